@@ -0,0 +1,125 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log/slog"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+
+	"github.com/zynqcloud/api/internal/config"
+	"github.com/zynqcloud/api/internal/crypto"
+	"github.com/zynqcloud/api/internal/database"
+	"github.com/zynqcloud/api/internal/handlers"
+)
+
+const commandUsage = `Usage: api [command] [flags]
+
+Without a command the API server starts.
+
+Commands:
+  migrate      apply, revert or list schema migrations
+  rotate-key   re-wrap every file key with a new master key
+`
+
+// runCommand executes a maintenance subcommand and returns the exit code.
+func runCommand(cfg *config.Config, name string, args []string) int {
+	switch name {
+	case "migrate":
+		return runMigrate(cfg, args)
+	case "rotate-key":
+		return runRotateKey(cfg, args)
+	case "help", "-h", "--help":
+		fmt.Print(commandUsage)
+		return 0
+	default:
+		fmt.Fprintf(os.Stderr, "unknown command %q\n\n%s", name, commandUsage)
+		return 2
+	}
+}
+
+// runRotateKey re-wraps all DEKs under the new master key. It is safe to stop
+// and run again; converted rows are skipped on the next run.
+func runRotateKey(cfg *config.Config, args []string) int {
+	fs := flag.NewFlagSet("rotate-key", flag.ContinueOnError)
+	newKey := fs.String("new-key", "", "base64 master key to re-wrap with (default: the configured KEY_PROVIDER)")
+	oldKeys := fs.String("old-key", strings.Join(cfg.FileEncryptionOldKeys, ","), "comma-separated base64 master keys being retired (default FILE_ENCRYPTION_OLD_KEYS)")
+	batch := fs.Int("batch", 500, "rows re-wrapped per transaction")
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+	if *oldKeys == "" {
+		fmt.Fprintln(os.Stderr, "rotate-key: at least one old key is required (-old-key or FILE_ENCRYPTION_OLD_KEYS)")
+		return 2
+	}
+
+	var kek crypto.KeyProvider
+	if *newKey != "" {
+		k, err := crypto.NewStaticKey(*newKey)
+		if err != nil {
+			slog.Error("invalid new key", "error", err)
+			return 1
+		}
+		kek = k
+	} else {
+		k, err := loadKeyProvider(cfg)
+		if err != nil || k == nil {
+			slog.Error("no new key: configure KEY_PROVIDER or pass -new-key", "provider", cfg.KeyProvider, "error", err)
+			return 1
+		}
+		kek = k
+	}
+	c, err := crypto.NewWithProvider(kek)
+	if err != nil {
+		slog.Error("failed to initialize crypto", "error", err)
+		return 1
+	}
+	var retired []string
+	for _, k := range strings.Split(*oldKeys, ",") {
+		if k = strings.TrimSpace(k); k == "" {
+			continue
+		}
+		if err := c.AddPreviousKey(k); err != nil {
+			slog.Error("invalid old key", "error", err)
+			return 1
+		}
+		retired = append(retired, k)
+	}
+
+	db, err := database.Connect(cfg)
+	if err != nil {
+		slog.Error("failed to connect to database", "error", err)
+		return 1
+	}
+
+	// Refuse to run with keys unrelated to this instance: the rows would all
+	// fail to unwrap, and a first-boot fingerprint would be overwritten.
+	stored, err := storedKeyFingerprint(db)
+	if err != nil || stored == "" {
+		slog.Error("no key fingerprint stored — start the server once before rotating keys", "error", err)
+		return 1
+	}
+	if stored != c.Fingerprint() && !isOldKeyFingerprint(retired, stored) {
+		slog.Error("stored key fingerprint matches neither the new key nor an old key")
+		return 1
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+
+	slog.Info("key rotation started", "key_id", c.KeyID())
+	res, err := handlers.RotateMasterKey(ctx, db, c, *batch, slog.Default())
+	if err != nil {
+		slog.Error("key rotation stopped — run the command again to resume", "rewrapped", res.Rewrapped, "error", err)
+		return 1
+	}
+	if res.Pending > 0 {
+		slog.Error("key rotation incomplete — some keys could not be unwrapped with the given old keys", "rewrapped", res.Rewrapped, "failed", res.Failed, "pending", res.Pending)
+		return 1
+	}
+	slog.Info("key rotation complete — the old keys can be removed from FILE_ENCRYPTION_OLD_KEYS", "rewrapped", res.Rewrapped)
+	return 0
+}
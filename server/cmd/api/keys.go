@@ -0,0 +1,61 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/zynqcloud/api/internal/config"
+	"github.com/zynqcloud/api/internal/crypto"
+	"gorm.io/gorm"
+)
+
+// loadKeyProvider builds the KEK provider selected by KEY_PROVIDER. It returns
+// nil without an error when the default env provider has no key configured.
+func loadKeyProvider(cfg *config.Config) (crypto.KeyProvider, error) {
+	switch cfg.KeyProvider {
+	case "env", "":
+		if cfg.FileEncryptionMasterKey == "" {
+			return nil, nil
+		}
+		return crypto.NewStaticKey(cfg.FileEncryptionMasterKey)
+	case "file":
+		if cfg.MasterKeyFile == "" {
+			return nil, fmt.Errorf("FILE_ENCRYPTION_MASTER_KEY_FILE is not set")
+		}
+		return crypto.NewKeyFile(cfg.MasterKeyFile)
+	case "vault":
+		return crypto.NewVaultTransit(crypto.VaultTransitConfig{
+			Address:   cfg.VaultAddr,
+			Token:     cfg.VaultToken,
+			Namespace: cfg.VaultNamespace,
+			Mount:     cfg.VaultTransitMount,
+			KeyName:   cfg.VaultTransitKey,
+		})
+	default:
+		return nil, fmt.Errorf("unknown KEY_PROVIDER %q", cfg.KeyProvider)
+	}
+}
+
+// storedKeyFingerprint returns the key_fingerprint setting, or "" if unset.
+func storedKeyFingerprint(db *gorm.DB) (string, error) {
+	var stored struct{ Value string }
+	if err := db.Raw("SELECT value::text AS value FROM settings WHERE user_id IS NULL AND key = 'key_fingerprint' LIMIT 1").Scan(&stored).Error; err != nil {
+		return "", err
+	}
+	if stored.Value == "null" {
+		return "", nil
+	}
+	// Strip surrounding JSON quotes if value came back as a JSON string.
+	return strings.Trim(stored.Value, `"`), nil
+}
+
+// isOldKeyFingerprint reports whether fingerprint belongs to one of the
+// retired master keys.
+func isOldKeyFingerprint(oldKeys []string, fingerprint string) bool {
+	for _, k := range oldKeys {
+		if crypto.Fingerprint(k) == fingerprint {
+			return true
+		}
+	}
+	return false
+}
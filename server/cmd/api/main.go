@@ -2,8 +2,6 @@ package main
 
 import (
 	"context"
-	"crypto/sha256"
-	"encoding/hex"
 	"log/slog"
 	"net/http"
 	"os"
@@ -35,6 +33,11 @@ func main() {
 	}
 	slog.SetDefault(slog.New(slog.NewTextHandler(os.Stdout, &slog.HandlerOptions{Level: logLevel})))
 
+	// Maintenance subcommands (e.g. `api rotate-key`) run instead of the server.
+	if len(os.Args) > 1 {
+		os.Exit(runCommand(cfg, os.Args[1], os.Args[2:]))
+	}
+
 	slog.Info("starting ZynqCloud API", "port", cfg.Port, "env", cfg.NodeEnv)
 
 	// Fail fast on missing critical config
@@ -54,54 +57,47 @@ func main() {
 	}
 	slog.Info("database connected")
 
-	// Verify schema is reachable (migrations run via postgres.Dockerfile init scripts)
-	if err := db.Raw("SELECT 1 FROM users LIMIT 1").Error; err != nil {
-		slog.Error("schema check failed — ensure migrations have run", "error", err)
-		os.Exit(1)
-	}
-	slog.Info("schema verified")
-
-	// Auto-create audit_logs table if it doesn't exist yet.
-	if err := db.Exec(`
-		CREATE TABLE IF NOT EXISTS audit_logs (
-			id            UUID        PRIMARY KEY DEFAULT uuid_generate_v4(),
-			created_at    TIMESTAMPTZ NOT NULL DEFAULT NOW(),
-			user_id       UUID,
-			user_name     TEXT        NOT NULL DEFAULT '',
-			user_email    TEXT        NOT NULL DEFAULT '',
-			action        TEXT        NOT NULL,
-			resource_type TEXT        NOT NULL DEFAULT '',
-			resource_name TEXT        NOT NULL DEFAULT '',
-			resource_id   TEXT        NOT NULL DEFAULT '',
-			ip_address    TEXT        NOT NULL DEFAULT '',
-			metadata      JSONB
-		);
-		CREATE INDEX IF NOT EXISTS idx_audit_logs_created_at ON audit_logs (created_at DESC);
-		CREATE INDEX IF NOT EXISTS idx_audit_logs_user_id    ON audit_logs (user_id);
-		CREATE INDEX IF NOT EXISTS idx_audit_logs_action     ON audit_logs (action);
-	`).Error; err != nil {
-		slog.Error("failed to create audit_logs table", "error", err)
+	// Apply pending schema migrations. The advisory lock inside the migrator
+	// lets several instances start at once; only one of them migrates.
+	if err := runMigrations(context.Background(), db); err != nil {
+		slog.Error("schema migration failed", "error", err)
 		os.Exit(1)
 	}
-	slog.Info("audit_logs table ready")
+	slog.Info("schema up to date")
 
-	// Add avatar column to users if it doesn't exist yet (idempotent).
-	if err := db.Exec(`ALTER TABLE users ADD COLUMN IF NOT EXISTS avatar TEXT;`).Error; err != nil {
-		slog.Error("failed to add avatar column", "error", err)
+	// Initialize crypto (may be nil if not configured — upload/download will 503)
+	kek, err := loadKeyProvider(cfg)
+	if err != nil {
+		slog.Error("failed to initialize key provider", "provider", cfg.KeyProvider, "error", err)
 		os.Exit(1)
 	}
-	slog.Info("avatar column ready")
+	var cryptoSvc *crypto.Crypto
+	if kek != nil {
+		cryptoSvc, err = crypto.NewWithProvider(kek)
+		if err != nil {
+			slog.Error("failed to initialize crypto", "provider", cfg.KeyProvider, "error", err)
+			os.Exit(1)
+		}
+		for _, k := range cfg.FileEncryptionOldKeys {
+			if err := cryptoSvc.AddPreviousKey(k); err != nil {
+				slog.Error("invalid key in FILE_ENCRYPTION_OLD_KEYS", "error", err)
+				os.Exit(1)
+			}
+		}
+		slog.Info("crypto initialized", "provider", cfg.KeyProvider, "key_id", cryptoSvc.KeyID(), "old_keys", len(cfg.FileEncryptionOldKeys))
+	} else {
+		slog.Warn("FILE_ENCRYPTION_MASTER_KEY not set — file upload/download disabled")
+	}
 
 	// Verify master key fingerprint — fail hard if the key has changed since first boot.
 	// This prevents silently encrypting new files with the wrong key while old files
-	// become permanently unreadable.
-	if cfg.FileEncryptionMasterKey != "" {
-		sum := sha256.Sum256([]byte(cfg.FileEncryptionMasterKey))
-		fingerprint := hex.EncodeToString(sum[:])
-
-		var stored struct{ Value string }
-		err := db.Raw("SELECT value::text AS value FROM settings WHERE user_id IS NULL AND key = 'key_fingerprint' LIMIT 1").Scan(&stored).Error
-		if err != nil || stored.Value == "" || stored.Value == "null" {
+	// become permanently unreadable. During a key rotation the stored fingerprint
+	// still belongs to one of FILE_ENCRYPTION_OLD_KEYS until every DEK is re-wrapped.
+	if cryptoSvc != nil {
+		fingerprint := cryptoSvc.Fingerprint()
+
+		stored, err := storedKeyFingerprint(db)
+		if err != nil || stored == "" {
 			// First boot — store fingerprint.
 			if err := db.Exec(
 				"INSERT INTO settings (id, key, value, user_id) VALUES (uuid_generate_v4(), 'key_fingerprint', to_jsonb(?::text), NULL) ON CONFLICT DO NOTHING",
@@ -111,14 +107,13 @@ func main() {
 				os.Exit(1)
 			}
 			slog.Info("key fingerprint stored (first boot)")
-		} else {
-			// Strip surrounding JSON quotes if value came back as a JSON string.
-			stored.Value = strings.Trim(stored.Value, `"`)
-			if stored.Value != fingerprint {
-				slog.Error("FILE_ENCRYPTION_MASTER_KEY has changed since first boot — all previously encrypted files will be unreadable. Restore the original key or run a key migration before starting.")
-				os.Exit(1)
-			}
+		} else if stored == fingerprint {
 			slog.Info("key fingerprint verified")
+		} else if isOldKeyFingerprint(cfg.FileEncryptionOldKeys, stored) {
+			slog.Warn("key rotation in progress — DEKs are still wrapped with an old key; run `api rotate-key` or POST /api/v1/admin/keys/rotate to finish it")
+		} else {
+			slog.Error("FILE_ENCRYPTION_MASTER_KEY has changed since first boot — all previously encrypted files will be unreadable. Restore the original key, or list it in FILE_ENCRYPTION_OLD_KEYS and run a key rotation, before starting.")
+			os.Exit(1)
 		}
 	}
 
@@ -126,42 +121,68 @@ func main() {
 	handlers.LoadSMTPFromDB(db, cfg)
 	slog.Info("SMTP settings loaded from DB")
 
-	// Initialize crypto (may be nil if not configured — upload/download will 503)
-	var cryptoSvc *crypto.Crypto
-	if cfg.FileEncryptionMasterKey != "" {
-		cryptoSvc, err = crypto.New(cfg.FileEncryptionMasterKey)
+	// Initialize storage backend
+	var backend storage.Backend
+	switch cfg.StorageBackend {
+	case "s3":
+		s3Backend, err := storage.NewS3Compatible(storage.S3Config{
+			Endpoint:       cfg.S3Endpoint,
+			Region:         cfg.S3Region,
+			Bucket:         cfg.S3Bucket,
+			AccessKey:      cfg.S3AccessKey,
+			SecretKey:      cfg.S3SecretKey,
+			Prefix:         cfg.S3Prefix,
+			ForcePathStyle: cfg.S3ForcePathStyle,
+			PartSize:       int64(cfg.S3PartSizeMB) << 20,
+		})
 		if err != nil {
-			slog.Error("failed to initialize crypto", "error", err)
+			slog.Error("failed to initialize storage backend", "backend", "s3", "error", err)
 			os.Exit(1)
 		}
-		slog.Info("crypto initialized")
-	} else {
-		slog.Warn("FILE_ENCRYPTION_MASTER_KEY not set — file upload/download disabled")
-	}
-
-	// Initialize storage backend
-	localBackend, err := storage.NewLocal(cfg.StoragePath)
-	if err != nil {
-		slog.Error("failed to initialize storage backend", "error", err)
+		backend = s3Backend
+		slog.Info("storage backend initialized", "backend", "s3", "endpoint", cfg.S3Endpoint, "bucket", cfg.S3Bucket)
+	case "local", "":
+		localBackend, err := storage.NewLocal(cfg.StoragePath)
+		if err != nil {
+			slog.Error("failed to initialize storage backend", "error", err)
+			os.Exit(1)
+		}
+		if cfg.DiskStatsPath != "" {
+			localBackend.SetDiskStatsPath(cfg.DiskStatsPath)
+			slog.Info("disk stats override", "path", cfg.DiskStatsPath)
+		}
+		backend = localBackend
+		slog.Info("storage backend initialized", "backend", "local", "path", cfg.StoragePath)
+	default:
+		slog.Error("unknown STORAGE_BACKEND", "value", cfg.StorageBackend)
 		os.Exit(1)
 	}
-	if cfg.DiskStatsPath != "" {
-		localBackend.SetDiskStatsPath(cfg.DiskStatsPath)
-		slog.Info("disk stats override", "path", cfg.DiskStatsPath)
-	}
-	slog.Info("storage backend initialized", "path", cfg.StoragePath)
 
 	// Start cleanup goroutine for stale uploads
 	ctx, cancel := context.WithCancel(context.Background())
 	defer cancel()
-	uploadsDir := cfg.StoragePath + "/.uploads"
+	uploadsDir := cfg.UploadTempDir
 	if err := os.MkdirAll(uploadsDir, 0o750); err != nil {
 		slog.Error("failed to create uploads directory", "dir", uploadsDir, "error", err)
 		os.Exit(1)
 	}
 	storage.RunCleanupPeriodic(ctx, uploadsDir, 24*time.Hour, time.Hour, slog.Default())
+	handlers.RunBlobGCPeriodic(ctx, db, storage.NewCAS(backend), time.Hour, 24*time.Hour, slog.Default())
+	handlers.RunVersionPrunePeriodic(ctx, db, backend, cfg, time.Hour, slog.Default())
+	handlers.RunSpaceTrashPurgePeriodic(ctx, db, backend, time.Hour, slog.Default())
+	handlers.RunSessionPrunePeriodic(ctx, db, time.Hour, slog.Default())
+	if cfg.SearchContentIndex && cryptoSvc != nil {
+		handlers.RunSearchIndexPeriodic(ctx, db, cryptoSvc, backend, 5*time.Minute, slog.Default())
+	}
+	if dir := handlers.NewDirectory(cfg); dir != nil && cfg.LDAPSyncIntervalMinutes > 0 {
+		handlers.RunLDAPSyncPeriodic(ctx, db, dir, cfg, time.Duration(cfg.LDAPSyncIntervalMinutes)*time.Minute, slog.Default())
+	}
 
-	// Build router
+	// Build router. WebDAV methods must be known to chi before any route is
+	// added.
+	for _, m := range handlers.WebDAVMethods {
+		chi.RegisterMethod(m)
+	}
 	r := chi.NewRouter()
 
 	// Global middleware
@@ -174,21 +195,36 @@ func main() {
 	handlers.SpaceBootstrap(db)
 	slog.Info("space bootstrap complete")
 
+	// Hash share passwords stored in plaintext by earlier versions
+	if n, err := handlers.MigrateSharePasswords(db); err != nil {
+		slog.Error("failed to hash share passwords", "hashed", n, "error", err)
+	} else if n > 0 {
+		slog.Info("hashed legacy share passwords", "count", n)
+	}
+
 	// Initialize handlers
 	healthH := handlers.NewHealthHandler(db)
-	authH := handlers.NewAuthHandler(db, cfg)
-	filesH := handlers.NewFilesHandler(db, cfg, cryptoSvc, localBackend)
+	authH := handlers.NewAuthHandler(db, cfg, cryptoSvc)
+	filesH := handlers.NewFilesHandler(db, cfg, cryptoSvc, backend)
 	usersH := handlers.NewUsersHandler(db)
 	settingsH := handlers.NewSettingsHandler(db, cfg)
 	invitationsH := handlers.NewInvitationsHandler(db, cfg)
-	storageStatsH := handlers.NewStorageStatsHandler(localBackend, db)
-	shareH := handlers.NewShareHandler(db, cfg, cryptoSvc, localBackend)
-	spacesH := handlers.NewSpacesHandler(db, cfg, cryptoSvc, localBackend)
+	storageStatsH := handlers.NewStorageStatsHandler(backend, db)
+	shareH := handlers.NewShareHandler(db, cfg, cryptoSvc, backend)
+	spacesH := handlers.NewSpacesHandler(db, cfg, cryptoSvc, backend)
+	groupsH := handlers.NewGroupsHandler(db, cfg)
 	notifChannelsH := handlers.NewNotificationChannelsHandler(db, cfg)
 	auditH := handlers.NewAuditHandler(db)
+	keysH := handlers.NewKeysHandler(db, cryptoSvc)
+	davH := handlers.NewWebDAVHandler(db, filesH, spacesH)
+	searchH := handlers.NewSearchHandler(db, cfg, cryptoSvc)
 
-	authMiddleware := mw.Auth(cfg.JWTSecret)
-	adminMiddleware := mw.RequireRole("admin", "owner")
+	authMiddleware := mw.Auth(cfg.JWTSecret, handlers.NewSessionStore(db), handlers.NewTokenStore(db))
+	// Admin routes need an admin/owner account and, for access tokens, the
+	// admin scope.
+	requireAdmin := mw.RequireRole("admin", "owner")
+	adminScope := mw.RequireScope(mw.ScopeAdmin, mw.ScopeAdmin)
+	adminMiddleware := func(next http.Handler) http.Handler { return requireAdmin(adminScope(next)) }
 
 	// Rate limiters (in-memory, per IP, sliding window)
 	loginLimiter := mw.NewRateLimiter(10, 15*time.Minute) // 10 attempts / 15 min
@@ -205,18 +241,46 @@ func main() {
 			r.Get("/setup-status", authH.SetupStatus)
 			r.With(registerLimiter.Middleware).Post("/register", authH.Register)
 			r.With(loginLimiter.Middleware).Post("/login", authH.Login)
+			r.With(loginLimiter.Middleware).Post("/login/2fa", authH.LoginSecondFactor)
+			r.With(loginLimiter.Middleware).Post("/login/2fa/setup", authH.LoginSetupSecondFactor)
+			r.With(loginLimiter.Middleware).Post("/login/2fa/enable", authH.LoginEnableSecondFactor)
+			r.With(loginLimiter.Middleware).Post("/passkeys/login/begin", authH.BeginPasskeyLogin)
+			r.With(loginLimiter.Middleware).Post("/passkeys/login/finish", authH.FinishPasskeyLogin)
+			r.With(loginLimiter.Middleware).Get("/oidc/login", authH.OIDCLogin)
+			r.With(loginLimiter.Middleware).Get("/oidc/callback", authH.OIDCCallback)
 			r.Post("/logout", authH.Logout)
+			r.Post("/refresh", authH.Refresh)
 			r.With(forgotLimiter.Middleware).Post("/forgot-password", authH.ForgotPassword)
 			r.Post("/reset-password", authH.ResetPassword)
 
-			// Protected auth routes
+			// Protected auth routes. Access tokens may only read /me; the
+			// rest manages the account and needs a browser session.
 			r.Group(func(r chi.Router) {
 				r.Use(authMiddleware)
 				r.Get("/me", authH.Me)
+			})
+			r.Group(func(r chi.Router) {
+				r.Use(authMiddleware, mw.RequireSession)
 				r.Patch("/profile", authH.UpdateProfile)
 				r.Post("/change-password", authH.ChangePassword)
 				r.Patch("/avatar", authH.UploadAvatar)
 				r.Delete("/avatar", authH.DeleteAvatar)
+				r.Get("/app-passwords", authH.ListAppPasswords)
+				r.Post("/app-passwords", authH.CreateAppPassword)
+				r.Delete("/app-passwords/{id}", authH.DeleteAppPassword)
+				r.Get("/sessions", authH.ListSessions)
+				r.Delete("/sessions", authH.RevokeOtherSessions)
+				r.Delete("/sessions/{id}", authH.RevokeSession)
+				r.Get("/2fa", authH.TwoFactorStatus)
+				r.Post("/2fa/setup", authH.SetupTwoFactor)
+				r.Post("/2fa/enable", authH.EnableTwoFactor)
+				r.Post("/2fa/disable", authH.DisableTwoFactor)
+				r.Post("/2fa/recovery-codes", authH.RegenerateRecoveryCodes)
+				r.Get("/passkeys", authH.ListPasskeys)
+				r.Post("/passkeys/register/begin", authH.BeginPasskeyRegistration)
+				r.Post("/passkeys/register/finish", authH.FinishPasskeyRegistration)
+				r.Patch("/passkeys/{id}", authH.RenamePasskey)
+				r.Delete("/passkeys/{id}", authH.DeletePasskey)
 			})
 		})
 
@@ -230,6 +294,14 @@ func main() {
 		r.Route("/public/share", func(r chi.Router) {
 			r.With(shareLimiter.Middleware).Get("/{token}", shareH.GetPublicShare)
 			r.With(shareLimiter.Middleware).Get("/{token}/download", shareH.DownloadPublicShare)
+			r.With(shareLimiter.Middleware).Get("/{token}/items", shareH.ListPublicShare)
+			r.With(shareLimiter.Middleware).Get("/{token}/items/{id}/download", shareH.DownloadPublicShareItem)
+		})
+
+		// File request uploads (no auth required) — rate limited
+		r.Route("/public/upload", func(r chi.Router) {
+			r.With(shareLimiter.Middleware).Get("/{token}", shareH.GetFileRequest)
+			r.With(shareLimiter.Middleware).Post("/{token}", shareH.UploadToFileRequest)
 		})
 
 		// Invite validation/accept (no auth required)
@@ -243,22 +315,34 @@ func main() {
 		r.Group(func(r chi.Router) {
 			r.Use(authMiddleware)
 
+			// Search (names and indexed document content)
+			r.With(mw.RequireScope(mw.ScopeFilesRead, mw.ScopeFilesRead)).Get("/search", searchH.Search)
+
 			// Files
 			r.Route("/files", func(r chi.Router) {
+				r.Use(mw.RequireScope(mw.ScopeFilesRead, mw.ScopeFilesWrite))
 				r.Get("/", filesH.List)
 				r.Post("/", filesH.Create)
 				r.Get("/trash", filesH.Trash)
 				r.Delete("/trash/empty", filesH.EmptyTrash)
 				r.Get("/shared", filesH.SharedWithMe)
 				r.Get("/public-shares", filesH.MyPublicShares)
+				r.Get("/public-shares/{shareId}/access", filesH.ShareAccessLog)
 				r.Get("/private-shares", filesH.MyPrivateShares)
 				r.Delete("/shares/{shareId}", filesH.RevokeShare)
 				r.Patch("/shares/{shareId}/public-settings", filesH.UpdatePublicShare)
+				r.Get("/file-requests", filesH.MyFileRequests)
+				r.Post("/file-requests", filesH.CreateFileRequest)
+				r.Patch("/file-requests/{requestId}", filesH.UpdateFileRequest)
+				r.Delete("/file-requests/{requestId}", filesH.DeleteFileRequest)
+				r.Get("/file-requests/{requestId}/uploads", filesH.ListFileRequestUploads)
 				r.Delete("/bulk", filesH.BulkDelete)
 				r.Post("/check-duplicate", filesH.CheckDuplicate)
 
 				r.Get("/{id}", filesH.GetByID)
 				r.Patch("/{id}", filesH.Rename)
+				r.Post("/{id}/copy", filesH.Copy)
+				r.Post("/{id}/move", filesH.Move)
 				r.Put("/{id}/upload", filesH.Upload)
 				r.Post("/{id}/upload-session", filesH.StartUploadSession)
 				r.Get("/{id}/upload-session/{sessionId}", filesH.GetUploadSession)
@@ -266,6 +350,12 @@ func main() {
 				r.Post("/{id}/upload-session/{sessionId}/complete", filesH.CompleteUploadSession)
 				r.Delete("/{id}/upload-session/{sessionId}", filesH.AbortUploadSession)
 				r.Get("/{id}/download", filesH.Download)
+				r.Get("/{id}/versions", filesH.ListVersions)
+				r.Get("/{id}/versions/{versionId}/download", filesH.DownloadVersion)
+				r.Post("/{id}/versions/{versionId}/restore", filesH.RestoreVersion)
+				r.Get("/{id}/comments", filesH.ListComments)
+				r.Post("/{id}/comments", filesH.CreateComment)
+				r.Delete("/{id}/comments/{commentId}", filesH.DeleteComment)
 				r.Delete("/{id}", filesH.Delete)
 				r.Post("/{id}/restore", filesH.Restore)
 				r.Delete("/{id}/permanent", filesH.PermanentDelete)
@@ -274,27 +364,44 @@ func main() {
 
 			// Spaces
 			r.Route("/spaces", func(r chi.Router) {
+				r.Use(mw.RequireScope(mw.ScopeSpacesRead, mw.ScopeSpacesWrite))
 				r.Get("/", spacesH.List)
 				r.Post("/", spacesH.Create)
+				r.Get("/discover", spacesH.Discover)
 				r.Route("/{id}", func(r chi.Router) {
+					r.Patch("/", spacesH.UpdateSettings)
+					r.Post("/join", spacesH.Join)
+					r.Delete("/join", spacesH.CancelJoin)
+					r.Get("/join-requests", spacesH.ListJoinRequests)
+					r.Post("/join-requests/{rid}/approve", spacesH.ApproveJoinRequest)
+					r.Post("/join-requests/{rid}/reject", spacesH.RejectJoinRequest)
 					r.Get("/files", spacesH.GetFiles)
 					r.Post("/files", spacesH.CreateFile)
 					r.Put("/files/{fid}/upload", spacesH.Upload)
 					r.Get("/files/{fid}/download", spacesH.Download)
 					r.Patch("/files/{fid}", spacesH.RenameFile)
 					r.Delete("/files/{fid}", spacesH.DeleteFile)
+					r.Get("/trash", spacesH.Trash)
+					r.Delete("/trash", spacesH.EmptyTrash)
+					r.Post("/trash/{fid}/restore", spacesH.RestoreFile)
+					r.Delete("/trash/{fid}", spacesH.PurgeFile)
 					r.Get("/members", spacesH.ListMembers)
+					r.Post("/members", spacesH.AddMember)
 					r.Patch("/members/{uid}", spacesH.UpdateMember)
 					r.Delete("/members/{uid}", spacesH.RemoveMember)
+					r.Get("/groups", spacesH.ListGroups)
+					r.Post("/groups", spacesH.AddGroup)
+					r.Patch("/groups/{gid}", spacesH.UpdateGroup)
+					r.Delete("/groups/{gid}", spacesH.RemoveGroup)
 					r.Get("/activity", spacesH.GetActivity)
 				})
 			})
 
 			// Settings
 			r.Route("/settings", func(r chi.Router) {
-				r.Get("/", settingsH.GetUserSettings)
-				r.Patch("/", settingsH.UpdateUserSettings)
-				r.Put("/", settingsH.UpdateUserSettings)
+				r.With(mw.RequireSession).Get("/", settingsH.GetUserSettings)
+				r.With(mw.RequireSession).Patch("/", settingsH.UpdateUserSettings)
+				r.With(mw.RequireSession).Put("/", settingsH.UpdateUserSettings)
 
 				r.Group(func(r chi.Router) {
 					r.Use(adminMiddleware)
@@ -319,7 +426,7 @@ func main() {
 			})
 
 			// Storage
-			r.Get("/storage/overview", storageStatsH.Overview)
+			r.With(mw.RequireScope(mw.ScopeFilesRead, mw.ScopeFilesRead)).Get("/storage/overview", storageStatsH.Overview)
 			r.Route("/storage/users", func(r chi.Router) {
 				r.Use(adminMiddleware)
 				r.Get("/", storageStatsH.GetAllUsersStorage)
@@ -330,21 +437,50 @@ func main() {
 			// System (protected)
 			r.With(adminMiddleware).Post("/system/update", handlers.SystemUpdate)
 
-			// Users (admin only except self-access)
+			// Users (admin only except self-access). Deleting an account
+			// with an access token takes the admin scope.
 			r.Route("/users", func(r chi.Router) {
+				r.Use(mw.RequireScope(mw.ScopeFilesRead, mw.ScopeAdmin))
 				r.Get("/shareable", usersH.ListShareable)
 				r.Get("/{id}", usersH.GetByID)
 				r.Delete("/{id}", usersH.Delete)
 			})
 
+			// Groups: everyone can list them to pick one, admins manage them.
+			r.Route("/groups", func(r chi.Router) {
+				r.Use(mw.RequireScope(mw.ScopeFilesRead, mw.ScopeAdmin))
+				r.Get("/", groupsH.List)
+				r.Group(func(r chi.Router) {
+					r.Use(adminMiddleware)
+					r.Post("/", groupsH.Create)
+					r.Patch("/{id}", groupsH.Update)
+					r.Delete("/{id}", groupsH.Delete)
+					r.Get("/{id}/members", groupsH.ListMembers)
+					r.Post("/{id}/members", groupsH.AddMembers)
+					r.Delete("/{id}/members/{uid}", groupsH.RemoveMember)
+				})
+			})
+
 			// Admin users routes
 			r.Route("/admin/users", func(r chi.Router) {
 				r.Use(adminMiddleware)
 				r.Get("/", usersH.List)
 				r.Put("/{id}", usersH.Update)
 				r.Delete("/{id}", usersH.Delete)
+				r.Delete("/{id}/2fa", authH.ResetTwoFactor)
+				r.Delete("/{id}/sessions", authH.RevokeUserSessions)
 			})
 
+			// Two-factor policy (admin/owner only)
+			r.Route("/admin/2fa-policy", func(r chi.Router) {
+				r.Use(adminMiddleware)
+				r.Get("/", authH.GetTwoFactorPolicy)
+				r.Put("/", authH.UpdateTwoFactorPolicy)
+			})
+
+			// Directory sync (admin/owner only)
+			r.With(adminMiddleware).Post("/admin/ldap/sync", authH.SyncLDAP)
+
 			// Invitations (admin/owner only)
 			r.Route("/invites", func(r chi.Router) {
 				r.Use(adminMiddleware)
@@ -358,9 +494,23 @@ func main() {
 				r.Use(adminMiddleware)
 				r.Get("/", auditH.List)
 			})
+
+			// Encryption key rotation (admin/owner only)
+			r.Route("/admin/keys", func(r chi.Router) {
+				r.Use(adminMiddleware)
+				r.Get("/", keysH.Status)
+				r.Post("/rotate", keysH.Rotate)
+			})
 		})
 	})
 
+	// WebDAV (HTTP Basic auth with an app password)
+	r.Route(handlers.DAVPrefix, func(r chi.Router) {
+		r.Use(davH.Authenticate)
+		r.Handle("/", davH)
+		r.Handle("/*", davH)
+	})
+
 	// Serve React SPA from staticDir if configured.
 	// All non-API routes fall back to index.html so client-side routing works.
 	staticDir := cfg.StaticDir
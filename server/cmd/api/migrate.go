@@ -0,0 +1,110 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log/slog"
+	"os"
+	"text/tabwriter"
+
+	"github.com/zynqcloud/api/internal/config"
+	"github.com/zynqcloud/api/internal/database"
+	"github.com/zynqcloud/api/migrations"
+	"gorm.io/gorm"
+)
+
+const migrateUsage = `Usage: api migrate <command>
+
+Commands:
+  status          list migrations and whether they are applied
+  up              apply all pending migrations
+  down [-steps N] revert the last N applied migrations (default 1)
+`
+
+func newMigrator(db *gorm.DB) (*database.Migrator, error) {
+	sqlDB, err := db.DB()
+	if err != nil {
+		return nil, err
+	}
+	return database.NewMigrator(sqlDB, migrations.FS, slog.Default())
+}
+
+// runMigrations applies every pending embedded migration.
+func runMigrations(ctx context.Context, db *gorm.DB) error {
+	m, err := newMigrator(db)
+	if err != nil {
+		return err
+	}
+	_, err = m.Up(ctx)
+	return err
+}
+
+// runMigrate implements `api migrate`.
+func runMigrate(cfg *config.Config, args []string) int {
+	if len(args) == 0 {
+		fmt.Fprint(os.Stderr, migrateUsage)
+		return 2
+	}
+	sub, args := args[0], args[1:]
+	fs := flag.NewFlagSet("migrate "+sub, flag.ContinueOnError)
+	steps := fs.Int("steps", 1, "number of migrations to revert")
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+
+	db, err := database.Connect(cfg)
+	if err != nil {
+		slog.Error("failed to connect to database", "error", err)
+		return 1
+	}
+	m, err := newMigrator(db)
+	if err != nil {
+		slog.Error("failed to load migrations", "error", err)
+		return 1
+	}
+	ctx := context.Background()
+
+	switch sub {
+	case "status":
+		status, err := m.Status(ctx)
+		if err != nil {
+			slog.Error("failed to read migration status", "error", err)
+			return 1
+		}
+		tw := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(tw, "VERSION\tNAME\tAPPLIED AT")
+		for _, s := range status {
+			applied := "pending"
+			if s.AppliedAt != nil {
+				applied = s.AppliedAt.Local().Format("2006-01-02 15:04:05")
+			}
+			fmt.Fprintf(tw, "%03d\t%s\t%s\n", s.Version, s.Name, applied)
+		}
+		tw.Flush()
+		return 0
+	case "up":
+		n, err := m.Up(ctx)
+		if err != nil {
+			slog.Error("migration failed", "applied", n, "error", err)
+			return 1
+		}
+		slog.Info("migrations applied", "count", n)
+		return 0
+	case "down":
+		if *steps < 1 {
+			fmt.Fprintln(os.Stderr, "migrate down: -steps must be at least 1")
+			return 2
+		}
+		n, err := m.Down(ctx, *steps)
+		if err != nil {
+			slog.Error("revert failed", "reverted", n, "error", err)
+			return 1
+		}
+		slog.Info("migrations reverted", "count", n)
+		return 0
+	default:
+		fmt.Fprintf(os.Stderr, "unknown migrate command %q\n\n%s", sub, migrateUsage)
+		return 2
+	}
+}
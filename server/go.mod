@@ -3,7 +3,9 @@ module github.com/zynqcloud/api
 go 1.25.9
 
 require (
+	github.com/go-asn1-ber/asn1-ber v1.5.5
 	github.com/go-chi/chi/v5 v5.2.2
+	github.com/go-ldap/ldap/v3 v3.4.8
 	github.com/golang-jwt/jwt/v5 v5.2.2
 	github.com/google/uuid v1.6.0
 	golang.org/x/crypto v0.37.0
@@ -13,6 +15,7 @@ require (
 )
 
 require (
+	github.com/Azure/go-ntlmssp v0.0.0-20221128193559-754e69321358 // indirect
 	github.com/jackc/pgpassfile v1.0.0 // indirect
 	github.com/jackc/pgservicefile v0.0.0-20221227161230-091c0ba34f0a // indirect
 	github.com/jackc/pgx/v5 v5.5.5 // indirect
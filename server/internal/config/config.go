@@ -1,11 +1,14 @@
 package config
 
 import (
+	"fmt"
 	"log/slog"
+	"net/url"
 	"os"
 	"strconv"
 	"strings"
 	"sync"
+	"time"
 )
 
 type Config struct {
@@ -18,12 +21,32 @@ type Config struct {
 	DatabasePassword        string
 	DatabaseName            string
 	JWTSecret               string
-	JWTExpiresIn            string // "7d" default
+	JWTExpiresIn            string        // "7d" default
+	SessionLifetime         time.Duration // JWTExpiresIn parsed: how long an idle session survives between refreshes
+	AccessTokenTTLMinutes   int           // lifetime of the short access token a session hands out
 	CookieDomain            string
 	CORSOrigins             []string
 	FrontendURL             string
-	FileEncryptionMasterKey string // base64-encoded 32 bytes
+	FileEncryptionMasterKey string   // base64-encoded 32 bytes
+	FileEncryptionOldKeys   []string // retired master keys still accepted for decryption during a key rotation
+	KeyProvider             string   // where the KEK lives: "env" (default), "file" or "vault"
+	MasterKeyFile           string   // KEY_PROVIDER=file: path to a base64 or raw 32-byte key
+	VaultAddr               string   // KEY_PROVIDER=vault: transit engine server
+	VaultToken              string
+	VaultNamespace          string
+	VaultTransitMount       string
+	VaultTransitKey         string
 	StoragePath             string
+	StorageBackend          string // "local" (default) or "s3"
+	UploadTempDir           string // local staging dir for in-flight uploads; must be on local disk for every backend
+	S3Endpoint              string
+	S3Region                string
+	S3Bucket                string
+	S3AccessKey             string
+	S3SecretKey             string
+	S3Prefix                string // optional key prefix so several instances can share a bucket
+	S3ForcePathStyle        bool   // true for MinIO and most self-hosted S3 servers
+	S3PartSizeMB            int
 	EmailEnabled            bool
 	SMTPHost                string
 	SMTPPort                int
@@ -40,8 +63,41 @@ type Config struct {
 	MaxAssemblyWorkers      int
 	SessionTTLHours         int
 	MinFreeBytes            int64
-	DiskStatsPath           string // override path for disk stats (useful in Docker to point at a host mount)
-	StaticDir               string // directory to serve the React SPA from (empty = disabled)
+	FileVersionRetention    int      // previous versions kept per file; 0 disables versioning
+	FileVersionMaxAgeDays   int      // versions older than this are purged; 0 = no age limit
+	SearchContentIndex      bool     // extract document text into the keyed full-text index
+	WebAuthnRPID            string   // passkey relying party ID (default: host of FRONTEND_URL)
+	WebAuthnOrigins         []string // origins allowed to use passkeys (default: FRONTEND_URL and CORS_ORIGIN)
+	PasswordLogin           bool     // allow email/password sign-in; false leaves SSO and passkeys
+	OIDCIssuer              string   // OpenID provider for single sign-on (empty = disabled)
+	OIDCClientID            string
+	OIDCClientSecret        string
+	OIDCRedirectURL         string // default: FRONTEND_URL + /api/v1/auth/oidc/callback
+	OIDCScopes              []string
+	OIDCProviderName        string   // label for the sign-in button
+	OIDCGroupsClaim         string   // ID token claim listing the user's groups
+	OIDCOwnerGroups         []string // IdP groups mapped to the owner role
+	OIDCAdminGroups         []string // IdP groups mapped to the admin role
+	OIDCAllowedGroups       []string // if set, only members of these groups may sign in
+	LDAPURL                 string   // ldap:// or ldaps:// directory for sign-in and user sync (empty = disabled)
+	LDAPStartTLS            bool
+	LDAPCACert              string // PEM file trusted for the directory's certificate
+	LDAPTLSSkipVerify       bool
+	LDAPBindDN              string // service account used to search for users
+	LDAPBindPassword        string
+	LDAPBaseDN              string
+	LDAPUserFilter          string // {username} is replaced by the escaped sign-in name
+	LDAPIDAttr              string // immutable entry ID (entryUUID, objectGUID)
+	LDAPNameAttr            string
+	LDAPEmailAttr           string
+	LDAPGroupAttr           string   // attribute listing group DNs (memberOf)
+	LDAPOwnerGroups         []string // directory groups (DN or CN) mapped to the owner role
+	LDAPAdminGroups         []string // directory groups mapped to the admin role
+	LDAPAllowedGroups       []string // if set, only members of these groups may sign in or are synced
+	LDAPSpaceGroups         string   // group:space[:role] entries separated by ';'
+	LDAPSyncIntervalMinutes int      // 0 disables the periodic sync
+	DiskStatsPath           string   // override path for disk stats (useful in Docker to point at a host mount)
+	StaticDir               string   // directory to serve the React SPA from (empty = disabled)
 	NodeEnv                 string
 	CookieSecure            bool // set Secure flag on auth cookie (default: true when NODE_ENV=production)
 }
@@ -76,11 +132,28 @@ func Load() *Config {
 		DatabaseName:            getEnv("DATABASE_NAME", "zynqcloud"),
 		JWTSecret:               getEnv("JWT_SECRET", ""),
 		JWTExpiresIn:            getEnv("JWT_EXPIRES_IN", "7d"),
+		AccessTokenTTLMinutes:   getEnvInt("ACCESS_TOKEN_TTL_MINUTES", 15),
 		CookieDomain:            getEnv("COOKIE_DOMAIN", ""),
 		CORSOrigins:             corsOrigins,
 		FrontendURL:             getEnv("FRONTEND_URL", "http://localhost:3000"),
 		FileEncryptionMasterKey: getEnv("FILE_ENCRYPTION_MASTER_KEY", ""),
+		KeyProvider:             strings.ToLower(getEnv("KEY_PROVIDER", "env")),
+		MasterKeyFile:           getEnv("FILE_ENCRYPTION_MASTER_KEY_FILE", ""),
+		VaultAddr:               getEnv("VAULT_ADDR", ""),
+		VaultToken:              getEnv("VAULT_TOKEN", ""),
+		VaultNamespace:          getEnv("VAULT_NAMESPACE", ""),
+		VaultTransitMount:       getEnv("VAULT_TRANSIT_MOUNT", "transit"),
+		VaultTransitKey:         getEnv("VAULT_TRANSIT_KEY", "zynqcloud"),
 		StoragePath:             getEnv("FILE_STORAGE_PATH", getEnv("STORAGE_PATH", "/data/files")),
+		StorageBackend:          strings.ToLower(getEnv("STORAGE_BACKEND", "local")),
+		S3Endpoint:              getEnv("S3_ENDPOINT", ""),
+		S3Region:                getEnv("S3_REGION", "us-east-1"),
+		S3Bucket:                getEnv("S3_BUCKET", ""),
+		S3AccessKey:             getEnv("S3_ACCESS_KEY", ""),
+		S3SecretKey:             getEnv("S3_SECRET_KEY", ""),
+		S3Prefix:                getEnv("S3_PREFIX", ""),
+		S3ForcePathStyle:        getEnv("S3_FORCE_PATH_STYLE", "true") == "true",
+		S3PartSizeMB:            getEnvInt("S3_PART_SIZE_MB", 16),
 		EmailEnabled:            getEnv("EMAIL_ENABLED", "false") == "true",
 		SMTPHost:                getEnv("SMTP_HOST", ""),
 		SMTPPort:                getEnvInt("SMTP_PORT", 587),
@@ -97,11 +170,72 @@ func Load() *Config {
 		MaxAssemblyWorkers:      getEnvInt("MAX_ASSEMBLY_WORKERS", 32),
 		SessionTTLHours:         getEnvInt("SESSION_TTL_HOURS", 24),
 		MinFreeBytes:            getEnvInt64("MIN_FREE_BYTES", 536870912),
+		FileVersionRetention:    getEnvInt("FILE_VERSION_RETENTION", 10),
+		FileVersionMaxAgeDays:   getEnvInt("FILE_VERSION_MAX_AGE_DAYS", 90),
+		SearchContentIndex:      getEnv("SEARCH_CONTENT_INDEX", "true") == "true",
 		DiskStatsPath:           getEnv("DISK_STATS_PATH", ""),
 		StaticDir:               getEnv("STATIC_DIR", ""),
 		NodeEnv:                 getEnv("NODE_ENV", "development"),
 	}
 
+	for _, k := range strings.Split(getEnv("FILE_ENCRYPTION_OLD_KEYS", ""), ",") {
+		if k = strings.TrimSpace(k); k != "" {
+			cfg.FileEncryptionOldKeys = append(cfg.FileEncryptionOldKeys, k)
+		}
+	}
+
+	// Passkeys are bound to a domain and only work from the origins the web
+	// app is served on.
+	cfg.WebAuthnRPID = getEnv("WEBAUTHN_RP_ID", "")
+	if cfg.WebAuthnRPID == "" {
+		if u, err := url.Parse(cfg.FrontendURL); err == nil {
+			cfg.WebAuthnRPID = u.Hostname()
+		}
+	}
+	for _, o := range strings.Split(getEnv("WEBAUTHN_ORIGINS", ""), ",") {
+		if o = strings.TrimRight(strings.TrimSpace(o), "/"); o != "" {
+			cfg.WebAuthnOrigins = append(cfg.WebAuthnOrigins, o)
+		}
+	}
+	if len(cfg.WebAuthnOrigins) == 0 {
+		cfg.WebAuthnOrigins = append([]string{strings.TrimRight(cfg.FrontendURL, "/")}, cfg.CORSOrigins...)
+	}
+
+	cfg.PasswordLogin = getEnv("PASSWORD_LOGIN", "true") == "true"
+	cfg.OIDCIssuer = getEnv("OIDC_ISSUER", "")
+	cfg.OIDCClientID = getEnv("OIDC_CLIENT_ID", "")
+	cfg.OIDCClientSecret = getEnv("OIDC_CLIENT_SECRET", "")
+	cfg.OIDCRedirectURL = getEnv("OIDC_REDIRECT_URL", strings.TrimRight(cfg.FrontendURL, "/")+"/api/v1/auth/oidc/callback")
+	cfg.OIDCScopes = strings.Fields(getEnv("OIDC_SCOPES", "openid email profile"))
+	cfg.OIDCProviderName = getEnv("OIDC_PROVIDER_NAME", "Single sign-on")
+	cfg.OIDCGroupsClaim = getEnv("OIDC_GROUPS_CLAIM", "groups")
+	cfg.OIDCOwnerGroups = getEnvList("OIDC_OWNER_GROUPS")
+	cfg.OIDCAdminGroups = getEnvList("OIDC_ADMIN_GROUPS")
+	cfg.OIDCAllowedGroups = getEnvList("OIDC_ALLOWED_GROUPS")
+
+	// Group DNs contain commas, so LDAP group lists are separated by ';'.
+	cfg.LDAPURL = getEnv("LDAP_URL", "")
+	cfg.LDAPStartTLS = getEnv("LDAP_START_TLS", "false") == "true"
+	cfg.LDAPCACert = getEnv("LDAP_CA_CERT", "")
+	cfg.LDAPTLSSkipVerify = getEnv("LDAP_TLS_SKIP_VERIFY", "false") == "true"
+	cfg.LDAPBindDN = getEnv("LDAP_BIND_DN", "")
+	cfg.LDAPBindPassword = getEnv("LDAP_BIND_PASSWORD", "")
+	cfg.LDAPBaseDN = getEnv("LDAP_BASE_DN", "")
+	cfg.LDAPUserFilter = getEnv("LDAP_USER_FILTER", "(&(objectClass=person)(|(uid={username})(mail={username})))")
+	cfg.LDAPIDAttr = getEnv("LDAP_ID_ATTR", "entryUUID")
+	cfg.LDAPNameAttr = getEnv("LDAP_NAME_ATTR", "cn")
+	cfg.LDAPEmailAttr = getEnv("LDAP_EMAIL_ATTR", "mail")
+	cfg.LDAPGroupAttr = getEnv("LDAP_GROUP_ATTR", "memberOf")
+	cfg.LDAPOwnerGroups = getEnvSplit("LDAP_OWNER_GROUPS", ";")
+	cfg.LDAPAdminGroups = getEnvSplit("LDAP_ADMIN_GROUPS", ";")
+	cfg.LDAPAllowedGroups = getEnvSplit("LDAP_ALLOWED_GROUPS", ";")
+	cfg.LDAPSpaceGroups = getEnv("LDAP_SPACE_GROUPS", "")
+	cfg.LDAPSyncIntervalMinutes = getEnvInt("LDAP_SYNC_INTERVAL_MINUTES", 60)
+
+	// Uploads are staged on local disk before being handed to the backend, so
+	// the staging dir stays local even when files themselves live in S3.
+	cfg.UploadTempDir = getEnv("UPLOAD_TEMP_DIR", cfg.StoragePath+"/.uploads")
+
 	// COOKIE_SECURE defaults to true when NODE_ENV=production, but can be
 	// overridden to false for local/Tailscale HTTP access without HTTPS.
 	nodeEnv := cfg.NodeEnv
@@ -111,16 +245,52 @@ func Load() *Config {
 	}
 	cfg.CookieSecure = getEnv("COOKIE_SECURE", cookieSecureDefault) == "true"
 
+	lifetime, err := parseLifetime(cfg.JWTExpiresIn)
+	if err != nil {
+		slog.Warn("JWT_EXPIRES_IN is not a valid duration — using 7d", "value", cfg.JWTExpiresIn)
+		lifetime = 7 * 24 * time.Hour
+	}
+	cfg.SessionLifetime = lifetime
+	if cfg.AccessTokenTTLMinutes <= 0 {
+		cfg.AccessTokenTTLMinutes = 15
+	}
+
 	// Warn loudly about missing critical secrets at startup.
 	if cfg.JWTSecret == "" {
 		slog.Warn("JWT_SECRET is not set — tokens will fail to verify on restart; set a strong random secret")
 	}
-	if cfg.FileEncryptionMasterKey == "" {
-		slog.Warn("FILE_ENCRYPTION_MASTER_KEY is not set — file encryption is disabled")
+	switch cfg.KeyProvider {
+	case "env":
+		if cfg.FileEncryptionMasterKey == "" {
+			slog.Warn("FILE_ENCRYPTION_MASTER_KEY is not set — file encryption is disabled")
+		}
+	case "file":
+		if cfg.MasterKeyFile == "" {
+			slog.Warn("KEY_PROVIDER=file but FILE_ENCRYPTION_MASTER_KEY_FILE is not set — key provider will fail to initialize")
+		}
+	case "vault":
+		if cfg.VaultAddr == "" || cfg.VaultToken == "" {
+			slog.Warn("KEY_PROVIDER=vault but VAULT_ADDR or VAULT_TOKEN is not set — key provider will fail to initialize")
+		}
+	}
+	if cfg.StorageBackend == "s3" && (cfg.S3Endpoint == "" || cfg.S3Bucket == "") {
+		slog.Warn("STORAGE_BACKEND=s3 but S3_ENDPOINT or S3_BUCKET is not set — storage backend will fail to initialize")
 	}
 	if cfg.EmailEnabled && cfg.SMTPHost == "" {
 		slog.Warn("EMAIL_ENABLED=true but SMTP_HOST is not set — emails will not be delivered")
 	}
+	if cfg.OIDCIssuer != "" && cfg.OIDCClientID == "" {
+		slog.Warn("OIDC_ISSUER is set but OIDC_CLIENT_ID is not — single sign-on will fail")
+	}
+	if !cfg.PasswordLogin && cfg.OIDCIssuer == "" && cfg.LDAPURL == "" {
+		slog.Warn("PASSWORD_LOGIN=false without OIDC_ISSUER or LDAP_URL — only passkeys can sign in")
+	}
+	if cfg.LDAPURL != "" && cfg.LDAPBaseDN == "" {
+		slog.Warn("LDAP_URL is set but LDAP_BASE_DN is not — directory searches will fail")
+	}
+	if cfg.LDAPTLSSkipVerify {
+		slog.Warn("LDAP_TLS_SKIP_VERIFY=true — the directory's certificate is not checked")
+	}
 	if len(cfg.CORSOrigins) == 0 {
 		slog.Warn("no CORS origins configured (CORS_ORIGIN) — cross-origin requests will be blocked")
 	}
@@ -152,3 +322,37 @@ func getEnvInt64(key string, fallback int64) int64 {
 	}
 	return fallback
 }
+
+// parseLifetime accepts a Go duration ("12h") or a whole number of days
+// ("7d"), the form JWT_EXPIRES_IN has always used.
+func parseLifetime(v string) (time.Duration, error) {
+	var d time.Duration
+	var err error
+	if days, ok := strings.CutSuffix(v, "d"); ok {
+		var n int
+		n, err = strconv.Atoi(days)
+		d = time.Duration(n) * 24 * time.Hour
+	} else {
+		d, err = time.ParseDuration(v)
+	}
+	if err == nil && d <= 0 {
+		err = fmt.Errorf("lifetime must be positive")
+	}
+	return d, err
+}
+
+// getEnvList splits a comma-separated variable, dropping empty entries.
+func getEnvList(key string) []string {
+	return getEnvSplit(key, ",")
+}
+
+// getEnvSplit splits a variable on sep, dropping empty entries.
+func getEnvSplit(key, sep string) []string {
+	var out []string
+	for _, v := range strings.Split(os.Getenv(key), sep) {
+		if v = strings.TrimSpace(v); v != "" {
+			out = append(out, v)
+		}
+	}
+	return out
+}
@@ -3,9 +3,11 @@ package crypto
 import (
 	"crypto/aes"
 	"crypto/cipher"
+	"crypto/hmac"
 	"crypto/rand"
-	"encoding/base64"
+	"crypto/sha256"
 	"encoding/binary"
+	"encoding/hex"
 	"errors"
 	"io"
 )
@@ -16,21 +18,59 @@ const (
 	authTagLength = 16
 	// ChunkSize is the plaintext bytes per GCM chunk for streaming encryption.
 	ChunkSize = 64 * 1024 * 1024 // 64 MiB
+	// chunkOverhead is the per-chunk framing: size header, nonce and GCM tag.
+	chunkOverhead = 4 + ivLength + authTagLength
 )
 
 type Crypto struct {
-	masterKey []byte
+	kek KeyProvider
+	// previousKeys are retired KEKs that can still unwrap DEKs while a key
+	// rotation is in progress. New DEKs are always wrapped with kek.
+	previousKeys []KeyProvider
+	// contentKey is the secret used for keyed convergent encryption of
+	// content-addressed blobs. Supplied by the KEK, never stored, so blobs
+	// written before a key rotation no longer deduplicate with new uploads
+	// of the same content.
+	contentKey []byte
 }
 
+// New creates a Crypto whose KEK is the given base64 master key.
 func New(masterKeyBase64 string) (*Crypto, error) {
-	key, err := base64.StdEncoding.DecodeString(masterKeyBase64)
+	kek, err := NewStaticKey(masterKeyBase64)
 	if err != nil {
 		return nil, err
 	}
-	if len(key) != 32 {
-		return nil, errors.New("FILE_ENCRYPTION_MASTER_KEY must be exactly 32 bytes when base64-decoded")
+	return NewWithProvider(kek)
+}
+
+// NewWithProvider creates a Crypto that wraps DEKs through kek.
+func NewWithProvider(kek KeyProvider) (*Crypto, error) {
+	contentKey, err := kek.ContentKey()
+	if err != nil {
+		return nil, err
 	}
-	return &Crypto{masterKey: key}, nil
+	return &Crypto{kek: kek, contentKey: contentKey}, nil
+}
+
+// Fingerprint returns the fingerprint of the current KEK.
+func (c *Crypto) Fingerprint() string {
+	return c.kek.Fingerprint()
+}
+
+// KeyID returns the identifier of the current KEK.
+func (c *Crypto) KeyID() string {
+	return c.kek.Fingerprint()[:16]
+}
+
+// AddPreviousKey registers a retired base64 master key. DecryptFileKey falls
+// back to it for DEKs that have not been re-wrapped yet.
+func (c *Crypto) AddPreviousKey(masterKeyBase64 string) error {
+	kek, err := NewStaticKey(masterKeyBase64)
+	if err != nil {
+		return err
+	}
+	c.previousKeys = append(c.previousKeys, kek)
+	return nil
 }
 
 func (c *Crypto) GenerateDEK() ([]byte, error) {
@@ -45,35 +85,23 @@ func (c *Crypto) GenerateIV() ([]byte, error) {
 	return iv, err
 }
 
-// EncryptDEK encrypts the DEK with the master key.
+// EncryptDEK encrypts the DEK with the KEK, split into the leading IV and the
+// rest of the wrapped value.
 func (c *Crypto) EncryptDEK(dek []byte) (dekIv []byte, encryptedDEK []byte, err error) {
-	dekIv, err = c.GenerateIV()
+	wrapped, err := c.kek.Wrap(dek)
 	if err != nil {
-		return
+		return nil, nil, err
 	}
-	block, err := aes.NewCipher(c.masterKey)
-	if err != nil {
-		return
+	if len(wrapped) < ivLength {
+		return nil, nil, errors.New("wrapped DEK too short")
 	}
-	gcm, err := cipher.NewGCM(block)
-	if err != nil {
-		return
-	}
-	encryptedDEK = gcm.Seal(nil, dekIv, dek, nil)
-	return
+	return wrapped[:ivLength], wrapped[ivLength:], nil
 }
 
-// DecryptDEK decrypts the DEK.
+// DecryptDEK decrypts a DEK split by EncryptDEK.
 func (c *Crypto) DecryptDEK(encryptedDEKWithTag, dekIv []byte) ([]byte, error) {
-	block, err := aes.NewCipher(c.masterKey)
-	if err != nil {
-		return nil, err
-	}
-	gcm, err := cipher.NewGCM(block)
-	if err != nil {
-		return nil, err
-	}
-	return gcm.Open(nil, dekIv, encryptedDEKWithTag, nil)
+	wrapped := make([]byte, 0, len(dekIv)+len(encryptedDEKWithTag))
+	return c.kek.Unwrap(append(append(wrapped, dekIv...), encryptedDEKWithTag...))
 }
 
 // CreateEncryptionKeys generates all keys needed for a new file.
@@ -86,23 +114,80 @@ func (c *Crypto) CreateEncryptionKeys() (dek, iv, storedEncryptedDEK []byte, alg
 	if err != nil {
 		return
 	}
-	dekIv, encryptedDEK, err := c.EncryptDEK(dek)
+	storedEncryptedDEK, err = c.WrapDEK(dek)
 	if err != nil {
 		return
 	}
-	storedEncryptedDEK = append(dekIv, encryptedDEK...)
 	algorithm = "AES-256-GCM-STREAM"
 	return
 }
 
-// DecryptFileKey extracts the DEK from the stored encrypted_dek field.
+// WrapDEK encrypts dek with the KEK and returns the stored encrypted_dek
+// value (dekIv || ciphertext+tag for local keys).
+func (c *Crypto) WrapDEK(dek []byte) ([]byte, error) {
+	return c.kek.Wrap(dek)
+}
+
+// DeriveContentKeys derives the blob ID, DEK and base IV for a plaintext
+// SHA-256 digest (keyed convergent encryption).
+//
+// Identical plaintext always yields the same blob ID and ciphertext, which is
+// what lets the CAS store it once across users. Because every value is keyed
+// by a secret derived from the master key, someone holding only the storage
+// volume or a database dump cannot confirm whether a known file is stored by
+// hashing it. Each DEK encrypts exactly one plaintext, so the deterministic
+// IV never reuses a nonce with different data.
+func (c *Crypto) DeriveContentKeys(plainSHA256 []byte) (blobID string, dek, iv []byte) {
+	derive := func(label string) []byte {
+		mac := hmac.New(sha256.New, c.contentKey)
+		mac.Write([]byte(label))
+		mac.Write(plainSHA256)
+		return mac.Sum(nil)
+	}
+	blobID = hex.EncodeToString(derive("id"))
+	dek = derive("dek")[:dekLength]
+	iv = derive("iv")[:ivLength]
+	return
+}
+
+// searchTokenLength is the bytes of HMAC kept per search token. 80 bits
+// keeps collisions negligible for any realistic vocabulary.
+const searchTokenLength = 10
+
+// SearchToken returns the keyed token stored in the full-text index in place
+// of term. Document text is as sensitive as the encrypted content it came
+// from, so the index only ever holds these tokens: a database dump shows
+// which files share words, not what the words are. Tokens depend on the
+// master key, so they change when it is rotated.
+func (c *Crypto) SearchToken(term string) string {
+	mac := hmac.New(sha256.New, c.contentKey)
+	mac.Write([]byte("search"))
+	mac.Write([]byte(term))
+	return hex.EncodeToString(mac.Sum(nil)[:searchTokenLength])
+}
+
+// DecryptFileKey extracts the DEK from the stored encrypted_dek field. DEKs
+// still wrapped with a previous KEK are unwrapped with that key; failed
+// authentication tells the keys apart.
 func (c *Crypto) DecryptFileKey(storedEncryptedDEK []byte) ([]byte, error) {
-	if len(storedEncryptedDEK) < ivLength {
-		return nil, errors.New("invalid encrypted_dek length")
+	dek, err := c.kek.Unwrap(storedEncryptedDEK)
+	for _, kek := range c.previousKeys {
+		if err == nil {
+			break
+		}
+		dek, err = kek.Unwrap(storedEncryptedDEK)
 	}
-	dekIv := storedEncryptedDEK[:ivLength]
-	actualEncrypted := storedEncryptedDEK[ivLength:]
-	return c.DecryptDEK(actualEncrypted, dekIv)
+	return dek, err
+}
+
+// RewrapFileKey re-encrypts a stored encrypted_dek under the current master
+// key. The DEK itself, and therefore the file ciphertext, is unchanged.
+func (c *Crypto) RewrapFileKey(storedEncryptedDEK []byte) ([]byte, error) {
+	dek, err := c.DecryptFileKey(storedEncryptedDEK)
+	if err != nil {
+		return nil, err
+	}
+	return c.WrapDEK(dek)
 }
 
 // EncryptBuffer encrypts plaintext with AES-256-GCM (legacy / small-file path).
@@ -203,47 +288,102 @@ func EncryptStream(r io.Reader, w io.Writer, dek, baseIV []byte) (int64, error)
 // DecryptStream reads AES-256-GCM-STREAM chunked ciphertext from r and writes
 // decrypted plaintext to w.
 func DecryptStream(r io.Reader, w io.Writer, dek, baseIV []byte) error {
-	block, err := aes.NewCipher(dek)
-	if err != nil {
-		return err
-	}
-	gcm, err := cipher.NewGCM(block)
+	gcm, err := newGCM(dek)
 	if err != nil {
 		return err
 	}
 
 	var idx uint32
-	var hdr [4]byte
-
 	for {
-		_, err := io.ReadFull(r, hdr[:])
+		plain, err := openChunk(r, gcm, baseIV, idx)
 		if err == io.EOF {
 			break
 		}
 		if err != nil {
 			return err
 		}
-		plainSize := binary.BigEndian.Uint32(hdr[:])
-
-		nonce := make([]byte, ivLength)
-		if _, err := io.ReadFull(r, nonce); err != nil {
+		if _, err := w.Write(plain); err != nil {
 			return err
 		}
+		idx++
+	}
+	return nil
+}
 
-		sealed := make([]byte, int(plainSize)+authTagLength)
-		if _, err := io.ReadFull(r, sealed); err != nil {
-			return err
-		}
+// StreamChunkOffset returns the ciphertext offset of the chunk holding
+// plaintext byte plainOffset, and that chunk's index. Every chunk except the
+// last carries exactly ChunkSize plaintext bytes, so the position is fixed.
+func StreamChunkOffset(plainOffset int64) (cipherOffset int64, index uint32) {
+	index = uint32(plainOffset / ChunkSize) // #nosec G115 -- 2^32 chunks of 64 MiB exceeds any supported file size
+	return int64(index) * (ChunkSize + chunkOverhead), index
+}
 
-		expectedNonce := chunkNonce(baseIV, idx)
-		plain, err := gcm.Open(nil, expectedNonce, sealed, nil)
+// DecryptStreamRange writes plaintext bytes [offset, offset+length) of an
+// AES-256-GCM-STREAM file to w. r must start at the ciphertext position
+// returned by StreamChunkOffset(offset); only the chunks covering the range
+// are read and authenticated.
+func DecryptStreamRange(r io.Reader, w io.Writer, dek, baseIV []byte, offset, length int64) error {
+	gcm, err := newGCM(dek)
+	if err != nil {
+		return err
+	}
+
+	_, idx := StreamChunkOffset(offset)
+	skip := offset % ChunkSize
+	for length > 0 {
+		plain, err := openChunk(r, gcm, baseIV, idx)
+		if err == io.EOF {
+			return io.ErrUnexpectedEOF
+		}
 		if err != nil {
 			return err
 		}
+		if skip >= int64(len(plain)) {
+			return io.ErrUnexpectedEOF
+		}
+		plain = plain[skip:]
+		skip = 0
+		if int64(len(plain)) > length {
+			plain = plain[:length]
+		}
 		if _, err := w.Write(plain); err != nil {
 			return err
 		}
+		length -= int64(len(plain))
 		idx++
 	}
 	return nil
 }
+
+func newGCM(dek []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(dek)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// openChunk reads and authenticates the next chunk from r. It returns io.EOF
+// when r is exhausted at a chunk boundary.
+func openChunk(r io.Reader, gcm cipher.AEAD, baseIV []byte, idx uint32) ([]byte, error) {
+	var hdr [4]byte
+	if _, err := io.ReadFull(r, hdr[:]); err != nil {
+		return nil, err
+	}
+	plainSize := binary.BigEndian.Uint32(hdr[:])
+	if plainSize > ChunkSize {
+		return nil, errors.New("invalid chunk size")
+	}
+
+	nonce := make([]byte, ivLength)
+	if _, err := io.ReadFull(r, nonce); err != nil {
+		return nil, err
+	}
+
+	sealed := make([]byte, int(plainSize)+authTagLength)
+	if _, err := io.ReadFull(r, sealed); err != nil {
+		return nil, err
+	}
+
+	return gcm.Open(nil, chunkNonce(baseIV, idx), sealed, nil)
+}
@@ -2,7 +2,10 @@ package crypto
 
 import (
 	"bytes"
+	"crypto/sha256"
 	"encoding/base64"
+	"encoding/hex"
+	"io"
 	"strings"
 	"testing"
 )
@@ -88,6 +91,103 @@ func TestCreateEncryptionKeys(t *testing.T) {
 	}
 }
 
+func TestDeriveContentKeys(t *testing.T) {
+	c, _ := New(validMasterKey())
+	sum := sha256.Sum256([]byte("shared quarterly report"))
+
+	id1, dek1, iv1 := c.DeriveContentKeys(sum[:])
+	id2, dek2, iv2 := c.DeriveContentKeys(sum[:])
+	if id1 != id2 || !bytes.Equal(dek1, dek2) || !bytes.Equal(iv1, iv2) {
+		t.Fatal("content keys must be deterministic for identical content")
+	}
+	if len(id1) != 64 || len(dek1) != dekLength || len(iv1) != ivLength {
+		t.Errorf("unexpected lengths: id=%d dek=%d iv=%d", len(id1), len(dek1), len(iv1))
+	}
+	if id1 == hex.EncodeToString(sum[:]) {
+		t.Error("blob ID must not be the plain content hash")
+	}
+
+	other := sha256.Sum256([]byte("different content"))
+	if id3, _, _ := c.DeriveContentKeys(other[:]); id3 == id1 {
+		t.Error("different content produced the same blob ID")
+	}
+
+	otherKey := make([]byte, 32)
+	for i := range otherKey {
+		otherKey[i] = byte(255 - i)
+	}
+	c2, _ := New(base64.StdEncoding.EncodeToString(otherKey))
+	if id4, dek4, _ := c2.DeriveContentKeys(sum[:]); id4 == id1 || bytes.Equal(dek4, dek1) {
+		t.Error("content keys must depend on the master key")
+	}
+}
+
+func TestSearchToken(t *testing.T) {
+	c, _ := New(validMasterKey())
+	tok := c.SearchToken("invoice")
+	if tok != c.SearchToken("invoice") {
+		t.Fatal("search tokens must be deterministic")
+	}
+	if len(tok) != 2*searchTokenLength {
+		t.Errorf("token length = %d, want %d", len(tok), 2*searchTokenLength)
+	}
+	if tok == c.SearchToken("invoices") {
+		t.Error("different terms produced the same token")
+	}
+
+	otherKey := make([]byte, 32)
+	for i := range otherKey {
+		otherKey[i] = byte(255 - i)
+	}
+	c2, _ := New(base64.StdEncoding.EncodeToString(otherKey))
+	if c2.SearchToken("invoice") == tok {
+		t.Error("search tokens must depend on the master key")
+	}
+}
+
+func TestRewrapFileKey(t *testing.T) {
+	oldKey := validMasterKey()
+	newKey := base64.StdEncoding.EncodeToString(bytes.Repeat([]byte{0x24}, 32))
+
+	oldC, _ := New(oldKey)
+	_, _, stored, _, err := oldC.CreateEncryptionKeys()
+	if err != nil {
+		t.Fatal(err)
+	}
+	dek, _ := oldC.DecryptFileKey(stored)
+
+	newC, _ := New(newKey)
+	if _, err := newC.DecryptFileKey(stored); err == nil {
+		t.Fatal("new key alone must not unwrap an old DEK")
+	}
+	if err := newC.AddPreviousKey(oldKey); err != nil {
+		t.Fatal(err)
+	}
+	got, err := newC.DecryptFileKey(stored)
+	if err != nil || !bytes.Equal(got, dek) {
+		t.Fatalf("DecryptFileKey with previous key: %v", err)
+	}
+
+	rewrapped, err := newC.RewrapFileKey(stored)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := oldC.DecryptFileKey(rewrapped); err == nil {
+		t.Error("re-wrapped DEK must not open with the old key")
+	}
+	onlyNew, _ := New(newKey)
+	if got, err := onlyNew.DecryptFileKey(rewrapped); err != nil || !bytes.Equal(got, dek) {
+		t.Errorf("re-wrapped DEK: %v", err)
+	}
+
+	if newC.KeyID() != KeyID(newKey) || newC.KeyID() == oldC.KeyID() || len(newC.KeyID()) != 16 {
+		t.Errorf("unexpected key IDs %q / %q", newC.KeyID(), oldC.KeyID())
+	}
+	if err := newC.AddPreviousKey("short"); err == nil {
+		t.Error("expected error for invalid previous key")
+	}
+}
+
 func TestStreamEncryptDecryptRoundTrip(t *testing.T) {
 	c, _ := New(validMasterKey())
 	dek, _ := c.GenerateDEK()
@@ -136,6 +236,53 @@ func TestStreamEncryptLargeFile(t *testing.T) {
 	}
 }
 
+func TestDecryptStreamRange(t *testing.T) {
+	c, _ := New(validMasterKey())
+	dek, _ := c.GenerateDEK()
+	iv, _ := c.GenerateIV()
+
+	// Two chunks so ranges can straddle the boundary.
+	plaintext := make([]byte, ChunkSize+4096)
+	for i := range plaintext {
+		plaintext[i] = byte(i % 251)
+	}
+	var cipherBuf bytes.Buffer
+	if _, err := EncryptStream(bytes.NewReader(plaintext), &cipherBuf, dek, iv); err != nil {
+		t.Fatalf("EncryptStream: %v", err)
+	}
+	ciphertext := cipherBuf.Bytes()
+
+	cases := []struct {
+		name           string
+		offset, length int64
+	}{
+		{"head", 0, 100},
+		{"inside first chunk", 12345, 1000},
+		{"straddles boundary", ChunkSize - 10, 20},
+		{"second chunk only", ChunkSize + 5, 100},
+		{"tail", int64(len(plaintext)) - 1, 1},
+		{"whole file", 0, int64(len(plaintext))},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			cipherOffset, _ := StreamChunkOffset(tc.offset)
+			var out bytes.Buffer
+			if err := DecryptStreamRange(bytes.NewReader(ciphertext[cipherOffset:]), &out, dek, iv, tc.offset, tc.length); err != nil {
+				t.Fatalf("DecryptStreamRange: %v", err)
+			}
+			if !bytes.Equal(out.Bytes(), plaintext[tc.offset:tc.offset+tc.length]) {
+				t.Fatal("range plaintext mismatch")
+			}
+		})
+	}
+
+	// Reading past the end must fail rather than return short data silently.
+	cipherOffset, _ := StreamChunkOffset(ChunkSize)
+	if err := DecryptStreamRange(bytes.NewReader(ciphertext[cipherOffset:]), io.Discard, dek, iv, ChunkSize, 8192); err == nil {
+		t.Error("expected error when range exceeds file")
+	}
+}
+
 func TestDecryptWithWrongKey(t *testing.T) {
 	c1, _ := New(validMasterKey())
 	key2 := base64.StdEncoding.EncodeToString(bytes.Repeat([]byte{0xFF}, 32))
@@ -0,0 +1,124 @@
+package crypto
+
+import (
+	"crypto/hkdf"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"os"
+	"strings"
+)
+
+// KeyProvider holds the key-encryption key (KEK) that wraps per-file DEKs.
+// Implementations may keep the key in process memory or delegate wrapping to
+// an external service so the KEK never enters the process.
+type KeyProvider interface {
+	// Wrap encrypts a DEK and returns the bytes stored in encrypted_dek.
+	Wrap(dek []byte) ([]byte, error)
+	// Unwrap reverses Wrap. It must fail, not return garbage, when the
+	// value was wrapped by a different KEK.
+	Unwrap(wrapped []byte) ([]byte, error)
+	// ContentKey returns the stable secret used for keyed convergent
+	// encryption of content-addressed blobs.
+	ContentKey() ([]byte, error)
+	// Fingerprint identifies the KEK. It is stored on first boot to detect
+	// a changed key, and its prefix is recorded as key_id on wrapped DEKs.
+	Fingerprint() string
+}
+
+// contentKeyInfo is the HKDF/HMAC label for the CAS content key.
+const contentKeyInfo = "zynqcloud cas content key v1"
+
+// StaticKey is a KEK held in process memory, configured directly
+// (FILE_ENCRYPTION_MASTER_KEY) or read from a key file.
+type StaticKey struct {
+	key         []byte
+	fingerprint string
+}
+
+// NewStaticKey parses a base64-encoded 32-byte master key.
+func NewStaticKey(masterKeyBase64 string) (*StaticKey, error) {
+	key, err := decodeMasterKey(masterKeyBase64)
+	if err != nil {
+		return nil, err
+	}
+	return &StaticKey{key: key, fingerprint: Fingerprint(masterKeyBase64)}, nil
+}
+
+// NewKeyFile reads a master key from path. The file holds the key in base64,
+// as FILE_ENCRYPTION_MASTER_KEY would, or as 32 raw bytes. Either form has the
+// same fingerprint as the equivalent environment key, so an instance can move
+// between the two without a key rotation.
+func NewKeyFile(path string) (*StaticKey, error) {
+	data, err := os.ReadFile(path) // #nosec G304 -- path is operator configuration
+	if err != nil {
+		return nil, err
+	}
+	if len(data) == 32 {
+		// A base64 key is 44 characters, so 32 bytes can only be a raw key.
+		return NewStaticKey(base64.StdEncoding.EncodeToString(data))
+	}
+	k, err := NewStaticKey(strings.TrimSpace(string(data)))
+	if err != nil {
+		return nil, errors.New("key file must contain a base64-encoded or raw 32-byte key")
+	}
+	return k, nil
+}
+
+func decodeMasterKey(masterKeyBase64 string) ([]byte, error) {
+	key, err := base64.StdEncoding.DecodeString(masterKeyBase64)
+	if err != nil {
+		return nil, err
+	}
+	if len(key) != 32 {
+		return nil, errors.New("FILE_ENCRYPTION_MASTER_KEY must be exactly 32 bytes when base64-decoded")
+	}
+	return key, nil
+}
+
+// Wrap encrypts dek with AES-256-GCM and returns dekIv || ciphertext+tag.
+func (k *StaticKey) Wrap(dek []byte) ([]byte, error) {
+	dekIv := make([]byte, ivLength)
+	if _, err := rand.Read(dekIv); err != nil {
+		return nil, err
+	}
+	gcm, err := newGCM(k.key)
+	if err != nil {
+		return nil, err
+	}
+	return gcm.Seal(dekIv, dekIv, dek, nil), nil
+}
+
+// Unwrap decrypts a value produced by Wrap.
+func (k *StaticKey) Unwrap(wrapped []byte) ([]byte, error) {
+	if len(wrapped) < ivLength {
+		return nil, errors.New("invalid encrypted_dek length")
+	}
+	gcm, err := newGCM(k.key)
+	if err != nil {
+		return nil, err
+	}
+	return gcm.Open(nil, wrapped[:ivLength], wrapped[ivLength:], nil)
+}
+
+// ContentKey derives the CAS content key from the master key with HKDF.
+func (k *StaticKey) ContentKey() ([]byte, error) {
+	return hkdf.Key(sha256.New, k.key, nil, contentKeyInfo, 32)
+}
+
+func (k *StaticKey) Fingerprint() string { return k.fingerprint }
+
+// Fingerprint returns the SHA-256 fingerprint of a configured master key, as
+// stored in the key_fingerprint setting.
+func Fingerprint(masterKeyBase64 string) string {
+	sum := sha256.Sum256([]byte(masterKeyBase64))
+	return hex.EncodeToString(sum[:])
+}
+
+// KeyID returns the short identifier recorded next to DEKs wrapped with the
+// given master key.
+func KeyID(masterKeyBase64 string) string {
+	return Fingerprint(masterKeyBase64)[:16]
+}
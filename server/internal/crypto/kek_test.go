@@ -0,0 +1,46 @@
+package crypto
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestNewKeyFile(t *testing.T) {
+	dir := t.TempDir()
+	raw := bytes.Repeat([]byte{0x42}, 32)
+
+	b64Path := filepath.Join(dir, "master.key")
+	os.WriteFile(b64Path, []byte(validMasterKey()+"\n"), 0o600) //nolint:errcheck
+	rawPath := filepath.Join(dir, "master.bin")
+	os.WriteFile(rawPath, raw, 0o600) //nolint:errcheck
+
+	for _, p := range []string{b64Path, rawPath} {
+		k, err := NewKeyFile(p)
+		if err != nil {
+			t.Fatalf("NewKeyFile(%s): %v", filepath.Base(p), err)
+		}
+		// Same key, same fingerprint as FILE_ENCRYPTION_MASTER_KEY.
+		if k.Fingerprint() != Fingerprint(validMasterKey()) {
+			t.Errorf("%s: fingerprint differs from the env key", filepath.Base(p))
+		}
+	}
+
+	envC, _ := New(validMasterKey())
+	fileKEK, _ := NewKeyFile(b64Path)
+	fileC, _ := NewWithProvider(fileKEK)
+	_, _, stored, _, _ := envC.CreateEncryptionKeys()
+	if _, err := fileC.DecryptFileKey(stored); err != nil {
+		t.Errorf("key file cannot unwrap DEKs wrapped by the env key: %v", err)
+	}
+
+	short := filepath.Join(dir, "short.key")
+	os.WriteFile(short, []byte("c2hvcnQ="), 0o600) //nolint:errcheck
+	if _, err := NewKeyFile(short); err == nil {
+		t.Error("expected error for short key file")
+	}
+	if _, err := NewKeyFile(filepath.Join(dir, "missing")); err == nil {
+		t.Error("expected error for missing key file")
+	}
+}
@@ -0,0 +1,164 @@
+package crypto
+
+import (
+	"bytes"
+	"crypto/hkdf"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// VaultTransitConfig configures a VaultTransit key provider.
+type VaultTransitConfig struct {
+	Address   string // e.g. https://vault.example.com:8200
+	Token     string
+	Mount     string // transit secrets engine mount, default "transit"
+	KeyName   string
+	Namespace string       // optional, sent as X-Vault-Namespace
+	Client    *http.Client // optional; defaults to a client with a 10s timeout
+}
+
+// VaultTransit wraps DEKs with a key held by a HashiCorp Vault (or
+// API-compatible, e.g. OpenBao) transit secrets engine. The KEK never leaves
+// the key server; each wrap and unwrap is one HTTP call.
+type VaultTransit struct {
+	cfg         VaultTransitConfig
+	base        string
+	fingerprint string
+}
+
+// vaultPrefix starts every transit ciphertext.
+const vaultPrefix = "vault:"
+
+// NewVaultTransit validates cfg and returns the provider. It does not contact
+// the server; the first call to ContentKey does.
+func NewVaultTransit(cfg VaultTransitConfig) (*VaultTransit, error) {
+	if cfg.Address == "" || cfg.Token == "" || cfg.KeyName == "" {
+		return nil, errors.New("vault transit: address, token and key name are required")
+	}
+	u, err := url.Parse(cfg.Address)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return nil, fmt.Errorf("vault transit: invalid address %q", cfg.Address)
+	}
+	if cfg.Mount == "" {
+		cfg.Mount = "transit"
+	}
+	if cfg.Client == nil {
+		cfg.Client = &http.Client{Timeout: 10 * time.Second}
+	}
+	base := strings.TrimRight(cfg.Address, "/") + "/v1/" + strings.Trim(cfg.Mount, "/")
+	sum := sha256.Sum256([]byte("vault-transit:" + base + "/" + cfg.KeyName))
+	return &VaultTransit{cfg: cfg, base: base, fingerprint: hex.EncodeToString(sum[:])}, nil
+}
+
+// Wrap encrypts dek with the transit key and returns the "vault:vN:..."
+// ciphertext as the stored value.
+func (v *VaultTransit) Wrap(dek []byte) ([]byte, error) {
+	var out struct {
+		Ciphertext string `json:"ciphertext"`
+	}
+	if err := v.call("encrypt", map[string]interface{}{
+		"plaintext": base64.StdEncoding.EncodeToString(dek),
+	}, &out); err != nil {
+		return nil, err
+	}
+	if !strings.HasPrefix(out.Ciphertext, vaultPrefix) {
+		return nil, errors.New("vault transit: unexpected ciphertext format")
+	}
+	return []byte(out.Ciphertext), nil
+}
+
+// Unwrap decrypts a value produced by Wrap. Values wrapped by a local key are
+// rejected without contacting the server.
+func (v *VaultTransit) Unwrap(wrapped []byte) ([]byte, error) {
+	if !bytes.HasPrefix(wrapped, []byte(vaultPrefix)) {
+		return nil, errors.New("vault transit: encrypted_dek was not wrapped by vault")
+	}
+	var out struct {
+		Plaintext string `json:"plaintext"`
+	}
+	if err := v.call("decrypt", map[string]interface{}{"ciphertext": string(wrapped)}, &out); err != nil {
+		return nil, err
+	}
+	return base64.StdEncoding.DecodeString(out.Plaintext)
+}
+
+// ContentKey derives the CAS content key from an HMAC computed by the key
+// server over a fixed label. The HMAC is pinned to version 1 of the transit
+// key so rotating the key inside Vault does not change blob IDs.
+func (v *VaultTransit) ContentKey() ([]byte, error) {
+	var out struct {
+		HMAC string `json:"hmac"`
+	}
+	if err := v.call("hmac", map[string]interface{}{
+		"input":       base64.StdEncoding.EncodeToString([]byte(contentKeyInfo)),
+		"key_version": 1,
+	}, &out); err != nil {
+		return nil, err
+	}
+	i := strings.LastIndex(out.HMAC, ":")
+	if !strings.HasPrefix(out.HMAC, vaultPrefix) || i < 0 {
+		return nil, errors.New("vault transit: unexpected hmac format")
+	}
+	mac, err := base64.StdEncoding.DecodeString(out.HMAC[i+1:])
+	if err != nil {
+		return nil, fmt.Errorf("vault transit: decode hmac: %w", err)
+	}
+	return hkdf.Key(sha256.New, mac, nil, contentKeyInfo, 32)
+}
+
+func (v *VaultTransit) Fingerprint() string { return v.fingerprint }
+
+// call POSTs body to <mount>/<op>/<key> and decodes the response's data field
+// into out.
+func (v *VaultTransit) call(op string, body map[string]interface{}, out interface{}) error {
+	payload, err := json.Marshal(body)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequest(http.MethodPost, v.base+"/"+op+"/"+url.PathEscape(v.cfg.KeyName), bytes.NewReader(payload))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-Vault-Token", v.cfg.Token)
+	if v.cfg.Namespace != "" {
+		req.Header.Set("X-Vault-Namespace", v.cfg.Namespace)
+	}
+
+	resp, err := v.cfg.Client.Do(req)
+	if err != nil {
+		return fmt.Errorf("vault transit %s: %w", op, err)
+	}
+	defer resp.Body.Close()
+	raw, err := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if err != nil {
+		return fmt.Errorf("vault transit %s: %w", op, err)
+	}
+
+	var envelope struct {
+		Data   json.RawMessage `json:"data"`
+		Errors []string        `json:"errors"`
+	}
+	if err := json.Unmarshal(raw, &envelope); err != nil && resp.StatusCode == http.StatusOK {
+		return fmt.Errorf("vault transit %s: %w", op, err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		if len(envelope.Errors) > 0 {
+			return fmt.Errorf("vault transit %s: %s (status %d)", op, strings.Join(envelope.Errors, "; "), resp.StatusCode)
+		}
+		return fmt.Errorf("vault transit %s: status %d", op, resp.StatusCode)
+	}
+	if len(envelope.Data) == 0 {
+		return fmt.Errorf("vault transit %s: empty response", op)
+	}
+	return json.Unmarshal(envelope.Data, out)
+}
@@ -0,0 +1,179 @@
+package crypto
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+)
+
+// fakeTransit is a minimal in-memory stand-in for Vault's transit engine.
+type fakeTransit struct {
+	key   []byte
+	calls int32
+}
+
+func newFakeTransit(t *testing.T) (*fakeTransit, *httptest.Server) {
+	t.Helper()
+	f := &fakeTransit{key: make([]byte, 32)}
+	rand.Read(f.key) //nolint:errcheck
+	srv := httptest.NewServer(http.HandlerFunc(f.serve))
+	t.Cleanup(srv.Close)
+	return f, srv
+}
+
+func (f *fakeTransit) serve(w http.ResponseWriter, r *http.Request) {
+	atomic.AddInt32(&f.calls, 1)
+	reply := func(status int, v interface{}) {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(status)
+		json.NewEncoder(w).Encode(v) //nolint:errcheck
+	}
+	fail := func(status int, msg string) {
+		reply(status, map[string]interface{}{"errors": []string{msg}})
+	}
+	if r.Method != http.MethodPost || r.Header.Get("X-Vault-Token") != "s.test" {
+		fail(http.StatusForbidden, "permission denied")
+		return
+	}
+	var body map[string]interface{}
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		fail(http.StatusBadRequest, "bad json")
+		return
+	}
+	gcm, _ := newGCM(f.key)
+
+	switch r.URL.Path {
+	case "/v1/transit/encrypt/zynq":
+		plain, err := base64.StdEncoding.DecodeString(body["plaintext"].(string))
+		if err != nil {
+			fail(http.StatusBadRequest, "plaintext must be base64")
+			return
+		}
+		nonce := make([]byte, ivLength)
+		rand.Read(nonce) //nolint:errcheck
+		ct := "vault:v1:" + base64.StdEncoding.EncodeToString(gcm.Seal(nonce, nonce, plain, nil))
+		reply(http.StatusOK, map[string]interface{}{"data": map[string]string{"ciphertext": ct}})
+	case "/v1/transit/decrypt/zynq":
+		raw, err := base64.StdEncoding.DecodeString(strings.TrimPrefix(body["ciphertext"].(string), "vault:v1:"))
+		if err != nil || len(raw) < ivLength {
+			fail(http.StatusBadRequest, "invalid ciphertext")
+			return
+		}
+		plain, err := gcm.Open(nil, raw[:ivLength], raw[ivLength:], nil)
+		if err != nil {
+			fail(http.StatusBadRequest, "cipher: message authentication failed")
+			return
+		}
+		reply(http.StatusOK, map[string]interface{}{"data": map[string]string{"plaintext": base64.StdEncoding.EncodeToString(plain)}})
+	case "/v1/transit/hmac/zynq":
+		input, _ := base64.StdEncoding.DecodeString(body["input"].(string))
+		mac := hmac.New(sha256.New, f.key)
+		mac.Write(input)
+		reply(http.StatusOK, map[string]interface{}{"data": map[string]string{"hmac": "vault:v1:" + base64.StdEncoding.EncodeToString(mac.Sum(nil))}})
+	default:
+		fail(http.StatusNotFound, "no handler for route")
+	}
+}
+
+func TestVaultTransit_RoundTrip(t *testing.T) {
+	_, srv := newFakeTransit(t)
+	kek, err := NewVaultTransit(VaultTransitConfig{Address: srv.URL, Token: "s.test", KeyName: "zynq"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	c, err := NewWithProvider(kek)
+	if err != nil {
+		t.Fatalf("NewWithProvider: %v", err)
+	}
+
+	dek, _, stored, _, err := c.CreateEncryptionKeys()
+	if err != nil {
+		t.Fatalf("CreateEncryptionKeys: %v", err)
+	}
+	if !bytes.HasPrefix(stored, []byte("vault:v1:")) {
+		t.Errorf("stored DEK = %q, want transit ciphertext", stored)
+	}
+	got, err := c.DecryptFileKey(stored)
+	if err != nil || !bytes.Equal(got, dek) {
+		t.Fatalf("DecryptFileKey: %v", err)
+	}
+
+	// The content key must be stable across restarts for dedup to work.
+	c2, _ := NewWithProvider(kek)
+	sum := sha256.Sum256([]byte("same content"))
+	id1, _, _ := c.DeriveContentKeys(sum[:])
+	id2, _, _ := c2.DeriveContentKeys(sum[:])
+	if id1 != id2 {
+		t.Error("content key changed between instances")
+	}
+	if len(c.KeyID()) != 16 {
+		t.Errorf("KeyID = %q", c.KeyID())
+	}
+}
+
+func TestVaultTransit_MigrateFromStaticKey(t *testing.T) {
+	f, srv := newFakeTransit(t)
+	oldKey := validMasterKey()
+	old, _ := New(oldKey)
+	_, _, legacy, _, _ := old.CreateEncryptionKeys()
+	want, _ := old.DecryptFileKey(legacy)
+
+	kek, _ := NewVaultTransit(VaultTransitConfig{Address: srv.URL + "/", Token: "s.test", KeyName: "zynq"})
+	c, err := NewWithProvider(kek)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := c.AddPreviousKey(oldKey); err != nil {
+		t.Fatal(err)
+	}
+
+	before := atomic.LoadInt32(&f.calls)
+	got, err := c.DecryptFileKey(legacy)
+	if err != nil || !bytes.Equal(got, want) {
+		t.Fatalf("DecryptFileKey(legacy): %v", err)
+	}
+	if atomic.LoadInt32(&f.calls) != before {
+		t.Error("a locally wrapped DEK should not be sent to the key server")
+	}
+
+	rewrapped, err := c.RewrapFileKey(legacy)
+	if err != nil || !bytes.HasPrefix(rewrapped, []byte("vault:")) {
+		t.Fatalf("RewrapFileKey: %q %v", rewrapped, err)
+	}
+}
+
+func TestVaultTransit_Errors(t *testing.T) {
+	_, srv := newFakeTransit(t)
+
+	bad, _ := NewVaultTransit(VaultTransitConfig{Address: srv.URL, Token: "wrong", KeyName: "zynq"})
+	if _, err := bad.Wrap(make([]byte, 32)); err == nil || !strings.Contains(err.Error(), "permission denied") {
+		t.Errorf("expected permission error, got %v", err)
+	}
+	if _, err := NewWithProvider(bad); err == nil {
+		t.Error("NewWithProvider should fail when the content key cannot be fetched")
+	}
+
+	kek, _ := NewVaultTransit(VaultTransitConfig{Address: srv.URL, Token: "s.test", KeyName: "zynq"})
+	if _, err := kek.Unwrap([]byte("vault:v1:AAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAA")); err == nil {
+		t.Error("expected error for tampered ciphertext")
+	}
+
+	for _, cfg := range []VaultTransitConfig{
+		{Token: "t", KeyName: "k"},
+		{Address: "vault:8200", Token: "t", KeyName: "k"},
+		{Address: srv.URL, KeyName: "k"},
+		{Address: srv.URL, Token: "t"},
+	} {
+		if _, err := NewVaultTransit(cfg); err == nil {
+			t.Errorf("expected validation error for %+v", cfg)
+		}
+	}
+}
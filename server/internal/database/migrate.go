@@ -0,0 +1,242 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"io/fs"
+	"log/slog"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// migrationLockKey is the pg_advisory_lock key held while migrating, so only
+// one API instance applies migrations at a time.
+const migrationLockKey int64 = 0x7a796e716d696772 // "zynqmigr"
+
+// Migration is one versioned schema change.
+type Migration struct {
+	Version int
+	Name    string
+	Up      string
+	Down    string // empty when the migration cannot be reverted
+}
+
+// MigrationStatus reports whether a migration has been applied.
+type MigrationStatus struct {
+	Version   int
+	Name      string
+	AppliedAt *time.Time
+}
+
+// LoadMigrations reads NNN_name.sql (up) and NNN_name.down.sql (down) files
+// from fsys, sorted by version.
+func LoadMigrations(fsys fs.FS) ([]Migration, error) {
+	entries, err := fs.ReadDir(fsys, ".")
+	if err != nil {
+		return nil, err
+	}
+	byVersion := map[int]*Migration{}
+	for _, e := range entries {
+		file := e.Name()
+		if e.IsDir() || path.Ext(file) != ".sql" {
+			continue
+		}
+		base, isDown := strings.CutSuffix(strings.TrimSuffix(file, ".sql"), ".down")
+		num, name, ok := strings.Cut(base, "_")
+		version, err := strconv.Atoi(num)
+		if !ok || err != nil || version <= 0 || name == "" {
+			return nil, fmt.Errorf("migration %s: name must look like 001_description.sql", file)
+		}
+		body, err := fs.ReadFile(fsys, file)
+		if err != nil {
+			return nil, err
+		}
+
+		m := byVersion[version]
+		if m == nil {
+			m = &Migration{Version: version, Name: name}
+			byVersion[version] = m
+		} else if m.Name != name {
+			return nil, fmt.Errorf("migration %s: version %d is used by %q too", file, version, m.Name)
+		}
+		if isDown {
+			m.Down = string(body)
+		} else {
+			m.Up = string(body)
+		}
+	}
+
+	migrations := make([]Migration, 0, len(byVersion))
+	for _, m := range byVersion {
+		if m.Up == "" {
+			return nil, fmt.Errorf("migration %03d_%s: down file without up file", m.Version, m.Name)
+		}
+		migrations = append(migrations, *m)
+	}
+	sort.Slice(migrations, func(i, j int) bool { return migrations[i].Version < migrations[j].Version })
+	return migrations, nil
+}
+
+// Migrator applies and reverts migrations, tracking them in schema_migrations.
+type Migrator struct {
+	db         *sql.DB
+	migrations []Migration
+	logger     *slog.Logger
+}
+
+func NewMigrator(db *sql.DB, fsys fs.FS, logger *slog.Logger) (*Migrator, error) {
+	migrations, err := LoadMigrations(fsys)
+	if err != nil {
+		return nil, err
+	}
+	return &Migrator{db: db, migrations: migrations, logger: logger}, nil
+}
+
+// Up applies every pending migration in order and returns how many ran.
+// Each migration runs in its own transaction together with its
+// schema_migrations row, so a failure leaves earlier migrations applied.
+func (m *Migrator) Up(ctx context.Context) (int, error) {
+	var n int
+	err := m.locked(ctx, func(conn *sql.Conn) error {
+		applied, err := appliedVersions(ctx, conn)
+		if err != nil {
+			return err
+		}
+		for _, mig := range m.migrations {
+			if _, ok := applied[mig.Version]; ok {
+				continue
+			}
+			if err := runInTx(ctx, conn, mig.Up,
+				"INSERT INTO schema_migrations (version, name) VALUES ($1, $2)", mig.Version, mig.Name); err != nil {
+				return fmt.Errorf("apply %03d_%s: %w", mig.Version, mig.Name, err)
+			}
+			m.logger.Info("migration applied", "version", mig.Version, "name", mig.Name)
+			n++
+		}
+		return nil
+	})
+	return n, err
+}
+
+// Down reverts the last steps applied migrations, newest first.
+func (m *Migrator) Down(ctx context.Context, steps int) (int, error) {
+	var n int
+	err := m.locked(ctx, func(conn *sql.Conn) error {
+		applied, err := appliedVersions(ctx, conn)
+		if err != nil {
+			return err
+		}
+		for i := len(m.migrations) - 1; i >= 0 && n < steps; i-- {
+			mig := m.migrations[i]
+			if _, ok := applied[mig.Version]; !ok {
+				continue
+			}
+			if mig.Down == "" {
+				return fmt.Errorf("migration %03d_%s has no down file", mig.Version, mig.Name)
+			}
+			if err := runInTx(ctx, conn, mig.Down,
+				"DELETE FROM schema_migrations WHERE version = $1", mig.Version); err != nil {
+				return fmt.Errorf("revert %03d_%s: %w", mig.Version, mig.Name, err)
+			}
+			m.logger.Info("migration reverted", "version", mig.Version, "name", mig.Name)
+			n++
+		}
+		return nil
+	})
+	return n, err
+}
+
+// Status lists every known migration with its applied time, if any.
+func (m *Migrator) Status(ctx context.Context) ([]MigrationStatus, error) {
+	conn, err := m.db.Conn(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+	if err := ensureMigrationsTable(ctx, conn); err != nil {
+		return nil, err
+	}
+	applied, err := appliedVersions(ctx, conn)
+	if err != nil {
+		return nil, err
+	}
+	out := make([]MigrationStatus, 0, len(m.migrations))
+	for _, mig := range m.migrations {
+		s := MigrationStatus{Version: mig.Version, Name: mig.Name}
+		if at, ok := applied[mig.Version]; ok {
+			s.AppliedAt = &at
+		}
+		out = append(out, s)
+	}
+	return out, nil
+}
+
+// locked runs fn on a single connection holding the migration advisory lock.
+// Advisory locks belong to a session, so the lock and the migrations must
+// share one connection rather than go through the pool.
+func (m *Migrator) locked(ctx context.Context, fn func(*sql.Conn) error) error {
+	conn, err := m.db.Conn(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	if _, err := conn.ExecContext(ctx, "SELECT pg_advisory_lock($1)", migrationLockKey); err != nil {
+		return fmt.Errorf("acquire migration lock: %w", err)
+	}
+	defer conn.ExecContext(context.Background(), "SELECT pg_advisory_unlock($1)", migrationLockKey) //nolint:errcheck
+
+	if err := ensureMigrationsTable(ctx, conn); err != nil {
+		return err
+	}
+	return fn(conn)
+}
+
+func ensureMigrationsTable(ctx context.Context, conn *sql.Conn) error {
+	_, err := conn.ExecContext(ctx, `
+		CREATE TABLE IF NOT EXISTS schema_migrations (
+			version    BIGINT      PRIMARY KEY,
+			name       TEXT        NOT NULL,
+			applied_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+		)`)
+	return err
+}
+
+func appliedVersions(ctx context.Context, conn *sql.Conn) (map[int]time.Time, error) {
+	rows, err := conn.QueryContext(ctx, "SELECT version, applied_at FROM schema_migrations")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	applied := map[int]time.Time{}
+	for rows.Next() {
+		var v int
+		var at time.Time
+		if err := rows.Scan(&v, &at); err != nil {
+			return nil, err
+		}
+		applied[v] = at
+	}
+	return applied, rows.Err()
+}
+
+// runInTx executes a migration script and its bookkeeping statement
+// atomically.
+func runInTx(ctx context.Context, conn *sql.Conn, script, record string, args ...interface{}) error {
+	tx, err := conn.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback() //nolint:errcheck
+	if _, err := tx.ExecContext(ctx, script); err != nil {
+		return err
+	}
+	if _, err := tx.ExecContext(ctx, record, args...); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
@@ -0,0 +1,250 @@
+// Package directory authenticates users against an LDAP server or Active
+// Directory and lists the users a sync should mirror.
+//
+// Sign-in is search-then-bind: the service account finds the entry matching
+// the user filter, then the server checks the password by binding as that
+// entry. Connections are made per operation; directory sign-ins are rare
+// next to JWT-authenticated requests.
+package directory
+
+import (
+	"crypto/tls"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/go-ldap/ldap/v3"
+)
+
+// ErrInvalidCredentials is returned when no entry matches the username or
+// the directory rejects the password.
+var ErrInvalidCredentials = errors.New("directory: invalid credentials")
+
+// pageSize is the number of entries requested per page when listing users;
+// Active Directory caps unpaged searches at 1000.
+const pageSize = 500
+
+// Config describes how to reach and read the directory.
+type Config struct {
+	// URL is ldap://host[:389] or ldaps://host[:636].
+	URL string
+	// StartTLS upgrades an ldap:// connection before binding.
+	StartTLS bool
+	// TLS is used for ldaps:// and StartTLS. ServerName defaults to the URL
+	// host.
+	TLS *tls.Config
+
+	// BindDN and BindPassword are the service account that searches for
+	// users. Both empty means an anonymous search.
+	BindDN       string
+	BindPassword string
+
+	BaseDN string
+	// UserFilter selects the entry for a sign-in; {username} is replaced by
+	// the escaped name the user typed. With {username} replaced by * it
+	// selects every user to sync.
+	UserFilter string
+
+	// IDAttr holds a value that survives renames and moves (entryUUID,
+	// objectGUID). Entries without it are keyed by DN.
+	IDAttr    string
+	NameAttr  string
+	EmailAttr string
+	// GroupAttr lists the DNs of the groups the user belongs to (memberOf).
+	GroupAttr string
+
+	Timeout time.Duration
+}
+
+// User is a directory entry mapped to the fields ZynqCloud keeps.
+type User struct {
+	DN     string
+	ID     string
+	Name   string
+	Email  string
+	Groups []string // group DNs
+}
+
+// Directory is a configured LDAP server. It is safe for concurrent use.
+type Directory struct {
+	cfg Config
+}
+
+// New returns a Directory for cfg, filling in defaults for empty fields.
+func New(cfg Config) *Directory {
+	if cfg.UserFilter == "" {
+		cfg.UserFilter = "(&(objectClass=person)(|(uid={username})(mail={username})))"
+	}
+	if cfg.IDAttr == "" {
+		cfg.IDAttr = "entryUUID"
+	}
+	if cfg.NameAttr == "" {
+		cfg.NameAttr = "cn"
+	}
+	if cfg.EmailAttr == "" {
+		cfg.EmailAttr = "mail"
+	}
+	if cfg.GroupAttr == "" {
+		cfg.GroupAttr = "memberOf"
+	}
+	if cfg.Timeout == 0 {
+		cfg.Timeout = 10 * time.Second
+	}
+	return &Directory{cfg: cfg}
+}
+
+func (d *Directory) tlsConfig() *tls.Config {
+	tc := &tls.Config{MinVersion: tls.VersionTLS12}
+	if d.cfg.TLS != nil {
+		tc = d.cfg.TLS.Clone()
+	}
+	if tc.ServerName == "" {
+		if u, err := url.Parse(d.cfg.URL); err == nil {
+			tc.ServerName = u.Hostname()
+		}
+	}
+	return tc
+}
+
+// connect dials the server, upgrades to TLS when configured and binds as
+// the service account.
+func (d *Directory) connect() (*ldap.Conn, error) {
+	tc := d.tlsConfig()
+	conn, err := ldap.DialURL(d.cfg.URL,
+		ldap.DialWithDialer(&net.Dialer{Timeout: d.cfg.Timeout}),
+		ldap.DialWithTLSConfig(tc))
+	if err != nil {
+		return nil, fmt.Errorf("directory: connect: %w", err)
+	}
+	conn.SetTimeout(d.cfg.Timeout)
+	if d.cfg.StartTLS && strings.HasPrefix(strings.ToLower(d.cfg.URL), "ldap://") {
+		if err := conn.StartTLS(tc); err != nil {
+			conn.Close()
+			return nil, fmt.Errorf("directory: starttls: %w", err)
+		}
+	}
+	if d.cfg.BindDN != "" {
+		if err := conn.Bind(d.cfg.BindDN, d.cfg.BindPassword); err != nil {
+			conn.Close()
+			return nil, fmt.Errorf("directory: service bind: %w", err)
+		}
+	}
+	return conn, nil
+}
+
+func (d *Directory) attributes() []string {
+	return []string{d.cfg.IDAttr, d.cfg.NameAttr, d.cfg.EmailAttr, d.cfg.GroupAttr}
+}
+
+func (d *Directory) toUser(e *ldap.Entry) User {
+	u := User{
+		DN:     e.DN,
+		Name:   e.GetEqualFoldAttributeValue(d.cfg.NameAttr),
+		Email:  strings.ToLower(strings.TrimSpace(e.GetEqualFoldAttributeValue(d.cfg.EmailAttr))),
+		Groups: e.GetEqualFoldAttributeValues(d.cfg.GroupAttr),
+	}
+	// objectGUID is binary; store it as hex so it fits a text column.
+	if raw := e.GetEqualFoldRawAttributeValue(d.cfg.IDAttr); len(raw) > 0 {
+		if utf8.Valid(raw) && !strings.ContainsRune(string(raw), 0) {
+			u.ID = string(raw)
+		} else {
+			u.ID = hex.EncodeToString(raw)
+		}
+	} else {
+		u.ID = "dn:" + strings.ToLower(e.DN)
+	}
+	return u
+}
+
+// Authenticate checks username and password against the directory and
+// returns the user's entry.
+func (d *Directory) Authenticate(username, password string) (*User, error) {
+	username = strings.TrimSpace(username)
+	// An empty password would be an unauthenticated bind, which many
+	// servers answer with success.
+	if username == "" || password == "" {
+		return nil, ErrInvalidCredentials
+	}
+	conn, err := d.connect()
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+
+	filter := strings.ReplaceAll(d.cfg.UserFilter, "{username}", ldap.EscapeFilter(username))
+	res, err := conn.Search(ldap.NewSearchRequest(d.cfg.BaseDN, ldap.ScopeWholeSubtree, ldap.NeverDerefAliases,
+		2, int(d.cfg.Timeout.Seconds()), false, filter, d.attributes(), nil))
+	if err != nil && (res == nil || !ldap.IsErrorWithCode(err, ldap.LDAPResultSizeLimitExceeded)) {
+		return nil, fmt.Errorf("directory: search: %w", err)
+	}
+	switch n := len(res.Entries); {
+	case n == 0:
+		return nil, ErrInvalidCredentials
+	case n > 1:
+		return nil, fmt.Errorf("directory: %q matches more than one entry; tighten LDAP_USER_FILTER", username)
+	}
+	entry := res.Entries[0]
+
+	if err := conn.Bind(entry.DN, password); err != nil {
+		if ldap.IsErrorWithCode(err, ldap.LDAPResultInvalidCredentials) {
+			return nil, ErrInvalidCredentials
+		}
+		return nil, fmt.Errorf("directory: bind: %w", err)
+	}
+	u := d.toUser(entry)
+	return &u, nil
+}
+
+// Users lists every entry the user filter matches.
+func (d *Directory) Users() ([]User, error) {
+	conn, err := d.connect()
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+
+	filter := strings.ReplaceAll(d.cfg.UserFilter, "{username}", "*")
+	res, err := conn.SearchWithPaging(ldap.NewSearchRequest(d.cfg.BaseDN, ldap.ScopeWholeSubtree, ldap.NeverDerefAliases,
+		0, 0, false, filter, d.attributes(), nil), pageSize)
+	if err != nil {
+		return nil, fmt.Errorf("directory: list users: %w", err)
+	}
+	users := make([]User, 0, len(res.Entries))
+	for _, e := range res.Entries {
+		users = append(users, d.toUser(e))
+	}
+	return users, nil
+}
+
+// InGroup reports whether any of groups (DNs) is one of want. Entries in
+// want are either full DNs or a group's common name.
+func InGroup(groups, want []string) bool {
+	for _, g := range groups {
+		for _, w := range want {
+			if groupMatches(g, w) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func groupMatches(groupDN, want string) bool {
+	dn, err := ldap.ParseDN(groupDN)
+	if err != nil {
+		return strings.EqualFold(groupDN, want)
+	}
+	if strings.Contains(want, "=") {
+		w, err := ldap.ParseDN(want)
+		return err == nil && dn.EqualFold(w)
+	}
+	if len(dn.RDNs) == 0 || len(dn.RDNs[0].Attributes) == 0 {
+		return false
+	}
+	return strings.EqualFold(dn.RDNs[0].Attributes[0].Value, want)
+}
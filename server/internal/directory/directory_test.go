@@ -0,0 +1,143 @@
+package directory_test
+
+import (
+	"crypto/tls"
+	"errors"
+	"testing"
+
+	"github.com/zynqcloud/api/internal/directory"
+	"github.com/zynqcloud/api/internal/directory/ldaptest"
+)
+
+const (
+	base     = "dc=example,dc=com"
+	adminsDN = "cn=zynq-admins,ou=groups,dc=example,dc=com"
+	staffDN  = "cn=staff,ou=groups,dc=example,dc=com"
+)
+
+func populate(s *ldaptest.Server) {
+	s.Add("cn=svc,ou=system,"+base, "svc-pass", map[string][]string{"objectClass": {"account"}})
+	s.Add("uid=ada,ou=people,"+base, "ada-pass", map[string][]string{
+		"objectClass": {"person", "inetOrgPerson"},
+		"uid":         {"ada"},
+		"cn":          {"Ada Lovelace"},
+		"mail":        {"Ada@Example.com"},
+		"entryUUID":   {"6b1f4f9c-0000-4000-8000-000000000001"},
+		"memberOf":    {adminsDN, staffDN},
+	})
+	s.Add("uid=bob,ou=people,"+base, "bob-pass", map[string][]string{
+		"objectClass": {"person"},
+		"uid":         {"bob"},
+		"cn":          {"Bob"},
+		"mail":        {"bob@example.com"},
+		"memberOf":    {staffDN},
+	})
+}
+
+func newDirectory(s *ldaptest.Server, startTLS bool) *directory.Directory {
+	return directory.New(directory.Config{
+		URL:          s.URL,
+		StartTLS:     startTLS,
+		TLS:          &tls.Config{RootCAs: s.RootCAs, MinVersion: tls.VersionTLS12},
+		BindDN:       "cn=svc,ou=system," + base,
+		BindPassword: "svc-pass",
+		BaseDN:       base,
+	})
+}
+
+func TestAuthenticate(t *testing.T) {
+	s := ldaptest.NewServer()
+	defer s.Close()
+	populate(s)
+	d := newDirectory(s, true)
+
+	u, err := d.Authenticate("ada", "ada-pass")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if u.ID != "6b1f4f9c-0000-4000-8000-000000000001" || u.Name != "Ada Lovelace" || u.Email != "ada@example.com" || len(u.Groups) != 2 {
+		t.Errorf("unexpected user %+v", u)
+	}
+	// The default filter also matches the email address.
+	if _, err := d.Authenticate("bob@example.com", "bob-pass"); err != nil {
+		t.Errorf("sign-in by email: %v", err)
+	}
+
+	cases := map[string][2]string{
+		"wrong password": {"ada", "nope"},
+		"unknown user":   {"carol", "ada-pass"},
+		// Would be an unauthenticated bind, which the server accepts.
+		"empty password": {"ada", ""},
+		// A filter injection matching every entry must not pick one.
+		"injection": {"*)(uid=*", "ada-pass"},
+	}
+	for name, c := range cases {
+		if _, err := d.Authenticate(c[0], c[1]); !errors.Is(err, directory.ErrInvalidCredentials) {
+			t.Errorf("%s: got %v, want ErrInvalidCredentials", name, err)
+		}
+	}
+}
+
+func TestAuthenticateLDAPS(t *testing.T) {
+	s := ldaptest.NewTLSServer()
+	defer s.Close()
+	populate(s)
+	if _, err := newDirectory(s, false).Authenticate("ada", "ada-pass"); err != nil {
+		t.Fatal(err)
+	}
+
+	// An untrusted certificate fails the connection.
+	d := directory.New(directory.Config{URL: s.URL, BaseDN: base, BindDN: "cn=svc,ou=system," + base, BindPassword: "svc-pass"})
+	if _, err := d.Authenticate("ada", "ada-pass"); err == nil || errors.Is(err, directory.ErrInvalidCredentials) {
+		t.Errorf("untrusted server: got %v, want a connection error", err)
+	}
+}
+
+func TestServiceBindRequired(t *testing.T) {
+	s := ldaptest.NewServer()
+	defer s.Close()
+	populate(s)
+	d := directory.New(directory.Config{URL: s.URL, BaseDN: base, BindDN: "cn=svc,ou=system," + base, BindPassword: "wrong"})
+	if _, err := d.Authenticate("ada", "ada-pass"); err == nil || errors.Is(err, directory.ErrInvalidCredentials) {
+		t.Errorf("bad service account: got %v, want a bind error", err)
+	}
+}
+
+func TestUsers(t *testing.T) {
+	s := ldaptest.NewServer()
+	defer s.Close()
+	populate(s)
+	users, err := newDirectory(s, false).Users()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(users) != 2 {
+		t.Fatalf("got %d users, want 2", len(users))
+	}
+	for _, u := range users {
+		// Entries without entryUUID are keyed by DN.
+		if u.Email == "bob@example.com" && u.ID != "dn:uid=bob,ou=people,dc=example,dc=com" {
+			t.Errorf("bob ID = %q", u.ID)
+		}
+	}
+}
+
+func TestInGroup(t *testing.T) {
+	groups := []string{adminsDN, staffDN}
+	cases := []struct {
+		want []string
+		ok   bool
+	}{
+		{[]string{"zynq-admins"}, true},
+		{[]string{"ZYNQ-ADMINS"}, true},
+		{[]string{"CN=Staff, OU=Groups, DC=example, DC=com"}, true},
+		{[]string{"cn=staff,ou=other,dc=example,dc=com"}, false},
+		{[]string{"groups"}, false},
+		{nil, false},
+	}
+	for _, c := range cases {
+		if got := directory.InGroup(groups, c.want); got != c.ok {
+			t.Errorf("InGroup(%v) = %v, want %v", c.want, got, c.ok)
+		}
+	}
+}
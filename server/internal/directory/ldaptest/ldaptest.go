@@ -0,0 +1,424 @@
+// Package ldaptest runs a small in-process LDAP server for tests. It
+// answers simple binds, subtree and base searches with and/or/not,
+// equality, substring and presence filters, and StartTLS. Like many real
+// servers it accepts unauthenticated binds (a DN with an empty password),
+// so clients are tested against that trap too.
+package ldaptest
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"math/big"
+	"net"
+	"strings"
+	"sync"
+	"time"
+
+	ber "github.com/go-asn1-ber/asn1-ber"
+	"github.com/go-ldap/ldap/v3"
+)
+
+const startTLSOID = "1.3.6.1.4.1.1466.20037"
+
+// Server is a running directory. Its address is URL.
+type Server struct {
+	URL string
+	// RootCAs trusts the server's certificate, for ldaps:// and StartTLS.
+	RootCAs *x509.CertPool
+
+	ln  net.Listener
+	tls *tls.Config
+	wg  sync.WaitGroup
+
+	mu      sync.Mutex
+	entries map[string]*entry
+	conns   map[net.Conn]struct{}
+	closed  bool
+}
+
+type entry struct {
+	dn       string
+	password string
+	attrs    map[string][]string
+}
+
+// NewServer starts an ldap:// server that supports StartTLS. Close it when
+// done.
+func NewServer() *Server {
+	return start(false)
+}
+
+// NewTLSServer starts an ldaps:// server.
+func NewTLSServer() *Server {
+	return start(true)
+}
+
+func start(implicitTLS bool) *Server {
+	tc, pool := selfSigned()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		panic(err)
+	}
+	s := &Server{
+		RootCAs: pool,
+		tls:     tc,
+		entries: make(map[string]*entry),
+		conns:   make(map[net.Conn]struct{}),
+	}
+	if implicitTLS {
+		s.ln = tls.NewListener(ln, tc)
+		s.URL = "ldaps://" + ln.Addr().String()
+	} else {
+		s.ln = ln
+		s.URL = "ldap://" + ln.Addr().String()
+	}
+	s.wg.Add(1)
+	go s.accept()
+	return s
+}
+
+// Add stores an entry, replacing any entry with the same DN. password is
+// the entry's userPassword; empty means it cannot bind.
+func (s *Server) Add(dn, password string, attrs map[string][]string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.entries[normDN(dn)] = &entry{dn: dn, password: password, attrs: attrs}
+}
+
+// Delete removes an entry.
+func (s *Server) Delete(dn string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.entries, normDN(dn))
+}
+
+// Close stops the server and drops open connections.
+func (s *Server) Close() {
+	s.mu.Lock()
+	s.closed = true
+	for c := range s.conns {
+		c.Close()
+	}
+	s.mu.Unlock()
+	s.ln.Close()
+	s.wg.Wait()
+}
+
+func (s *Server) accept() {
+	defer s.wg.Done()
+	for {
+		c, err := s.ln.Accept()
+		if err != nil {
+			return
+		}
+		s.mu.Lock()
+		if s.closed {
+			s.mu.Unlock()
+			c.Close()
+			return
+		}
+		s.conns[c] = struct{}{}
+		s.mu.Unlock()
+		s.wg.Add(1)
+		go s.serve(c)
+	}
+}
+
+func (s *Server) serve(c net.Conn) {
+	defer s.wg.Done()
+	defer func() {
+		s.mu.Lock()
+		delete(s.conns, c)
+		s.mu.Unlock()
+		c.Close()
+	}()
+
+	bound := false
+	for {
+		p, err := ber.ReadPacket(c)
+		if err != nil || len(p.Children) < 2 {
+			return
+		}
+		id, _ := p.Children[0].Value.(int64)
+		op := p.Children[1]
+		switch op.Tag {
+		case ldap.ApplicationBindRequest:
+			var code int
+			code, bound = s.bind(op)
+			write(c, id, result(ldap.ApplicationBindResponse, code, ""))
+		case ldap.ApplicationUnbindRequest:
+			return
+		case ldap.ApplicationSearchRequest:
+			if !bound {
+				write(c, id, result(ldap.ApplicationSearchResultDone, ldap.LDAPResultInsufficientAccessRights, "bind first"))
+				continue
+			}
+			s.search(c, id, op)
+		case ldap.ApplicationAbandonRequest:
+		case ldap.ApplicationExtendedRequest:
+			if len(op.Children) == 0 || str(op.Children[0]) != startTLSOID {
+				write(c, id, result(ldap.ApplicationExtendedResponse, ldap.LDAPResultProtocolError, "unsupported extended operation"))
+				continue
+			}
+			if _, ok := c.(*tls.Conn); ok {
+				write(c, id, result(ldap.ApplicationExtendedResponse, ldap.LDAPResultOperationsError, "TLS already active"))
+				continue
+			}
+			write(c, id, result(ldap.ApplicationExtendedResponse, ldap.LDAPResultSuccess, ""))
+			tc := tls.Server(c, s.tls)
+			if err := tc.Handshake(); err != nil {
+				return
+			}
+			s.mu.Lock()
+			delete(s.conns, c)
+			s.conns[tc] = struct{}{}
+			s.mu.Unlock()
+			c = tc
+		default:
+			write(c, id, result(ldap.ApplicationExtendedResponse, ldap.LDAPResultUnwillingToPerform, "unsupported operation"))
+		}
+	}
+}
+
+// bind handles a simple bind and reports the result code and whether the
+// connection is now authenticated.
+func (s *Server) bind(op *ber.Packet) (int, bool) {
+	if len(op.Children) < 3 || op.Children[2].Tag != 0 {
+		return ldap.LDAPResultAuthMethodNotSupported, false
+	}
+	name := str(op.Children[1])
+	password := str(op.Children[2])
+	if password == "" {
+		// Anonymous or unauthenticated bind (RFC 4513 §5.1.2): succeeds
+		// without authenticating.
+		return ldap.LDAPResultSuccess, false
+	}
+	s.mu.Lock()
+	e := s.entries[normDN(name)]
+	s.mu.Unlock()
+	if e == nil || e.password == "" || e.password != password {
+		return ldap.LDAPResultInvalidCredentials, false
+	}
+	return ldap.LDAPResultSuccess, true
+}
+
+func (s *Server) search(c net.Conn, id int64, op *ber.Packet) {
+	if len(op.Children) < 8 {
+		write(c, id, result(ldap.ApplicationSearchResultDone, ldap.LDAPResultProtocolError, "malformed search"))
+		return
+	}
+	base := normDN(str(op.Children[0]))
+	scope, _ := op.Children[1].Value.(int64)
+	sizeLimit, _ := op.Children[3].Value.(int64)
+	filter := op.Children[6]
+	var wanted []string
+	for _, a := range op.Children[7].Children {
+		wanted = append(wanted, str(a))
+	}
+
+	s.mu.Lock()
+	var matches []*entry
+	for dn, e := range s.entries {
+		inScope := dn == base
+		if scope != ldap.ScopeBaseObject {
+			inScope = inScope || base == "" || strings.HasSuffix(dn, ","+base)
+		}
+		if inScope && matchFilter(filter, e) {
+			matches = append(matches, e)
+		}
+	}
+	s.mu.Unlock()
+
+	code := ldap.LDAPResultSuccess
+	if sizeLimit > 0 && int64(len(matches)) > sizeLimit {
+		matches = matches[:sizeLimit]
+		code = ldap.LDAPResultSizeLimitExceeded
+	}
+	for _, e := range matches {
+		write(c, id, searchEntry(e, wanted))
+	}
+	write(c, id, result(ldap.ApplicationSearchResultDone, code, ""))
+}
+
+func matchFilter(f *ber.Packet, e *entry) bool {
+	switch f.Tag {
+	case ldap.FilterAnd:
+		for _, child := range f.Children {
+			if !matchFilter(child, e) {
+				return false
+			}
+		}
+		return true
+	case ldap.FilterOr:
+		for _, child := range f.Children {
+			if matchFilter(child, e) {
+				return true
+			}
+		}
+		return false
+	case ldap.FilterNot:
+		return len(f.Children) == 1 && !matchFilter(f.Children[0], e)
+	case ldap.FilterEqualityMatch:
+		if len(f.Children) != 2 {
+			return false
+		}
+		want := str(f.Children[1])
+		for _, v := range e.values(str(f.Children[0])) {
+			if strings.EqualFold(v, want) {
+				return true
+			}
+		}
+		return false
+	case ldap.FilterPresent:
+		return len(e.values(str(f))) > 0
+	case ldap.FilterSubstrings:
+		if len(f.Children) != 2 {
+			return false
+		}
+		for _, v := range e.values(str(f.Children[0])) {
+			if matchSubstrings(strings.ToLower(v), f.Children[1].Children) {
+				return true
+			}
+		}
+		return false
+	}
+	return false
+}
+
+func matchSubstrings(v string, parts []*ber.Packet) bool {
+	for _, p := range parts {
+		s := strings.ToLower(str(p))
+		switch p.Tag {
+		case ldap.FilterSubstringsInitial:
+			if !strings.HasPrefix(v, s) {
+				return false
+			}
+			v = v[len(s):]
+		case ldap.FilterSubstringsAny:
+			i := strings.Index(v, s)
+			if i < 0 {
+				return false
+			}
+			v = v[i+len(s):]
+		case ldap.FilterSubstringsFinal:
+			if !strings.HasSuffix(v, s) {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+func (e *entry) values(attr string) []string {
+	for k, v := range e.attrs {
+		if strings.EqualFold(k, attr) {
+			return v
+		}
+	}
+	return nil
+}
+
+func searchEntry(e *entry, wanted []string) *ber.Packet {
+	p := ber.Encode(ber.ClassApplication, ber.TypeConstructed, ldap.ApplicationSearchResultEntry, nil, "Search Result Entry")
+	p.AppendChild(octets(e.dn))
+	attrs := ber.NewSequence("Attributes")
+	for name, vals := range e.attrs {
+		if !selected(name, wanted) {
+			continue
+		}
+		a := ber.NewSequence("Attribute")
+		a.AppendChild(octets(name))
+		set := ber.Encode(ber.ClassUniversal, ber.TypeConstructed, ber.TagSet, nil, "Values")
+		for _, v := range vals {
+			set.AppendChild(octets(v))
+		}
+		a.AppendChild(set)
+		attrs.AppendChild(a)
+	}
+	p.AppendChild(attrs)
+	return p
+}
+
+func selected(name string, wanted []string) bool {
+	if len(wanted) == 0 {
+		return true
+	}
+	for _, w := range wanted {
+		if w == "*" || strings.EqualFold(w, name) {
+			return true
+		}
+	}
+	return false
+}
+
+func result(tag ber.Tag, code int, message string) *ber.Packet {
+	p := ber.Encode(ber.ClassApplication, ber.TypeConstructed, tag, nil, "Result")
+	p.AppendChild(ber.NewInteger(ber.ClassUniversal, ber.TypePrimitive, ber.TagEnumerated, int64(code), "resultCode"))
+	p.AppendChild(octets(""))
+	p.AppendChild(octets(message))
+	return p
+}
+
+func octets(s string) *ber.Packet {
+	return ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, s, "")
+}
+
+func write(c net.Conn, id int64, op *ber.Packet) {
+	p := ber.Encode(ber.ClassUniversal, ber.TypeConstructed, ber.TagSequence, nil, "LDAP Response")
+	p.AppendChild(ber.NewInteger(ber.ClassUniversal, ber.TypePrimitive, ber.TagInteger, id, "Message ID"))
+	p.AppendChild(op)
+	_, _ = c.Write(p.Bytes())
+}
+
+func normDN(dn string) string {
+	parts := strings.Split(dn, ",")
+	for i, p := range parts {
+		parts[i] = strings.ToLower(strings.TrimSpace(p))
+	}
+	return strings.Join(parts, ",")
+}
+
+// selfSigned returns a server config with a fresh certificate for
+// 127.0.0.1 and localhost, and a pool that trusts it.
+func selfSigned() (*tls.Config, *x509.CertPool) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		panic(err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "ldaptest"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(24 * time.Hour),
+		IPAddresses:           []net.IP{net.IPv4(127, 0, 0, 1)},
+		DNSNames:              []string{"localhost"},
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		panic(err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		panic(err)
+	}
+	pool := x509.NewCertPool()
+	pool.AddCert(cert)
+	return &tls.Config{
+		Certificates: []tls.Certificate{{Certificate: [][]byte{der}, PrivateKey: key}},
+		MinVersion:   tls.VersionTLS12,
+	}, pool
+}
+
+// str returns a primitive's content. ber only decodes universal types into
+// Value, so context-tagged fields are read from Data.
+func str(p *ber.Packet) string {
+	return p.Data.String()
+}
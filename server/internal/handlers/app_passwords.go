@@ -0,0 +1,303 @@
+package handlers
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/google/uuid"
+	mw "github.com/zynqcloud/api/internal/middleware"
+	"github.com/zynqcloud/api/internal/models"
+	"gorm.io/gorm"
+)
+
+// App passwords
+//
+// Clients that can only send a username and password (WebDAV mounts, sync
+// tools) sign in with a generated app password instead of the account
+// password. Each one is shown once at creation, stored as a SHA-256 hash and
+// can be revoked on its own. The secrets carry 256 bits of entropy, so an
+// unsalted hash is enough and lets a login look the row up directly.
+//
+// The same secret is a personal access token for scripts using the JSON
+// API: sent as "Authorization: Bearer <secret>" it stands in for a browser
+// session on the routes its scopes cover (see middleware.RequireScope).
+// Tokens may expire; usage is audit-logged at most once per touch interval.
+
+var errInvalidAppPassword = errors.New("invalid app password")
+
+// appPasswordTouchInterval limits last_used_at writes and "app_password.use"
+// audit entries; WebDAV clients send many requests per operation.
+const appPasswordTouchInterval = time.Minute
+
+// appPasswordPrefix marks generated secrets so they are recognisable in
+// scripts and secret scanners.
+const appPasswordPrefix = "zpat_"
+
+// defaultAppPasswordScopes is what a password created without scopes gets:
+// everything a WebDAV mount needs.
+var defaultAppPasswordScopes = []string{mw.ScopeFilesRead, mw.ScopeFilesWrite, mw.ScopeSpacesRead, mw.ScopeSpacesWrite}
+
+// maxAppPasswordDays caps expiresInDays.
+const maxAppPasswordDays = 3650
+
+func hashAppPassword(secret string) string {
+	sum := sha256.Sum256([]byte(secret))
+	return hex.EncodeToString(sum[:])
+}
+
+// lookupAppPassword returns the unexpired app password with secret and its
+// active owner.
+func lookupAppPassword(db *gorm.DB, secret string) (*models.AppPassword, *models.User, error) {
+	if secret == "" {
+		return nil, nil, errInvalidAppPassword
+	}
+	var ap models.AppPassword
+	if err := db.Where("token_hash = ? AND (expires_at IS NULL OR expires_at > ?)", hashAppPassword(secret), time.Now()).
+		First(&ap).Error; err != nil {
+		return nil, nil, errInvalidAppPassword
+	}
+	var user models.User
+	if err := db.Where("id = ? AND disabled_at IS NULL", ap.UserID).First(&user).Error; err != nil {
+		return nil, nil, errInvalidAppPassword
+	}
+	return &ap, &user, nil
+}
+
+// authenticateAppPassword returns the app password with secret and its owner
+// when email matches that user.
+func authenticateAppPassword(db *gorm.DB, r *http.Request, email, secret string) (*models.AppPassword, *models.User, error) {
+	email = strings.ToLower(strings.TrimSpace(email))
+	if email == "" {
+		return nil, nil, errInvalidAppPassword
+	}
+	ap, user, err := lookupAppPassword(db, secret)
+	if err != nil || user.Email != email {
+		return nil, nil, errInvalidAppPassword
+	}
+	touchAppPassword(db, r, ap, user, "webdav")
+	return ap, user, nil
+}
+
+// touchAppPassword records a use of ap, at most once per
+// appPasswordTouchInterval.
+func touchAppPassword(db *gorm.DB, r *http.Request, ap *models.AppPassword, user *models.User, via string) {
+	now := time.Now()
+	if ap.LastUsedAt != nil && now.Sub(*ap.LastUsedAt) <= appPasswordTouchInterval {
+		return
+	}
+	// Conditional, so concurrent requests record one use between them.
+	res := db.Model(&models.AppPassword{}).
+		Where("id = ? AND (last_used_at IS NULL OR last_used_at <= ?)", ap.ID, now.Add(-appPasswordTouchInterval)).
+		UpdateColumn("last_used_at", now)
+	if res.Error != nil || res.RowsAffected == 0 {
+		return
+	}
+	ap.LastUsedAt = &now
+	uid := user.ID
+	LogAudit(db, AuditEntry{
+		UserID:       &uid,
+		UserName:     user.Name,
+		UserEmail:    user.Email,
+		Action:       "app_password.use",
+		ResourceType: "app_password",
+		ResourceName: ap.Name,
+		ResourceID:   ap.ID.String(),
+		IPAddress:    auditIP(r),
+		Metadata:     models.JSONB{"via": via},
+	})
+}
+
+// TokenStore authenticates app passwords sent as Bearer tokens. It is the
+// token authenticator for middleware.Auth.
+type TokenStore struct {
+	db *gorm.DB
+}
+
+func NewTokenStore(db *gorm.DB) *TokenStore {
+	return &TokenStore{db: db}
+}
+
+func (s *TokenStore) AuthenticateToken(r *http.Request, token string) (*mw.Claims, bool) {
+	ap, user, err := lookupAppPassword(s.db, token)
+	if err != nil {
+		return nil, false
+	}
+	touchAppPassword(s.db, r, ap, user, "api")
+	return appPasswordClaims(ap, user), true
+}
+
+// appPasswordClaims are the claims of a request signed in with ap.
+func appPasswordClaims(ap *models.AppPassword, user *models.User) *mw.Claims {
+	return &mw.Claims{
+		Sub:     user.ID.String(),
+		Email:   user.Email,
+		Role:    user.Role,
+		TokenID: ap.ID.String(),
+		Scopes:  ap.Scopes,
+	}
+}
+
+// validateScopes checks requested scopes against the known ones and the
+// user's role, and returns them de-duplicated in canonical order.
+func validateScopes(requested []string, role string) ([]string, error) {
+	if len(requested) == 0 {
+		return defaultAppPasswordScopes, nil
+	}
+	for _, s := range requested {
+		if !slices.Contains(mw.Scopes, s) {
+			return nil, fmt.Errorf("unknown scope %q", s)
+		}
+	}
+	var out []string
+	for _, s := range mw.Scopes {
+		if slices.Contains(requested, s) {
+			out = append(out, s)
+		}
+	}
+	if slices.Contains(out, mw.ScopeAdmin) && role != "admin" && role != "owner" {
+		return nil, errors.New("only admins can create tokens with the admin scope")
+	}
+	return out, nil
+}
+
+// GET /api/v1/auth/app-passwords
+func (h *AuthHandler) ListAppPasswords(w http.ResponseWriter, r *http.Request) {
+	claims := mw.GetClaims(r)
+	userID, _ := uuid.Parse(claims.Sub)
+
+	var passwords []models.AppPassword
+	if err := h.db.Where("user_id = ?", userID).Order("created_at DESC").Find(&passwords).Error; err != nil {
+		writeError(w, http.StatusInternalServerError, "Failed to list app passwords")
+		return
+	}
+	writeJSON(w, http.StatusOK, passwords)
+}
+
+// POST /api/v1/auth/app-passwords
+func (h *AuthHandler) CreateAppPassword(w http.ResponseWriter, r *http.Request) {
+	claims := mw.GetClaims(r)
+	userID, _ := uuid.Parse(claims.Sub)
+
+	var req struct {
+		Name          string   `json:"name"`
+		Scopes        []string `json:"scopes"`
+		ExpiresInDays *int     `json:"expiresInDays"` // omitted: never expires
+	}
+	if err := readJSON(r, &req); err != nil {
+		writeError(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+	req.Name = strings.TrimSpace(req.Name)
+	if req.Name == "" {
+		writeError(w, http.StatusBadRequest, "name is required")
+		return
+	}
+	if len(req.Name) > 100 {
+		writeError(w, http.StatusBadRequest, "name must be at most 100 characters")
+		return
+	}
+	scopes, err := validateScopes(req.Scopes, claims.Role)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	var expiresAt *time.Time
+	if req.ExpiresInDays != nil {
+		if *req.ExpiresInDays < 1 || *req.ExpiresInDays > maxAppPasswordDays {
+			writeError(w, http.StatusBadRequest, fmt.Sprintf("expiresInDays must be between 1 and %d", maxAppPasswordDays))
+			return
+		}
+		t := time.Now().AddDate(0, 0, *req.ExpiresInDays)
+		expiresAt = &t
+	}
+
+	secretBytes := make([]byte, 32)
+	if _, err := rand.Read(secretBytes); err != nil {
+		writeError(w, http.StatusInternalServerError, "Failed to generate app password")
+		return
+	}
+	secret := appPasswordPrefix + hex.EncodeToString(secretBytes)
+
+	ap := &models.AppPassword{
+		ID:        uuid.New(),
+		UserID:    userID,
+		Name:      req.Name,
+		TokenHash: hashAppPassword(secret),
+		Scopes:    scopes,
+		ExpiresAt: expiresAt,
+	}
+	if err := h.db.Create(ap).Error; err != nil {
+		writeError(w, http.StatusInternalServerError, "Failed to create app password")
+		return
+	}
+
+	var auditUser models.User
+	h.db.Select("name, email").First(&auditUser, "id = ?", userID)
+	LogAudit(h.db, AuditEntry{
+		UserID:       &userID,
+		UserName:     auditUser.Name,
+		UserEmail:    auditUser.Email,
+		Action:       "app_password.create",
+		ResourceType: "app_password",
+		ResourceName: ap.Name,
+		ResourceID:   ap.ID.String(),
+		IPAddress:    auditIP(r),
+		Metadata:     models.JSONB{"scopes": scopes, "expires_at": expiresAt},
+	})
+
+	// The secret is returned only here; the server keeps just its hash.
+	writeJSON(w, http.StatusCreated, map[string]interface{}{
+		"id":         ap.ID,
+		"name":       ap.Name,
+		"created_at": ap.CreatedAt,
+		"scopes":     ap.Scopes,
+		"expires_at": ap.ExpiresAt,
+		"password":   secret,
+		"username":   auditUser.Email,
+	})
+}
+
+// DELETE /api/v1/auth/app-passwords/{id}
+func (h *AuthHandler) DeleteAppPassword(w http.ResponseWriter, r *http.Request) {
+	claims := mw.GetClaims(r)
+	userID, _ := uuid.Parse(claims.Sub)
+
+	id, err := uuid.Parse(chi.URLParam(r, "id"))
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "Invalid app password ID")
+		return
+	}
+
+	var ap models.AppPassword
+	if err := h.db.Where("id = ? AND user_id = ?", id, userID).First(&ap).Error; err != nil {
+		writeError(w, http.StatusNotFound, "App password not found")
+		return
+	}
+	if err := h.db.Delete(&ap).Error; err != nil {
+		writeError(w, http.StatusInternalServerError, "Failed to revoke app password")
+		return
+	}
+
+	var auditUser models.User
+	h.db.Select("name, email").First(&auditUser, "id = ?", userID)
+	LogAudit(h.db, AuditEntry{
+		UserID:       &userID,
+		UserName:     auditUser.Name,
+		UserEmail:    auditUser.Email,
+		Action:       "app_password.revoke",
+		ResourceType: "app_password",
+		ResourceName: ap.Name,
+		ResourceID:   ap.ID.String(),
+		IPAddress:    auditIP(r),
+	})
+
+	writeJSON(w, http.StatusOK, map[string]string{"message": "App password revoked"})
+}
@@ -0,0 +1,26 @@
+package handlers
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestValidateScopes(t *testing.T) {
+	got, err := validateScopes(nil, "user")
+	if err != nil || !slices.Equal(got, defaultAppPasswordScopes) {
+		t.Errorf("no scopes: got %v, %v; want the WebDAV defaults", got, err)
+	}
+	got, err = validateScopes([]string{"spaces:read", "files:read", "files:read"}, "user")
+	if err != nil || !slices.Equal(got, []string{"files:read", "spaces:read"}) {
+		t.Errorf("got %v, %v", got, err)
+	}
+	if _, err := validateScopes([]string{"files:delete"}, "owner"); err == nil {
+		t.Error("unknown scope accepted")
+	}
+	if _, err := validateScopes([]string{"admin"}, "user"); err == nil {
+		t.Error("admin scope granted to a regular user")
+	}
+	if got, err := validateScopes([]string{"admin"}, "admin"); err != nil || !slices.Equal(got, []string{"admin"}) {
+		t.Errorf("admin: got %v, %v", got, err)
+	}
+}
@@ -4,15 +4,17 @@ import (
 	"crypto/rand"
 	"encoding/hex"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"log/slog"
 	"net/http"
 	"strings"
 	"time"
 
-	"github.com/golang-jwt/jwt/v5"
 	"github.com/google/uuid"
 	"github.com/zynqcloud/api/internal/config"
+	"github.com/zynqcloud/api/internal/crypto"
+	"github.com/zynqcloud/api/internal/directory"
 	mw "github.com/zynqcloud/api/internal/middleware"
 	"github.com/zynqcloud/api/internal/models"
 	"golang.org/x/crypto/bcrypt"
@@ -20,66 +22,77 @@ import (
 )
 
 type AuthHandler struct {
-	db  *gorm.DB
-	cfg *config.Config
+	db     *gorm.DB
+	cfg    *config.Config
+	crypto *crypto.Crypto
+	// totpLimiter caps second-factor attempts per user, on top of the
+	// per-IP login limit, so codes cannot be guessed from many addresses.
+	totpLimiter *mw.RateLimiter
+	// passkeys holds WebAuthn ceremonies waiting for the browser's response.
+	passkeys *passkeyCeremonies
+	// oidc is the single sign-on provider, nil when OIDC_ISSUER is unset.
+	oidc *oidcClient
+	// directory is the LDAP server, nil when LDAP_URL is unset.
+	directory *directory.Directory
 }
 
-func NewAuthHandler(db *gorm.DB, cfg *config.Config) *AuthHandler {
-	return &AuthHandler{db: db, cfg: cfg}
+func NewAuthHandler(db *gorm.DB, cfg *config.Config, c *crypto.Crypto) *AuthHandler {
+	return &AuthHandler{
+		db:          db,
+		cfg:         cfg,
+		crypto:      c,
+		totpLimiter: mw.NewRateLimiter(10, 15*time.Minute),
+		passkeys:    newPasskeyCeremonies(),
+		oidc:        newOIDCClient(cfg),
+		directory:   NewDirectory(cfg),
+	}
 }
 
-func (h *AuthHandler) generateToken(user *models.User) (string, error) {
-	claims := &mw.Claims{
-		Sub:   user.ID.String(),
-		Email: user.Email,
-		Role:  user.Role,
-		RegisteredClaims: jwt.RegisteredClaims{
-			ExpiresAt: jwt.NewNumericDate(time.Now().Add(7 * 24 * time.Hour)),
-			IssuedAt:  jwt.NewNumericDate(time.Now()),
-		},
-	}
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
-	return token.SignedString([]byte(h.cfg.JWTSecret))
-}
+// errPasswordLoginDisabled is the error message when PASSWORD_LOGIN=false.
+const errPasswordLoginDisabled = "Password sign-in is disabled — use single sign-on or a passkey"
 
-func (h *AuthHandler) setAuthCookie(w http.ResponseWriter, tokenStr string) {
-	secure := h.cfg.CookieSecure
+// errAccountDisabled is returned by issueSession for disabled accounts.
+var errAccountDisabled = errors.New("account disabled")
+
+// cookie builds an auth cookie. maxAge < 0 deletes it.
+func (h *AuthHandler) cookie(name, value, path string, maxAge int) *http.Cookie {
 	cookie := &http.Cookie{ // #nosec G124 -- Secure flag controlled by COOKIE_SECURE env var
-		Name:     "jid",
-		Value:    tokenStr,
+		Name:     name,
+		Value:    value,
 		HttpOnly: true,
-		Secure:   secure,
+		Secure:   h.cfg.CookieSecure,
 		SameSite: http.SameSiteLaxMode,
-		MaxAge:   7 * 24 * 60 * 60,
-		Path:     "/",
+		MaxAge:   maxAge,
+		Path:     path,
 	}
 	if h.cfg.CookieDomain != "" {
 		cookie.Domain = h.cfg.CookieDomain
 	}
-	http.SetCookie(w, cookie)
+	return cookie
+}
+
+func (h *AuthHandler) setAuthCookie(w http.ResponseWriter, tokenStr string) {
+	http.SetCookie(w, h.cookie("jid", tokenStr, "/", h.cfg.AccessTokenTTLMinutes*60))
 }
 
 func (h *AuthHandler) clearAuthCookie(w http.ResponseWriter) {
-	cookie := &http.Cookie{ // #nosec G124 -- Secure flag controlled by COOKIE_SECURE env var
-		Name:     "jid",
-		Value:    "",
-		HttpOnly: true,
-		Secure:   h.cfg.CookieSecure,
-		SameSite: http.SameSiteLaxMode,
-		MaxAge:   -1,
-		Path:     "/",
-	}
-	if h.cfg.CookieDomain != "" {
-		cookie.Domain = h.cfg.CookieDomain
-	}
-	http.SetCookie(w, cookie)
+	http.SetCookie(w, h.cookie("jid", "", "/", -1))
 }
 
 // GET /api/v1/auth/setup-status
 func (h *AuthHandler) SetupStatus(w http.ResponseWriter, r *http.Request) {
 	var count int64
 	h.db.Model(&models.User{}).Count(&count)
-	writeJSON(w, http.StatusOK, map[string]bool{"needsSetup": count == 0})
+	resp := map[string]interface{}{
+		"needsSetup":    count == 0,
+		"passwordLogin": h.cfg.PasswordLogin,
+		// Directory users may sign in with their username instead of email.
+		"ldap": h.directory != nil,
+	}
+	if h.oidc != nil {
+		resp["sso"] = map[string]string{"name": h.cfg.OIDCProviderName, "loginUrl": "/api/v1/auth/oidc/login"}
+	}
+	writeJSON(w, http.StatusOK, resp)
 }
 
 // POST /api/v1/auth/register
@@ -111,6 +124,13 @@ func (h *AuthHandler) Register(w http.ResponseWriter, r *http.Request) {
 	var userCount int64
 	h.db.Model(&models.User{}).Count(&userCount)
 
+	// The first account can always be created, so an SSO-only instance
+	// still gets an owner who can sign in with a passkey if SSO breaks.
+	if userCount > 0 && !h.cfg.PasswordLogin {
+		writeError(w, http.StatusForbidden, errPasswordLoginDisabled)
+		return
+	}
+
 	role := "user"
 	if userCount == 0 {
 		// First user becomes the instance owner
@@ -185,14 +205,12 @@ func (h *AuthHandler) Register(w http.ResponseWriter, r *http.Request) {
 	// Enroll new user in all existing spaces
 	AutoEnrollUserInSpaces(h.db, user.ID, user.Role)
 
-	tokenStr, err := h.generateToken(user)
+	tokenStr, refresh, err := h.startSession(w, r, user, "password")
 	if err != nil {
 		writeError(w, http.StatusInternalServerError, "Failed to generate token")
 		return
 	}
 
-	h.setAuthCookie(w, tokenStr)
-
 	uid := user.ID
 	LogAudit(h.db, AuditEntry{
 		UserID:    &uid,
@@ -205,12 +223,19 @@ func (h *AuthHandler) Register(w http.ResponseWriter, r *http.Request) {
 
 	writeJSON(w, http.StatusCreated, struct {
 		*models.User
-		Token string `json:"token"`
-	}{User: user, Token: tokenStr})
+		Token        string `json:"token"`
+		RefreshToken string `json:"refreshToken"`
+	}{User: user, Token: tokenStr, RefreshToken: refresh})
 }
 
 // POST /api/v1/auth/login
+//
+// With LDAP configured, email may also be a directory username.
 func (h *AuthHandler) Login(w http.ResponseWriter, r *http.Request) {
+	if !h.cfg.PasswordLogin && h.directory == nil {
+		writeError(w, http.StatusForbidden, errPasswordLoginDisabled)
+		return
+	}
 	var req struct {
 		Email    string `json:"email"`
 		Password string `json:"password"`
@@ -222,8 +247,20 @@ func (h *AuthHandler) Login(w http.ResponseWriter, r *http.Request) {
 
 	req.Email = strings.ToLower(strings.TrimSpace(req.Email))
 
+	var dirErr error
+	if h.directory != nil {
+		var handled bool
+		if handled, dirErr = h.directoryLogin(w, r, req.Email, req.Password); handled {
+			return
+		}
+	}
+
 	var user models.User
-	if err := h.db.Where("email = ?", req.Email).First(&user).Error; err != nil {
+	if !h.cfg.PasswordLogin || h.db.Where("email = ?", req.Email).First(&user).Error != nil {
+		if dirErr != nil {
+			writeError(w, http.StatusServiceUnavailable, "Directory is unavailable, try again later")
+			return
+		}
 		LogAudit(h.db, AuditEntry{
 			Action:    "auth.login_failed",
 			UserEmail: req.Email,
@@ -234,6 +271,25 @@ func (h *AuthHandler) Login(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	// Directory accounts sign in through the directory only.
+	if user.LDAPID != nil && h.directory != nil {
+		if dirErr != nil {
+			writeError(w, http.StatusServiceUnavailable, "Directory is unavailable, try again later")
+			return
+		}
+		uid := user.ID
+		LogAudit(h.db, AuditEntry{
+			UserID:    &uid,
+			UserName:  user.Name,
+			UserEmail: user.Email,
+			Action:    "auth.login_failed",
+			IPAddress: auditIP(r),
+			Metadata:  models.JSONB{"reason": "rejected by directory"},
+		})
+		writeError(w, http.StatusUnauthorized, "Invalid credentials")
+		return
+	}
+
 	if err := bcrypt.CompareHashAndPassword([]byte(user.PasswordHash), []byte(req.Password)); err != nil {
 		uid := user.ID
 		LogAudit(h.db, AuditEntry{
@@ -248,13 +304,57 @@ func (h *AuthHandler) Login(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	tokenStr, err := h.generateToken(&user)
+	if user.DisabledAt != nil {
+		writeError(w, http.StatusForbidden, "This account is disabled")
+		return
+	}
+
+	// Accounts with TOTP, or whose role requires it, finish signing in
+	// through /auth/login/2fa or with a passkey.
+	if h.needsSecondFactor(&user) {
+		h.startLoginChallenge(w, r, &user)
+		return
+	}
+
+	h.completeLogin(w, r, &user, nil, nil)
+}
+
+// completeLogin starts a session for an authenticated user and writes the
+// login response. recoveryCodes is set when the login also
+// finished a required 2FA enrollment; they are shown this once.
+func (h *AuthHandler) completeLogin(w http.ResponseWriter, r *http.Request, user *models.User, metadata models.JSONB, recoveryCodes []string) {
+	tokenStr, refresh, err := h.issueSession(w, r, user, metadata)
+	if errors.Is(err, errAccountDisabled) {
+		writeError(w, http.StatusForbidden, "This account is disabled")
+		return
+	}
 	if err != nil {
 		writeError(w, http.StatusInternalServerError, "Failed to generate token")
 		return
 	}
 
-	h.setAuthCookie(w, tokenStr)
+	writeJSON(w, http.StatusOK, struct {
+		*models.User
+		Token         string   `json:"token"`
+		RefreshToken  string   `json:"refreshToken"`
+		RecoveryCodes []string `json:"recoveryCodes,omitempty"`
+	}{User: user, Token: tokenStr, RefreshToken: refresh, RecoveryCodes: recoveryCodes})
+}
+
+// issueSession starts a session for an authenticated user and records the
+// login. It returns the access and refresh tokens.
+func (h *AuthHandler) issueSession(w http.ResponseWriter, r *http.Request, user *models.User, metadata models.JSONB) (string, string, error) {
+	if user.DisabledAt != nil {
+		return "", "", errAccountDisabled
+	}
+	method := "password"
+	if m, ok := metadata["method"].(string); ok {
+		method = m
+	}
+	tokenStr, refresh, err := h.startSession(w, r, user, method)
+	if err != nil {
+		return "", "", err
+	}
 
 	uid := user.ID
 	LogAudit(h.db, AuditEntry{
@@ -263,27 +363,26 @@ func (h *AuthHandler) Login(w http.ResponseWriter, r *http.Request) {
 		UserEmail: user.Email,
 		Action:    "auth.login",
 		IPAddress: auditIP(r),
+		Metadata:  metadata,
 	})
 
 	// Admin/owner always have unlimited storage — fix stale DB records on login
 	if (user.Role == "admin" || user.Role == "owner") && user.StorageLimit != 0 {
-		h.db.Model(&user).UpdateColumn("storage_limit", 0)
+		h.db.Model(user).UpdateColumn("storage_limit", 0)
 		user.StorageLimit = 0
 	}
-
-	writeJSON(w, http.StatusOK, struct {
-		*models.User
-		Token string `json:"token"`
-	}{User: &user, Token: tokenStr})
+	return tokenStr, refresh, nil
 }
 
 // POST /api/v1/auth/logout
 func (h *AuthHandler) Logout(w http.ResponseWriter, r *http.Request) {
-	claims := mw.GetClaims(r)
+	sess := h.requestSession(r)
 	h.clearAuthCookie(w)
-	if claims != nil {
+	h.clearRefreshCookie(w)
+	if sess != nil {
+		revokeSession(h.db, sess.ID)
 		var user models.User
-		if err := h.db.Select("id, name, email").First(&user, "email = ?", claims.Email).Error; err == nil {
+		if err := h.db.Select("id, name, email").First(&user, "id = ?", sess.UserID).Error; err == nil {
 			uid := user.ID
 			LogAudit(h.db, AuditEntry{
 				UserID:    &uid,
@@ -401,6 +500,10 @@ func (h *AuthHandler) ChangePassword(w http.ResponseWriter, r *http.Request) {
 		writeError(w, http.StatusNotFound, "User not found")
 		return
 	}
+	if user.LDAPID != nil && h.directory != nil {
+		writeError(w, http.StatusBadRequest, "Change your password in the company directory")
+		return
+	}
 
 	if err := bcrypt.CompareHashAndPassword([]byte(user.PasswordHash), []byte(req.OldPassword)); err != nil {
 		writeError(w, http.StatusUnauthorized, "Current password is incorrect")
@@ -427,11 +530,19 @@ func (h *AuthHandler) ChangePassword(w http.ResponseWriter, r *http.Request) {
 		IPAddress: auditIP(r),
 	})
 
+	// Sign out everywhere else; whoever knew the old password may be
+	// signed in.
+	revokeUserSessions(h.db, user.ID, currentSessionID(r))
+
 	writeJSON(w, http.StatusOK, map[string]string{"message": "Password changed successfully"})
 }
 
 // POST /api/v1/auth/forgot-password
 func (h *AuthHandler) ForgotPassword(w http.ResponseWriter, r *http.Request) {
+	if !h.cfg.PasswordLogin {
+		writeError(w, http.StatusForbidden, errPasswordLoginDisabled)
+		return
+	}
 	var req struct {
 		Email string `json:"email"`
 	}
@@ -526,6 +637,7 @@ func (h *AuthHandler) ResetPassword(w http.ResponseWriter, r *http.Request) {
 	// Mark token as used
 	now := time.Now()
 	h.db.Model(&reset).Update("used_at", now)
+	revokeUserSessions(h.db, reset.UserID, uuid.Nil)
 
 	// Fetch user for audit log.
 	var resetUser models.User
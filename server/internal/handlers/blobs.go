@@ -0,0 +1,225 @@
+package handlers
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/zynqcloud/api/internal/crypto"
+	"github.com/zynqcloud/api/internal/models"
+	"github.com/zynqcloud/api/internal/storage"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// Blob lifecycle
+//
+// Uploaded content is stored once in the CAS regardless of which user or
+// space uploads it. Blob IDs, DEKs and IVs are derived from the plaintext hash
+// with a key only the server holds (crypto.DeriveContentKeys), so sharing a
+// blob never requires handing one file's key to another user, and nothing on
+// disk or in the database lets an outsider test whether a given file is stored.
+//
+// blobs.ref_count counts file rows (trashed ones included) and file versions
+// that point at the blob. A reference is reserved before any bytes are written
+// so the garbage collector can never remove a blob that an in-flight upload is
+// about to use.
+
+// storeBlob re-encrypts a staged upload into the CAS, unless an
+// identical blob is already stored, and reserves one reference on it. The
+// caller must hand that reference to a file with attachBlob, or give it back
+// with releaseBlob if the file update fails.
+func storeBlob(db *gorm.DB, c *crypto.Crypto, cas *storage.CAS, staged *stagedUpload) (*models.Blob, bool, error) {
+	blobID, dek, iv := c.DeriveContentKeys(staged.sum)
+	storedDEK, err := c.WrapDEK(dek)
+	if err != nil {
+		return nil, false, fmt.Errorf("wrap blob key: %w", err)
+	}
+
+	keyID := c.KeyID()
+	blob := models.Blob{
+		ID:             blobID,
+		StoragePath:    storage.BlobPath(blobID),
+		Size:           staged.size,
+		EncryptedDEK:   storedDEK,
+		EncryptionIV:   iv,
+		EncryptionAlgo: "AES-256-GCM-STREAM",
+		KeyID:          &keyID,
+		RefCount:       1,
+	}
+	if err := db.Clauses(clause.OnConflict{
+		Columns: []clause.Column{{Name: "id"}},
+		DoUpdates: clause.Assignments(map[string]interface{}{
+			"ref_count":  gorm.Expr("blobs.ref_count + 1"),
+			"updated_at": gorm.Expr("NOW()"),
+		}),
+	}).Create(&blob).Error; err != nil {
+		return nil, false, fmt.Errorf("reserve blob: %w", err)
+	}
+	// Pick up the stored key material when the row already existed.
+	if err := db.First(&blob, "id = ?", blobID).Error; err != nil {
+		releaseBlob(db, blobID)
+		return nil, false, fmt.Errorf("load blob: %w", err)
+	}
+
+	res, err := cas.Put(blobID, func(w io.Writer) error {
+		plain := staged.open()
+		defer plain.Close()
+		_, err := crypto.EncryptStream(plain, w, dek, iv)
+		return err
+	})
+	if err != nil {
+		releaseBlob(db, blobID)
+		return nil, false, err
+	}
+	return &blob, res.IsNew, nil
+}
+
+// attachBlob points file at blob inside tx. Any blob the file referenced
+// before gives up its reference, since storeBlob reserved a fresh one.
+func attachBlob(tx *gorm.DB, file *models.File, blob *models.Blob, updates map[string]interface{}) error {
+	updates["blob_id"] = blob.ID
+	updates["storage_path"] = blob.StoragePath
+	updates["encrypted_dek"] = blob.EncryptedDEK
+	updates["encryption_iv"] = blob.EncryptionIV
+	updates["encryption_algo"] = blob.EncryptionAlgo
+	updates["key_id"] = blob.KeyID
+	if err := tx.Model(file).Updates(updates).Error; err != nil {
+		return err
+	}
+	if file.BlobID != nil {
+		if err := releaseBlob(tx, *file.BlobID); err != nil {
+			return err
+		}
+	}
+	blobID, storagePath := blob.ID, blob.StoragePath
+	file.BlobID = &blobID
+	file.StoragePath = &storagePath
+	file.EncryptedDEK = blob.EncryptedDEK
+	file.EncryptionIV = blob.EncryptionIV
+	file.EncryptionAlgo = blob.EncryptionAlgo
+	file.KeyID = blob.KeyID
+	return nil
+}
+
+// retainBlob adds one reference to a blob, for a new row that points at
+// content that is already stored.
+func retainBlob(db *gorm.DB, blobID string) error {
+	return db.Model(&models.Blob{}).Where("id = ?", blobID).Updates(map[string]interface{}{
+		"ref_count":  gorm.Expr("ref_count + 1"),
+		"updated_at": gorm.Expr("NOW()"),
+	}).Error
+}
+
+// releaseBlob drops one reference from a blob.
+func releaseBlob(db *gorm.DB, blobID string) error {
+	return db.Model(&models.Blob{}).Where("id = ?", blobID).Updates(map[string]interface{}{
+		"ref_count":  gorm.Expr("GREATEST(ref_count - 1, 0)"),
+		"updated_at": gorm.Expr("NOW()"),
+	}).Error
+}
+
+// releaseFileBlobs drops the blob references held by the given file rows and
+// their versions. Call it in the same transaction as, and before, deleting
+// the rows.
+func releaseFileBlobs(tx *gorm.DB, fileIDs []uuid.UUID) error {
+	if len(fileIDs) == 0 {
+		return nil
+	}
+	return tx.Exec(`
+		UPDATE blobs SET ref_count = GREATEST(blobs.ref_count - r.n, 0), updated_at = NOW()
+		FROM (
+			SELECT blob_id, COUNT(*) AS n FROM (
+				SELECT blob_id FROM files WHERE id IN ? AND blob_id IS NOT NULL
+				UNION ALL
+				SELECT blob_id FROM file_versions WHERE file_id IN ? AND blob_id IS NOT NULL
+			) refs
+			GROUP BY blob_id
+		) r
+		WHERE blobs.id = r.blob_id`, fileIDs, fileIDs).Error
+}
+
+// CollectBlobGarbage removes blobs that no file has referenced for at least
+// grace and returns how many were deleted. The grace period covers uploads
+// that reserved a reference but have not finished writing yet.
+//
+// Counters that drifted (for example rows removed by a cascading delete) are
+// corrected first, so a leaked reference delays collection by one grace period
+// instead of pinning the blob forever.
+func CollectBlobGarbage(db *gorm.DB, cas *storage.CAS, grace time.Duration) (int, error) {
+	cutoff := time.Now().Add(-grace)
+
+	if err := db.Exec(`
+		UPDATE blobs SET ref_count = 0
+		WHERE ref_count > 0 AND updated_at < ?
+		  AND NOT EXISTS (SELECT 1 FROM files WHERE files.blob_id = blobs.id)
+		  AND NOT EXISTS (SELECT 1 FROM file_versions WHERE file_versions.blob_id = blobs.id)`, cutoff).Error; err != nil {
+		return 0, fmt.Errorf("reconcile blob refs: %w", err)
+	}
+
+	var ids []string
+	if err := db.Model(&models.Blob{}).
+		Where("ref_count <= 0 AND updated_at < ?", cutoff).
+		Limit(1000).Pluck("id", &ids).Error; err != nil {
+		return 0, fmt.Errorf("list unreferenced blobs: %w", err)
+	}
+
+	var removed int
+	for _, id := range ids {
+		err := db.Transaction(func(tx *gorm.DB) error {
+			// Re-check under a row lock: an upload may have reserved the blob
+			// since the scan. storeBlob's upsert blocks on this lock.
+			var blob models.Blob
+			if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+				Where("id = ? AND ref_count <= 0", id).
+				Where("NOT EXISTS (SELECT 1 FROM files WHERE files.blob_id = blobs.id)").
+				Where("NOT EXISTS (SELECT 1 FROM file_versions WHERE file_versions.blob_id = blobs.id)").
+				First(&blob).Error; err != nil {
+				return nil // referenced again or already gone
+			}
+			if err := cas.Delete(id); err != nil {
+				return err
+			}
+			if err := tx.Delete(&blob).Error; err != nil {
+				return err
+			}
+			removed++
+			return nil
+		})
+		if err != nil {
+			return removed, fmt.Errorf("delete blob %s: %w", id, err)
+		}
+	}
+	return removed, nil
+}
+
+// RunBlobGCPeriodic starts a background goroutine that calls CollectBlobGarbage
+// on every interval until ctx is cancelled.
+//
+// Recommended values: interval=1h, grace=24h.
+func RunBlobGCPeriodic(ctx context.Context, db *gorm.DB, cas *storage.CAS, interval, grace time.Duration, logger *slog.Logger) <-chan struct{} {
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				n, err := CollectBlobGarbage(db, cas, grace)
+				if err != nil {
+					logger.Error("blob gc failed", "removed", n, "error", err)
+				} else if n > 0 {
+					logger.Info("blob gc: cycle complete", "removed", n)
+				}
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	return done
+}
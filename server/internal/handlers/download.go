@@ -0,0 +1,225 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/zynqcloud/api/internal/crypto"
+	"github.com/zynqcloud/api/internal/models"
+	"github.com/zynqcloud/api/internal/storage"
+)
+
+var errRangeNotSatisfiable = errors.New("range not satisfiable")
+
+// serveDecryptedFile streams the plaintext of file to w. GET requests may ask
+// for a single byte range (Range, optionally guarded by If-Range); for
+// AES-256-GCM-STREAM files only the 64 MiB chunks covering that range are
+// fetched from the backend and decrypted.
+func serveDecryptedFile(w http.ResponseWriter, r *http.Request, c *crypto.Crypto, backend storage.Backend, file *models.File) {
+	dek, err := c.DecryptFileKey(file.EncryptedDEK)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "Failed to decrypt file key")
+		return
+	}
+
+	mimeType := "application/octet-stream"
+	if file.MimeType != nil {
+		mimeType = *file.MimeType
+	}
+
+	etag := fileETag(file)
+	w.Header().Set("Content-Type", mimeType)
+	w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="%s"`, file.Name))
+	w.Header().Set("Cache-Control", "private, no-cache")
+	w.Header().Set("Accept-Ranges", "bytes")
+	w.Header().Set("ETag", etag)
+	w.Header().Set("Last-Modified", file.UpdatedAt.UTC().Format(http.TimeFormat))
+
+	if file.EncryptionAlgo != "AES-256-GCM-STREAM" {
+		serveLegacyDecryptedFile(w, r, backend, file, dek, etag)
+		return
+	}
+
+	start, length, partial, err := requestedRange(r, file.Size, etag, file.UpdatedAt)
+	if err != nil {
+		w.Header().Set("Content-Range", fmt.Sprintf("bytes */%d", file.Size))
+		writeError(w, http.StatusRequestedRangeNotSatisfiable, "Requested range not satisfiable")
+		return
+	}
+
+	if !partial {
+		// Streaming chunked decryption — no full-file buffering.
+		rc, _, err := backend.Read(*file.StoragePath)
+		if err != nil {
+			writeError(w, http.StatusNotFound, "File data not found")
+			return
+		}
+		defer rc.Close()
+		w.Header().Set("Content-Length", strconv.FormatInt(file.Size, 10))
+		w.WriteHeader(http.StatusOK)
+		if err := crypto.DecryptStream(rc, w, dek, file.EncryptionIV); err != nil {
+			slog.Error("stream decrypt failed", "file_id", file.ID, "err", err)
+		}
+		return
+	}
+
+	cipherStart, _ := crypto.StreamChunkOffset(start)
+	cipherEnd, _ := crypto.StreamChunkOffset(start + length - 1 + crypto.ChunkSize)
+	rc, err := storage.OpenRange(backend, *file.StoragePath, cipherStart, cipherEnd-cipherStart)
+	if err != nil {
+		writeError(w, http.StatusNotFound, "File data not found")
+		return
+	}
+	defer rc.Close()
+
+	w.Header().Set("Content-Range", fmt.Sprintf("bytes %d-%d/%d", start, start+length-1, file.Size))
+	w.Header().Set("Content-Length", strconv.FormatInt(length, 10))
+	w.WriteHeader(http.StatusPartialContent)
+	if err := crypto.DecryptStreamRange(rc, w, dek, file.EncryptionIV, start, length); err != nil {
+		slog.Error("range decrypt failed", "file_id", file.ID, "start", start, "length", length, "err", err)
+	}
+}
+
+// serveLegacyDecryptedFile handles AES-256-GCM (single-chunk buffer) files
+// uploaded before streaming encryption. The whole file has to be decrypted to
+// authenticate it, so ranges are cut from the plaintext afterwards.
+func serveLegacyDecryptedFile(w http.ResponseWriter, r *http.Request, backend storage.Backend, file *models.File, dek []byte, etag string) {
+	rc, _, err := backend.Read(*file.StoragePath)
+	if err != nil {
+		writeError(w, http.StatusNotFound, "File data not found")
+		return
+	}
+	defer rc.Close()
+
+	ciphertext, err := io.ReadAll(rc)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "Failed to read file data")
+		return
+	}
+
+	plaintext, err := crypto.DecryptBuffer(ciphertext, dek, file.EncryptionIV)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "Failed to decrypt file")
+		return
+	}
+
+	size := int64(len(plaintext))
+	start, length, partial, err := requestedRange(r, size, etag, file.UpdatedAt)
+	if err != nil {
+		w.Header().Set("Content-Range", fmt.Sprintf("bytes */%d", size))
+		writeError(w, http.StatusRequestedRangeNotSatisfiable, "Requested range not satisfiable")
+		return
+	}
+	if !partial {
+		w.Header().Set("Content-Length", strconv.FormatInt(size, 10))
+		w.WriteHeader(http.StatusOK)
+		w.Write(plaintext)
+		return
+	}
+
+	w.Header().Set("Content-Range", fmt.Sprintf("bytes %d-%d/%d", start, start+length-1, size))
+	w.Header().Set("Content-Length", strconv.FormatInt(length, 10))
+	w.WriteHeader(http.StatusPartialContent)
+	w.Write(plaintext[start : start+length])
+}
+
+// fileETag is a strong validator for a file's content. updated_at changes on
+// every re-upload, so a resumed download never stitches two versions together.
+func fileETag(file *models.File) string {
+	return fmt.Sprintf(`"%s-%x"`, file.ID, file.UpdatedAt.UnixNano())
+}
+
+// requestedRange decides whether r should get a partial response. partial is
+// false when the whole file should be sent: no Range header, a non-GET
+// method, a stale If-Range validator, or a header we choose to ignore
+// (malformed or multiple ranges).
+func requestedRange(r *http.Request, size int64, etag string, modified time.Time) (start, length int64, partial bool, err error) {
+	if r.Method != http.MethodGet {
+		return 0, size, false, nil
+	}
+	header := r.Header.Get("Range")
+	if header == "" {
+		return 0, size, false, nil
+	}
+	if !ifRangeMatches(r.Header.Get("If-Range"), etag, modified) {
+		return 0, size, false, nil
+	}
+	start, length, ok, err := parseRange(header, size)
+	if err != nil {
+		return 0, 0, false, err
+	}
+	if !ok {
+		return 0, size, false, nil
+	}
+	return start, length, true, nil
+}
+
+// ifRangeMatches reports whether the If-Range precondition holds. An entity
+// tag must match strongly; a date must equal Last-Modified exactly.
+func ifRangeMatches(ifRange, etag string, modified time.Time) bool {
+	if ifRange == "" {
+		return true
+	}
+	if strings.HasPrefix(ifRange, `"`) || strings.HasPrefix(ifRange, "W/") {
+		return ifRange == etag
+	}
+	t, err := http.ParseTime(ifRange)
+	if err != nil {
+		return false
+	}
+	return modified.UTC().Truncate(time.Second).Equal(t)
+}
+
+// parseRange parses a single "bytes=" range against size. ok is false when
+// the header should be ignored; err is errRangeNotSatisfiable when the range
+// lies entirely outside the file.
+func parseRange(header string, size int64) (start, length int64, ok bool, err error) {
+	spec, found := strings.CutPrefix(header, "bytes=")
+	if !found || strings.Contains(spec, ",") {
+		return 0, 0, false, nil
+	}
+	first, last, found := strings.Cut(strings.TrimSpace(spec), "-")
+	if !found {
+		return 0, 0, false, nil
+	}
+
+	if first == "" {
+		// Suffix range: the final N bytes.
+		n, perr := strconv.ParseInt(last, 10, 64)
+		if perr != nil || n < 0 {
+			return 0, 0, false, nil
+		}
+		if n == 0 || size == 0 {
+			return 0, 0, false, errRangeNotSatisfiable
+		}
+		if n > size {
+			n = size
+		}
+		return size - n, n, true, nil
+	}
+
+	start, perr := strconv.ParseInt(first, 10, 64)
+	if perr != nil || start < 0 {
+		return 0, 0, false, nil
+	}
+	end := size - 1
+	if last != "" {
+		end, perr = strconv.ParseInt(last, 10, 64)
+		if perr != nil || end < start {
+			return 0, 0, false, nil
+		}
+	}
+	if start >= size {
+		return 0, 0, false, errRangeNotSatisfiable
+	}
+	if end >= size {
+		end = size - 1
+	}
+	return start, end - start + 1, true, nil
+}
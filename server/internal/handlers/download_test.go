@@ -0,0 +1,151 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/base64"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/zynqcloud/api/internal/crypto"
+	"github.com/zynqcloud/api/internal/models"
+	"github.com/zynqcloud/api/internal/storage"
+)
+
+func TestParseRange(t *testing.T) {
+	cases := []struct {
+		header        string
+		start, length int64
+		ok            bool
+		unsatisfiable bool
+	}{
+		{"bytes=0-99", 0, 100, true, false},
+		{"bytes=100-", 100, 900, true, false},
+		{"bytes=-100", 900, 100, true, false},
+		{"bytes=-5000", 0, 1000, true, false},
+		{"bytes=900-5000", 900, 100, true, false},
+		{"bytes=1000-", 0, 0, false, true},
+		{"bytes=-0", 0, 0, false, true},
+		{"bytes=5-1", 0, 0, false, false},
+		{"bytes=0-1,5-6", 0, 0, false, false},
+		{"items=0-1", 0, 0, false, false},
+		{"bytes=abc", 0, 0, false, false},
+	}
+	for _, tc := range cases {
+		start, length, ok, err := parseRange(tc.header, 1000)
+		if tc.unsatisfiable {
+			if err != errRangeNotSatisfiable {
+				t.Errorf("%q: expected unsatisfiable, got err=%v", tc.header, err)
+			}
+			continue
+		}
+		if err != nil || ok != tc.ok || start != tc.start || length != tc.length {
+			t.Errorf("%q = (%d, %d, %v, %v), want (%d, %d, %v)", tc.header, start, length, ok, err, tc.start, tc.length, tc.ok)
+		}
+	}
+}
+
+func TestIfRangeMatches(t *testing.T) {
+	mod := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+	etag := `"abc-1"`
+	if !ifRangeMatches("", etag, mod) {
+		t.Error("empty If-Range should match")
+	}
+	if !ifRangeMatches(etag, etag, mod) {
+		t.Error("matching ETag should match")
+	}
+	if ifRangeMatches(`"other"`, etag, mod) || ifRangeMatches("W/"+etag, etag, mod) {
+		t.Error("different or weak ETag must not match")
+	}
+	if !ifRangeMatches(mod.Format(http.TimeFormat), etag, mod.Add(300*time.Millisecond)) {
+		t.Error("Last-Modified date should match at second precision")
+	}
+	if ifRangeMatches(mod.Add(-time.Hour).Format(http.TimeFormat), etag, mod) {
+		t.Error("older date must not match")
+	}
+}
+
+func TestServeDecryptedFile_Range(t *testing.T) {
+	c, err := crypto.New(base64.StdEncoding.EncodeToString(bytes.Repeat([]byte{7}, 32)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	backend, err := storage.NewLocal(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	plaintext := []byte("The quick brown fox jumps over the lazy dog")
+	dek, iv, storedDEK, algo, _ := c.CreateEncryptionKeys()
+	var ct bytes.Buffer
+	crypto.EncryptStream(bytes.NewReader(plaintext), &ct, dek, iv) //nolint:errcheck
+	backend.Write("u/f.enc", &ct)                                  //nolint:errcheck
+
+	path := "u/f.enc"
+	file := &models.File{
+		ID: uuid.New(), Name: "fox.txt", Size: int64(len(plaintext)),
+		StoragePath: &path, EncryptedDEK: storedDEK, EncryptionIV: iv, EncryptionAlgo: algo,
+		UpdatedAt: time.Now(),
+	}
+
+	get := func(hdr map[string]string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, "/download", nil)
+		for k, v := range hdr {
+			req.Header.Set(k, v)
+		}
+		rec := httptest.NewRecorder()
+		serveDecryptedFile(rec, req, c, backend, file)
+		return rec
+	}
+
+	rec := get(nil)
+	if rec.Code != http.StatusOK || !bytes.Equal(rec.Body.Bytes(), plaintext) {
+		t.Fatalf("full download: %d %q", rec.Code, rec.Body.Bytes())
+	}
+	if rec.Header().Get("Accept-Ranges") != "bytes" {
+		t.Error("missing Accept-Ranges")
+	}
+	etag := rec.Header().Get("ETag")
+
+	rec = get(map[string]string{"Range": "bytes=4-8"})
+	if rec.Code != http.StatusPartialContent {
+		t.Fatalf("range: status %d", rec.Code)
+	}
+	if got := rec.Body.String(); got != "quick" {
+		t.Errorf("range body = %q", got)
+	}
+	if cr := rec.Header().Get("Content-Range"); cr != "bytes 4-8/43" {
+		t.Errorf("Content-Range = %q", cr)
+	}
+
+	rec = get(map[string]string{"Range": "bytes=-3", "If-Range": etag})
+	if rec.Code != http.StatusPartialContent || rec.Body.String() != "dog" {
+		t.Errorf("If-Range match: %d %q", rec.Code, rec.Body.String())
+	}
+
+	rec = get(map[string]string{"Range": "bytes=0-2", "If-Range": `"stale"`})
+	if rec.Code != http.StatusOK || !bytes.Equal(rec.Body.Bytes(), plaintext) {
+		t.Errorf("stale If-Range should return full file, got %d", rec.Code)
+	}
+
+	rec = get(map[string]string{"Range": "bytes=500-"})
+	if rec.Code != http.StatusRequestedRangeNotSatisfiable {
+		t.Errorf("out-of-range: status %d", rec.Code)
+	}
+	if cr := rec.Header().Get("Content-Range"); cr != "bytes */43" {
+		t.Errorf("416 Content-Range = %q", cr)
+	}
+
+	// Range is only meaningful for GET; the POST share download sends it all.
+	req := httptest.NewRequest(http.MethodPost, "/download", nil)
+	req.Header.Set("Range", "bytes=0-2")
+	rr := httptest.NewRecorder()
+	serveDecryptedFile(rr, req, c, backend, file)
+	body, _ := io.ReadAll(rr.Body)
+	if rr.Code != http.StatusOK || !bytes.Equal(body, plaintext) {
+		t.Errorf("POST with Range: %d", rr.Code)
+	}
+}
@@ -0,0 +1,181 @@
+package handlers
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/google/uuid"
+	mw "github.com/zynqcloud/api/internal/middleware"
+	"github.com/zynqcloud/api/internal/models"
+	"gorm.io/gorm"
+)
+
+// maxCommentLength caps a file comment, in bytes.
+const maxCommentLength = 4000
+
+// commentBody trims a submitted comment and returns a message for an empty
+// or oversized one.
+func commentBody(body string) (string, string) {
+	body = strings.TrimSpace(body)
+	if body == "" {
+		return "", "body cannot be empty"
+	}
+	if len(body) > maxCommentLength {
+		return "", "body is too long"
+	}
+	return body, ""
+}
+
+// loadCommentedFile resolves the {id} URL parameter to a personal file the
+// caller owns or has been granted, along with their permission on it. It
+// writes the error response itself when it returns false.
+func (h *FilesHandler) loadCommentedFile(w http.ResponseWriter, r *http.Request) (*models.File, string, uuid.UUID, bool) {
+	claims := mw.GetClaims(r)
+	userID, _ := uuid.Parse(claims.Sub)
+
+	fileID, err := uuid.Parse(chi.URLParam(r, "id"))
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "Invalid file ID")
+		return nil, "", userID, false
+	}
+	file, permission, err := loadPersonalFile(h.db, fileID, userID)
+	if err != nil {
+		writeError(w, http.StatusNotFound, "File not found")
+		return nil, "", userID, false
+	}
+	return file, permission, userID, true
+}
+
+// GET /api/v1/files/{id}/comments
+func (h *FilesHandler) ListComments(w http.ResponseWriter, r *http.Request) {
+	file, _, _, ok := h.loadCommentedFile(w, r)
+	if !ok {
+		return
+	}
+
+	q := r.URL.Query()
+	page, _ := strconv.Atoi(q.Get("page"))
+	if page < 1 {
+		page = 1
+	}
+	limit, _ := strconv.Atoi(q.Get("limit"))
+	if limit < 1 || limit > 200 {
+		limit = 50
+	}
+	offset := (page - 1) * limit
+
+	baseQ := h.db.Model(&models.FileComment{}).Where("file_id = ?", file.ID)
+	var total int64
+	baseQ.Count(&total)
+
+	comments := []models.FileComment{}
+	h.db.Preload("User", func(db *gorm.DB) *gorm.DB {
+		return db.Select("id, name, email")
+	}).Where("file_id = ?", file.ID).Order("created_at ASC").
+		Offset(offset).Limit(limit).Find(&comments)
+
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"items": comments,
+		"meta": map[string]interface{}{
+			"total": total,
+			"page":  page,
+			"limit": limit,
+		},
+	})
+}
+
+// POST /api/v1/files/{id}/comments
+func (h *FilesHandler) CreateComment(w http.ResponseWriter, r *http.Request) {
+	file, permission, userID, ok := h.loadCommentedFile(w, r)
+	if !ok {
+		return
+	}
+	if !sharePermits(permission, models.SharePermissionComment) {
+		writeError(w, http.StatusForbidden, "No comment access to this file")
+		return
+	}
+
+	var req struct {
+		Body string `json:"body"`
+	}
+	if err := readJSON(r, &req); err != nil {
+		writeError(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+	body, msg := commentBody(req.Body)
+	if msg != "" {
+		writeError(w, http.StatusBadRequest, msg)
+		return
+	}
+
+	comment := models.FileComment{FileID: file.ID, UserID: &userID, Body: body}
+	if err := h.db.Create(&comment).Error; err != nil {
+		writeError(w, http.StatusInternalServerError, "Failed to add comment")
+		return
+	}
+
+	var author models.User
+	h.db.Select("id, name, email").First(&author, "id = ?", userID)
+	comment.User = &author
+	LogAudit(h.db, AuditEntry{
+		UserID:       &userID,
+		UserName:     author.Name,
+		UserEmail:    author.Email,
+		Action:       "file.comment",
+		ResourceType: "file",
+		ResourceName: file.Name,
+		ResourceID:   file.ID.String(),
+		IPAddress:    auditIP(r),
+		Metadata:     models.JSONB{"comment_id": comment.ID.String()},
+	})
+
+	writeJSON(w, http.StatusCreated, comment)
+}
+
+// DELETE /api/v1/files/{id}/comments/{commentId}
+//
+// Authors remove their own comments; the file owner can remove any.
+func (h *FilesHandler) DeleteComment(w http.ResponseWriter, r *http.Request) {
+	file, _, userID, ok := h.loadCommentedFile(w, r)
+	if !ok {
+		return
+	}
+	commentID, err := uuid.Parse(chi.URLParam(r, "commentId"))
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "Invalid comment ID")
+		return
+	}
+
+	var comment models.FileComment
+	if err := h.db.Where("id = ? AND file_id = ?", commentID, file.ID).First(&comment).Error; err != nil {
+		writeError(w, http.StatusNotFound, "Comment not found")
+		return
+	}
+	isAuthor := comment.UserID != nil && *comment.UserID == userID
+	if !isAuthor && file.OwnerID != userID {
+		writeError(w, http.StatusForbidden, "Only the author or the owner can delete this comment")
+		return
+	}
+	if err := h.db.Delete(&comment).Error; err != nil {
+		writeError(w, http.StatusInternalServerError, "Failed to delete comment")
+		return
+	}
+
+	var auditUser models.User
+	h.db.Select("name, email").First(&auditUser, "id = ?", userID)
+	LogAudit(h.db, AuditEntry{
+		UserID:       &userID,
+		UserName:     auditUser.Name,
+		UserEmail:    auditUser.Email,
+		Action:       "file.comment_delete",
+		ResourceType: "file",
+		ResourceName: file.Name,
+		ResourceID:   file.ID.String(),
+		IPAddress:    auditIP(r),
+		Metadata:     models.JSONB{"comment_id": comment.ID.String()},
+	})
+
+	writeJSON(w, http.StatusOK, map[string]string{"message": "Comment deleted"})
+}
@@ -0,0 +1,20 @@
+package handlers
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestCommentBody(t *testing.T) {
+	if body, msg := commentBody("  looks good \n"); msg != "" || body != "looks good" {
+		t.Errorf("commentBody trimmed to %q, %q", body, msg)
+	}
+	for _, bad := range []string{"", "   \n\t", strings.Repeat("x", maxCommentLength+1)} {
+		if _, msg := commentBody(bad); msg == "" {
+			t.Errorf("commentBody accepted %d bytes", len(bad))
+		}
+	}
+	if _, msg := commentBody(strings.Repeat("x", maxCommentLength)); msg != "" {
+		t.Errorf("commentBody rejected a comment at the limit: %s", msg)
+	}
+}
@@ -0,0 +1,661 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"mime/multipart"
+	"net/http"
+	"net/mail"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/google/uuid"
+	mw "github.com/zynqcloud/api/internal/middleware"
+	"github.com/zynqcloud/api/internal/models"
+	"gorm.io/gorm"
+)
+
+// File requests
+//
+// A file request is an upload-only public link into a folder, personal or
+// in a space. Visitors holding the link can add files to the folder (after
+// its password, if it has one) but cannot list or download anything; they
+// only learn the title and message the owner wrote. Uploads are stored like
+// any other: encrypted, deduplicated, checked against blockedExtensionsRe
+// and, in a personal folder, charged to the folder owner's quota. Space
+// folders stay open only while the request's creator can still write to
+// the space.
+
+const (
+	// fileRequestMaxUpload caps a single upload, as for FilesHandler.Upload.
+	fileRequestMaxUpload = 15 * 1024 * 1024 * 1024
+	// fileRequestMaxExtensions caps the allowed-extensions list.
+	fileRequestMaxExtensions = 50
+	// fileRequestFieldLimit caps the uploader name and email form fields.
+	fileRequestFieldLimit = 255
+)
+
+var extensionRe = regexp.MustCompile(`^[a-z0-9]{1,16}$`)
+
+// normalizeExtensions lowercases exts and strips leading dots, dropping
+// blanks and duplicates.
+func normalizeExtensions(exts []string) ([]string, error) {
+	out := []string{}
+	seen := make(map[string]bool)
+	for _, e := range exts {
+		e = strings.ToLower(strings.TrimLeft(strings.TrimSpace(e), "."))
+		if e == "" || seen[e] {
+			continue
+		}
+		if !extensionRe.MatchString(e) {
+			return nil, fmt.Errorf("invalid extension %q", e)
+		}
+		seen[e] = true
+		out = append(out, e)
+	}
+	if len(out) > fileRequestMaxExtensions {
+		return nil, fmt.Errorf("at most %d extensions are allowed", fileRequestMaxExtensions)
+	}
+	return out, nil
+}
+
+// extensionAllowed reports whether name has one of the allowed extensions;
+// any extension is allowed when the list is empty.
+func extensionAllowed(name string, allowed []string) bool {
+	if len(allowed) == 0 {
+		return true
+	}
+	ext := strings.ToLower(strings.TrimPrefix(filepath.Ext(name), "."))
+	for _, a := range allowed {
+		if ext == a {
+			return true
+		}
+	}
+	return false
+}
+
+// requestUploadName cleans the file name a visitor's browser sent. Some
+// browsers send a full client path; only its last element is kept.
+func requestUploadName(raw string) (string, bool) {
+	name := strings.TrimSpace(filepath.Base(strings.ReplaceAll(raw, `\`, "/")))
+	if name == "" || name == "." || name == ".." || name == "/" || len(name) > 255 {
+		return "", false
+	}
+	if strings.IndexFunc(name, unicode.IsControl) >= 0 {
+		return "", false
+	}
+	return name, true
+}
+
+// freeUploadName returns name, or "name (2)", "name (3)", ... when a live
+// sibling in folder already uses it.
+func freeUploadName(db *gorm.DB, ownerID uuid.UUID, folder *models.File, name string) string {
+	if !nameTaken(db, ownerID, folder.SpaceID, &folder.ID, name) {
+		return name
+	}
+	ext := filepath.Ext(name)
+	base := strings.TrimSuffix(name, ext)
+	if base == "" {
+		base, ext = name, ""
+	}
+	for i := 2; ; i++ {
+		if candidate := fmt.Sprintf("%s (%d)%s", base, i, ext); !nameTaken(db, ownerID, folder.SpaceID, &folder.ID, candidate) {
+			return candidate
+		}
+	}
+}
+
+func fileRequestGate(req *models.FileRequest) *passwordGate {
+	return &passwordGate{id: req.ID, token: req.Token, password: req.Password, table: "file_requests", resource: "file_request"}
+}
+
+type fileRequestResponse struct {
+	*models.FileRequest
+	PublicLink string `json:"publicLink"`
+}
+
+func (h *FilesHandler) fileRequestResponse(req *models.FileRequest) fileRequestResponse {
+	req.HasPassword = req.Password != nil
+	return fileRequestResponse{FileRequest: req, PublicLink: h.cfg.FrontendURL + "/upload/" + req.Token}
+}
+
+// fileRequestInput is the body of creating or updating a file request.
+// Fields left out are not changed on update.
+type fileRequestInput struct {
+	FolderID          *uuid.UUID `json:"folderId"`
+	Title             *string    `json:"title"`
+	Message           *string    `json:"message"`
+	Password          *string    `json:"password"`
+	ExpiresAt         *time.Time `json:"expiresAt"`
+	NoExpiry          bool       `json:"noExpiry"`
+	MaxFiles          *int       `json:"maxFiles"`
+	MaxFileSize       *int64     `json:"maxFileSize"`
+	AllowedExtensions *[]string  `json:"allowedExtensions"`
+	RequireUploader   *bool      `json:"requireUploader"`
+}
+
+// apply copies the fields set in in onto req, returning a message for the
+// first invalid one.
+func (in *fileRequestInput) apply(req *models.FileRequest) (string, error) {
+	if in.Title != nil {
+		title := strings.TrimSpace(*in.Title)
+		if len(title) > 255 {
+			return "title is too long", nil
+		}
+		req.Title = title
+	}
+	if in.Message != nil {
+		if len(*in.Message) > 2000 {
+			return "message is too long", nil
+		}
+		req.Message = strings.TrimSpace(*in.Message)
+	}
+	if in.NoExpiry {
+		req.ExpiresAt = nil
+	} else if in.ExpiresAt != nil {
+		if !in.ExpiresAt.After(time.Now()) {
+			return "expiresAt must be in the future", nil
+		}
+		req.ExpiresAt = in.ExpiresAt
+	}
+	if in.MaxFiles != nil {
+		if *in.MaxFiles < 0 {
+			return "maxFiles must not be negative", nil
+		}
+		req.MaxFiles = *in.MaxFiles
+	}
+	if in.MaxFileSize != nil {
+		if *in.MaxFileSize < 0 || *in.MaxFileSize > fileRequestMaxUpload {
+			return "maxFileSize is out of range", nil
+		}
+		req.MaxFileSize = *in.MaxFileSize
+	}
+	if in.AllowedExtensions != nil {
+		exts, err := normalizeExtensions(*in.AllowedExtensions)
+		if err != nil {
+			return err.Error(), nil
+		}
+		req.AllowedExtensions = exts
+	}
+	if in.RequireUploader != nil {
+		req.RequireUploader = *in.RequireUploader
+	}
+	if in.Password != nil {
+		hash, err := sharePasswordValue(in.Password)
+		if err != nil {
+			return "", err
+		}
+		req.Password = hash
+	}
+	return "", nil
+}
+
+// requestFolder loads a live folder the caller may collect uploads into:
+// one of their personal folders, or a folder in a space they can write to.
+// On failure it returns the status and message to answer with.
+func (h *FilesHandler) requestFolder(r *http.Request, userID, folderID uuid.UUID) (*models.File, int, string) {
+	var folder models.File
+	if err := h.db.Where("id = ? AND is_folder = true AND deleted_at IS NULL", folderID).First(&folder).Error; err != nil {
+		return nil, http.StatusNotFound, "Folder not found"
+	}
+	if folder.SpaceID == nil {
+		if folder.OwnerID != userID {
+			return nil, http.StatusNotFound, "Folder not found"
+		}
+		return &folder, 0, ""
+	}
+	if !mw.GetClaims(r).HasScope(mw.ScopeSpacesWrite) {
+		return nil, http.StatusForbidden, "Token lacks the " + mw.ScopeSpacesWrite + " scope"
+	}
+	if !canWrite(spaceRole(h.db, *folder.SpaceID, userID)) {
+		return nil, http.StatusNotFound, "Folder not found"
+	}
+	return &folder, 0, ""
+}
+
+// POST /api/v1/files/file-requests
+func (h *FilesHandler) CreateFileRequest(w http.ResponseWriter, r *http.Request) {
+	claims := mw.GetClaims(r)
+	userID, _ := uuid.Parse(claims.Sub)
+
+	var in fileRequestInput
+	if err := readJSON(r, &in); err != nil {
+		writeError(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+	if in.FolderID == nil {
+		writeError(w, http.StatusBadRequest, "folderId is required")
+		return
+	}
+	folder, status, msg := h.requestFolder(r, userID, *in.FolderID)
+	if folder == nil {
+		writeError(w, status, msg)
+		return
+	}
+
+	req := &models.FileRequest{
+		ID:                uuid.New(),
+		CreatedBy:         userID,
+		FolderID:          folder.ID,
+		Token:             uuid.New().String(),
+		Title:             folder.Name,
+		AllowedExtensions: []string{},
+	}
+	if msg, err := in.apply(req); err != nil {
+		writeError(w, http.StatusInternalServerError, "Failed to create file request")
+		return
+	} else if msg != "" {
+		writeError(w, http.StatusBadRequest, msg)
+		return
+	}
+	if err := h.db.Create(req).Error; err != nil {
+		writeError(w, http.StatusInternalServerError, "Failed to create file request")
+		return
+	}
+
+	var auditUser models.User
+	h.db.Select("name, email").First(&auditUser, "id = ?", userID)
+	LogAudit(h.db, AuditEntry{
+		UserID:       &userID,
+		UserName:     auditUser.Name,
+		UserEmail:    auditUser.Email,
+		Action:       "file_request.create",
+		ResourceType: "folder",
+		ResourceName: folder.Name,
+		ResourceID:   folder.ID.String(),
+		IPAddress:    auditIP(r),
+		Metadata:     models.JSONB{"file_request_id": req.ID.String()},
+	})
+
+	req.Folder = folder
+	writeJSON(w, http.StatusCreated, h.fileRequestResponse(req))
+}
+
+// GET /api/v1/files/file-requests
+func (h *FilesHandler) MyFileRequests(w http.ResponseWriter, r *http.Request) {
+	claims := mw.GetClaims(r)
+	userID, _ := uuid.Parse(claims.Sub)
+
+	var reqs []models.FileRequest
+	h.db.Preload("Folder").Where("created_by = ?", userID).Order("created_at DESC").Find(&reqs)
+
+	resp := make([]fileRequestResponse, len(reqs))
+	for i := range reqs {
+		resp[i] = h.fileRequestResponse(&reqs[i])
+	}
+	writeJSON(w, http.StatusOK, resp)
+}
+
+// ownFileRequest loads the caller's file request named by {requestId}.
+func (h *FilesHandler) ownFileRequest(w http.ResponseWriter, r *http.Request) (*models.FileRequest, uuid.UUID, bool) {
+	claims := mw.GetClaims(r)
+	userID, _ := uuid.Parse(claims.Sub)
+
+	id, err := uuid.Parse(chi.URLParam(r, "requestId"))
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "Invalid file request ID")
+		return nil, userID, false
+	}
+	var req models.FileRequest
+	if err := h.db.Preload("Folder").Where("id = ? AND created_by = ?", id, userID).First(&req).Error; err != nil {
+		writeError(w, http.StatusNotFound, "File request not found")
+		return nil, userID, false
+	}
+	return &req, userID, true
+}
+
+// PATCH /api/v1/files/file-requests/{requestId}
+func (h *FilesHandler) UpdateFileRequest(w http.ResponseWriter, r *http.Request) {
+	req, _, ok := h.ownFileRequest(w, r)
+	if !ok {
+		return
+	}
+	var in fileRequestInput
+	if err := readJSON(r, &in); err != nil {
+		writeError(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+	if in.FolderID != nil && *in.FolderID != req.FolderID {
+		writeError(w, http.StatusBadRequest, "The folder of a file request cannot be changed")
+		return
+	}
+	if msg, err := in.apply(req); err != nil {
+		writeError(w, http.StatusInternalServerError, "Failed to update file request")
+		return
+	} else if msg != "" {
+		writeError(w, http.StatusBadRequest, msg)
+		return
+	}
+
+	if err := h.db.Model(req).Select("title", "message", "password", "expires_at", "max_files",
+		"max_file_size", "allowed_extensions", "require_uploader").Updates(req).Error; err != nil {
+		writeError(w, http.StatusInternalServerError, "Failed to update file request")
+		return
+	}
+	writeJSON(w, http.StatusOK, h.fileRequestResponse(req))
+}
+
+// DELETE /api/v1/files/file-requests/{requestId}
+func (h *FilesHandler) DeleteFileRequest(w http.ResponseWriter, r *http.Request) {
+	req, userID, ok := h.ownFileRequest(w, r)
+	if !ok {
+		return
+	}
+	h.db.Delete(req)
+
+	var auditUser models.User
+	h.db.Select("name, email").First(&auditUser, "id = ?", userID)
+	folderName := ""
+	if req.Folder != nil {
+		folderName = req.Folder.Name
+	}
+	LogAudit(h.db, AuditEntry{
+		UserID:       &userID,
+		UserName:     auditUser.Name,
+		UserEmail:    auditUser.Email,
+		Action:       "file_request.delete",
+		ResourceType: "folder",
+		ResourceName: folderName,
+		ResourceID:   req.FolderID.String(),
+		IPAddress:    auditIP(r),
+		Metadata:     models.JSONB{"file_request_id": req.ID.String()},
+	})
+
+	writeJSON(w, http.StatusOK, map[string]string{"message": "File request deleted"})
+}
+
+// GET /api/v1/files/file-requests/{requestId}/uploads
+func (h *FilesHandler) ListFileRequestUploads(w http.ResponseWriter, r *http.Request) {
+	req, _, ok := h.ownFileRequest(w, r)
+	if !ok {
+		return
+	}
+
+	q := r.URL.Query()
+	page, _ := strconv.Atoi(q.Get("page"))
+	if page < 1 {
+		page = 1
+	}
+	limit, _ := strconv.Atoi(q.Get("limit"))
+	if limit < 1 || limit > 200 {
+		limit = 50
+	}
+	offset := (page - 1) * limit
+
+	baseQ := h.db.Model(&models.FileRequestUpload{}).Where("request_id = ?", req.ID)
+	var total int64
+	baseQ.Count(&total)
+
+	uploads := []models.FileRequestUpload{}
+	baseQ.Order("created_at DESC").Offset(offset).Limit(limit).Find(&uploads)
+
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"items": uploads,
+		"meta": map[string]interface{}{
+			"total": total,
+			"page":  page,
+			"limit": limit,
+		},
+	})
+}
+
+// openFileRequest loads the live file request behind the {token} URL
+// parameter and checks its password. It writes the error response itself
+// when it returns false.
+func (h *ShareHandler) openFileRequest(w http.ResponseWriter, r *http.Request) (*models.FileRequest, string, bool) {
+	token := chi.URLParam(r, "token")
+
+	var req models.FileRequest
+	if err := h.db.Preload("Folder").Where("token = ?", token).First(&req).Error; err != nil {
+		writeError(w, http.StatusNotFound, "File request not found")
+		return nil, "", false
+	}
+	if req.ExpiresAt != nil && req.ExpiresAt.Before(time.Now()) {
+		writeError(w, http.StatusGone, "File request has expired")
+		return nil, "", false
+	}
+	if req.Folder == nil || req.Folder.DeletedAt != nil ||
+		(req.Folder.SpaceID != nil && !canWrite(spaceRole(h.db, *req.Folder.SpaceID, req.CreatedBy))) {
+		writeError(w, http.StatusGone, "File request is no longer available")
+		return nil, "", false
+	}
+	g := fileRequestGate(&req)
+	session, ok := h.authorize(w, r, g, r.Header.Get("x-share-password"), "Password required")
+	if !ok {
+		return nil, "", false
+	}
+	req.Password = g.password
+	return &req, session, true
+}
+
+// GET /api/v1/public/upload/{token}
+func (h *ShareHandler) GetFileRequest(w http.ResponseWriter, r *http.Request) {
+	req, session, ok := h.openFileRequest(w, r)
+	if !ok {
+		return
+	}
+
+	var owner models.User
+	h.db.Select("name").First(&owner, "id = ?", req.CreatedBy)
+	resp := map[string]interface{}{
+		"id":                req.ID,
+		"title":             req.Title,
+		"message":           req.Message,
+		"owner":             owner.Name,
+		"hasPassword":       req.Password != nil,
+		"expiresAt":         req.ExpiresAt,
+		"maxFiles":          req.MaxFiles,
+		"uploadCount":       req.UploadCount,
+		"maxFileSize":       req.MaxFileSize,
+		"allowedExtensions": req.AllowedExtensions,
+		"requireUploader":   req.RequireUploader,
+	}
+	if session != "" {
+		resp["shareSession"] = session
+	}
+	writeJSON(w, http.StatusOK, resp)
+}
+
+// POST /api/v1/public/upload/{token}
+//
+// Takes one file as multipart/form-data. The optional uploaderName and
+// uploaderEmail fields must come before the file part, which is streamed
+// straight into the staging area.
+func (h *ShareHandler) UploadToFileRequest(w http.ResponseWriter, r *http.Request) {
+	req, _, ok := h.openFileRequest(w, r)
+	if !ok {
+		return
+	}
+	if req.MaxFiles > 0 && req.UploadCount >= req.MaxFiles {
+		writeError(w, http.StatusForbidden, "This file request is not accepting more files")
+		return
+	}
+	if h.crypto == nil {
+		writeError(w, http.StatusInternalServerError, "Encryption not configured")
+		return
+	}
+
+	maxSize := int64(fileRequestMaxUpload)
+	if req.MaxFileSize > 0 {
+		maxSize = req.MaxFileSize
+	}
+	// Leave room for the multipart framing and form fields.
+	r.Body = http.MaxBytesReader(w, r.Body, maxSize+1<<20)
+	mr, err := r.MultipartReader()
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "Expected a multipart/form-data body")
+		return
+	}
+
+	var uploaderName, uploaderEmail string
+	for {
+		part, err := mr.NextPart()
+		if err == io.EOF {
+			writeError(w, http.StatusBadRequest, "file is required")
+			return
+		}
+		if err != nil {
+			writeError(w, http.StatusBadRequest, "Malformed multipart body")
+			return
+		}
+		switch part.FormName() {
+		case "uploaderName", "uploaderEmail":
+			value, err := io.ReadAll(io.LimitReader(part, fileRequestFieldLimit+1))
+			if err != nil || len(value) > fileRequestFieldLimit {
+				writeError(w, http.StatusBadRequest, part.FormName()+" is too long")
+				return
+			}
+			if part.FormName() == "uploaderName" {
+				uploaderName = strings.TrimSpace(string(value))
+			} else {
+				uploaderEmail = strings.ToLower(strings.TrimSpace(string(value)))
+			}
+		case "file":
+			h.receiveRequestUpload(w, r, req, part, maxSize, uploaderName, uploaderEmail)
+			return
+		}
+		part.Close()
+	}
+}
+
+// receiveRequestUpload stores the file part of an upload to req in its
+// folder and tells the owner about it.
+func (h *ShareHandler) receiveRequestUpload(w http.ResponseWriter, r *http.Request, req *models.FileRequest, part *multipart.Part, maxSize int64, uploaderName, uploaderEmail string) {
+	name, ok := requestUploadName(part.FileName())
+	if !ok {
+		writeError(w, http.StatusBadRequest, "Invalid file name")
+		return
+	}
+	if blockedExtensionsRe.MatchString(name) || !extensionAllowed(name, req.AllowedExtensions) {
+		writeError(w, http.StatusBadRequest, "File type not allowed")
+		return
+	}
+	if req.RequireUploader && (uploaderName == "" || uploaderEmail == "") {
+		writeError(w, http.StatusBadRequest, "uploaderName and uploaderEmail are required")
+		return
+	}
+	if uploaderEmail != "" {
+		if _, err := mail.ParseAddress(uploaderEmail); err != nil {
+			writeError(w, http.StatusBadRequest, "Invalid uploaderEmail")
+			return
+		}
+	}
+
+	staged, err := stageUpload(h.cfg.UploadTempDir, h.crypto, io.LimitReader(part, maxSize+1))
+	if err != nil {
+		var mbe *http.MaxBytesError
+		if errors.As(err, &mbe) {
+			writeError(w, http.StatusRequestEntityTooLarge, "File is too large")
+			return
+		}
+		slog.Warn("file request upload interrupted", "file_request", req.ID, "error", err)
+		writeError(w, http.StatusInternalServerError, "Upload interrupted — please try again")
+		return
+	}
+	defer staged.remove()
+	if staged.size > maxSize {
+		writeError(w, http.StatusRequestEntityTooLarge, "File is too large")
+		return
+	}
+	if staged.size == 0 {
+		writeError(w, http.StatusBadRequest, "Empty file body")
+		return
+	}
+
+	// Take a slot first so concurrent uploads cannot overshoot max_files.
+	res := h.db.Model(&models.FileRequest{}).
+		Where("id = ? AND (max_files = 0 OR upload_count < max_files)", req.ID).
+		UpdateColumn("upload_count", gorm.Expr("upload_count + 1"))
+	if res.Error != nil || res.RowsAffected == 0 {
+		writeError(w, http.StatusForbidden, "This file request is not accepting more files")
+		return
+	}
+	releaseSlot := func() {
+		h.db.Model(&models.FileRequest{}).Where("id = ?", req.ID).
+			UpdateColumn("upload_count", gorm.Expr("GREATEST(upload_count - 1, 0)"))
+	}
+
+	folder := req.Folder
+	// Personal uploads belong to, and are charged to, the folder owner;
+	// space uploads are attributed to whoever made the request.
+	ownerID := folder.OwnerID
+	if folder.SpaceID != nil {
+		ownerID = req.CreatedBy
+	}
+	file := &models.File{
+		ID:       uuid.New(),
+		OwnerID:  ownerID,
+		SpaceID:  folder.SpaceID,
+		Name:     freeUploadName(h.db, ownerID, folder, name),
+		ParentID: &folder.ID,
+	}
+	if err := h.db.Create(file).Error; err != nil {
+		releaseSlot()
+		writeError(w, http.StatusInternalServerError, "Failed to create file")
+		return
+	}
+
+	var owner models.User
+	h.db.First(&owner, "id = ?", ownerID)
+	var uerr *uploadError
+	if folder.SpaceID == nil {
+		uerr = h.filesHandler().storeUploadedContent(r, file, &owner, staged)
+	} else {
+		uerr = NewSpacesHandler(h.db, h.cfg, h.crypto, h.backend).storeUploadedContent(file, *folder.SpaceID, ownerID, staged)
+	}
+	if uerr != nil {
+		h.db.Delete(file)
+		releaseSlot()
+		writeError(w, uerr.status, uerr.message)
+		return
+	}
+
+	h.db.Create(&models.FileRequestUpload{
+		RequestID:     req.ID,
+		FileID:        &file.ID,
+		FileName:      file.Name,
+		Size:          file.Size,
+		UploaderName:  uploaderName,
+		UploaderEmail: uploaderEmail,
+		IPAddress:     auditIP(r),
+	})
+	LogAudit(h.db, AuditEntry{
+		UserName:     uploaderName,
+		UserEmail:    uploaderEmail,
+		Action:       "file_request.upload",
+		ResourceType: "file",
+		ResourceName: file.Name,
+		ResourceID:   file.ID.String(),
+		IPAddress:    auditIP(r),
+		Metadata:     models.JSONB{"file_request_id": req.ID.String(), "folder_id": folder.ID.String(), "size": file.Size},
+	})
+
+	from := "Someone"
+	switch {
+	case uploaderName != "" && uploaderEmail != "":
+		from = fmt.Sprintf("%s <%s>", uploaderName, uploaderEmail)
+	case uploaderName != "":
+		from = uploaderName
+	case uploaderEmail != "":
+		from = uploaderEmail
+	}
+	var requester models.User
+	h.db.Select("name, email").First(&requester, "id = ?", req.CreatedBy)
+	go SendNotification(h.db, h.cfg, "file_request_upload",
+		fmt.Sprintf("New upload to \"%s\"", req.Title),
+		fmt.Sprintf("%s uploaded %s (%s) to the folder %s through the file request \"%s\" of %s.",
+			from, file.Name, formatStorageBytes(file.Size), folder.Name, req.Title, requester.Email),
+	)
+
+	writeJSON(w, http.StatusCreated, map[string]interface{}{
+		"name": file.Name,
+		"size": file.Size,
+	})
+}
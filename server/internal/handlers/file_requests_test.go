@@ -0,0 +1,48 @@
+package handlers
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestNormalizeExtensions(t *testing.T) {
+	got, err := normalizeExtensions([]string{" .PDF", "docx", "pdf", "", "..jpg"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"pdf", "docx", "jpg"}; !slices.Equal(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+	for _, bad := range []string{"tar.gz", "p d f", "*"} {
+		if _, err := normalizeExtensions([]string{bad}); err == nil {
+			t.Errorf("%q accepted", bad)
+		}
+	}
+
+	if !extensionAllowed("scan.PDF", got) || extensionAllowed("notes.txt", got) || extensionAllowed("pdf", got) {
+		t.Error("allowed extensions not applied")
+	}
+	if !extensionAllowed("anything.bin", nil) {
+		t.Error("empty list should allow any extension")
+	}
+}
+
+func TestRequestUploadName(t *testing.T) {
+	cases := map[string]string{
+		"report.pdf":                    "report.pdf",
+		`C:\Users\ana\Desktop\scan.jpg`: "scan.jpg",
+		"../../etc/passwd":              "passwd",
+		"  contract final.docx ":        "contract final.docx",
+		"dir/sub/":                      "sub",
+	}
+	for raw, want := range cases {
+		if got, ok := requestUploadName(raw); !ok || got != want {
+			t.Errorf("requestUploadName(%q) = %q, %v; want %q", raw, got, ok, want)
+		}
+	}
+	for _, bad := range []string{"", "..", "/", "bad\x00name.txt", "line\nbreak.txt"} {
+		if _, ok := requestUploadName(bad); ok {
+			t.Errorf("%q accepted", bad)
+		}
+	}
+}
@@ -2,12 +2,10 @@ package handlers
 
 import (
 	"archive/zip"
-	"crypto/sha256"
 	"fmt"
 	"io"
 	"log/slog"
 	"net/http"
-	"os"
 	"regexp"
 	"strconv"
 	"strings"
@@ -31,10 +29,11 @@ type FilesHandler struct {
 	cfg     *config.Config
 	crypto  *crypto.Crypto
 	backend storage.Backend
+	cas     *storage.CAS
 }
 
 func NewFilesHandler(db *gorm.DB, cfg *config.Config, c *crypto.Crypto, backend storage.Backend) *FilesHandler {
-	return &FilesHandler{db: db, cfg: cfg, crypto: c, backend: backend}
+	return &FilesHandler{db: db, cfg: cfg, crypto: c, backend: backend, cas: storage.NewCAS(backend)}
 }
 
 // GET /api/v1/files
@@ -67,6 +66,11 @@ func (h *FilesHandler) List(w http.ResponseWriter, r *http.Request) {
 			writeError(w, http.StatusBadRequest, "Invalid parentId")
 			return
 		}
+		// Grantees browse a shared folder's contents, which stay the owner's.
+		if parent, _, err := loadPersonalFile(h.db, parentID, userID); err == nil && parent.OwnerID != userID {
+			query = h.db.Model(&models.File{}).
+				Where("owner_id = ? AND deleted_at IS NULL AND space_id IS NULL", parent.OwnerID)
+		}
 		query = query.Where("parent_id = ?", parentID)
 	}
 
@@ -179,18 +183,25 @@ func (h *FilesHandler) Create(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// Verify parent exists and is owned by user
+	// Verify parent exists and the user owns it or holds write on it. Items
+	// added to a shared folder belong to the folder's owner.
+	ownerID := userID
 	if req.ParentID != nil {
-		var parent models.File
-		if err := h.db.Where("id = ? AND owner_id = ? AND is_folder = true AND deleted_at IS NULL AND space_id IS NULL", req.ParentID, userID).First(&parent).Error; err != nil {
+		parent, permission, err := loadPersonalFile(h.db, *req.ParentID, userID)
+		if err != nil || !parent.IsFolder {
 			writeError(w, http.StatusNotFound, "Parent folder not found")
 			return
 		}
+		if !sharePermits(permission, models.SharePermissionWrite) {
+			writeError(w, http.StatusForbidden, "No write access to this folder")
+			return
+		}
+		ownerID = parent.OwnerID
 	}
 
 	file := &models.File{
 		ID:       uuid.New(),
-		OwnerID:  userID,
+		OwnerID:  ownerID,
 		Name:     req.Name,
 		IsFolder: req.IsFolder,
 		ParentID: req.ParentID,
@@ -287,7 +298,8 @@ func (h *FilesHandler) EmptyTrash(w http.ResponseWriter, r *http.Request) {
 	uniquePaths := make(map[string]struct{})
 	for _, f := range files {
 		deleteIDs = append(deleteIDs, f.ID)
-		if !f.IsFolder && f.StoragePath != nil {
+		// CAS-backed files are reclaimed by the blob GC once unreferenced.
+		if !f.IsFolder && f.StoragePath != nil && f.BlobID == nil {
 			uniquePaths[*f.StoragePath] = struct{}{}
 		}
 	}
@@ -326,6 +338,11 @@ func (h *FilesHandler) EmptyTrash(w http.ResponseWriter, r *http.Request) {
 		}
 	}
 
+	removeLegacyVersionObjects(h.db, h.backend, deleteIDs)
+	if err := releaseFileBlobs(h.db, deleteIDs); err != nil {
+		slog.Error("empty trash: release blob refs failed", "error", err)
+	}
+
 	// Delete shares and file records.
 	for _, f := range files {
 		h.db.Where("file_id = ?", f.ID).Delete(&models.Share{})
@@ -337,6 +354,7 @@ func (h *FilesHandler) EmptyTrash(w http.ResponseWriter, r *http.Request) {
 	h.db.Model(&models.File{}).
 		Where("owner_id = ? AND deleted_at IS NULL AND is_folder = false AND space_id IS NULL", userID).
 		Select("COALESCE(SUM(size), 0)").Scan(&totalSize)
+	totalSize += versionBytesUsed(h.db, userID)
 	h.db.Model(&models.User{}).Where("id = ?", userID).Update("storage_used", totalSize)
 
 	writeJSON(w, http.StatusOK, map[string]string{"message": "Trash emptied"})
@@ -362,14 +380,14 @@ func (h *FilesHandler) SharedWithMe(w http.ResponseWriter, r *http.Request) {
 	h.db.First(&user, "id = ?", userID)
 
 	baseQ := h.db.Model(&models.Share{}).
-		Where("(grantee_user_id = ? OR grantee_email = ?) AND is_public = false", userID, user.Email).
+		Where("(grantee_user_id = ? OR grantee_email = ? OR grantee_group_id IN (SELECT group_id FROM user_group_members WHERE user_id = ?)) AND is_public = false", userID, user.Email, userID).
 		Where("(expires_at IS NULL OR expires_at > ?)", time.Now())
 
 	var total int64
 	baseQ.Count(&total)
 
 	var shares []models.Share
-	baseQ.Preload("File").Preload("Creator").
+	baseQ.Preload("File").Preload("Creator").Preload("GranteeGroup").
 		Offset(offset).Limit(limit).
 		Find(&shares)
 
@@ -416,14 +434,16 @@ func (h *FilesHandler) MyPrivateShares(w http.ResponseWriter, r *http.Request) {
 	}
 	offset := (page - 1) * limit
 
+	// Includes shares grantees passed on of the caller's own files.
 	baseQ := h.db.Model(&models.Share{}).
-		Where("created_by = ? AND is_public = false", userID)
+		Where("is_public = false").
+		Where("(created_by = ? OR file_id IN (SELECT id FROM files WHERE owner_id = ?))", userID, userID)
 
 	var total int64
 	baseQ.Count(&total)
 
 	var shares []models.Share
-	baseQ.Preload("File").Preload("GranteeUser").
+	baseQ.Preload("File").Preload("GranteeUser").Preload("GranteeGroup").Preload("Creator").
 		Offset(offset).Limit(limit).
 		Find(&shares)
 
@@ -449,8 +469,11 @@ func (h *FilesHandler) RevokeShare(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	// The file's owner may also revoke shares grantees passed on.
 	var share models.Share
-	if err := h.db.Where("id = ? AND created_by = ?", shareID, userID).First(&share).Error; err != nil {
+	if err := h.db.Where("id = ?", shareID).
+		Where("(created_by = ? OR file_id IN (SELECT id FROM files WHERE owner_id = ?))", userID, userID).
+		First(&share).Error; err != nil {
 		writeError(w, http.StatusNotFound, "Share not found")
 		return
 	}
@@ -492,6 +515,8 @@ func (h *FilesHandler) UpdatePublicShare(w http.ResponseWriter, r *http.Request)
 	var req struct {
 		ExpiresAt *time.Time `json:"expiresAt"`
 		Password  *string    `json:"password"`
+		// MaxDownloads of 0 removes the download limit.
+		MaxDownloads *int `json:"maxDownloads"`
 	}
 	if err := readJSON(r, &req); err != nil {
 		writeError(w, http.StatusBadRequest, "Invalid request body")
@@ -509,11 +534,24 @@ func (h *FilesHandler) UpdatePublicShare(w http.ResponseWriter, r *http.Request)
 		updates["expires_at"] = req.ExpiresAt
 	}
 	if req.Password != nil {
-		if *req.Password == "" {
-			updates["password"] = nil
-		} else {
-			updates["password"] = req.Password
+		hash, err := sharePasswordValue(req.Password)
+		if err != nil {
+			writeError(w, http.StatusInternalServerError, "Failed to update share")
+			return
+		}
+		updates["password"] = hash
+		share.Password = hash
+	}
+	if req.MaxDownloads != nil {
+		if *req.MaxDownloads < 0 {
+			writeError(w, http.StatusBadRequest, "maxDownloads must not be negative")
+			return
 		}
+		share.MaxDownloads = nil
+		if *req.MaxDownloads > 0 {
+			share.MaxDownloads = req.MaxDownloads
+		}
+		updates["max_downloads"] = share.MaxDownloads
 	}
 
 	h.db.Model(&share).Updates(updates)
@@ -658,11 +696,22 @@ func (h *FilesHandler) Rename(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	var file models.File
-	if err := h.db.Where("id = ? AND owner_id = ? AND deleted_at IS NULL AND space_id IS NULL", fileID, userID).First(&file).Error; err != nil {
+	file, permission, err := loadPersonalFile(h.db, fileID, userID)
+	if err != nil {
 		writeError(w, http.StatusNotFound, "File not found")
 		return
 	}
+	// Grantees with write access may rename; moving stays with the owner.
+	if file.OwnerID != userID {
+		if !sharePermits(permission, models.SharePermissionWrite) {
+			writeError(w, http.StatusForbidden, "No write access to this file")
+			return
+		}
+		if req.MoveToRoot || req.ParentID != nil {
+			writeError(w, http.StatusForbidden, "Only the owner can move this file")
+			return
+		}
+	}
 
 	updates := map[string]interface{}{}
 
@@ -704,12 +753,12 @@ func (h *FilesHandler) Rename(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	if err := h.db.Model(&file).Updates(updates).Error; err != nil {
+	if err := h.db.Model(file).Updates(updates).Error; err != nil {
 		writeError(w, http.StatusInternalServerError, "Failed to update file")
 		return
 	}
 
-	h.db.Where("id = ?", fileID).First(&file)
+	h.db.Where("id = ?", fileID).First(file)
 
 	var auditUser models.User
 	h.db.Select("name, email").First(&auditUser, "id = ?", userID)
@@ -748,11 +797,15 @@ func (h *FilesHandler) Upload(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	var file models.File
-	if err := h.db.Where("id = ? AND owner_id = ? AND deleted_at IS NULL AND space_id IS NULL", fileID, userID).First(&file).Error; err != nil {
+	file, permission, err := loadPersonalFile(h.db, fileID, userID)
+	if err != nil {
 		writeError(w, http.StatusNotFound, "File not found")
 		return
 	}
+	if !sharePermits(permission, models.SharePermissionWrite) {
+		writeError(w, http.StatusForbidden, "No write access to this file")
+		return
+	}
 
 	if file.IsFolder {
 		writeError(w, http.StatusBadRequest, "Cannot upload to a folder")
@@ -777,33 +830,18 @@ func (h *FilesHandler) Upload(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// ── Stream body to temp file while hashing ────────────────────────────────
-	// Avoids loading the entire file into memory for large uploads.
-	tmpDir := h.backend.(*storage.Local).Root() + "/.uploads"
-	if err := os.MkdirAll(tmpDir, 0o750); err != nil {
-		writeError(w, http.StatusInternalServerError, "Failed to create temp directory")
-		return
-	}
-	tmpFile, err := os.CreateTemp(tmpDir, ".upload-*")
+	// ── Stream body to the staging area, encrypting and hashing as it goes ────
+	// Avoids loading the entire file into memory for large uploads, and never
+	// writes plaintext to disk.
+	staged, err := stageUpload(h.cfg.UploadTempDir, h.crypto, r.Body)
 	if err != nil {
-		writeError(w, http.StatusInternalServerError, "Failed to create temp file")
-		return
-	}
-	tmpPath := tmpFile.Name()
-	defer os.Remove(tmpPath)
-
-	// Tee through hash writer while streaming to temp
-	hasher := sha256.New()
-	plainSize, copyErr := io.Copy(tmpFile, io.TeeReader(r.Body, hasher))
-	tmpFile.Close()
-	if copyErr != nil {
-		slog.Warn("upload body read failed (client disconnected?)", "file_id", fileID, "error", copyErr)
+		slog.Warn("upload body read failed (client disconnected?)", "file_id", fileID, "error", err)
 		writeError(w, http.StatusInternalServerError, "Upload interrupted — please try again")
 		return
 	}
-	if !h.commitUploadedTempFile(w, r, &file, &user, tmpPath, plainSize, hasher) {
-		return
-	}
+	defer staged.remove()
+
+	h.commitStagedUpload(w, r, file, &user, staged)
 }
 
 // GET /api/v1/files/{id}/download
@@ -818,26 +856,16 @@ func (h *FilesHandler) Download(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	var file models.File
-	if err := h.db.Where("id = ? AND owner_id = ? AND deleted_at IS NULL AND space_id IS NULL", fileID, userID).First(&file).Error; err != nil {
-		// Also check if user has a share for this file
-		var share models.Share
-		var shareUser models.User
-		h.db.First(&shareUser, "id = ?", userID)
-		if err2 := h.db.Where("file_id = ? AND (grantee_user_id = ? OR grantee_email = ?) AND is_public = false", fileID, userID, shareUser.Email).
-			Where("(expires_at IS NULL OR expires_at > ?)", time.Now()).
-			First(&share).Error; err2 != nil {
-			writeError(w, http.StatusNotFound, "File not found")
-			return
-		}
-		if err3 := h.db.First(&file, "id = ? AND deleted_at IS NULL", fileID).Error; err3 != nil {
-			writeError(w, http.StatusNotFound, "File not found")
-			return
-		}
+	// Every share permission includes read, so owners and all grantees of
+	// the file or a folder above it may download.
+	file, _, err := loadPersonalFile(h.db, fileID, userID)
+	if err != nil {
+		writeError(w, http.StatusNotFound, "File not found")
+		return
 	}
 
 	if file.IsFolder {
-		h.streamFolderAsZip(w, r, &file)
+		h.streamFolderAsZip(w, r, file)
 		return
 	}
 
@@ -846,92 +874,49 @@ func (h *FilesHandler) Download(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	h.streamDecryptedFile(w, r, &file)
+	h.streamDecryptedFile(w, r, file)
 }
 
 func (h *FilesHandler) streamDecryptedFile(w http.ResponseWriter, r *http.Request, file *models.File) {
-	rc, _, err := h.backend.Read(*file.StoragePath)
-	if err != nil {
-		writeError(w, http.StatusNotFound, "File data not found")
-		return
-	}
-	defer rc.Close()
-
-	dek, err := h.crypto.DecryptFileKey(file.EncryptedDEK)
-	if err != nil {
-		writeError(w, http.StatusInternalServerError, "Failed to decrypt file key")
-		return
-	}
-
-	mimeType := "application/octet-stream"
-	if file.MimeType != nil {
-		mimeType = *file.MimeType
-	}
+	serveDecryptedFile(w, r, h.crypto, h.backend, file)
+}
 
-	w.Header().Set("Content-Type", mimeType)
-	w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="%s"`, file.Name))
-	w.Header().Set("Cache-Control", "private, no-cache")
+// zipEntry is a file to put in a ZIP archive at path.
+type zipEntry struct {
+	file models.File
+	path string
+}
 
-	if file.EncryptionAlgo == "AES-256-GCM-STREAM" {
-		// Streaming chunked decryption — no full-file buffering.
-		w.Header().Set("Content-Length", strconv.FormatInt(file.Size, 10))
-		w.WriteHeader(http.StatusOK)
-		if err := crypto.DecryptStream(rc, w, dek, file.EncryptionIV); err != nil {
-			slog.Error("stream decrypt failed", "file_id", file.ID, "err", err)
+// collectZipEntries appends every file under the folder parentID to entries,
+// at its path below the folder prefixed with prefix.
+func (h *FilesHandler) collectZipEntries(entries []zipEntry, parentID uuid.UUID, prefix string) []zipEntry {
+	var children []models.File
+	h.db.Where("parent_id = ? AND deleted_at IS NULL", parentID).
+		Order("is_folder DESC, name ASC").Find(&children)
+	for _, child := range children {
+		childPath := prefix + child.Name
+		if child.IsFolder {
+			entries = h.collectZipEntries(entries, child.ID, childPath+"/")
+		} else if child.StoragePath != nil {
+			entries = append(entries, zipEntry{file: child, path: childPath})
 		}
-		return
-	}
-
-	// Legacy AES-256-GCM (single-chunk buffer) — kept for files uploaded before streaming.
-	ciphertext, err := io.ReadAll(rc)
-	if err != nil {
-		writeError(w, http.StatusInternalServerError, "Failed to read file data")
-		return
-	}
-
-	plaintext, err := crypto.DecryptBuffer(ciphertext, dek, file.EncryptionIV)
-	if err != nil {
-		writeError(w, http.StatusInternalServerError, "Failed to decrypt file")
-		return
 	}
-
-	w.Header().Set("Content-Length", strconv.FormatInt(int64(len(plaintext)), 10))
-	w.WriteHeader(http.StatusOK)
-	w.Write(plaintext)
+	return entries
 }
 
 // streamFolderAsZip recursively collects all files in a folder, decrypts them,
 // and streams the result as a ZIP archive.
 func (h *FilesHandler) streamFolderAsZip(w http.ResponseWriter, r *http.Request, folder *models.File) {
-	// Recursively collect all non-folder files under this folder.
-	type entry struct {
-		file models.File
-		path string // relative path inside the ZIP
-	}
-	var entries []entry
-
-	var collect func(parentID uuid.UUID, prefix string)
-	collect = func(parentID uuid.UUID, prefix string) {
-		var children []models.File
-		h.db.Where("parent_id = ? AND deleted_at IS NULL", parentID).
-			Order("is_folder DESC, name ASC").Find(&children)
-		for _, child := range children {
-			childPath := prefix + child.Name
-			if child.IsFolder {
-				collect(child.ID, childPath+"/")
-			} else if child.StoragePath != nil {
-				entries = append(entries, entry{file: child, path: childPath})
-			}
-		}
-	}
-	collect(folder.ID, "")
-
+	entries := h.collectZipEntries(nil, folder.ID, "")
 	if len(entries) == 0 {
 		writeError(w, http.StatusNotFound, "Folder is empty")
 		return
 	}
+	h.streamZip(w, r, folder.Name+".zip", entries)
+}
 
-	zipName := folder.Name + ".zip"
+// streamZip decrypts entries into a ZIP archive streamed as zipName.
+func (h *FilesHandler) streamZip(w http.ResponseWriter, r *http.Request, zipName string, entries []zipEntry) {
 	w.Header().Set("Content-Type", "application/zip")
 	w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="%s"`, zipName))
 	w.Header().Set("Cache-Control", "private, no-cache")
@@ -1080,9 +1065,16 @@ func (h *FilesHandler) PermanentDelete(w http.ResponseWriter, r *http.Request) {
 	}
 
 	fileSize := file.Size
+	var versionBytes int64
+	h.db.Model(&models.FileVersion{}).Where("file_id = ?", file.ID).
+		Select("COALESCE(SUM(size), 0)").Scan(&versionBytes)
+	// Versions of a trashed file are already excluded from storage_used.
+	if file.DeletedAt == nil {
+		fileSize += versionBytes
+	}
 
-	if !file.IsFolder && file.StoragePath != nil {
-		// Atomically lock, check references, and delete blob.
+	if !file.IsFolder && file.StoragePath != nil && file.BlobID == nil {
+		// Legacy per-file object: atomically lock, check references, and delete.
 		_ = h.db.Transaction(func(tx *gorm.DB) error {
 			var refCount int64
 			tx.Model(&models.File{}).
@@ -1096,8 +1088,14 @@ func (h *FilesHandler) PermanentDelete(w http.ResponseWriter, r *http.Request) {
 		})
 	}
 
+	removeLegacyVersionObjects(h.db, h.backend, []uuid.UUID{file.ID})
 	h.db.Where("file_id = ?", file.ID).Delete(&models.Share{})
-	h.db.Delete(&file)
+	_ = h.db.Transaction(func(tx *gorm.DB) error {
+		if err := releaseFileBlobs(tx, []uuid.UUID{file.ID}); err != nil {
+			return err
+		}
+		return tx.Delete(&file).Error
+	})
 
 	// Update storage used
 	if fileSize > 0 {
@@ -1120,27 +1118,54 @@ func (h *FilesHandler) ShareFile(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	var file models.File
-	if err := h.db.Where("id = ? AND owner_id = ? AND deleted_at IS NULL AND space_id IS NULL", fileID, userID).First(&file).Error; err != nil {
+	file, held, err := loadPersonalFile(h.db, fileID, userID)
+	if err != nil {
 		writeError(w, http.StatusNotFound, "File not found")
 		return
 	}
+	isOwner := file.OwnerID == userID
+	if !sharePermits(held, models.SharePermissionReshare) {
+		writeError(w, http.StatusForbidden, "You cannot share this file")
+		return
+	}
 
 	var req struct {
-		IsPublic      bool       `json:"isPublic"`
-		GranteeEmail  *string    `json:"granteeEmail"`
-		GranteeUserID *uuid.UUID `json:"granteeUserId"`
-		Permission    string     `json:"permission"`
-		ExpiresAt     *time.Time `json:"expiresAt"`
-		Password      *string    `json:"password"`
+		IsPublic       bool       `json:"isPublic"`
+		GranteeEmail   *string    `json:"granteeEmail"`
+		GranteeUserID  *uuid.UUID `json:"granteeUserId"`
+		GranteeGroupID *uuid.UUID `json:"granteeGroupId"`
+		Permission     string     `json:"permission"`
+		ExpiresAt      *time.Time `json:"expiresAt"`
+		Password       *string    `json:"password"`
+		MaxDownloads   *int       `json:"maxDownloads"`
 	}
 	if err := readJSON(r, &req); err != nil {
 		writeError(w, http.StatusBadRequest, "Invalid request body")
 		return
 	}
+	if req.MaxDownloads != nil && *req.MaxDownloads < 0 {
+		writeError(w, http.StatusBadRequest, "maxDownloads must not be negative")
+		return
+	}
 
 	if req.Permission == "" {
-		req.Permission = "read"
+		req.Permission = models.SharePermissionRead
+	}
+	if sharePermissionLevel(req.Permission) == 0 {
+		writeError(w, http.StatusBadRequest, "permission must be read, comment, write or reshare")
+		return
+	}
+	// Grantees with reshare pass the file on privately, never with more than
+	// they hold themselves.
+	if !isOwner {
+		if req.IsPublic {
+			writeError(w, http.StatusForbidden, "Only the owner can create public links")
+			return
+		}
+		if !sharePermits(held, req.Permission) {
+			writeError(w, http.StatusForbidden, "Cannot grant more than your own permission")
+			return
+		}
 	}
 
 	// For public shares, return the existing active share rather than creating a duplicate.
@@ -1150,7 +1175,7 @@ func (h *FilesHandler) ShareFile(w http.ResponseWriter, r *http.Request) {
 		if err := q.First(&existing).Error; err == nil {
 			// Found an existing public share. If it has expired, delete it and fall through
 			// to create a fresh one; otherwise return it as-is.
-			if existing.ExpiresAt == nil || existing.ExpiresAt.After(time.Now()) {
+			if !shareExpired(&existing) {
 				existing.HasPassword = existing.Password != nil
 				type shareResponse struct {
 					*models.Share
@@ -1180,10 +1205,26 @@ func (h *FilesHandler) ShareFile(w http.ResponseWriter, r *http.Request) {
 	if req.IsPublic {
 		token := uuid.New().String()
 		share.ShareToken = &token
-		share.Password = req.Password
+		hash, err := sharePasswordValue(req.Password)
+		if err != nil {
+			writeError(w, http.StatusInternalServerError, "Failed to create share")
+			return
+		}
+		share.Password = hash
+		if req.MaxDownloads != nil && *req.MaxDownloads > 0 {
+			share.MaxDownloads = req.MaxDownloads
+		}
 	} else {
 		if req.GranteeUserID != nil {
 			share.GranteeUserID = req.GranteeUserID
+		} else if req.GranteeGroupID != nil {
+			var n int64
+			h.db.Model(&models.Group{}).Where("id = ?", *req.GranteeGroupID).Count(&n)
+			if n == 0 {
+				writeError(w, http.StatusNotFound, "Group not found")
+				return
+			}
+			share.GranteeGroupID = req.GranteeGroupID
 		} else if req.GranteeEmail != nil {
 			email := strings.ToLower(strings.TrimSpace(*req.GranteeEmail))
 			share.GranteeEmail = &email
@@ -1194,7 +1235,7 @@ func (h *FilesHandler) ShareFile(w http.ResponseWriter, r *http.Request) {
 				share.GranteeUserID = &granteeUser.ID
 			}
 		} else {
-			writeError(w, http.StatusBadRequest, "granteeEmail or granteeUserId is required for private shares")
+			writeError(w, http.StatusBadRequest, "granteeEmail, granteeUserId or granteeGroupId is required for private shares")
 			return
 		}
 	}
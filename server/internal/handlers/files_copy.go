@@ -0,0 +1,524 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/google/uuid"
+	"github.com/zynqcloud/api/internal/crypto"
+	mw "github.com/zynqcloud/api/internal/middleware"
+	"github.com/zynqcloud/api/internal/models"
+	"gorm.io/gorm"
+)
+
+// Copy and move
+//
+// A file lives either in its owner's personal tree (space_id NULL) or in a
+// space. Copies and moves work between any two trees the caller can write
+// to. Copies never duplicate content: each copied file takes another
+// reference on the source's blob. Personal files count toward the owner's
+// quota and space files do not, so anything entering a personal tree is
+// checked against the quota first.
+
+// copyFileTree copies src to a new row called name under parentID, either in
+// ownerID's personal tree (spaceID nil) or in a space. With recursive set a
+// folder is copied with everything below it. Content is never duplicated:
+// every copied file takes another reference on the source's blob. Run it
+// inside a transaction. It returns the new row and the plaintext bytes the
+// copy adds.
+//
+// When c is set, file keys still wrapped by a retired master key are
+// re-wrapped for the copy, so new rows never depend on an old key.
+func copyFileTree(tx *gorm.DB, c *crypto.Crypto, src *models.File, ownerID uuid.UUID, spaceID, parentID *uuid.UUID, name string, recursive bool) (*models.File, int64, error) {
+	dst := &models.File{
+		ID:             uuid.New(),
+		OwnerID:        ownerID,
+		SpaceID:        spaceID,
+		Name:           name,
+		IsFolder:       src.IsFolder,
+		ParentID:       parentID,
+		MimeType:       src.MimeType,
+		Size:           src.Size,
+		FileHash:       src.FileHash,
+		StoragePath:    src.StoragePath,
+		EncryptedDEK:   src.EncryptedDEK,
+		EncryptionIV:   src.EncryptionIV,
+		EncryptionAlgo: src.EncryptionAlgo,
+		KeyID:          src.KeyID,
+		BlobID:         src.BlobID,
+		UploadedBy:     &ownerID,
+	}
+	if c != nil && len(src.EncryptedDEK) > 0 && (src.KeyID == nil || *src.KeyID != c.KeyID()) {
+		rewrapped, err := c.RewrapFileKey(src.EncryptedDEK)
+		if err != nil {
+			return nil, 0, fmt.Errorf("rewrap key of %s: %w", src.ID, err)
+		}
+		keyID := c.KeyID()
+		dst.EncryptedDEK = rewrapped
+		dst.KeyID = &keyID
+	}
+	if err := tx.Create(dst).Error; err != nil {
+		return nil, 0, err
+	}
+
+	var copied int64
+	if !src.IsFolder {
+		// Pre-CAS objects are shared by storage_path instead; every delete
+		// path checks for other rows using the path before removing it.
+		if src.BlobID != nil {
+			if err := retainBlob(tx, *src.BlobID); err != nil {
+				return nil, 0, err
+			}
+		}
+		copied = src.Size
+	}
+
+	if src.IsFolder && recursive {
+		var children []models.File
+		if err := tx.Where("parent_id = ? AND deleted_at IS NULL", src.ID).Find(&children).Error; err != nil {
+			return nil, 0, err
+		}
+		for i := range children {
+			_, n, err := copyFileTree(tx, c, &children[i], ownerID, spaceID, &dst.ID, children[i].Name, true)
+			if err != nil {
+				return nil, 0, err
+			}
+			copied += n
+		}
+	}
+	return dst, copied, nil
+}
+
+// fileTreeSize returns the plaintext bytes held by file or, for a folder, by
+// every live file below it.
+func fileTreeSize(db *gorm.DB, file *models.File) int64 {
+	if !file.IsFolder {
+		return file.Size
+	}
+	var size int64
+	db.Raw(`
+		WITH RECURSIVE descendants AS (
+			SELECT id, is_folder, size FROM files
+			WHERE parent_id = ? AND deleted_at IS NULL
+			UNION ALL
+			SELECT f.id, f.is_folder, f.size FROM files f
+			INNER JOIN descendants d ON f.parent_id = d.id
+			WHERE f.deleted_at IS NULL
+		)
+		SELECT COALESCE(SUM(size), 0) FROM descendants WHERE is_folder = false
+	`, file.ID).Scan(&size)
+	return size
+}
+
+// fileTreeUsage is fileTreeSize plus the previous versions kept for those
+// files: what the tree would add to a personal quota if moved there.
+func fileTreeUsage(db *gorm.DB, file *models.File) int64 {
+	var versions int64
+	db.Raw(`
+		WITH RECURSIVE tree AS (
+			SELECT id FROM files WHERE id = ?
+			UNION ALL
+			SELECT f.id FROM files f
+			INNER JOIN tree t ON f.parent_id = t.id
+			WHERE f.deleted_at IS NULL
+		)
+		SELECT COALESCE(SUM(v.size), 0) FROM file_versions v
+		WHERE v.file_id IN (SELECT id FROM tree)
+	`, file.ID).Scan(&versions)
+	return fileTreeSize(db, file) + versions
+}
+
+// replacedUsage is what replacing file, an item about to be overwritten,
+// gives back to its owner's quota: nothing for space files or no file.
+func replacedUsage(db *gorm.DB, file *models.File) int64 {
+	if file == nil || file.SpaceID != nil {
+		return 0
+	}
+	return fileTreeUsage(db, file)
+}
+
+// trashReplacedFile moves file, an item overwritten by a copy or move, to
+// the trash the way deleting it would: a space file and everything below it
+// to the space trash, a personal file to its owner's trash. It runs in the
+// transaction that writes the replacement, after the replacement is in place,
+// so the overwrite happens entirely or not at all.
+func trashReplacedFile(tx *gorm.DB, file *models.File, userID uuid.UUID) error {
+	if file.SpaceID != nil {
+		return trashSpaceFile(tx, file, userID)
+	}
+	return tx.Model(file).Update("deleted_at", time.Now()).Error
+}
+
+// relocateFileTree moves file and every row below it, trashed ones included,
+// into another tree. Rows entering a personal tree become ownerID's. The
+// caller sets the new parent of file itself.
+func relocateFileTree(tx *gorm.DB, file *models.File, ownerID uuid.UUID, spaceID *uuid.UUID) error {
+	updates := map[string]interface{}{"space_id": spaceID, "updated_at": gorm.Expr("NOW()")}
+	if spaceID == nil {
+		updates["owner_id"] = ownerID
+	}
+	return tx.Model(&models.File{}).
+		Where(`id IN (
+			WITH RECURSIVE tree AS (
+				SELECT id FROM files WHERE id = ?
+				UNION ALL
+				SELECT f.id FROM files f
+				INNER JOIN tree t ON f.parent_id = t.id
+			)
+			SELECT id FROM tree)`, file.ID).
+		Updates(updates).Error
+}
+
+// recalcStorageUsed recomputes a user's storage_used from their live personal
+// files and the versions kept for them.
+func recalcStorageUsed(db *gorm.DB, userID uuid.UUID) {
+	var total int64
+	db.Model(&models.File{}).
+		Where("owner_id = ? AND deleted_at IS NULL AND is_folder = false AND space_id IS NULL", userID).
+		Select("COALESCE(SUM(size), 0)").Scan(&total)
+	total += versionBytesUsed(db, userID)
+	db.Model(&models.User{}).Where("id = ?", userID).Update("storage_used", total)
+}
+
+// nameTaken reports whether a live item in the folder parentID (of the
+// owner's personal files, or of the space) is called name.
+func nameTaken(db *gorm.DB, ownerID uuid.UUID, spaceID, parentID *uuid.UUID, name string) bool {
+	q := db.Model(&models.File{}).Where("name = ? AND deleted_at IS NULL", name)
+	if spaceID == nil {
+		q = q.Where("owner_id = ? AND space_id IS NULL", ownerID)
+	} else {
+		q = q.Where("space_id = ?", *spaceID)
+	}
+	if parentID == nil {
+		q = q.Where("parent_id IS NULL")
+	} else {
+		q = q.Where("parent_id = ?", *parentID)
+	}
+	var n int64
+	q.Count(&n)
+	return n > 0
+}
+
+// copyName returns name, or "name (copy)", "name (copy 2)", ... when a live
+// sibling in the destination folder already uses it.
+func copyName(db *gorm.DB, ownerID uuid.UUID, spaceID, parentID *uuid.UUID, name string) string {
+	taken := func(candidate string) bool {
+		return nameTaken(db, ownerID, spaceID, parentID, candidate)
+	}
+	if !taken(name) {
+		return name
+	}
+	ext := filepath.Ext(name)
+	base := strings.TrimSuffix(name, ext)
+	if base == "" {
+		base, ext = name, ""
+	}
+	for i := 1; ; i++ {
+		suffix := " (copy)"
+		if i > 1 {
+			suffix = fmt.Sprintf(" (copy %d)", i)
+		}
+		if candidate := base + suffix + ext; !taken(candidate) {
+			return candidate
+		}
+	}
+}
+
+var errFileNotFound = errors.New("file not found")
+
+// loadReadableFile returns a live file the caller may read: one of their
+// personal files, a file in a space they belong to, or a file shared with
+// them directly or through a folder above it. role is the caller's space
+// role for space files.
+func loadReadableFile(db *gorm.DB, fileID, userID uuid.UUID) (file *models.File, role string, err error) {
+	var f models.File
+	if err := db.Where("id = ? AND deleted_at IS NULL", fileID).First(&f).Error; err != nil {
+		return nil, "", errFileNotFound
+	}
+	if f.SpaceID != nil {
+		if role = spaceRole(db, *f.SpaceID, userID); role == "" {
+			return nil, "", errFileNotFound
+		}
+		return &f, role, nil
+	}
+	if f.OwnerID == userID || sharedPermission(db, f.ID, userID) != "" {
+		return &f, "", nil
+	}
+	return nil, "", errFileNotFound
+}
+
+// checkCopyDestination verifies the caller can add files to parentID in the
+// given tree (spaceID nil for their personal files).
+func checkCopyDestination(db *gorm.DB, userID uuid.UUID, spaceID, parentID *uuid.UUID) *uploadError {
+	if spaceID != nil && !canWrite(spaceRole(db, *spaceID, userID)) {
+		return &uploadError{http.StatusForbidden, "No write access to the target space"}
+	}
+	if parentID == nil {
+		return nil
+	}
+	q := db.Model(&models.File{}).Where("id = ? AND is_folder = true AND deleted_at IS NULL", *parentID)
+	if spaceID == nil {
+		q = q.Where("owner_id = ? AND space_id IS NULL", userID)
+	} else {
+		q = q.Where("space_id = ?", *spaceID)
+	}
+	var n int64
+	q.Count(&n)
+	if n == 0 {
+		return &uploadError{http.StatusNotFound, "Target folder not found"}
+	}
+	return nil
+}
+
+// POST /api/v1/files/{id}/copy
+func (h *FilesHandler) Copy(w http.ResponseWriter, r *http.Request) {
+	claims := mw.GetClaims(r)
+	userID, _ := uuid.Parse(claims.Sub)
+
+	fileID, err := uuid.Parse(chi.URLParam(r, "id"))
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "Invalid file ID")
+		return
+	}
+
+	var req struct {
+		Name     *string    `json:"name"`
+		ParentID *uuid.UUID `json:"parentId"`
+		SpaceID  *uuid.UUID `json:"spaceId"`
+	}
+	if err := readJSON(r, &req); err != nil {
+		writeError(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+
+	src, _, err := loadReadableFile(h.db, fileID, userID)
+	if err != nil {
+		writeError(w, http.StatusNotFound, "File not found")
+		return
+	}
+
+	name := src.Name
+	if req.Name != nil {
+		name = strings.TrimSpace(*req.Name)
+		if name == "" {
+			writeError(w, http.StatusBadRequest, "name cannot be empty")
+			return
+		}
+		if !src.IsFolder && blockedExtensionsRe.MatchString(name) {
+			writeError(w, http.StatusBadRequest, "File type not allowed")
+			return
+		}
+	}
+
+	if uerr := checkCopyDestination(h.db, userID, req.SpaceID, req.ParentID); uerr != nil {
+		writeError(w, uerr.status, uerr.message)
+		return
+	}
+	// A folder cannot contain a copy of itself.
+	if src.IsFolder && req.ParentID != nil && isDescendantOf(h.db, *req.ParentID, src.ID) {
+		writeError(w, http.StatusBadRequest, "Cannot copy a folder into itself")
+		return
+	}
+
+	var user models.User
+	h.db.First(&user, "id = ?", userID)
+	if req.SpaceID == nil && user.StorageLimit > 0 {
+		if user.StorageUsed+fileTreeSize(h.db, src) > user.StorageLimit {
+			writeError(w, http.StatusForbidden, "Storage limit exceeded")
+			return
+		}
+	}
+
+	name = copyName(h.db, userID, req.SpaceID, req.ParentID, name)
+	var copy *models.File
+	var copied int64
+	if err := h.db.Transaction(func(tx *gorm.DB) error {
+		var err error
+		copy, copied, err = copyFileTree(tx, h.crypto, src, userID, req.SpaceID, req.ParentID, name, true)
+		return err
+	}); err != nil {
+		slog.Error("copy failed", "file_id", src.ID, "error", err)
+		writeError(w, http.StatusInternalServerError, "Failed to copy")
+		return
+	}
+
+	if req.SpaceID != nil {
+		logSpaceActivity(h.db, *req.SpaceID, userID, models.SpaceActionCopy, &copy.ID, &copy.Name,
+			models.JSONB{"source_id": src.ID.String()})
+	} else {
+		// Copies share blobs with their source but are charged in full, as
+		// an upload of identical content would be.
+		if copied > 0 {
+			h.db.Model(&models.User{}).Where("id = ?", userID).
+				UpdateColumn("storage_used", gorm.Expr("storage_used + ?", copied))
+		}
+		resourceType := "file"
+		if copy.IsFolder {
+			resourceType = "folder"
+		}
+		LogAudit(h.db, AuditEntry{
+			UserID:       &userID,
+			UserName:     user.Name,
+			UserEmail:    user.Email,
+			Action:       "file.copy",
+			ResourceType: resourceType,
+			ResourceName: copy.Name,
+			ResourceID:   copy.ID.String(),
+			IPAddress:    auditIP(r),
+			Metadata:     models.JSONB{"source_id": src.ID.String(), "size": copied},
+		})
+	}
+
+	writeJSON(w, http.StatusCreated, copy)
+}
+
+// POST /api/v1/files/{id}/move
+//
+// Moves a file or folder tree to another folder, optionally in another tree:
+// from personal files into a space, out of a space, or between spaces.
+func (h *FilesHandler) Move(w http.ResponseWriter, r *http.Request) {
+	claims := mw.GetClaims(r)
+	userID, _ := uuid.Parse(claims.Sub)
+
+	fileID, err := uuid.Parse(chi.URLParam(r, "id"))
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "Invalid file ID")
+		return
+	}
+
+	var req struct {
+		ParentID *uuid.UUID `json:"parentId"`
+		SpaceID  *uuid.UUID `json:"spaceId"`
+	}
+	if err := readJSON(r, &req); err != nil {
+		writeError(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+
+	file, role, err := loadReadableFile(h.db, fileID, userID)
+	if err != nil {
+		writeError(w, http.StatusNotFound, "File not found")
+		return
+	}
+	// Moving needs the same rights as deleting from the source.
+	switch {
+	case file.SpaceID == nil && file.OwnerID != userID:
+		writeError(w, http.StatusForbidden, "Cannot move a file shared with you")
+		return
+	case file.SpaceID != nil && !canWrite(role):
+		writeError(w, http.StatusForbidden, "No write access to this space")
+		return
+	case file.SpaceID != nil && file.OwnerID != userID && !isSpaceAdminOrGlobal(role, claims.Role):
+		writeError(w, http.StatusForbidden, "Cannot modify another member's file")
+		return
+	}
+
+	if uerr := h.moveFile(r, file, userID, req.SpaceID, req.ParentID, file.Name, nil); uerr != nil {
+		writeError(w, uerr.status, uerr.message)
+		return
+	}
+	h.db.Where("id = ?", file.ID).First(file)
+	writeJSON(w, http.StatusOK, file)
+}
+
+// moveFile moves file (renamed to name) under parentID in the tree given by
+// spaceID, which may differ from the file's own. A non-nil replace is the
+// item already at the destination; it goes to the trash in the same
+// transaction. The caller has checked it may modify file and replace.
+func (h *FilesHandler) moveFile(r *http.Request, file *models.File, userID uuid.UUID, spaceID, parentID *uuid.UUID, name string, replace *models.File) *uploadError {
+	if uerr := checkCopyDestination(h.db, userID, spaceID, parentID); uerr != nil {
+		return uerr
+	}
+	if parentID != nil && isDescendantOf(h.db, *parentID, file.ID) {
+		return &uploadError{http.StatusBadRequest, "Cannot move a folder into its own subfolder"}
+	}
+
+	sameTree := (spaceID == nil) == (file.SpaceID == nil) &&
+		(spaceID == nil || *spaceID == *file.SpaceID)
+	sameParent := (parentID == nil) == (file.ParentID == nil) &&
+		(parentID == nil || *parentID == *file.ParentID)
+	if sameTree && sameParent && name == file.Name {
+		return nil
+	}
+
+	var user models.User
+	h.db.First(&user, "id = ?", userID)
+	if spaceID == nil && file.SpaceID != nil && user.StorageLimit > 0 {
+		if user.StorageUsed+fileTreeUsage(h.db, file)-replacedUsage(h.db, replace) > user.StorageLimit {
+			return &uploadError{http.StatusForbidden, "Storage limit exceeded"}
+		}
+	}
+
+	fromSpace := file.SpaceID
+	if err := h.db.Transaction(func(tx *gorm.DB) error {
+		updates := map[string]interface{}{"name": name, "parent_id": parentID}
+		if err := tx.Model(file).Updates(updates).Error; err != nil {
+			return err
+		}
+		if !sameTree {
+			if err := relocateFileTree(tx, file, userID, spaceID); err != nil {
+				return err
+			}
+		}
+		if replace != nil {
+			return trashReplacedFile(tx, replace, userID)
+		}
+		return nil
+	}); err != nil {
+		slog.Error("move failed", "file_id", file.ID, "error", err)
+		return &uploadError{http.StatusInternalServerError, "Failed to move file"}
+	}
+	if !sameTree && (fromSpace == nil || spaceID == nil) || replace != nil && replace.SpaceID == nil {
+		recalcStorageUsed(h.db, userID)
+	}
+
+	// Record the move where each side will look for it: the activity feed of
+	// every space involved, and the audit log when personal files change.
+	details := func(from, to *uuid.UUID) models.JSONB {
+		if sameTree {
+			return nil
+		}
+		d := models.JSONB{"from": "personal", "to": "personal"}
+		if from != nil {
+			d["from"] = from.String()
+		}
+		if to != nil {
+			d["to"] = to.String()
+		}
+		return d
+	}
+	if fromSpace != nil {
+		logSpaceActivity(h.db, *fromSpace, userID, models.SpaceActionMove, &file.ID, &name, details(fromSpace, spaceID))
+	}
+	if spaceID != nil && !sameTree {
+		logSpaceActivity(h.db, *spaceID, userID, models.SpaceActionMove, &file.ID, &name, details(fromSpace, spaceID))
+	}
+	if fromSpace == nil || spaceID == nil {
+		resourceType := "file"
+		if file.IsFolder {
+			resourceType = "folder"
+		}
+		action := "file.move"
+		if sameTree && sameParent {
+			action = "file.rename"
+		}
+		LogAudit(h.db, AuditEntry{
+			UserID:       &userID,
+			UserName:     user.Name,
+			UserEmail:    user.Email,
+			Action:       action,
+			ResourceType: resourceType,
+			ResourceName: name,
+			ResourceID:   file.ID.String(),
+			IPAddress:    auditIP(r),
+			Metadata:     details(fromSpace, spaceID),
+		})
+	}
+	return nil
+}
@@ -1,11 +1,9 @@
 package handlers
 
 import (
-	"crypto/sha256"
 	"encoding/json"
+	"errors"
 	"fmt"
-	"hash"
-	"io"
 	"log/slog"
 	"math"
 	"mime"
@@ -19,12 +17,10 @@ import (
 
 	"github.com/go-chi/chi/v5"
 	"github.com/google/uuid"
-	"github.com/zynqcloud/api/internal/crypto"
 	mw "github.com/zynqcloud/api/internal/middleware"
 	"github.com/zynqcloud/api/internal/models"
 	"github.com/zynqcloud/api/internal/storage"
 	"gorm.io/gorm"
-	"gorm.io/gorm/clause"
 )
 
 const (
@@ -45,6 +41,10 @@ type uploadSessionManifest struct {
 	CreatedAt      time.Time        `json:"createdAt"`
 	UpdatedAt      time.Time        `json:"updatedAt"`
 	ExpiresAt      time.Time        `json:"expiresAt"`
+	// EncryptedDEK is the session's staging key (see upload_staging.go),
+	// wrapped by the master key. Sessions started before chunks were
+	// encrypted on arrival have none and must be restarted.
+	EncryptedDEK []byte `json:"encryptedDek,omitempty"`
 }
 
 type uploadSessionInfo struct {
@@ -61,11 +61,7 @@ type uploadSessionInfo struct {
 }
 
 func (h *FilesHandler) uploadRootDir() (string, error) {
-	local, ok := h.backend.(*storage.Local)
-	if !ok {
-		return "", fmt.Errorf("chunked uploads require local storage backend")
-	}
-	root := filepath.Join(local.Root(), ".uploads")
+	root := h.cfg.UploadTempDir
 	if err := os.MkdirAll(root, 0o750); err != nil {
 		return "", err
 	}
@@ -137,7 +133,13 @@ func nextMissingChunk(manifest uploadSessionManifest) int {
 	return manifest.TotalChunks
 }
 
-func (h *FilesHandler) loadOwnedUploadFile(r *http.Request) (*models.File, *models.User, error) {
+// errNoWriteAccess is returned by loadUploadFile for a file shared with the
+// caller without write.
+var errNoWriteAccess = errors.New("no write access to this file")
+
+// loadUploadFile loads the file an upload session writes to: one the caller
+// owns or holds write on through a private share.
+func (h *FilesHandler) loadUploadFile(r *http.Request) (*models.File, *models.User, error) {
 	claims := mw.GetClaims(r)
 	userID, _ := uuid.Parse(claims.Sub)
 
@@ -147,10 +149,13 @@ func (h *FilesHandler) loadOwnedUploadFile(r *http.Request) (*models.File, *mode
 		return nil, nil, fmt.Errorf("invalid file ID")
 	}
 
-	var file models.File
-	if err := h.db.Where("id = ? AND owner_id = ? AND deleted_at IS NULL AND space_id IS NULL", fileID, userID).First(&file).Error; err != nil {
+	file, permission, err := loadPersonalFile(h.db, fileID, userID)
+	if err != nil {
 		return nil, nil, gorm.ErrRecordNotFound
 	}
+	if !sharePermits(permission, models.SharePermissionWrite) {
+		return nil, nil, errNoWriteAccess
+	}
 	if file.IsFolder {
 		return nil, nil, fmt.Errorf("cannot upload to a folder")
 	}
@@ -160,191 +165,142 @@ func (h *FilesHandler) loadOwnedUploadFile(r *http.Request) (*models.File, *mode
 
 	var user models.User
 	h.db.First(&user, "id = ?", userID)
-	return &file, &user, nil
+	return file, &user, nil
+}
+
+// writeUploadFileError answers a loadUploadFile error.
+func writeUploadFileError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, gorm.ErrRecordNotFound):
+		writeError(w, http.StatusNotFound, "File not found")
+	case errors.Is(err, errNoWriteAccess):
+		writeError(w, http.StatusForbidden, "No write access to this file")
+	default:
+		writeError(w, http.StatusBadRequest, err.Error())
+	}
 }
 
-func (h *FilesHandler) commitUploadedTempFile(
+// uploadError is a failed content commit, copy or move together with the
+// HTTP status it should be reported as.
+type uploadError struct {
+	status  int
+	message string
+}
+
+func (e *uploadError) Error() string { return e.message }
+
+func (h *FilesHandler) commitStagedUpload(
 	w http.ResponseWriter,
 	r *http.Request,
 	file *models.File,
 	user *models.User,
-	tmpPath string,
-	plainSize int64,
-	hasher hash.Hash,
+	staged *stagedUpload,
 ) bool {
-	if plainSize == 0 {
+	if staged.size == 0 {
 		writeError(w, http.StatusBadRequest, "Empty file body")
 		return false
 	}
-
-	if user.StorageLimit > 0 && user.StorageUsed+plainSize > user.StorageLimit {
-		writeError(w, http.StatusForbidden, "Storage limit exceeded")
+	if uerr := h.storeUploadedContent(r, file, user, staged); uerr != nil {
+		writeError(w, uerr.status, uerr.message)
 		return false
 	}
+	writeJSON(w, http.StatusOK, file)
+	return true
+}
 
-	if localBackend, ok := h.backend.(*storage.Local); ok {
-		if avail, _ := localBackend.DiskStats(); avail > 0 {
-			minFree := uint64(h.cfg.MinFreeBytes)
-			if avail < uint64(plainSize)+minFree {
-				writeError(w, http.StatusInsufficientStorage, "Insufficient disk space")
-				return false
-			}
+// storeUploadedContent makes a staged upload by user the new content of a
+// personal file: it checks quota and disk space, stores the blob, archives
+// the previous content as a version and charges the owner, who is user
+// unless user is a grantee with write access. file is updated in place.
+func (h *FilesHandler) storeUploadedContent(
+	r *http.Request,
+	file *models.File,
+	user *models.User,
+	staged *stagedUpload,
+) *uploadError {
+	owner := user
+	if file.OwnerID != user.ID {
+		owner = &models.User{}
+		if err := h.db.First(owner, "id = ?", file.OwnerID).Error; err != nil {
+			return &uploadError{http.StatusNotFound, "File not found"}
 		}
 	}
 
-	mimeType := "application/octet-stream"
-	if ext := filepath.Ext(file.Name); ext != "" {
-		if extMime := mime.TypeByExtension(ext); extMime != "" {
-			mimeType = extMime
-		}
+	plainSize := staged.size
+	if owner.StorageLimit > 0 && owner.StorageUsed+plainSize > owner.StorageLimit {
+		return &uploadError{http.StatusForbidden, "Storage limit exceeded"}
 	}
-	if mimeType == "application/octet-stream" {
-		if tf, err := os.Open(tmpPath); err == nil { // #nosec G304 -- tmpPath from CreateTemp
-			sniff := make([]byte, 512)
-			n, _ := tf.Read(sniff)
-			tf.Close()
-			if n > 0 {
-				detected := http.DetectContentType(sniff[:n])
-				if i := strings.IndexByte(detected, ';'); i != -1 {
-					detected = strings.TrimSpace(detected[:i])
-				}
-				mimeType = detected
+
+	if ds, ok := h.backend.(storage.DiskStatter); ok {
+		if avail, _ := ds.DiskStats(); avail > 0 {
+			minFree := uint64(h.cfg.MinFreeBytes)
+			if avail < uint64(plainSize)+minFree {
+				return &uploadError{http.StatusInsufficientStorage, "Insufficient disk space"}
 			}
 		}
 	}
 
+	mimeType := detectUploadMimeType(file.Name, staged.head)
+
 	var computedHash string
 	if storage.ShouldDedup(file.Name) {
-		computedHash = fmt.Sprintf("%x", hasher.Sum(nil))
-
-		var dedupDone bool
-		dedupErr := h.db.Transaction(func(tx *gorm.DB) error {
-			var existing models.File
-			err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
-				Where(
-					"owner_id = ? AND file_hash = ? AND is_folder = false AND deleted_at IS NULL AND storage_path IS NOT NULL AND space_id IS NULL",
-					user.ID, computedHash,
-				).First(&existing).Error
-
-			if err != nil || existing.StoragePath == nil {
-				return nil
-			}
-
-			mimeStr := mimeType
-			hashStr := computedHash
-			updates := map[string]interface{}{
-				"storage_path":    existing.StoragePath,
-				"encrypted_dek":   existing.EncryptedDEK,
-				"encryption_iv":   existing.EncryptionIV,
-				"encryption_algo": existing.EncryptionAlgo,
-				"size":            plainSize,
-				"mime_type":       mimeStr,
-				"file_hash":       hashStr,
-			}
-			if err := tx.Model(file).Updates(updates).Error; err != nil {
-				return err
-			}
-			tx.Model(&models.User{}).Where("id = ?", user.ID).
-				UpdateColumn("storage_used", gorm.Expr("storage_used + ?", plainSize))
-			file.Size = plainSize
-			file.MimeType = &mimeStr
-			file.StoragePath = existing.StoragePath
-			file.FileHash = &hashStr
-			dedupDone = true
-			return nil
-		})
-		if dedupErr != nil {
-			writeError(w, http.StatusInternalServerError, "Failed to update file record")
-			return false
-		}
-		if dedupDone {
-			LogAudit(h.db, AuditEntry{
-				UserID:       &user.ID,
-				UserName:     user.Name,
-				UserEmail:    user.Email,
-				Action:       "file.upload",
-				ResourceType: "file",
-				ResourceName: file.Name,
-				ResourceID:   file.ID.String(),
-				IPAddress:    auditIP(r),
-				Metadata:     models.JSONB{"size": plainSize, "mime_type": mimeType, "dedup": true},
-			})
-			writeJSON(w, http.StatusOK, file)
-			return true
-		}
+		computedHash = fmt.Sprintf("%x", staged.sum)
 	}
 
-	dek, iv, storedEncryptedDEK, algo, err := h.crypto.CreateEncryptionKeys()
+	// Identical content is stored once across all users and spaces; the
+	// uploader is still charged for the full size against their quota.
+	blob, isNew, err := storeBlob(h.db, h.crypto, h.cas, staged)
 	if err != nil {
-		writeError(w, http.StatusInternalServerError, "Failed to generate encryption keys")
-		return false
-	}
-
-	storagePath := fmt.Sprintf("%s/%s.enc", user.ID.String(), file.ID.String())
-
-	plainReader, err := os.Open(tmpPath) // #nosec G304 -- tmpPath from CreateTemp
-	if err != nil {
-		writeError(w, http.StatusInternalServerError, "Failed to open temp file")
-		return false
-	}
-	defer plainReader.Close()
-
-	pr, pw := io.Pipe()
-	encErrCh := make(chan error, 1)
-	go func() {
-		_, err := crypto.EncryptStream(plainReader, pw, dek, iv)
-		if err != nil {
-			pw.CloseWithError(err)
-		} else {
-			pw.Close()
-		}
-		encErrCh <- err
-	}()
-
-	_, writeErr := h.backend.Write(storagePath, pr)
-	encErr := <-encErrCh
-	if encErr != nil {
-		slog.Error("failed to encrypt file", "error", encErr, "path", storagePath)
-		_ = h.backend.Delete(storagePath)
-		writeError(w, http.StatusInternalServerError, "Failed to encrypt file")
-		return false
-	}
-	if writeErr != nil {
-		slog.Error("failed to write encrypted file", "error", writeErr, "path", storagePath)
-		writeError(w, http.StatusInternalServerError, "Failed to store file")
-		return false
+		slog.Error("failed to store blob", "error", err, "file_id", file.ID)
+		return &uploadError{http.StatusInternalServerError, "Failed to store file"}
 	}
 
 	updates := map[string]interface{}{
-		"storage_path":    storagePath,
-		"encrypted_dek":   storedEncryptedDEK,
-		"encryption_iv":   iv,
-		"encryption_algo": algo,
-		"size":            plainSize,
-		"mime_type":       mimeType,
+		"size":        plainSize,
+		"mime_type":   mimeType,
+		"uploaded_by": user.ID,
 	}
 	if computedHash != "" {
 		updates["file_hash"] = computedHash
 	}
 
-	if err := h.db.Model(file).Updates(updates).Error; err != nil {
-		writeError(w, http.StatusInternalServerError, "Failed to update file record")
-		return false
+	// Overwriting keeps the previous content as a version, which stays
+	// charged to the owner until retention removes it.
+	previousSize := file.Size
+	hadContent := file.StoragePath != nil
+	var archived bool
+	if err := h.db.Transaction(func(tx *gorm.DB) error {
+		var err error
+		if archived, err = archiveCurrentVersion(tx, h.cfg, file); err != nil {
+			return err
+		}
+		return attachBlob(tx, file, blob, updates)
+	}); err != nil {
+		releaseBlob(h.db, blob.ID) //nolint:errcheck
+		return &uploadError{http.StatusInternalServerError, "Failed to update file record"}
+	}
+	if archived {
+		pruneFileVersions(h.db, h.backend, h.cfg, file.ID)
 	}
+	wakeSearchIndexer()
 
-	h.db.Model(&models.User{}).Where("id = ?", user.ID).
-		UpdateColumn("storage_used", gorm.Expr("storage_used + ?", plainSize))
+	usedDelta := plainSize
+	if hadContent && !archived {
+		usedDelta -= previousSize
+	}
+	h.db.Model(&models.User{}).Where("id = ?", owner.ID).
+		UpdateColumn("storage_used", gorm.Expr("GREATEST(storage_used + ?, 0)", usedDelta))
 
-	if user.StorageLimit > 0 {
-		prevPct := float64(user.StorageUsed) / float64(user.StorageLimit) * 100
-		newPct := float64(user.StorageUsed+plainSize) / float64(user.StorageLimit) * 100
+	if owner.StorageLimit > 0 {
+		prevPct := float64(owner.StorageUsed) / float64(owner.StorageLimit) * 100
+		newPct := float64(owner.StorageUsed+plainSize) / float64(owner.StorageLimit) * 100
 		if prevPct < 75 && newPct >= 75 {
 			go SendNotification(h.db, h.cfg, "storage_warning",
 				"Storage Warning — 75% Used",
 				fmt.Sprintf("User %s has used %.0f%% of their storage quota (%s / %s).",
-					user.Email, newPct,
-					formatStorageBytes(user.StorageUsed+plainSize),
-					formatStorageBytes(user.StorageLimit),
+					owner.Email, newPct,
+					formatStorageBytes(owner.StorageUsed+plainSize),
+					formatStorageBytes(owner.StorageLimit),
 				),
 			)
 		}
@@ -353,7 +309,6 @@ func (h *FilesHandler) commitUploadedTempFile(
 	file.Size = plainSize
 	mimeStr := mimeType
 	file.MimeType = &mimeStr
-	file.StoragePath = &storagePath
 	if computedHash != "" {
 		file.FileHash = &computedHash
 	}
@@ -367,32 +322,56 @@ func (h *FilesHandler) commitUploadedTempFile(
 		ResourceName: file.Name,
 		ResourceID:   file.ID.String(),
 		IPAddress:    auditIP(r),
-		Metadata:     models.JSONB{"size": plainSize, "mime_type": mimeType},
+		Metadata:     models.JSONB{"size": plainSize, "mime_type": mimeType, "dedup": !isNew},
 	})
+	return nil
+}
 
-	writeJSON(w, http.StatusOK, file)
-	return true
+// detectUploadMimeType picks a MIME type from the file extension, falling
+// back to sniffing head, the first bytes of the plaintext.
+func detectUploadMimeType(name string, head []byte) string {
+	mimeType := "application/octet-stream"
+	if ext := filepath.Ext(name); ext != "" {
+		if extMime := mime.TypeByExtension(ext); extMime != "" {
+			mimeType = extMime
+		}
+	}
+	if mimeType == "application/octet-stream" && len(head) > 0 {
+		detected := http.DetectContentType(head)
+		if i := strings.IndexByte(detected, ';'); i != -1 {
+			detected = strings.TrimSpace(detected[:i])
+		}
+		mimeType = detected
+	}
+	return mimeType
 }
 
 // POST /api/v1/files/{id}/upload-session
 func (h *FilesHandler) StartUploadSession(w http.ResponseWriter, r *http.Request) {
-	file, user, err := h.loadOwnedUploadFile(r)
+	file, user, err := h.loadUploadFile(r)
 	if err != nil {
-		if err == gorm.ErrRecordNotFound {
-			writeError(w, http.StatusNotFound, "File not found")
-		} else {
-			writeError(w, http.StatusBadRequest, err.Error())
-		}
+		writeUploadFileError(w, err)
 		return
 	}
-	if file.StoragePath != nil {
-		writeError(w, http.StatusConflict, "File already uploaded")
+	root, err := h.uploadRootDir()
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "Failed to create upload session storage")
 		return
 	}
 
-	root, err := h.uploadRootDir()
+	if h.crypto == nil {
+		writeError(w, http.StatusInternalServerError, "Encryption not configured")
+		return
+	}
+	// Chunks are encrypted under a per-session staging key as they arrive.
+	stagingKey, err := h.crypto.GenerateDEK()
 	if err != nil {
-		writeError(w, http.StatusInternalServerError, "Failed to create upload session storage")
+		writeError(w, http.StatusInternalServerError, "Failed to create upload session")
+		return
+	}
+	wrappedKey, err := h.crypto.WrapDEK(stagingKey)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "Failed to create upload session")
 		return
 	}
 
@@ -426,6 +405,7 @@ func (h *FilesHandler) StartUploadSession(w http.ResponseWriter, r *http.Request
 		CreatedAt:      now,
 		UpdatedAt:      now,
 		ExpiresAt:      now.Add(uploadSessionTTL),
+		EncryptedDEK:   wrappedKey,
 	}
 	if err := writeUploadSessionManifest(uploadSessionManifestPath(root, file.ID.String(), sessionID), manifest); err != nil {
 		writeError(w, http.StatusInternalServerError, "Failed to create upload session manifest")
@@ -450,13 +430,9 @@ func (h *FilesHandler) StartUploadSession(w http.ResponseWriter, r *http.Request
 
 // GET /api/v1/files/{id}/upload-session/{sessionId}
 func (h *FilesHandler) GetUploadSession(w http.ResponseWriter, r *http.Request) {
-	_, _, err := h.loadOwnedUploadFile(r)
+	_, _, err := h.loadUploadFile(r)
 	if err != nil {
-		if err == gorm.ErrRecordNotFound {
-			writeError(w, http.StatusNotFound, "File not found")
-		} else {
-			writeError(w, http.StatusBadRequest, err.Error())
-		}
+		writeUploadFileError(w, err)
 		return
 	}
 
@@ -490,13 +466,9 @@ func (h *FilesHandler) GetUploadSession(w http.ResponseWriter, r *http.Request)
 
 // PUT /api/v1/files/{id}/upload-session/{sessionId}/chunks/{index}
 func (h *FilesHandler) UploadChunk(w http.ResponseWriter, r *http.Request) {
-	file, user, err := h.loadOwnedUploadFile(r)
+	file, user, err := h.loadUploadFile(r)
 	if err != nil {
-		if err == gorm.ErrRecordNotFound {
-			writeError(w, http.StatusNotFound, "File not found")
-		} else {
-			writeError(w, http.StatusBadRequest, err.Error())
-		}
+		writeUploadFileError(w, err)
 		return
 	}
 
@@ -533,29 +505,17 @@ func (h *FilesHandler) UploadChunk(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	dir := uploadSessionDir(root, fileID, sessionID)
-	if err := os.MkdirAll(dir, 0o750); err != nil {
-		writeError(w, http.StatusInternalServerError, "Failed to prepare upload session")
+	stagingKey, uerr := h.sessionStagingKey(manifest)
+	if uerr != nil {
+		writeError(w, uerr.status, uerr.message)
 		return
 	}
 
-	tmpChunk, err := os.CreateTemp(dir, fmt.Sprintf(".chunk-%06d-*", index))
-	if err != nil {
-		writeError(w, http.StatusInternalServerError, "Failed to create chunk")
-		return
-	}
-	tmpPath := tmpChunk.Name()
-
 	r.Body = http.MaxBytesReader(w, r.Body, uploadChunkSizeBytes+1)
-	written, copyErr := io.Copy(tmpChunk, r.Body)
-	closeErr := tmpChunk.Close()
-	if copyErr != nil || closeErr != nil {
-		os.Remove(tmpPath)
-		if copyErr != nil {
-			writeError(w, http.StatusInternalServerError, "Upload interrupted — please try again")
-		} else {
-			writeError(w, http.StatusInternalServerError, "Failed to finish chunk upload")
-		}
+	dir := uploadSessionDir(root, fileID, sessionID)
+	tmpPath, written, err := writeStagedPart(dir, fmt.Sprintf(".chunk-%06d-*", index), stagingKey, r.Body)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "Upload interrupted — please try again")
 		return
 	}
 
@@ -597,13 +557,9 @@ func (h *FilesHandler) UploadChunk(w http.ResponseWriter, r *http.Request) {
 
 // POST /api/v1/files/{id}/upload-session/{sessionId}/complete
 func (h *FilesHandler) CompleteUploadSession(w http.ResponseWriter, r *http.Request) {
-	file, user, err := h.loadOwnedUploadFile(r)
+	file, user, err := h.loadUploadFile(r)
 	if err != nil {
-		if err == gorm.ErrRecordNotFound {
-			writeError(w, http.StatusNotFound, "File not found")
-		} else {
-			writeError(w, http.StatusBadRequest, err.Error())
-		}
+		writeUploadFileError(w, err)
 		return
 	}
 
@@ -644,55 +600,49 @@ func (h *FilesHandler) CompleteUploadSession(w http.ResponseWriter, r *http.Requ
 		}
 	}
 
-	assembled, err := os.CreateTemp(filepath.Dir(manifestPath), ".assembled-*")
-	if err != nil {
-		writeError(w, http.StatusInternalServerError, "Failed to assemble upload")
+	stagingKey, uerr := h.sessionStagingKey(manifest)
+	if uerr != nil {
+		writeError(w, uerr.status, uerr.message)
 		return
 	}
-	assembledPath := assembled.Name()
-	hasher := sha256.New()
-	var plainSize int64
-	for i := 0; i < manifest.TotalChunks; i++ {
-		chunkFile, err := os.Open(uploadChunkPath(root, fileID, sessionID, i))
-		if err != nil {
-			assembled.Close()
-			os.Remove(assembledPath)
-			writeError(w, http.StatusInternalServerError, "Missing upload chunk")
-			return
-		}
-		n, copyErr := io.Copy(io.MultiWriter(assembled, hasher), chunkFile)
-		chunkFile.Close()
-		if copyErr != nil {
-			assembled.Close()
-			os.Remove(assembledPath)
-			writeError(w, http.StatusInternalServerError, "Failed to read upload chunk")
-			return
-		}
-		plainSize += n
+	parts := make([]string, manifest.TotalChunks)
+	for i := range parts {
+		parts[i] = uploadChunkPath(root, fileID, sessionID, i)
 	}
-	if err := assembled.Close(); err != nil {
-		os.Remove(assembledPath)
-		writeError(w, http.StatusInternalServerError, "Failed to finalize upload assembly")
+	staged, err := stagedSession(parts, stagingKey)
+	if err != nil {
+		slog.Error("failed to read upload session chunks", "file_id", fileID, "session_id", sessionID, "error", err)
+		writeError(w, http.StatusInternalServerError, "Failed to read upload chunk")
 		return
 	}
 
-	if !h.commitUploadedTempFile(w, r, file, user, assembledPath, plainSize, hasher) {
-		os.Remove(assembledPath)
+	if !h.commitStagedUpload(w, r, file, user, staged) {
 		return
 	}
-	os.Remove(assembledPath)
 	_ = os.RemoveAll(uploadSessionDir(root, fileID, sessionID))
 }
 
+// sessionStagingKey unwraps the key a session's chunks are encrypted with.
+func (h *FilesHandler) sessionStagingKey(manifest uploadSessionManifest) ([]byte, *uploadError) {
+	if h.crypto == nil {
+		return nil, &uploadError{http.StatusInternalServerError, "Encryption not configured"}
+	}
+	if len(manifest.EncryptedDEK) == 0 {
+		return nil, &uploadError{http.StatusGone, "Upload session expired"}
+	}
+	key, err := h.crypto.DecryptFileKey(manifest.EncryptedDEK)
+	if err != nil {
+		slog.Error("failed to unwrap upload session key", "file_id", manifest.FileID, "error", err)
+		return nil, &uploadError{http.StatusInternalServerError, "Failed to read upload session"}
+	}
+	return key, nil
+}
+
 // DELETE /api/v1/files/{id}/upload-session/{sessionId}
 func (h *FilesHandler) AbortUploadSession(w http.ResponseWriter, r *http.Request) {
-	file, _, err := h.loadOwnedUploadFile(r)
+	file, _, err := h.loadUploadFile(r)
 	if err != nil {
-		if err == gorm.ErrRecordNotFound {
-			writeError(w, http.StatusNotFound, "File not found")
-		} else {
-			writeError(w, http.StatusBadRequest, err.Error())
-		}
+		writeUploadFileError(w, err)
 		return
 	}
 
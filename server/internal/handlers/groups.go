@@ -0,0 +1,414 @@
+package handlers
+
+import (
+	"errors"
+	"log/slog"
+	"net/http"
+	"strings"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/google/uuid"
+	"github.com/zynqcloud/api/internal/config"
+	mw "github.com/zynqcloud/api/internal/middleware"
+	"github.com/zynqcloud/api/internal/models"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// Groups
+//
+// A group is a named set of users that can be the grantee of a private
+// share or a member of a space with a role, exactly like a single user.
+// Everyone can list groups to pick one; only admins manage them. A group
+// can follow a directory group (sync_source "ldap", sync_group a DN or CN)
+// or a value of the IdP's groups claim ("oidc"): the LDAP sync and every
+// sign-in add and remove the memberships they granted, and leave the ones
+// added by hand alone.
+
+// maxGroupMembersPerRequest caps the users added in one request.
+const maxGroupMembersPerRequest = 500
+
+var errGroupNameTaken = errors.New("a group with this name already exists")
+
+type GroupsHandler struct {
+	db  *gorm.DB
+	cfg *config.Config
+}
+
+func NewGroupsHandler(db *gorm.DB, cfg *config.Config) *GroupsHandler {
+	return &GroupsHandler{db: db, cfg: cfg}
+}
+
+// groupInput is the body of a group create or update; nil fields are left
+// unchanged on update.
+type groupInput struct {
+	Name        *string `json:"name"`
+	Description *string `json:"description"`
+	SyncSource  *string `json:"syncSource"`
+	SyncGroup   *string `json:"syncGroup"`
+}
+
+// apply validates in and copies it onto g.
+func (in *groupInput) apply(g *models.Group) error {
+	if in.Name != nil {
+		name := strings.TrimSpace(*in.Name)
+		if name == "" || len(name) > 255 {
+			return errors.New("name must be 1 to 255 characters")
+		}
+		g.Name = name
+	}
+	if in.Description != nil {
+		g.Description = strings.TrimSpace(*in.Description)
+	}
+	if in.SyncSource != nil {
+		switch source := strings.TrimSpace(*in.SyncSource); source {
+		case "":
+			g.SyncSource, g.SyncGroup = nil, nil
+		case models.GroupSourceLDAP, models.GroupSourceOIDC:
+			g.SyncSource = &source
+		default:
+			return errors.New("syncSource must be ldap, oidc or empty")
+		}
+	}
+	if in.SyncGroup != nil && g.SyncSource != nil {
+		syncGroup := strings.TrimSpace(*in.SyncGroup)
+		g.SyncGroup = &syncGroup
+	}
+	if g.SyncSource != nil && (g.SyncGroup == nil || *g.SyncGroup == "") {
+		return errors.New("syncGroup is required with syncSource")
+	}
+	return nil
+}
+
+// checkGroupName returns errGroupNameTaken when another group has name,
+// ignoring case.
+func checkGroupName(db *gorm.DB, name string, except uuid.UUID) error {
+	var n int64
+	db.Model(&models.Group{}).Where("LOWER(name) = LOWER(?) AND id != ?", name, except).Count(&n)
+	if n > 0 {
+		return errGroupNameTaken
+	}
+	return nil
+}
+
+// groupMemberCounts returns the member count of each group in ids.
+func groupMemberCounts(db *gorm.DB, ids []uuid.UUID) map[uuid.UUID]int {
+	counts := make(map[uuid.UUID]int, len(ids))
+	if len(ids) == 0 {
+		return counts
+	}
+	var rows []struct {
+		GroupID uuid.UUID
+		Count   int
+	}
+	db.Model(&models.GroupMember{}).
+		Select("group_id, COUNT(*) AS count").
+		Where("group_id IN ?", ids).
+		Group("group_id").
+		Scan(&rows)
+	for _, row := range rows {
+		counts[row.GroupID] = row.Count
+	}
+	return counts
+}
+
+func (h *GroupsHandler) loadGroup(w http.ResponseWriter, r *http.Request) (*models.Group, bool) {
+	groupID, err := uuid.Parse(chi.URLParam(r, "id"))
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "Invalid group ID")
+		return nil, false
+	}
+	var g models.Group
+	if err := h.db.First(&g, "id = ?", groupID).Error; err != nil {
+		writeError(w, http.StatusNotFound, "Group not found")
+		return nil, false
+	}
+	return &g, true
+}
+
+func (h *GroupsHandler) audit(r *http.Request, action string, g *models.Group, meta models.JSONB) {
+	claims := mw.GetClaims(r)
+	userID, _ := uuid.Parse(claims.Sub)
+	var auditUser models.User
+	h.db.Select("name, email").First(&auditUser, "id = ?", userID)
+	LogAudit(h.db, AuditEntry{
+		UserID:       &userID,
+		UserName:     auditUser.Name,
+		UserEmail:    auditUser.Email,
+		Action:       action,
+		ResourceType: "group",
+		ResourceName: g.Name,
+		ResourceID:   g.ID.String(),
+		IPAddress:    auditIP(r),
+		Metadata:     meta,
+	})
+}
+
+// GET /api/v1/groups
+func (h *GroupsHandler) List(w http.ResponseWriter, r *http.Request) {
+	query := h.db.Model(&models.Group{})
+	if q := r.URL.Query().Get("q"); q != "" {
+		query = query.Where("name ILIKE ? ESCAPE '\\'", likeSafe(q))
+	}
+	groups := []models.Group{}
+	query.Order("name ASC").Find(&groups)
+
+	ids := make([]uuid.UUID, len(groups))
+	for i, g := range groups {
+		ids[i] = g.ID
+	}
+	counts := groupMemberCounts(h.db, ids)
+	for i := range groups {
+		groups[i].MemberCount = counts[groups[i].ID]
+	}
+	writeJSON(w, http.StatusOK, groups)
+}
+
+// POST /api/v1/groups
+func (h *GroupsHandler) Create(w http.ResponseWriter, r *http.Request) {
+	claims := mw.GetClaims(r)
+	userID, _ := uuid.Parse(claims.Sub)
+
+	var in groupInput
+	if err := readJSON(r, &in); err != nil {
+		writeError(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+	if in.Name == nil {
+		writeError(w, http.StatusBadRequest, "name is required")
+		return
+	}
+	g := &models.Group{ID: uuid.New(), CreatedBy: &userID}
+	if err := in.apply(g); err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if err := checkGroupName(h.db, g.Name, g.ID); err != nil {
+		writeError(w, http.StatusConflict, err.Error())
+		return
+	}
+	if err := h.db.Create(g).Error; err != nil {
+		writeError(w, http.StatusInternalServerError, "Failed to create group")
+		return
+	}
+
+	h.audit(r, "group.create", g, models.JSONB{})
+	writeJSON(w, http.StatusCreated, g)
+}
+
+// PATCH /api/v1/groups/{id}
+func (h *GroupsHandler) Update(w http.ResponseWriter, r *http.Request) {
+	g, ok := h.loadGroup(w, r)
+	if !ok {
+		return
+	}
+	var in groupInput
+	if err := readJSON(r, &in); err != nil {
+		writeError(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+	oldSource := g.SyncSource
+	if err := in.apply(g); err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if err := checkGroupName(h.db, g.Name, g.ID); err != nil {
+		writeError(w, http.StatusConflict, err.Error())
+		return
+	}
+	err := h.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(g).Select("name", "description", "sync_source", "sync_group").Updates(g).Error; err != nil {
+			return err
+		}
+		// Memberships the old sync added are its to manage; they go with it.
+		if oldSource != nil && (g.SyncSource == nil || *g.SyncSource != *oldSource) {
+			return tx.Where("group_id = ? AND source = ?", g.ID, *oldSource).Delete(&models.GroupMember{}).Error
+		}
+		return nil
+	})
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "Failed to update group")
+		return
+	}
+
+	h.audit(r, "group.update", g, models.JSONB{})
+	writeJSON(w, http.StatusOK, g)
+}
+
+// DELETE /api/v1/groups/{id}
+func (h *GroupsHandler) Delete(w http.ResponseWriter, r *http.Request) {
+	g, ok := h.loadGroup(w, r)
+	if !ok {
+		return
+	}
+	// Memberships, space roles and shares held by the group cascade.
+	if err := h.db.Delete(g).Error; err != nil {
+		writeError(w, http.StatusInternalServerError, "Failed to delete group")
+		return
+	}
+
+	h.audit(r, "group.delete", g, models.JSONB{})
+	writeJSON(w, http.StatusOK, map[string]string{"message": "Group deleted"})
+}
+
+// GET /api/v1/groups/{id}/members
+func (h *GroupsHandler) ListMembers(w http.ResponseWriter, r *http.Request) {
+	g, ok := h.loadGroup(w, r)
+	if !ok {
+		return
+	}
+	members := []models.GroupMember{}
+	h.db.Where("group_id = ?", g.ID).Preload("User").Order("added_at ASC").Find(&members)
+	writeJSON(w, http.StatusOK, members)
+}
+
+// POST /api/v1/groups/{id}/members
+func (h *GroupsHandler) AddMembers(w http.ResponseWriter, r *http.Request) {
+	claims := mw.GetClaims(r)
+	userID, _ := uuid.Parse(claims.Sub)
+
+	g, ok := h.loadGroup(w, r)
+	if !ok {
+		return
+	}
+	var req struct {
+		UserIDs []uuid.UUID `json:"userIds"`
+	}
+	if err := readJSON(r, &req); err != nil {
+		writeError(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+	if len(req.UserIDs) == 0 {
+		writeError(w, http.StatusBadRequest, "userIds is required")
+		return
+	}
+	if len(req.UserIDs) > maxGroupMembersPerRequest {
+		writeError(w, http.StatusBadRequest, "Too many users in one request")
+		return
+	}
+
+	var users []models.User
+	h.db.Select("id").Where("id IN ?", req.UserIDs).Find(&users)
+	if len(users) == 0 {
+		writeError(w, http.StatusNotFound, "User not found")
+		return
+	}
+	members := make([]models.GroupMember, len(users))
+	for i, u := range users {
+		members[i] = models.GroupMember{GroupID: g.ID, UserID: u.ID, AddedBy: &userID}
+	}
+	tx := h.db.Clauses(clause.OnConflict{DoNothing: true}).Create(&members)
+	if tx.Error != nil {
+		writeError(w, http.StatusInternalServerError, "Failed to add members")
+		return
+	}
+
+	h.audit(r, "group.member_add", g, models.JSONB{"added": tx.RowsAffected})
+	writeJSON(w, http.StatusOK, map[string]interface{}{"added": tx.RowsAffected})
+}
+
+// DELETE /api/v1/groups/{id}/members/{uid}
+func (h *GroupsHandler) RemoveMember(w http.ResponseWriter, r *http.Request) {
+	g, ok := h.loadGroup(w, r)
+	if !ok {
+		return
+	}
+	targetUID, err := uuid.Parse(chi.URLParam(r, "uid"))
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "Invalid user ID")
+		return
+	}
+	result := h.db.Where("group_id = ? AND user_id = ?", g.ID, targetUID).Delete(&models.GroupMember{})
+	if result.RowsAffected == 0 {
+		writeError(w, http.StatusNotFound, "Member not found")
+		return
+	}
+
+	h.audit(r, "group.member_remove", g, models.JSONB{"target_user_id": targetUID.String()})
+	writeJSON(w, http.StatusOK, map[string]string{"message": "Member removed"})
+}
+
+// syncGroupMembers applies a group sync from source. inGroup holds, for
+// each user the sync knows about, whether they belong to a given sync
+// group. Each user joins the groups following source that they belong to
+// and leaves the ones they no longer do. With prune set, users missing from
+// inGroup leave every group the sync added them to. Memberships added by
+// hand are never touched.
+func syncGroupMembers(db *gorm.DB, source string, inGroup map[uuid.UUID]func(syncGroup string) bool, prune bool) (added, removed int, err error) {
+	var groups []models.Group
+	if err := db.Where("sync_source = ?", source).Find(&groups).Error; err != nil {
+		return 0, 0, err
+	}
+	if len(groups) == 0 {
+		return 0, 0, nil
+	}
+
+	type key struct{ group, user uuid.UUID }
+	want := make(map[key]bool)
+	groupIDs := make([]uuid.UUID, len(groups))
+	for i, g := range groups {
+		groupIDs[i] = g.ID
+		if g.SyncGroup == nil {
+			continue
+		}
+		for userID, member := range inGroup {
+			if member(*g.SyncGroup) {
+				want[key{g.ID, userID}] = true
+			}
+		}
+	}
+
+	q := db.Where("source = ? AND group_id IN ?", source, groupIDs)
+	if !prune {
+		userIDs := make([]uuid.UUID, 0, len(inGroup))
+		for id := range inGroup {
+			userIDs = append(userIDs, id)
+		}
+		if len(userIDs) == 0 {
+			return 0, 0, nil
+		}
+		q = q.Where("user_id IN ?", userIDs)
+	}
+	var synced []models.GroupMember
+	if err := q.Find(&synced).Error; err != nil {
+		return 0, 0, err
+	}
+	have := make(map[key]bool, len(synced))
+	for _, m := range synced {
+		k := key{m.GroupID, m.UserID}
+		if want[k] {
+			have[k] = true
+			continue
+		}
+		if err := db.Where("group_id = ? AND user_id = ?", m.GroupID, m.UserID).Delete(&models.GroupMember{}).Error; err != nil {
+			return added, removed, err
+		}
+		removed++
+	}
+
+	for k := range want {
+		if have[k] {
+			continue
+		}
+		m := models.GroupMember{GroupID: k.group, UserID: k.user, Source: &source}
+		// Existing hand-made memberships win.
+		tx := db.Clauses(clause.OnConflict{DoNothing: true}).Create(&m)
+		if tx.Error != nil {
+			return added, removed, tx.Error
+		}
+		if tx.RowsAffected > 0 {
+			added++
+		}
+	}
+	return added, removed, nil
+}
+
+// syncUserGroups applies a sign-in's groups to the user's memberships of
+// the groups following source. Failures are logged; they never block the
+// sign-in.
+func syncUserGroups(db *gorm.DB, source string, userID uuid.UUID, member func(syncGroup string) bool) {
+	inGroup := map[uuid.UUID]func(string) bool{userID: member}
+	if _, _, err := syncGroupMembers(db, source, inGroup, false); err != nil {
+		slog.Warn("group sync on sign-in failed", "source", source, "user_id", userID, "error", err)
+	}
+}
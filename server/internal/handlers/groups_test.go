@@ -0,0 +1,68 @@
+package handlers
+
+import (
+	"testing"
+
+	"github.com/zynqcloud/api/internal/models"
+)
+
+func strPtr(s string) *string { return &s }
+
+func TestGroupInputApply(t *testing.T) {
+	var g models.Group
+	in := groupInput{Name: strPtr("  Design  "), SyncSource: strPtr("ldap"), SyncGroup: strPtr(" cn=design,ou=groups,dc=example,dc=com ")}
+	if err := in.apply(&g); err != nil {
+		t.Fatal(err)
+	}
+	if g.Name != "Design" || g.SyncSource == nil || *g.SyncSource != "ldap" || *g.SyncGroup != "cn=design,ou=groups,dc=example,dc=com" {
+		t.Errorf("unexpected group %+v", g)
+	}
+
+	// Clearing the source drops the sync group with it.
+	if err := (&groupInput{SyncSource: strPtr("")}).apply(&g); err != nil {
+		t.Fatal(err)
+	}
+	if g.SyncSource != nil || g.SyncGroup != nil {
+		t.Error("sync settings not cleared")
+	}
+
+	for name, bad := range map[string]groupInput{
+		"empty name":        {Name: strPtr("   ")},
+		"unknown source":    {SyncSource: strPtr("saml"), SyncGroup: strPtr("x")},
+		"source, no group":  {SyncSource: strPtr("oidc")},
+		"source, blank one": {SyncSource: strPtr("oidc"), SyncGroup: strPtr("  ")},
+	} {
+		g := models.Group{Name: "Design"}
+		if err := bad.apply(&g); err == nil {
+			t.Errorf("%s: accepted", name)
+		}
+	}
+}
+
+func TestStrongestSpaceRole(t *testing.T) {
+	cases := []struct {
+		roles []string
+		want  string
+	}{
+		{nil, ""},
+		{[]string{models.SpaceRoleViewer}, models.SpaceRoleViewer},
+		{[]string{models.SpaceRoleViewer, models.SpaceRoleAdmin, models.SpaceRoleContributor}, models.SpaceRoleAdmin},
+		{[]string{"bogus", models.SpaceRoleContributor}, models.SpaceRoleContributor},
+	}
+	for _, c := range cases {
+		if got := strongestSpaceRole(c.roles); got != c.want {
+			t.Errorf("strongestSpaceRole(%v) = %q, want %q", c.roles, got, c.want)
+		}
+	}
+}
+
+func TestGroupMatchers(t *testing.T) {
+	dir := directoryGroupMatcher([]string{"CN=Design,OU=Groups,DC=example,DC=com"})
+	if !dir("design") || !dir("cn=design,ou=groups,dc=example,dc=com") || dir("sales") {
+		t.Error("directory group matching")
+	}
+	idp := oidcGroupMatcher([]string{"design", "eng"})
+	if !idp("eng") || idp("Eng") || idp("sales") {
+		t.Error("groups claim matching")
+	}
+}
@@ -228,6 +228,12 @@ func (h *InvitationsHandler) Accept(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	// Invited users sign in through SSO instead when passwords are off.
+	if !h.cfg.PasswordLogin {
+		writeError(w, http.StatusForbidden, errPasswordLoginDisabled)
+		return
+	}
+
 	req.Email = strings.ToLower(strings.TrimSpace(req.Email))
 	req.Name = strings.TrimSpace(req.Name)
 
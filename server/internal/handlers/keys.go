@@ -0,0 +1,248 @@
+package handlers
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/zynqcloud/api/internal/crypto"
+	mw "github.com/zynqcloud/api/internal/middleware"
+	"github.com/zynqcloud/api/internal/models"
+	"gorm.io/gorm"
+)
+
+// Master key rotation
+//
+// Every stored encrypted_dek is the file's DEK wrapped with the master key
+// (KEK). Rotating the KEK re-wraps those DEKs; file contents are never
+// re-encrypted. The server runs with the new key as FILE_ENCRYPTION_MASTER_KEY
+// and the old one in FILE_ENCRYPTION_OLD_KEYS, so both keys can unwrap while
+// rows are converted. key_id records which key wrapped each row.
+//
+// Work is done in batches and every converted row is committed with its new
+// key_id, so an interrupted rotation simply resumes where it stopped. Once no
+// row is left on an old key, the stored key_fingerprint is switched to the
+// new key and the old key can be removed from the configuration.
+
+// keyedTables are the tables holding wrapped DEKs. user_totp wraps TOTP
+// secrets the same way.
+var keyedTables = []string{"files", "file_versions", "blobs", "user_totp"}
+
+// KeyRotationResult summarises one RotateMasterKey run.
+type KeyRotationResult struct {
+	Rewrapped          int   `json:"rewrapped"`
+	Failed             int   `json:"failed"`
+	Pending            int64 `json:"pending"`
+	FingerprintUpdated bool  `json:"fingerprint_updated"`
+}
+
+// RotateMasterKey re-wraps every DEK not yet wrapped with c's current master
+// key, batchSize rows at a time. Rows that no configured key can unwrap are
+// counted as failed and skipped. When nothing is left to convert the stored
+// key fingerprint is switched to the current master key.
+func RotateMasterKey(ctx context.Context, db *gorm.DB, c *crypto.Crypto, batchSize int, logger *slog.Logger) (KeyRotationResult, error) {
+	var res KeyRotationResult
+	if batchSize <= 0 {
+		batchSize = 500
+	}
+	keyID := c.KeyID()
+
+	for _, table := range keyedTables {
+		cursor := ""
+		for {
+			if err := ctx.Err(); err != nil {
+				return res, err
+			}
+			n, failed, last, err := rewrapBatch(db, c, table, keyID, cursor, batchSize)
+			res.Rewrapped += n
+			res.Failed += failed
+			if err != nil {
+				return res, fmt.Errorf("rewrap %s: %w", table, err)
+			}
+			if last == "" {
+				break
+			}
+			cursor = last
+			logger.Info("key rotation: batch complete", "table", table, "rewrapped", res.Rewrapped, "failed", res.Failed)
+		}
+	}
+
+	pending, err := pendingKeyRewraps(db, keyID)
+	if err != nil {
+		return res, err
+	}
+	res.Pending = pending
+	if pending == 0 {
+		if err := storeKeyFingerprint(db, c.Fingerprint()); err != nil {
+			return res, err
+		}
+		res.FingerprintUpdated = true
+	}
+	return res, nil
+}
+
+// rewrapBatch converts up to limit rows of table whose id sorts after cursor.
+// It returns the last id it looked at, or "" when the table is exhausted.
+func rewrapBatch(db *gorm.DB, c *crypto.Crypto, table, keyID, cursor string, limit int) (rewrapped, failed int, last string, err error) {
+	var rows []struct {
+		ID           string
+		EncryptedDEK []byte
+	}
+	q := db.Table(table).Select("id::text AS id, encrypted_dek").
+		Where("encrypted_dek IS NOT NULL AND key_id IS DISTINCT FROM ?", keyID)
+	if cursor != "" {
+		q = q.Where("id > ?", cursor)
+	}
+	if err := q.Order("id").Limit(limit).Scan(&rows).Error; err != nil {
+		return 0, 0, "", err
+	}
+	if len(rows) == 0 {
+		return 0, 0, "", nil
+	}
+
+	err = db.Transaction(func(tx *gorm.DB) error {
+		for _, row := range rows {
+			wrapped, err := c.RewrapFileKey(row.EncryptedDEK)
+			if err != nil {
+				failed++
+				continue
+			}
+			// Only replace the key we read: a concurrent upload may have
+			// written fresh key material in the meantime.
+			res := tx.Table(table).
+				Where("id = ? AND encrypted_dek = ?", row.ID, row.EncryptedDEK).
+				Updates(map[string]interface{}{"encrypted_dek": wrapped, "key_id": keyID})
+			if res.Error != nil {
+				return res.Error
+			}
+			rewrapped += int(res.RowsAffected)
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, 0, "", err
+	}
+	return rewrapped, failed, rows[len(rows)-1].ID, nil
+}
+
+// pendingKeyRewraps counts rows whose DEK is not wrapped with keyID.
+func pendingKeyRewraps(db *gorm.DB, keyID string) (int64, error) {
+	var total int64
+	for _, table := range keyedTables {
+		var n int64
+		if err := db.Table(table).
+			Where("encrypted_dek IS NOT NULL AND key_id IS DISTINCT FROM ?", keyID).
+			Count(&n).Error; err != nil {
+			return 0, err
+		}
+		total += n
+	}
+	return total, nil
+}
+
+func storeKeyFingerprint(db *gorm.DB, fingerprint string) error {
+	return db.Exec(
+		"UPDATE settings SET value = to_jsonb(?::text) WHERE user_id IS NULL AND key = 'key_fingerprint'",
+		fingerprint,
+	).Error
+}
+
+type KeysHandler struct {
+	db     *gorm.DB
+	crypto *crypto.Crypto
+
+	mu      sync.Mutex
+	running bool
+	last    *keyRotationRun
+}
+
+type keyRotationRun struct {
+	StartedAt  time.Time          `json:"started_at"`
+	FinishedAt *time.Time         `json:"finished_at,omitempty"`
+	Result     *KeyRotationResult `json:"result,omitempty"`
+	Error      string             `json:"error,omitempty"`
+}
+
+func NewKeysHandler(db *gorm.DB, c *crypto.Crypto) *KeysHandler {
+	return &KeysHandler{db: db, crypto: c}
+}
+
+// GET /api/v1/admin/keys
+func (h *KeysHandler) Status(w http.ResponseWriter, r *http.Request) {
+	if h.crypto == nil {
+		writeError(w, http.StatusInternalServerError, "Encryption not configured")
+		return
+	}
+	pending, err := pendingKeyRewraps(h.db, h.crypto.KeyID())
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "Failed to count pending keys")
+		return
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"key_id":   h.crypto.KeyID(),
+		"pending":  pending,
+		"running":  h.running,
+		"last_run": h.last,
+	})
+}
+
+// POST /api/v1/admin/keys/rotate
+func (h *KeysHandler) Rotate(w http.ResponseWriter, r *http.Request) {
+	if h.crypto == nil {
+		writeError(w, http.StatusInternalServerError, "Encryption not configured")
+		return
+	}
+	claims := mw.GetClaims(r)
+	userID, _ := uuid.Parse(claims.Sub)
+
+	h.mu.Lock()
+	if h.running {
+		h.mu.Unlock()
+		writeError(w, http.StatusConflict, "Key rotation already running")
+		return
+	}
+	run := &keyRotationRun{StartedAt: time.Now()}
+	h.running = true
+	h.last = run
+	h.mu.Unlock()
+
+	var auditUser models.User
+	h.db.Select("name, email").First(&auditUser, "id = ?", userID)
+	LogAudit(h.db, AuditEntry{
+		UserID:       &userID,
+		UserName:     auditUser.Name,
+		UserEmail:    auditUser.Email,
+		Action:       "key.rotate",
+		ResourceType: "key",
+		ResourceName: h.crypto.KeyID(),
+		ResourceID:   h.crypto.KeyID(),
+		IPAddress:    auditIP(r),
+		Metadata:     models.JSONB{},
+	})
+
+	// The request only starts the job; progress is reported by Status.
+	go func() {
+		res, err := RotateMasterKey(context.Background(), h.db, h.crypto, 500, slog.Default())
+		now := time.Now()
+		h.mu.Lock()
+		defer h.mu.Unlock()
+		run.FinishedAt = &now
+		run.Result = &res
+		if err != nil {
+			run.Error = err.Error()
+			slog.Error("key rotation failed", "error", err)
+		} else {
+			slog.Info("key rotation finished", "rewrapped", res.Rewrapped, "failed", res.Failed, "pending", res.Pending)
+		}
+		h.running = false
+	}()
+
+	writeJSON(w, http.StatusAccepted, map[string]interface{}{"key_id": h.crypto.KeyID(), "started_at": run.StartedAt})
+}
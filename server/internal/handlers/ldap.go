@@ -0,0 +1,562 @@
+package handlers
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/zynqcloud/api/internal/config"
+	"github.com/zynqcloud/api/internal/directory"
+	"github.com/zynqcloud/api/internal/models"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// LDAP / Active Directory
+//
+// With LDAP_URL set, POST /auth/login first checks the email or username
+// against the directory (search as the service account, then bind as the
+// user). Directory accounts are matched by LDAP_ID_ATTR, linked to an
+// existing account with the same email on first sign-in, or created. Their
+// local password is never accepted, so the directory stays the source of
+// truth; accounts without a directory entry keep signing in locally.
+//
+// SyncLDAPUsers mirrors the directory periodically: it creates accounts,
+// updates names, emails and mapped roles, disables accounts that left the
+// directory (or LDAP_ALLOWED_GROUPS) and re-enables them when they return.
+// LDAP_SPACE_GROUPS grants space membership by group, and groups set to
+// follow a directory group get its members; the sync only removes
+// memberships it granted.
+
+const spaceMemberSourceLDAP = "ldap"
+
+var (
+	errDirectoryNotAllowed = errors.New("not a member of an allowed group")
+	errDirectoryNoEmail    = errors.New("directory entry has no email address")
+	errDirectoryEmailTaken = errors.New("email belongs to an account linked to another directory entry")
+)
+
+// NewDirectory returns the configured directory, or nil when LDAP_URL is
+// unset or the TLS settings cannot be loaded.
+func NewDirectory(cfg *config.Config) *directory.Directory {
+	if cfg.LDAPURL == "" {
+		return nil
+	}
+	tc := &tls.Config{
+		MinVersion:         tls.VersionTLS12,
+		InsecureSkipVerify: cfg.LDAPTLSSkipVerify, // #nosec G402 -- opt-in via LDAP_TLS_SKIP_VERIFY, warned about at startup
+	}
+	if cfg.LDAPCACert != "" {
+		pem, err := os.ReadFile(cfg.LDAPCACert)
+		if err != nil {
+			slog.Error("LDAP disabled: cannot read LDAP_CA_CERT", "path", cfg.LDAPCACert, "error", err)
+			return nil
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			slog.Error("LDAP disabled: LDAP_CA_CERT contains no PEM certificates", "path", cfg.LDAPCACert)
+			return nil
+		}
+		tc.RootCAs = pool
+	}
+	return directory.New(directory.Config{
+		URL:          cfg.LDAPURL,
+		StartTLS:     cfg.LDAPStartTLS,
+		TLS:          tc,
+		BindDN:       cfg.LDAPBindDN,
+		BindPassword: cfg.LDAPBindPassword,
+		BaseDN:       cfg.LDAPBaseDN,
+		UserFilter:   cfg.LDAPUserFilter,
+		IDAttr:       cfg.LDAPIDAttr,
+		NameAttr:     cfg.LDAPNameAttr,
+		EmailAttr:    cfg.LDAPEmailAttr,
+		GroupAttr:    cfg.LDAPGroupAttr,
+	})
+}
+
+// ldapRole maps directory groups to a role. ok is false when no role
+// mapping is configured.
+func ldapRole(cfg *config.Config, groups []string) (role string, ok bool) {
+	if len(cfg.LDAPOwnerGroups) == 0 && len(cfg.LDAPAdminGroups) == 0 {
+		return "", false
+	}
+	switch {
+	case directory.InGroup(groups, cfg.LDAPOwnerGroups):
+		return "owner", true
+	case directory.InGroup(groups, cfg.LDAPAdminGroups):
+		return "admin", true
+	}
+	return "user", true
+}
+
+func ldapAllowed(cfg *config.Config, groups []string) bool {
+	return len(cfg.LDAPAllowedGroups) == 0 || directory.InGroup(groups, cfg.LDAPAllowedGroups)
+}
+
+// spaceGroup grants members of Group a Role in the space named Space.
+type spaceGroup struct {
+	Group string
+	Space string
+	Role  string
+}
+
+// parseSpaceGroups reads LDAP_SPACE_GROUPS: entries separated by ';', each
+// group:space[:role]. The role defaults to contributor.
+func parseSpaceGroups(s string) ([]spaceGroup, error) {
+	var out []spaceGroup
+	for _, e := range strings.Split(s, ";") {
+		if e = strings.TrimSpace(e); e == "" {
+			continue
+		}
+		fields := strings.Split(e, ":")
+		if len(fields) < 2 {
+			return nil, fmt.Errorf("LDAP_SPACE_GROUPS entry %q: want group:space[:role]", e)
+		}
+		m := spaceGroup{Group: strings.TrimSpace(fields[0]), Role: models.SpaceRoleContributor}
+		rest := fields[1:]
+		if last := strings.TrimSpace(rest[len(rest)-1]); len(rest) > 1 && validSpaceRoles[last] {
+			m.Role = last
+			rest = rest[:len(rest)-1]
+		}
+		m.Space = strings.TrimSpace(strings.Join(rest, ":"))
+		if m.Group == "" || m.Space == "" {
+			return nil, fmt.Errorf("LDAP_SPACE_GROUPS entry %q: want group:space[:role]", e)
+		}
+		out = append(out, m)
+	}
+	return out, nil
+}
+
+// provisionDirectoryUser finds, links or creates the account for a
+// directory entry and brings its name, email, role and disabled state in
+// line with the directory. change is "created", "linked", "updated" or "".
+func provisionDirectoryUser(db *gorm.DB, cfg *config.Config, entry *directory.User, ip string) (user *models.User, change string, err error) {
+	if entry.Email == "" {
+		return nil, "", errDirectoryNoEmail
+	}
+	name := strings.TrimSpace(entry.Name)
+	if name == "" {
+		name, _, _ = strings.Cut(entry.Email, "@")
+	}
+
+	var u models.User
+	err = db.Where("ldap_id = ?", entry.ID).First(&u).Error
+	switch {
+	case err == nil:
+		updates := map[string]interface{}{}
+		if u.Name != name {
+			updates["name"] = name
+		}
+		if u.Email != entry.Email {
+			var taken int64
+			db.Model(&models.User{}).Where("email = ? AND id != ?", entry.Email, u.ID).Count(&taken)
+			if taken == 0 {
+				updates["email"] = entry.Email
+			} else {
+				slog.Warn("ldap: email change skipped, address in use", "user", u.Email, "new_email", entry.Email)
+			}
+		}
+		if len(updates) > 0 {
+			if err := db.Model(&u).Updates(updates).Error; err != nil {
+				return nil, "", err
+			}
+			u.Name = name
+			if email, ok := updates["email"].(string); ok {
+				u.Email = email
+			}
+			change = "updated"
+		}
+	case errors.Is(err, gorm.ErrRecordNotFound):
+		if err := db.Where("email = ?", entry.Email).First(&u).Error; err == nil {
+			if u.LDAPID != nil {
+				return nil, "", errDirectoryEmailTaken
+			}
+			if err := db.Model(&u).UpdateColumn("ldap_id", entry.ID).Error; err != nil {
+				return nil, "", err
+			}
+			change = "linked"
+			uid := u.ID
+			LogAudit(db, AuditEntry{
+				UserID:    &uid,
+				UserName:  u.Name,
+				UserEmail: u.Email,
+				Action:    "auth.ldap_link",
+				IPAddress: ip,
+				Metadata:  models.JSONB{"dn": entry.DN},
+			})
+		} else {
+			created, err := createDirectoryUser(db, cfg, entry, name, ip)
+			if err != nil {
+				return nil, "", err
+			}
+			return created, "created", nil
+		}
+	default:
+		return nil, "", err
+	}
+
+	if u.DisabledAt != nil {
+		if err := db.Model(&u).UpdateColumn("disabled_at", nil).Error; err != nil {
+			return nil, "", err
+		}
+		u.DisabledAt = nil
+		logUserStatus(db, &u, "user.enable", ip)
+		if change == "" {
+			change = "updated"
+		}
+	}
+	if role, ok := ldapRole(cfg, entry.Groups); ok && role != u.Role {
+		applyMappedRole(db, &u, role, "ldap", ip)
+		if change == "" {
+			change = "updated"
+		}
+	}
+	return &u, change, nil
+}
+
+func createDirectoryUser(db *gorm.DB, cfg *config.Config, entry *directory.User, name, ip string) (*models.User, error) {
+	var userCount int64
+	db.Model(&models.User{}).Count(&userCount)
+	role := "user"
+	if mapped, ok := ldapRole(cfg, entry.Groups); ok {
+		role = mapped
+	}
+	if userCount == 0 {
+		role = "owner"
+	}
+	storageLimit := int64(10 * 1024 * 1024 * 1024) // 10 GiB default
+	if role == "admin" || role == "owner" {
+		storageLimit = 0 // unlimited
+	}
+	ldapID := entry.ID
+	user := &models.User{
+		ID:           uuid.New(),
+		Name:         name,
+		Email:        entry.Email,
+		PasswordHash: "", // signs in through the directory only
+		Role:         role,
+		StorageLimit: storageLimit,
+		LDAPID:       &ldapID,
+	}
+	if err := db.Select("id", "name", "email", "password_hash", "role", "storage_limit", "ldap_id").Create(user).Error; err != nil {
+		return nil, err
+	}
+	if role == "admin" || role == "owner" {
+		db.Model(user).UpdateColumn("storage_limit", 0)
+		user.StorageLimit = 0
+	}
+	// With LDAP_SPACE_GROUPS, directory groups decide space membership.
+	if cfg.LDAPSpaceGroups == "" {
+		AutoEnrollUserInSpaces(db, user.ID, user.Role)
+	}
+
+	uid := user.ID
+	LogAudit(db, AuditEntry{
+		UserID:    &uid,
+		UserName:  user.Name,
+		UserEmail: user.Email,
+		Action:    "user.register",
+		IPAddress: ip,
+		Metadata:  models.JSONB{"role": role, "method": "ldap"},
+	})
+	return user, nil
+}
+
+func logUserStatus(db *gorm.DB, user *models.User, action, ip string) {
+	uid := user.ID
+	LogAudit(db, AuditEntry{
+		UserID:       &uid,
+		UserName:     user.Name,
+		UserEmail:    user.Email,
+		Action:       action,
+		ResourceType: "user",
+		ResourceName: user.Name,
+		ResourceID:   user.ID.String(),
+		IPAddress:    ip,
+		Metadata:     models.JSONB{"source": "ldap"},
+	})
+}
+
+// directoryLogin signs in a directory user. handled is false when the
+// directory does not know the credentials, so the caller can try a local
+// account; dirErr reports a directory that could not be reached.
+func (h *AuthHandler) directoryLogin(w http.ResponseWriter, r *http.Request, login, password string) (handled bool, dirErr error) {
+	entry, err := h.directory.Authenticate(login, password)
+	if errors.Is(err, directory.ErrInvalidCredentials) {
+		return false, nil
+	}
+	if err != nil {
+		slog.Error("ldap sign-in failed", "login", login, "error", err)
+		return false, err
+	}
+
+	fail := func(status int, message, reason string) {
+		LogAudit(h.db, AuditEntry{
+			Action:    "auth.login_failed",
+			UserEmail: entry.Email,
+			IPAddress: auditIP(r),
+			Metadata:  models.JSONB{"method": "ldap", "reason": reason},
+		})
+		writeError(w, status, message)
+	}
+	if !ldapAllowed(h.cfg, entry.Groups) {
+		fail(http.StatusForbidden, "Your directory account is not allowed to sign in", errDirectoryNotAllowed.Error())
+		return true, nil
+	}
+	user, _, err := provisionDirectoryUser(h.db, h.cfg, entry, auditIP(r))
+	if err != nil {
+		slog.Warn("ldap sign-in rejected", "dn", entry.DN, "error", err)
+		if errors.Is(err, errDirectoryNoEmail) || errors.Is(err, errDirectoryEmailTaken) {
+			fail(http.StatusConflict, "Your directory account cannot be matched to a ZynqCloud account", err.Error())
+		} else {
+			fail(http.StatusInternalServerError, "Failed to sign in", err.Error())
+		}
+		return true, nil
+	}
+	syncUserGroups(h.db, models.GroupSourceLDAP, user.ID, directoryGroupMatcher(entry.Groups))
+
+	if h.needsSecondFactor(user) {
+		h.startLoginChallenge(w, r, user)
+		return true, nil
+	}
+	h.completeLogin(w, r, user, models.JSONB{"method": "ldap"}, nil)
+	return true, nil
+}
+
+// LDAPSyncResult counts what a directory sync changed.
+type LDAPSyncResult struct {
+	Users        int `json:"users"`
+	Created      int `json:"created"`
+	Linked       int `json:"linked"`
+	Updated      int `json:"updated"`
+	Disabled     int `json:"disabled"`
+	SpaceAdded   int `json:"spaceMembershipsAdded"`
+	SpaceRemoved int `json:"spaceMembershipsRemoved"`
+	GroupAdded   int `json:"groupMembershipsAdded"`
+	GroupRemoved int `json:"groupMembershipsRemoved"`
+}
+
+// SyncLDAPUsers mirrors the directory's users, roles and space groups.
+func SyncLDAPUsers(db *gorm.DB, dir *directory.Directory, cfg *config.Config) (LDAPSyncResult, error) {
+	var res LDAPSyncResult
+	mappings, err := parseSpaceGroups(cfg.LDAPSpaceGroups)
+	if err != nil {
+		return res, err
+	}
+	entries, err := dir.Users()
+	if err != nil {
+		return res, err
+	}
+	// An empty result is far more likely a broken filter or base DN than a
+	// directory without users; don't disable everyone over it.
+	if len(entries) == 0 {
+		return res, errors.New("directory returned no users; check LDAP_BASE_DN and LDAP_USER_FILTER")
+	}
+
+	active := make(map[uuid.UUID][]string) // user → groups
+	for i := range entries {
+		entry := &entries[i]
+		if !ldapAllowed(cfg, entry.Groups) {
+			continue
+		}
+		user, change, err := provisionDirectoryUser(db, cfg, entry, "")
+		if err != nil {
+			slog.Warn("ldap sync: entry skipped", "dn", entry.DN, "error", err)
+			continue
+		}
+		res.Users++
+		switch change {
+		case "created":
+			res.Created++
+		case "linked":
+			res.Linked++
+		case "updated":
+			res.Updated++
+		}
+		active[user.ID] = entry.Groups
+	}
+
+	var linked []models.User
+	if err := db.Where("ldap_id IS NOT NULL AND disabled_at IS NULL").Find(&linked).Error; err != nil {
+		return res, err
+	}
+	for i := range linked {
+		u := &linked[i]
+		if _, ok := active[u.ID]; ok {
+			continue
+		}
+		if u.Role == "owner" {
+			var owners int64
+			db.Model(&models.User{}).Where("role = ? AND disabled_at IS NULL", "owner").Count(&owners)
+			if owners <= 1 {
+				slog.Warn("ldap sync: not disabling the last owner", "user", u.Email)
+				continue
+			}
+		}
+		if err := db.Model(u).UpdateColumn("disabled_at", time.Now()).Error; err != nil {
+			return res, err
+		}
+		revokeUserSessions(db, u.ID, uuid.Nil)
+		logUserStatus(db, u, "user.disable", "")
+		res.Disabled++
+	}
+
+	if len(mappings) > 0 {
+		added, removed, err := syncSpaceGroups(db, mappings, active)
+		res.SpaceAdded, res.SpaceRemoved = added, removed
+		if err != nil {
+			return res, err
+		}
+	}
+
+	inGroup := make(map[uuid.UUID]func(string) bool, len(active))
+	for userID, groups := range active {
+		inGroup[userID] = directoryGroupMatcher(groups)
+	}
+	added, removed, err := syncGroupMembers(db, models.GroupSourceLDAP, inGroup, true)
+	res.GroupAdded, res.GroupRemoved = added, removed
+	return res, err
+}
+
+// directoryGroupMatcher reports whether a directory entry with groups
+// belongs to a group's sync group, a DN or CN.
+func directoryGroupMatcher(groups []string) func(string) bool {
+	return func(syncGroup string) bool {
+		return directory.InGroup(groups, []string{syncGroup})
+	}
+}
+
+// syncSpaceGroups grants the memberships mappings call for and removes
+// directory-granted memberships that no longer apply. Memberships added by
+// hand are left as they are.
+func syncSpaceGroups(db *gorm.DB, mappings []spaceGroup, active map[uuid.UUID][]string) (added, removed int, err error) {
+	type key struct{ space, user uuid.UUID }
+	want := make(map[key]string)
+	for _, m := range mappings {
+		var space models.Space
+		if err := db.Where("name = ?", m.Space).First(&space).Error; err != nil {
+			slog.Warn("ldap sync: space in LDAP_SPACE_GROUPS not found", "space", m.Space)
+			continue
+		}
+		for userID, groups := range active {
+			if !directory.InGroup(groups, []string{m.Group}) {
+				continue
+			}
+			k := key{space.ID, userID}
+			if spaceRoleRank[m.Role] > spaceRoleRank[want[k]] {
+				want[k] = m.Role
+			}
+		}
+	}
+
+	var synced []models.SpaceMember
+	if err := db.Where("source = ?", spaceMemberSourceLDAP).Find(&synced).Error; err != nil {
+		return 0, 0, err
+	}
+	current := make(map[key]string, len(synced))
+	for _, m := range synced {
+		k := key{m.SpaceID, m.UserID}
+		role, ok := want[k]
+		switch {
+		case !ok:
+			if err := db.Where("space_id = ? AND user_id = ?", m.SpaceID, m.UserID).Delete(&models.SpaceMember{}).Error; err != nil {
+				return added, removed, err
+			}
+			removed++
+		case role != m.Role:
+			db.Model(&models.SpaceMember{}).Where("space_id = ? AND user_id = ?", m.SpaceID, m.UserID).Update("role", role)
+		}
+		current[k] = role
+	}
+
+	source := spaceMemberSourceLDAP
+	for k, role := range want {
+		if _, ok := current[k]; ok {
+			continue
+		}
+		m := models.SpaceMember{SpaceID: k.space, UserID: k.user, Role: role, Source: &source}
+		// Existing hand-made memberships win.
+		tx := db.Clauses(clause.OnConflict{DoNothing: true}).Create(&m)
+		if tx.Error != nil {
+			return added, removed, tx.Error
+		}
+		if tx.RowsAffected > 0 {
+			added++
+		}
+	}
+	return added, removed, nil
+}
+
+// RunLDAPSyncPeriodic starts a background goroutine that calls
+// SyncLDAPUsers once at startup and then on every interval until ctx is
+// cancelled.
+func RunLDAPSyncPeriodic(ctx context.Context, db *gorm.DB, dir *directory.Directory, cfg *config.Config, interval time.Duration, logger *slog.Logger) <-chan struct{} {
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+
+		run := func() {
+			res, err := SyncLDAPUsers(db, dir, cfg)
+			if err != nil {
+				logger.Error("ldap sync failed", "error", err)
+			} else {
+				logger.Info("ldap sync: cycle complete", "users", res.Users, "created", res.Created,
+					"updated", res.Updated, "disabled", res.Disabled)
+			}
+		}
+		run()
+
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				run()
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	return done
+}
+
+// POST /api/v1/admin/ldap/sync
+func (h *AuthHandler) SyncLDAP(w http.ResponseWriter, r *http.Request) {
+	if h.directory == nil {
+		writeError(w, http.StatusNotFound, "LDAP is not configured")
+		return
+	}
+	caller, ok := h.currentUser(r)
+	if !ok {
+		writeError(w, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+	res, err := SyncLDAPUsers(h.db, h.directory, h.cfg)
+	if err != nil {
+		slog.Error("ldap sync failed", "error", err)
+		writeError(w, http.StatusBadGateway, "Directory sync failed: "+err.Error())
+		return
+	}
+	uid := caller.ID
+	LogAudit(h.db, AuditEntry{
+		UserID:    &uid,
+		UserName:  caller.Name,
+		UserEmail: caller.Email,
+		Action:    "ldap.sync",
+		IPAddress: auditIP(r),
+		Metadata: models.JSONB{
+			"users": res.Users, "created": res.Created, "linked": res.Linked, "updated": res.Updated,
+			"disabled": res.Disabled, "space_added": res.SpaceAdded, "space_removed": res.SpaceRemoved,
+			"group_added": res.GroupAdded, "group_removed": res.GroupRemoved,
+		},
+	})
+	writeJSON(w, http.StatusOK, res)
+}
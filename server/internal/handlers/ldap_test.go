@@ -0,0 +1,75 @@
+package handlers
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/zynqcloud/api/internal/config"
+)
+
+func TestParseSpaceGroups(t *testing.T) {
+	got, err := parseSpaceGroups(" engineering:Engineering ; cn=design,ou=groups,dc=example,dc=com:Design: viewer;ops:Team: Ops:admin;")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []spaceGroup{
+		{"engineering", "Engineering", "contributor"},
+		{"cn=design,ou=groups,dc=example,dc=com", "Design", "viewer"},
+		{"ops", "Team: Ops", "admin"},
+	}
+	if len(got) != len(want) {
+		t.Fatalf("got %+v", got)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Errorf("entry %d = %+v, want %+v", i, got[i], want[i])
+		}
+	}
+
+	// A trailing word that is not a role belongs to the space name.
+	if got, _ := parseSpaceGroups("qa:Quality:Assurance"); len(got) != 1 || got[0].Space != "Quality:Assurance" || got[0].Role != "contributor" {
+		t.Errorf("got %+v", got)
+	}
+	for _, bad := range []string{"engineering", ":Engineering", "engineering:"} {
+		if _, err := parseSpaceGroups(bad); err == nil {
+			t.Errorf("%q accepted", bad)
+		}
+	}
+}
+
+func TestLDAPRole(t *testing.T) {
+	groups := []string{"cn=zynq-admins,ou=groups,dc=example,dc=com", "cn=staff,ou=groups,dc=example,dc=com"}
+	cfg := &config.Config{}
+	if _, ok := ldapRole(cfg, groups); ok {
+		t.Error("role mapped without LDAP_OWNER_GROUPS or LDAP_ADMIN_GROUPS")
+	}
+	cfg.LDAPAdminGroups = []string{"zynq-admins"}
+	if role, _ := ldapRole(cfg, groups); role != "admin" {
+		t.Errorf("role = %q, want admin", role)
+	}
+	cfg.LDAPOwnerGroups = []string{"cn=Staff,ou=Groups,dc=example,dc=com"}
+	if role, _ := ldapRole(cfg, groups); role != "owner" {
+		t.Errorf("role = %q, want owner", role)
+	}
+	if role, _ := ldapRole(cfg, nil); role != "user" {
+		t.Errorf("role = %q, want user", role)
+	}
+
+	if !ldapAllowed(cfg, nil) {
+		t.Error("everyone should be allowed without LDAP_ALLOWED_GROUPS")
+	}
+	cfg.LDAPAllowedGroups = []string{"staff"}
+	if !ldapAllowed(cfg, groups) || ldapAllowed(cfg, []string{"cn=guests,dc=example,dc=com"}) {
+		t.Error("LDAP_ALLOWED_GROUPS not applied")
+	}
+}
+
+func TestNewDirectoryBadCA(t *testing.T) {
+	if NewDirectory(&config.Config{}) != nil {
+		t.Error("directory configured without LDAP_URL")
+	}
+	cfg := &config.Config{LDAPURL: "ldaps://ldap.example.com", LDAPCACert: filepath.Join(t.TempDir(), "missing.pem")}
+	if NewDirectory(cfg) != nil {
+		t.Error("directory configured with an unreadable CA file")
+	}
+}
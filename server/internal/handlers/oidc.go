@@ -0,0 +1,398 @@
+package handlers
+
+import (
+	"context"
+	"crypto/subtle"
+	"errors"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
+	"github.com/zynqcloud/api/internal/config"
+	"github.com/zynqcloud/api/internal/models"
+	"github.com/zynqcloud/api/internal/oidc"
+	"gorm.io/gorm"
+)
+
+// Single sign-on (OpenID Connect)
+//
+// With OIDC_ISSUER set, GET /auth/oidc/login sends the browser to the
+// provider (authorization code flow with PKCE) and GET /auth/oidc/callback
+// signs the user in with the same jid cookie as a password login, then
+// redirects to the web app. State, nonce and PKCE verifier travel in a
+// ten-minute cookie signed with a key derived from JWT_SECRET.
+//
+// Accounts are matched by the provider's issuer and subject. On first
+// sign-in an existing account with the same verified email is linked, or a
+// new one is created and enrolled in spaces like a registration. When
+// OIDC_OWNER_GROUPS or OIDC_ADMIN_GROUPS is set, the role follows the IdP
+// groups at every sign-in. Local TOTP is not asked for: the provider is the
+// source of truth for SSO accounts and enforces its own MFA.
+
+const (
+	oidcStateCookie = "oidc_state"
+	oidcStateTTL    = 10 * time.Minute
+	oidcStateAud    = "oidc-state"
+	oidcHTTPTimeout = 10 * time.Second
+)
+
+var (
+	errOIDCNoEmail       = errors.New("identity provider did not return an email address")
+	errOIDCEmailTaken    = errors.New("email belongs to an account linked to another identity")
+	errOIDCEmailUnproven = errors.New("email not verified by the identity provider")
+	errOIDCNotAllowed    = errors.New("not a member of an allowed group")
+)
+
+// oidcClient discovers the provider on first use, so the API starts even
+// while the IdP is unreachable.
+type oidcClient struct {
+	issuer string
+	cfg    *oidc.Config
+	http   *http.Client
+
+	mu       sync.Mutex
+	provider *oidc.Provider
+}
+
+func newOIDCClient(cfg *config.Config) *oidcClient {
+	if cfg.OIDCIssuer == "" || cfg.OIDCClientID == "" {
+		return nil
+	}
+	return &oidcClient{
+		issuer: cfg.OIDCIssuer,
+		cfg: &oidc.Config{
+			ClientID:     cfg.OIDCClientID,
+			ClientSecret: cfg.OIDCClientSecret,
+			RedirectURL:  cfg.OIDCRedirectURL,
+			Scopes:       cfg.OIDCScopes,
+		},
+		http: &http.Client{Timeout: oidcHTTPTimeout},
+	}
+}
+
+func (c *oidcClient) discover(ctx context.Context) (*oidc.Provider, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.provider != nil {
+		return c.provider, nil
+	}
+	p, err := oidc.Discover(ctx, c.http, c.issuer)
+	if err != nil {
+		return nil, err
+	}
+	c.provider = p
+	return p, nil
+}
+
+type oidcStateClaims struct {
+	State    string `json:"state"`
+	Nonce    string `json:"nonce"`
+	Verifier string `json:"verifier"`
+	Redirect string `json:"redirect"`
+	jwt.RegisteredClaims
+}
+
+func (h *AuthHandler) oidcStateKey() []byte {
+	return h.purposeKey("zynqcloud oidc state v1")
+}
+
+func (h *AuthHandler) setOIDCStateCookie(w http.ResponseWriter, value string, maxAge int) {
+	http.SetCookie(w, &http.Cookie{ // #nosec G124 -- Secure flag controlled by COOKIE_SECURE env var
+		Name:     oidcStateCookie,
+		Value:    value,
+		Path:     "/api/v1/auth/oidc",
+		MaxAge:   maxAge,
+		HttpOnly: true,
+		Secure:   h.cfg.CookieSecure,
+		// Lax: the provider sends the browser back with a top-level GET.
+		SameSite: http.SameSiteLaxMode,
+	})
+}
+
+// safeRedirect keeps post-login redirects on the web app.
+func safeRedirect(path string) string {
+	if !strings.HasPrefix(path, "/") || strings.HasPrefix(path, "//") || strings.HasPrefix(path, "/\\") {
+		return "/"
+	}
+	return path
+}
+
+// GET /api/v1/auth/oidc/login
+func (h *AuthHandler) OIDCLogin(w http.ResponseWriter, r *http.Request) {
+	if h.oidc == nil {
+		writeError(w, http.StatusNotFound, "Single sign-on is not configured")
+		return
+	}
+	p, err := h.oidc.discover(r.Context())
+	if err != nil {
+		slog.Error("oidc discovery failed", "issuer", h.oidc.issuer, "error", err)
+		writeError(w, http.StatusBadGateway, "Identity provider is unavailable")
+		return
+	}
+
+	var secrets [3]string
+	for i := range secrets {
+		if secrets[i], err = oidc.RandomString(); err != nil {
+			writeError(w, http.StatusInternalServerError, "Failed to start single sign-on")
+			return
+		}
+	}
+	state, nonce, verifier := secrets[0], secrets[1], secrets[2]
+	now := time.Now()
+	cookie, err := jwt.NewWithClaims(jwt.SigningMethodHS256, &oidcStateClaims{
+		State:    state,
+		Nonce:    nonce,
+		Verifier: verifier,
+		Redirect: safeRedirect(r.URL.Query().Get("redirect")),
+		RegisteredClaims: jwt.RegisteredClaims{
+			Audience:  jwt.ClaimStrings{oidcStateAud},
+			ExpiresAt: jwt.NewNumericDate(now.Add(oidcStateTTL)),
+			IssuedAt:  jwt.NewNumericDate(now),
+		},
+	}).SignedString(h.oidcStateKey())
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "Failed to start single sign-on")
+		return
+	}
+	h.setOIDCStateCookie(w, cookie, int(oidcStateTTL.Seconds()))
+	http.Redirect(w, r, p.AuthCodeURL(h.oidc.cfg, state, nonce, verifier), http.StatusFound)
+}
+
+// GET /api/v1/auth/oidc/callback
+//
+// Failures redirect to the web app's login page with ?error=sso_failed (or
+// sso_denied, sso_not_allowed, sso_email_taken, sso_disabled) instead of
+// returning JSON, since this is a browser navigation.
+func (h *AuthHandler) OIDCCallback(w http.ResponseWriter, r *http.Request) {
+	if h.oidc == nil {
+		writeError(w, http.StatusNotFound, "Single sign-on is not configured")
+		return
+	}
+	h.setOIDCStateCookie(w, "", -1)
+
+	if e := r.URL.Query().Get("error"); e != "" {
+		slog.Info("oidc sign-in refused by provider", "error", e, "description", r.URL.Query().Get("error_description"))
+		h.oidcFail(w, r, "sso_denied")
+		return
+	}
+	id, redirect, err := h.oidcIdentity(r)
+	if err != nil {
+		slog.Warn("oidc sign-in failed", "error", err)
+		h.oidcFail(w, r, "sso_failed")
+		return
+	}
+
+	user, err := h.provisionOIDCUser(r, id)
+	if err != nil {
+		slog.Warn("oidc sign-in rejected", "subject", id.Subject, "email", id.Email, "error", err)
+		LogAudit(h.db, AuditEntry{
+			Action:    "auth.login_failed",
+			UserEmail: id.Email,
+			IPAddress: auditIP(r),
+			Metadata:  models.JSONB{"method": "oidc", "reason": err.Error()},
+		})
+		code := "sso_failed"
+		switch {
+		case errors.Is(err, errOIDCNotAllowed):
+			code = "sso_not_allowed"
+		case errors.Is(err, errOIDCEmailTaken), errors.Is(err, errOIDCEmailUnproven):
+			code = "sso_email_taken"
+		}
+		h.oidcFail(w, r, code)
+		return
+	}
+
+	if _, _, err := h.issueSession(w, r, user, models.JSONB{"method": "oidc"}); err != nil {
+		code := "sso_failed"
+		if errors.Is(err, errAccountDisabled) {
+			code = "sso_disabled"
+		}
+		h.oidcFail(w, r, code)
+		return
+	}
+	http.Redirect(w, r, strings.TrimRight(h.cfg.FrontendURL, "/")+redirect, http.StatusFound)
+}
+
+func (h *AuthHandler) oidcFail(w http.ResponseWriter, r *http.Request, code string) {
+	http.Redirect(w, r, strings.TrimRight(h.cfg.FrontendURL, "/")+"/login?error="+url.QueryEscape(code), http.StatusFound)
+}
+
+// oidcIdentity completes the code flow for a callback request and returns
+// the verified identity and the path to send the user to.
+func (h *AuthHandler) oidcIdentity(r *http.Request) (*oidc.IDToken, string, error) {
+	c, err := r.Cookie(oidcStateCookie)
+	if err != nil {
+		return nil, "", errors.New("missing state cookie")
+	}
+	st := &oidcStateClaims{}
+	if _, err := jwt.ParseWithClaims(c.Value, st, func(*jwt.Token) (interface{}, error) {
+		return h.oidcStateKey(), nil
+	}, jwt.WithValidMethods([]string{jwt.SigningMethodHS256.Alg()}), jwt.WithAudience(oidcStateAud)); err != nil {
+		return nil, "", err
+	}
+	q := r.URL.Query()
+	if subtle.ConstantTimeCompare([]byte(q.Get("state")), []byte(st.State)) != 1 {
+		return nil, "", errors.New("state mismatch")
+	}
+
+	p, err := h.oidc.discover(r.Context())
+	if err != nil {
+		return nil, "", err
+	}
+	tok, err := p.Exchange(r.Context(), h.oidc.cfg, q.Get("code"), st.Verifier)
+	if err != nil {
+		return nil, "", err
+	}
+	id, err := p.Verify(r.Context(), h.oidc.cfg, tok.IDToken, st.Nonce)
+	if err != nil {
+		return nil, "", err
+	}
+	return id, safeRedirect(st.Redirect), nil
+}
+
+func intersects(a, b []string) bool {
+	for _, s := range a {
+		if slices.Contains(b, s) {
+			return true
+		}
+	}
+	return false
+}
+
+// oidcRole maps IdP groups to a role. ok is false when no role mapping is
+// configured, in which case roles are managed in ZynqCloud.
+func oidcRole(cfg *config.Config, groups []string) (role string, ok bool) {
+	if len(cfg.OIDCOwnerGroups) == 0 && len(cfg.OIDCAdminGroups) == 0 {
+		return "", false
+	}
+	switch {
+	case intersects(groups, cfg.OIDCOwnerGroups):
+		return "owner", true
+	case intersects(groups, cfg.OIDCAdminGroups):
+		return "admin", true
+	}
+	return "user", true
+}
+
+// provisionOIDCUser finds, links or creates the account for a verified
+// identity.
+func (h *AuthHandler) provisionOIDCUser(r *http.Request, id *oidc.IDToken) (*models.User, error) {
+	groups := id.StringsClaim(h.cfg.OIDCGroupsClaim)
+	if len(h.cfg.OIDCAllowedGroups) > 0 && !intersects(groups, h.cfg.OIDCAllowedGroups) {
+		return nil, errOIDCNotAllowed
+	}
+	issuer := h.oidc.issuer
+
+	var user models.User
+	err := h.db.Where("oidc_issuer = ? AND oidc_subject = ?", issuer, id.Subject).First(&user).Error
+	if err == nil {
+		h.syncOIDCRole(r, &user, groups)
+		return &user, nil
+	}
+	if !errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, err
+	}
+
+	email := strings.ToLower(strings.TrimSpace(id.Email))
+	if email == "" {
+		return nil, errOIDCNoEmail
+	}
+
+	// Link an existing local account. Only a verified email may claim one,
+	// or anyone able to set an address at the IdP could take it over.
+	if err := h.db.Where("email = ?", email).First(&user).Error; err == nil {
+		if !id.EmailVerified {
+			return nil, errOIDCEmailUnproven
+		}
+		if user.OIDCSubject != nil {
+			return nil, errOIDCEmailTaken
+		}
+		if err := h.db.Model(&user).Updates(map[string]interface{}{"oidc_issuer": issuer, "oidc_subject": id.Subject}).Error; err != nil {
+			return nil, err
+		}
+		uid := user.ID
+		LogAudit(h.db, AuditEntry{
+			UserID:    &uid,
+			UserName:  user.Name,
+			UserEmail: user.Email,
+			Action:    "auth.sso_link",
+			IPAddress: auditIP(r),
+			Metadata:  models.JSONB{"issuer": issuer},
+		})
+		h.syncOIDCRole(r, &user, groups)
+		return &user, nil
+	}
+
+	// Just-in-time provisioning.
+	var userCount int64
+	h.db.Model(&models.User{}).Count(&userCount)
+	role := "user"
+	if mapped, ok := oidcRole(h.cfg, groups); ok {
+		role = mapped
+	}
+	if userCount == 0 {
+		role = "owner"
+	}
+	name := strings.TrimSpace(id.Name)
+	if name == "" {
+		name, _, _ = strings.Cut(email, "@")
+	}
+	storageLimit := int64(10 * 1024 * 1024 * 1024) // 10 GiB default
+	if role == "admin" || role == "owner" {
+		storageLimit = 0 // unlimited
+	}
+	subject := id.Subject
+	user = models.User{
+		ID:           uuid.New(),
+		Name:         name,
+		Email:        email,
+		PasswordHash: "", // no local password; bcrypt never matches an empty hash
+		Role:         role,
+		StorageLimit: storageLimit,
+		OIDCIssuer:   &issuer,
+		OIDCSubject:  &subject,
+	}
+	if err := h.db.Select("id", "name", "email", "password_hash", "role", "storage_limit", "oidc_issuer", "oidc_subject").Create(&user).Error; err != nil {
+		return nil, err
+	}
+	if role == "admin" || role == "owner" {
+		h.db.Model(&user).UpdateColumn("storage_limit", 0)
+		user.StorageLimit = 0
+	}
+	AutoEnrollUserInSpaces(h.db, user.ID, user.Role)
+	syncUserGroups(h.db, models.GroupSourceOIDC, user.ID, oidcGroupMatcher(groups))
+
+	uid := user.ID
+	LogAudit(h.db, AuditEntry{
+		UserID:    &uid,
+		UserName:  user.Name,
+		UserEmail: user.Email,
+		Action:    "user.register",
+		IPAddress: auditIP(r),
+		Metadata:  models.JSONB{"role": role, "method": "oidc"},
+	})
+	return &user, nil
+}
+
+// syncOIDCRole applies the role the IdP groups map to, and the memberships
+// of groups that follow the groups claim.
+func (h *AuthHandler) syncOIDCRole(r *http.Request, user *models.User, groups []string) {
+	if role, ok := oidcRole(h.cfg, groups); ok {
+		applyMappedRole(h.db, user, role, "oidc", auditIP(r))
+	}
+	syncUserGroups(h.db, models.GroupSourceOIDC, user.ID, oidcGroupMatcher(groups))
+}
+
+// oidcGroupMatcher reports whether a sign-in with the groups claim groups
+// belongs to a group's sync group.
+func oidcGroupMatcher(groups []string) func(string) bool {
+	return func(syncGroup string) bool {
+		return slices.Contains(groups, syncGroup)
+	}
+}
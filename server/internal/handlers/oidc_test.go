@@ -0,0 +1,145 @@
+package handlers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/zynqcloud/api/internal/config"
+	"github.com/zynqcloud/api/internal/oidc/oidctest"
+)
+
+func testOIDCHandler(t *testing.T) (*AuthHandler, *oidctest.Server) {
+	t.Helper()
+	idp := oidctest.NewServer("zynq", "s3cret")
+	t.Cleanup(idp.Close)
+	cfg := &config.Config{
+		JWTSecret:        "test-secret-test-secret-test-secret",
+		FrontendURL:      "https://cloud.example.com",
+		OIDCIssuer:       idp.URL,
+		OIDCClientID:     "zynq",
+		OIDCClientSecret: "s3cret",
+		OIDCRedirectURL:  "https://cloud.example.com/api/v1/auth/oidc/callback",
+		OIDCScopes:       []string{"openid", "email", "profile"},
+	}
+	h := &AuthHandler{cfg: cfg, oidc: newOIDCClient(cfg)}
+	h.oidc.http = idp.Client()
+	return h, idp
+}
+
+// signIn starts a login, lets the mock provider authorize it and returns
+// the callback request the browser would make.
+func signIn(t *testing.T, h *AuthHandler, idp *oidctest.Server, redirect string) *http.Request {
+	t.Helper()
+	rec := httptest.NewRecorder()
+	h.OIDCLogin(rec, httptest.NewRequest(http.MethodGet, "/api/v1/auth/oidc/login?redirect="+url.QueryEscape(redirect), nil))
+	if rec.Code != http.StatusFound {
+		t.Fatalf("login: status %d: %s", rec.Code, rec.Body)
+	}
+	cookies := rec.Result().Cookies()
+	if len(cookies) != 1 || cookies[0].Name != oidcStateCookie || !cookies[0].HttpOnly {
+		t.Fatalf("login: unexpected cookies %v", cookies)
+	}
+
+	client := idp.Client()
+	client.CheckRedirect = func(*http.Request, []*http.Request) error { return http.ErrUseLastResponse }
+	resp, err := client.Get(rec.Header().Get("Location"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	back := resp.Header.Get("Location")
+	if !strings.HasPrefix(back, h.cfg.OIDCRedirectURL+"?") {
+		t.Fatalf("provider redirected to %q", back)
+	}
+	req := httptest.NewRequest(http.MethodGet, back, nil)
+	req.AddCookie(cookies[0])
+	return req
+}
+
+func TestOIDCIdentity(t *testing.T) {
+	h, idp := testOIDCHandler(t)
+	idp.Claims = map[string]any{"sub": "u-1", "email": "Ada@Example.com", "email_verified": true}
+
+	id, redirect, err := h.oidcIdentity(signIn(t, h, idp, "/files/docs"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if id.Subject != "u-1" || id.Email != "Ada@Example.com" || redirect != "/files/docs" {
+		t.Errorf("identity %+v, redirect %q", id, redirect)
+	}
+
+	// Off-site redirects are dropped.
+	_, redirect, err = h.oidcIdentity(signIn(t, h, idp, "//evil.example.net"))
+	if err != nil || redirect != "/" {
+		t.Errorf("redirect = %q, %v; want /", redirect, err)
+	}
+}
+
+func TestOIDCIdentityRejectsForgedCallback(t *testing.T) {
+	h, idp := testOIDCHandler(t)
+	idp.Claims = map[string]any{"sub": "u-1"}
+
+	// State from another login attempt.
+	req := signIn(t, h, idp, "/")
+	q := req.URL.Query()
+	q.Set("state", "attacker-state")
+	req.URL.RawQuery = q.Encode()
+	if _, _, err := h.oidcIdentity(req); err == nil {
+		t.Error("callback with mismatched state accepted")
+	}
+
+	// No state cookie: the login was not started in this browser.
+	req = signIn(t, h, idp, "/")
+	bare := httptest.NewRequest(http.MethodGet, req.URL.String(), nil)
+	if _, _, err := h.oidcIdentity(bare); err == nil {
+		t.Error("callback without state cookie accepted")
+	}
+
+	// A state cookie signed for a different purpose is rejected.
+	other := &AuthHandler{cfg: &config.Config{JWTSecret: "another-secret-another-secret"}, oidc: h.oidc}
+	if _, _, err := other.oidcIdentity(signIn(t, h, idp, "/")); err == nil {
+		t.Error("state cookie accepted under a different key")
+	}
+}
+
+func TestOIDCRole(t *testing.T) {
+	cfg := &config.Config{}
+	if _, ok := oidcRole(cfg, []string{"admins"}); ok {
+		t.Error("role mapped without OIDC_OWNER_GROUPS or OIDC_ADMIN_GROUPS")
+	}
+
+	cfg.OIDCOwnerGroups = []string{"it-owners"}
+	cfg.OIDCAdminGroups = []string{"admins"}
+	cases := []struct {
+		groups []string
+		want   string
+	}{
+		{nil, "user"},
+		{[]string{"staff"}, "user"},
+		{[]string{"staff", "admins"}, "admin"},
+		{[]string{"admins", "it-owners"}, "owner"},
+	}
+	for _, c := range cases {
+		if got, ok := oidcRole(cfg, c.groups); !ok || got != c.want {
+			t.Errorf("oidcRole(%v) = %q, %v; want %q", c.groups, got, ok, c.want)
+		}
+	}
+}
+
+func TestPasswordLoginDisabled(t *testing.T) {
+	h := &AuthHandler{cfg: &config.Config{PasswordLogin: false}}
+	rec := httptest.NewRecorder()
+	h.Login(rec, httptest.NewRequest(http.MethodPost, "/api/v1/auth/login", strings.NewReader(`{"email":"a@b.c","password":"x"}`)))
+	if rec.Code != http.StatusForbidden {
+		t.Errorf("password login: status %d, want 403", rec.Code)
+	}
+
+	rec = httptest.NewRecorder()
+	(&AuthHandler{cfg: &config.Config{}}).OIDCLogin(rec, httptest.NewRequest(http.MethodGet, "/api/v1/auth/oidc/login", nil))
+	if rec.Code != http.StatusNotFound {
+		t.Errorf("unconfigured SSO: status %d, want 404", rec.Code)
+	}
+}
@@ -0,0 +1,481 @@
+package handlers
+
+import (
+	"bytes"
+	"crypto/rand"
+	"errors"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/google/uuid"
+	"github.com/zynqcloud/api/internal/models"
+	"github.com/zynqcloud/api/internal/webauthn"
+	"gorm.io/gorm"
+)
+
+// Passkeys
+//
+// Users can register WebAuthn credentials (passkeys) under /auth/passkeys and
+// sign in with them in two ways:
+//
+//   - Instead of a password: POST /auth/passkeys/login/begin with an empty
+//     body offers every discoverable passkey for the site. The assertion must
+//     carry user verification (PIN or biometric), which makes it two factors
+//     on its own, so no TOTP challenge follows.
+//   - As the second factor after a password: begin with the challengeToken
+//     from POST /auth/login. Only that user's passkeys are offered and user
+//     presence is enough.
+//
+// Either way a successful assertion goes through completeLogin, like a
+// password login. Each ceremony's challenge is held in memory for five
+// minutes and can be finished once. Passkeys are bound to WEBAUTHN_RP_ID and
+// accepted only from WEBAUTHN_ORIGINS.
+
+const (
+	passkeyRPName        = "ZynqCloud"
+	passkeyCeremonyTTL   = 5 * time.Minute
+	maxPasskeyCeremonies = 10000
+	maxPasskeysPerUser   = 25
+)
+
+var errPasskeyCeremony = errors.New("passkey ceremony expired or unknown")
+
+// passkeyCeremony is a registration or sign-in waiting for the browser's
+// response.
+type passkeyCeremony struct {
+	challenge []byte
+	register  bool
+	// userID is the registering user, or the user a second-factor sign-in
+	// is for. It is uuid.Nil for a passwordless sign-in.
+	userID  uuid.UUID
+	expires time.Time
+}
+
+func (c *passkeyCeremony) secondFactor() bool {
+	return !c.register && c.userID != uuid.Nil
+}
+
+// passkeyCeremonies holds the ceremonies in progress, keyed by challenge.
+type passkeyCeremonies struct {
+	mu sync.Mutex
+	m  map[string]*passkeyCeremony
+}
+
+func newPasskeyCeremonies() *passkeyCeremonies {
+	return &passkeyCeremonies{m: make(map[string]*passkeyCeremony)}
+}
+
+// start records c under a new random challenge and returns the challenge.
+func (s *passkeyCeremonies) start(c passkeyCeremony) ([]byte, error) {
+	challenge := make([]byte, webauthn.ChallengeLength)
+	if _, err := rand.Read(challenge); err != nil {
+		return nil, err
+	}
+	c.challenge = challenge
+	c.expires = time.Now().Add(passkeyCeremonyTTL)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	now := time.Now()
+	for k, v := range s.m {
+		if now.After(v.expires) {
+			delete(s.m, k)
+		}
+	}
+	if len(s.m) >= maxPasskeyCeremonies {
+		return nil, errors.New("too many passkey ceremonies in progress")
+	}
+	s.m[string(challenge)] = &c
+	return challenge, nil
+}
+
+// take removes and returns the ceremony a client response was made for.
+func (s *passkeyCeremonies) take(clientDataJSON []byte, register bool) (*passkeyCeremony, error) {
+	challenge, err := webauthn.Challenge(clientDataJSON)
+	if err != nil {
+		return nil, errPasskeyCeremony
+	}
+	s.mu.Lock()
+	c, ok := s.m[string(challenge)]
+	delete(s.m, string(challenge))
+	s.mu.Unlock()
+	if !ok || c.register != register || time.Now().After(c.expires) {
+		return nil, errPasskeyCeremony
+	}
+	return c, nil
+}
+
+func (h *AuthHandler) relyingParty() *webauthn.RelyingParty {
+	return &webauthn.RelyingParty{ID: h.cfg.WebAuthnRPID, Name: passkeyRPName, Origins: h.cfg.WebAuthnOrigins}
+}
+
+func passkeyTimeout() int {
+	return int(passkeyCeremonyTTL.Milliseconds())
+}
+
+func passkeyDescriptors(creds []models.WebAuthnCredential) []webauthn.CredentialDescriptor {
+	out := make([]webauthn.CredentialDescriptor, len(creds))
+	for i, c := range creds {
+		out[i] = webauthn.CredentialDescriptor{Type: "public-key", ID: c.CredentialID}
+		if c.Transports != "" {
+			out[i].Transports = strings.Split(c.Transports, ",")
+		}
+	}
+	return out
+}
+
+func loadPasskeys(db *gorm.DB, userID uuid.UUID) ([]models.WebAuthnCredential, error) {
+	var creds []models.WebAuthnCredential
+	err := db.Where("user_id = ?", userID).Order("created_at DESC").Find(&creds).Error
+	return creds, err
+}
+
+func hasPasskey(db *gorm.DB, userID uuid.UUID) bool {
+	var n int64
+	db.Model(&models.WebAuthnCredential{}).Where("user_id = ?", userID).Count(&n)
+	return n > 0
+}
+
+// passkeyCreationOptions starts a registration for user. existing are the
+// user's current passkeys, which the browser will refuse to register again.
+func (h *AuthHandler) passkeyCreationOptions(user *models.User, existing []models.WebAuthnCredential) (*webauthn.CreationOptions, error) {
+	challenge, err := h.passkeys.start(passkeyCeremony{register: true, userID: user.ID})
+	if err != nil {
+		return nil, err
+	}
+	entity := webauthn.UserEntity{ID: user.ID[:], Name: user.Email, DisplayName: user.Name}
+	return h.relyingParty().CreationOptions(challenge, entity, passkeyDescriptors(existing), passkeyTimeout()), nil
+}
+
+// verifyPasskeyRegistration checks a registration response from userID
+// against the ceremony it answers.
+func (h *AuthHandler) verifyPasskeyRegistration(userID uuid.UUID, resp *webauthn.CreationResponse) (*webauthn.Credential, error) {
+	c, err := h.passkeys.take(resp.Response.ClientDataJSON, true)
+	if err != nil {
+		return nil, err
+	}
+	if c.userID != userID {
+		return nil, errPasskeyCeremony
+	}
+	return h.relyingParty().VerifyRegistration(c.challenge, resp, false)
+}
+
+// passkeyRequestOptions starts a sign-in. With a user ID it is a second
+// factor for that user and allow lists their passkeys; without one any
+// discoverable passkey may answer, and it must verify the user.
+func (h *AuthHandler) passkeyRequestOptions(userID uuid.UUID, allow []models.WebAuthnCredential) (*webauthn.RequestOptions, error) {
+	challenge, err := h.passkeys.start(passkeyCeremony{userID: userID})
+	if err != nil {
+		return nil, err
+	}
+	uv := "required"
+	if userID != uuid.Nil {
+		uv = "discouraged"
+	}
+	return h.relyingParty().RequestOptions(challenge, passkeyDescriptors(allow), uv, passkeyTimeout()), nil
+}
+
+// verifyPasskeyAssertion checks a sign-in response made with cred against
+// the ceremony it answers.
+func (h *AuthHandler) verifyPasskeyAssertion(resp *webauthn.AssertionResponse, cred *models.WebAuthnCredential) (*passkeyCeremony, *webauthn.Assertion, error) {
+	c, err := h.passkeys.take(resp.Response.ClientDataJSON, false)
+	if err != nil {
+		return nil, nil, err
+	}
+	if c.userID != uuid.Nil && c.userID != cred.UserID {
+		return nil, nil, webauthn.ErrVerification
+	}
+	if handle := resp.Response.UserHandle; len(handle) > 0 && !bytes.Equal(handle, cred.UserID[:]) {
+		return nil, nil, webauthn.ErrVerification
+	}
+	a, err := h.relyingParty().VerifyAssertion(c.challenge, resp, cred.PublicKey, uint32(cred.SignCount), !c.secondFactor()) // #nosec G115 -- stored from a uint32
+	if err != nil {
+		return nil, nil, err
+	}
+	return c, a, nil
+}
+
+func validPasskeyName(name string) (string, bool) {
+	name = strings.TrimSpace(name)
+	if name == "" {
+		name = "Passkey"
+	}
+	return name, len(name) <= 100
+}
+
+// ── Registration and management ─────────────────────────────────────────────
+
+// GET /api/v1/auth/passkeys
+func (h *AuthHandler) ListPasskeys(w http.ResponseWriter, r *http.Request) {
+	user, ok := h.currentUser(r)
+	if !ok {
+		writeError(w, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+	creds, err := loadPasskeys(h.db, user.ID)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "Failed to list passkeys")
+		return
+	}
+	writeJSON(w, http.StatusOK, creds)
+}
+
+// POST /api/v1/auth/passkeys/register/begin
+//
+// Returns the options for navigator.credentials.create().
+func (h *AuthHandler) BeginPasskeyRegistration(w http.ResponseWriter, r *http.Request) {
+	user, ok := h.currentUser(r)
+	if !ok {
+		writeError(w, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+	existing, err := loadPasskeys(h.db, user.ID)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "Failed to start passkey registration")
+		return
+	}
+	if len(existing) >= maxPasskeysPerUser {
+		writeError(w, http.StatusBadRequest, "Passkey limit reached — remove one first")
+		return
+	}
+	opts, err := h.passkeyCreationOptions(user, existing)
+	if err != nil {
+		writeError(w, http.StatusServiceUnavailable, "Failed to start passkey registration")
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]interface{}{"publicKey": opts})
+}
+
+// POST /api/v1/auth/passkeys/register/finish
+func (h *AuthHandler) FinishPasskeyRegistration(w http.ResponseWriter, r *http.Request) {
+	user, ok := h.currentUser(r)
+	if !ok {
+		writeError(w, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+	var req struct {
+		Name       string                    `json:"name"`
+		Credential webauthn.CreationResponse `json:"credential"`
+	}
+	if err := readJSON(r, &req); err != nil {
+		writeError(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+	name, ok := validPasskeyName(req.Name)
+	if !ok {
+		writeError(w, http.StatusBadRequest, "name must be at most 100 characters")
+		return
+	}
+
+	cred, err := h.verifyPasskeyRegistration(user.ID, &req.Credential)
+	if errors.Is(err, errPasskeyCeremony) {
+		writeError(w, http.StatusBadRequest, "Passkey registration expired — start again")
+		return
+	}
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "Passkey could not be verified")
+		return
+	}
+
+	var taken int64
+	h.db.Model(&models.WebAuthnCredential{}).Where("credential_id = ?", cred.ID).Count(&taken)
+	if taken > 0 {
+		writeError(w, http.StatusConflict, "This passkey is already registered")
+		return
+	}
+	row := &models.WebAuthnCredential{
+		ID:             uuid.New(),
+		UserID:         user.ID,
+		Name:           name,
+		CredentialID:   cred.ID,
+		PublicKey:      cred.PublicKey,
+		SignCount:      int64(cred.SignCount),
+		AAGUID:         cred.AAGUID,
+		Transports:     strings.Join(cred.Transports, ","),
+		BackupEligible: cred.BackupEligible,
+		BackedUp:       cred.BackedUp,
+	}
+	if err := h.db.Create(row).Error; err != nil {
+		writeError(w, http.StatusInternalServerError, "Failed to save passkey")
+		return
+	}
+
+	h.auditPasskey(r, user, "auth.passkey_add", row)
+	writeJSON(w, http.StatusCreated, row)
+}
+
+// PATCH /api/v1/auth/passkeys/{id}
+func (h *AuthHandler) RenamePasskey(w http.ResponseWriter, r *http.Request) {
+	user, ok := h.currentUser(r)
+	if !ok {
+		writeError(w, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+	row, ok := h.ownPasskey(w, r, user.ID)
+	if !ok {
+		return
+	}
+	var req struct {
+		Name string `json:"name"`
+	}
+	if err := readJSON(r, &req); err != nil {
+		writeError(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+	name, ok := validPasskeyName(req.Name)
+	if !ok || strings.TrimSpace(req.Name) == "" {
+		writeError(w, http.StatusBadRequest, "name must be 1 to 100 characters")
+		return
+	}
+	if err := h.db.Model(row).Update("name", name).Error; err != nil {
+		writeError(w, http.StatusInternalServerError, "Failed to rename passkey")
+		return
+	}
+	h.auditPasskey(r, user, "auth.passkey_rename", row)
+	writeJSON(w, http.StatusOK, row)
+}
+
+// DELETE /api/v1/auth/passkeys/{id}
+func (h *AuthHandler) DeletePasskey(w http.ResponseWriter, r *http.Request) {
+	user, ok := h.currentUser(r)
+	if !ok {
+		writeError(w, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+	row, ok := h.ownPasskey(w, r, user.ID)
+	if !ok {
+		return
+	}
+	if err := h.db.Delete(row).Error; err != nil {
+		writeError(w, http.StatusInternalServerError, "Failed to remove passkey")
+		return
+	}
+	h.auditPasskey(r, user, "auth.passkey_remove", row)
+	writeJSON(w, http.StatusOK, map[string]string{"message": "Passkey removed"})
+}
+
+func (h *AuthHandler) ownPasskey(w http.ResponseWriter, r *http.Request, userID uuid.UUID) (*models.WebAuthnCredential, bool) {
+	id, err := uuid.Parse(chi.URLParam(r, "id"))
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "Invalid passkey ID")
+		return nil, false
+	}
+	var row models.WebAuthnCredential
+	if err := h.db.Where("id = ? AND user_id = ?", id, userID).First(&row).Error; err != nil {
+		writeError(w, http.StatusNotFound, "Passkey not found")
+		return nil, false
+	}
+	return &row, true
+}
+
+func (h *AuthHandler) auditPasskey(r *http.Request, user *models.User, action string, row *models.WebAuthnCredential) {
+	uid := user.ID
+	LogAudit(h.db, AuditEntry{
+		UserID:       &uid,
+		UserName:     user.Name,
+		UserEmail:    user.Email,
+		Action:       action,
+		ResourceType: "passkey",
+		ResourceName: row.Name,
+		ResourceID:   row.ID.String(),
+		IPAddress:    auditIP(r),
+	})
+}
+
+// ── Sign-in ─────────────────────────────────────────────────────────────────
+
+// POST /api/v1/auth/passkeys/login/begin
+//
+// Returns the options for navigator.credentials.get(). Send the
+// challengeToken from /auth/login to use a passkey as the second factor.
+func (h *AuthHandler) BeginPasskeyLogin(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		ChallengeToken string `json:"challengeToken"`
+	}
+	// The body is optional for a passwordless sign-in.
+	if r.ContentLength != 0 {
+		if err := readJSON(r, &req); err != nil {
+			writeError(w, http.StatusBadRequest, "Invalid request body")
+			return
+		}
+	}
+
+	userID := uuid.Nil
+	var allow []models.WebAuthnCredential
+	if req.ChallengeToken != "" {
+		user, ok := h.challengeUser(req.ChallengeToken)
+		if !ok {
+			writeError(w, http.StatusUnauthorized, "Login challenge expired — sign in again")
+			return
+		}
+		creds, err := loadPasskeys(h.db, user.ID)
+		if err != nil || len(creds) == 0 {
+			writeError(w, http.StatusBadRequest, "No passkeys registered for this account")
+			return
+		}
+		userID, allow = user.ID, creds
+	}
+
+	opts, err := h.passkeyRequestOptions(userID, allow)
+	if err != nil {
+		writeError(w, http.StatusServiceUnavailable, "Failed to start passkey sign-in")
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]interface{}{"publicKey": opts})
+}
+
+// POST /api/v1/auth/passkeys/login/finish
+func (h *AuthHandler) FinishPasskeyLogin(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Credential webauthn.AssertionResponse `json:"credential"`
+	}
+	if err := readJSON(r, &req); err != nil {
+		writeError(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+
+	var cred models.WebAuthnCredential
+	if err := h.db.Where("credential_id = ?", []byte(req.Credential.RawID)).First(&cred).Error; err != nil {
+		writeError(w, http.StatusUnauthorized, "Unknown passkey")
+		return
+	}
+	var user models.User
+	if err := h.db.First(&user, "id = ?", cred.UserID).Error; err != nil {
+		writeError(w, http.StatusUnauthorized, "Unknown passkey")
+		return
+	}
+
+	ceremony, assertion, err := h.verifyPasskeyAssertion(&req.Credential, &cred)
+	if errors.Is(err, errPasskeyCeremony) {
+		writeError(w, http.StatusUnauthorized, "Passkey sign-in expired — try again")
+		return
+	}
+	if err != nil {
+		h.audit2FA(r, &user, "auth.login_failed", models.JSONB{"reason": "passkey verification failed", "passkey": cred.Name})
+		writeError(w, http.StatusUnauthorized, "Passkey could not be verified")
+		return
+	}
+
+	// Conditional on the stored count, so two sign-ins racing with the same
+	// counter value cannot both succeed.
+	res := h.db.Model(&models.WebAuthnCredential{}).
+		Where("id = ? AND sign_count = ?", cred.ID, cred.SignCount).
+		Updates(map[string]interface{}{
+			"sign_count":   int64(assertion.SignCount),
+			"backed_up":    assertion.BackedUp,
+			"last_used_at": time.Now(),
+		})
+	if res.Error != nil || res.RowsAffected == 0 {
+		writeError(w, http.StatusUnauthorized, "Passkey could not be verified")
+		return
+	}
+
+	metadata := models.JSONB{"method": "passkey", "passkey": cred.Name}
+	if ceremony.secondFactor() {
+		metadata = models.JSONB{"second_factor": "passkey", "passkey": cred.Name}
+	}
+	h.completeLogin(w, r, &user, metadata, nil)
+}
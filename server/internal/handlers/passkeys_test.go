@@ -0,0 +1,140 @@
+package handlers
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/zynqcloud/api/internal/config"
+	"github.com/zynqcloud/api/internal/models"
+	"github.com/zynqcloud/api/internal/webauthn"
+)
+
+func testPasskeyHandler() *AuthHandler {
+	return &AuthHandler{
+		cfg: &config.Config{
+			WebAuthnRPID:    "cloud.example.com",
+			WebAuthnOrigins: []string{"https://cloud.example.com"},
+		},
+		passkeys: newPasskeyCeremonies(),
+	}
+}
+
+// registerPasskey runs a registration ceremony and returns the row the
+// handler would store.
+func registerPasskey(t *testing.T, h *AuthHandler, a *webauthn.Authenticator, user *models.User) *models.WebAuthnCredential {
+	t.Helper()
+	opts, err := h.passkeyCreationOptions(user, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp, err := a.Create(opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cred, err := h.verifyPasskeyRegistration(user.ID, resp)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &models.WebAuthnCredential{
+		ID:           uuid.New(),
+		UserID:       user.ID,
+		CredentialID: cred.ID,
+		PublicKey:    cred.PublicKey,
+		SignCount:    int64(cred.SignCount),
+	}
+}
+
+func TestPasskeyCeremonies(t *testing.T) {
+	h := testPasskeyHandler()
+	a := webauthn.NewAuthenticator("https://cloud.example.com")
+	user := &models.User{ID: uuid.New(), Email: "ada@example.com", Name: "Ada"}
+	row := registerPasskey(t, h, a, user)
+
+	// Passwordless sign-in: any discoverable passkey, user verification
+	// required.
+	opts, err := h.passkeyRequestOptions(uuid.Nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if opts.UserVerification != "required" || len(opts.AllowCredentials) != 0 {
+		t.Errorf("passwordless options = %+v", opts)
+	}
+	resp, err := a.Get(opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c, assertion, err := h.verifyPasskeyAssertion(resp, row)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c.secondFactor() {
+		t.Error("passwordless sign-in reported as a second factor")
+	}
+	row.SignCount = int64(assertion.SignCount)
+
+	// The challenge is spent: replaying the same response fails.
+	if _, _, err := h.verifyPasskeyAssertion(resp, row); !errors.Is(err, errPasskeyCeremony) {
+		t.Errorf("replayed assertion: got %v, want errPasskeyCeremony", err)
+	}
+
+	// Second factor: only the challenged user's passkeys are accepted.
+	opts, err = h.passkeyRequestOptions(user.ID, []models.WebAuthnCredential{*row})
+	if err != nil {
+		t.Fatal(err)
+	}
+	a.UserVerification = false
+	resp, err = a.Get(opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c, _, err = h.verifyPasskeyAssertion(resp, row)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !c.secondFactor() {
+		t.Error("second-factor sign-in not reported as one")
+	}
+
+	other := &models.User{ID: uuid.New(), Email: "bob@example.com"}
+	opts, _ = h.passkeyRequestOptions(other.ID, nil)
+	resp, _ = a.Get(opts)
+	if _, _, err := h.verifyPasskeyAssertion(resp, row); err == nil {
+		t.Error("passkey accepted as another user's second factor")
+	}
+
+	// Without user verification a passkey cannot replace the password.
+	opts, _ = h.passkeyRequestOptions(uuid.Nil, nil)
+	resp, _ = a.Get(opts)
+	if _, _, err := h.verifyPasskeyAssertion(resp, row); !errors.Is(err, webauthn.ErrVerification) {
+		t.Errorf("unverified passwordless sign-in: got %v, want a verification error", err)
+	}
+}
+
+func TestPasskeyRegistrationBoundToUser(t *testing.T) {
+	h := testPasskeyHandler()
+	a := webauthn.NewAuthenticator("https://cloud.example.com")
+	user := &models.User{ID: uuid.New(), Email: "ada@example.com"}
+
+	opts, err := h.passkeyCreationOptions(user, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp, err := a.Create(opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// A registration challenge cannot finish a sign-in, and another user
+	// cannot finish the registration.
+	var signIn webauthn.AssertionResponse
+	signIn.Response.ClientDataJSON = resp.Response.ClientDataJSON
+	if _, _, err := h.verifyPasskeyAssertion(&signIn, &models.WebAuthnCredential{}); !errors.Is(err, errPasskeyCeremony) {
+		t.Errorf("registration challenge used for sign-in: %v", err)
+	}
+
+	opts, _ = h.passkeyCreationOptions(user, nil)
+	resp, _ = a.Create(opts)
+	if _, err := h.verifyPasskeyRegistration(uuid.New(), resp); !errors.Is(err, errPasskeyCeremony) {
+		t.Errorf("registration finished by another user: %v", err)
+	}
+}
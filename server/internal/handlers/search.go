@@ -0,0 +1,327 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/zynqcloud/api/internal/config"
+	"github.com/zynqcloud/api/internal/crypto"
+	mw "github.com/zynqcloud/api/internal/middleware"
+	"github.com/zynqcloud/api/internal/models"
+	"github.com/zynqcloud/api/internal/search"
+	"github.com/zynqcloud/api/internal/storage"
+	"gorm.io/gorm"
+)
+
+// Full-text search
+//
+// Names are matched as stored. Document content is indexed in the
+// background: the indexer decrypts each new blob in memory, extracts its text
+// (internal/search) and stores a tsvector in blob_search_index. Extracted text
+// would reveal exactly what the encryption at rest hides, so it is never
+// written anywhere; every word is replaced by an HMAC token keyed from the
+// master key (crypto.SearchToken) and queries are tokenised the same way.
+// Someone holding only a database dump learns which documents share words,
+// not the words. The trade-off is that content matches are whole-word only.
+//
+// The index is per blob, so a document uploaded to several places is read
+// once. Access control is applied at query time from the file rows that point
+// at the blob.
+
+// Blob index states (blob_search_index.status).
+const (
+	searchIndexed = "indexed"
+	searchSkipped = "skipped" // too large or not readable as text
+	searchFailed  = "failed"  // could not be decrypted or parsed
+)
+
+// searchIndexBatch is the number of blobs indexed per query for pending work.
+const searchIndexBatch = 20
+
+// searchIndexWake lets uploads start an indexing cycle right away instead of
+// waiting for the next tick.
+var searchIndexWake = make(chan struct{}, 1)
+
+// wakeSearchIndexer schedules an indexing cycle. It never blocks.
+func wakeSearchIndexer() {
+	select {
+	case searchIndexWake <- struct{}{}:
+	default:
+	}
+}
+
+// searchableNameRe matches the file names whose content the indexer reads.
+var searchableNameRe = func() string {
+	exts := search.Extensions()
+	for i, ext := range exts {
+		exts[i] = regexp.QuoteMeta(strings.TrimPrefix(ext, "."))
+	}
+	return `\.(` + strings.Join(exts, "|") + `)$`
+}()
+
+// IndexSearchContent indexes up to limit blobs that have no index entry for
+// the current key. It returns how many were processed.
+func IndexSearchContent(db *gorm.DB, c *crypto.Crypto, backend storage.Backend, limit int) (int, error) {
+	type pending struct {
+		BlobID string
+		Name   string
+	}
+	var rows []pending
+	if err := db.Raw(`
+		SELECT DISTINCT ON (b.id) b.id AS blob_id, f.name
+		FROM blobs b
+		JOIN files f ON f.blob_id = b.id AND f.deleted_at IS NULL
+		LEFT JOIN blob_search_index s ON s.blob_id = b.id AND s.key_id = ?
+		WHERE s.blob_id IS NULL AND lower(f.name) ~ ?
+		ORDER BY b.id, f.created_at
+		LIMIT ?
+	`, c.KeyID(), searchableNameRe, limit).Scan(&rows).Error; err != nil {
+		return 0, fmt.Errorf("list unindexed blobs: %w", err)
+	}
+
+	for i, row := range rows {
+		status, tsv, err := extractBlobTerms(db, c, backend, row.BlobID, row.Name)
+		if err != nil {
+			// Storage errors are usually transient; leave the blob for the
+			// next cycle instead of recording a failure.
+			return i, err
+		}
+		if err := db.Exec(`
+			INSERT INTO blob_search_index (blob_id, key_id, status, content_tsv, indexed_at)
+			VALUES (?, ?, ?, ?::tsvector, NOW())
+			ON CONFLICT (blob_id) DO UPDATE SET
+				key_id      = EXCLUDED.key_id,
+				status      = EXCLUDED.status,
+				content_tsv = EXCLUDED.content_tsv,
+				indexed_at  = EXCLUDED.indexed_at
+		`, row.BlobID, c.KeyID(), status, tsv).Error; err != nil {
+			// The blob may have been garbage collected meanwhile.
+			slog.Warn("search index: store entry failed", "blob_id", row.BlobID, "error", err)
+		}
+	}
+	return len(rows), nil
+}
+
+// extractBlobTerms decrypts a blob and returns its index status and keyed
+// tsvector. An error means the content could not be read from storage.
+func extractBlobTerms(db *gorm.DB, c *crypto.Crypto, backend storage.Backend, blobID, name string) (string, string, error) {
+	var blob models.Blob
+	if err := db.First(&blob, "id = ?", blobID).Error; err != nil {
+		return "", "", fmt.Errorf("load blob: %w", err)
+	}
+	if blob.Size > search.MaxSourceBytes {
+		return searchSkipped, "", nil
+	}
+	dek, err := c.DecryptFileKey(blob.EncryptedDEK)
+	if err != nil {
+		slog.Warn("search index: unwrap blob key failed", "blob_id", blobID, "error", err)
+		return searchFailed, "", nil
+	}
+
+	rc, _, err := backend.Read(blob.StoragePath)
+	if err != nil {
+		return "", "", fmt.Errorf("read blob %s: %w", blobID, err)
+	}
+	defer rc.Close()
+	var plain bytes.Buffer
+	plain.Grow(int(blob.Size))
+	if err := crypto.DecryptStream(rc, &plain, dek, blob.EncryptionIV); err != nil {
+		slog.Warn("search index: decrypt blob failed", "blob_id", blobID, "error", err)
+		return searchFailed, "", nil
+	}
+
+	text, err := search.Extract(name, plain.Bytes())
+	if errors.Is(err, search.ErrUnsupported) {
+		return searchSkipped, "", nil
+	}
+	if err != nil {
+		slog.Debug("search index: extract text failed", "blob_id", blobID, "error", err)
+		return searchFailed, "", nil
+	}
+	return searchIndexed, search.TSVector(text, c.SearchToken), nil
+}
+
+// RunSearchIndexPeriodic starts a background goroutine that indexes pending
+// blobs on every interval, and right after uploads, until ctx is cancelled.
+func RunSearchIndexPeriodic(ctx context.Context, db *gorm.DB, c *crypto.Crypto, backend storage.Backend, interval time.Duration, logger *slog.Logger) <-chan struct{} {
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			total := 0
+			for ctx.Err() == nil {
+				n, err := IndexSearchContent(db, c, backend, searchIndexBatch)
+				total += n
+				if err != nil {
+					logger.Error("search index failed", "indexed", total, "error", err)
+					break
+				}
+				if n < searchIndexBatch {
+					break
+				}
+			}
+			if total > 0 {
+				logger.Info("search index: cycle complete", "indexed", total)
+			}
+
+			select {
+			case <-ticker.C:
+			case <-searchIndexWake:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	return done
+}
+
+// ── Search endpoint ─────────────────────────────────────────────────────────
+
+type SearchHandler struct {
+	db     *gorm.DB
+	cfg    *config.Config
+	crypto *crypto.Crypto
+}
+
+func NewSearchHandler(db *gorm.DB, cfg *config.Config, c *crypto.Crypto) *SearchHandler {
+	return &SearchHandler{db: db, cfg: cfg, crypto: c}
+}
+
+// searchResult is one file returned by Search.
+type searchResult struct {
+	models.File
+	Source       string  `json:"source"` // "personal", "space" or "shared"
+	SpaceName    *string `json:"space_name,omitempty"`
+	ContentMatch bool    `json:"content_match"`
+	Rank         float64 `json:"rank"`
+}
+
+// GET /api/v1/search?q=...
+//
+// Searches every file the caller can open: their personal files, files in
+// spaces they belong to, and files shared with them. Results are ranked by
+// name matches first, then by how well the content matches.
+func (h *SearchHandler) Search(w http.ResponseWriter, r *http.Request) {
+	claims := mw.GetClaims(r)
+	userID, _ := uuid.Parse(claims.Sub)
+
+	q := r.URL.Query()
+	query := strings.TrimSpace(q.Get("q"))
+	if query == "" {
+		writeError(w, http.StatusBadRequest, "q is required")
+		return
+	}
+	if len(query) > 200 {
+		writeError(w, http.StatusBadRequest, "q must be at most 200 characters")
+		return
+	}
+	page, _ := strconv.Atoi(q.Get("page"))
+	if page < 1 {
+		page = 1
+	}
+	limit, _ := strconv.Atoi(q.Get("limit"))
+	if limit <= 0 || limit > 100 {
+		limit = 50
+	}
+	offset := (page - 1) * limit
+
+	// Files shared with the caller, and everything inside shared folders,
+	// follow the same rules as sharedPermission.
+	shared := sharedRootIDs(h.db, userID)
+	if len(shared) == 0 {
+		shared = []uuid.UUID{uuid.Nil}
+	}
+	args := map[string]interface{}{
+		"user":     userID,
+		"like":     likeSafe(query),
+		"q":        query,
+		"shared":   shared,
+		"maxDepth": shareTreeMaxDepth,
+	}
+
+	// Each matcher contributes a condition and a rank term.
+	match := []string{`f.name ILIKE @like ESCAPE '\'`}
+	rank := []string{`CASE WHEN f.name ILIKE @like ESCAPE '\' THEN 1.0 ELSE 0 END`}
+	if len(search.Terms(query)) > 0 {
+		match = append(match, `to_tsvector('simple', f.name) @@ plainto_tsquery('simple', @q)`)
+		rank = append(rank, `ts_rank(to_tsvector('simple', f.name), plainto_tsquery('simple', @q)) * 2`)
+	}
+	contentJoin := ""
+	contentMatch := "false"
+	if h.cfg.SearchContentIndex && h.crypto != nil {
+		if cq := search.TSQuery(query, h.crypto.SearchToken); cq != "" {
+			args["cq"] = cq
+			args["key"] = h.crypto.KeyID()
+			contentJoin = `LEFT JOIN blob_search_index s
+				ON s.blob_id = f.blob_id AND s.key_id = @key AND s.status = 'indexed'`
+			contentMatch = `COALESCE(s.content_tsv @@ CAST(@cq AS tsquery), false)`
+			match = append(match, contentMatch)
+			rank = append(rank, `COALESCE(ts_rank(s.content_tsv, CAST(@cq AS tsquery)), 0)`)
+		}
+	}
+
+	from := `
+		FROM files f
+		LEFT JOIN spaces sp ON sp.id = f.space_id
+		` + contentJoin + `
+		WHERE f.deleted_at IS NULL
+		  AND ((f.space_id IS NULL AND f.owner_id = @user)
+		    OR f.space_id IN (` + userSpacesSQL + `)
+		    OR f.id IN (
+		      WITH RECURSIVE shared_tree AS (
+		        SELECT id, 0 AS depth FROM files WHERE id IN @shared
+		        UNION ALL
+		        SELECT c.id, t.depth + 1 FROM files c
+		        INNER JOIN shared_tree t ON c.parent_id = t.id
+		        WHERE c.deleted_at IS NULL AND t.depth < @maxDepth
+		      )
+		      SELECT id FROM shared_tree))
+		  AND (` + strings.Join(match, " OR ") + `)`
+
+	var total int64
+	if err := h.db.Raw(`SELECT COUNT(*) `+from, args).Scan(&total).Error; err != nil {
+		writeError(w, http.StatusInternalServerError, "Search failed")
+		return
+	}
+
+	args["limit"] = limit
+	args["offset"] = offset
+	results := []searchResult{}
+	if err := h.db.Raw(`
+		SELECT f.*,
+		       CASE WHEN f.space_id IS NOT NULL THEN 'space'
+		            WHEN f.owner_id = @user THEN 'personal'
+		            ELSE 'shared' END AS source,
+		       sp.name AS space_name,
+		       `+contentMatch+` AS content_match,
+		       (`+strings.Join(rank, " + ")+`) AS rank
+		`+from+`
+		ORDER BY rank DESC, f.updated_at DESC
+		LIMIT @limit OFFSET @offset
+	`, args).Scan(&results).Error; err != nil {
+		slog.Error("search query failed", "error", err)
+		writeError(w, http.StatusInternalServerError, "Search failed")
+		return
+	}
+
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"items": results,
+		"meta": map[string]interface{}{
+			"total": total,
+			"page":  page,
+			"limit": limit,
+		},
+	})
+}
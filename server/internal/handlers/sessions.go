@@ -0,0 +1,521 @@
+package handlers
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"log/slog"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
+	mw "github.com/zynqcloud/api/internal/middleware"
+	"github.com/zynqcloud/api/internal/models"
+	"gorm.io/gorm"
+)
+
+// A sign-in creates a row in sessions. The browser gets two cookies: jid, a
+// short-lived access token whose jti is the session ID, and zrt, an opaque
+// refresh token of the form "<session id>.<secret>" that only the refresh
+// and logout endpoints see. Every refresh rotates the secret. The secret it
+// replaced stays valid for refreshGrace so tabs refreshing at the same time
+// don't sign each other out; presenting it after that means it was copied,
+// and the session is revoked.
+
+const (
+	refreshCookie     = "zrt"
+	refreshCookiePath = "/api/v1/auth"
+	refreshGrace      = 30 * time.Second
+
+	// sessionTouchInterval limits last_seen_at writes to one a minute per
+	// session.
+	sessionTouchInterval = time.Minute
+)
+
+// SessionStore checks access tokens against the sessions table. It is the
+// session validator for middleware.Auth.
+type SessionStore struct {
+	db *gorm.DB
+}
+
+func NewSessionStore(db *gorm.DB) *SessionStore {
+	return &SessionStore{db: db}
+}
+
+// ValidSession reports whether the token's session exists, belongs to the
+// token's user, and is neither revoked nor expired.
+func (s *SessionStore) ValidSession(r *http.Request, claims *mw.Claims) bool {
+	id, err := uuid.Parse(claims.ID)
+	if err != nil {
+		return false
+	}
+	var sess models.Session
+	if err := s.db.Select("id, user_id, last_seen_at").
+		Where("id = ? AND revoked_at IS NULL AND expires_at > ?", id, time.Now()).
+		First(&sess).Error; err != nil {
+		return false
+	}
+	if sess.UserID.String() != claims.Sub {
+		return false
+	}
+	if time.Since(sess.LastSeenAt) > sessionTouchInterval {
+		s.db.Model(&sess).Updates(map[string]interface{}{"last_seen_at": time.Now(), "ip_address": auditIP(r)})
+	}
+	return true
+}
+
+// accessToken signs a short-lived token for the session.
+func (h *AuthHandler) accessToken(user *models.User, sessionID uuid.UUID) (string, error) {
+	now := time.Now()
+	claims := &mw.Claims{
+		Sub:   user.ID.String(),
+		Email: user.Email,
+		Role:  user.Role,
+		RegisteredClaims: jwt.RegisteredClaims{
+			ID:        sessionID.String(),
+			ExpiresAt: jwt.NewNumericDate(now.Add(time.Duration(h.cfg.AccessTokenTTLMinutes) * time.Minute)),
+			IssuedAt:  jwt.NewNumericDate(now),
+		},
+	}
+	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
+	return token.SignedString([]byte(h.cfg.JWTSecret))
+}
+
+func newRefreshSecret() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// startSession records a new session for user and sets its cookies. It
+// returns the access and refresh tokens.
+func (h *AuthHandler) startSession(w http.ResponseWriter, r *http.Request, user *models.User, method string) (access, refresh string, err error) {
+	secret, err := newRefreshSecret()
+	if err != nil {
+		return "", "", err
+	}
+	ua := r.UserAgent()
+	if len(ua) > 512 {
+		ua = ua[:512]
+	}
+	now := time.Now()
+	sess := &models.Session{
+		ID:          uuid.New(),
+		UserID:      user.ID,
+		RefreshHash: hashAppPassword(secret),
+		ExpiresAt:   now.Add(h.cfg.SessionLifetime),
+		LastSeenAt:  now,
+		IPAddress:   auditIP(r),
+		UserAgent:   ua,
+		Device:      deviceLabel(ua),
+		AuthMethod:  method,
+	}
+	if err := h.db.Create(sess).Error; err != nil {
+		return "", "", err
+	}
+	access, err = h.accessToken(user, sess.ID)
+	if err != nil {
+		return "", "", err
+	}
+	refresh = sess.ID.String() + "." + secret
+	h.setAuthCookie(w, access)
+	h.setRefreshCookie(w, refresh)
+	return access, refresh, nil
+}
+
+func (h *AuthHandler) setRefreshCookie(w http.ResponseWriter, token string) {
+	http.SetCookie(w, h.cookie(refreshCookie, token, refreshCookiePath, int(h.cfg.SessionLifetime/time.Second)))
+}
+
+func (h *AuthHandler) clearRefreshCookie(w http.ResponseWriter) {
+	http.SetCookie(w, h.cookie(refreshCookie, "", refreshCookiePath, -1))
+}
+
+// refreshTokenFrom reads the refresh token from its cookie or, for clients
+// that cannot keep cookies, from a JSON body {"refreshToken": "..."}.
+func refreshTokenFrom(r *http.Request) string {
+	if c, err := r.Cookie(refreshCookie); err == nil && c.Value != "" {
+		return c.Value
+	}
+	var req struct {
+		RefreshToken string `json:"refreshToken"`
+	}
+	if r.ContentLength != 0 && readJSON(r, &req) == nil {
+		return req.RefreshToken
+	}
+	return ""
+}
+
+// liveSession loads the active session a refresh token names, and returns
+// the token's secret hashed.
+func (h *AuthHandler) liveSession(token string) (*models.Session, string, bool) {
+	idStr, secret, ok := strings.Cut(token, ".")
+	if !ok || secret == "" {
+		return nil, "", false
+	}
+	id, err := uuid.Parse(idStr)
+	if err != nil {
+		return nil, "", false
+	}
+	var sess models.Session
+	if err := h.db.Where("id = ? AND revoked_at IS NULL AND expires_at > ?", id, time.Now()).First(&sess).Error; err != nil {
+		return nil, "", false
+	}
+	return &sess, hashAppPassword(secret), true
+}
+
+func hashesEqual(a, b string) bool {
+	return subtle.ConstantTimeCompare([]byte(a), []byte(b)) == 1
+}
+
+// POST /api/v1/auth/refresh
+//
+// Trades the refresh token for a new access token and rotates the refresh
+// token.
+func (h *AuthHandler) Refresh(w http.ResponseWriter, r *http.Request) {
+	sess, presented, ok := h.liveSession(refreshTokenFrom(r))
+	if !ok {
+		h.clearAuthCookie(w)
+		h.clearRefreshCookie(w)
+		writeError(w, http.StatusUnauthorized, "Session expired")
+		return
+	}
+
+	var user models.User
+	if err := h.db.First(&user, "id = ?", sess.UserID).Error; err != nil || user.DisabledAt != nil {
+		revokeSession(h.db, sess.ID)
+		h.clearAuthCookie(w)
+		h.clearRefreshCookie(w)
+		writeError(w, http.StatusUnauthorized, "Session expired")
+		return
+	}
+
+	now := time.Now()
+	refresh := ""
+	switch {
+	case hashesEqual(presented, sess.RefreshHash):
+		secret, err := newRefreshSecret()
+		if err != nil {
+			writeError(w, http.StatusInternalServerError, "Failed to refresh session")
+			return
+		}
+		// Conditional on the old hash so only one of two concurrent
+		// refreshes rotates; the other is inside the grace window.
+		res := h.db.Model(&models.Session{}).
+			Where("id = ? AND refresh_hash = ?", sess.ID, sess.RefreshHash).
+			Updates(map[string]interface{}{
+				"refresh_hash":      hashAppPassword(secret),
+				"prev_refresh_hash": sess.RefreshHash,
+				"rotated_at":        now,
+				"expires_at":        now.Add(h.cfg.SessionLifetime),
+				"last_seen_at":      now,
+				"ip_address":        auditIP(r),
+			})
+		if res.Error != nil {
+			writeError(w, http.StatusInternalServerError, "Failed to refresh session")
+			return
+		}
+		if res.RowsAffected == 1 {
+			refresh = sess.ID.String() + "." + secret
+		}
+	case sess.PrevRefreshHash != nil && hashesEqual(presented, *sess.PrevRefreshHash):
+		if sess.RotatedAt == nil || now.Sub(*sess.RotatedAt) > refreshGrace {
+			revokeSession(h.db, sess.ID)
+			uid := user.ID
+			LogAudit(h.db, AuditEntry{
+				UserID:       &uid,
+				UserName:     user.Name,
+				UserEmail:    user.Email,
+				Action:       "auth.refresh_reuse",
+				ResourceType: "session",
+				ResourceID:   sess.ID.String(),
+				IPAddress:    auditIP(r),
+				Metadata:     models.JSONB{"device": sess.Device},
+			})
+			h.clearAuthCookie(w)
+			h.clearRefreshCookie(w)
+			writeError(w, http.StatusUnauthorized, "Session expired")
+			return
+		}
+	default:
+		writeError(w, http.StatusUnauthorized, "Session expired")
+		return
+	}
+
+	access, err := h.accessToken(&user, sess.ID)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "Failed to generate token")
+		return
+	}
+	h.setAuthCookie(w, access)
+	if refresh != "" {
+		h.setRefreshCookie(w, refresh)
+	}
+	writeJSON(w, http.StatusOK, map[string]string{"token": access, "refreshToken": refresh})
+}
+
+// requestSession finds the session a request belongs to, from its refresh
+// token or else its access token. The access token may have expired: a user
+// signing out after a break still ends the session.
+func (h *AuthHandler) requestSession(r *http.Request) *models.Session {
+	if sess, presented, ok := h.liveSession(refreshTokenFrom(r)); ok {
+		if hashesEqual(presented, sess.RefreshHash) || sess.PrevRefreshHash != nil && hashesEqual(presented, *sess.PrevRefreshHash) {
+			return sess
+		}
+	}
+	tokenStr := ""
+	if c, err := r.Cookie("jid"); err == nil {
+		tokenStr = c.Value
+	} else if auth := r.Header.Get("Authorization"); strings.HasPrefix(auth, "Bearer ") {
+		tokenStr = strings.TrimPrefix(auth, "Bearer ")
+	}
+	if tokenStr == "" {
+		return nil
+	}
+	claims := &mw.Claims{}
+	_, err := jwt.ParseWithClaims(tokenStr, claims, func(*jwt.Token) (interface{}, error) {
+		return []byte(h.cfg.JWTSecret), nil
+	}, jwt.WithValidMethods([]string{jwt.SigningMethodHS256.Alg()}), jwt.WithoutClaimsValidation())
+	if err != nil {
+		return nil
+	}
+	var sess models.Session
+	if err := h.db.Where("id = ? AND user_id = ? AND revoked_at IS NULL", claims.ID, claims.Sub).First(&sess).Error; err != nil {
+		return nil
+	}
+	return &sess
+}
+
+// revokeSession ends one session.
+func revokeSession(db *gorm.DB, id uuid.UUID) {
+	if err := db.Model(&models.Session{}).Where("id = ? AND revoked_at IS NULL", id).
+		Update("revoked_at", time.Now()).Error; err != nil {
+		slog.Error("failed to revoke session", "session", id, "error", err)
+	}
+}
+
+// revokeUserSessions ends every session of the user except keep, which may
+// be uuid.Nil. It returns the number of sessions revoked.
+func revokeUserSessions(db *gorm.DB, userID, keep uuid.UUID) int64 {
+	q := db.Model(&models.Session{}).Where("user_id = ? AND revoked_at IS NULL", userID)
+	if keep != uuid.Nil {
+		q = q.Where("id <> ?", keep)
+	}
+	res := q.Update("revoked_at", time.Now())
+	if res.Error != nil {
+		slog.Error("failed to revoke sessions", "user", userID, "error", res.Error)
+	}
+	return res.RowsAffected
+}
+
+// currentSessionID is the session the request's access token belongs to.
+func currentSessionID(r *http.Request) uuid.UUID {
+	claims := mw.GetClaims(r)
+	if claims == nil {
+		return uuid.Nil
+	}
+	id, _ := uuid.Parse(claims.ID)
+	return id
+}
+
+// GET /api/v1/auth/sessions
+func (h *AuthHandler) ListSessions(w http.ResponseWriter, r *http.Request) {
+	user, ok := h.currentUser(r)
+	if !ok {
+		writeError(w, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+	var sessions []models.Session
+	if err := h.db.Where("user_id = ? AND revoked_at IS NULL AND expires_at > ?", user.ID, time.Now()).
+		Order("last_seen_at DESC").Find(&sessions).Error; err != nil {
+		writeError(w, http.StatusInternalServerError, "Failed to list sessions")
+		return
+	}
+	type sessionView struct {
+		models.Session
+		Current bool `json:"current"`
+	}
+	current := currentSessionID(r)
+	out := make([]sessionView, len(sessions))
+	for i, s := range sessions {
+		out[i] = sessionView{Session: s, Current: s.ID == current}
+	}
+	writeJSON(w, http.StatusOK, out)
+}
+
+// DELETE /api/v1/auth/sessions/{id}
+func (h *AuthHandler) RevokeSession(w http.ResponseWriter, r *http.Request) {
+	user, ok := h.currentUser(r)
+	if !ok {
+		writeError(w, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+	id, err := uuid.Parse(chi.URLParam(r, "id"))
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "Invalid session ID")
+		return
+	}
+	var sess models.Session
+	if err := h.db.Where("id = ? AND user_id = ? AND revoked_at IS NULL", id, user.ID).First(&sess).Error; err != nil {
+		writeError(w, http.StatusNotFound, "Session not found")
+		return
+	}
+	revokeSession(h.db, sess.ID)
+	if sess.ID == currentSessionID(r) {
+		h.clearAuthCookie(w)
+		h.clearRefreshCookie(w)
+	}
+
+	uid := user.ID
+	LogAudit(h.db, AuditEntry{
+		UserID:       &uid,
+		UserName:     user.Name,
+		UserEmail:    user.Email,
+		Action:       "auth.session_revoke",
+		ResourceType: "session",
+		ResourceName: sess.Device,
+		ResourceID:   sess.ID.String(),
+		IPAddress:    auditIP(r),
+	})
+	writeJSON(w, http.StatusOK, map[string]string{"message": "Session revoked"})
+}
+
+// DELETE /api/v1/auth/sessions
+//
+// Signs out every other device; the calling session stays.
+func (h *AuthHandler) RevokeOtherSessions(w http.ResponseWriter, r *http.Request) {
+	user, ok := h.currentUser(r)
+	if !ok {
+		writeError(w, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+	n := revokeUserSessions(h.db, user.ID, currentSessionID(r))
+
+	uid := user.ID
+	LogAudit(h.db, AuditEntry{
+		UserID:    &uid,
+		UserName:  user.Name,
+		UserEmail: user.Email,
+		Action:    "auth.sessions_revoke",
+		IPAddress: auditIP(r),
+		Metadata:  models.JSONB{"revoked": n},
+	})
+	writeJSON(w, http.StatusOK, map[string]int64{"revoked": n})
+}
+
+// DELETE /api/v1/admin/users/{id}/sessions
+func (h *AuthHandler) RevokeUserSessions(w http.ResponseWriter, r *http.Request) {
+	claims := mw.GetClaims(r)
+	callerID, _ := uuid.Parse(claims.Sub)
+
+	targetID, err := uuid.Parse(chi.URLParam(r, "id"))
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "Invalid user ID")
+		return
+	}
+	var target models.User
+	if err := h.db.First(&target, "id = ?", targetID).Error; err != nil {
+		writeError(w, http.StatusNotFound, "User not found")
+		return
+	}
+	if target.Role == "owner" && claims.Role != "owner" {
+		writeError(w, http.StatusForbidden, "Only an owner can sign out an owner")
+		return
+	}
+	n := revokeUserSessions(h.db, targetID, uuid.Nil)
+
+	var caller models.User
+	h.db.Select("name, email").First(&caller, "id = ?", callerID)
+	LogAudit(h.db, AuditEntry{
+		UserID:       &callerID,
+		UserName:     caller.Name,
+		UserEmail:    caller.Email,
+		Action:       "user.sessions_revoke",
+		ResourceType: "user",
+		ResourceName: target.Email,
+		ResourceID:   target.ID.String(),
+		IPAddress:    auditIP(r),
+		Metadata:     models.JSONB{"revoked": n},
+	})
+	writeJSON(w, http.StatusOK, map[string]int64{"revoked": n})
+}
+
+// deviceLabel names the browser and OS in a User-Agent, e.g. "Firefox on
+// Linux". It returns "" when it recognises neither.
+func deviceLabel(ua string) string {
+	var browser, os string
+	switch {
+	case strings.Contains(ua, "Edg/"), strings.Contains(ua, "EdgiOS/"), strings.Contains(ua, "EdgA/"):
+		browser = "Edge"
+	case strings.Contains(ua, "OPR/"):
+		browser = "Opera"
+	case strings.Contains(ua, "Firefox/"), strings.Contains(ua, "FxiOS/"):
+		browser = "Firefox"
+	case strings.Contains(ua, "Chrome/"), strings.Contains(ua, "CriOS/"):
+		browser = "Chrome"
+	case strings.Contains(ua, "Safari/"):
+		browser = "Safari"
+	}
+	switch {
+	case strings.Contains(ua, "iPhone"), strings.Contains(ua, "iPad"):
+		os = "iOS"
+	case strings.Contains(ua, "Android"):
+		os = "Android"
+	case strings.Contains(ua, "Windows"):
+		os = "Windows"
+	case strings.Contains(ua, "CrOS"):
+		os = "ChromeOS"
+	case strings.Contains(ua, "Macintosh"), strings.Contains(ua, "Mac OS X"):
+		os = "macOS"
+	case strings.Contains(ua, "Linux"):
+		os = "Linux"
+	}
+	switch {
+	case browser != "" && os != "":
+		return browser + " on " + os
+	case browser != "":
+		return browser
+	default:
+		return os
+	}
+}
+
+// PruneSessions deletes sessions that expired, or were revoked, more than a
+// day ago. It returns the number removed.
+func PruneSessions(db *gorm.DB) (int64, error) {
+	cutoff := time.Now().Add(-24 * time.Hour)
+	res := db.Where("expires_at < ? OR revoked_at < ?", cutoff, cutoff).Delete(&models.Session{})
+	return res.RowsAffected, res.Error
+}
+
+// RunSessionPrunePeriodic starts a background goroutine that calls
+// PruneSessions on every interval until ctx is cancelled.
+func RunSessionPrunePeriodic(ctx context.Context, db *gorm.DB, interval time.Duration, logger *slog.Logger) <-chan struct{} {
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				n, err := PruneSessions(db)
+				if err != nil {
+					logger.Error("session prune failed", "error", err)
+				} else if n > 0 {
+					logger.Info("session prune: cycle complete", "removed", n)
+				}
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	return done
+}
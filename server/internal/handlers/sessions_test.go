@@ -0,0 +1,43 @@
+package handlers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestDeviceLabel(t *testing.T) {
+	cases := map[string]string{
+		"Mozilla/5.0 (X11; Linux x86_64; rv:128.0) Gecko/20100101 Firefox/128.0":                                                        "Firefox on Linux",
+		"Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/126.0.0.0 Safari/537.36 Edg/126.0.0.0": "Edge on Windows",
+		"Mozilla/5.0 (Macintosh; Intel Mac OS X 10_15_7) AppleWebKit/605.1.15 (KHTML, like Gecko) Version/17.5 Safari/605.1.15":         "Safari on macOS",
+		"Mozilla/5.0 (iPhone; CPU iPhone OS 17_5 like Mac OS X) AppleWebKit/605.1.15 (KHTML, like Gecko) CriOS/126.0 Mobile/15E148":     "Chrome on iOS",
+		"Mozilla/5.0 (Linux; Android 14; Pixel 8) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/126.0.0.0 Mobile Safari/537.36":         "Chrome on Android",
+		"curl/8.8.0": "",
+	}
+	for ua, want := range cases {
+		if got := deviceLabel(ua); got != want {
+			t.Errorf("deviceLabel(%q) = %q, want %q", ua, got, want)
+		}
+	}
+}
+
+func TestRefreshTokenFrom(t *testing.T) {
+	req := httptest.NewRequest(http.MethodPost, "/api/v1/auth/refresh", strings.NewReader(`{"refreshToken":"from-body"}`))
+	if got := refreshTokenFrom(req); got != "from-body" {
+		t.Errorf("body token = %q", got)
+	}
+
+	// The cookie wins over the body.
+	req = httptest.NewRequest(http.MethodPost, "/api/v1/auth/refresh", strings.NewReader(`{"refreshToken":"from-body"}`))
+	req.AddCookie(&http.Cookie{Name: refreshCookie, Value: "from-cookie"})
+	if got := refreshTokenFrom(req); got != "from-cookie" {
+		t.Errorf("cookie token = %q", got)
+	}
+
+	req = httptest.NewRequest(http.MethodPost, "/api/v1/auth/refresh", nil)
+	if got := refreshTokenFrom(req); got != "" {
+		t.Errorf("empty request token = %q", got)
+	}
+}
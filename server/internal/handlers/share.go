@@ -1,9 +1,7 @@
 package handlers
 
 import (
-	"crypto/subtle"
 	"net/http"
-	"time"
 
 	"github.com/go-chi/chi/v5"
 	"github.com/google/uuid"
@@ -20,10 +18,12 @@ type ShareHandler struct {
 	cfg     *config.Config
 	crypto  *crypto.Crypto
 	backend storage.Backend
+	// lockout throttles password guesses per share token.
+	lockout *shareLockout
 }
 
 func NewShareHandler(db *gorm.DB, cfg *config.Config, c *crypto.Crypto, backend storage.Backend) *ShareHandler {
-	return &ShareHandler{db: db, cfg: cfg, crypto: c, backend: backend}
+	return &ShareHandler{db: db, cfg: cfg, crypto: c, backend: backend, lockout: newShareLockout()}
 }
 
 // GET /api/v1/shares/{token}
@@ -36,12 +36,11 @@ func (h *ShareHandler) GetByToken(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	if share.ExpiresAt != nil && share.ExpiresAt.Before(time.Now()) {
-		writeError(w, http.StatusGone, "Share has expired")
+	if !h.checkShareOpen(w, r, &share) {
 		return
 	}
 
-	share.HasPassword = share.Password != nil
+	share.HasPassword = share.Password != nil && *share.Password != ""
 	// Never expose the password
 	resp := map[string]interface{}{
 		"id":          share.ID,
@@ -68,21 +67,19 @@ func (h *ShareHandler) Download(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	if share.ExpiresAt != nil && share.ExpiresAt.Before(time.Now()) {
-		writeError(w, http.StatusGone, "Share has expired")
+	if !h.checkShareOpen(w, r, &share) {
 		return
 	}
 
 	// Check password if required
-	if share.Password != nil {
-		var req struct {
-			Password string `json:"password"`
-		}
-		if err := readJSON(r, &req); err != nil ||
-			subtle.ConstantTimeCompare([]byte(req.Password), []byte(*share.Password)) != 1 {
-			writeError(w, http.StatusUnauthorized, "Incorrect password")
-			return
-		}
+	var req struct {
+		Password string `json:"password"`
+	}
+	if r.ContentLength != 0 {
+		_ = readJSON(r, &req)
+	}
+	if _, ok := h.authorizeShare(w, r, &share, req.Password, "Incorrect password"); !ok {
+		return
 	}
 
 	if share.File == nil {
@@ -91,23 +88,19 @@ func (h *ShareHandler) Download(w http.ResponseWriter, r *http.Request) {
 	}
 
 	file := share.File
-	if file.IsFolder {
-		writeError(w, http.StatusBadRequest, "Cannot download a folder")
+	if !file.IsFolder && file.StoragePath == nil {
+		writeError(w, http.StatusNotFound, "File data not found")
 		return
 	}
-
-	if file.StoragePath == nil {
-		writeError(w, http.StatusNotFound, "File data not found")
+	if !h.takeShareDownload(w, r, &share, file) {
 		return
 	}
 
-	fh := &FilesHandler{
-		db:      h.db,
-		cfg:     h.cfg,
-		crypto:  h.crypto,
-		backend: h.backend,
+	if file.IsFolder {
+		h.filesHandler().streamFolderAsZip(w, r, file)
+		return
 	}
-	fh.streamDecryptedFile(w, r, file)
+	h.filesHandler().streamDecryptedFile(w, r, file)
 }
 
 // GET /api/v1/public/share/{token}
@@ -123,16 +116,13 @@ func (h *ShareHandler) GetPublicShare(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	if share.ExpiresAt != nil && share.ExpiresAt.Before(time.Now()) {
-		writeError(w, http.StatusGone, "Share has expired")
+	if !h.checkShareOpen(w, r, &share) {
 		return
 	}
 
-	if share.Password != nil && *share.Password != "" {
-		if password == "" || subtle.ConstantTimeCompare([]byte(password), []byte(*share.Password)) != 1 {
-			writeError(w, http.StatusUnauthorized, "Password required")
-			return
-		}
+	session, ok := h.authorizeShare(w, r, &share, password, "Password required")
+	if !ok {
+		return
 	}
 
 	if share.File == nil {
@@ -184,8 +174,9 @@ func (h *ShareHandler) GetPublicShare(w http.ResponseWriter, r *http.Request) {
 		accessEntry.UserEmail = claims.Email
 	}
 	LogAudit(h.db, accessEntry)
+	recordShareAccess(h.db, r, share.ID, models.ShareOutcomeViewed)
 
-	writeJSON(w, http.StatusOK, map[string]interface{}{
+	resp := map[string]interface{}{
 		"id":          share.ID,
 		"name":        share.File.Name,
 		"size":        share.File.Size,
@@ -198,10 +189,21 @@ func (h *ShareHandler) GetPublicShare(w http.ResponseWriter, r *http.Request) {
 		"hasContent":  share.File.StoragePath != nil || share.File.IsFolder,
 		"hasPassword": share.Password != nil && *share.Password != "",
 		"expiresAt":   share.ExpiresAt,
-	})
+	}
+	if share.MaxDownloads != nil {
+		resp["downloadsLeft"] = max(*share.MaxDownloads-share.DownloadCount, 0)
+	}
+	// Clients that cannot keep the cookie send this back in x-share-session.
+	if session != "" {
+		resp["shareSession"] = session
+	}
+	writeJSON(w, http.StatusOK, resp)
 }
 
 // GET /api/v1/public/share/{token}/download
+//
+// For a folder share, ids picks items inside it to zip instead of the whole
+// folder.
 func (h *ShareHandler) DownloadPublicShare(w http.ResponseWriter, r *http.Request) {
 	token := chi.URLParam(r, "token")
 	password := r.Header.Get("x-share-password")
@@ -212,16 +214,12 @@ func (h *ShareHandler) DownloadPublicShare(w http.ResponseWriter, r *http.Reques
 		return
 	}
 
-	if share.ExpiresAt != nil && share.ExpiresAt.Before(time.Now()) {
-		writeError(w, http.StatusGone, "Share has expired")
+	if !h.checkShareOpen(w, r, &share) {
 		return
 	}
 
-	if share.Password != nil && *share.Password != "" {
-		if password == "" || subtle.ConstantTimeCompare([]byte(password), []byte(*share.Password)) != 1 {
-			writeError(w, http.StatusUnauthorized, "Password required")
-			return
-		}
+	if _, ok := h.authorizeShare(w, r, &share, password, "Password required"); !ok {
+		return
 	}
 
 	if share.File == nil {
@@ -229,6 +227,30 @@ func (h *ShareHandler) DownloadPublicShare(w http.ResponseWriter, r *http.Reques
 		return
 	}
 
+	if ids := r.URL.Query()["ids"]; len(ids) > 0 {
+		if !share.File.IsFolder {
+			writeError(w, http.StatusBadRequest, "Share is not a folder")
+			return
+		}
+		selection, err := parseShareSelection(ids)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, "Invalid ids")
+			return
+		}
+		if len(selection) > 0 {
+			h.downloadShareSelection(w, r, &share, selection)
+			return
+		}
+	}
+
+	if !share.File.IsFolder && share.File.StoragePath == nil {
+		writeError(w, http.StatusNotFound, "File data not found")
+		return
+	}
+	if !h.takeShareDownload(w, r, &share, share.File) {
+		return
+	}
+
 	// Log the download as a share access event.
 	dlClaims := mw.GetClaims(r)
 	dlEntry := AuditEntry{
@@ -248,21 +270,10 @@ func (h *ShareHandler) DownloadPublicShare(w http.ResponseWriter, r *http.Reques
 	}
 	LogAudit(h.db, dlEntry)
 
-	fh := &FilesHandler{
-		db:      h.db,
-		cfg:     h.cfg,
-		crypto:  h.crypto,
-		backend: h.backend,
-	}
-
+	fh := h.filesHandler()
 	if share.File.IsFolder {
 		fh.streamFolderAsZip(w, r, share.File)
 		return
 	}
-
-	if share.File.StoragePath == nil {
-		writeError(w, http.StatusNotFound, "File data not found")
-		return
-	}
 	fh.streamDecryptedFile(w, r, share.File)
 }
@@ -0,0 +1,365 @@
+package handlers
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log/slog"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
+	"github.com/zynqcloud/api/internal/models"
+	"golang.org/x/crypto/argon2"
+	"gorm.io/gorm"
+)
+
+// Share passwords
+//
+// Passwords on public shares are stored as Argon2id hashes in PHC string
+// form ($argon2id$v=19$m=...,t=...,p=...$salt$hash). Rows written before
+// hashing are rehashed at startup by MigrateSharePasswords, and on their
+// next successful check should that have missed any.
+//
+// Wrong guesses are counted per share token, so spreading them over many
+// addresses does not get around the per-IP share limiter. After
+// shareLockoutFree failures the token locks for shareLockoutBase, doubling
+// with each further failure up to shareLockoutMax.
+//
+// A correct password earns a share session: a signed token, set as a cookie
+// and returned to the caller, that opens the share for shareSessionTTL
+// without sending the password again. Changing the password ends it.
+
+const (
+	argon2Time    = 3
+	argon2Memory  = 64 * 1024
+	argon2Threads = 4
+	argon2KeyLen  = 32
+
+	shareLockoutFree = 5
+	shareLockoutBase = 30 * time.Second
+	shareLockoutMax  = time.Hour
+	// shareLockoutForget drops the failure count of a token nobody has
+	// tried for this long.
+	shareLockoutForget = 24 * time.Hour
+
+	shareSessionTTL    = time.Hour
+	shareSessionAud    = "share-session"
+	shareSessionHeader = "x-share-session"
+)
+
+var errBadPasswordHash = errors.New("malformed password hash")
+
+// hashSharePassword hashes password with Argon2id.
+func hashSharePassword(password string) (string, error) {
+	salt := make([]byte, 16)
+	if _, err := rand.Read(salt); err != nil {
+		return "", err
+	}
+	key := argon2.IDKey([]byte(password), salt, argon2Time, argon2Memory, argon2Threads, argon2KeyLen)
+	return fmt.Sprintf("$argon2id$v=%d$m=%d,t=%d,p=%d$%s$%s", argon2.Version, argon2Memory, argon2Time, argon2Threads,
+		base64.RawStdEncoding.EncodeToString(salt), base64.RawStdEncoding.EncodeToString(key)), nil
+}
+
+func isSharePasswordHash(stored string) bool {
+	return strings.HasPrefix(stored, "$argon2id$")
+}
+
+// verifySharePassword checks password against a stored hash. legacy is true
+// when stored is a plaintext password from before hashing, which the caller
+// should replace.
+func verifySharePassword(stored, password string) (ok, legacy bool, err error) {
+	if !isSharePasswordHash(stored) {
+		return subtle.ConstantTimeCompare([]byte(stored), []byte(password)) == 1, true, nil
+	}
+	parts := strings.Split(stored, "$")
+	if len(parts) != 6 || parts[2] != "v="+strconv.Itoa(argon2.Version) {
+		return false, false, errBadPasswordHash
+	}
+	var m uint32
+	var t uint32
+	var p uint8
+	if _, err := fmt.Sscanf(parts[3], "m=%d,t=%d,p=%d", &m, &t, &p); err != nil {
+		return false, false, errBadPasswordHash
+	}
+	salt, err := base64.RawStdEncoding.DecodeString(parts[4])
+	if err != nil {
+		return false, false, errBadPasswordHash
+	}
+	want, err := base64.RawStdEncoding.DecodeString(parts[5])
+	if err != nil || len(want) == 0 || len(want) > math.MaxUint32 {
+		return false, false, errBadPasswordHash
+	}
+	got := argon2.IDKey([]byte(password), salt, t, m, p, uint32(len(want)))
+	return subtle.ConstantTimeCompare(got, want) == 1, false, nil
+}
+
+// sharePasswordValue turns a password from a request into the column value:
+// nil for none, the hash otherwise.
+func sharePasswordValue(password *string) (*string, error) {
+	if password == nil || *password == "" {
+		return nil, nil
+	}
+	hash, err := hashSharePassword(*password)
+	if err != nil {
+		return nil, err
+	}
+	return &hash, nil
+}
+
+// MigrateSharePasswords hashes share passwords still stored in plaintext.
+func MigrateSharePasswords(db *gorm.DB) (int, error) {
+	var shares []models.Share
+	if err := db.Select("id, password").
+		Where("password IS NOT NULL AND password <> '' AND password NOT LIKE ?", "$argon2id$%").
+		Find(&shares).Error; err != nil {
+		return 0, err
+	}
+	for i, s := range shares {
+		hash, err := hashSharePassword(*s.Password)
+		if err != nil {
+			return i, err
+		}
+		if err := db.Model(&models.Share{}).Where("id = ?", s.ID).UpdateColumn("password", hash).Error; err != nil {
+			return i, err
+		}
+	}
+	return len(shares), nil
+}
+
+// shareLockout counts wrong share passwords per token.
+type shareLockout struct {
+	mu      sync.Mutex
+	entries map[string]*shareLockoutEntry
+	now     func() time.Time
+}
+
+type shareLockoutEntry struct {
+	failures int
+	last     time.Time
+	until    time.Time
+}
+
+func newShareLockout() *shareLockout {
+	return &shareLockout{entries: make(map[string]*shareLockoutEntry), now: time.Now}
+}
+
+// retryAfter is how long token stays locked; 0 when it is not.
+func (l *shareLockout) retryAfter(token string) time.Duration {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if e, ok := l.entries[token]; ok {
+		if d := e.until.Sub(l.now()); d > 0 {
+			return d
+		}
+	}
+	return 0
+}
+
+// fail records a wrong password for token and returns the lockout it
+// triggers, 0 while failures are still free.
+func (l *shareLockout) fail(token string) time.Duration {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	now := l.now()
+	for k, e := range l.entries {
+		if now.Sub(e.last) > shareLockoutForget {
+			delete(l.entries, k)
+		}
+	}
+	e, ok := l.entries[token]
+	if !ok {
+		e = &shareLockoutEntry{}
+		l.entries[token] = e
+	}
+	e.failures++
+	e.last = now
+	if e.failures < shareLockoutFree {
+		return 0
+	}
+	d := shareLockoutMax
+	if n := e.failures - shareLockoutFree; n < 8 {
+		d = min(shareLockoutBase<<n, shareLockoutMax)
+	}
+	e.until = now.Add(d)
+	return d
+}
+
+func (l *shareLockout) reset(token string) {
+	l.mu.Lock()
+	delete(l.entries, token)
+	l.mu.Unlock()
+}
+
+type shareSessionClaims struct {
+	// PasswordTag ties the session to the password it was earned with.
+	PasswordTag string `json:"pwt"`
+	jwt.RegisteredClaims
+}
+
+// passwordGate is a public link that may sit behind a password: a share or
+// a file request.
+type passwordGate struct {
+	id       uuid.UUID
+	token    string
+	password *string
+	// table holds the password column, for rehashing legacy values.
+	table string
+	// resource is the audit resource type for wrong passwords.
+	resource string
+	// denied, when set, hears why a request was turned away: one of the
+	// password outcomes of the share access log.
+	denied func(outcome string)
+}
+
+func (g *passwordGate) deny(outcome string) {
+	if g.denied != nil {
+		g.denied(outcome)
+	}
+}
+
+func shareGate(share *models.Share) *passwordGate {
+	return &passwordGate{id: share.ID, token: *share.ShareToken, password: share.Password, table: "shares", resource: "share"}
+}
+
+func (g *passwordGate) protected() bool {
+	return g.password != nil && *g.password != ""
+}
+
+func (h *ShareHandler) shareSessionKey() []byte {
+	return derivePurposeKey(h.cfg.JWTSecret, "zynqcloud share session v1")
+}
+
+func sharePasswordTag(stored string) string {
+	sum := sha256.Sum256([]byte(stored))
+	return hex.EncodeToString(sum[:8])
+}
+
+func shareSessionCookie(g *passwordGate) string {
+	return "zshare_" + g.id.String()
+}
+
+func (h *ShareHandler) signShareSession(g *passwordGate) (string, error) {
+	now := time.Now()
+	return jwt.NewWithClaims(jwt.SigningMethodHS256, &shareSessionClaims{
+		PasswordTag: sharePasswordTag(*g.password),
+		RegisteredClaims: jwt.RegisteredClaims{
+			Subject:   g.id.String(),
+			Audience:  jwt.ClaimStrings{shareSessionAud},
+			ExpiresAt: jwt.NewNumericDate(now.Add(shareSessionTTL)),
+			IssuedAt:  jwt.NewNumericDate(now),
+		},
+	}).SignedString(h.shareSessionKey())
+}
+
+// validShareSession reports whether the request carries a share session for
+// g, in its cookie or the x-share-session header.
+func (h *ShareHandler) validShareSession(r *http.Request, g *passwordGate) bool {
+	var candidates []string
+	if c, err := r.Cookie(shareSessionCookie(g)); err == nil {
+		candidates = append(candidates, c.Value)
+	}
+	if v := r.Header.Get(shareSessionHeader); v != "" {
+		candidates = append(candidates, v)
+	}
+	for _, tok := range candidates {
+		claims := &shareSessionClaims{}
+		_, err := jwt.ParseWithClaims(tok, claims, func(*jwt.Token) (interface{}, error) {
+			return h.shareSessionKey(), nil
+		}, jwt.WithValidMethods([]string{jwt.SigningMethodHS256.Alg()}), jwt.WithAudience(shareSessionAud))
+		if err == nil && claims.Subject == g.id.String() &&
+			subtle.ConstantTimeCompare([]byte(claims.PasswordTag), []byte(sharePasswordTag(*g.password))) == 1 {
+			return true
+		}
+	}
+	return false
+}
+
+// authorizeShare lets the request through a share's password. It returns
+// the share session issued when the request sent the right password, ""
+// when none was needed, and ok=false after writing the error response.
+// failMsg is the 401 message for a missing or wrong password.
+func (h *ShareHandler) authorizeShare(w http.ResponseWriter, r *http.Request, share *models.Share, password, failMsg string) (session string, ok bool) {
+	g := shareGate(share)
+	g.denied = func(outcome string) { recordShareAccess(h.db, r, share.ID, outcome) }
+	session, ok = h.authorize(w, r, g, password, failMsg)
+	share.Password = g.password
+	return session, ok
+}
+
+// authorize is authorizeShare for any password gate. A legacy plaintext
+// password is replaced by its hash in g.password.
+func (h *ShareHandler) authorize(w http.ResponseWriter, r *http.Request, g *passwordGate, password, failMsg string) (session string, ok bool) {
+	if !g.protected() || h.validShareSession(r, g) {
+		return "", true
+	}
+	if d := h.lockout.retryAfter(g.token); d > 0 {
+		g.deny(models.ShareOutcomeLockedOut)
+		writeLockout(w, d)
+		return "", false
+	}
+	if password == "" {
+		g.deny(models.ShareOutcomePasswordRequired)
+		writeError(w, http.StatusUnauthorized, failMsg)
+		return "", false
+	}
+
+	match, legacy, err := verifySharePassword(*g.password, password)
+	if err != nil {
+		slog.Error("share password check failed", g.resource, g.id, "error", err)
+	}
+	if !match {
+		g.deny(models.ShareOutcomeWrongPassword)
+		LogAudit(h.db, AuditEntry{
+			Action:       g.resource + ".password_failed",
+			ResourceType: g.resource,
+			ResourceID:   g.id.String(),
+			IPAddress:    auditIP(r),
+		})
+		if d := h.lockout.fail(g.token); d > 0 {
+			writeLockout(w, d)
+			return "", false
+		}
+		writeError(w, http.StatusUnauthorized, failMsg)
+		return "", false
+	}
+	h.lockout.reset(g.token)
+
+	if legacy {
+		if hash, err := hashSharePassword(password); err == nil &&
+			h.db.Table(g.table).Where("id = ?", g.id).UpdateColumn("password", hash).Error == nil {
+			g.password = &hash
+		}
+	}
+	session, err = h.signShareSession(g)
+	if err != nil {
+		// The password was right; the caller just has to send it again.
+		slog.Error("failed to sign share session", g.resource, g.id, "error", err)
+		return "", true
+	}
+	http.SetCookie(w, &http.Cookie{ // #nosec G124 -- Secure flag controlled by COOKIE_SECURE env var
+		Name:     shareSessionCookie(g),
+		Value:    session,
+		Path:     "/api/v1",
+		MaxAge:   int(shareSessionTTL / time.Second),
+		HttpOnly: true,
+		Secure:   h.cfg.CookieSecure,
+		SameSite: http.SameSiteLaxMode,
+	})
+	return session, true
+}
+
+func writeLockout(w http.ResponseWriter, d time.Duration) {
+	secs := int(math.Ceil(d.Seconds()))
+	w.Header().Set("Retry-After", strconv.Itoa(secs))
+	writeError(w, http.StatusTooManyRequests, fmt.Sprintf("Too many password attempts. Try again in %d seconds.", secs))
+}
@@ -0,0 +1,108 @@
+package handlers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/zynqcloud/api/internal/config"
+	"github.com/zynqcloud/api/internal/models"
+)
+
+func TestSharePasswordHash(t *testing.T) {
+	hash, err := hashSharePassword("correct horse")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(hash, "$argon2id$v=19$") || strings.Contains(hash, "correct horse") {
+		t.Fatalf("unexpected hash %q", hash)
+	}
+	if ok, legacy, err := verifySharePassword(hash, "correct horse"); !ok || legacy || err != nil {
+		t.Errorf("right password: ok=%v legacy=%v err=%v", ok, legacy, err)
+	}
+	if ok, _, _ := verifySharePassword(hash, "correct horse "); ok {
+		t.Error("wrong password accepted")
+	}
+	if other, _ := hashSharePassword("correct horse"); other == hash {
+		t.Error("hashes are not salted")
+	}
+
+	// Plaintext rows from before hashing still verify, flagged for rehashing.
+	if ok, legacy, _ := verifySharePassword("hunter2", "hunter2"); !ok || !legacy {
+		t.Errorf("legacy password: ok=%v legacy=%v", ok, legacy)
+	}
+	if _, _, err := verifySharePassword("$argon2id$v=19$m=1,t=1$bad", "x"); err == nil {
+		t.Error("malformed hash accepted")
+	}
+}
+
+func TestShareLockout(t *testing.T) {
+	l := newShareLockout()
+	now := time.Now()
+	l.now = func() time.Time { return now }
+
+	for i := 1; i < shareLockoutFree; i++ {
+		if d := l.fail("tok"); d != 0 {
+			t.Fatalf("failure %d locked for %v", i, d)
+		}
+	}
+	if d := l.fail("tok"); d != shareLockoutBase {
+		t.Fatalf("first lockout = %v, want %v", d, shareLockoutBase)
+	}
+	if l.retryAfter("tok") != shareLockoutBase || l.retryAfter("other") != 0 {
+		t.Error("lockout not keyed by token")
+	}
+	if d := l.fail("tok"); d != 2*shareLockoutBase {
+		t.Errorf("second lockout = %v, want %v", d, 2*shareLockoutBase)
+	}
+	for range 10 {
+		l.fail("tok")
+	}
+	if d := l.retryAfter("tok"); d != shareLockoutMax {
+		t.Errorf("lockout = %v, want the %v cap", d, shareLockoutMax)
+	}
+
+	now = now.Add(shareLockoutMax)
+	if l.retryAfter("tok") != 0 {
+		t.Error("lockout did not expire")
+	}
+	l.reset("tok")
+	if d := l.fail("tok"); d != 0 {
+		t.Errorf("failure after reset locked for %v", d)
+	}
+}
+
+func TestShareSession(t *testing.T) {
+	h := &ShareHandler{cfg: &config.Config{JWTSecret: "test-secret"}}
+	hash, _ := hashSharePassword("pw")
+	token := "tok"
+	share := shareGate(&models.Share{ID: uuid.New(), ShareToken: &token, Password: &hash})
+
+	session, err := h.signShareSession(share)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req := httptest.NewRequest(http.MethodGet, "/api/v1/public/share/tok", nil)
+	req.AddCookie(&http.Cookie{Name: shareSessionCookie(share), Value: session})
+	if !h.validShareSession(req, share) {
+		t.Error("cookie session rejected")
+	}
+	req = httptest.NewRequest(http.MethodGet, "/api/v1/public/share/tok", nil)
+	req.Header.Set(shareSessionHeader, session)
+	if !h.validShareSession(req, share) {
+		t.Error("header session rejected")
+	}
+
+	other := shareGate(&models.Share{ID: uuid.New(), ShareToken: &token, Password: &hash})
+	if h.validShareSession(req, other) {
+		t.Error("session accepted for another share")
+	}
+	newHash, _ := hashSharePassword("new")
+	share.password = &newHash
+	if h.validShareSession(req, share) {
+		t.Error("session survived a password change")
+	}
+}
@@ -0,0 +1,344 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/google/uuid"
+	mw "github.com/zynqcloud/api/internal/middleware"
+	"github.com/zynqcloud/api/internal/models"
+)
+
+// Public folder shares
+//
+// A public share of a folder opens everything below it. Items inside are
+// addressed by ID, never by a client-supplied path: each one is resolved by
+// walking its parents up to the shared folder, so an ID outside the subtree
+// (or below a deleted folder) is simply not found. Paths in responses and
+// ZIP archives are relative to the shared folder.
+
+const (
+	// shareTreeMaxDepth bounds the parent walks and listings below a shared
+	// folder.
+	shareTreeMaxDepth = 64
+	// shareListMaxLimit caps the page size of a share listing.
+	shareListMaxLimit = 500
+	// shareZipMaxItems caps the items picked for one ZIP download.
+	shareZipMaxItems = 1000
+)
+
+var errNotInShare = errors.New("item is not inside the share")
+
+// shareChainLink is one step of the walk from an item up to the shared
+// folder, Depth 0 being the item itself.
+type shareChainLink struct {
+	ID    uuid.UUID
+	Name  string
+	Depth int
+}
+
+// shareItemPath returns the path of the item at the head of chain, ordered
+// by depth, relative to root, or false when the chain does not end at root.
+// Root itself has the empty path.
+func shareItemPath(chain []shareChainLink, root uuid.UUID) (string, bool) {
+	if len(chain) == 0 || chain[len(chain)-1].ID != root {
+		return "", false
+	}
+	names := make([]string, 0, len(chain)-1)
+	for i := len(chain) - 2; i >= 0; i-- {
+		names = append(names, chain[i].Name)
+	}
+	return strings.Join(names, "/"), true
+}
+
+// shareItem loads the live item id inside the shared folder root and its
+// path relative to root.
+func (h *ShareHandler) shareItem(root, id uuid.UUID) (*models.File, string, error) {
+	var chain []shareChainLink
+	if err := h.db.Raw(`
+		WITH RECURSIVE chain AS (
+			SELECT id, parent_id, name, 0 AS depth FROM files
+			WHERE id = ? AND deleted_at IS NULL
+			UNION ALL
+			SELECT f.id, f.parent_id, f.name, c.depth + 1 FROM files f
+			INNER JOIN chain c ON f.id = c.parent_id
+			WHERE c.id <> ? AND f.deleted_at IS NULL AND c.depth < ?
+		)
+		SELECT id, name, depth FROM chain ORDER BY depth
+	`, id, root, shareTreeMaxDepth).Scan(&chain).Error; err != nil {
+		return nil, "", err
+	}
+	path, ok := shareItemPath(chain, root)
+	if !ok {
+		return nil, "", errNotInShare
+	}
+	var file models.File
+	if err := h.db.First(&file, "id = ? AND deleted_at IS NULL", id).Error; err != nil {
+		return nil, "", err
+	}
+	return &file, path, nil
+}
+
+// publicFolderShare loads the public share behind the {token} URL parameter,
+// checks its password, and makes sure it shares a live folder. It writes the
+// error response itself when it returns false.
+func (h *ShareHandler) publicFolderShare(w http.ResponseWriter, r *http.Request) (*models.Share, bool) {
+	token := chi.URLParam(r, "token")
+
+	var share models.Share
+	if err := h.db.Preload("File").Where("share_token = ? AND is_public = true", token).First(&share).Error; err != nil {
+		writeError(w, http.StatusNotFound, "Share not found")
+		return nil, false
+	}
+	if !h.checkShareOpen(w, r, &share) {
+		return nil, false
+	}
+	if _, ok := h.authorizeShare(w, r, &share, r.Header.Get("x-share-password"), "Password required"); !ok {
+		return nil, false
+	}
+	if share.File == nil || share.File.DeletedAt != nil {
+		writeError(w, http.StatusNotFound, "File not found")
+		return nil, false
+	}
+	if !share.File.IsFolder {
+		writeError(w, http.StatusBadRequest, "Share is not a folder")
+		return nil, false
+	}
+	return &share, true
+}
+
+// logShareDownload records a download from a public share, by a signed-in
+// user when there is one.
+func (h *ShareHandler) logShareDownload(r *http.Request, share *models.Share, file *models.File, meta models.JSONB) {
+	meta["share_token"] = *share.ShareToken
+	meta["type"] = "download"
+	meta["is_folder"] = file.IsFolder
+	entry := AuditEntry{
+		Action:       "share.access",
+		ResourceType: "file",
+		ResourceName: file.Name,
+		ResourceID:   file.ID.String(),
+		IPAddress:    auditIP(r),
+		Metadata:     meta,
+	}
+	if claims := mw.GetClaims(r); claims != nil {
+		if uid, err := uuid.Parse(claims.Sub); err == nil {
+			entry.UserID = &uid
+		}
+		entry.UserName = claims.Email
+		entry.UserEmail = claims.Email
+	}
+	LogAudit(h.db, entry)
+}
+
+func (h *ShareHandler) filesHandler() *FilesHandler {
+	return NewFilesHandler(h.db, h.cfg, h.crypto, h.backend)
+}
+
+type shareListItem struct {
+	ID        uuid.UUID `json:"id"`
+	ParentID  uuid.UUID `json:"parentId"`
+	Name      string    `json:"name"`
+	Path      string    `json:"path"`
+	IsFolder  bool      `json:"isFolder"`
+	Size      int64     `json:"size"`
+	MimeType  *string   `json:"mimeType"`
+	UpdatedAt time.Time `json:"updatedAt"`
+}
+
+// GET /api/v1/public/share/{token}/items
+//
+// Lists a folder inside a public folder share: the shared folder itself, or
+// the one given by parentId. With recursive=true the whole subtree below it
+// is listed, ordered by path.
+func (h *ShareHandler) ListPublicShare(w http.ResponseWriter, r *http.Request) {
+	share, ok := h.publicFolderShare(w, r)
+	if !ok {
+		return
+	}
+
+	q := r.URL.Query()
+	page, _ := strconv.Atoi(q.Get("page"))
+	if page < 1 {
+		page = 1
+	}
+	limit, _ := strconv.Atoi(q.Get("limit"))
+	if limit <= 0 {
+		limit = 50
+	}
+	limit = min(limit, shareListMaxLimit)
+	offset := (page - 1) * limit
+
+	parent := share.File
+	prefix := ""
+	if p := q.Get("parentId"); p != "" && p != "root" {
+		parentID, err := uuid.Parse(p)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, "Invalid parentId")
+			return
+		}
+		file, path, err := h.shareItem(share.File.ID, parentID)
+		if err != nil || !file.IsFolder {
+			writeError(w, http.StatusNotFound, "Folder not found")
+			return
+		}
+		parent = file
+		if path != "" {
+			prefix = path + "/"
+		}
+	}
+
+	depth, order := 1, "f.is_folder DESC, t.path"
+	if q.Get("recursive") == "true" {
+		depth, order = shareTreeMaxDepth, "t.path"
+	}
+	// Paths are built relative to parent and prefixed afterwards.
+	const tree = `
+		WITH RECURSIVE tree AS (
+			SELECT id, is_folder, CAST(name AS TEXT) AS path, 1 AS depth FROM files
+			WHERE parent_id = @parent AND deleted_at IS NULL
+			UNION ALL
+			SELECT f.id, f.is_folder, t.path || '/' || f.name, t.depth + 1 FROM files f
+			INNER JOIN tree t ON f.parent_id = t.id
+			WHERE t.is_folder AND f.deleted_at IS NULL AND t.depth < @depth
+		)`
+	args := map[string]interface{}{"parent": parent.ID, "depth": depth, "limit": limit, "offset": offset}
+
+	var total int64
+	if err := h.db.Raw(tree+` SELECT COUNT(*) FROM tree`, args).Scan(&total).Error; err != nil {
+		writeError(w, http.StatusInternalServerError, "Failed to list share")
+		return
+	}
+	items := []shareListItem{}
+	if err := h.db.Raw(tree+`
+		SELECT f.id, f.parent_id, f.name, t.path, f.is_folder, f.size, f.mime_type, f.updated_at
+		FROM tree t INNER JOIN files f ON f.id = t.id
+		ORDER BY `+order+`
+		LIMIT @limit OFFSET @offset`, args).Scan(&items).Error; err != nil {
+		writeError(w, http.StatusInternalServerError, "Failed to list share")
+		return
+	}
+	for i := range items {
+		items[i].Path = prefix + items[i].Path
+	}
+
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"items": items,
+		"meta": map[string]interface{}{
+			"total": total,
+			"page":  page,
+			"limit": limit,
+		},
+	})
+}
+
+// GET /api/v1/public/share/{token}/items/{id}/download
+//
+// Downloads one file inside a public folder share, or a folder inside it as
+// a ZIP archive.
+func (h *ShareHandler) DownloadPublicShareItem(w http.ResponseWriter, r *http.Request) {
+	share, ok := h.publicFolderShare(w, r)
+	if !ok {
+		return
+	}
+	id, err := uuid.Parse(chi.URLParam(r, "id"))
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "Invalid file ID")
+		return
+	}
+	file, path, err := h.shareItem(share.File.ID, id)
+	if err != nil {
+		writeError(w, http.StatusNotFound, "File not found")
+		return
+	}
+
+	if !file.IsFolder && file.StoragePath == nil {
+		writeError(w, http.StatusNotFound, "File data not found")
+		return
+	}
+	if !h.takeShareDownload(w, r, share, file) {
+		return
+	}
+
+	h.logShareDownload(r, share, file, models.JSONB{"path": path})
+	fh := h.filesHandler()
+	if file.IsFolder {
+		fh.streamFolderAsZip(w, r, file)
+		return
+	}
+	fh.streamDecryptedFile(w, r, file)
+}
+
+// parseShareSelection reads the ids query parameter, given repeated or
+// comma-separated, without duplicates.
+func parseShareSelection(values []string) ([]uuid.UUID, error) {
+	var ids []uuid.UUID
+	seen := make(map[uuid.UUID]bool)
+	for _, v := range values {
+		for _, s := range strings.Split(v, ",") {
+			if s = strings.TrimSpace(s); s == "" {
+				continue
+			}
+			id, err := uuid.Parse(s)
+			if err != nil {
+				return nil, err
+			}
+			if !seen[id] {
+				seen[id] = true
+				ids = append(ids, id)
+			}
+		}
+	}
+	return ids, nil
+}
+
+// downloadShareSelection streams the items ids inside the folder share as
+// one ZIP archive, each at its path relative to the shared folder.
+func (h *ShareHandler) downloadShareSelection(w http.ResponseWriter, r *http.Request, share *models.Share, ids []uuid.UUID) {
+	if len(ids) > shareZipMaxItems {
+		writeError(w, http.StatusBadRequest, "Too many items selected")
+		return
+	}
+	fh := h.filesHandler()
+	var entries []zipEntry
+	paths := make([]string, 0, len(ids))
+	for _, id := range ids {
+		file, path, err := h.shareItem(share.File.ID, id)
+		if err != nil {
+			writeError(w, http.StatusNotFound, "File not found")
+			return
+		}
+		paths = append(paths, path)
+		switch {
+		case path == "":
+			entries = fh.collectZipEntries(entries, file.ID, "")
+		case file.IsFolder:
+			entries = fh.collectZipEntries(entries, file.ID, path+"/")
+		case file.StoragePath != nil:
+			entries = append(entries, zipEntry{file: *file, path: path})
+		}
+	}
+	// A folder and something inside it may both be picked.
+	seen := make(map[uuid.UUID]bool, len(entries))
+	unique := entries[:0]
+	for _, e := range entries {
+		if !seen[e.file.ID] {
+			seen[e.file.ID] = true
+			unique = append(unique, e)
+		}
+	}
+	entries = unique
+	if len(entries) == 0 {
+		writeError(w, http.StatusNotFound, "Nothing to download")
+		return
+	}
+	if !h.takeShareDownload(w, r, share, share.File) {
+		return
+	}
+	h.logShareDownload(r, share, share.File, models.JSONB{"selection": paths})
+	fh.streamZip(w, r, share.File.Name+".zip", entries)
+}
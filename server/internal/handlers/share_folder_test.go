@@ -0,0 +1,42 @@
+package handlers
+
+import (
+	"testing"
+
+	"github.com/google/uuid"
+)
+
+func TestShareItemPath(t *testing.T) {
+	root, docs, file := uuid.New(), uuid.New(), uuid.New()
+	chain := []shareChainLink{{file, "report.pdf", 0}, {docs, "docs", 1}, {root, "Shared", 2}}
+	if path, ok := shareItemPath(chain, root); !ok || path != "docs/report.pdf" {
+		t.Errorf("path = %q, %v", path, ok)
+	}
+	if path, ok := shareItemPath(chain[2:], root); !ok || path != "" {
+		t.Errorf("root path = %q, %v", path, ok)
+	}
+
+	// A walk that runs past the top of the tree without meeting the shared
+	// folder is outside it.
+	outside := []shareChainLink{{file, "report.pdf", 0}, {docs, "docs", 1}}
+	if _, ok := shareItemPath(outside, root); ok {
+		t.Error("item outside the share resolved")
+	}
+	if _, ok := shareItemPath(nil, root); ok {
+		t.Error("missing item resolved")
+	}
+}
+
+func TestParseShareSelection(t *testing.T) {
+	a, b := uuid.New(), uuid.New()
+	got, err := parseShareSelection([]string{a.String() + ", " + b.String(), a.String(), ""})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != 2 || got[0] != a || got[1] != b {
+		t.Errorf("got %v", got)
+	}
+	if _, err := parseShareSelection([]string{"../etc/passwd"}); err == nil {
+		t.Error("non-UUID accepted")
+	}
+}
@@ -0,0 +1,236 @@
+package handlers
+
+import (
+	"log/slog"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
+	mw "github.com/zynqcloud/api/internal/middleware"
+	"github.com/zynqcloud/api/internal/models"
+	"gorm.io/gorm"
+)
+
+// Share access log
+//
+// Every hit on a public link is recorded in share_access_log with its
+// outcome (models.ShareOutcome*), for the owner to read through
+// ShareAccessLog. A public link may also carry max_downloads, after which
+// it counts as expired. Every response counts against the allowance except
+// a range from a later byte than the first that continues a download this
+// client was already charged for, so a video scrubbed in the browser does
+// not use up the allowance. A counted download of a file sets a download
+// ticket: a signed cookie naming the share, the file and its ETag, which
+// lets the client's later ranges of that same content through uncounted.
+// Anything sent from the start of the file counts, whatever the Range
+// header said, and ZIP archives ignore ranges and always count.
+
+const (
+	// shareUserAgentLimit caps the user agent kept per hit.
+	shareUserAgentLimit = 512
+
+	shareTicketTTL = 12 * time.Hour
+	shareTicketAud = "share-download"
+)
+
+type shareTicketClaims struct {
+	FileID string `json:"fid"`
+	ETag   string `json:"etag"`
+	jwt.RegisteredClaims
+}
+
+// recordShareAccess adds a hit on the public link shareID to its log.
+func recordShareAccess(db *gorm.DB, r *http.Request, shareID uuid.UUID, outcome string) {
+	ua := r.UserAgent()
+	if len(ua) > shareUserAgentLimit {
+		ua = ua[:shareUserAgentLimit]
+	}
+	db.Create(&models.ShareAccess{
+		ShareID:   shareID,
+		Outcome:   outcome,
+		IPAddress: auditIP(r),
+		UserAgent: ua,
+	})
+}
+
+// shareExpired reports whether a public link is past its expiry or out of
+// downloads.
+func shareExpired(share *models.Share) bool {
+	if share.ExpiresAt != nil && share.ExpiresAt.Before(time.Now()) {
+		return true
+	}
+	return share.MaxDownloads != nil && share.DownloadCount >= *share.MaxDownloads
+}
+
+// countsAsDownload reports whether serving file through share for r is
+// charged as a download. It looks at the range the download path will
+// actually serve, not at the raw header, and lets a later range through
+// only with a download ticket for the same content.
+func (h *ShareHandler) countsAsDownload(r *http.Request, share *models.Share, file *models.File) bool {
+	if file.IsFolder {
+		return true
+	}
+	start, _, partial, err := requestedRange(r, file.Size, fileETag(file), file.UpdatedAt)
+	if err != nil {
+		// Answered with 416; nothing is sent.
+		return false
+	}
+	if !partial || start == 0 {
+		return true
+	}
+	return !h.validShareTicket(r, share, file)
+}
+
+func (h *ShareHandler) shareTicketKey() []byte {
+	return derivePurposeKey(h.cfg.JWTSecret, "zynqcloud share download v1")
+}
+
+func shareTicketCookie(file *models.File) string {
+	return "zdl_" + file.ID.String()
+}
+
+func (h *ShareHandler) signShareTicket(share *models.Share, file *models.File) (string, error) {
+	now := time.Now()
+	return jwt.NewWithClaims(jwt.SigningMethodHS256, &shareTicketClaims{
+		FileID: file.ID.String(),
+		ETag:   fileETag(file),
+		RegisteredClaims: jwt.RegisteredClaims{
+			Subject:   share.ID.String(),
+			Audience:  jwt.ClaimStrings{shareTicketAud},
+			ExpiresAt: jwt.NewNumericDate(now.Add(shareTicketTTL)),
+			IssuedAt:  jwt.NewNumericDate(now),
+		},
+	}).SignedString(h.shareTicketKey())
+}
+
+// validShareTicket reports whether r carries a download ticket for file, as
+// it is now, issued through share.
+func (h *ShareHandler) validShareTicket(r *http.Request, share *models.Share, file *models.File) bool {
+	c, err := r.Cookie(shareTicketCookie(file))
+	if err != nil {
+		return false
+	}
+	claims := &shareTicketClaims{}
+	_, err = jwt.ParseWithClaims(c.Value, claims, func(*jwt.Token) (interface{}, error) {
+		return h.shareTicketKey(), nil
+	}, jwt.WithValidMethods([]string{jwt.SigningMethodHS256.Alg()}), jwt.WithAudience(shareTicketAud))
+	return err == nil && claims.Subject == share.ID.String() &&
+		claims.FileID == file.ID.String() && claims.ETag == fileETag(file)
+}
+
+// setShareTicket gives the client a download ticket for file after a
+// counted download. A client that drops it is charged for every range.
+func (h *ShareHandler) setShareTicket(w http.ResponseWriter, share *models.Share, file *models.File) {
+	ticket, err := h.signShareTicket(share, file)
+	if err != nil {
+		slog.Error("failed to sign share download ticket", "share", share.ID, "error", err)
+		return
+	}
+	http.SetCookie(w, &http.Cookie{ // #nosec G124 -- Secure flag controlled by COOKIE_SECURE env var
+		Name:     shareTicketCookie(file),
+		Value:    ticket,
+		Path:     "/api/v1",
+		MaxAge:   int(shareTicketTTL / time.Second),
+		HttpOnly: true,
+		Secure:   h.cfg.CookieSecure,
+		SameSite: http.SameSiteLaxMode,
+	})
+}
+
+// checkShareOpen answers 410 and logs the hit when share has expired.
+func (h *ShareHandler) checkShareOpen(w http.ResponseWriter, r *http.Request, share *models.Share) bool {
+	if shareExpired(share) {
+		recordShareAccess(h.db, r, share.ID, models.ShareOutcomeExpired)
+		writeError(w, http.StatusGone, "Share has expired")
+		return false
+	}
+	return true
+}
+
+// takeShareDownload counts a download of file through share against the
+// share's allowance and logs it. It answers 410 when the allowance ran out
+// in the meantime.
+func (h *ShareHandler) takeShareDownload(w http.ResponseWriter, r *http.Request, share *models.Share, file *models.File) bool {
+	if !h.countsAsDownload(r, share, file) {
+		return true
+	}
+	res := h.db.Model(&models.Share{}).
+		Where("id = ? AND (max_downloads IS NULL OR download_count < max_downloads)", share.ID).
+		UpdateColumn("download_count", gorm.Expr("download_count + 1"))
+	if res.Error != nil || res.RowsAffected == 0 {
+		recordShareAccess(h.db, r, share.ID, models.ShareOutcomeExpired)
+		writeError(w, http.StatusGone, "Share has expired")
+		return false
+	}
+	share.DownloadCount++
+	recordShareAccess(h.db, r, share.ID, models.ShareOutcomeDownloaded)
+	if !file.IsFolder {
+		h.setShareTicket(w, share, file)
+	}
+	return true
+}
+
+// GET /api/v1/files/public-shares/{shareId}/access
+func (h *FilesHandler) ShareAccessLog(w http.ResponseWriter, r *http.Request) {
+	claims := mw.GetClaims(r)
+	userID, _ := uuid.Parse(claims.Sub)
+
+	shareID, err := uuid.Parse(chi.URLParam(r, "shareId"))
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "Invalid share ID")
+		return
+	}
+	var share models.Share
+	if err := h.db.Where("id = ? AND created_by = ? AND is_public = true", shareID, userID).First(&share).Error; err != nil {
+		writeError(w, http.StatusNotFound, "Share not found")
+		return
+	}
+
+	q := r.URL.Query()
+	page, _ := strconv.Atoi(q.Get("page"))
+	if page < 1 {
+		page = 1
+	}
+	limit, _ := strconv.Atoi(q.Get("limit"))
+	if limit < 1 || limit > 200 {
+		limit = 50
+	}
+	offset := (page - 1) * limit
+
+	baseQ := h.db.Model(&models.ShareAccess{}).Where("share_id = ?", share.ID)
+	if outcome := q.Get("outcome"); outcome != "" {
+		baseQ = baseQ.Where("outcome = ?", outcome)
+	}
+	var total int64
+	baseQ.Count(&total)
+
+	entries := []models.ShareAccess{}
+	baseQ.Order("created_at DESC").Offset(offset).Limit(limit).Find(&entries)
+
+	type outcomeCount struct {
+		Outcome string
+		Count   int64
+	}
+	var counts []outcomeCount
+	h.db.Model(&models.ShareAccess{}).Select("outcome, COUNT(*) AS count").
+		Where("share_id = ?", share.ID).Group("outcome").Scan(&counts)
+	summary := make(map[string]int64, len(counts))
+	for _, c := range counts {
+		summary[c.Outcome] = c.Count
+	}
+
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"items":         entries,
+		"summary":       summary,
+		"downloadCount": share.DownloadCount,
+		"maxDownloads":  share.MaxDownloads,
+		"meta": map[string]interface{}{
+			"total": total,
+			"page":  page,
+			"limit": limit,
+		},
+	})
+}
@@ -0,0 +1,114 @@
+package handlers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/zynqcloud/api/internal/config"
+	"github.com/zynqcloud/api/internal/models"
+)
+
+func TestShareExpired(t *testing.T) {
+	past, future := time.Now().Add(-time.Minute), time.Now().Add(time.Hour)
+	three := 3
+	cases := []struct {
+		name  string
+		share models.Share
+		want  bool
+	}{
+		{"open", models.Share{}, false},
+		{"future expiry", models.Share{ExpiresAt: &future}, false},
+		{"past expiry", models.Share{ExpiresAt: &past}, true},
+		{"downloads left", models.Share{MaxDownloads: &three, DownloadCount: 2}, false},
+		{"downloads used up", models.Share{MaxDownloads: &three, DownloadCount: 3}, true},
+	}
+	for _, c := range cases {
+		if got := shareExpired(&c.share); got != c.want {
+			t.Errorf("%s: shareExpired = %v, want %v", c.name, got, c.want)
+		}
+	}
+}
+
+func TestCountsAsDownload(t *testing.T) {
+	h := &ShareHandler{cfg: &config.Config{JWTSecret: "test-secret"}}
+	share := &models.Share{ID: uuid.New()}
+	file := &models.File{ID: uuid.New(), Size: 4096, UpdatedAt: time.Now()}
+	ticket, err := h.signShareTicket(share, file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	request := func(rng, cookie string) *http.Request {
+		r := httptest.NewRequest(http.MethodGet, "/api/v1/public/share/tok/download", nil)
+		if rng != "" {
+			r.Header.Set("Range", rng)
+		}
+		if cookie != "" {
+			r.AddCookie(&http.Cookie{Name: shareTicketCookie(file), Value: cookie})
+		}
+		return r
+	}
+
+	for rng, want := range map[string]bool{
+		"":                    true,
+		"bytes=0-":            true,
+		"bytes=0-0":           true,
+		"bytes=0-1023":        true,
+		"bytes=1-":            false,
+		"bytes=1024-":         false,
+		"bytes=500-1000":      false,
+		"bytes=-100":          false,
+		"bytes=-999999999999": true, // suffix covering the whole file
+		"bytes=1-,2":          true, // multiple ranges: served in full
+		"bytes=1-2,3-4":       true,
+		"foo":                 true,
+		"bytes=abc-":          true,
+		"bytes=5000-":         false, // 416, nothing sent
+	} {
+		if got := h.countsAsDownload(request(rng, ticket), share, file); got != want {
+			t.Errorf("Range %q with a ticket: countsAsDownload = %v, want %v", rng, got, want)
+		}
+	}
+
+	// Without a ticket a later range did not continue a counted download.
+	for _, rng := range []string{"bytes=1-", "bytes=1024-", "bytes=-100"} {
+		if !h.countsAsDownload(request(rng, ""), share, file) {
+			t.Errorf("Range %q without a ticket: download not counted", rng)
+		}
+		if !h.countsAsDownload(request(rng, "garbage"), share, file) {
+			t.Errorf("Range %q with a forged ticket: download not counted", rng)
+		}
+	}
+
+	// A ticket only covers the share, file and content it was issued for.
+	other := &models.Share{ID: uuid.New()}
+	if !h.countsAsDownload(request("bytes=1-", ticket), other, file) {
+		t.Error("ticket accepted for another share")
+	}
+	sibling := *file
+	sibling.ID = uuid.New()
+	r := request("bytes=1-", "")
+	r.AddCookie(&http.Cookie{Name: shareTicketCookie(&sibling), Value: ticket})
+	if !h.countsAsDownload(r, share, &sibling) {
+		t.Error("ticket accepted for another file")
+	}
+	changed := *file
+	changed.UpdatedAt = file.UpdatedAt.Add(time.Second)
+	if !h.countsAsDownload(request("bytes=1-", ticket), share, &changed) {
+		t.Error("ticket survived a content change")
+	}
+
+	// A stale If-Range makes the server send the whole file.
+	r = request("bytes=1024-", ticket)
+	r.Header.Set("If-Range", `"stale"`)
+	if !h.countsAsDownload(r, share, file) {
+		t.Error("stale If-Range: download not counted")
+	}
+
+	// Folder archives ignore ranges.
+	if !h.countsAsDownload(request("bytes=1024-", ticket), share, &models.File{IsFolder: true}) {
+		t.Error("folder zip: download not counted")
+	}
+}
@@ -0,0 +1,145 @@
+package handlers
+
+import (
+	"github.com/google/uuid"
+	"github.com/zynqcloud/api/internal/models"
+	"gorm.io/gorm"
+)
+
+// Private share permissions
+//
+// A private share grants read, comment, write or reshare on a personal file
+// or folder, each permission including the ones before it; a folder share
+// covers everything below the folder. Every grantee can read the file's
+// comments and comment lets them add their own. Write lets the grantee
+// upload new content, rename, and add files to a shared folder (charged to
+// the owner); reshare also lets them share the item privately with others,
+// at most with their own permission. Moving, deleting and public links stay
+// with the owner.
+//
+// A share made by someone other than the owner only counts while its
+// creator still holds reshare, so revoking a grant also voids everything
+// passed on from it.
+
+// shareReshareMaxHops bounds how many re-shares sharedPermission follows
+// back towards the owner.
+const shareReshareMaxHops = 8
+
+// sharePermissionLevel ranks a share permission, 0 for unknown values.
+func sharePermissionLevel(permission string) int {
+	switch permission {
+	case models.SharePermissionRead:
+		return 1
+	case models.SharePermissionComment:
+		return 2
+	case models.SharePermissionWrite:
+		return 3
+	case models.SharePermissionReshare:
+		return 4
+	}
+	return 0
+}
+
+// sharePermits reports whether holding permission have allows want.
+func sharePermits(have, want string) bool {
+	level := sharePermissionLevel(want)
+	return level > 0 && sharePermissionLevel(have) >= level
+}
+
+// sharedPermission returns the strongest permission userID holds on the
+// personal file fileID through live private shares of the file or of a
+// folder above it, made to them or to one of their groups, or "" when
+// nothing is shared with them.
+func sharedPermission(db *gorm.DB, fileID, userID uuid.UUID) string {
+	return sharedPermissionWithin(db, fileID, userID, shareReshareMaxHops)
+}
+
+func sharedPermissionWithin(db *gorm.DB, fileID, userID uuid.UUID, hops int) string {
+	var grants []struct {
+		FileID     uuid.UUID
+		OwnerID    uuid.UUID
+		CreatedBy  uuid.UUID
+		Permission string
+	}
+	db.Raw(`
+		WITH RECURSIVE chain AS (
+			SELECT id, parent_id, owner_id, 0 AS depth FROM files
+			WHERE id = @file AND deleted_at IS NULL AND space_id IS NULL
+			UNION ALL
+			SELECT f.id, f.parent_id, f.owner_id, c.depth + 1 FROM files f
+			INNER JOIN chain c ON f.id = c.parent_id
+			WHERE f.deleted_at IS NULL AND c.depth < @maxDepth
+		)
+		SELECT s.file_id, c.owner_id, s.created_by, s.permission
+		FROM shares s
+		INNER JOIN chain c ON c.id = s.file_id
+		WHERE s.is_public = false
+		  AND (s.grantee_user_id = @user
+		    OR s.grantee_email = (SELECT email FROM users WHERE id = @user)
+		    OR s.grantee_group_id IN (SELECT group_id FROM user_group_members WHERE user_id = @user))
+		  AND (s.expires_at IS NULL OR s.expires_at > NOW())
+	`, map[string]interface{}{"file": fileID, "user": userID, "maxDepth": shareTreeMaxDepth}).Scan(&grants)
+
+	best := ""
+	for _, g := range grants {
+		if sharePermissionLevel(g.Permission) <= sharePermissionLevel(best) {
+			continue
+		}
+		if g.CreatedBy != g.OwnerID {
+			if hops == 0 || !sharePermits(sharedPermissionWithin(db, g.FileID, g.CreatedBy, hops-1), models.SharePermissionReshare) {
+				continue
+			}
+		}
+		best = g.Permission
+	}
+	return best
+}
+
+// loadPersonalFile returns a live personal file the caller owns or that is
+// shared with them, and the permission they hold on it. Owners hold
+// reshare; callers that must tell them apart compare OwnerID.
+func loadPersonalFile(db *gorm.DB, fileID, userID uuid.UUID) (*models.File, string, error) {
+	var f models.File
+	if err := db.Where("id = ? AND deleted_at IS NULL AND space_id IS NULL", fileID).First(&f).Error; err != nil {
+		return nil, "", errFileNotFound
+	}
+	if f.OwnerID == userID {
+		return &f, models.SharePermissionReshare, nil
+	}
+	permission := sharedPermission(db, f.ID, userID)
+	if permission == "" {
+		return nil, "", errFileNotFound
+	}
+	return &f, permission, nil
+}
+
+// sharedRootIDs returns the live personal files and folders shared with
+// userID, directly or through one of their groups, by a share that counts
+// for sharedPermission. Everything live below them is shared too.
+func sharedRootIDs(db *gorm.DB, userID uuid.UUID) []uuid.UUID {
+	var candidates []struct {
+		ID      uuid.UUID
+		ByOwner bool
+	}
+	db.Raw(`
+		SELECT f.id, BOOL_OR(s.created_by = f.owner_id) AS by_owner
+		FROM shares s
+		INNER JOIN files f ON f.id = s.file_id
+		WHERE f.deleted_at IS NULL AND f.space_id IS NULL
+		  AND s.is_public = false
+		  AND (s.grantee_user_id = @user
+		    OR s.grantee_email = (SELECT email FROM users WHERE id = @user)
+		    OR s.grantee_group_id IN (SELECT group_id FROM user_group_members WHERE user_id = @user))
+		  AND (s.expires_at IS NULL OR s.expires_at > NOW())
+		GROUP BY f.id
+	`, map[string]interface{}{"user": userID}).Scan(&candidates)
+
+	ids := make([]uuid.UUID, 0, len(candidates))
+	for _, c := range candidates {
+		// Re-shares only count while their creator may still pass it on.
+		if c.ByOwner || sharedPermission(db, c.ID, userID) != "" {
+			ids = append(ids, c.ID)
+		}
+	}
+	return ids
+}
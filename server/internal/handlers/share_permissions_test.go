@@ -0,0 +1,52 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/zynqcloud/api/internal/models"
+	"gorm.io/gorm"
+)
+
+func TestSharePermits(t *testing.T) {
+	order := []string{
+		models.SharePermissionRead,
+		models.SharePermissionComment,
+		models.SharePermissionWrite,
+		models.SharePermissionReshare,
+	}
+	for i, have := range order {
+		for j, want := range order {
+			if got := sharePermits(have, want); got != (i >= j) {
+				t.Errorf("sharePermits(%q, %q) = %v", have, want, got)
+			}
+		}
+	}
+	for _, bad := range []string{"", "edit", "READ", "admin"} {
+		if sharePermissionLevel(bad) != 0 {
+			t.Errorf("%q ranked as a permission", bad)
+		}
+		if sharePermits(bad, models.SharePermissionRead) {
+			t.Errorf("%q allowed read", bad)
+		}
+		if sharePermits(models.SharePermissionReshare, bad) {
+			t.Errorf("reshare allowed %q", bad)
+		}
+	}
+}
+
+func TestWriteUploadFileError(t *testing.T) {
+	for err, want := range map[error]int{
+		gorm.ErrRecordNotFound:                  http.StatusNotFound,
+		errNoWriteAccess:                        http.StatusForbidden,
+		errors.New("cannot upload to a folder"): http.StatusBadRequest,
+	} {
+		w := httptest.NewRecorder()
+		writeUploadFileError(w, err)
+		if w.Code != want {
+			t.Errorf("%v: status %d, want %d", err, w.Code, want)
+		}
+	}
+}
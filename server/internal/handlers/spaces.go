@@ -1,15 +1,10 @@
 package handlers
 
 import (
-	"crypto/sha256"
 	"encoding/hex"
 	"fmt"
-	"io"
 	"log/slog"
-	"mime"
 	"net/http"
-	"os"
-	"path/filepath"
 	"strconv"
 	"strings"
 	"time"
@@ -30,19 +25,96 @@ type SpacesHandler struct {
 	cfg     *config.Config
 	crypto  *crypto.Crypto
 	backend storage.Backend
+	cas     *storage.CAS
 }
 
 func NewSpacesHandler(db *gorm.DB, cfg *config.Config, c *crypto.Crypto, backend storage.Backend) *SpacesHandler {
-	return &SpacesHandler{db: db, cfg: cfg, crypto: c, backend: backend}
+	return &SpacesHandler{db: db, cfg: cfg, crypto: c, backend: backend, cas: storage.NewCAS(backend)}
+}
+
+var validSpaceRoles = map[string]bool{
+	models.SpaceRoleViewer:      true,
+	models.SpaceRoleContributor: true,
+	models.SpaceRoleAdmin:       true,
+}
+
+var spaceRoleRank = map[string]int{
+	models.SpaceRoleViewer:      1,
+	models.SpaceRoleContributor: 2,
+	models.SpaceRoleAdmin:       3,
+}
+
+// strongestSpaceRole returns the highest-ranked of roles, "" for none.
+func strongestSpaceRole(roles []string) string {
+	best := ""
+	for _, r := range roles {
+		if spaceRoleRank[r] > spaceRoleRank[best] {
+			best = r
+		}
+	}
+	return best
+}
+
+// userSpacesSQL selects the IDs of the spaces @user belongs to, directly or
+// through one of their groups.
+const userSpacesSQL = `
+	SELECT space_id FROM space_members WHERE user_id = @user
+	UNION
+	SELECT sg.space_id FROM space_group_members sg
+	INNER JOIN user_group_members gm ON gm.group_id = sg.group_id
+	WHERE gm.user_id = @user`
+
+// spaceRoles returns the caller's role in each space they belong to: the
+// strongest of their own membership and those of their groups.
+func spaceRoles(db *gorm.DB, userID uuid.UUID, spaceID *uuid.UUID) map[uuid.UUID]string {
+	q := `
+		SELECT space_id, role FROM space_members WHERE user_id = @user
+		UNION ALL
+		SELECT sg.space_id, sg.role FROM space_group_members sg
+		INNER JOIN user_group_members gm ON gm.group_id = sg.group_id
+		WHERE gm.user_id = @user`
+	args := map[string]interface{}{"user": userID}
+	if spaceID != nil {
+		q = `SELECT space_id, role FROM (` + q + `) r WHERE space_id = @space`
+		args["space"] = *spaceID
+	}
+	var rows []struct {
+		SpaceID uuid.UUID
+		Role    string
+	}
+	db.Raw(q, args).Scan(&rows)
+
+	bySpace := make(map[uuid.UUID][]string)
+	for _, row := range rows {
+		bySpace[row.SpaceID] = append(bySpace[row.SpaceID], row.Role)
+	}
+	roles := make(map[uuid.UUID]string, len(bySpace))
+	for id, rs := range bySpace {
+		roles[id] = strongestSpaceRole(rs)
+	}
+	return roles
 }
 
 // spaceRole returns the caller's role in the space, or "" if not a member.
+// Roles held through groups count like the caller's own.
 func spaceRole(db *gorm.DB, spaceID, userID uuid.UUID) string {
-	var m models.SpaceMember
-	if err := db.Where("space_id = ? AND user_id = ?", spaceID, userID).First(&m).Error; err != nil {
-		return ""
-	}
-	return m.Role
+	return spaceRoles(db, userID, &spaceID)[spaceID]
+}
+
+// spaceMemberCount counts the users in a space, directly or through a
+// group, each once.
+func spaceMemberCount(db *gorm.DB, spaceID uuid.UUID) int {
+	var count int64
+	db.Raw(`
+		SELECT COUNT(*) FROM (
+			SELECT user_id FROM space_members WHERE space_id = @space
+			UNION
+			SELECT gm.user_id FROM space_group_members sg
+			INNER JOIN user_group_members gm ON gm.group_id = sg.group_id
+			WHERE sg.space_id = @space
+		) m
+	`, map[string]interface{}{"space": spaceID}).Scan(&count)
+	return int(count)
 }
 
 // canWrite returns true if role allows uploads/creates/renames.
@@ -56,6 +128,12 @@ func isSpaceAdminOrGlobal(spaceRole, userRole string) bool {
 }
 
 func (h *SpacesHandler) logActivity(spaceID, userID uuid.UUID, action string, fileID *uuid.UUID, fileName *string, details models.JSONB) {
+	logSpaceActivity(h.db, spaceID, userID, action, fileID, fileName, details)
+}
+
+// logSpaceActivity records an entry in a space's activity feed. Failures are
+// logged and otherwise ignored.
+func logSpaceActivity(db *gorm.DB, spaceID, userID uuid.UUID, action string, fileID *uuid.UUID, fileName *string, details models.JSONB) {
 	act := &models.SpaceActivity{
 		SpaceID:  spaceID,
 		UserID:   &userID,
@@ -64,7 +142,7 @@ func (h *SpacesHandler) logActivity(spaceID, userID uuid.UUID, action string, fi
 		FileName: fileName,
 		Details:  details,
 	}
-	if err := h.db.Create(act).Error; err != nil {
+	if err := db.Create(act).Error; err != nil {
 		slog.Warn("failed to log space activity", "error", err)
 	}
 }
@@ -74,19 +152,15 @@ func (h *SpacesHandler) List(w http.ResponseWriter, r *http.Request) {
 	claims := mw.GetClaims(r)
 	userID, _ := uuid.Parse(claims.Sub)
 
-	var members []models.SpaceMember
-	h.db.Where("user_id = ?", userID).Find(&members)
-
-	if len(members) == 0 {
+	roleBySpace := spaceRoles(h.db, userID, nil)
+	if len(roleBySpace) == 0 {
 		writeJSON(w, http.StatusOK, []interface{}{})
 		return
 	}
 
-	spaceIDs := make([]uuid.UUID, len(members))
-	roleBySpace := make(map[uuid.UUID]string, len(members))
-	for i, m := range members {
-		spaceIDs[i] = m.SpaceID
-		roleBySpace[m.SpaceID] = m.Role
+	spaceIDs := make([]uuid.UUID, 0, len(roleBySpace))
+	for id := range roleBySpace {
+		spaceIDs = append(spaceIDs, id)
 	}
 
 	var spaces []models.Space
@@ -100,19 +174,18 @@ func (h *SpacesHandler) List(w http.ResponseWriter, r *http.Request) {
 
 	result := make([]spaceResp, len(spaces))
 	for i, s := range spaces {
-		var count int64
-		h.db.Model(&models.SpaceMember{}).Where("space_id = ?", s.ID).Count(&count)
 		result[i] = spaceResp{
 			Space:       s,
 			MyRole:      roleBySpace[s.ID],
-			MemberCount: int(count),
+			MemberCount: spaceMemberCount(h.db, s.ID),
 		}
 	}
 
 	writeJSON(w, http.StatusOK, result)
 }
 
-// POST /api/v1/spaces — admin/owner only; creates space and enrolls all existing users
+// POST /api/v1/spaces — admin/owner only; creates space and, when it is
+// open, enrolls all existing users
 func (h *SpacesHandler) Create(w http.ResponseWriter, r *http.Request) {
 	claims := mw.GetClaims(r)
 	userID, _ := uuid.Parse(claims.Sub)
@@ -125,6 +198,7 @@ func (h *SpacesHandler) Create(w http.ResponseWriter, r *http.Request) {
 	var req struct {
 		Name        string  `json:"name"`
 		Description *string `json:"description"`
+		Visibility  string  `json:"visibility"`
 	}
 	if err := readJSON(r, &req); err != nil {
 		writeError(w, http.StatusBadRequest, "Invalid request body")
@@ -135,40 +209,36 @@ func (h *SpacesHandler) Create(w http.ResponseWriter, r *http.Request) {
 		writeError(w, http.StatusBadRequest, "name is required")
 		return
 	}
+	if req.Visibility == "" {
+		req.Visibility = models.SpaceVisibilityOpen
+	}
+	if !validSpaceVisibilities[req.Visibility] {
+		writeError(w, http.StatusBadRequest, "visibility must be open, discoverable, or private")
+		return
+	}
 
 	space := &models.Space{
 		ID:          uuid.New(),
 		Name:        req.Name,
 		Description: req.Description,
 		CreatedBy:   &userID,
+		Visibility:  req.Visibility,
 	}
 
 	err := h.db.Transaction(func(tx *gorm.DB) error {
 		if err := tx.Create(space).Error; err != nil {
 			return err
 		}
-
-		// Enroll all existing users as contributors
-		var users []models.User
-		tx.Find(&users)
-
-		members := make([]models.SpaceMember, 0, len(users))
-		for _, u := range users {
-			role := models.SpaceRoleContributor
-			if u.Role == "admin" || u.Role == "owner" {
-				role = models.SpaceRoleAdmin
-			}
-			members = append(members, models.SpaceMember{
-				SpaceID: space.ID,
-				UserID:  u.ID,
-				Role:    role,
-				AddedBy: &userID,
-			})
-		}
-		if len(members) > 0 {
-			return tx.Clauses(clause.OnConflict{DoNothing: true}).Create(&members).Error
+		if space.Visibility == models.SpaceVisibilityOpen {
+			return enrollAllUsers(tx, space.ID, &userID)
 		}
-		return nil
+		// Other spaces start with their creator, who adds the rest.
+		return tx.Create(&models.SpaceMember{
+			SpaceID: space.ID,
+			UserID:  userID,
+			Role:    models.SpaceRoleAdmin,
+			AddedBy: &userID,
+		}).Error
 	})
 
 	if err != nil {
@@ -450,165 +520,70 @@ func (h *SpacesHandler) Upload(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	tmpDir := h.backend.(*storage.Local).Root() + "/.uploads"
-	if err := os.MkdirAll(tmpDir, 0o750); err != nil {
-		writeError(w, http.StatusInternalServerError, "Failed to create temp directory")
-		return
-	}
-	tmpFile, err := os.CreateTemp(tmpDir, ".upload-*")
+	staged, err := stageUpload(h.cfg.UploadTempDir, h.crypto, r.Body)
 	if err != nil {
-		writeError(w, http.StatusInternalServerError, "Failed to create temp file")
-		return
-	}
-	tmpPath := tmpFile.Name()
-	defer os.Remove(tmpPath)
-
-	hasher := sha256.New()
-	plainSize, copyErr := io.Copy(tmpFile, io.TeeReader(r.Body, hasher))
-	tmpFile.Close()
-	if copyErr != nil {
 		writeError(w, http.StatusInternalServerError, "Failed to read upload body")
 		return
 	}
-	if plainSize == 0 {
+	defer staged.remove()
+	if staged.size == 0 {
 		writeError(w, http.StatusBadRequest, "Empty file body")
 		return
 	}
 
-	// Detect MIME type
-	mimeType := "application/octet-stream"
-	if ext := filepath.Ext(file.Name); ext != "" {
-		if extMime := mime.TypeByExtension(ext); extMime != "" {
-			mimeType = extMime
-		}
-	}
-	if mimeType == "application/octet-stream" {
-		if tf, err := os.Open(tmpPath); err == nil { // #nosec G304 -- tmpPath from os.CreateTemp
-			sniff := make([]byte, 512)
-			n, _ := tf.Read(sniff)
-			tf.Close()
-			if n > 0 {
-				detected := http.DetectContentType(sniff[:n])
-				if i := strings.IndexByte(detected, ';'); i != -1 {
-					detected = strings.TrimSpace(detected[:i])
-				}
-				mimeType = detected
-			}
-		}
+	if uerr := h.storeUploadedContent(&file, spaceID, userID, staged); uerr != nil {
+		writeError(w, uerr.status, uerr.message)
+		return
 	}
+	writeJSON(w, http.StatusOK, file)
+}
+
+// storeUploadedContent makes a staged upload the new content of a
+// space file and records the upload in the space activity. file is updated in
+// place.
+func (h *SpacesHandler) storeUploadedContent(file *models.File, spaceID, userID uuid.UUID, staged *stagedUpload) *uploadError {
+	plainSize := staged.size
+	mimeType := detectUploadMimeType(file.Name, staged.head)
 
-	// Deduplication check (within the space)
 	var computedHash string
 	if storage.ShouldDedup(file.Name) {
-		computedHash = hex.EncodeToString(hasher.Sum(nil))
-
-		var dedupDone bool
-		dedupErr := h.db.Transaction(func(tx *gorm.DB) error {
-			var existing models.File
-			err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
-				Where(
-					"space_id = ? AND file_hash = ? AND is_folder = false AND deleted_at IS NULL AND storage_path IS NOT NULL",
-					spaceID, computedHash,
-				).First(&existing).Error
-
-			if err != nil || existing.StoragePath == nil {
-				return nil
-			}
-
-			mimeStr := mimeType
-			hashStr := computedHash
-			updates := map[string]interface{}{
-				"storage_path":    existing.StoragePath,
-				"encrypted_dek":   existing.EncryptedDEK,
-				"encryption_iv":   existing.EncryptionIV,
-				"encryption_algo": existing.EncryptionAlgo,
-				"size":            plainSize,
-				"mime_type":       mimeStr,
-				"file_hash":       hashStr,
-			}
-			if err := tx.Model(&file).Updates(updates).Error; err != nil {
-				return err
-			}
-			file.Size = plainSize
-			file.MimeType = &mimeStr
-			file.StoragePath = existing.StoragePath
-			file.FileHash = &hashStr
-			dedupDone = true
-			return nil
-		})
-		if dedupErr != nil {
-			writeError(w, http.StatusInternalServerError, "Failed to update file record")
-			return
-		}
-		if dedupDone {
-			h.logActivity(spaceID, userID, models.SpaceActionUpload, &file.ID, &file.Name, nil)
-			writeJSON(w, http.StatusOK, file)
-			return
-		}
+		computedHash = hex.EncodeToString(staged.sum)
 	}
 
-	// Generate encryption keys
-	dek, iv, storedEncryptedDEK, algo, err := h.crypto.CreateEncryptionKeys()
+	// Content is deduplicated across all spaces and personal files via the CAS.
+	blob, _, err := storeBlob(h.db, h.crypto, h.cas, staged)
 	if err != nil {
-		writeError(w, http.StatusInternalServerError, "Failed to generate encryption keys")
-		return
-	}
-
-	// Space files use a distinct storage path to avoid collisions with personal files
-	storagePath := fmt.Sprintf("spaces/%s/%s.enc", spaceID.String(), fileID.String())
-
-	plainReader, err := os.Open(tmpPath) // #nosec G304 -- tmpPath from os.CreateTemp
-	if err != nil {
-		writeError(w, http.StatusInternalServerError, "Failed to open temp file")
-		return
-	}
-	defer plainReader.Close()
-
-	pr, pw := io.Pipe()
-	var encErr error
-	go func() {
-		_, encErr = crypto.EncryptStream(plainReader, pw, dek, iv)
-		if encErr != nil {
-			pw.CloseWithError(encErr)
-		} else {
-			pw.Close()
-		}
-	}()
-
-	if _, err := h.backend.Write(storagePath, pr); err != nil {
-		slog.Error("failed to write encrypted space file", "error", err, "path", storagePath)
-		writeError(w, http.StatusInternalServerError, "Failed to store file")
-		return
+		slog.Error("failed to store space blob", "error", err, "file_id", file.ID)
+		return &uploadError{http.StatusInternalServerError, "Failed to store file"}
 	}
 
 	updates := map[string]interface{}{
-		"storage_path":    storagePath,
-		"encrypted_dek":   storedEncryptedDEK,
-		"encryption_iv":   iv,
-		"encryption_algo": algo,
-		"size":            plainSize,
-		"mime_type":       mimeType,
+		"size":        plainSize,
+		"mime_type":   mimeType,
+		"uploaded_by": userID,
 	}
 	if computedHash != "" {
 		updates["file_hash"] = computedHash
 	}
 
-	if err := h.db.Model(&file).Updates(updates).Error; err != nil {
-		writeError(w, http.StatusInternalServerError, "Failed to update file record")
-		return
+	if err := h.db.Transaction(func(tx *gorm.DB) error {
+		return attachBlob(tx, file, blob, updates)
+	}); err != nil {
+		releaseBlob(h.db, blob.ID) //nolint:errcheck
+		return &uploadError{http.StatusInternalServerError, "Failed to update file record"}
 	}
+	wakeSearchIndexer()
 
 	// NOTE: space uploads intentionally do NOT increment the uploader's storage_used
 	file.Size = plainSize
 	mimeStr := mimeType
 	file.MimeType = &mimeStr
-	file.StoragePath = &storagePath
 	if computedHash != "" {
 		file.FileHash = &computedHash
 	}
 
 	h.logActivity(spaceID, userID, models.SpaceActionUpload, &file.ID, &file.Name, nil)
-	writeJSON(w, http.StatusOK, file)
+	return nil
 }
 
 // GET /api/v1/spaces/:id/files/:fid/download
@@ -650,50 +625,7 @@ func (h *SpacesHandler) Download(w http.ResponseWriter, r *http.Request) {
 }
 
 func (h *SpacesHandler) streamDecryptedFile(w http.ResponseWriter, r *http.Request, file *models.File) {
-	rc, _, err := h.backend.Read(*file.StoragePath)
-	if err != nil {
-		writeError(w, http.StatusNotFound, "File data not found")
-		return
-	}
-	defer rc.Close()
-
-	dek, err := h.crypto.DecryptFileKey(file.EncryptedDEK)
-	if err != nil {
-		writeError(w, http.StatusInternalServerError, "Failed to decrypt file key")
-		return
-	}
-
-	mimeType := "application/octet-stream"
-	if file.MimeType != nil {
-		mimeType = *file.MimeType
-	}
-
-	w.Header().Set("Content-Type", mimeType)
-	w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="%s"`, file.Name))
-	w.Header().Set("Cache-Control", "private, no-cache")
-
-	if file.EncryptionAlgo == "AES-256-GCM-STREAM" {
-		w.Header().Set("Content-Length", strconv.FormatInt(file.Size, 10))
-		w.WriteHeader(http.StatusOK)
-		if err := crypto.DecryptStream(rc, w, dek, file.EncryptionIV); err != nil {
-			slog.Error("stream decrypt failed", "file_id", file.ID, "err", err)
-		}
-		return
-	}
-
-	ciphertext, err := io.ReadAll(rc)
-	if err != nil {
-		writeError(w, http.StatusInternalServerError, "Failed to read file data")
-		return
-	}
-	plaintext, err := crypto.DecryptBuffer(ciphertext, dek, file.EncryptionIV)
-	if err != nil {
-		writeError(w, http.StatusInternalServerError, "Failed to decrypt file")
-		return
-	}
-	w.Header().Set("Content-Length", strconv.FormatInt(int64(len(plaintext)), 10))
-	w.WriteHeader(http.StatusOK)
-	w.Write(plaintext)
+	serveDecryptedFile(w, r, h.crypto, h.backend, file)
 }
 
 // PATCH /api/v1/spaces/:id/files/:fid
@@ -762,6 +694,10 @@ func (h *SpacesHandler) RenameFile(w http.ResponseWriter, r *http.Request) {
 			writeError(w, http.StatusBadRequest, "Cannot move a file into itself")
 			return
 		}
+		if file.IsFolder && isDescendantOf(h.db, *req.ParentID, fileID) {
+			writeError(w, http.StatusBadRequest, "Cannot move a folder into its own subfolder")
+			return
+		}
 		var parent models.File
 		if err := h.db.Where("id = ? AND space_id = ? AND is_folder = true AND deleted_at IS NULL", *req.ParentID, spaceID).First(&parent).Error; err != nil {
 			writeError(w, http.StatusNotFound, "Target folder not found in this space")
@@ -827,27 +763,13 @@ func (h *SpacesHandler) DeleteFile(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	fileName := file.Name
-
-	// Permanently delete space files (no trash for team space)
-	if !file.IsFolder && file.StoragePath != nil {
-		_ = h.db.Transaction(func(tx *gorm.DB) error {
-			var refCount int64
-			tx.Model(&models.File{}).
-				Clauses(clause.Locking{Strength: "UPDATE"}).
-				Where("storage_path = ? AND id != ?", *file.StoragePath, file.ID).
-				Count(&refCount)
-			if refCount == 0 {
-				h.backend.Delete(*file.StoragePath)
-			}
-			return nil
-		})
+	if err := trashSpaceFile(h.db, &file, userID); err != nil {
+		writeError(w, http.StatusInternalServerError, "Failed to delete file")
+		return
 	}
 
-	h.db.Delete(&file)
-
-	h.logActivity(spaceID, userID, models.SpaceActionDelete, &fileID, &fileName, nil)
-	writeJSON(w, http.StatusOK, map[string]string{"message": "File deleted"})
+	h.logActivity(spaceID, userID, models.SpaceActionDelete, &fileID, &file.Name, nil)
+	writeJSON(w, http.StatusOK, map[string]string{"message": "File moved to trash"})
 }
 
 // GET /api/v1/spaces/:id/members
@@ -901,7 +823,7 @@ func (h *SpacesHandler) UpdateMember(w http.ResponseWriter, r *http.Request) {
 		writeError(w, http.StatusBadRequest, "Invalid request body")
 		return
 	}
-	if req.Role != models.SpaceRoleViewer && req.Role != models.SpaceRoleContributor && req.Role != models.SpaceRoleAdmin {
+	if !validSpaceRoles[req.Role] {
 		writeError(w, http.StatusBadRequest, "role must be viewer, contributor, or admin")
 		return
 	}
@@ -954,6 +876,159 @@ func (h *SpacesHandler) RemoveMember(w http.ResponseWriter, r *http.Request) {
 	writeJSON(w, http.StatusOK, map[string]string{"message": "Member removed"})
 }
 
+// spaceGroupRequest parses the space and group IDs of a space group route
+// and checks the caller may manage the space's members.
+func (h *SpacesHandler) spaceGroupRequest(w http.ResponseWriter, r *http.Request) (spaceID, groupID, userID uuid.UUID, ok bool) {
+	claims := mw.GetClaims(r)
+	userID, _ = uuid.Parse(claims.Sub)
+
+	spaceID, err := uuid.Parse(chi.URLParam(r, "id"))
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "Invalid space ID")
+		return spaceID, groupID, userID, false
+	}
+	if gid := chi.URLParam(r, "gid"); gid != "" {
+		if groupID, err = uuid.Parse(gid); err != nil {
+			writeError(w, http.StatusBadRequest, "Invalid group ID")
+			return spaceID, groupID, userID, false
+		}
+	}
+	if !isSpaceAdminOrGlobal(spaceRole(h.db, spaceID, userID), claims.Role) {
+		writeError(w, http.StatusForbidden, "Only space admins can manage groups")
+		return spaceID, groupID, userID, false
+	}
+	return spaceID, groupID, userID, true
+}
+
+// GET /api/v1/spaces/:id/groups
+func (h *SpacesHandler) ListGroups(w http.ResponseWriter, r *http.Request) {
+	claims := mw.GetClaims(r)
+	userID, _ := uuid.Parse(claims.Sub)
+
+	spaceID, err := uuid.Parse(chi.URLParam(r, "id"))
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "Invalid space ID")
+		return
+	}
+	if spaceRole(h.db, spaceID, userID) == "" {
+		writeError(w, http.StatusForbidden, "Not a member of this space")
+		return
+	}
+
+	groups := []models.SpaceGroupMember{}
+	h.db.Where("space_id = ?", spaceID).Preload("Group").Order("added_at ASC").Find(&groups)
+
+	ids := make([]uuid.UUID, len(groups))
+	for i, g := range groups {
+		ids[i] = g.GroupID
+	}
+	counts := groupMemberCounts(h.db, ids)
+	for i := range groups {
+		if groups[i].Group != nil {
+			groups[i].Group.MemberCount = counts[groups[i].GroupID]
+		}
+	}
+	writeJSON(w, http.StatusOK, groups)
+}
+
+// POST /api/v1/spaces/:id/groups
+func (h *SpacesHandler) AddGroup(w http.ResponseWriter, r *http.Request) {
+	spaceID, _, userID, ok := h.spaceGroupRequest(w, r)
+	if !ok {
+		return
+	}
+
+	var req struct {
+		GroupID uuid.UUID `json:"groupId"`
+		Role    string    `json:"role"`
+	}
+	if err := readJSON(r, &req); err != nil {
+		writeError(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+	if req.Role == "" {
+		req.Role = models.SpaceRoleContributor
+	}
+	if !validSpaceRoles[req.Role] {
+		writeError(w, http.StatusBadRequest, "role must be viewer, contributor, or admin")
+		return
+	}
+	var group models.Group
+	if err := h.db.First(&group, "id = ?", req.GroupID).Error; err != nil {
+		writeError(w, http.StatusNotFound, "Group not found")
+		return
+	}
+
+	member := models.SpaceGroupMember{SpaceID: spaceID, GroupID: group.ID, Role: req.Role, AddedBy: &userID}
+	tx := h.db.Clauses(clause.OnConflict{DoNothing: true}).Create(&member)
+	if tx.Error != nil {
+		writeError(w, http.StatusInternalServerError, "Failed to add group")
+		return
+	}
+	if tx.RowsAffected == 0 {
+		writeError(w, http.StatusConflict, "Group is already a member of this space")
+		return
+	}
+
+	h.logActivity(spaceID, userID, models.SpaceActionGroupAdded, nil, nil,
+		models.JSONB{"group_id": group.ID.String(), "group_name": group.Name, "role": req.Role})
+
+	member.Group = &group
+	writeJSON(w, http.StatusCreated, member)
+}
+
+// PATCH /api/v1/spaces/:id/groups/:gid
+func (h *SpacesHandler) UpdateGroup(w http.ResponseWriter, r *http.Request) {
+	spaceID, groupID, userID, ok := h.spaceGroupRequest(w, r)
+	if !ok {
+		return
+	}
+
+	var req struct {
+		Role string `json:"role"`
+	}
+	if err := readJSON(r, &req); err != nil {
+		writeError(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+	if !validSpaceRoles[req.Role] {
+		writeError(w, http.StatusBadRequest, "role must be viewer, contributor, or admin")
+		return
+	}
+
+	result := h.db.Model(&models.SpaceGroupMember{}).
+		Where("space_id = ? AND group_id = ?", spaceID, groupID).
+		Update("role", req.Role)
+	if result.RowsAffected == 0 {
+		writeError(w, http.StatusNotFound, "Group not found in this space")
+		return
+	}
+
+	h.logActivity(spaceID, userID, models.SpaceActionGroupRoleChanged, nil, nil,
+		models.JSONB{"group_id": groupID.String(), "new_role": req.Role})
+
+	writeJSON(w, http.StatusOK, map[string]string{"message": "Group role updated"})
+}
+
+// DELETE /api/v1/spaces/:id/groups/:gid
+func (h *SpacesHandler) RemoveGroup(w http.ResponseWriter, r *http.Request) {
+	spaceID, groupID, userID, ok := h.spaceGroupRequest(w, r)
+	if !ok {
+		return
+	}
+
+	result := h.db.Where("space_id = ? AND group_id = ?", spaceID, groupID).Delete(&models.SpaceGroupMember{})
+	if result.RowsAffected == 0 {
+		writeError(w, http.StatusNotFound, "Group not found in this space")
+		return
+	}
+
+	h.logActivity(spaceID, userID, models.SpaceActionGroupRemoved, nil, nil,
+		models.JSONB{"group_id": groupID.String()})
+
+	writeJSON(w, http.StatusOK, map[string]string{"message": "Group removed"})
+}
+
 // GET /api/v1/spaces/:id/activity
 func (h *SpacesHandler) GetActivity(w http.ResponseWriter, r *http.Request) {
 	claims := mw.GetClaims(r)
@@ -1001,18 +1076,46 @@ func (h *SpacesHandler) GetActivity(w http.ResponseWriter, r *http.Request) {
 	})
 }
 
-// AutoEnrollUserInSpaces adds a newly registered user to all existing spaces as contributor.
+// enrollRole is the role a user gets when enrolled in an open space:
+// contributor, or admin for instance admins and owners.
+func enrollRole(userRole string) string {
+	if userRole == "admin" || userRole == "owner" {
+		return models.SpaceRoleAdmin
+	}
+	return models.SpaceRoleContributor
+}
+
+// enrollAllUsers adds every user to the space with their enrollRole,
+// keeping existing memberships as they are.
+func enrollAllUsers(db *gorm.DB, spaceID uuid.UUID, addedBy *uuid.UUID) error {
+	var users []models.User
+	if err := db.Select("id, role").Find(&users).Error; err != nil {
+		return err
+	}
+	members := make([]models.SpaceMember, len(users))
+	for i, u := range users {
+		members[i] = models.SpaceMember{
+			SpaceID: spaceID,
+			UserID:  u.ID,
+			Role:    enrollRole(u.Role),
+			AddedBy: addedBy,
+		}
+	}
+	if len(members) == 0 {
+		return nil
+	}
+	return db.Clauses(clause.OnConflict{DoNothing: true}).Create(&members).Error
+}
+
+// AutoEnrollUserInSpaces adds a newly registered user to all open spaces as contributor.
 // Called from auth.Register after user creation.
 func AutoEnrollUserInSpaces(db *gorm.DB, userID uuid.UUID, userRole string) {
 	var spaces []models.Space
-	if err := db.Find(&spaces).Error; err != nil || len(spaces) == 0 {
+	if err := db.Where("visibility = ?", models.SpaceVisibilityOpen).Find(&spaces).Error; err != nil || len(spaces) == 0 {
 		return
 	}
 
-	role := models.SpaceRoleContributor
-	if userRole == "admin" || userRole == "owner" {
-		role = models.SpaceRoleAdmin
-	}
+	role := enrollRole(userRole)
 
 	members := make([]models.SpaceMember, len(spaces))
 	for i, s := range spaces {
@@ -1025,7 +1128,7 @@ func AutoEnrollUserInSpaces(db *gorm.DB, userID uuid.UUID, userRole string) {
 	db.Clauses(clause.OnConflict{DoNothing: true}).Create(&members)
 }
 
-// SpaceBootstrap ensures a default "Team" space exists and all users are enrolled.
+// SpaceBootstrap ensures a default open "Team" space exists and all users are enrolled.
 // Called once at startup after the DB schema is verified.
 func SpaceBootstrap(db *gorm.DB) {
 	var count int64
@@ -1046,35 +1149,19 @@ func SpaceBootstrap(db *gorm.DB) {
 		db.First(&owner) // fall back to any user
 	}
 
+	// Team is open, so everyone is in it now and joins it on sign-up.
 	space := &models.Space{
-		ID:        uuid.New(),
-		Name:      "Team",
-		CreatedBy: &owner.ID,
+		ID:         uuid.New(),
+		Name:       "Team",
+		CreatedBy:  &owner.ID,
+		Visibility: models.SpaceVisibilityOpen,
 	}
 
 	err := db.Transaction(func(tx *gorm.DB) error {
 		if err := tx.Create(space).Error; err != nil {
 			return err
 		}
-		var users []models.User
-		tx.Find(&users)
-		members := make([]models.SpaceMember, len(users))
-		for i, u := range users {
-			role := models.SpaceRoleContributor
-			if u.Role == "admin" || u.Role == "owner" {
-				role = models.SpaceRoleAdmin
-			}
-			members[i] = models.SpaceMember{
-				SpaceID: space.ID,
-				UserID:  u.ID,
-				Role:    role,
-				AddedBy: &owner.ID,
-			}
-		}
-		if len(members) > 0 {
-			return tx.Clauses(clause.OnConflict{DoNothing: true}).Create(&members).Error
-		}
-		return nil
+		return enrollAllUsers(tx, space.ID, &owner.ID)
 	})
 
 	if err != nil {
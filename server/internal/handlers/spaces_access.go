@@ -0,0 +1,470 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/google/uuid"
+	mw "github.com/zynqcloud/api/internal/middleware"
+	"github.com/zynqcloud/api/internal/models"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// Space visibility and membership
+//
+// Every user is enrolled in an open space, on sign-up or when the space
+// becomes open, and can join one they were removed from. A discoverable
+// space is listed to everyone under /spaces/discover; joining it takes a
+// request that a space admin approves or rejects. A private space is
+// invisible to non-members: only its admins add people. Space admins can add
+// members to any space explicitly.
+
+// maxJoinMessageLength caps the note sent with a join request.
+const maxJoinMessageLength = 1000
+
+var validSpaceVisibilities = map[string]bool{
+	models.SpaceVisibilityOpen:         true,
+	models.SpaceVisibilityDiscoverable: true,
+	models.SpaceVisibilityPrivate:      true,
+}
+
+var validJoinRequestStatuses = map[string]bool{
+	models.JoinRequestPending:  true,
+	models.JoinRequestApproved: true,
+	models.JoinRequestRejected: true,
+}
+
+var errJoinRequestDecided = errors.New("join request was already decided")
+
+// spaceAdminRequest parses the space ID of a route and checks the caller is
+// a space admin or an instance admin.
+func (h *SpacesHandler) spaceAdminRequest(w http.ResponseWriter, r *http.Request, forbidden string) (space *models.Space, userID uuid.UUID, ok bool) {
+	claims := mw.GetClaims(r)
+	userID, _ = uuid.Parse(claims.Sub)
+
+	spaceID, err := uuid.Parse(chi.URLParam(r, "id"))
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "Invalid space ID")
+		return nil, userID, false
+	}
+	var s models.Space
+	if err := h.db.First(&s, "id = ?", spaceID).Error; err != nil {
+		writeError(w, http.StatusNotFound, "Space not found")
+		return nil, userID, false
+	}
+	if !isSpaceAdminOrGlobal(spaceRole(h.db, spaceID, userID), claims.Role) {
+		writeError(w, http.StatusForbidden, forbidden)
+		return nil, userID, false
+	}
+	return &s, userID, true
+}
+
+// PATCH /api/v1/spaces/:id
+func (h *SpacesHandler) UpdateSettings(w http.ResponseWriter, r *http.Request) {
+	space, userID, ok := h.spaceAdminRequest(w, r, "Only space admins can change space settings")
+	if !ok {
+		return
+	}
+
+	var req struct {
+		Name        *string `json:"name"`
+		Description *string `json:"description"`
+		Visibility  *string `json:"visibility"`
+		// TrashRetentionDays is how long deleted files stay in the trash.
+		TrashRetentionDays *int `json:"trashRetentionDays"`
+	}
+	if err := readJSON(r, &req); err != nil {
+		writeError(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+
+	updates := map[string]interface{}{}
+	if req.Name != nil {
+		name := strings.TrimSpace(*req.Name)
+		if name == "" {
+			writeError(w, http.StatusBadRequest, "name cannot be empty")
+			return
+		}
+		updates["name"] = name
+	}
+	if req.Description != nil {
+		updates["description"] = strings.TrimSpace(*req.Description)
+	}
+	if req.Visibility != nil {
+		if !validSpaceVisibilities[*req.Visibility] {
+			writeError(w, http.StatusBadRequest, "visibility must be open, discoverable, or private")
+			return
+		}
+		updates["visibility"] = *req.Visibility
+	}
+	if req.TrashRetentionDays != nil {
+		if !validTrashRetention(*req.TrashRetentionDays) {
+			writeError(w, http.StatusBadRequest, fmt.Sprintf("trashRetentionDays must be between 1 and %d", maxTrashRetentionDays))
+			return
+		}
+		updates["trash_retention_days"] = *req.TrashRetentionDays
+	}
+	if len(updates) == 0 {
+		writeJSON(w, http.StatusOK, space)
+		return
+	}
+
+	opened := req.Visibility != nil && *req.Visibility == models.SpaceVisibilityOpen &&
+		space.Visibility != models.SpaceVisibilityOpen
+	err := h.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(space).Updates(updates).Error; err != nil {
+			return err
+		}
+		if !opened {
+			return nil
+		}
+		// An open space holds everyone; pending requests are moot.
+		if err := tx.Model(&models.SpaceJoinRequest{}).
+			Where("space_id = ? AND status = ?", space.ID, models.JoinRequestPending).
+			Updates(map[string]interface{}{"status": models.JoinRequestApproved, "decided_by": userID, "decided_at": time.Now()}).Error; err != nil {
+			return err
+		}
+		return enrollAllUsers(tx, space.ID, &userID)
+	})
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "Failed to update space")
+		return
+	}
+
+	details := models.JSONB{}
+	for k, v := range updates {
+		details[k] = v
+	}
+	h.logActivity(space.ID, userID, models.SpaceActionSettingsChanged, nil, nil, details)
+
+	h.db.First(space, "id = ?", space.ID)
+	writeJSON(w, http.StatusOK, space)
+}
+
+// GET /api/v1/spaces/discover
+func (h *SpacesHandler) Discover(w http.ResponseWriter, r *http.Request) {
+	claims := mw.GetClaims(r)
+	userID, _ := uuid.Parse(claims.Sub)
+
+	var spaces []models.Space
+	h.db.Where("visibility IN ?", []string{models.SpaceVisibilityOpen, models.SpaceVisibilityDiscoverable}).
+		Where("id NOT IN ("+userSpacesSQL+")", map[string]interface{}{"user": userID}).
+		Order("name ASC").
+		Find(&spaces)
+
+	var pending []models.SpaceJoinRequest
+	h.db.Select("space_id").Where("user_id = ? AND status = ?", userID, models.JoinRequestPending).Find(&pending)
+	requested := make(map[uuid.UUID]bool, len(pending))
+	for _, p := range pending {
+		requested[p.SpaceID] = true
+	}
+
+	type discoverResp struct {
+		models.Space
+		MemberCount     int  `json:"member_count"`
+		RequestedToJoin bool `json:"requested_to_join"`
+	}
+	result := make([]discoverResp, len(spaces))
+	for i, s := range spaces {
+		result[i] = discoverResp{
+			Space:           s,
+			MemberCount:     spaceMemberCount(h.db, s.ID),
+			RequestedToJoin: requested[s.ID],
+		}
+	}
+	writeJSON(w, http.StatusOK, result)
+}
+
+// POST /api/v1/spaces/:id/join
+func (h *SpacesHandler) Join(w http.ResponseWriter, r *http.Request) {
+	claims := mw.GetClaims(r)
+	userID, _ := uuid.Parse(claims.Sub)
+
+	spaceID, err := uuid.Parse(chi.URLParam(r, "id"))
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "Invalid space ID")
+		return
+	}
+	// Private spaces answer like missing ones.
+	var space models.Space
+	if err := h.db.Where("id = ? AND visibility != ?", spaceID, models.SpaceVisibilityPrivate).First(&space).Error; err != nil {
+		writeError(w, http.StatusNotFound, "Space not found")
+		return
+	}
+	if spaceRole(h.db, spaceID, userID) != "" {
+		writeError(w, http.StatusConflict, "Already a member of this space")
+		return
+	}
+
+	var req struct {
+		Message string `json:"message"`
+	}
+	// The body is optional.
+	_ = readJSON(r, &req)
+	req.Message = strings.TrimSpace(req.Message)
+	if len(req.Message) > maxJoinMessageLength {
+		writeError(w, http.StatusBadRequest, "message is too long")
+		return
+	}
+
+	if space.Visibility == models.SpaceVisibilityOpen {
+		member := models.SpaceMember{SpaceID: spaceID, UserID: userID, Role: enrollRole(claims.Role)}
+		if err := h.db.Clauses(clause.OnConflict{DoNothing: true}).Create(&member).Error; err != nil {
+			writeError(w, http.StatusInternalServerError, "Failed to join space")
+			return
+		}
+		h.logActivity(spaceID, userID, models.SpaceActionMemberAdded, nil, nil,
+			models.JSONB{"target_user_id": userID.String(), "role": member.Role, "joined": true})
+		writeJSON(w, http.StatusOK, map[string]interface{}{"status": "joined", "role": member.Role})
+		return
+	}
+
+	joinReq := models.SpaceJoinRequest{ID: uuid.New(), SpaceID: spaceID, UserID: userID, Message: req.Message, Status: models.JoinRequestPending}
+	tx := h.db.Clauses(clause.OnConflict{DoNothing: true}).Create(&joinReq)
+	if tx.Error != nil {
+		writeError(w, http.StatusInternalServerError, "Failed to request to join")
+		return
+	}
+	if tx.RowsAffected == 0 {
+		writeError(w, http.StatusConflict, "You already asked to join this space")
+		return
+	}
+	h.logActivity(spaceID, userID, models.SpaceActionJoinRequested, nil, nil,
+		models.JSONB{"join_request_id": joinReq.ID.String()})
+
+	writeJSON(w, http.StatusAccepted, map[string]interface{}{"status": "requested", "request": joinReq})
+}
+
+// DELETE /api/v1/spaces/:id/join — withdraws the caller's pending request
+func (h *SpacesHandler) CancelJoin(w http.ResponseWriter, r *http.Request) {
+	claims := mw.GetClaims(r)
+	userID, _ := uuid.Parse(claims.Sub)
+
+	spaceID, err := uuid.Parse(chi.URLParam(r, "id"))
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "Invalid space ID")
+		return
+	}
+	result := h.db.Where("space_id = ? AND user_id = ? AND status = ?", spaceID, userID, models.JoinRequestPending).
+		Delete(&models.SpaceJoinRequest{})
+	if result.RowsAffected == 0 {
+		writeError(w, http.StatusNotFound, "No pending request")
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]string{"message": "Request withdrawn"})
+}
+
+// GET /api/v1/spaces/:id/join-requests
+func (h *SpacesHandler) ListJoinRequests(w http.ResponseWriter, r *http.Request) {
+	space, _, ok := h.spaceAdminRequest(w, r, "Only space admins can see join requests")
+	if !ok {
+		return
+	}
+
+	q := r.URL.Query()
+	status := q.Get("status")
+	if status == "" {
+		status = models.JoinRequestPending
+	}
+	if !validJoinRequestStatuses[status] {
+		writeError(w, http.StatusBadRequest, "status must be pending, approved, or rejected")
+		return
+	}
+	page, _ := strconv.Atoi(q.Get("page"))
+	if page < 1 {
+		page = 1
+	}
+	limit, _ := strconv.Atoi(q.Get("limit"))
+	if limit < 1 || limit > 200 {
+		limit = 50
+	}
+	offset := (page - 1) * limit
+
+	baseQ := h.db.Model(&models.SpaceJoinRequest{}).Where("space_id = ? AND status = ?", space.ID, status)
+	var total int64
+	baseQ.Count(&total)
+
+	requests := []models.SpaceJoinRequest{}
+	baseQ.Preload("User").
+		Order("created_at ASC").
+		Offset(offset).Limit(limit).
+		Find(&requests)
+
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"items": requests,
+		"meta": map[string]interface{}{
+			"total": total,
+			"page":  page,
+			"limit": limit,
+		},
+	})
+}
+
+// decideJoinRequest closes the pending request rid of the space, and with
+// role set adds its user as a member in the same transaction.
+func (h *SpacesHandler) decideJoinRequest(spaceID, rid, deciderID uuid.UUID, role string) (*models.SpaceJoinRequest, error) {
+	var req models.SpaceJoinRequest
+	if err := h.db.First(&req, "id = ? AND space_id = ?", rid, spaceID).Error; err != nil {
+		return nil, err
+	}
+	status := models.JoinRequestRejected
+	if role != "" {
+		status = models.JoinRequestApproved
+	}
+	err := h.db.Transaction(func(tx *gorm.DB) error {
+		result := tx.Model(&models.SpaceJoinRequest{}).
+			Where("id = ? AND status = ?", req.ID, models.JoinRequestPending).
+			Updates(map[string]interface{}{"status": status, "decided_by": deciderID, "decided_at": time.Now()})
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return errJoinRequestDecided
+		}
+		if role == "" {
+			return nil
+		}
+		return tx.Clauses(clause.OnConflict{DoNothing: true}).Create(&models.SpaceMember{
+			SpaceID: spaceID,
+			UserID:  req.UserID,
+			Role:    role,
+			AddedBy: &deciderID,
+		}).Error
+	})
+	req.Status = status
+	return &req, err
+}
+
+func (h *SpacesHandler) writeDecideError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, gorm.ErrRecordNotFound):
+		writeError(w, http.StatusNotFound, "Join request not found")
+	case errors.Is(err, errJoinRequestDecided):
+		writeError(w, http.StatusConflict, "Join request was already decided")
+	default:
+		writeError(w, http.StatusInternalServerError, "Failed to update join request")
+	}
+}
+
+// POST /api/v1/spaces/:id/join-requests/:rid/approve
+func (h *SpacesHandler) ApproveJoinRequest(w http.ResponseWriter, r *http.Request) {
+	space, userID, ok := h.spaceAdminRequest(w, r, "Only space admins can approve join requests")
+	if !ok {
+		return
+	}
+	rid, err := uuid.Parse(chi.URLParam(r, "rid"))
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "Invalid request ID")
+		return
+	}
+	var body struct {
+		Role string `json:"role"`
+	}
+	_ = readJSON(r, &body)
+	if body.Role == "" {
+		body.Role = models.SpaceRoleContributor
+	}
+	if !validSpaceRoles[body.Role] {
+		writeError(w, http.StatusBadRequest, "role must be viewer, contributor, or admin")
+		return
+	}
+
+	req, err := h.decideJoinRequest(space.ID, rid, userID, body.Role)
+	if err != nil {
+		h.writeDecideError(w, err)
+		return
+	}
+	h.logActivity(space.ID, userID, models.SpaceActionMemberAdded, nil, nil,
+		models.JSONB{"target_user_id": req.UserID.String(), "role": body.Role, "join_request_id": req.ID.String()})
+
+	writeJSON(w, http.StatusOK, req)
+}
+
+// POST /api/v1/spaces/:id/join-requests/:rid/reject
+func (h *SpacesHandler) RejectJoinRequest(w http.ResponseWriter, r *http.Request) {
+	space, userID, ok := h.spaceAdminRequest(w, r, "Only space admins can reject join requests")
+	if !ok {
+		return
+	}
+	rid, err := uuid.Parse(chi.URLParam(r, "rid"))
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "Invalid request ID")
+		return
+	}
+
+	req, err := h.decideJoinRequest(space.ID, rid, userID, "")
+	if err != nil {
+		h.writeDecideError(w, err)
+		return
+	}
+	h.logActivity(space.ID, userID, models.SpaceActionJoinRejected, nil, nil,
+		models.JSONB{"target_user_id": req.UserID.String(), "join_request_id": req.ID.String()})
+
+	writeJSON(w, http.StatusOK, req)
+}
+
+// POST /api/v1/spaces/:id/members
+func (h *SpacesHandler) AddMember(w http.ResponseWriter, r *http.Request) {
+	space, userID, ok := h.spaceAdminRequest(w, r, "Only space admins can add members")
+	if !ok {
+		return
+	}
+
+	var req struct {
+		UserID uuid.UUID `json:"userId"`
+		Role   string    `json:"role"`
+	}
+	if err := readJSON(r, &req); err != nil {
+		writeError(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+	if req.Role == "" {
+		req.Role = models.SpaceRoleContributor
+	}
+	if !validSpaceRoles[req.Role] {
+		writeError(w, http.StatusBadRequest, "role must be viewer, contributor, or admin")
+		return
+	}
+	var target models.User
+	if err := h.db.Select("id, name, email").First(&target, "id = ?", req.UserID).Error; err != nil {
+		writeError(w, http.StatusNotFound, "User not found")
+		return
+	}
+
+	member := models.SpaceMember{SpaceID: space.ID, UserID: target.ID, Role: req.Role, AddedBy: &userID}
+	var added bool
+	err := h.db.Transaction(func(tx *gorm.DB) error {
+		result := tx.Clauses(clause.OnConflict{DoNothing: true}).Create(&member)
+		if result.Error != nil {
+			return result.Error
+		}
+		added = result.RowsAffected > 0
+		if !added {
+			return nil
+		}
+		// Adding someone answers their pending request.
+		return tx.Model(&models.SpaceJoinRequest{}).
+			Where("space_id = ? AND user_id = ? AND status = ?", space.ID, target.ID, models.JoinRequestPending).
+			Updates(map[string]interface{}{"status": models.JoinRequestApproved, "decided_by": userID, "decided_at": time.Now()}).Error
+	})
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "Failed to add member")
+		return
+	}
+	if !added {
+		writeError(w, http.StatusConflict, "User is already a member of this space")
+		return
+	}
+
+	h.logActivity(space.ID, userID, models.SpaceActionMemberAdded, nil, nil,
+		models.JSONB{"target_user_id": target.ID.String(), "role": req.Role})
+
+	member.User = &target
+	writeJSON(w, http.StatusCreated, member)
+}
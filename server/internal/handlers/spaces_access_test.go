@@ -0,0 +1,46 @@
+package handlers
+
+import (
+	"testing"
+
+	"github.com/zynqcloud/api/internal/models"
+)
+
+func TestEnrollRole(t *testing.T) {
+	for role, want := range map[string]string{
+		"owner": models.SpaceRoleAdmin,
+		"admin": models.SpaceRoleAdmin,
+		"user":  models.SpaceRoleContributor,
+		"":      models.SpaceRoleContributor,
+	} {
+		if got := enrollRole(role); got != want {
+			t.Errorf("enrollRole(%q) = %q, want %q", role, got, want)
+		}
+	}
+}
+
+func TestValidSpaceVisibilities(t *testing.T) {
+	for _, v := range []string{models.SpaceVisibilityOpen, models.SpaceVisibilityDiscoverable, models.SpaceVisibilityPrivate} {
+		if !validSpaceVisibilities[v] {
+			t.Errorf("%q should be valid", v)
+		}
+	}
+	for _, v := range []string{"", "public", "Open"} {
+		if validSpaceVisibilities[v] {
+			t.Errorf("%q should be rejected", v)
+		}
+	}
+}
+
+func TestValidJoinRequestStatuses(t *testing.T) {
+	for _, s := range []string{models.JoinRequestPending, models.JoinRequestApproved, models.JoinRequestRejected} {
+		if !validJoinRequestStatuses[s] {
+			t.Errorf("%q should be valid", s)
+		}
+	}
+	for _, s := range []string{"", "all", "Pending", "pending' OR 1=1"} {
+		if validJoinRequestStatuses[s] {
+			t.Errorf("%q should be rejected", s)
+		}
+	}
+}
@@ -0,0 +1,402 @@
+package handlers
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/google/uuid"
+	mw "github.com/zynqcloud/api/internal/middleware"
+	"github.com/zynqcloud/api/internal/models"
+	"github.com/zynqcloud/api/internal/storage"
+	"gorm.io/gorm"
+)
+
+// Space trash
+//
+// Deleting a space file or folder stamps it and everything live below it
+// with the same deleted_at and with deleted_by, so the subtree disappears
+// from listings, downloads, search and WebDAV at once and comes back as one
+// piece. The trash lists the items that were deleted themselves rather than
+// along with a folder. The deleter can restore an item as long as they can
+// still write to the space; space admins can restore anything, and only they
+// delete for good. Items older than the space's trash_retention_days are
+// purged by PurgeSpaceTrash.
+
+// maxTrashRetentionDays caps a space's trash retention.
+const maxTrashRetentionDays = 3650
+
+// spaceTrashRootsSQL selects the items of a space's trash: rows deleted
+// themselves, not together with their parent folder.
+const spaceTrashRootsSQL = `files.deleted_at IS NOT NULL AND NOT EXISTS (
+	SELECT 1 FROM files p WHERE p.id = files.parent_id AND p.deleted_at = files.deleted_at)`
+
+// validTrashRetention reports whether days is an acceptable retention.
+func validTrashRetention(days int) bool {
+	return days >= 1 && days <= maxTrashRetentionDays
+}
+
+// trashSpaceFile moves file and every live row below it to the space trash.
+func trashSpaceFile(db *gorm.DB, file *models.File, userID uuid.UUID) error {
+	return db.Model(&models.File{}).
+		Where(`id IN (
+			WITH RECURSIVE tree AS (
+				SELECT id FROM files WHERE id = ?
+				UNION ALL
+				SELECT f.id FROM files f
+				INNER JOIN tree t ON f.parent_id = t.id
+				WHERE f.deleted_at IS NULL
+			)
+			SELECT id FROM tree)`, file.ID).
+		Where("deleted_at IS NULL").
+		Updates(map[string]interface{}{"deleted_at": time.Now(), "deleted_by": userID}).Error
+}
+
+// trashedSpaceFile loads an item of the space trash for the route's :fid.
+func (h *SpacesHandler) trashedSpaceFile(w http.ResponseWriter, r *http.Request, spaceID uuid.UUID) (*models.File, bool) {
+	fileID, err := uuid.Parse(chi.URLParam(r, "fid"))
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "Invalid file ID")
+		return nil, false
+	}
+	var file models.File
+	if err := h.db.Where("id = ? AND space_id = ? AND deleted_at IS NOT NULL", fileID, spaceID).First(&file).Error; err != nil {
+		writeError(w, http.StatusNotFound, "File not found in trash")
+		return nil, false
+	}
+	return &file, true
+}
+
+// GET /api/v1/spaces/:id/trash
+func (h *SpacesHandler) Trash(w http.ResponseWriter, r *http.Request) {
+	claims := mw.GetClaims(r)
+	userID, _ := uuid.Parse(claims.Sub)
+
+	spaceID, err := uuid.Parse(chi.URLParam(r, "id"))
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "Invalid space ID")
+		return
+	}
+	if spaceRole(h.db, spaceID, userID) == "" {
+		writeError(w, http.StatusForbidden, "Not a member of this space")
+		return
+	}
+	var space models.Space
+	if err := h.db.First(&space, "id = ?", spaceID).Error; err != nil {
+		writeError(w, http.StatusNotFound, "Space not found")
+		return
+	}
+
+	q := r.URL.Query()
+	page, _ := strconv.Atoi(q.Get("page"))
+	if page < 1 {
+		page = 1
+	}
+	limit, _ := strconv.Atoi(q.Get("limit"))
+	if limit < 1 || limit > 200 {
+		limit = 50
+	}
+	offset := (page - 1) * limit
+
+	query := h.db.Model(&models.File{}).Where("space_id = ?", spaceID).Where(spaceTrashRootsSQL)
+
+	var total int64
+	query.Count(&total)
+
+	var files []models.File
+	query.Preload("Owner").Preload("Deleter").
+		Order("deleted_at DESC").
+		Offset(offset).Limit(limit).
+		Find(&files)
+
+	for i := range files {
+		if files[i].IsFolder {
+			files[i].FolderSize = trashedTreeSize(h.db, &files[i])
+		}
+	}
+
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"items":          files,
+		"retention_days": space.TrashRetentionDays,
+		"meta": map[string]interface{}{
+			"total": total,
+			"page":  page,
+			"limit": limit,
+		},
+	})
+}
+
+// trashedTreeSize returns the bytes of the files trashed together with the
+// folder file.
+func trashedTreeSize(db *gorm.DB, file *models.File) int64 {
+	var size int64
+	db.Raw(`
+		WITH RECURSIVE tree AS (
+			SELECT id, is_folder, size FROM files
+			WHERE parent_id = @id AND deleted_at = @at
+			UNION ALL
+			SELECT f.id, f.is_folder, f.size FROM files f
+			INNER JOIN tree t ON f.parent_id = t.id
+			WHERE f.deleted_at = @at
+		)
+		SELECT COALESCE(SUM(size), 0) FROM tree WHERE is_folder = false
+	`, map[string]interface{}{"id": file.ID, "at": file.DeletedAt}).Scan(&size)
+	return size
+}
+
+// POST /api/v1/spaces/:id/trash/:fid/restore
+func (h *SpacesHandler) RestoreFile(w http.ResponseWriter, r *http.Request) {
+	claims := mw.GetClaims(r)
+	userID, _ := uuid.Parse(claims.Sub)
+
+	spaceID, err := uuid.Parse(chi.URLParam(r, "id"))
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "Invalid space ID")
+		return
+	}
+	role := spaceRole(h.db, spaceID, userID)
+	if role == "" {
+		writeError(w, http.StatusForbidden, "Not a member of this space")
+		return
+	}
+	file, ok := h.trashedSpaceFile(w, r, spaceID)
+	if !ok {
+		return
+	}
+
+	deleter := file.DeletedBy != nil && *file.DeletedBy == userID
+	if !(deleter && canWrite(role)) && !isSpaceAdminOrGlobal(role, claims.Role) {
+		writeError(w, http.StatusForbidden, "Only the person who deleted this item or a space admin can restore it")
+		return
+	}
+
+	// An item whose folder is gone, or still in the trash, comes back at the
+	// top of the space.
+	toRoot := false
+	if file.ParentID != nil {
+		var n int64
+		h.db.Model(&models.File{}).Where("id = ? AND space_id = ? AND deleted_at IS NULL", *file.ParentID, spaceID).Count(&n)
+		toRoot = n == 0
+	}
+
+	err = h.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&models.File{}).
+			Where(`id IN (
+				WITH RECURSIVE tree AS (
+					SELECT id FROM files WHERE id = @id
+					UNION ALL
+					SELECT f.id FROM files f
+					INNER JOIN tree t ON f.parent_id = t.id
+					WHERE f.deleted_at = @at
+				)
+				SELECT id FROM tree)`, map[string]interface{}{"id": file.ID, "at": file.DeletedAt}).
+			Updates(map[string]interface{}{"deleted_at": nil, "deleted_by": nil}).Error; err != nil {
+			return err
+		}
+		if toRoot {
+			return tx.Model(&models.File{}).Where("id = ?", file.ID).Update("parent_id", nil).Error
+		}
+		return nil
+	})
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "Failed to restore file")
+		return
+	}
+
+	details := models.JSONB{}
+	if file.DeletedBy != nil {
+		details["deleted_by"] = file.DeletedBy.String()
+	}
+	if toRoot {
+		details["to_root"] = true
+	}
+	h.logActivity(spaceID, userID, models.SpaceActionRestore, &file.ID, &file.Name, details)
+
+	writeJSON(w, http.StatusOK, map[string]string{"message": "File restored"})
+}
+
+// DELETE /api/v1/spaces/:id/trash/:fid
+func (h *SpacesHandler) PurgeFile(w http.ResponseWriter, r *http.Request) {
+	space, userID, ok := h.spaceAdminRequest(w, r, "Only space admins can delete files permanently")
+	if !ok {
+		return
+	}
+	file, ok := h.trashedSpaceFile(w, r, space.ID)
+	if !ok {
+		return
+	}
+
+	n, err := purgeFileTrees(h.db, h.backend, []uuid.UUID{file.ID})
+	if err != nil {
+		slog.Error("space trash: purge failed", "space_id", space.ID, "file_id", file.ID, "error", err)
+		writeError(w, http.StatusInternalServerError, "Failed to delete file")
+		return
+	}
+	h.logActivity(space.ID, userID, models.SpaceActionPurge, &file.ID, &file.Name, models.JSONB{"items": n})
+
+	writeJSON(w, http.StatusOK, map[string]string{"message": "File deleted permanently"})
+}
+
+// DELETE /api/v1/spaces/:id/trash
+func (h *SpacesHandler) EmptyTrash(w http.ResponseWriter, r *http.Request) {
+	space, userID, ok := h.spaceAdminRequest(w, r, "Only space admins can empty the trash")
+	if !ok {
+		return
+	}
+
+	var roots []uuid.UUID
+	h.db.Model(&models.File{}).Where("space_id = ?", space.ID).Where(spaceTrashRootsSQL).Pluck("id", &roots)
+	if len(roots) == 0 {
+		writeJSON(w, http.StatusOK, map[string]string{"message": "Trash emptied"})
+		return
+	}
+
+	n, err := purgeFileTrees(h.db, h.backend, roots)
+	if err != nil {
+		slog.Error("space trash: empty failed", "space_id", space.ID, "error", err)
+		writeError(w, http.StatusInternalServerError, "Failed to empty trash")
+		return
+	}
+	h.logActivity(space.ID, userID, models.SpaceActionPurge, nil, nil,
+		models.JSONB{"emptied": true, "trashed": len(roots), "items": n})
+
+	writeJSON(w, http.StatusOK, map[string]string{"message": "Trash emptied"})
+}
+
+// purgeFileTrees permanently deletes the files rootIDs and every row below
+// them, releasing their blobs and the legacy storage objects held by them or
+// their versions. The rows go first: an object is only removed once nothing
+// in the database can point at it any more. It returns how many rows were
+// deleted.
+func purgeFileTrees(db *gorm.DB, backend storage.Backend, rootIDs []uuid.UUID) (int, error) {
+	var files []models.File
+	if err := db.Raw(`
+		WITH RECURSIVE tree AS (
+			SELECT id FROM files WHERE id IN ?
+			UNION
+			SELECT f.id FROM files f
+			INNER JOIN tree t ON f.parent_id = t.id
+		)
+		SELECT * FROM files WHERE id IN (SELECT id FROM tree)`, rootIDs).Scan(&files).Error; err != nil {
+		return 0, fmt.Errorf("collect file tree: %w", err)
+	}
+	if len(files) == 0 {
+		return 0, nil
+	}
+
+	ids := make([]uuid.UUID, 0, len(files))
+	paths := make(map[string]struct{})
+	for _, f := range files {
+		ids = append(ids, f.ID)
+		// CAS-backed files are reclaimed by the blob GC once unreferenced.
+		if !f.IsFolder && f.StoragePath != nil && f.BlobID == nil {
+			paths[*f.StoragePath] = struct{}{}
+		}
+	}
+	var versionPaths []string
+	if err := db.Model(&models.FileVersion{}).
+		Where("file_id IN ? AND blob_id IS NULL AND storage_path IS NOT NULL", ids).
+		Distinct().Pluck("storage_path", &versionPaths).Error; err != nil {
+		return 0, fmt.Errorf("collect version objects: %w", err)
+	}
+	for _, p := range versionPaths {
+		paths[p] = struct{}{}
+	}
+
+	// Version rows go with the files (ON DELETE CASCADE).
+	err := db.Transaction(func(tx *gorm.DB) error {
+		if err := releaseFileBlobs(tx, ids); err != nil {
+			return err
+		}
+		if err := tx.Where("file_id IN ?", ids).Delete(&models.Share{}).Error; err != nil {
+			return err
+		}
+		return tx.Where("id IN ?", ids).Delete(&models.File{}).Error
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	for p := range paths {
+		var fileRefs, versionRefs int64
+		db.Model(&models.File{}).Where("storage_path = ?", p).Count(&fileRefs)
+		db.Model(&models.FileVersion{}).Where("storage_path = ?", p).Count(&versionRefs)
+		if fileRefs+versionRefs > 0 {
+			continue
+		}
+		if err := backend.Delete(p); err != nil {
+			slog.Error("space trash: delete storage object failed", "path", p, "error", err)
+		}
+	}
+	return len(ids), nil
+}
+
+// PurgeSpaceTrash permanently deletes space trash items older than their
+// space's retention and records each in the space activity. It returns how
+// many items were purged.
+func PurgeSpaceTrash(db *gorm.DB, backend storage.Backend) (int, error) {
+	var expired []models.File
+	if err := db.Model(&models.File{}).
+		Joins("INNER JOIN spaces s ON s.id = files.space_id").
+		Where(spaceTrashRootsSQL).
+		Where("files.deleted_at < NOW() - make_interval(days => s.trash_retention_days)").
+		Limit(1000).
+		Find(&expired).Error; err != nil {
+		return 0, fmt.Errorf("list expired trash: %w", err)
+	}
+
+	var purged int
+	for _, f := range expired {
+		n, err := purgeFileTrees(db, backend, []uuid.UUID{f.ID})
+		if err != nil {
+			return purged, fmt.Errorf("purge %s: %w", f.ID, err)
+		}
+		purged++
+
+		name := f.Name
+		details := models.JSONB{"auto": true, "items": n}
+		if f.DeletedBy != nil {
+			details["deleted_by"] = f.DeletedBy.String()
+		}
+		if err := db.Create(&models.SpaceActivity{
+			SpaceID:  *f.SpaceID,
+			Action:   models.SpaceActionPurge,
+			FileID:   &f.ID,
+			FileName: &name,
+			Details:  details,
+		}).Error; err != nil {
+			slog.Warn("failed to log space activity", "error", err)
+		}
+	}
+	return purged, nil
+}
+
+// RunSpaceTrashPurgePeriodic starts a background goroutine that calls
+// PurgeSpaceTrash on every interval until ctx is cancelled.
+func RunSpaceTrashPurgePeriodic(ctx context.Context, db *gorm.DB, backend storage.Backend, interval time.Duration, logger *slog.Logger) <-chan struct{} {
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				n, err := PurgeSpaceTrash(db, backend)
+				if err != nil {
+					logger.Error("space trash purge failed", "purged", n, "error", err)
+				} else if n > 0 {
+					logger.Info("space trash purge: cycle complete", "purged", n)
+				}
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	return done
+}
@@ -0,0 +1,18 @@
+package handlers
+
+import "testing"
+
+func TestValidTrashRetention(t *testing.T) {
+	for days, want := range map[int]bool{
+		-1:                        false,
+		0:                         false,
+		1:                         true,
+		30:                        true,
+		maxTrashRetentionDays:     true,
+		maxTrashRetentionDays + 1: false,
+	} {
+		if got := validTrashRetention(days); got != want {
+			t.Errorf("validTrashRetention(%d) = %v, want %v", days, got, want)
+		}
+	}
+}
@@ -12,11 +12,11 @@ import (
 )
 
 type StorageStatsHandler struct {
-	backend *storage.Local
+	backend storage.Backend
 	db      *gorm.DB
 }
 
-func NewStorageStatsHandler(backend *storage.Local, db *gorm.DB) *StorageStatsHandler {
+func NewStorageStatsHandler(backend storage.Backend, db *gorm.DB) *StorageStatsHandler {
 	return &StorageStatsHandler{backend: backend, db: db}
 }
 
@@ -25,7 +25,12 @@ func (h *StorageStatsHandler) Overview(w http.ResponseWriter, r *http.Request) {
 	claims := mw.GetClaims(r)
 	userID, _ := uuid.Parse(claims.Sub)
 
-	avail, total := h.backend.DiskStats()
+	// Object-store backends have no fixed capacity; report zeros so the UI
+	// falls back to per-user quotas only.
+	var avail, total uint64
+	if ds, ok := h.backend.(storage.DiskStatter); ok {
+		avail, total = ds.DiskStats()
+	}
 	used := total - avail
 	var usedPercentage float64
 	if total > 0 {
@@ -39,6 +44,7 @@ func (h *StorageStatsHandler) Overview(w http.ResponseWriter, r *http.Request) {
 	h.db.Model(&models.File{}).
 		Where("owner_id = ? AND deleted_at IS NULL AND is_folder = false", userID).
 		Select("COALESCE(SUM(size), 0)").Scan(&actualUsed)
+	actualUsed += versionBytesUsed(h.db, userID)
 	if actualUsed != user.StorageUsed {
 		h.db.Model(&user).UpdateColumn("storage_used", actualUsed)
 	}
@@ -94,9 +100,9 @@ func (h *StorageStatsHandler) GetAllUsersStorage(w http.ResponseWriter, r *http.
 		Group("owner_id").
 		Scan(&rows)
 
-	usageByOwner := make(map[string]int64, len(rows))
+	usageByOwner := versionBytesByOwner(h.db)
 	for _, row := range rows {
-		usageByOwner[row.OwnerID] = row.Used
+		usageByOwner[row.OwnerID] += row.Used
 	}
 
 	result := make([]map[string]interface{}, 0, len(users))
@@ -143,6 +149,7 @@ func (h *StorageStatsHandler) GetUserStorage(w http.ResponseWriter, r *http.Requ
 	h.db.Model(&models.File{}).
 		Where("owner_id = ? AND deleted_at IS NULL AND is_folder = false", userID).
 		Select("COALESCE(SUM(size), 0)").Scan(&actualUsed)
+	actualUsed += versionBytesUsed(h.db, userID)
 	if actualUsed != user.StorageUsed {
 		h.db.Model(&user).UpdateColumn("storage_used", actualUsed)
 	}
@@ -0,0 +1,682 @@
+package handlers
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base32"
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
+	mw "github.com/zynqcloud/api/internal/middleware"
+	"github.com/zynqcloud/api/internal/models"
+	"github.com/zynqcloud/api/internal/totp"
+	"golang.org/x/crypto/bcrypt"
+	"gorm.io/gorm"
+)
+
+// Two-factor authentication
+//
+// Users can add a TOTP authenticator (RFC 6238) to their account. Enrollment
+// stores a pending secret, returns its otpauth:// URI for the QR code, and
+// takes effect once the user confirms a first code; at that point ten
+// single-use recovery codes are issued and shown once.
+//
+// With 2FA on, POST /auth/login no longer sets the jid cookie after the
+// password check. It returns a challenge token valid for five minutes, which
+// POST /auth/login/2fa exchanges for the session together with a TOTP or
+// recovery code. Challenge tokens are signed with a key derived from
+// JWT_SECRET for this purpose only, so Auth never accepts one as a session.
+//
+// Admins can require 2FA for the admin and owner roles (the require_2fa_admins
+// global setting). Those users get a challenge even before they have enrolled
+// and must enroll through /auth/login/2fa/setup before their first session.
+// A registered passkey counts as a second factor too (see passkeys.go).
+
+const (
+	totpIssuer            = "ZynqCloud"
+	loginChallengeTTL     = 5 * time.Minute
+	loginChallengeAud     = "login-2fa"
+	recoveryCodeCount     = 10
+	recoveryCodeBytes     = 10 // 80 bits, 16 base32 characters
+	require2FASettingsKey = "require_2fa_admins"
+)
+
+var (
+	errSecondFactorInvalid = errors.New("invalid code")
+	errTOTPNotEnrolled     = errors.New("two-factor authentication is not set up")
+)
+
+var recoveryB32 = base32.StdEncoding.WithPadding(base32.NoPadding)
+
+// ── Policy and state ────────────────────────────────────────────────────────
+
+// twoFactorRequired reports whether the instance requires 2FA for role.
+func twoFactorRequired(db *gorm.DB, role string) bool {
+	if role != "admin" && role != "owner" {
+		return false
+	}
+	var setting models.Setting
+	if err := db.Where("user_id IS NULL AND key = ?", require2FASettingsKey).First(&setting).Error; err != nil {
+		return false
+	}
+	on, _ := setting.Value["value"].(bool)
+	return on
+}
+
+// loadTOTP returns the user's TOTP enrollment, or nil when there is none.
+func loadTOTP(db *gorm.DB, userID uuid.UUID) *models.UserTOTP {
+	var t models.UserTOTP
+	if err := db.Where("user_id = ?", userID).First(&t).Error; err != nil {
+		return nil
+	}
+	return &t
+}
+
+func totpEnabled(db *gorm.DB, userID uuid.UUID) bool {
+	t := loadTOTP(db, userID)
+	return t != nil && t.EnabledAt != nil
+}
+
+func (h *AuthHandler) needsSecondFactor(user *models.User) bool {
+	return totpEnabled(h.db, user.ID) || twoFactorRequired(h.db, user.Role)
+}
+
+// ── Secrets and codes ───────────────────────────────────────────────────────
+
+// beginTOTPEnrollment stores a new pending secret for user, replacing any
+// earlier unconfirmed one, and returns it with its provisioning URI.
+func (h *AuthHandler) beginTOTPEnrollment(user *models.User) (string, string, error) {
+	if h.crypto == nil {
+		return "", "", errors.New("encryption not configured")
+	}
+	secret, err := totp.GenerateSecret()
+	if err != nil {
+		return "", "", err
+	}
+	wrapped, err := h.crypto.WrapDEK(secret)
+	if err != nil {
+		return "", "", err
+	}
+	keyID := h.crypto.KeyID()
+	err = h.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("user_id = ? AND enabled_at IS NULL", user.ID).Delete(&models.UserTOTP{}).Error; err != nil {
+			return err
+		}
+		return tx.Create(&models.UserTOTP{
+			ID:           uuid.New(),
+			UserID:       user.ID,
+			EncryptedDEK: wrapped,
+			KeyID:        &keyID,
+		}).Error
+	})
+	if err != nil {
+		return "", "", err
+	}
+	return totp.EncodeSecret(secret), totp.ProvisioningURI(totpIssuer, user.Email, secret), nil
+}
+
+// checkTOTP validates code against t and consumes its time step.
+func (h *AuthHandler) checkTOTP(t *models.UserTOTP, code string) error {
+	if h.crypto == nil {
+		return errors.New("encryption not configured")
+	}
+	secret, err := h.crypto.DecryptFileKey(t.EncryptedDEK)
+	if err != nil {
+		return err
+	}
+	counter, ok := totp.Validate(secret, code, time.Now())
+	if !ok || counter <= t.LastCounter {
+		return errSecondFactorInvalid
+	}
+	// Conditional on the stored step, so two requests racing with the same
+	// code cannot both succeed.
+	res := h.db.Model(&models.UserTOTP{}).
+		Where("id = ? AND last_counter < ?", t.ID, counter).
+		UpdateColumn("last_counter", counter)
+	if res.Error != nil || res.RowsAffected == 0 {
+		return errSecondFactorInvalid
+	}
+	t.LastCounter = counter
+	return nil
+}
+
+func hashRecoveryCode(code string) string {
+	norm := strings.ToUpper(strings.NewReplacer("-", "", " ", "").Replace(strings.TrimSpace(code)))
+	return hashAppPassword(norm)
+}
+
+// issueRecoveryCodes replaces the user's recovery codes and returns the new
+// ones, formatted as xxxx-xxxx-xxxx-xxxx.
+func issueRecoveryCodes(db *gorm.DB, userID uuid.UUID) ([]string, error) {
+	codes := make([]string, recoveryCodeCount)
+	rows := make([]models.TOTPRecoveryCode, recoveryCodeCount)
+	for i := range codes {
+		b := make([]byte, recoveryCodeBytes)
+		if _, err := rand.Read(b); err != nil {
+			return nil, err
+		}
+		raw := strings.ToLower(recoveryB32.EncodeToString(b))
+		codes[i] = raw[0:4] + "-" + raw[4:8] + "-" + raw[8:12] + "-" + raw[12:16]
+		rows[i] = models.TOTPRecoveryCode{ID: uuid.New(), UserID: userID, CodeHash: hashRecoveryCode(raw)}
+	}
+	err := db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("user_id = ?", userID).Delete(&models.TOTPRecoveryCode{}).Error; err != nil {
+			return err
+		}
+		return tx.Create(&rows).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+	return codes, nil
+}
+
+// useRecoveryCode marks one of the user's unused recovery codes as used.
+func useRecoveryCode(db *gorm.DB, userID uuid.UUID, code string) bool {
+	res := db.Model(&models.TOTPRecoveryCode{}).
+		Where("user_id = ? AND code_hash = ? AND used_at IS NULL", userID, hashRecoveryCode(code)).
+		UpdateColumn("used_at", time.Now())
+	return res.Error == nil && res.RowsAffected == 1
+}
+
+// verifySecondFactor checks a TOTP code or, failing that, a recovery code
+// for a user with 2FA enabled. It returns which one was used.
+func (h *AuthHandler) verifySecondFactor(userID uuid.UUID, code, recoveryCode string) (string, error) {
+	t := loadTOTP(h.db, userID)
+	if t == nil || t.EnabledAt == nil {
+		return "", errTOTPNotEnrolled
+	}
+	if !h.totpLimiter.Allow(userID.String()) {
+		return "", errSecondFactorInvalid
+	}
+	if code != "" && h.checkTOTP(t, code) == nil {
+		return "totp", nil
+	}
+	if recoveryCode != "" && useRecoveryCode(h.db, userID, recoveryCode) {
+		return "recovery_code", nil
+	}
+	return "", errSecondFactorInvalid
+}
+
+// ── Login challenge ─────────────────────────────────────────────────────────
+
+type loginChallengeClaims struct {
+	Sub string `json:"sub"`
+	jwt.RegisteredClaims
+}
+
+// challengeKey is the signing key for login challenges. It differs from the
+// session key so a challenge can never pass as a session token.
+func (h *AuthHandler) challengeKey() []byte {
+	return h.purposeKey("zynqcloud login challenge v1")
+}
+
+// purposeKey derives a signing key for one kind of short-lived token from
+// JWT_SECRET.
+func (h *AuthHandler) purposeKey(label string) []byte {
+	return derivePurposeKey(h.cfg.JWTSecret, label)
+}
+
+func derivePurposeKey(secret, label string) []byte {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(label))
+	return mac.Sum(nil)
+}
+
+func (h *AuthHandler) signLoginChallenge(userID uuid.UUID) (string, error) {
+	now := time.Now()
+	return jwt.NewWithClaims(jwt.SigningMethodHS256, &loginChallengeClaims{
+		Sub: userID.String(),
+		RegisteredClaims: jwt.RegisteredClaims{
+			Audience:  jwt.ClaimStrings{loginChallengeAud},
+			ExpiresAt: jwt.NewNumericDate(now.Add(loginChallengeTTL)),
+			IssuedAt:  jwt.NewNumericDate(now),
+		},
+	}).SignedString(h.challengeKey())
+}
+
+// startLoginChallenge answers a correct password for an account that needs
+// a second factor.
+func (h *AuthHandler) startLoginChallenge(w http.ResponseWriter, r *http.Request, user *models.User) {
+	token, err := h.signLoginChallenge(user.ID)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "Failed to generate token")
+		return
+	}
+
+	// A passkey satisfies the requirement as well as TOTP does.
+	var methods []string
+	if totpEnabled(h.db, user.ID) {
+		methods = append(methods, "totp")
+	}
+	if hasPasskey(h.db, user.ID) {
+		methods = append(methods, "passkey")
+	}
+	enrolled := len(methods) > 0
+	uid := user.ID
+	LogAudit(h.db, AuditEntry{
+		UserID:    &uid,
+		UserName:  user.Name,
+		UserEmail: user.Email,
+		Action:    "auth.2fa_challenge",
+		IPAddress: auditIP(r),
+		Metadata:  models.JSONB{"setup_required": !enrolled},
+	})
+
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"twoFactorRequired": true,
+		"setupRequired":     !enrolled,
+		"methods":           methods,
+		"challengeToken":    token,
+		"expiresIn":         int(loginChallengeTTL.Seconds()),
+	})
+}
+
+// challengeUser returns the user a login challenge token was issued to.
+func (h *AuthHandler) challengeUser(tokenStr string) (*models.User, bool) {
+	claims := &loginChallengeClaims{}
+	token, err := jwt.ParseWithClaims(tokenStr, claims, func(*jwt.Token) (interface{}, error) {
+		return h.challengeKey(), nil
+	}, jwt.WithValidMethods([]string{jwt.SigningMethodHS256.Alg()}), jwt.WithAudience(loginChallengeAud))
+	if err != nil || !token.Valid {
+		return nil, false
+	}
+	var user models.User
+	if err := h.db.First(&user, "id = ?", claims.Sub).Error; err != nil {
+		return nil, false
+	}
+	return &user, true
+}
+
+func (h *AuthHandler) audit2FA(r *http.Request, user *models.User, action string, metadata models.JSONB) {
+	uid := user.ID
+	LogAudit(h.db, AuditEntry{
+		UserID:    &uid,
+		UserName:  user.Name,
+		UserEmail: user.Email,
+		Action:    action,
+		IPAddress: auditIP(r),
+		Metadata:  metadata,
+	})
+}
+
+// POST /api/v1/auth/login/2fa
+func (h *AuthHandler) LoginSecondFactor(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		ChallengeToken string `json:"challengeToken"`
+		Code           string `json:"code"`
+		RecoveryCode   string `json:"recoveryCode"`
+	}
+	if err := readJSON(r, &req); err != nil {
+		writeError(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+	user, ok := h.challengeUser(req.ChallengeToken)
+	if !ok {
+		writeError(w, http.StatusUnauthorized, "Login challenge expired — sign in again")
+		return
+	}
+
+	method, err := h.verifySecondFactor(user.ID, req.Code, req.RecoveryCode)
+	if errors.Is(err, errTOTPNotEnrolled) && hasPasskey(h.db, user.ID) {
+		writeError(w, http.StatusBadRequest, "Use your passkey to finish signing in")
+		return
+	}
+	if errors.Is(err, errTOTPNotEnrolled) {
+		writeError(w, http.StatusForbidden, "Two-factor setup required")
+		return
+	}
+	if err != nil {
+		h.audit2FA(r, user, "auth.login_failed", models.JSONB{"reason": "wrong second factor"})
+		writeError(w, http.StatusUnauthorized, "Invalid code")
+		return
+	}
+
+	h.completeLogin(w, r, user, models.JSONB{"second_factor": method}, nil)
+}
+
+// POST /api/v1/auth/login/2fa/setup
+//
+// Starts enrollment for a user whose role requires 2FA and who has not set it
+// up yet, before they have a session.
+func (h *AuthHandler) LoginSetupSecondFactor(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		ChallengeToken string `json:"challengeToken"`
+	}
+	if err := readJSON(r, &req); err != nil {
+		writeError(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+	user, ok := h.challengeUser(req.ChallengeToken)
+	if !ok {
+		writeError(w, http.StatusUnauthorized, "Login challenge expired — sign in again")
+		return
+	}
+	if totpEnabled(h.db, user.ID) {
+		writeError(w, http.StatusConflict, "Two-factor authentication is already enabled")
+		return
+	}
+	h.writeEnrollment(w, r, user)
+}
+
+// POST /api/v1/auth/login/2fa/enable
+//
+// Confirms enrollment started with /auth/login/2fa/setup and completes the
+// login. The response carries the recovery codes.
+func (h *AuthHandler) LoginEnableSecondFactor(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		ChallengeToken string `json:"challengeToken"`
+		Code           string `json:"code"`
+	}
+	if err := readJSON(r, &req); err != nil {
+		writeError(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+	user, ok := h.challengeUser(req.ChallengeToken)
+	if !ok {
+		writeError(w, http.StatusUnauthorized, "Login challenge expired — sign in again")
+		return
+	}
+	codes, ok := h.confirmEnrollment(w, r, user, req.Code)
+	if !ok {
+		return
+	}
+	h.completeLogin(w, r, user, models.JSONB{"second_factor": "totp"}, codes)
+}
+
+// writeEnrollment starts enrollment and returns the secret to the client.
+func (h *AuthHandler) writeEnrollment(w http.ResponseWriter, r *http.Request, user *models.User) {
+	secret, uri, err := h.beginTOTPEnrollment(user)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "Failed to start two-factor setup")
+		return
+	}
+	h.audit2FA(r, user, "auth.2fa_setup", nil)
+	writeJSON(w, http.StatusOK, map[string]string{
+		"secret":     secret,
+		"otpauthUrl": uri,
+	})
+}
+
+// confirmEnrollment enables a pending enrollment once code checks out and
+// returns the first set of recovery codes. On failure it has written the
+// error response.
+func (h *AuthHandler) confirmEnrollment(w http.ResponseWriter, r *http.Request, user *models.User, code string) ([]string, bool) {
+	t := loadTOTP(h.db, user.ID)
+	if t == nil {
+		writeError(w, http.StatusBadRequest, "Start two-factor setup first")
+		return nil, false
+	}
+	if t.EnabledAt != nil {
+		writeError(w, http.StatusConflict, "Two-factor authentication is already enabled")
+		return nil, false
+	}
+	if !h.totpLimiter.Allow(user.ID.String()) {
+		writeError(w, http.StatusTooManyRequests, "Too many attempts — try again later")
+		return nil, false
+	}
+	if err := h.checkTOTP(t, code); err != nil {
+		writeError(w, http.StatusBadRequest, "Invalid code")
+		return nil, false
+	}
+	if err := h.db.Model(t).UpdateColumn("enabled_at", time.Now()).Error; err != nil {
+		writeError(w, http.StatusInternalServerError, "Failed to enable two-factor authentication")
+		return nil, false
+	}
+	codes, err := issueRecoveryCodes(h.db, user.ID)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "Failed to create recovery codes")
+		return nil, false
+	}
+	h.audit2FA(r, user, "auth.2fa_enable", nil)
+	return codes, true
+}
+
+// ── Self-service ────────────────────────────────────────────────────────────
+
+func (h *AuthHandler) currentUser(r *http.Request) (*models.User, bool) {
+	claims := mw.GetClaims(r)
+	if claims == nil {
+		return nil, false
+	}
+	var user models.User
+	if err := h.db.First(&user, "id = ?", claims.Sub).Error; err != nil {
+		return nil, false
+	}
+	return &user, true
+}
+
+// GET /api/v1/auth/2fa
+func (h *AuthHandler) TwoFactorStatus(w http.ResponseWriter, r *http.Request) {
+	user, ok := h.currentUser(r)
+	if !ok {
+		writeError(w, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+	t := loadTOTP(h.db, user.ID)
+	var remaining int64
+	h.db.Model(&models.TOTPRecoveryCode{}).Where("user_id = ? AND used_at IS NULL", user.ID).Count(&remaining)
+	resp := map[string]interface{}{
+		"enabled":                t != nil && t.EnabledAt != nil,
+		"required":               twoFactorRequired(h.db, user.Role),
+		"recoveryCodesRemaining": remaining,
+		"passkeys":               hasPasskey(h.db, user.ID),
+	}
+	if t != nil && t.EnabledAt != nil {
+		resp["enabledAt"] = t.EnabledAt
+	}
+	writeJSON(w, http.StatusOK, resp)
+}
+
+// POST /api/v1/auth/2fa/setup
+func (h *AuthHandler) SetupTwoFactor(w http.ResponseWriter, r *http.Request) {
+	user, ok := h.currentUser(r)
+	if !ok {
+		writeError(w, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+	if totpEnabled(h.db, user.ID) {
+		writeError(w, http.StatusConflict, "Two-factor authentication is already enabled")
+		return
+	}
+	h.writeEnrollment(w, r, user)
+}
+
+// POST /api/v1/auth/2fa/enable
+func (h *AuthHandler) EnableTwoFactor(w http.ResponseWriter, r *http.Request) {
+	user, ok := h.currentUser(r)
+	if !ok {
+		writeError(w, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+	var req struct {
+		Code string `json:"code"`
+	}
+	if err := readJSON(r, &req); err != nil {
+		writeError(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+	codes, ok := h.confirmEnrollment(w, r, user, req.Code)
+	if !ok {
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]interface{}{"recoveryCodes": codes})
+}
+
+// POST /api/v1/auth/2fa/disable
+func (h *AuthHandler) DisableTwoFactor(w http.ResponseWriter, r *http.Request) {
+	user, ok := h.currentUser(r)
+	if !ok {
+		writeError(w, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+	var req struct {
+		Password     string `json:"password"`
+		Code         string `json:"code"`
+		RecoveryCode string `json:"recoveryCode"`
+	}
+	if err := readJSON(r, &req); err != nil {
+		writeError(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+	if twoFactorRequired(h.db, user.Role) {
+		writeError(w, http.StatusForbidden, "Two-factor authentication is required for your role")
+		return
+	}
+	if err := bcrypt.CompareHashAndPassword([]byte(user.PasswordHash), []byte(req.Password)); err != nil {
+		writeError(w, http.StatusUnauthorized, "Current password is incorrect")
+		return
+	}
+	if _, err := h.verifySecondFactor(user.ID, req.Code, req.RecoveryCode); err != nil {
+		writeError(w, http.StatusUnauthorized, "Invalid code")
+		return
+	}
+	if err := clearTwoFactor(h.db, user.ID); err != nil {
+		writeError(w, http.StatusInternalServerError, "Failed to disable two-factor authentication")
+		return
+	}
+	h.audit2FA(r, user, "auth.2fa_disable", nil)
+	writeJSON(w, http.StatusOK, map[string]string{"message": "Two-factor authentication disabled"})
+}
+
+// POST /api/v1/auth/2fa/recovery-codes
+func (h *AuthHandler) RegenerateRecoveryCodes(w http.ResponseWriter, r *http.Request) {
+	user, ok := h.currentUser(r)
+	if !ok {
+		writeError(w, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+	var req struct {
+		Code string `json:"code"`
+	}
+	if err := readJSON(r, &req); err != nil {
+		writeError(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+	method, err := h.verifySecondFactor(user.ID, req.Code, "")
+	if errors.Is(err, errTOTPNotEnrolled) {
+		writeError(w, http.StatusBadRequest, "Two-factor authentication is not enabled")
+		return
+	}
+	if err != nil || method != "totp" {
+		writeError(w, http.StatusUnauthorized, "Invalid code")
+		return
+	}
+	codes, err := issueRecoveryCodes(h.db, user.ID)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "Failed to create recovery codes")
+		return
+	}
+	h.audit2FA(r, user, "auth.2fa_recovery_codes", nil)
+	writeJSON(w, http.StatusOK, map[string]interface{}{"recoveryCodes": codes})
+}
+
+func clearTwoFactor(db *gorm.DB, userID uuid.UUID) error {
+	return db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("user_id = ?", userID).Delete(&models.TOTPRecoveryCode{}).Error; err != nil {
+			return err
+		}
+		return tx.Where("user_id = ?", userID).Delete(&models.UserTOTP{}).Error
+	})
+}
+
+// ── Admin ───────────────────────────────────────────────────────────────────
+
+// DELETE /api/v1/admin/users/{id}/2fa
+//
+// Removes a user's authenticator and recovery codes, e.g. after a lost phone.
+// If their role requires 2FA they enroll again at their next login.
+func (h *AuthHandler) ResetTwoFactor(w http.ResponseWriter, r *http.Request) {
+	claims := mw.GetClaims(r)
+	callerID, _ := uuid.Parse(claims.Sub)
+
+	targetID, err := uuid.Parse(chi.URLParam(r, "id"))
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "Invalid user ID")
+		return
+	}
+	var target models.User
+	if err := h.db.First(&target, "id = ?", targetID).Error; err != nil {
+		writeError(w, http.StatusNotFound, "User not found")
+		return
+	}
+	if target.Role == "owner" && claims.Role != "owner" {
+		writeError(w, http.StatusForbidden, "Only an owner can reset an owner's two-factor authentication")
+		return
+	}
+	if err := clearTwoFactor(h.db, targetID); err != nil {
+		writeError(w, http.StatusInternalServerError, "Failed to reset two-factor authentication")
+		return
+	}
+
+	var caller models.User
+	h.db.Select("name, email").First(&caller, "id = ?", callerID)
+	LogAudit(h.db, AuditEntry{
+		UserID:       &callerID,
+		UserName:     caller.Name,
+		UserEmail:    caller.Email,
+		Action:       "auth.2fa_reset",
+		ResourceType: "user",
+		ResourceName: target.Email,
+		ResourceID:   target.ID.String(),
+		IPAddress:    auditIP(r),
+	})
+	writeJSON(w, http.StatusOK, map[string]string{"message": "Two-factor authentication reset"})
+}
+
+// GET /api/v1/admin/2fa-policy
+func (h *AuthHandler) GetTwoFactorPolicy(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, map[string]bool{"requireForAdmins": twoFactorRequired(h.db, "admin")})
+}
+
+// PUT /api/v1/admin/2fa-policy
+func (h *AuthHandler) UpdateTwoFactorPolicy(w http.ResponseWriter, r *http.Request) {
+	claims := mw.GetClaims(r)
+	callerID, _ := uuid.Parse(claims.Sub)
+
+	var req struct {
+		RequireForAdmins bool `json:"requireForAdmins"`
+	}
+	if err := readJSON(r, &req); err != nil {
+		writeError(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+	// Turning the requirement on while the caller has no authenticator would
+	// send them through enrollment at their next login; make them enroll first.
+	if req.RequireForAdmins && !totpEnabled(h.db, callerID) && !hasPasskey(h.db, callerID) {
+		writeError(w, http.StatusBadRequest, "Enable two-factor authentication or add a passkey on your own account first")
+		return
+	}
+
+	value := models.JSONB{"value": req.RequireForAdmins}
+	var setting models.Setting
+	if err := h.db.Where("user_id IS NULL AND key = ?", require2FASettingsKey).First(&setting).Error; err != nil {
+		setting = models.Setting{ID: uuid.New(), Key: require2FASettingsKey, Value: value}
+		err = h.db.Create(&setting).Error
+		if err != nil {
+			writeError(w, http.StatusInternalServerError, "Failed to save policy")
+			return
+		}
+	} else if err := h.db.Model(&setting).Update("value", value).Error; err != nil {
+		writeError(w, http.StatusInternalServerError, "Failed to save policy")
+		return
+	}
+
+	var caller models.User
+	h.db.Select("name, email").First(&caller, "id = ?", callerID)
+	LogAudit(h.db, AuditEntry{
+		UserID:    &callerID,
+		UserName:  caller.Name,
+		UserEmail: caller.Email,
+		Action:    "settings.2fa_policy",
+		IPAddress: auditIP(r),
+		Metadata:  models.JSONB{"require_for_admins": req.RequireForAdmins},
+	})
+	writeJSON(w, http.StatusOK, map[string]bool{"requireForAdmins": req.RequireForAdmins})
+}
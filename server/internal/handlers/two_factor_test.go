@@ -0,0 +1,49 @@
+package handlers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/zynqcloud/api/internal/config"
+	mw "github.com/zynqcloud/api/internal/middleware"
+	"github.com/zynqcloud/api/internal/models"
+)
+
+func TestLoginChallengeIsNotASession(t *testing.T) {
+	h := &AuthHandler{cfg: &config.Config{JWTSecret: "test-secret"}}
+	token, err := h.signLoginChallenge(uuid.New())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	reached := false
+	protected := mw.Auth(h.cfg.JWTSecret, nil, nil)(http.HandlerFunc(func(http.ResponseWriter, *http.Request) {
+		reached = true
+	}))
+	req := httptest.NewRequest(http.MethodGet, "/api/v1/auth/me", nil)
+	req.Header.Set("Authorization", "Bearer "+token)
+	rec := httptest.NewRecorder()
+	protected.ServeHTTP(rec, req)
+	if reached || rec.Code != http.StatusUnauthorized {
+		t.Errorf("challenge token accepted as a session (status %d)", rec.Code)
+	}
+
+	session, err := h.accessToken(&models.User{ID: uuid.New(), Email: "a@example.com", Role: "user"}, uuid.New())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := h.challengeUser(session); ok {
+		t.Error("session token accepted as a login challenge")
+	}
+}
+
+func TestHashRecoveryCode(t *testing.T) {
+	if hashRecoveryCode("abcd-efgh-ijkl-mnop") != hashRecoveryCode(" ABCDEFGH IJKLMNOP ") {
+		t.Error("recovery codes differing only in case and separators hash differently")
+	}
+	if hashRecoveryCode("abcd-efgh-ijkl-mnop") == hashRecoveryCode("abcd-efgh-ijkl-mnoq") {
+		t.Error("different recovery codes hash the same")
+	}
+}
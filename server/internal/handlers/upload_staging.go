@@ -0,0 +1,162 @@
+package handlers
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/zynqcloud/api/internal/crypto"
+)
+
+// Upload staging
+//
+// Uploads are staged under UPLOAD_TEMP_DIR until their SHA-256 is known,
+// because the blob ID and key are derived from it (crypto.DeriveContentKeys).
+// Staged content is encrypted as it streams in, under a random staging key,
+// so a crash, a disk snapshot or a stray backup of the staging directory never
+// holds user plaintext. A single-request upload keeps its staging key in
+// memory only; a resumable session needs it across requests and stores it in
+// the manifest wrapped by the master key, like any other DEK.
+//
+// Each staged part is written as
+//
+//	[12-byte random IV] [AES-256-GCM-STREAM ciphertext]
+//
+// so parts re-sent under the same session key never reuse a nonce.
+
+// sniffLen is the number of leading bytes http.DetectContentType looks at.
+const sniffLen = 512
+
+// stagingIVLen is the size of the random IV leading each staged part.
+const stagingIVLen = 12
+
+// stagedUpload is upload content staged encrypted on local disk.
+type stagedUpload struct {
+	parts []string // staged part files, in content order
+	dek   []byte   // staging key the parts are encrypted with
+	size  int64    // plaintext bytes
+	sum   []byte   // SHA-256 of the plaintext
+	head  []byte   // first sniffLen plaintext bytes, for MIME sniffing
+}
+
+// sniffWriter keeps the first sniffLen bytes written to it.
+type sniffWriter struct{ buf []byte }
+
+func (s *sniffWriter) Write(p []byte) (int, error) {
+	if n := sniffLen - len(s.buf); n > 0 {
+		if len(p) < n {
+			n = len(p)
+		}
+		s.buf = append(s.buf, p[:n]...)
+	}
+	return len(p), nil
+}
+
+// stageUpload encrypts body into a new staging file under dir, hashing the
+// plaintext on the way, in a single pass. The caller removes the result.
+func stageUpload(dir string, c *crypto.Crypto, body io.Reader) (*stagedUpload, error) {
+	dek, err := c.GenerateDEK()
+	if err != nil {
+		return nil, err
+	}
+	hasher := sha256.New()
+	head := &sniffWriter{}
+	path, size, err := writeStagedPart(dir, ".upload-*", dek, io.TeeReader(body, io.MultiWriter(hasher, head)))
+	if err != nil {
+		return nil, err
+	}
+	return &stagedUpload{
+		parts: []string{path},
+		dek:   dek,
+		size:  size,
+		sum:   hasher.Sum(nil),
+		head:  head.buf,
+	}, nil
+}
+
+// writeStagedPart encrypts r under dek into a new file in dir named after
+// pattern (as for os.CreateTemp). It returns the file and the plaintext bytes
+// read.
+func writeStagedPart(dir, pattern string, dek []byte, r io.Reader) (string, int64, error) {
+	if err := os.MkdirAll(dir, 0o750); err != nil {
+		return "", 0, err
+	}
+	iv := make([]byte, stagingIVLen)
+	if _, err := rand.Read(iv); err != nil {
+		return "", 0, err
+	}
+	f, err := os.CreateTemp(dir, pattern)
+	if err != nil {
+		return "", 0, err
+	}
+	_, err = f.Write(iv)
+	var n int64
+	if err == nil {
+		n, err = crypto.EncryptStream(r, f, dek, iv)
+	}
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		os.Remove(f.Name())
+		return "", 0, err
+	}
+	return f.Name(), n, nil
+}
+
+// stagedSession assembles the parts of a completed upload session. Nothing
+// is decrypted to disk: the parts are read once here to hash the plaintext
+// and again when the blob is stored.
+func stagedSession(parts []string, dek []byte) (*stagedUpload, error) {
+	s := &stagedUpload{parts: parts, dek: dek}
+	rc := s.open()
+	defer rc.Close()
+	hasher := sha256.New()
+	head := &sniffWriter{}
+	n, err := io.Copy(io.MultiWriter(hasher, head), rc)
+	if err != nil {
+		return nil, err
+	}
+	s.size = n
+	s.sum = hasher.Sum(nil)
+	s.head = head.buf
+	return s, nil
+}
+
+// open streams the staged plaintext. Decryption happens in memory; a part
+// that fails authentication surfaces as a read error.
+func (s *stagedUpload) open() io.ReadCloser {
+	pr, pw := io.Pipe()
+	go func() {
+		for _, part := range s.parts {
+			if err := decryptStagedPart(part, s.dek, pw); err != nil {
+				pw.CloseWithError(err)
+				return
+			}
+		}
+		pw.Close()
+	}()
+	return pr
+}
+
+func decryptStagedPart(path string, dek []byte, w io.Writer) error {
+	f, err := os.Open(path) // #nosec G304 -- path from CreateTemp or the session directory
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	iv := make([]byte, stagingIVLen)
+	if _, err := io.ReadFull(f, iv); err != nil {
+		return fmt.Errorf("staged part %s: %w", path, err)
+	}
+	return crypto.DecryptStream(f, w, dek, iv)
+}
+
+// remove deletes the staged parts.
+func (s *stagedUpload) remove() {
+	for _, part := range s.parts {
+		os.Remove(part)
+	}
+}
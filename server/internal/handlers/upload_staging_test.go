@@ -0,0 +1,106 @@
+package handlers
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/base64"
+	"io"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/zynqcloud/api/internal/crypto"
+)
+
+func testCrypto(t *testing.T) *crypto.Crypto {
+	t.Helper()
+	c, err := crypto.New(base64.StdEncoding.EncodeToString(bytes.Repeat([]byte{7}, 32)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return c
+}
+
+func TestStageUpload(t *testing.T) {
+	c := testCrypto(t)
+	dir := t.TempDir()
+	plain := []byte(strings.Repeat("confidential quarterly numbers ", 100))
+
+	staged, err := stageUpload(dir, c, bytes.NewReader(plain))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer staged.remove()
+
+	if staged.size != int64(len(plain)) {
+		t.Errorf("size = %d, want %d", staged.size, len(plain))
+	}
+	if sum := sha256.Sum256(plain); !bytes.Equal(staged.sum, sum[:]) {
+		t.Error("sum is not the plaintext SHA-256")
+	}
+	if !bytes.Equal(staged.head, plain[:sniffLen]) {
+		t.Error("head is not the leading plaintext")
+	}
+
+	onDisk, err := os.ReadFile(staged.parts[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bytes.Contains(onDisk, []byte("confidential")) {
+		t.Error("staging file contains plaintext")
+	}
+
+	got, err := io.ReadAll(staged.open())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, plain) {
+		t.Error("open did not return the staged plaintext")
+	}
+
+	staged.remove()
+	if _, err := os.Stat(staged.parts[0]); !os.IsNotExist(err) {
+		t.Error("remove left the staging file behind")
+	}
+}
+
+func TestStagedSession(t *testing.T) {
+	c := testCrypto(t)
+	dir := t.TempDir()
+	key, _ := c.GenerateDEK()
+
+	// Parts arrive out of order and one is re-sent; only the part paths
+	// decide the content order.
+	chunks := []string{"<html>first ", "second ", "third"}
+	parts := make([]string, len(chunks))
+	for _, i := range []int{2, 0, 1, 0} {
+		path, n, err := writeStagedPart(dir, ".chunk-*", key, strings.NewReader(chunks[i]))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if n != int64(len(chunks[i])) {
+			t.Errorf("part %d: wrote %d plaintext bytes, want %d", i, n, len(chunks[i]))
+		}
+		parts[i] = path
+	}
+
+	staged, err := stagedSession(parts, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	plain := strings.Join(chunks, "")
+	if staged.size != int64(len(plain)) {
+		t.Errorf("size = %d, want %d", staged.size, len(plain))
+	}
+	if sum := sha256.Sum256([]byte(plain)); !bytes.Equal(staged.sum, sum[:]) {
+		t.Error("sum is not the plaintext SHA-256")
+	}
+	if got := detectUploadMimeType("upload", staged.head); got != "text/html" {
+		t.Errorf("sniffed MIME type = %q, want text/html", got)
+	}
+
+	other, _ := c.GenerateDEK()
+	if _, err := stagedSession(parts, other); err == nil {
+		t.Error("parts decrypted under the wrong key")
+	}
+}
@@ -1,6 +1,7 @@
 package handlers
 
 import (
+	"log/slog"
 	"net/http"
 	"strconv"
 
@@ -145,6 +146,8 @@ func (h *UsersHandler) Update(w http.ResponseWriter, r *http.Request) {
 			IPAddress:    auditIP(r),
 			Metadata:     models.JSONB{"old_role": oldRole, "new_role": *req.Role},
 		})
+		// Existing tokens carry the old role.
+		revokeUserSessions(h.db, user.ID, uuid.Nil)
 	}
 	if req.StorageLimit != nil {
 		LogAudit(h.db, AuditEntry{
@@ -190,6 +193,11 @@ func (h *UsersHandler) Delete(w http.ResponseWriter, r *http.Request) {
 	// Delete user's files and shares
 	h.db.Where("created_by = ?", userID).Delete(&models.Share{})
 	h.db.Where("grantee_user_id = ?", userID).Delete(&models.Share{})
+	var ownedIDs []uuid.UUID
+	h.db.Model(&models.File{}).Where("owner_id = ?", userID).Pluck("id", &ownedIDs)
+	if err := releaseFileBlobs(h.db, ownedIDs); err != nil {
+		slog.Error("user delete: release blob refs failed", "user_id", userID, "error", err)
+	}
 	h.db.Where("owner_id = ?", userID).Delete(&models.File{})
 	h.db.Delete(&user)
 
@@ -228,3 +236,44 @@ func (h *UsersHandler) ListShareable(w http.ResponseWriter, r *http.Request) {
 
 	writeJSON(w, http.StatusOK, users)
 }
+
+// applyMappedRole sets the role an identity provider or directory maps the
+// user to. source names the mapping in the audit log. The last owner is
+// never demoted this way, so a misconfigured mapping cannot orphan the
+// instance.
+func applyMappedRole(db *gorm.DB, user *models.User, role, source, ip string) {
+	if role == user.Role {
+		return
+	}
+	if user.Role == "owner" {
+		var owners int64
+		db.Model(&models.User{}).Where("role = ? AND disabled_at IS NULL", "owner").Count(&owners)
+		if owners <= 1 {
+			slog.Warn("group mapping would demote the last owner; keeping role", "user", user.Email, "source", source, "mapped_role", role)
+			return
+		}
+	}
+	updates := map[string]interface{}{"role": role}
+	if role == "admin" || role == "owner" {
+		updates["storage_limit"] = int64(0)
+	}
+	if err := db.Model(user).Updates(updates).Error; err != nil {
+		slog.Error("failed to apply mapped role", "user", user.Email, "source", source, "error", err)
+		return
+	}
+	oldRole := user.Role
+	user.Role = role
+	revokeUserSessions(db, user.ID, uuid.Nil)
+	uid := user.ID
+	LogAudit(db, AuditEntry{
+		UserID:       &uid,
+		UserName:     user.Name,
+		UserEmail:    user.Email,
+		Action:       "user.role_change",
+		ResourceType: "user",
+		ResourceName: user.Name,
+		ResourceID:   user.ID.String(),
+		IPAddress:    ip,
+		Metadata:     models.JSONB{"old_role": oldRole, "new_role": role, "source": source},
+	})
+}
@@ -0,0 +1,393 @@
+package handlers
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/google/uuid"
+	"github.com/zynqcloud/api/internal/config"
+	mw "github.com/zynqcloud/api/internal/middleware"
+	"github.com/zynqcloud/api/internal/models"
+	"github.com/zynqcloud/api/internal/storage"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// archiveCurrentVersion copies file's current content into file_versions
+// before it is overwritten. The version takes over the file's blob reference,
+// so file.BlobID is cleared and the following attachBlob releases nothing.
+// Must run inside the transaction that replaces the content.
+func archiveCurrentVersion(tx *gorm.DB, cfg *config.Config, file *models.File) (bool, error) {
+	if cfg.FileVersionRetention <= 0 || file.StoragePath == nil {
+		return false, nil
+	}
+
+	// Serialise concurrent overwrites of the same file so version numbers
+	// stay unique.
+	var locked models.File
+	if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+		Select("id").First(&locked, "id = ?", file.ID).Error; err != nil {
+		return false, err
+	}
+
+	var next int
+	if err := tx.Model(&models.FileVersion{}).Where("file_id = ?", file.ID).
+		Select("COALESCE(MAX(version_number), 0) + 1").Scan(&next).Error; err != nil {
+		return false, err
+	}
+
+	uploader := file.UploadedBy
+	if uploader == nil {
+		uploader = &file.OwnerID
+	}
+	v := models.FileVersion{
+		FileID:         file.ID,
+		VersionNumber:  next,
+		UploadedBy:     uploader,
+		BlobID:         file.BlobID,
+		StoragePath:    file.StoragePath,
+		EncryptedDEK:   file.EncryptedDEK,
+		EncryptionIV:   file.EncryptionIV,
+		EncryptionAlgo: file.EncryptionAlgo,
+		KeyID:          file.KeyID,
+		Size:           file.Size,
+		FileHash:       file.FileHash,
+		MimeType:       file.MimeType,
+	}
+	if err := tx.Create(&v).Error; err != nil {
+		return false, err
+	}
+	file.BlobID = nil
+	return true, nil
+}
+
+// deleteFileVersion removes one version, gives back its blob reference and
+// stops charging its size to the owner of a personal file.
+func deleteFileVersion(db *gorm.DB, backend storage.Backend, v *models.FileVersion) error {
+	return db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Delete(v).Error; err != nil {
+			return err
+		}
+		if v.BlobID != nil {
+			if err := releaseBlob(tx, *v.BlobID); err != nil {
+				return err
+			}
+		} else if v.StoragePath != nil {
+			deleteLegacyObjectIfUnreferenced(tx, backend, *v.StoragePath)
+		}
+		return tx.Exec(`
+			UPDATE users SET storage_used = GREATEST(storage_used - ?, 0)
+			WHERE id = (SELECT owner_id FROM files WHERE id = ? AND space_id IS NULL)`,
+			v.Size, v.FileID).Error
+	})
+}
+
+// deleteLegacyObjectIfUnreferenced deletes a pre-CAS per-file object once no
+// file or version points at it any more.
+func deleteLegacyObjectIfUnreferenced(tx *gorm.DB, backend storage.Backend, storagePath string) {
+	var refCount int64
+	tx.Model(&models.File{}).
+		Clauses(clause.Locking{Strength: "UPDATE"}).
+		Where("storage_path = ?", storagePath).
+		Count(&refCount)
+	var versionRefs int64
+	tx.Model(&models.FileVersion{}).Where("storage_path = ?", storagePath).Count(&versionRefs)
+	if refCount+versionRefs == 0 {
+		backend.Delete(storagePath)
+	}
+}
+
+// removeLegacyVersionObjects deletes the pre-CAS objects held only by
+// versions of the given files. Call before the files are deleted; the
+// version rows themselves go with the files (ON DELETE CASCADE).
+func removeLegacyVersionObjects(db *gorm.DB, backend storage.Backend, fileIDs []uuid.UUID) {
+	if len(fileIDs) == 0 {
+		return
+	}
+	var paths []string
+	db.Model(&models.FileVersion{}).
+		Where("file_id IN ? AND blob_id IS NULL AND storage_path IS NOT NULL", fileIDs).
+		Distinct().Pluck("storage_path", &paths)
+	for _, p := range paths {
+		var refCount int64
+		db.Model(&models.File{}).Where("storage_path = ? AND id NOT IN ?", p, fileIDs).Count(&refCount)
+		var versionRefs int64
+		db.Model(&models.FileVersion{}).Where("storage_path = ? AND file_id NOT IN ?", p, fileIDs).Count(&versionRefs)
+		if refCount+versionRefs == 0 {
+			backend.Delete(p)
+		}
+	}
+}
+
+// pruneFileVersions enforces the per-file retention count right after an
+// overwrite so a busy file never grows past it between sweeps.
+func pruneFileVersions(db *gorm.DB, backend storage.Backend, cfg *config.Config, fileID uuid.UUID) {
+	var stale []models.FileVersion
+	db.Where("file_id = ?", fileID).Order("version_number DESC").
+		Offset(cfg.FileVersionRetention).Find(&stale)
+	for i := range stale {
+		if err := deleteFileVersion(db, backend, &stale[i]); err != nil {
+			slog.Error("prune version failed", "file_id", fileID, "version_id", stale[i].ID, "error", err)
+		}
+	}
+}
+
+// PruneFileVersions deletes versions beyond FILE_VERSION_RETENTION per file
+// and versions older than FILE_VERSION_MAX_AGE_DAYS. It returns how many were
+// removed.
+func PruneFileVersions(db *gorm.DB, backend storage.Backend, cfg *config.Config) (int, error) {
+	keep := cfg.FileVersionRetention
+	if keep < 0 {
+		keep = 0
+	}
+	// A cutoff in the future never matches, which disables the age limit.
+	cutoff := time.Now().Add(24 * time.Hour)
+	if cfg.FileVersionMaxAgeDays > 0 {
+		cutoff = time.Now().AddDate(0, 0, -cfg.FileVersionMaxAgeDays)
+	}
+
+	var ids []uuid.UUID
+	if err := db.Raw(`
+		SELECT id FROM (
+			SELECT id, created_at,
+			       ROW_NUMBER() OVER (PARTITION BY file_id ORDER BY version_number DESC) AS rn
+			FROM file_versions
+		) v
+		WHERE rn > ? OR created_at < ?
+		LIMIT 1000`, keep, cutoff).Scan(&ids).Error; err != nil {
+		return 0, fmt.Errorf("list expired versions: %w", err)
+	}
+
+	var removed int
+	for _, id := range ids {
+		var v models.FileVersion
+		if err := db.First(&v, "id = ?", id).Error; err != nil {
+			continue
+		}
+		if err := deleteFileVersion(db, backend, &v); err != nil {
+			return removed, fmt.Errorf("delete version %s: %w", id, err)
+		}
+		removed++
+	}
+	return removed, nil
+}
+
+// RunVersionPrunePeriodic starts a background goroutine that calls
+// PruneFileVersions on every interval until ctx is cancelled.
+func RunVersionPrunePeriodic(ctx context.Context, db *gorm.DB, backend storage.Backend, cfg *config.Config, interval time.Duration, logger *slog.Logger) <-chan struct{} {
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				n, err := PruneFileVersions(db, backend, cfg)
+				if err != nil {
+					logger.Error("version prune failed", "removed", n, "error", err)
+				} else if n > 0 {
+					logger.Info("version prune: cycle complete", "removed", n)
+				}
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	return done
+}
+
+// versionBytesUsed returns the bytes held by previous versions of the user's
+// personal files. Trashed files are excluded, matching the live-file total.
+func versionBytesUsed(db *gorm.DB, userID uuid.UUID) int64 {
+	var total int64
+	db.Raw(`
+		SELECT COALESCE(SUM(v.size), 0) FROM file_versions v
+		JOIN files f ON f.id = v.file_id
+		WHERE f.owner_id = ? AND f.space_id IS NULL AND f.deleted_at IS NULL`, userID).Scan(&total)
+	return total
+}
+
+// versionBytesByOwner is versionBytesUsed for every user in one query.
+func versionBytesByOwner(db *gorm.DB) map[string]int64 {
+	type row struct {
+		OwnerID string
+		Used    int64
+	}
+	var rows []row
+	db.Raw(`
+		SELECT f.owner_id, COALESCE(SUM(v.size), 0) AS used FROM file_versions v
+		JOIN files f ON f.id = v.file_id
+		WHERE f.space_id IS NULL AND f.deleted_at IS NULL
+		GROUP BY f.owner_id`).Scan(&rows)
+	out := make(map[string]int64, len(rows))
+	for _, r := range rows {
+		out[r.OwnerID] = r.Used
+	}
+	return out
+}
+
+// loadOwnedVersionedFile resolves {id} to a live personal file owned by the caller.
+func (h *FilesHandler) loadOwnedVersionedFile(w http.ResponseWriter, r *http.Request) (*models.File, uuid.UUID, bool) {
+	claims := mw.GetClaims(r)
+	userID, _ := uuid.Parse(claims.Sub)
+
+	fileID, err := uuid.Parse(chi.URLParam(r, "id"))
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "Invalid file ID")
+		return nil, userID, false
+	}
+
+	var file models.File
+	if err := h.db.Where("id = ? AND owner_id = ? AND deleted_at IS NULL AND space_id IS NULL", fileID, userID).First(&file).Error; err != nil {
+		writeError(w, http.StatusNotFound, "File not found")
+		return nil, userID, false
+	}
+	if file.IsFolder {
+		writeError(w, http.StatusBadRequest, "Folders have no versions")
+		return nil, userID, false
+	}
+	return &file, userID, true
+}
+
+// GET /api/v1/files/{id}/versions
+func (h *FilesHandler) ListVersions(w http.ResponseWriter, r *http.Request) {
+	file, _, ok := h.loadOwnedVersionedFile(w, r)
+	if !ok {
+		return
+	}
+
+	var versions []models.FileVersion
+	h.db.Preload("Uploader", func(db *gorm.DB) *gorm.DB {
+		return db.Select("id, name, email")
+	}).Where("file_id = ?", file.ID).Order("version_number DESC").Find(&versions)
+
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"items":     versions,
+		"retention": h.cfg.FileVersionRetention,
+	})
+}
+
+// GET /api/v1/files/{id}/versions/{versionId}/download
+func (h *FilesHandler) DownloadVersion(w http.ResponseWriter, r *http.Request) {
+	file, _, ok := h.loadOwnedVersionedFile(w, r)
+	if !ok {
+		return
+	}
+
+	versionID, err := uuid.Parse(chi.URLParam(r, "versionId"))
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "Invalid version ID")
+		return
+	}
+	var v models.FileVersion
+	if err := h.db.Where("id = ? AND file_id = ?", versionID, file.ID).First(&v).Error; err != nil {
+		writeError(w, http.StatusNotFound, "Version not found")
+		return
+	}
+	if v.StoragePath == nil {
+		writeError(w, http.StatusNotFound, "File data not found")
+		return
+	}
+
+	h.streamDecryptedFile(w, r, &models.File{
+		ID:             v.ID,
+		UpdatedAt:      v.CreatedAt,
+		Name:           file.Name,
+		MimeType:       v.MimeType,
+		Size:           v.Size,
+		StoragePath:    v.StoragePath,
+		EncryptedDEK:   v.EncryptedDEK,
+		EncryptionIV:   v.EncryptionIV,
+		EncryptionAlgo: v.EncryptionAlgo,
+	})
+}
+
+// POST /api/v1/files/{id}/versions/{versionId}/restore
+func (h *FilesHandler) RestoreVersion(w http.ResponseWriter, r *http.Request) {
+	file, userID, ok := h.loadOwnedVersionedFile(w, r)
+	if !ok {
+		return
+	}
+
+	versionID, err := uuid.Parse(chi.URLParam(r, "versionId"))
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "Invalid version ID")
+		return
+	}
+
+	var restored models.FileVersion
+	err = h.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+			Where("id = ? AND file_id = ?", versionID, file.ID).First(&restored).Error; err != nil {
+			return err
+		}
+
+		archived, err := archiveCurrentVersion(tx, h.cfg, file)
+		if err != nil {
+			return err
+		}
+		if !archived && file.StoragePath != nil {
+			// Versioning was switched off after this version was kept: the
+			// current content is dropped rather than archived.
+			if file.BlobID != nil {
+				if err := releaseBlob(tx, *file.BlobID); err != nil {
+					return err
+				}
+			}
+			tx.Model(&models.User{}).Where("id = ?", file.OwnerID).
+				UpdateColumn("storage_used", gorm.Expr("GREATEST(storage_used - ?, 0)", file.Size))
+		}
+
+		// The restored version's blob reference moves back to the file.
+		if err := tx.Delete(&restored).Error; err != nil {
+			return err
+		}
+		updates := map[string]interface{}{
+			"blob_id":         restored.BlobID,
+			"storage_path":    restored.StoragePath,
+			"encrypted_dek":   restored.EncryptedDEK,
+			"encryption_iv":   restored.EncryptionIV,
+			"encryption_algo": restored.EncryptionAlgo,
+			"key_id":          restored.KeyID,
+			"size":            restored.Size,
+			"file_hash":       restored.FileHash,
+			"mime_type":       restored.MimeType,
+			"uploaded_by":     restored.UploadedBy,
+		}
+		return tx.Model(file).Updates(updates).Error
+	})
+	if err == gorm.ErrRecordNotFound {
+		writeError(w, http.StatusNotFound, "Version not found")
+		return
+	}
+	if err != nil {
+		slog.Error("restore version failed", "file_id", file.ID, "version_id", versionID, "error", err)
+		writeError(w, http.StatusInternalServerError, "Failed to restore version")
+		return
+	}
+	pruneFileVersions(h.db, h.backend, h.cfg, file.ID)
+
+	h.db.First(file, "id = ?", file.ID)
+
+	var auditUser models.User
+	h.db.Select("name, email").First(&auditUser, "id = ?", userID)
+	LogAudit(h.db, AuditEntry{
+		UserID:       &userID,
+		UserName:     auditUser.Name,
+		UserEmail:    auditUser.Email,
+		Action:       "file.version_restore",
+		ResourceType: "file",
+		ResourceName: file.Name,
+		ResourceID:   file.ID.String(),
+		IPAddress:    auditIP(r),
+		Metadata:     models.JSONB{"version_number": restored.VersionNumber, "size": restored.Size},
+	})
+
+	writeJSON(w, http.StatusOK, file)
+}
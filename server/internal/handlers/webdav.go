@@ -0,0 +1,1394 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	mw "github.com/zynqcloud/api/internal/middleware"
+	"github.com/zynqcloud/api/internal/models"
+	"gorm.io/gorm"
+)
+
+// WebDAV
+//
+// The handler mounted at DAVPrefix serves the caller's personal files under
+// /files/ and every space they belong to under /spaces/<space name>/. Clients
+// sign in with HTTP Basic auth using their email and an app password.
+//
+// Access follows the JSON API: personal files are reachable by their owner
+// only, space members can read, contributors and admins can write, and
+// contributors may only rename, move or delete their own files. Uploads go
+// through the same pipeline as the browser (encrypted, deduplicated,
+// versioned and charged against the quota) and downloads are decrypted while
+// they stream, so large files are never held in memory.
+
+// DAVPrefix is the path the WebDAV handler is mounted at.
+const DAVPrefix = "/dav"
+
+// WebDAVMethods are the request methods WebDAV adds to HTTP. They have to be
+// registered with the router before any route is added.
+var WebDAVMethods = []string{"PROPFIND", "PROPPATCH", "MKCOL", "COPY", "MOVE", "LOCK", "UNLOCK"}
+
+// davMaxUploadSize is the same cap as the JSON upload endpoints.
+const davMaxUploadSize = 15 * 1024 * 1024 * 1024
+
+// davMaxXMLBody bounds PROPFIND, PROPPATCH and LOCK request bodies.
+const davMaxXMLBody = 1 << 20
+
+type WebDAVHandler struct {
+	db     *gorm.DB
+	files  *FilesHandler
+	spaces *SpacesHandler
+	locks  *davLockSystem
+}
+
+func NewWebDAVHandler(db *gorm.DB, files *FilesHandler, spaces *SpacesHandler) *WebDAVHandler {
+	return &WebDAVHandler{db: db, files: files, spaces: spaces, locks: newDAVLockSystem()}
+}
+
+// Authenticate accepts HTTP Basic credentials made of an account email and
+// one of that account's app passwords, and stores the same claims as
+// middleware.Auth so the WebDAV methods can use mw.GetClaims. The app
+// password's scopes must cover the request (see davScopes).
+func (h *WebDAVHandler) Authenticate(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		email, secret, ok := r.BasicAuth()
+		var ap *models.AppPassword
+		var user *models.User
+		var err error
+		if ok {
+			ap, user, err = authenticateAppPassword(h.db, r, email, secret)
+		}
+		if !ok || err != nil {
+			w.Header().Set("WWW-Authenticate", `Basic realm="ZynqCloud", charset="UTF-8"`)
+			writeError(w, http.StatusUnauthorized, "Unauthorized")
+			return
+		}
+		claims := appPasswordClaims(ap, user)
+		for _, scope := range davScopes(r) {
+			if !claims.HasScope(scope) {
+				writeError(w, http.StatusForbidden, "App password lacks the "+scope+" scope")
+				return
+			}
+		}
+		ctx := context.WithValue(r.Context(), mw.UserClaimsKey, claims)
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+// davScopes returns the scopes a WebDAV request needs: read or write on the
+// area its path is in (personal files or spaces) and, for COPY and MOVE,
+// write on the destination's area. COPY only reads its source.
+func davScopes(r *http.Request) []string {
+	write := true
+	switch r.Method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions, "PROPFIND", "COPY":
+		write = false
+	}
+	var scopes []string
+	if s := davAreaScope(davPath(r.URL.Path), write); s != "" {
+		scopes = append(scopes, s)
+	}
+	if r.Method == "COPY" || r.Method == "MOVE" {
+		if dst, ok := davDestination(r); ok {
+			if s := davAreaScope(dst, true); s != "" {
+				scopes = append(scopes, s)
+			}
+		}
+	}
+	return scopes
+}
+
+// davAreaScope maps a path below DAVPrefix to its scope. The mount root
+// needs none: it only lists the two areas.
+func davAreaScope(p string, write bool) string {
+	area, _, _ := strings.Cut(strings.TrimPrefix(p, "/"), "/")
+	switch {
+	case area == "files" && write:
+		return mw.ScopeFilesWrite
+	case area == "files":
+		return mw.ScopeFilesRead
+	case area == "spaces" && write:
+		return mw.ScopeSpacesWrite
+	case area == "spaces":
+		return mw.ScopeSpacesRead
+	}
+	return ""
+}
+
+func (h *WebDAVHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodOptions:
+		h.options(w, r)
+	case http.MethodGet, http.MethodHead:
+		h.get(w, r)
+	case http.MethodPut:
+		h.put(w, r)
+	case http.MethodDelete:
+		h.delete(w, r)
+	case "MKCOL":
+		h.mkcol(w, r)
+	case "COPY", "MOVE":
+		h.copyMove(w, r)
+	case "PROPFIND":
+		h.propfind(w, r)
+	case "PROPPATCH":
+		h.proppatch(w, r)
+	case "LOCK":
+		h.lock(w, r)
+	case "UNLOCK":
+		h.unlock(w, r)
+	default:
+		writeError(w, http.StatusMethodNotAllowed, "Method not allowed")
+	}
+}
+
+// ── Path resolution ─────────────────────────────────────────────────────────
+
+// davScope is one file tree reachable over WebDAV: the caller's personal
+// files, or a space they are a member of.
+type davScope struct {
+	space *models.Space // nil for personal files
+	role  string        // caller's role in space
+}
+
+func (s *davScope) spaceID() *uuid.UUID {
+	if s.space == nil {
+		return nil
+	}
+	return &s.space.ID
+}
+
+// files restricts a query to the live rows of this tree.
+func (s *davScope) files(db *gorm.DB, userID uuid.UUID) *gorm.DB {
+	if s.space == nil {
+		return db.Model(&models.File{}).Where("owner_id = ? AND space_id IS NULL AND deleted_at IS NULL", userID)
+	}
+	return db.Model(&models.File{}).Where("space_id = ? AND deleted_at IS NULL", s.space.ID)
+}
+
+// canCreate reports whether the caller may add files and folders.
+func (s *davScope) canCreate() bool {
+	return s.space == nil || canWrite(s.role)
+}
+
+// canModify applies the checks of the rename and delete endpoints: in a
+// space, contributors may only change their own files.
+func (s *davScope) canModify(file *models.File, userID uuid.UUID, userRole string) bool {
+	if s.space == nil {
+		return true // personal rows are only ever resolved for their owner
+	}
+	if isSpaceAdminOrGlobal(s.role, userRole) {
+		return true
+	}
+	return canWrite(s.role) && file.OwnerID == userID
+}
+
+func sameDAVScope(a, b *davScope) bool {
+	if a.space == nil || b.space == nil {
+		return a.space == nil && b.space == nil
+	}
+	return a.space.ID == b.space.ID
+}
+
+// davNode is a request path resolved against the database.
+type davNode struct {
+	path     string       // cleaned path below DAVPrefix; "/" is the mount root
+	scope    *davScope    // nil for "/", "/spaces" and unknown top-level names
+	file     *models.File // nil for the collections above the file rows, or when missing
+	parentID *uuid.UUID   // folder holding the resource; nil at the top of a scope
+	name     string       // last path segment
+	exists   bool
+	orphan   bool // a collection on the way to the resource does not exist
+}
+
+func (n *davNode) isCollection() bool {
+	return n.file == nil || n.file.IsFolder
+}
+
+// davPath returns the cleaned request path below DAVPrefix.
+func davPath(p string) string {
+	p = strings.TrimPrefix(p, DAVPrefix)
+	return path.Clean("/" + p)
+}
+
+func (h *WebDAVHandler) resolve(userID uuid.UUID, p string) (*davNode, error) {
+	n := &davNode{path: davPath(p)}
+	if n.path == "/" {
+		n.exists = true
+		return n, nil
+	}
+	segs := strings.Split(n.path[1:], "/")
+	n.name = segs[len(segs)-1]
+
+	var rest []string
+	switch segs[0] {
+	case "files":
+		n.scope = &davScope{}
+		rest = segs[1:]
+	case "spaces":
+		if len(segs) == 1 {
+			n.exists = true
+			return n, nil
+		}
+		space, err := h.memberSpace(userID, segs[1])
+		if err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				n.orphan = len(segs) > 2
+				return n, nil
+			}
+			return nil, err
+		}
+		n.scope = &davScope{space: space, role: spaceRole(h.db, space.ID, userID)}
+		rest = segs[2:]
+	default:
+		n.orphan = len(segs) > 1
+		return n, nil
+	}
+	if len(rest) == 0 {
+		n.exists = true
+		return n, nil
+	}
+
+	var parentID *uuid.UUID
+	for i, name := range rest {
+		q := n.scope.files(h.db, userID).Where("name = ?", name)
+		if parentID == nil {
+			q = q.Where("parent_id IS NULL")
+		} else {
+			q = q.Where("parent_id = ?", *parentID)
+		}
+		// Names are not unique in the files table; the oldest entry wins
+		// and a folder wins over a file so paths keep resolving.
+		var f models.File
+		err := q.Order("is_folder DESC, created_at ASC").First(&f).Error
+		last := i == len(rest)-1
+		if err != nil {
+			if !errors.Is(err, gorm.ErrRecordNotFound) {
+				return nil, err
+			}
+			n.parentID = parentID
+			n.orphan = !last
+			return n, nil
+		}
+		if last {
+			n.file = &f
+			n.parentID = parentID
+			n.exists = true
+			return n, nil
+		}
+		if !f.IsFolder {
+			n.orphan = true
+			return n, nil
+		}
+		id := f.ID
+		parentID = &id
+	}
+	return n, nil
+}
+
+// memberSpace finds the space called name among the caller's spaces.
+func (h *WebDAVHandler) memberSpace(userID uuid.UUID, name string) (*models.Space, error) {
+	var space models.Space
+	err := h.db.
+		Where("spaces.id IN ("+userSpacesSQL+")", map[string]interface{}{"user": userID}).
+		Where("spaces.name = ?", name).
+		Order("spaces.created_at ASC").
+		First(&space).Error
+	if err != nil {
+		return nil, err
+	}
+	return &space, nil
+}
+
+// davHref turns a path below DAVPrefix into an escaped href. Collections end
+// in a slash.
+func davHref(p string, collection bool) string {
+	segs := strings.Split(strings.Trim(p, "/"), "/")
+	for i := range segs {
+		segs[i] = url.PathEscape(segs[i])
+	}
+	href := DAVPrefix + "/" + strings.Join(segs, "/")
+	if collection && !strings.HasSuffix(href, "/") {
+		href += "/"
+	}
+	return href
+}
+
+// davDestination returns the path below DAVPrefix named by the Destination
+// header. The host is not compared with the request's: behind a reverse
+// proxy the two routinely differ.
+func davDestination(r *http.Request) (string, bool) {
+	raw := r.Header.Get("Destination")
+	if raw == "" {
+		return "", false
+	}
+	u, err := url.Parse(raw)
+	if err != nil {
+		return "", false
+	}
+	rest, ok := strings.CutPrefix(u.Path, DAVPrefix)
+	if !ok || (rest != "" && rest[0] != '/') {
+		return "", false
+	}
+	return davPath(rest), true
+}
+
+// checkLocks reports whether the request may modify p, answering 423 when a
+// lock it does not hold is in the way.
+func (h *WebDAVHandler) checkLocks(w http.ResponseWriter, r *http.Request, userID uuid.UUID, p string, recursive bool) bool {
+	if h.locks.confirm(p, recursive, userID, davIfTokens(r.Header.Get("If"))) {
+		return true
+	}
+	writeError(w, http.StatusLocked, "Resource is locked")
+	return false
+}
+
+// ── Methods ─────────────────────────────────────────────────────────────────
+
+func (h *WebDAVHandler) options(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("DAV", "1, 2")
+	w.Header().Set("MS-Author-Via", "DAV")
+	w.Header().Set("Allow", "OPTIONS, GET, HEAD, PUT, DELETE, MKCOL, COPY, MOVE, PROPFIND, PROPPATCH, LOCK, UNLOCK")
+	w.WriteHeader(http.StatusOK)
+}
+
+// GET, HEAD /dav/...
+func (h *WebDAVHandler) get(w http.ResponseWriter, r *http.Request) {
+	claims := mw.GetClaims(r)
+	userID, _ := uuid.Parse(claims.Sub)
+
+	n, err := h.resolve(userID, r.URL.Path)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "Failed to resolve path")
+		return
+	}
+	if !n.exists {
+		writeError(w, http.StatusNotFound, "Not found")
+		return
+	}
+	if n.isCollection() {
+		writeError(w, http.StatusMethodNotAllowed, "Cannot download a collection")
+		return
+	}
+	file := n.file
+
+	if file.StoragePath == nil || r.Method == http.MethodHead {
+		// Content was never uploaded (e.g. a locked placeholder), or the
+		// client only wants the metadata: answer without touching storage.
+		mimeType := "application/octet-stream"
+		if file.MimeType != nil {
+			mimeType = *file.MimeType
+		}
+		size := file.Size
+		if file.StoragePath == nil {
+			size = 0
+		}
+		w.Header().Set("Content-Type", mimeType)
+		w.Header().Set("Content-Length", strconv.FormatInt(size, 10))
+		w.Header().Set("ETag", fileETag(file))
+		w.Header().Set("Last-Modified", file.UpdatedAt.UTC().Format(http.TimeFormat))
+		w.Header().Set("Accept-Ranges", "bytes")
+		w.WriteHeader(http.StatusOK)
+		return
+	}
+	if h.files.crypto == nil {
+		writeError(w, http.StatusInternalServerError, "Encryption not configured")
+		return
+	}
+	serveDecryptedFile(w, r, h.files.crypto, h.files.backend, file)
+}
+
+// PUT /dav/...
+func (h *WebDAVHandler) put(w http.ResponseWriter, r *http.Request) {
+	claims := mw.GetClaims(r)
+	userID, _ := uuid.Parse(claims.Sub)
+
+	n, err := h.resolve(userID, r.URL.Path)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "Failed to resolve path")
+		return
+	}
+	if n.orphan || (!n.exists && n.scope == nil) {
+		writeError(w, http.StatusConflict, "Parent collection not found")
+		return
+	}
+	if n.exists && n.isCollection() {
+		writeError(w, http.StatusMethodNotAllowed, "Cannot upload to a collection")
+		return
+	}
+	if blockedExtensionsRe.MatchString(n.name) {
+		writeError(w, http.StatusForbidden, "File type not allowed")
+		return
+	}
+	if n.exists && !n.scope.canModify(n.file, userID, claims.Role) || !n.exists && !n.scope.canCreate() {
+		writeError(w, http.StatusForbidden, "Permission denied")
+		return
+	}
+	if !h.checkLocks(w, r, userID, n.path, false) {
+		return
+	}
+	if h.files.crypto == nil {
+		writeError(w, http.StatusInternalServerError, "Encryption not configured")
+		return
+	}
+
+	r.Body = http.MaxBytesReader(w, r.Body, davMaxUploadSize)
+	staged, err := stageUpload(h.files.cfg.UploadTempDir, h.files.crypto, r.Body)
+	if err != nil {
+		slog.Warn("webdav upload body read failed", "path", n.path, "error", err)
+		var maxErr *http.MaxBytesError
+		if errors.As(err, &maxErr) {
+			writeError(w, http.StatusRequestEntityTooLarge, "File too large")
+			return
+		}
+		writeError(w, http.StatusInternalServerError, "Upload interrupted — please try again")
+		return
+	}
+	defer staged.remove()
+
+	file := n.file
+	created := file == nil
+	if created {
+		file = &models.File{
+			ID:       uuid.New(),
+			OwnerID:  userID,
+			SpaceID:  n.scope.spaceID(),
+			Name:     n.name,
+			ParentID: n.parentID,
+		}
+		if err := h.db.Create(file).Error; err != nil {
+			writeError(w, http.StatusInternalServerError, "Failed to create file")
+			return
+		}
+	}
+
+	var uerr *uploadError
+	if n.scope.space == nil {
+		var user models.User
+		h.db.First(&user, "id = ?", userID)
+		uerr = h.files.storeUploadedContent(r, file, &user, staged)
+	} else {
+		uerr = h.spaces.storeUploadedContent(file, n.scope.space.ID, userID, staged)
+	}
+	if uerr != nil {
+		if created {
+			h.db.Delete(file)
+		}
+		writeError(w, uerr.status, uerr.message)
+		return
+	}
+
+	w.Header().Set("ETag", fileETag(file))
+	if created {
+		w.WriteHeader(http.StatusCreated)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// MKCOL /dav/...
+func (h *WebDAVHandler) mkcol(w http.ResponseWriter, r *http.Request) {
+	claims := mw.GetClaims(r)
+	userID, _ := uuid.Parse(claims.Sub)
+
+	if r.ContentLength > 0 {
+		writeError(w, http.StatusUnsupportedMediaType, "MKCOL request bodies are not supported")
+		return
+	}
+	n, err := h.resolve(userID, r.URL.Path)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "Failed to resolve path")
+		return
+	}
+	if n.exists {
+		writeError(w, http.StatusMethodNotAllowed, "Resource already exists")
+		return
+	}
+	if n.orphan || n.scope == nil {
+		writeError(w, http.StatusConflict, "Parent collection not found")
+		return
+	}
+	if !n.scope.canCreate() {
+		writeError(w, http.StatusForbidden, "Permission denied")
+		return
+	}
+	if !h.checkLocks(w, r, userID, n.path, false) {
+		return
+	}
+
+	folder := &models.File{
+		ID:       uuid.New(),
+		OwnerID:  userID,
+		SpaceID:  n.scope.spaceID(),
+		Name:     n.name,
+		IsFolder: true,
+		ParentID: n.parentID,
+	}
+	if err := h.db.Create(folder).Error; err != nil {
+		writeError(w, http.StatusInternalServerError, "Failed to create folder")
+		return
+	}
+
+	if n.scope.space != nil {
+		h.spaces.logActivity(n.scope.space.ID, userID, "create_folder", &folder.ID, &folder.Name, nil)
+	} else {
+		var auditUser models.User
+		h.db.Select("name, email").First(&auditUser, "id = ?", userID)
+		LogAudit(h.db, AuditEntry{
+			UserID:       &userID,
+			UserName:     auditUser.Name,
+			UserEmail:    auditUser.Email,
+			Action:       "folder.create",
+			ResourceType: "folder",
+			ResourceName: folder.Name,
+			ResourceID:   folder.ID.String(),
+			IPAddress:    auditIP(r),
+		})
+	}
+	w.WriteHeader(http.StatusCreated)
+}
+
+// DELETE /dav/...
+func (h *WebDAVHandler) delete(w http.ResponseWriter, r *http.Request) {
+	claims := mw.GetClaims(r)
+	userID, _ := uuid.Parse(claims.Sub)
+
+	n, err := h.resolve(userID, r.URL.Path)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "Failed to resolve path")
+		return
+	}
+	if !n.exists {
+		writeError(w, http.StatusNotFound, "Not found")
+		return
+	}
+	if n.file == nil {
+		writeError(w, http.StatusForbidden, "Cannot delete this collection")
+		return
+	}
+	if !n.scope.canModify(n.file, userID, claims.Role) {
+		writeError(w, http.StatusForbidden, "Permission denied")
+		return
+	}
+	if !h.checkLocks(w, r, userID, n.path, true) {
+		return
+	}
+
+	if err := trashReplacedFile(h.db, n.file, userID); err != nil {
+		slog.Error("webdav: delete failed", "path", n.path, "error", err)
+		writeError(w, http.StatusInternalServerError, "Failed to delete")
+		return
+	}
+	h.logRemoval(r, n.scope, n.file, userID)
+	h.locks.removeTree(n.path)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// logRemoval records that file went to the trash the way the JSON API does:
+// in the space activity for space files, in the audit log for personal ones.
+func (h *WebDAVHandler) logRemoval(r *http.Request, scope *davScope, file *models.File, userID uuid.UUID) {
+	if scope.space != nil {
+		h.spaces.logActivity(scope.space.ID, userID, models.SpaceActionDelete, &file.ID, &file.Name, nil)
+		return
+	}
+
+	var auditUser models.User
+	h.db.Select("name, email").First(&auditUser, "id = ?", userID)
+	resourceType := "file"
+	if file.IsFolder {
+		resourceType = "folder"
+	}
+	LogAudit(h.db, AuditEntry{
+		UserID:       &userID,
+		UserName:     auditUser.Name,
+		UserEmail:    auditUser.Email,
+		Action:       "file.delete",
+		ResourceType: resourceType,
+		ResourceName: file.Name,
+		ResourceID:   file.ID.String(),
+		IPAddress:    auditIP(r),
+	})
+}
+
+// COPY, MOVE /dav/...
+func (h *WebDAVHandler) copyMove(w http.ResponseWriter, r *http.Request) {
+	claims := mw.GetClaims(r)
+	userID, _ := uuid.Parse(claims.Sub)
+	isMove := r.Method == "MOVE"
+
+	src, err := h.resolve(userID, r.URL.Path)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "Failed to resolve path")
+		return
+	}
+	if !src.exists {
+		writeError(w, http.StatusNotFound, "Not found")
+		return
+	}
+	if src.file == nil {
+		writeError(w, http.StatusForbidden, "Cannot copy or move this collection")
+		return
+	}
+	dstPath, ok := davDestination(r)
+	if !ok {
+		writeError(w, http.StatusBadRequest, "Invalid Destination header")
+		return
+	}
+	dst, err := h.resolve(userID, dstPath)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "Failed to resolve path")
+		return
+	}
+	if dst.orphan || (!dst.exists && dst.scope == nil) {
+		writeError(w, http.StatusConflict, "Destination collection not found")
+		return
+	}
+	if dst.exists && dst.file == nil || dst.path == src.path {
+		writeError(w, http.StatusForbidden, "Invalid destination")
+		return
+	}
+	if dst.exists && strings.EqualFold(r.Header.Get("Overwrite"), "F") {
+		writeError(w, http.StatusPreconditionFailed, "Destination exists")
+		return
+	}
+	if !src.file.IsFolder && blockedExtensionsRe.MatchString(dst.name) {
+		writeError(w, http.StatusForbidden, "File type not allowed")
+		return
+	}
+	if src.file.IsFolder && sameDAVScope(src.scope, dst.scope) && dst.parentID != nil &&
+		(*dst.parentID == src.file.ID || isDescendantOf(h.db, *dst.parentID, src.file.ID)) {
+		writeError(w, http.StatusForbidden, "Cannot copy or move a folder into itself")
+		return
+	}
+	if !dst.scope.canCreate() ||
+		dst.exists && !dst.scope.canModify(dst.file, userID, claims.Role) ||
+		isMove && !src.scope.canModify(src.file, userID, claims.Role) {
+		writeError(w, http.StatusForbidden, "Permission denied")
+		return
+	}
+	if isMove && !h.checkLocks(w, r, userID, src.path, true) {
+		return
+	}
+	if !h.checkLocks(w, r, userID, dst.path, true) {
+		return
+	}
+
+	var uerr *uploadError
+	if isMove {
+		uerr = h.move(r, src, dst, userID)
+	} else {
+		uerr = h.copy(r, src, dst, userID)
+	}
+	if uerr != nil {
+		writeError(w, uerr.status, uerr.message)
+		return
+	}
+	if dst.exists {
+		h.logRemoval(r, dst.scope, dst.file, userID)
+		h.locks.removeTree(dst.path)
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+	w.WriteHeader(http.StatusCreated)
+}
+
+// replacedFile is the item an existing dst holds, which a copy or move
+// trashes in the transaction that puts the replacement in place.
+func (dst *davNode) replacedFile() *models.File {
+	if !dst.exists {
+		return nil
+	}
+	return dst.file
+}
+
+// move renames and re-parents src to dst, trashing an existing dst in the
+// same transaction. Moves into another scope go through
+// FilesHandler.moveFile, which carries the tree over.
+func (h *WebDAVHandler) move(r *http.Request, src, dst *davNode, userID uuid.UUID) *uploadError {
+	replace := dst.replacedFile()
+	if !sameDAVScope(src.scope, dst.scope) {
+		if uerr := h.files.moveFile(r, src.file, userID, dst.scope.spaceID(), dst.parentID, dst.name, replace); uerr != nil {
+			return uerr
+		}
+		h.locks.removeTree(src.path)
+		return nil
+	}
+
+	file := src.file
+	oldName := file.Name
+	renamed := dst.name != file.Name
+	moved := (dst.parentID == nil) != (file.ParentID == nil) ||
+		dst.parentID != nil && *dst.parentID != *file.ParentID
+
+	updates := map[string]interface{}{}
+	if renamed {
+		updates["name"] = dst.name
+	}
+	if moved {
+		if dst.parentID == nil {
+			updates["parent_id"] = nil
+		} else {
+			updates["parent_id"] = *dst.parentID
+		}
+	}
+	if err := h.db.Transaction(func(tx *gorm.DB) error {
+		if len(updates) > 0 {
+			if err := tx.Model(file).Updates(updates).Error; err != nil {
+				return err
+			}
+		}
+		if replace != nil {
+			return trashReplacedFile(tx, replace, userID)
+		}
+		return nil
+	}); err != nil {
+		slog.Error("webdav move failed", "src", src.path, "dst", dst.path, "error", err)
+		return &uploadError{http.StatusInternalServerError, "Failed to update file"}
+	}
+	if replace != nil && replace.SpaceID == nil {
+		recalcStorageUsed(h.db, userID)
+	}
+	h.locks.removeTree(src.path)
+
+	if src.scope.space != nil {
+		spaceID := src.scope.space.ID
+		if renamed {
+			h.spaces.logActivity(spaceID, userID, models.SpaceActionRename, &file.ID, &dst.name,
+				models.JSONB{"old_name": oldName, "new_name": dst.name})
+		}
+		if moved {
+			h.spaces.logActivity(spaceID, userID, models.SpaceActionMove, &file.ID, &dst.name, nil)
+		}
+		return nil
+	}
+
+	var auditUser models.User
+	h.db.Select("name, email").First(&auditUser, "id = ?", userID)
+	action := "file.rename"
+	if moved {
+		action = "file.move"
+	}
+	resourceType := "file"
+	if file.IsFolder {
+		resourceType = "folder"
+	}
+	LogAudit(h.db, AuditEntry{
+		UserID:       &userID,
+		UserName:     auditUser.Name,
+		UserEmail:    auditUser.Email,
+		Action:       action,
+		ResourceType: resourceType,
+		ResourceName: dst.name,
+		ResourceID:   file.ID.String(),
+		IPAddress:    auditIP(r),
+	})
+	return nil
+}
+
+// copy duplicates src at dst, trashing an existing dst in the same
+// transaction. "Depth: 0" copies a folder without its contents.
+func (h *WebDAVHandler) copy(r *http.Request, src, dst *davNode, userID uuid.UUID) *uploadError {
+	recursive := r.Header.Get("Depth") != "0"
+	replace := dst.replacedFile()
+
+	var user models.User
+	h.db.First(&user, "id = ?", userID)
+	if dst.scope.space == nil && user.StorageLimit > 0 {
+		size := int64(0)
+		if recursive || !src.file.IsFolder {
+			size = fileTreeSize(h.db, src.file)
+		}
+		if user.StorageUsed+size-replacedUsage(h.db, replace) > user.StorageLimit {
+			return &uploadError{http.StatusInsufficientStorage, "Storage limit exceeded"}
+		}
+	}
+
+	var copy *models.File
+	var copied int64
+	if err := h.db.Transaction(func(tx *gorm.DB) error {
+		var err error
+		copy, copied, err = copyFileTree(tx, h.files.crypto, src.file, userID, dst.scope.spaceID(), dst.parentID, dst.name, recursive)
+		if err != nil {
+			return err
+		}
+		if replace != nil {
+			return trashReplacedFile(tx, replace, userID)
+		}
+		return nil
+	}); err != nil {
+		slog.Error("webdav copy failed", "src", src.path, "dst", dst.path, "error", err)
+		return &uploadError{http.StatusInternalServerError, "Failed to copy"}
+	}
+
+	if dst.scope.space != nil {
+		h.spaces.logActivity(dst.scope.space.ID, userID, models.SpaceActionCopy, &copy.ID, &copy.Name,
+			models.JSONB{"source_id": src.file.ID.String()})
+		return nil
+	}
+
+	// Copies share blobs with their source, but each is charged in full,
+	// as an upload of identical content would be. A replaced item stops
+	// counting, so usage is recomputed instead.
+	if replace != nil {
+		recalcStorageUsed(h.db, userID)
+	} else if copied > 0 {
+		h.db.Model(&models.User{}).Where("id = ?", userID).
+			UpdateColumn("storage_used", gorm.Expr("storage_used + ?", copied))
+	}
+	resourceType := "file"
+	if copy.IsFolder {
+		resourceType = "folder"
+	}
+	LogAudit(h.db, AuditEntry{
+		UserID:       &userID,
+		UserName:     user.Name,
+		UserEmail:    user.Email,
+		Action:       "file.copy",
+		ResourceType: resourceType,
+		ResourceName: copy.Name,
+		ResourceID:   copy.ID.String(),
+		IPAddress:    auditIP(r),
+		Metadata:     models.JSONB{"source_id": src.file.ID.String(), "size": copied},
+	})
+	return nil
+}
+
+// ── PROPFIND / PROPPATCH ────────────────────────────────────────────────────
+
+// davEntry is one resource listed in a multistatus response.
+type davEntry struct {
+	path        string
+	displayName string
+	collection  bool
+	file        *models.File // nil for collections that are not file rows
+	created     time.Time
+	modified    time.Time
+}
+
+func davFileEntry(p string, f *models.File) davEntry {
+	return davEntry{
+		path:        p,
+		displayName: f.Name,
+		collection:  f.IsFolder,
+		file:        f,
+		created:     f.CreatedAt,
+		modified:    f.UpdatedAt,
+	}
+}
+
+// PROPFIND /dav/...
+func (h *WebDAVHandler) propfind(w http.ResponseWriter, r *http.Request) {
+	claims := mw.GetClaims(r)
+	userID, _ := uuid.Parse(claims.Sub)
+
+	n, err := h.resolve(userID, r.URL.Path)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "Failed to resolve path")
+		return
+	}
+	if !n.exists {
+		writeError(w, http.StatusNotFound, "Not found")
+		return
+	}
+	depth := r.Header.Get("Depth")
+	if depth != "0" && depth != "1" {
+		// Listing a whole tree in one response is refused, as RFC 4918
+		// allows; clients fall back to walking it with Depth: 1.
+		writeDAVError(w, http.StatusForbidden, "propfind-finite-depth")
+		return
+	}
+	pf, err := parsePropfind(http.MaxBytesReader(w, r.Body, davMaxXMLBody))
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "Invalid PROPFIND body")
+		return
+	}
+
+	entries := []davEntry{h.nodeEntry(n)}
+	if depth == "1" && n.isCollection() {
+		children, err := h.children(n, userID)
+		if err != nil {
+			writeError(w, http.StatusInternalServerError, "Failed to list collection")
+			return
+		}
+		entries = append(entries, children...)
+	}
+
+	ms := davMultistatus{XMLNS: "DAV:"}
+	for _, e := range entries {
+		ms.Responses = append(ms.Responses, pf.response(davHref(e.path, e.collection), h.liveProps(e)))
+	}
+	writeMultistatus(w, ms)
+}
+
+func (h *WebDAVHandler) nodeEntry(n *davNode) davEntry {
+	if n.file != nil {
+		return davFileEntry(n.path, n.file)
+	}
+	e := davEntry{path: n.path, displayName: n.name, collection: true}
+	if n.scope != nil && n.scope.space != nil {
+		e.created = n.scope.space.CreatedAt
+		e.modified = n.scope.space.UpdatedAt
+	}
+	return e
+}
+
+// children lists the members of the collection n.
+func (h *WebDAVHandler) children(n *davNode, userID uuid.UUID) ([]davEntry, error) {
+	switch {
+	case n.path == "/":
+		return []davEntry{
+			{path: "/files", displayName: "files", collection: true},
+			{path: "/spaces", displayName: "spaces", collection: true},
+		}, nil
+	case n.scope == nil: // /spaces
+		var spaces []models.Space
+		if err := h.db.
+			Where("spaces.id IN ("+userSpacesSQL+")", map[string]interface{}{"user": userID}).
+			Order("spaces.name ASC, spaces.created_at ASC").
+			Find(&spaces).Error; err != nil {
+			return nil, err
+		}
+		out := make([]davEntry, 0, len(spaces))
+		seen := make(map[string]bool, len(spaces))
+		for _, s := range spaces {
+			if seen[s.Name] || strings.Contains(s.Name, "/") {
+				continue
+			}
+			seen[s.Name] = true
+			out = append(out, davEntry{
+				path:        path.Join(n.path, s.Name),
+				displayName: s.Name,
+				collection:  true,
+				created:     s.CreatedAt,
+				modified:    s.UpdatedAt,
+			})
+		}
+		return out, nil
+	}
+
+	q := n.scope.files(h.db, userID)
+	if n.file == nil {
+		q = q.Where("parent_id IS NULL")
+	} else {
+		q = q.Where("parent_id = ?", n.file.ID)
+	}
+	var rows []models.File
+	if err := q.Order("is_folder DESC, created_at ASC").Find(&rows).Error; err != nil {
+		return nil, err
+	}
+	out := make([]davEntry, 0, len(rows))
+	seen := make(map[string]bool, len(rows))
+	for i := range rows {
+		// Only the first of several same-named entries is reachable by path
+		// (see resolve), so list just that one.
+		if seen[rows[i].Name] || strings.Contains(rows[i].Name, "/") {
+			continue
+		}
+		seen[rows[i].Name] = true
+		out = append(out, davFileEntry(path.Join(n.path, rows[i].Name), &rows[i]))
+	}
+	return out, nil
+}
+
+const davSupportedLock = `<D:lockentry><D:lockscope><D:exclusive/></D:lockscope><D:locktype><D:write/></D:locktype></D:lockentry>`
+
+// liveProps returns the properties the server maintains for e.
+func (h *WebDAVHandler) liveProps(e davEntry) []davProp {
+	props := []davProp{
+		davLiveProp("displayname", davEscape(e.displayName)),
+	}
+	if e.collection {
+		props = append(props, davLiveProp("resourcetype", "<D:collection/>"))
+	} else {
+		props = append(props, davLiveProp("resourcetype", ""))
+	}
+	if !e.created.IsZero() {
+		props = append(props, davLiveProp("creationdate", e.created.UTC().Format(time.RFC3339)))
+	}
+	if !e.modified.IsZero() {
+		props = append(props, davLiveProp("getlastmodified", e.modified.UTC().Format(http.TimeFormat)))
+	}
+	if e.file != nil && !e.file.IsFolder {
+		size := e.file.Size
+		if e.file.StoragePath == nil {
+			size = 0
+		}
+		mimeType := "application/octet-stream"
+		if e.file.MimeType != nil {
+			mimeType = *e.file.MimeType
+		}
+		props = append(props,
+			davLiveProp("getcontentlength", strconv.FormatInt(size, 10)),
+			davLiveProp("getcontenttype", davEscape(mimeType)),
+			davLiveProp("getetag", davEscape(fileETag(e.file))),
+		)
+	}
+	if e.file != nil {
+		var active strings.Builder
+		for _, l := range h.locks.discover(e.path) {
+			active.WriteString(davActiveLock(l))
+		}
+		props = append(props,
+			davLiveProp("supportedlock", davSupportedLock),
+			davLiveProp("lockdiscovery", active.String()),
+		)
+	}
+	return props
+}
+
+// PROPPATCH /dav/...
+//
+// Dead properties are not stored; every requested change is refused, which
+// clients such as the Windows mini-redirector accept.
+func (h *WebDAVHandler) proppatch(w http.ResponseWriter, r *http.Request) {
+	claims := mw.GetClaims(r)
+	userID, _ := uuid.Parse(claims.Sub)
+
+	n, err := h.resolve(userID, r.URL.Path)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "Failed to resolve path")
+		return
+	}
+	if !n.exists {
+		writeError(w, http.StatusNotFound, "Not found")
+		return
+	}
+	if n.file == nil || !n.scope.canModify(n.file, userID, claims.Role) {
+		writeError(w, http.StatusForbidden, "Permission denied")
+		return
+	}
+	if !h.checkLocks(w, r, userID, n.path, false) {
+		return
+	}
+
+	var pu davPropertyUpdate
+	if err := xml.NewDecoder(http.MaxBytesReader(w, r.Body, davMaxXMLBody)).Decode(&pu); err != nil {
+		writeError(w, http.StatusBadRequest, "Invalid PROPPATCH body")
+		return
+	}
+	var props []davProp
+	for _, ops := range [][]davPropNames{pu.Set, pu.Remove} {
+		for _, op := range ops {
+			for _, name := range op.Prop.Names {
+				props = append(props, davProp{XMLName: name.XMLName})
+			}
+		}
+	}
+
+	ms := davMultistatus{XMLNS: "DAV:", Responses: []davResponse{{
+		Href:      davHref(n.path, n.isCollection()),
+		Propstats: []davPropstat{{Prop: davPropList{Props: davOutProps(props)}, Status: davStatus(http.StatusForbidden)}},
+	}}}
+	writeMultistatus(w, ms)
+}
+
+// ── LOCK / UNLOCK ───────────────────────────────────────────────────────────
+
+// LOCK /dav/...
+func (h *WebDAVHandler) lock(w http.ResponseWriter, r *http.Request) {
+	claims := mw.GetClaims(r)
+	userID, _ := uuid.Parse(claims.Sub)
+	timeout := davLockTimeout(r.Header.Get("Timeout"))
+
+	body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, davMaxXMLBody))
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "Invalid LOCK body")
+		return
+	}
+
+	n, err := h.resolve(userID, r.URL.Path)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "Failed to resolve path")
+		return
+	}
+
+	// An empty body refreshes a lock named in the If header.
+	if len(bytes.TrimSpace(body)) == 0 {
+		for _, token := range davIfTokens(r.Header.Get("If")) {
+			if l, ok := h.locks.refresh(token, userID, timeout); ok && l.covers(n.path) {
+				writeLockResponse(w, http.StatusOK, *l)
+				return
+			}
+		}
+		writeError(w, http.StatusPreconditionFailed, "No matching lock to refresh")
+		return
+	}
+
+	var li davLockInfo
+	if err := xml.Unmarshal(body, &li); err != nil {
+		writeError(w, http.StatusBadRequest, "Invalid LOCK body")
+		return
+	}
+	if li.Shared != nil {
+		writeError(w, http.StatusNotImplemented, "Shared locks are not supported")
+		return
+	}
+	if n.orphan || (!n.exists && n.scope == nil) {
+		writeError(w, http.StatusConflict, "Parent collection not found")
+		return
+	}
+	if n.file == nil && n.exists {
+		writeError(w, http.StatusForbidden, "Cannot lock this collection")
+		return
+	}
+	if n.exists && !n.scope.canModify(n.file, userID, claims.Role) || !n.exists && !n.scope.canCreate() {
+		writeError(w, http.StatusForbidden, "Permission denied")
+		return
+	}
+	if !n.exists && blockedExtensionsRe.MatchString(n.name) {
+		writeError(w, http.StatusForbidden, "File type not allowed")
+		return
+	}
+
+	owner := davLockOwner{}
+	if li.Owner != nil {
+		owner.Href = strings.TrimSpace(li.Owner.Href)
+		owner.Text = strings.TrimSpace(li.Owner.Text)
+	}
+	l, ok := h.locks.create(n.path, userID, r.Header.Get("Depth") != "0", owner, timeout)
+	if !ok {
+		writeError(w, http.StatusLocked, "Resource is locked")
+		return
+	}
+
+	// Locking an unmapped URL creates an empty resource (RFC 4918 §7.3);
+	// the client's next PUT fills it.
+	if !n.exists {
+		file := &models.File{
+			ID:       uuid.New(),
+			OwnerID:  userID,
+			SpaceID:  n.scope.spaceID(),
+			Name:     n.name,
+			ParentID: n.parentID,
+		}
+		if err := h.db.Create(file).Error; err != nil {
+			h.locks.unlock(l.token, n.path, userID)
+			writeError(w, http.StatusInternalServerError, "Failed to create file")
+			return
+		}
+		writeLockResponse(w, http.StatusCreated, *l)
+		return
+	}
+	writeLockResponse(w, http.StatusOK, *l)
+}
+
+// UNLOCK /dav/...
+func (h *WebDAVHandler) unlock(w http.ResponseWriter, r *http.Request) {
+	claims := mw.GetClaims(r)
+	userID, _ := uuid.Parse(claims.Sub)
+
+	token := strings.TrimSuffix(strings.TrimPrefix(strings.TrimSpace(r.Header.Get("Lock-Token")), "<"), ">")
+	if token == "" {
+		writeError(w, http.StatusBadRequest, "Missing Lock-Token header")
+		return
+	}
+	if !h.locks.unlock(token, davPath(r.URL.Path), userID) {
+		writeDAVError(w, http.StatusConflict, "lock-token-matches-request-uri")
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// ── XML ─────────────────────────────────────────────────────────────────────
+//
+// Responses spell out the "D:" prefix instead of relying on encoding/xml's
+// namespace handling, which declares the namespace again on every element
+// and confuses some clients.
+
+type davAnyName struct {
+	XMLName xml.Name
+}
+
+type davPropfind struct {
+	XMLName  xml.Name  `xml:"DAV: propfind"`
+	AllProp  *struct{} `xml:"DAV: allprop"`
+	PropName *struct{} `xml:"DAV: propname"`
+	Prop     *struct {
+		Names []davAnyName `xml:",any"`
+	} `xml:"DAV: prop"`
+}
+
+type davPropNames struct {
+	Prop struct {
+		Names []davAnyName `xml:",any"`
+	} `xml:"DAV: prop"`
+}
+
+type davPropertyUpdate struct {
+	XMLName xml.Name       `xml:"DAV: propertyupdate"`
+	Set     []davPropNames `xml:"DAV: set"`
+	Remove  []davPropNames `xml:"DAV: remove"`
+}
+
+type davLockInfo struct {
+	XMLName xml.Name  `xml:"DAV: lockinfo"`
+	Shared  *struct{} `xml:"DAV: lockscope>shared"`
+	Owner   *struct {
+		Href string `xml:"DAV: href"`
+		Text string `xml:",chardata"`
+	} `xml:"DAV: owner"`
+}
+
+type davMultistatus struct {
+	XMLName   xml.Name      `xml:"D:multistatus"`
+	XMLNS     string        `xml:"xmlns:D,attr"`
+	Responses []davResponse `xml:"D:response"`
+}
+
+type davResponse struct {
+	Href      string        `xml:"D:href"`
+	Propstats []davPropstat `xml:"D:propstat"`
+}
+
+type davPropstat struct {
+	Prop   davPropList `xml:"D:prop"`
+	Status string      `xml:"D:status"`
+}
+
+type davPropList struct {
+	Props []davProp
+}
+
+// davProp is one property. InnerXML is written verbatim and must already be
+// escaped.
+type davProp struct {
+	XMLName  xml.Name
+	InnerXML string `xml:",innerxml"`
+}
+
+func davLiveProp(local, inner string) davProp {
+	return davProp{XMLName: xml.Name{Space: "DAV:", Local: local}, InnerXML: inner}
+}
+
+// parsePropfind decodes a PROPFIND body. An empty body means allprop.
+func parsePropfind(body io.Reader) (*davPropfind, error) {
+	var pf davPropfind
+	if err := xml.NewDecoder(body).Decode(&pf); err != nil {
+		if errors.Is(err, io.EOF) {
+			return &davPropfind{}, nil
+		}
+		return nil, err
+	}
+	return &pf, nil
+}
+
+// response builds the multistatus entry for one resource from its live
+// properties.
+func (pf *davPropfind) response(href string, live []davProp) davResponse {
+	resp := davResponse{Href: href}
+	switch {
+	case pf.PropName != nil:
+		names := make([]davProp, len(live))
+		for i, p := range live {
+			names[i] = davProp{XMLName: p.XMLName}
+		}
+		resp.Propstats = []davPropstat{{Prop: davPropList{Props: davOutProps(names)}, Status: davStatus(http.StatusOK)}}
+	case pf.Prop != nil:
+		var found, missing []davProp
+		for _, want := range pf.Prop.Names {
+			p, ok := findDAVProp(live, want.XMLName)
+			if ok {
+				found = append(found, p)
+			} else {
+				missing = append(missing, davProp{XMLName: want.XMLName})
+			}
+		}
+		if len(found) > 0 {
+			resp.Propstats = append(resp.Propstats, davPropstat{Prop: davPropList{Props: davOutProps(found)}, Status: davStatus(http.StatusOK)})
+		}
+		if len(missing) > 0 {
+			resp.Propstats = append(resp.Propstats, davPropstat{Prop: davPropList{Props: davOutProps(missing)}, Status: davStatus(http.StatusNotFound)})
+		}
+	default:
+		resp.Propstats = []davPropstat{{Prop: davPropList{Props: davOutProps(live)}, Status: davStatus(http.StatusOK)}}
+	}
+	return resp
+}
+
+func findDAVProp(props []davProp, name xml.Name) (davProp, bool) {
+	for _, p := range props {
+		if p.XMLName == name {
+			return p, true
+		}
+	}
+	return davProp{}, false
+}
+
+// davOutProps rewrites DAV: property names to the "D:" prefix used in
+// responses. Other namespaces are left for encoding/xml to declare.
+func davOutProps(props []davProp) []davProp {
+	out := make([]davProp, len(props))
+	for i, p := range props {
+		if p.XMLName.Space == "DAV:" {
+			p.XMLName = xml.Name{Local: "D:" + p.XMLName.Local}
+		}
+		out[i] = p
+	}
+	return out
+}
+
+func davStatus(code int) string {
+	return fmt.Sprintf("HTTP/1.1 %d %s", code, http.StatusText(code))
+}
+
+func davEscape(s string) string {
+	var b bytes.Buffer
+	_ = xml.EscapeText(&b, []byte(s))
+	return b.String()
+}
+
+func davActiveLock(l davLock) string {
+	depth := "0"
+	if l.infinite {
+		depth = "infinity"
+	}
+	var b strings.Builder
+	b.WriteString("<D:activelock><D:locktype><D:write/></D:locktype><D:lockscope><D:exclusive/></D:lockscope>")
+	fmt.Fprintf(&b, "<D:depth>%s</D:depth>", depth)
+	if l.owner.Href != "" {
+		fmt.Fprintf(&b, "<D:owner><D:href>%s</D:href></D:owner>", davEscape(l.owner.Href))
+	} else if l.owner.Text != "" {
+		fmt.Fprintf(&b, "<D:owner>%s</D:owner>", davEscape(l.owner.Text))
+	}
+	fmt.Fprintf(&b, "<D:timeout>Second-%d</D:timeout>", int64(l.timeout/time.Second))
+	fmt.Fprintf(&b, "<D:locktoken><D:href>%s</D:href></D:locktoken>", davEscape(l.token))
+	fmt.Fprintf(&b, "<D:lockroot><D:href>%s</D:href></D:lockroot>", davEscape(davHref(l.path, false)))
+	b.WriteString("</D:activelock>")
+	return b.String()
+}
+
+func writeMultistatus(w http.ResponseWriter, ms davMultistatus) {
+	w.Header().Set("Content-Type", "application/xml; charset=utf-8")
+	w.WriteHeader(http.StatusMultiStatus)
+	_, _ = io.WriteString(w, xml.Header)
+	if err := xml.NewEncoder(w).Encode(ms); err != nil {
+		slog.Error("webdav: encode multistatus failed", "error", err)
+	}
+}
+
+func writeLockResponse(w http.ResponseWriter, status int, l davLock) {
+	w.Header().Set("Content-Type", "application/xml; charset=utf-8")
+	w.Header().Set("Lock-Token", "<"+l.token+">")
+	w.WriteHeader(status)
+	_, _ = io.WriteString(w, xml.Header+`<D:prop xmlns:D="DAV:"><D:lockdiscovery>`+davActiveLock(l)+`</D:lockdiscovery></D:prop>`)
+}
+
+// writeDAVError answers with an RFC 4918 precondition element.
+func writeDAVError(w http.ResponseWriter, status int, condition string) {
+	w.Header().Set("Content-Type", "application/xml; charset=utf-8")
+	w.WriteHeader(status)
+	_, _ = io.WriteString(w, xml.Header+`<D:error xmlns:D="DAV:"><D:`+condition+`/></D:error>`)
+}
@@ -0,0 +1,206 @@
+package handlers
+
+import (
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// WebDAV locks are advisory write locks held in memory. Clients such as
+// Office and the Windows and macOS file managers lock a file while it is
+// open and refresh the lock periodically, so losing them on restart only
+// means the next request succeeds without a token.
+
+const (
+	davDefaultLockTimeout = time.Hour
+	davMaxLockTimeout     = 24 * time.Hour
+)
+
+type davLock struct {
+	token    string
+	path     string // WebDAV path below the mount, e.g. "/files/report.docx"
+	userID   uuid.UUID
+	infinite bool // depth infinity: also covers everything below path
+	owner    davLockOwner
+	timeout  time.Duration
+	expires  time.Time
+}
+
+// davLockOwner is the client's description of the lock holder, echoed back
+// in lockdiscovery.
+type davLockOwner struct {
+	Href string
+	Text string
+}
+
+type davLockSystem struct {
+	mu    sync.Mutex
+	locks map[string]*davLock // by token
+	now   func() time.Time
+}
+
+func newDAVLockSystem() *davLockSystem {
+	return &davLockSystem{locks: make(map[string]*davLock), now: time.Now}
+}
+
+// covers reports whether l applies to path: the locked resource itself, or a
+// member of a collection locked with depth infinity.
+func (l *davLock) covers(path string) bool {
+	return l.path == path || (l.infinite && davPathWithin(path, l.path))
+}
+
+// davPathWithin reports whether path lies strictly below dir.
+func davPathWithin(path, dir string) bool {
+	return strings.HasPrefix(path, strings.TrimSuffix(dir, "/")+"/")
+}
+
+// expireLocked drops timed-out locks. ls.mu must be held.
+func (ls *davLockSystem) expireLocked() {
+	now := ls.now()
+	for token, l := range ls.locks {
+		if now.After(l.expires) {
+			delete(ls.locks, token)
+		}
+	}
+}
+
+// create takes an exclusive lock on path. It fails when any existing lock
+// covers path, or, for a depth-infinity lock, covers anything below it.
+func (ls *davLockSystem) create(path string, userID uuid.UUID, infinite bool, owner davLockOwner, timeout time.Duration) (*davLock, bool) {
+	ls.mu.Lock()
+	defer ls.mu.Unlock()
+	ls.expireLocked()
+
+	for _, l := range ls.locks {
+		if l.covers(path) || (infinite && davPathWithin(l.path, path)) {
+			return nil, false
+		}
+	}
+	l := &davLock{
+		token:    "opaquelocktoken:" + uuid.NewString(),
+		path:     path,
+		userID:   userID,
+		infinite: infinite,
+		owner:    owner,
+		timeout:  timeout,
+		expires:  ls.now().Add(timeout),
+	}
+	ls.locks[l.token] = l
+	return l, true
+}
+
+// refresh extends the lock with the given token if userID holds it.
+func (ls *davLockSystem) refresh(token string, userID uuid.UUID, timeout time.Duration) (*davLock, bool) {
+	ls.mu.Lock()
+	defer ls.mu.Unlock()
+	ls.expireLocked()
+
+	l, ok := ls.locks[token]
+	if !ok || l.userID != userID {
+		return nil, false
+	}
+	l.timeout = timeout
+	l.expires = ls.now().Add(timeout)
+	return l, true
+}
+
+// unlock releases the lock with the given token if it covers path and is
+// held by userID.
+func (ls *davLockSystem) unlock(token, path string, userID uuid.UUID) bool {
+	ls.mu.Lock()
+	defer ls.mu.Unlock()
+	ls.expireLocked()
+
+	l, ok := ls.locks[token]
+	if !ok || l.userID != userID || !l.covers(path) {
+		return false
+	}
+	delete(ls.locks, token)
+	return true
+}
+
+// confirm reports whether userID may modify path: every lock covering it
+// (and, with recursive set, every lock below it) must be held by userID and
+// named in tokens.
+func (ls *davLockSystem) confirm(path string, recursive bool, userID uuid.UUID, tokens []string) bool {
+	ls.mu.Lock()
+	defer ls.mu.Unlock()
+	ls.expireLocked()
+
+	for _, l := range ls.locks {
+		if !l.covers(path) && !(recursive && davPathWithin(l.path, path)) {
+			continue
+		}
+		if l.userID != userID || !slices.Contains(tokens, l.token) {
+			return false
+		}
+	}
+	return true
+}
+
+// discover returns the live locks covering path.
+func (ls *davLockSystem) discover(path string) []davLock {
+	ls.mu.Lock()
+	defer ls.mu.Unlock()
+	ls.expireLocked()
+
+	var out []davLock
+	for _, l := range ls.locks {
+		if l.covers(path) {
+			out = append(out, *l)
+		}
+	}
+	return out
+}
+
+// removeTree drops the locks on path and below it, after the resource was
+// deleted or moved away.
+func (ls *davLockSystem) removeTree(path string) {
+	ls.mu.Lock()
+	defer ls.mu.Unlock()
+	for token, l := range ls.locks {
+		if l.path == path || davPathWithin(l.path, path) {
+			delete(ls.locks, token)
+		}
+	}
+}
+
+var davIfTokenRe = regexp.MustCompile(`<((?:opaquelocktoken|urn:uuid):[^>]+)>`)
+
+// davIfTokens extracts the lock tokens named in an If header. The header's
+// resource tags and Not/ETag conditions are not evaluated; submitting a token
+// is taken as proof the client knows about the lock.
+func davIfTokens(header string) []string {
+	var tokens []string
+	for _, m := range davIfTokenRe.FindAllStringSubmatch(header, -1) {
+		tokens = append(tokens, m[1])
+	}
+	return tokens
+}
+
+// davLockTimeout parses a Timeout header ("Second-3600", "Infinite", or a
+// comma-separated list of preferences) and clamps it to davMaxLockTimeout.
+func davLockTimeout(header string) time.Duration {
+	for _, v := range strings.Split(header, ",") {
+		v = strings.TrimSpace(v)
+		if strings.EqualFold(v, "Infinite") {
+			return davMaxLockTimeout
+		}
+		secs, ok := strings.CutPrefix(v, "Second-")
+		if !ok {
+			continue
+		}
+		if n, err := strconv.ParseInt(secs, 10, 64); err == nil && n > 0 {
+			if n > int64(davMaxLockTimeout/time.Second) {
+				return davMaxLockTimeout
+			}
+			return time.Duration(n) * time.Second
+		}
+	}
+	return davDefaultLockTimeout
+}
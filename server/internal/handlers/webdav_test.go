@@ -0,0 +1,233 @@
+package handlers
+
+import (
+	"encoding/xml"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/zynqcloud/api/internal/models"
+)
+
+func TestDAVLockSystem(t *testing.T) {
+	ls := newDAVLockSystem()
+	now := time.Now()
+	ls.now = func() time.Time { return now }
+	alice, bob := uuid.New(), uuid.New()
+
+	dir, ok := ls.create("/files/docs", alice, true, davLockOwner{}, time.Minute)
+	if !ok {
+		t.Fatal("create on an unlocked path failed")
+	}
+	if _, ok := ls.create("/files/docs/a.txt", bob, false, davLockOwner{}, time.Minute); ok {
+		t.Error("lock below a depth-infinity lock was granted")
+	}
+	if _, ok := ls.create("/files", bob, true, davLockOwner{}, time.Minute); ok {
+		t.Error("depth-infinity lock above an existing lock was granted")
+	}
+	if _, ok := ls.create("/files/docs2", bob, false, davLockOwner{}, time.Minute); !ok {
+		t.Error("lock on a sibling with a shared prefix was refused")
+	}
+
+	if ls.confirm("/files/docs/a.txt", false, alice, nil) {
+		t.Error("confirm without the token succeeded")
+	}
+	if ls.confirm("/files/docs/a.txt", false, bob, []string{dir.token}) {
+		t.Error("confirm by another user succeeded")
+	}
+	if !ls.confirm("/files/docs/a.txt", false, alice, []string{dir.token}) {
+		t.Error("confirm by the holder failed")
+	}
+	if ls.confirm("/files", true, alice, nil) {
+		t.Error("recursive confirm ignored a lock below the path")
+	}
+	if !ls.confirm("/files/other.txt", false, bob, nil) {
+		t.Error("confirm on an unlocked path failed")
+	}
+
+	if got := ls.discover("/files/docs/a.txt"); len(got) != 1 || got[0].token != dir.token {
+		t.Errorf("discover = %v, want the folder lock", got)
+	}
+	if ls.unlock(dir.token, "/files/docs", bob) {
+		t.Error("unlock by another user succeeded")
+	}
+
+	now = now.Add(2 * time.Minute)
+	if !ls.confirm("/files/docs/a.txt", false, bob, nil) {
+		t.Error("expired lock still enforced")
+	}
+	if _, ok := ls.refresh(dir.token, alice, time.Minute); ok {
+		t.Error("expired lock was refreshed")
+	}
+}
+
+func TestDAVLockRemoveTree(t *testing.T) {
+	ls := newDAVLockSystem()
+	u := uuid.New()
+	ls.create("/files/a/b.txt", u, false, davLockOwner{}, time.Minute)
+	ls.create("/files/ab.txt", u, false, davLockOwner{}, time.Minute)
+	ls.removeTree("/files/a")
+	if len(ls.locks) != 1 {
+		t.Fatalf("removeTree left %d locks, want 1", len(ls.locks))
+	}
+}
+
+func TestDAVIfTokens(t *testing.T) {
+	h := `</dav/files/a.txt> (<opaquelocktoken:1234> ["etag"]) (Not <urn:uuid:abcd>)`
+	got := davIfTokens(h)
+	if len(got) != 2 || got[0] != "opaquelocktoken:1234" || got[1] != "urn:uuid:abcd" {
+		t.Errorf("davIfTokens = %q", got)
+	}
+	if got := davIfTokens(""); len(got) != 0 {
+		t.Errorf("davIfTokens(\"\") = %q", got)
+	}
+}
+
+func TestDAVLockTimeout(t *testing.T) {
+	cases := map[string]time.Duration{
+		"":                        davDefaultLockTimeout,
+		"Second-600":              600 * time.Second,
+		"Infinite, Second-600":    davMaxLockTimeout,
+		"Second-99999999999999":   davMaxLockTimeout,
+		"Second-abc, Second-30":   30 * time.Second,
+		"Second-0":                davDefaultLockTimeout,
+		"Extended-30, Second-120": 120 * time.Second,
+	}
+	for header, want := range cases {
+		if got := davLockTimeout(header); got != want {
+			t.Errorf("davLockTimeout(%q) = %v, want %v", header, got, want)
+		}
+	}
+}
+
+func TestDAVPathAndHref(t *testing.T) {
+	paths := map[string]string{
+		"/dav":                  "/",
+		"/dav/":                 "/",
+		"/dav/files/":           "/files",
+		"/dav/files/a/../b.txt": "/files/b.txt",
+		"/dav/../../etc":        "/etc",
+	}
+	for in, want := range paths {
+		if got := davPath(in); got != want {
+			t.Errorf("davPath(%q) = %q, want %q", in, got, want)
+		}
+	}
+
+	if got := davHref("/spaces/Team A/q#1.txt", false); got != "/dav/spaces/Team%20A/q%231.txt" {
+		t.Errorf("davHref file = %q", got)
+	}
+	if got := davHref("/files/docs", true); got != "/dav/files/docs/" {
+		t.Errorf("davHref collection = %q", got)
+	}
+	if got := davHref("/", true); got != "/dav/" {
+		t.Errorf("davHref root = %q", got)
+	}
+}
+
+func TestDAVDestination(t *testing.T) {
+	cases := []struct {
+		header string
+		want   string
+		ok     bool
+	}{
+		{"https://proxy.example.com/dav/files/b%20c.txt", "/files/b c.txt", true},
+		{"/dav/spaces/Team/x", "/spaces/Team/x", true},
+		{"https://example.com/api/v1/files", "", false},
+		{"https://example.com/davx/files", "", false},
+		{"", "", false},
+	}
+	for _, c := range cases {
+		r, _ := http.NewRequest("MOVE", "/dav/files/a.txt", nil)
+		if c.header != "" {
+			r.Header.Set("Destination", c.header)
+		}
+		got, ok := davDestination(r)
+		if got != c.want || ok != c.ok {
+			t.Errorf("davDestination(%q) = %q, %v; want %q, %v", c.header, got, ok, c.want, c.ok)
+		}
+	}
+}
+
+func TestDAVPropfindResponse(t *testing.T) {
+	body := `<?xml version="1.0"?>
+<propfind xmlns="DAV:" xmlns:x="urn:example"><prop><getetag/><x:color/></prop></propfind>`
+	pf, err := parsePropfind(strings.NewReader(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	live := []davProp{davLiveProp("getetag", `"abc"`), davLiveProp("displayname", "a &amp; b")}
+
+	ms := davMultistatus{XMLNS: "DAV:", Responses: []davResponse{pf.response("/dav/files/a.txt", live)}}
+	out, err := xml.Marshal(ms)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := string(out)
+	for _, want := range []string{
+		`<D:multistatus xmlns:D="DAV:">`,
+		`<D:href>/dav/files/a.txt</D:href>`,
+		`<D:getetag>"abc"</D:getetag>`,
+		`<D:status>HTTP/1.1 200 OK</D:status>`,
+		`<color xmlns="urn:example"></color>`,
+		`<D:status>HTTP/1.1 404 Not Found</D:status>`,
+	} {
+		if !strings.Contains(got, want) {
+			t.Errorf("multistatus missing %s\n%s", want, got)
+		}
+	}
+	if strings.Contains(got, "displayname") {
+		t.Errorf("unrequested property returned\n%s", got)
+	}
+
+	empty, err := parsePropfind(strings.NewReader(""))
+	if err != nil || empty.Prop != nil || empty.PropName != nil {
+		t.Errorf("empty body = %+v, %v; want allprop", empty, err)
+	}
+}
+
+func TestDAVScopes(t *testing.T) {
+	cases := []struct {
+		method, path, dest string
+		want               []string
+	}{
+		{"PROPFIND", "/dav/", "", nil},
+		{"PROPFIND", "/dav/files/docs", "", []string{"files:read"}},
+		{"GET", "/dav/spaces/Team/a.txt", "", []string{"spaces:read"}},
+		{"PUT", "/dav/files/a.txt", "", []string{"files:write"}},
+		{"LOCK", "/dav/spaces/Team/a.txt", "", []string{"spaces:write"}},
+		{"COPY", "/dav/spaces/Team/a.txt", "/dav/files/a.txt", []string{"spaces:read", "files:write"}},
+		{"MOVE", "/dav/files/a.txt", "http://host/dav/spaces/Team/a.txt", []string{"files:write", "spaces:write"}},
+	}
+	for _, c := range cases {
+		req, _ := http.NewRequest(c.method, c.path, nil)
+		if c.dest != "" {
+			req.Header.Set("Destination", c.dest)
+		}
+		got := davScopes(req)
+		if strings.Join(got, ",") != strings.Join(c.want, ",") {
+			t.Errorf("%s %s: scopes = %v, want %v", c.method, c.path, got, c.want)
+		}
+	}
+}
+
+func TestDAVReplacedFile(t *testing.T) {
+	existing := &models.File{ID: uuid.New(), Size: 100}
+	if f := (&davNode{exists: true, file: existing}).replacedFile(); f != existing {
+		t.Errorf("existing destination: replacedFile = %v", f)
+	}
+	if f := (&davNode{name: "new.txt"}).replacedFile(); f != nil {
+		t.Errorf("missing destination: replacedFile = %v", f)
+	}
+
+	// Only personal items give quota back; these need no lookups.
+	spaceID := uuid.New()
+	if n := replacedUsage(nil, nil); n != 0 {
+		t.Errorf("nothing replaced: usage = %d", n)
+	}
+	if n := replacedUsage(nil, &models.File{SpaceID: &spaceID, Size: 100}); n != 0 {
+		t.Errorf("space file replaced: usage = %d", n)
+	}
+}
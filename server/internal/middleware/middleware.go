@@ -4,6 +4,7 @@ import (
 	"context"
 	"log/slog"
 	"net/http"
+	"slices"
 	"strings"
 	"time"
 
@@ -19,9 +20,49 @@ type Claims struct {
 	Email string `json:"email"`
 	Role  string `json:"role"`
 	jwt.RegisteredClaims
+
+	// TokenID and Scopes are set when the request signed in with a personal
+	// access token instead of a browser session.
+	TokenID string   `json:"-"`
+	Scopes  []string `json:"-"`
+}
+
+// Personal access token scopes.
+const (
+	ScopeFilesRead   = "files:read"
+	ScopeFilesWrite  = "files:write"
+	ScopeSpacesRead  = "spaces:read"
+	ScopeSpacesWrite = "spaces:write"
+	ScopeAdmin       = "admin"
+)
+
+// Scopes lists every scope a token can be granted.
+var Scopes = []string{ScopeFilesRead, ScopeFilesWrite, ScopeSpacesRead, ScopeSpacesWrite, ScopeAdmin}
+
+// HasScope reports whether the request may use scope. Browser sessions have
+// every scope.
+func (c *Claims) HasScope(scope string) bool {
+	return c.TokenID == "" || slices.Contains(c.Scopes, scope)
+}
+
+// SessionValidator reports whether the session a token was issued for is
+// still active. Auth rejects a validly signed token whose session has been
+// revoked or has expired.
+type SessionValidator interface {
+	ValidSession(r *http.Request, claims *Claims) bool
+}
+
+// TokenAuthenticator resolves a personal access token to the claims of the
+// user it belongs to, with the token's scopes.
+type TokenAuthenticator interface {
+	AuthenticateToken(r *http.Request, token string) (*Claims, bool)
 }
 
-func Auth(jwtSecret string) func(http.Handler) http.Handler {
+// Auth authenticates requests by the jid cookie or a Bearer token. With a
+// nil sessions validator any token signed with jwtSecret is accepted. A
+// Bearer value that is not a JWT is looked up as a personal access token
+// when tokens is set.
+func Auth(jwtSecret string, sessions SessionValidator, tokens TokenAuthenticator) func(http.Handler) http.Handler {
 	return func(next http.Handler) http.Handler {
 		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 			tokenStr := ""
@@ -39,6 +80,17 @@ func Auth(jwtSecret string) func(http.Handler) http.Handler {
 				http.Error(w, `{"message":"Unauthorized","statusCode":401}`, http.StatusUnauthorized)
 				return
 			}
+			// A JWT has exactly three dot-separated parts; access tokens have none.
+			if tokens != nil && strings.Count(tokenStr, ".") != 2 {
+				claims, ok := tokens.AuthenticateToken(r, tokenStr)
+				if !ok {
+					http.Error(w, `{"message":"Unauthorized","statusCode":401}`, http.StatusUnauthorized)
+					return
+				}
+				ctx := context.WithValue(r.Context(), UserClaimsKey, claims)
+				next.ServeHTTP(w, r.WithContext(ctx))
+				return
+			}
 			claims := &Claims{}
 			token, err := jwt.ParseWithClaims(tokenStr, claims, func(token *jwt.Token) (interface{}, error) {
 				return []byte(jwtSecret), nil
@@ -47,6 +99,10 @@ func Auth(jwtSecret string) func(http.Handler) http.Handler {
 				http.Error(w, `{"message":"Unauthorized","statusCode":401}`, http.StatusUnauthorized)
 				return
 			}
+			if sessions != nil && !sessions.ValidSession(r, claims) {
+				http.Error(w, `{"message":"Unauthorized","statusCode":401}`, http.StatusUnauthorized)
+				return
+			}
 			ctx := context.WithValue(r.Context(), UserClaimsKey, claims)
 			next.ServeHTTP(w, r.WithContext(ctx))
 		})
@@ -72,6 +128,41 @@ func RequireRole(roles ...string) func(http.Handler) http.Handler {
 	}
 }
 
+// RequireScope limits personal access tokens to routes their scopes cover:
+// read for GET and HEAD requests, write for the rest. Browser sessions pass.
+func RequireScope(read, write string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			claims := GetClaims(r)
+			if claims == nil {
+				http.Error(w, `{"message":"Unauthorized","statusCode":401}`, http.StatusUnauthorized)
+				return
+			}
+			scope := write
+			if r.Method == http.MethodGet || r.Method == http.MethodHead {
+				scope = read
+			}
+			if !claims.HasScope(scope) {
+				http.Error(w, `{"message":"Token lacks the `+scope+` scope","statusCode":403}`, http.StatusForbidden)
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// RequireSession rejects personal access tokens, for routes that manage the
+// account itself.
+func RequireSession(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if claims := GetClaims(r); claims == nil || claims.TokenID != "" {
+			http.Error(w, `{"message":"Sign in with a browser session to use this endpoint","statusCode":403}`, http.StatusForbidden)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
 func GetClaims(r *http.Request) *Claims {
 	v := r.Context().Value(UserClaimsKey)
 	if v == nil {
@@ -94,11 +185,14 @@ func CORS(origins []string) func(http.Handler) http.Handler {
 					w.Header().Set("Access-Control-Allow-Origin", origin)
 					w.Header().Set("Access-Control-Allow-Credentials", "true")
 					w.Header().Set("Access-Control-Allow-Methods", "GET,POST,PUT,PATCH,DELETE,OPTIONS")
-					w.Header().Set("Access-Control-Allow-Headers", "Content-Type,Authorization,X-Requested-With")
+					w.Header().Set("Access-Control-Allow-Headers", "Content-Type,Authorization,X-Requested-With,Range,If-Range")
+					w.Header().Set("Access-Control-Expose-Headers", "Content-Range,Accept-Ranges,ETag")
 					w.Header().Set("Vary", "Origin")
 				}
 			}
-			if r.Method == http.MethodOptions {
+			// Answer CORS preflights here. Other OPTIONS requests (WebDAV
+			// clients probing for DAV support) go to the route.
+			if r.Method == http.MethodOptions && r.Header.Get("Access-Control-Request-Method") != "" {
 				w.WriteHeader(http.StatusNoContent)
 				return
 			}
@@ -31,7 +31,7 @@ func okHandler(w http.ResponseWriter, _ *http.Request) {
 }
 
 func TestAuth_NoCookie_NoHeader(t *testing.T) {
-	mw := Auth(testSecret)
+	mw := Auth(testSecret, nil, nil)
 	h := mw(http.HandlerFunc(okHandler))
 
 	req := httptest.NewRequest(http.MethodGet, "/", nil)
@@ -54,7 +54,7 @@ func TestAuth_ValidCookie(t *testing.T) {
 	}
 	tok := makeToken(t, claims, testSecret)
 
-	mw := Auth(testSecret)
+	mw := Auth(testSecret, nil, nil)
 	var capturedClaims *Claims
 	h := mw(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		capturedClaims = GetClaims(r)
@@ -87,7 +87,7 @@ func TestAuth_ValidBearerHeader(t *testing.T) {
 	}
 	tok := makeToken(t, claims, testSecret)
 
-	mw := Auth(testSecret)
+	mw := Auth(testSecret, nil, nil)
 	h := mw(http.HandlerFunc(okHandler))
 
 	req := httptest.NewRequest(http.MethodGet, "/", nil)
@@ -109,7 +109,7 @@ func TestAuth_ExpiredToken(t *testing.T) {
 	}
 	tok := makeToken(t, claims, testSecret)
 
-	mw := Auth(testSecret)
+	mw := Auth(testSecret, nil, nil)
 	h := mw(http.HandlerFunc(okHandler))
 
 	req := httptest.NewRequest(http.MethodGet, "/", nil)
@@ -131,7 +131,7 @@ func TestAuth_WrongSecret(t *testing.T) {
 	}
 	tok := makeToken(t, claims, "different-secret-value-here-for-test")
 
-	mw := Auth(testSecret)
+	mw := Auth(testSecret, nil, nil)
 	h := mw(http.HandlerFunc(okHandler))
 
 	req := httptest.NewRequest(http.MethodGet, "/", nil)
@@ -144,6 +144,107 @@ func TestAuth_WrongSecret(t *testing.T) {
 	}
 }
 
+type sessionSet map[string]bool
+
+func (s sessionSet) ValidSession(_ *http.Request, c *Claims) bool { return s[c.ID] }
+
+func TestAuth_RevokedSession(t *testing.T) {
+	sessions := sessionSet{"live": true}
+	mw := Auth(testSecret, sessions, nil)
+	h := mw(http.HandlerFunc(okHandler))
+
+	for jti, want := range map[string]int{"live": http.StatusOK, "revoked": http.StatusUnauthorized, "": http.StatusUnauthorized} {
+		tok := makeToken(t, &Claims{
+			Sub: "user-123",
+			RegisteredClaims: jwt.RegisteredClaims{
+				ID:        jti,
+				ExpiresAt: jwt.NewNumericDate(time.Now().Add(time.Hour)),
+			},
+		}, testSecret)
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		req.AddCookie(&http.Cookie{Name: "jid", Value: tok})
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, req)
+		if rec.Code != want {
+			t.Errorf("jti %q: expected %d, got %d", jti, want, rec.Code)
+		}
+	}
+}
+
+type tokenSet map[string]*Claims
+
+func (s tokenSet) AuthenticateToken(_ *http.Request, tok string) (*Claims, bool) {
+	c, ok := s[tok]
+	return c, ok
+}
+
+func TestAuth_AccessToken(t *testing.T) {
+	tokens := tokenSet{"zpat_good": {Sub: "user-123", TokenID: "t1", Scopes: []string{ScopeFilesRead}}}
+	var got *Claims
+	h := Auth(testSecret, sessionSet{}, tokens)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got = GetClaims(r)
+		w.WriteHeader(http.StatusOK)
+	}))
+
+	for tok, want := range map[string]int{"zpat_good": http.StatusOK, "zpat_bad": http.StatusUnauthorized} {
+		got = nil
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		req.Header.Set("Authorization", "Bearer "+tok)
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, req)
+		if rec.Code != want {
+			t.Errorf("%s: expected %d, got %d", tok, want, rec.Code)
+		}
+	}
+	if got != nil && got.TokenID != "t1" {
+		t.Errorf("wrong claims: %+v", got)
+	}
+}
+
+func TestRequireScope(t *testing.T) {
+	h := RequireScope(ScopeFilesRead, ScopeFilesWrite)(http.HandlerFunc(okHandler))
+	token := &Claims{Sub: "u1", TokenID: "t1", Scopes: []string{ScopeFilesRead}}
+	cases := []struct {
+		claims *Claims
+		method string
+		want   int
+	}{
+		{token, http.MethodGet, http.StatusOK},
+		{token, http.MethodHead, http.StatusOK},
+		{token, http.MethodPost, http.StatusForbidden},
+		{token, http.MethodDelete, http.StatusForbidden},
+		{&Claims{Sub: "u1"}, http.MethodDelete, http.StatusOK},
+	}
+	for _, c := range cases {
+		req := httptest.NewRequest(c.method, "/", nil)
+		req = req.WithContext(contextWithClaims(req.Context(), c.claims))
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, req)
+		if rec.Code != c.want {
+			t.Errorf("%s with token %q: expected %d, got %d", c.method, c.claims.TokenID, c.want, rec.Code)
+		}
+	}
+}
+
+func TestRequireSession(t *testing.T) {
+	h := RequireSession(http.HandlerFunc(okHandler))
+	for _, c := range []struct {
+		claims *Claims
+		want   int
+	}{
+		{&Claims{Sub: "u1"}, http.StatusOK},
+		{&Claims{Sub: "u1", TokenID: "t1", Scopes: Scopes}, http.StatusForbidden},
+	} {
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		req = req.WithContext(contextWithClaims(req.Context(), c.claims))
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, req)
+		if rec.Code != c.want {
+			t.Errorf("token %q: expected %d, got %d", c.claims.TokenID, c.want, rec.Code)
+		}
+	}
+}
+
 func TestRequireRole_Allowed(t *testing.T) {
 	claims := &Claims{Sub: "u1", Role: "admin"}
 	mw := RequireRole("admin", "owner")
@@ -48,6 +48,14 @@ type User struct {
 	StorageUsed  int64     `gorm:"column:storage_used;default:0" json:"storage_used"`
 	StorageLimit int64     `gorm:"column:storage_limit;default:0" json:"storage_limit"`
 	Avatar       *string   `gorm:"column:avatar" json:"avatar,omitempty"`
+	// OIDCIssuer and OIDCSubject link the account to a single sign-on
+	// identity.
+	OIDCIssuer  *string `gorm:"column:oidc_issuer" json:"-"`
+	OIDCSubject *string `gorm:"column:oidc_subject" json:"-"`
+	// LDAPID links the account to a directory entry.
+	LDAPID *string `gorm:"column:ldap_id" json:"-"`
+	// DisabledAt is set when the account may no longer sign in.
+	DisabledAt *time.Time `gorm:"column:disabled_at" json:"disabled_at,omitempty"`
 }
 
 func (User) TableName() string { return "users" }
@@ -69,7 +77,13 @@ type File struct {
 	EncryptedDEK   []byte     `gorm:"column:encrypted_dek" json:"-"`
 	EncryptionIV   []byte     `gorm:"column:encryption_iv" json:"-"`
 	EncryptionAlgo string     `gorm:"column:encryption_algo;default:'AES-256-GCM'" json:"encryption_algo,omitempty"`
+	KeyID          *string    `gorm:"column:key_id" json:"-"`
+	BlobID         *string    `gorm:"column:blob_id" json:"-"`
+	UploadedBy     *uuid.UUID `gorm:"column:uploaded_by" json:"uploaded_by,omitempty"`
 	DeletedAt      *time.Time `gorm:"column:deleted_at" json:"deleted_at,omitempty"`
+	// DeletedBy is who moved a space file to the trash.
+	DeletedBy *uuid.UUID `gorm:"column:deleted_by" json:"deleted_by,omitempty"`
+	Deleter   *User      `gorm:"foreignKey:DeletedBy" json:"deleter,omitempty"`
 	// computed fields (not in DB)
 	FolderSize        int64 `gorm:"-" json:"folder_size"`
 	ShareCount        int   `gorm:"-" json:"shareCount,omitempty"`
@@ -79,6 +93,59 @@ type File struct {
 
 func (File) TableName() string { return "files" }
 
+// Blob is a unique encrypted object in the content-addressable store.
+// Files that reference it copy its storage path and key material so the
+// download paths do not need to join against this table.
+type Blob struct {
+	ID             string    `gorm:"primaryKey" json:"id"`
+	CreatedAt      time.Time `gorm:"column:created_at;autoCreateTime" json:"created_at"`
+	UpdatedAt      time.Time `gorm:"column:updated_at;autoUpdateTime" json:"updated_at"`
+	StoragePath    string    `gorm:"column:storage_path;not null" json:"-"`
+	Size           int64     `gorm:"default:0" json:"size"`
+	EncryptedDEK   []byte    `gorm:"column:encrypted_dek;not null" json:"-"`
+	EncryptionIV   []byte    `gorm:"column:encryption_iv;not null" json:"-"`
+	EncryptionAlgo string    `gorm:"column:encryption_algo" json:"encryption_algo"`
+	KeyID          *string   `gorm:"column:key_id" json:"-"`
+	RefCount       int       `gorm:"column:ref_count;default:0" json:"ref_count"`
+}
+
+func (Blob) TableName() string { return "blobs" }
+
+// FileVersion is a previous content of a file, archived when it was
+// overwritten. It owns the blob reference the file held at that time.
+type FileVersion struct {
+	ID             uuid.UUID  `gorm:"type:uuid;primaryKey;default:uuid_generate_v4()" json:"id"`
+	CreatedAt      time.Time  `gorm:"column:created_at;autoCreateTime" json:"created_at"`
+	FileID         uuid.UUID  `gorm:"column:file_id;not null" json:"file_id"`
+	VersionNumber  int        `gorm:"column:version_number;not null" json:"version_number"`
+	UploadedBy     *uuid.UUID `gorm:"column:uploaded_by" json:"uploaded_by,omitempty"`
+	Uploader       *User      `gorm:"foreignKey:UploadedBy" json:"uploader,omitempty"`
+	BlobID         *string    `gorm:"column:blob_id" json:"-"`
+	StoragePath    *string    `gorm:"column:storage_path" json:"-"`
+	EncryptedDEK   []byte     `gorm:"column:encrypted_dek" json:"-"`
+	EncryptionIV   []byte     `gorm:"column:encryption_iv" json:"-"`
+	EncryptionAlgo string     `gorm:"column:encryption_algo" json:"-"`
+	KeyID          *string    `gorm:"column:key_id" json:"-"`
+	Size           int64      `gorm:"default:0" json:"size"`
+	FileHash       *string    `gorm:"column:file_hash" json:"file_hash,omitempty"`
+	MimeType       *string    `gorm:"column:mime_type" json:"mime_type"`
+}
+
+func (FileVersion) TableName() string { return "file_versions" }
+
+// FileComment is a comment on a personal file or folder.
+type FileComment struct {
+	ID        uuid.UUID  `gorm:"type:uuid;primaryKey;default:uuid_generate_v4()" json:"id"`
+	CreatedAt time.Time  `gorm:"column:created_at;autoCreateTime" json:"created_at"`
+	UpdatedAt time.Time  `gorm:"column:updated_at;autoUpdateTime" json:"updated_at"`
+	FileID    uuid.UUID  `gorm:"column:file_id;not null" json:"file_id"`
+	UserID    *uuid.UUID `gorm:"column:user_id" json:"user_id,omitempty"`
+	User      *User      `gorm:"foreignKey:UserID" json:"user,omitempty"`
+	Body      string     `gorm:"column:body;not null" json:"body"`
+}
+
+func (FileComment) TableName() string { return "file_comments" }
+
 type Share struct {
 	ID            uuid.UUID  `gorm:"type:uuid;primaryKey;default:uuid_generate_v4()" json:"id"`
 	CreatedAt     time.Time  `gorm:"column:created_at;autoCreateTime" json:"created_at"`
@@ -88,19 +155,56 @@ type Share struct {
 	GranteeUserID *uuid.UUID `gorm:"column:grantee_user_id" json:"grantee_user_id"`
 	GranteeUser   *User      `gorm:"foreignKey:GranteeUserID" json:"grantee_user,omitempty"`
 	GranteeEmail  *string    `gorm:"column:grantee_email" json:"grantee_email"`
-	Permission    string     `gorm:"default:'read'" json:"permission"`
-	CreatedBy     uuid.UUID  `gorm:"column:created_by" json:"created_by"`
-	Creator       *User      `gorm:"foreignKey:CreatedBy" json:"creator,omitempty"`
-	IsPublic      bool       `gorm:"column:is_public;default:false" json:"is_public"`
-	ShareToken    *string    `gorm:"column:share_token" json:"share_token,omitempty"`
-	ExpiresAt     *time.Time `gorm:"column:expires_at" json:"expires_at"`
-	Password      *string    `gorm:"column:password" json:"-"`
+	// GranteeGroupID shares with every member of a group.
+	GranteeGroupID *uuid.UUID `gorm:"column:grantee_group_id" json:"grantee_group_id,omitempty"`
+	GranteeGroup   *Group     `gorm:"foreignKey:GranteeGroupID" json:"grantee_group,omitempty"`
+	Permission     string     `gorm:"default:'read'" json:"permission"`
+	CreatedBy      uuid.UUID  `gorm:"column:created_by" json:"created_by"`
+	Creator        *User      `gorm:"foreignKey:CreatedBy" json:"creator,omitempty"`
+	IsPublic       bool       `gorm:"column:is_public;default:false" json:"is_public"`
+	ShareToken     *string    `gorm:"column:share_token" json:"share_token,omitempty"`
+	ExpiresAt      *time.Time `gorm:"column:expires_at" json:"expires_at"`
+	Password       *string    `gorm:"column:password" json:"-"`
+	// MaxDownloads closes a public link after that many downloads.
+	MaxDownloads  *int `gorm:"column:max_downloads" json:"max_downloads"`
+	DownloadCount int  `gorm:"column:download_count" json:"download_count"`
 	// computed
 	HasPassword bool `gorm:"-" json:"hasPassword,omitempty"`
 }
 
 func (Share) TableName() string { return "shares" }
 
+// Permissions a private share grants, weakest first. Each one includes the
+// ones before it.
+const (
+	SharePermissionRead    = "read"
+	SharePermissionComment = "comment"
+	SharePermissionWrite   = "write"
+	SharePermissionReshare = "reshare"
+)
+
+// Outcomes of a hit on a public link, recorded in the share access log.
+const (
+	ShareOutcomeViewed           = "viewed"
+	ShareOutcomeDownloaded       = "downloaded"
+	ShareOutcomePasswordRequired = "password_required"
+	ShareOutcomeWrongPassword    = "wrong_password"
+	ShareOutcomeLockedOut        = "locked_out"
+	ShareOutcomeExpired          = "expired"
+)
+
+// ShareAccess is one hit on a public link.
+type ShareAccess struct {
+	ID        uuid.UUID `gorm:"type:uuid;primaryKey;default:uuid_generate_v4()" json:"id"`
+	CreatedAt time.Time `gorm:"column:created_at;autoCreateTime" json:"created_at"`
+	ShareID   uuid.UUID `gorm:"column:share_id;not null" json:"share_id"`
+	Outcome   string    `gorm:"column:outcome;not null" json:"outcome"`
+	IPAddress string    `gorm:"column:ip_address" json:"ip_address"`
+	UserAgent string    `gorm:"column:user_agent" json:"user_agent"`
+}
+
+func (ShareAccess) TableName() string { return "share_access_log" }
+
 type PasswordReset struct {
 	ID        uuid.UUID  `gorm:"type:uuid;primaryKey;default:uuid_generate_v4()" json:"id"`
 	CreatedAt time.Time  `gorm:"column:created_at;autoCreateTime" json:"created_at"`
@@ -147,12 +251,48 @@ type Space struct {
 	Description *string    `gorm:"column:description" json:"description,omitempty"`
 	CreatedBy   *uuid.UUID `gorm:"column:created_by" json:"created_by,omitempty"`
 	Creator     *User      `gorm:"foreignKey:CreatedBy" json:"creator,omitempty"`
+	// Visibility decides who can see and join the space.
+	Visibility string `gorm:"column:visibility;default:'open'" json:"visibility"`
+	// TrashRetentionDays is how long deleted files stay in the space trash.
+	TrashRetentionDays int `gorm:"column:trash_retention_days;default:30" json:"trash_retention_days"`
 	// computed
 	MemberCount int `gorm:"-" json:"memberCount,omitempty"`
 }
 
 func (Space) TableName() string { return "spaces" }
 
+// Space visibilities. Every user is enrolled in open spaces; discoverable
+// spaces are listed to everyone and joined by request; private spaces are
+// invite-only and hidden from non-members.
+const (
+	SpaceVisibilityOpen         = "open"
+	SpaceVisibilityDiscoverable = "discoverable"
+	SpaceVisibilityPrivate      = "private"
+)
+
+// SpaceJoinRequest is a request to join a discoverable space.
+type SpaceJoinRequest struct {
+	ID        uuid.UUID  `gorm:"type:uuid;primaryKey;default:uuid_generate_v4()" json:"id"`
+	CreatedAt time.Time  `gorm:"column:created_at;autoCreateTime" json:"created_at"`
+	SpaceID   uuid.UUID  `gorm:"column:space_id;not null" json:"space_id"`
+	UserID    uuid.UUID  `gorm:"column:user_id;not null" json:"user_id"`
+	Message   string     `gorm:"column:message" json:"message"`
+	Status    string     `gorm:"column:status;default:'pending'" json:"status"`
+	DecidedBy *uuid.UUID `gorm:"column:decided_by" json:"decided_by,omitempty"`
+	DecidedAt *time.Time `gorm:"column:decided_at" json:"decided_at,omitempty"`
+	// associations
+	User *User `gorm:"foreignKey:UserID" json:"user,omitempty"`
+}
+
+func (SpaceJoinRequest) TableName() string { return "space_join_requests" }
+
+// Space join request statuses.
+const (
+	JoinRequestPending  = "pending"
+	JoinRequestApproved = "approved"
+	JoinRequestRejected = "rejected"
+)
+
 // SpaceMemberRole constants
 const (
 	SpaceRoleViewer      = "viewer"
@@ -166,6 +306,8 @@ type SpaceMember struct {
 	Role    string     `gorm:"not null;default:'contributor'" json:"role"`
 	AddedBy *uuid.UUID `gorm:"column:added_by" json:"added_by,omitempty"`
 	AddedAt time.Time  `gorm:"column:added_at;autoCreateTime" json:"added_at"`
+	// Source is "ldap" for memberships granted by a directory group.
+	Source *string `gorm:"column:source" json:"source,omitempty"`
 	// associations
 	User  *User `gorm:"foreignKey:UserID" json:"user,omitempty"`
 	Adder *User `gorm:"foreignKey:AddedBy" json:"adder,omitempty"`
@@ -173,15 +315,72 @@ type SpaceMember struct {
 
 func (SpaceMember) TableName() string { return "space_members" }
 
+// Group is a named set of users that can hold shares and space roles.
+type Group struct {
+	ID          uuid.UUID  `gorm:"type:uuid;primaryKey;default:uuid_generate_v4()" json:"id"`
+	CreatedAt   time.Time  `gorm:"column:created_at;autoCreateTime" json:"created_at"`
+	UpdatedAt   time.Time  `gorm:"column:updated_at;autoUpdateTime" json:"updated_at"`
+	Name        string     `gorm:"not null" json:"name"`
+	Description string     `gorm:"column:description" json:"description"`
+	CreatedBy   *uuid.UUID `gorm:"column:created_by" json:"created_by,omitempty"`
+	// SyncSource ("ldap" or "oidc") keeps the membership in line with
+	// SyncGroup in the directory or the IdP's groups claim.
+	SyncSource *string `gorm:"column:sync_source" json:"sync_source,omitempty"`
+	SyncGroup  *string `gorm:"column:sync_group" json:"sync_group,omitempty"`
+	// computed
+	MemberCount int `gorm:"-" json:"member_count"`
+}
+
+func (Group) TableName() string { return "user_groups" }
+
+// Group sync sources.
+const (
+	GroupSourceLDAP = "ldap"
+	GroupSourceOIDC = "oidc"
+)
+
+type GroupMember struct {
+	GroupID uuid.UUID  `gorm:"column:group_id;primaryKey" json:"group_id"`
+	UserID  uuid.UUID  `gorm:"column:user_id;primaryKey" json:"user_id"`
+	AddedBy *uuid.UUID `gorm:"column:added_by" json:"added_by,omitempty"`
+	AddedAt time.Time  `gorm:"column:added_at;autoCreateTime" json:"added_at"`
+	// Source is the sync that added the membership, nil if added by hand.
+	Source *string `gorm:"column:source" json:"source,omitempty"`
+	User   *User   `gorm:"foreignKey:UserID" json:"user,omitempty"`
+}
+
+func (GroupMember) TableName() string { return "user_group_members" }
+
+// SpaceGroupMember gives every member of a group a role in a space.
+type SpaceGroupMember struct {
+	SpaceID uuid.UUID  `gorm:"column:space_id;primaryKey" json:"space_id"`
+	GroupID uuid.UUID  `gorm:"column:group_id;primaryKey" json:"group_id"`
+	Role    string     `gorm:"not null;default:'contributor'" json:"role"`
+	AddedBy *uuid.UUID `gorm:"column:added_by" json:"added_by,omitempty"`
+	AddedAt time.Time  `gorm:"column:added_at;autoCreateTime" json:"added_at"`
+	Group   *Group     `gorm:"foreignKey:GroupID" json:"group,omitempty"`
+}
+
+func (SpaceGroupMember) TableName() string { return "space_group_members" }
+
 // SpaceActivityAction constants
 const (
 	SpaceActionUpload            = "upload"
 	SpaceActionDelete            = "delete"
+	SpaceActionRestore           = "restore"
+	SpaceActionPurge             = "purge"
 	SpaceActionRename            = "rename"
 	SpaceActionMove              = "move"
+	SpaceActionCopy              = "copy"
 	SpaceActionMemberAdded       = "member_added"
 	SpaceActionMemberRoleChanged = "member_role_changed"
 	SpaceActionMemberRemoved     = "member_removed"
+	SpaceActionGroupAdded        = "group_added"
+	SpaceActionGroupRoleChanged  = "group_role_changed"
+	SpaceActionGroupRemoved      = "group_removed"
+	SpaceActionJoinRequested     = "join_requested"
+	SpaceActionJoinRejected      = "join_rejected"
+	SpaceActionSettingsChanged   = "settings_changed"
 )
 
 type SpaceActivity struct {
@@ -257,3 +456,124 @@ type AuditLog struct {
 }
 
 func (AuditLog) TableName() string { return "audit_logs" }
+
+// AppPassword is a generated secret a user can give to a client that signs in
+// with HTTP Basic auth (e.g. a WebDAV mount) instead of their account password.
+// The same secret works as a personal access token (Authorization: Bearer) on
+// the routes its scopes cover.
+type AppPassword struct {
+	ID         uuid.UUID   `gorm:"type:uuid;primaryKey;default:uuid_generate_v4()" json:"id"`
+	CreatedAt  time.Time   `gorm:"column:created_at;autoCreateTime" json:"created_at"`
+	UserID     uuid.UUID   `gorm:"column:user_id;not null" json:"user_id"`
+	Name       string      `gorm:"not null" json:"name"`
+	TokenHash  string      `gorm:"column:token_hash;not null" json:"-"`
+	Scopes     StringArray `gorm:"column:scopes;type:text" json:"scopes"`
+	ExpiresAt  *time.Time  `gorm:"column:expires_at" json:"expires_at"`
+	LastUsedAt *time.Time  `gorm:"column:last_used_at" json:"last_used_at"`
+}
+
+func (AppPassword) TableName() string { return "app_passwords" }
+
+// UserTOTP is a user's TOTP enrollment. The secret is wrapped by the master
+// key; EnabledAt is nil until the user has confirmed a first code.
+type UserTOTP struct {
+	ID           uuid.UUID  `gorm:"type:uuid;primaryKey;default:uuid_generate_v4()" json:"id"`
+	CreatedAt    time.Time  `gorm:"column:created_at;autoCreateTime" json:"created_at"`
+	UserID       uuid.UUID  `gorm:"column:user_id;not null" json:"user_id"`
+	EncryptedDEK []byte     `gorm:"column:encrypted_dek;not null" json:"-"`
+	KeyID        *string    `gorm:"column:key_id" json:"-"`
+	EnabledAt    *time.Time `gorm:"column:enabled_at" json:"enabled_at"`
+	LastCounter  int64      `gorm:"column:last_counter;default:0" json:"-"`
+}
+
+func (UserTOTP) TableName() string { return "user_totp" }
+
+// TOTPRecoveryCode is a single-use code that stands in for a TOTP code when
+// the user has lost their authenticator.
+type TOTPRecoveryCode struct {
+	ID        uuid.UUID  `gorm:"type:uuid;primaryKey;default:uuid_generate_v4()" json:"id"`
+	CreatedAt time.Time  `gorm:"column:created_at;autoCreateTime" json:"created_at"`
+	UserID    uuid.UUID  `gorm:"column:user_id;not null" json:"user_id"`
+	CodeHash  string     `gorm:"column:code_hash;not null" json:"-"`
+	UsedAt    *time.Time `gorm:"column:used_at" json:"used_at"`
+}
+
+func (TOTPRecoveryCode) TableName() string { return "totp_recovery_codes" }
+
+// WebAuthnCredential is a passkey registered to a user.
+type WebAuthnCredential struct {
+	ID             uuid.UUID  `gorm:"type:uuid;primaryKey;default:uuid_generate_v4()" json:"id"`
+	CreatedAt      time.Time  `gorm:"column:created_at;autoCreateTime" json:"created_at"`
+	UserID         uuid.UUID  `gorm:"column:user_id;not null" json:"user_id"`
+	Name           string     `gorm:"column:name;not null" json:"name"`
+	CredentialID   []byte     `gorm:"column:credential_id;not null" json:"-"`
+	PublicKey      []byte     `gorm:"column:public_key;not null" json:"-"`
+	SignCount      int64      `gorm:"column:sign_count;default:0" json:"-"`
+	AAGUID         []byte     `gorm:"column:aaguid" json:"-"`
+	Transports     string     `gorm:"column:transports" json:"-"`
+	BackupEligible bool       `gorm:"column:backup_eligible" json:"backup_eligible"`
+	BackedUp       bool       `gorm:"column:backed_up" json:"backed_up"`
+	LastUsedAt     *time.Time `gorm:"column:last_used_at" json:"last_used_at"`
+}
+
+func (WebAuthnCredential) TableName() string { return "webauthn_credentials" }
+
+// Session is a signed-in device. Its ID is the jti of the access tokens it
+// issues; revoking it invalidates them.
+type Session struct {
+	ID              uuid.UUID  `gorm:"type:uuid;primaryKey;default:uuid_generate_v4()" json:"id"`
+	CreatedAt       time.Time  `gorm:"column:created_at;autoCreateTime" json:"created_at"`
+	UserID          uuid.UUID  `gorm:"column:user_id;not null" json:"user_id"`
+	RefreshHash     string     `gorm:"column:refresh_hash;not null" json:"-"`
+	PrevRefreshHash *string    `gorm:"column:prev_refresh_hash" json:"-"`
+	RotatedAt       *time.Time `gorm:"column:rotated_at" json:"-"`
+	ExpiresAt       time.Time  `gorm:"column:expires_at;not null" json:"expires_at"`
+	LastSeenAt      time.Time  `gorm:"column:last_seen_at" json:"last_seen_at"`
+	RevokedAt       *time.Time `gorm:"column:revoked_at" json:"-"`
+	IPAddress       string     `gorm:"column:ip_address" json:"ip_address"`
+	UserAgent       string     `gorm:"column:user_agent" json:"user_agent"`
+	Device          string     `gorm:"column:device" json:"device"`
+	AuthMethod      string     `gorm:"column:auth_method" json:"auth_method"`
+}
+
+func (Session) TableName() string { return "sessions" }
+
+// FileRequest is an upload-only public link into a folder. Visitors with
+// the token can add files but not see what the folder holds.
+type FileRequest struct {
+	ID                uuid.UUID   `gorm:"type:uuid;primaryKey;default:uuid_generate_v4()" json:"id"`
+	CreatedAt         time.Time   `gorm:"column:created_at;autoCreateTime" json:"created_at"`
+	UpdatedAt         time.Time   `gorm:"column:updated_at;autoUpdateTime" json:"updated_at"`
+	CreatedBy         uuid.UUID   `gorm:"column:created_by;not null" json:"created_by"`
+	FolderID          uuid.UUID   `gorm:"column:folder_id;not null" json:"folder_id"`
+	Folder            *File       `gorm:"foreignKey:FolderID" json:"folder,omitempty"`
+	Token             string      `gorm:"column:token;not null" json:"token"`
+	Title             string      `gorm:"column:title" json:"title"`
+	Message           string      `gorm:"column:message" json:"message"`
+	Password          *string     `gorm:"column:password" json:"-"`
+	ExpiresAt         *time.Time  `gorm:"column:expires_at" json:"expires_at"`
+	MaxFiles          int         `gorm:"column:max_files" json:"max_files"`
+	MaxFileSize       int64       `gorm:"column:max_file_size" json:"max_file_size"`
+	AllowedExtensions StringArray `gorm:"column:allowed_extensions;type:text" json:"allowed_extensions"`
+	RequireUploader   bool        `gorm:"column:require_uploader" json:"require_uploader"`
+	UploadCount       int         `gorm:"column:upload_count" json:"upload_count"`
+	// computed
+	HasPassword bool `gorm:"-" json:"hasPassword"`
+}
+
+func (FileRequest) TableName() string { return "file_requests" }
+
+// FileRequestUpload is a file received through a file request.
+type FileRequestUpload struct {
+	ID            uuid.UUID  `gorm:"type:uuid;primaryKey;default:uuid_generate_v4()" json:"id"`
+	CreatedAt     time.Time  `gorm:"column:created_at;autoCreateTime" json:"created_at"`
+	RequestID     uuid.UUID  `gorm:"column:request_id;not null" json:"request_id"`
+	FileID        *uuid.UUID `gorm:"column:file_id" json:"file_id"`
+	FileName      string     `gorm:"column:file_name;not null" json:"file_name"`
+	Size          int64      `gorm:"column:size" json:"size"`
+	UploaderName  string     `gorm:"column:uploader_name" json:"uploader_name"`
+	UploaderEmail string     `gorm:"column:uploader_email" json:"uploader_email"`
+	IPAddress     string     `gorm:"column:ip_address" json:"ip_address"`
+}
+
+func (FileRequestUpload) TableName() string { return "file_request_uploads" }
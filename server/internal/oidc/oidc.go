@@ -0,0 +1,390 @@
+// Package oidc implements an OpenID Connect relying party for the
+// authorization code flow with PKCE (RFC 7636): provider discovery, the
+// token exchange and ID token verification against the provider's JWKS.
+package oidc
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// maxResponseBytes caps what is read from the provider.
+const maxResponseBytes = 1 << 20
+
+// jwksRefreshInterval limits how often an unknown key ID triggers a JWKS
+// download, so forged tokens cannot make the server hammer the provider.
+const jwksRefreshInterval = time.Minute
+
+// clockSkew is the leeway allowed on exp, iat and nbf.
+const clockSkew = time.Minute
+
+// signingMethods are the ID token algorithms accepted. "none" and HMAC are
+// never accepted.
+var signingMethods = []string{"RS256", "RS384", "RS512", "PS256", "PS384", "PS512", "ES256", "ES384", "ES512"}
+
+// ErrInvalidToken is wrapped by every ID token verification failure.
+var ErrInvalidToken = errors.New("oidc: invalid ID token")
+
+// Config is the client registration at the provider.
+type Config struct {
+	ClientID     string
+	ClientSecret string // empty for a public client
+	RedirectURL  string
+	Scopes       []string
+}
+
+// Provider is a discovered OpenID provider.
+type Provider struct {
+	Issuer                string `json:"issuer"`
+	AuthorizationEndpoint string `json:"authorization_endpoint"`
+	TokenEndpoint         string `json:"token_endpoint"`
+	JWKSURI               string `json:"jwks_uri"`
+
+	client *http.Client
+
+	mu          sync.Mutex
+	keys        map[string]crypto.PublicKey
+	keysFetched time.Time
+}
+
+// Discover fetches the provider's metadata from
+// {issuer}/.well-known/openid-configuration.
+func Discover(ctx context.Context, client *http.Client, issuer string) (*Provider, error) {
+	if client == nil {
+		client = http.DefaultClient
+	}
+	wellKnown := strings.TrimSuffix(issuer, "/") + "/.well-known/openid-configuration"
+	p := &Provider{client: client}
+	if err := getJSON(ctx, client, wellKnown, p); err != nil {
+		return nil, fmt.Errorf("oidc discovery: %w", err)
+	}
+	// The issuer in the metadata must be the one configured (OIDC
+	// Discovery §4.3), or tokens could be accepted from another tenant.
+	if p.Issuer != issuer {
+		return nil, fmt.Errorf("oidc discovery: issuer %q does not match %q", p.Issuer, issuer)
+	}
+	if p.AuthorizationEndpoint == "" || p.TokenEndpoint == "" || p.JWKSURI == "" {
+		return nil, errors.New("oidc discovery: metadata is missing endpoints")
+	}
+	return p, nil
+}
+
+func getJSON(ctx context.Context, client *http.Client, u string, v any) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Accept", "application/json")
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("GET %s: %s", u, resp.Status)
+	}
+	return json.NewDecoder(io.LimitReader(resp.Body, maxResponseBytes)).Decode(v)
+}
+
+// ── PKCE, state and nonce ───────────────────────────────────────────────────
+
+// RandomString returns 32 random bytes, base64url-encoded. It is used for
+// state, nonce and PKCE verifiers (43 characters, as RFC 7636 allows).
+func RandomString() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// Challenge returns the S256 code challenge for a PKCE verifier.
+func Challenge(verifier string) string {
+	sum := sha256.Sum256([]byte(verifier))
+	return base64.RawURLEncoding.EncodeToString(sum[:])
+}
+
+// ── Authorization code flow ─────────────────────────────────────────────────
+
+// AuthCodeURL returns the URL to send the browser to for sign-in.
+func (p *Provider) AuthCodeURL(cfg *Config, state, nonce, verifier string) string {
+	v := url.Values{}
+	v.Set("response_type", "code")
+	v.Set("client_id", cfg.ClientID)
+	v.Set("redirect_uri", cfg.RedirectURL)
+	v.Set("scope", strings.Join(cfg.Scopes, " "))
+	v.Set("state", state)
+	v.Set("nonce", nonce)
+	v.Set("code_challenge", Challenge(verifier))
+	v.Set("code_challenge_method", "S256")
+	sep := "?"
+	if strings.Contains(p.AuthorizationEndpoint, "?") {
+		sep = "&"
+	}
+	return p.AuthorizationEndpoint + sep + v.Encode()
+}
+
+// Token is the token endpoint's response.
+type Token struct {
+	AccessToken string `json:"access_token"`
+	TokenType   string `json:"token_type"`
+	IDToken     string `json:"id_token"`
+	ExpiresIn   int    `json:"expires_in"`
+}
+
+// Exchange redeems an authorization code. Confidential clients authenticate
+// with client_secret_basic.
+func (p *Provider) Exchange(ctx context.Context, cfg *Config, code, verifier string) (*Token, error) {
+	form := url.Values{}
+	form.Set("grant_type", "authorization_code")
+	form.Set("code", code)
+	form.Set("redirect_uri", cfg.RedirectURL)
+	form.Set("code_verifier", verifier)
+	if cfg.ClientSecret == "" {
+		form.Set("client_id", cfg.ClientID)
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, p.TokenEndpoint, strings.NewReader(form.Encode()))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+	if cfg.ClientSecret != "" {
+		// RFC 6749 §2.3.1: both parts are form-encoded before Basic encoding.
+		req.SetBasicAuth(url.QueryEscape(cfg.ClientID), url.QueryEscape(cfg.ClientSecret))
+	}
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("oidc token exchange: %w", err)
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(io.LimitReader(resp.Body, maxResponseBytes))
+	if err != nil {
+		return nil, fmt.Errorf("oidc token exchange: %w", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		var e struct {
+			Error       string `json:"error"`
+			Description string `json:"error_description"`
+		}
+		if json.Unmarshal(body, &e) == nil && e.Error != "" {
+			return nil, fmt.Errorf("oidc token exchange: %s: %s", e.Error, e.Description)
+		}
+		return nil, fmt.Errorf("oidc token exchange: %s", resp.Status)
+	}
+	var tok Token
+	if err := json.Unmarshal(body, &tok); err != nil {
+		return nil, fmt.Errorf("oidc token exchange: %w", err)
+	}
+	if tok.IDToken == "" {
+		return nil, errors.New("oidc token exchange: no id_token in response (is the openid scope requested?)")
+	}
+	return &tok, nil
+}
+
+// ── ID tokens ───────────────────────────────────────────────────────────────
+
+// IDToken is a verified ID token.
+type IDToken struct {
+	Subject       string
+	Email         string
+	EmailVerified bool
+	Name          string
+	// Claims holds every claim, for provider-specific ones such as groups.
+	Claims map[string]any
+}
+
+// Verify checks an ID token's signature, issuer, audience, expiry and nonce
+// (OIDC Core §3.1.3.7) and returns its claims.
+func (p *Provider) Verify(ctx context.Context, cfg *Config, raw, nonce string) (*IDToken, error) {
+	claims := jwt.MapClaims{}
+	_, err := jwt.ParseWithClaims(raw, claims, func(t *jwt.Token) (any, error) {
+		kid, _ := t.Header["kid"].(string)
+		return p.key(ctx, kid)
+	},
+		jwt.WithValidMethods(signingMethods),
+		jwt.WithIssuer(p.Issuer),
+		jwt.WithAudience(cfg.ClientID),
+		jwt.WithExpirationRequired(),
+		jwt.WithIssuedAt(),
+		jwt.WithLeeway(clockSkew),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidToken, err)
+	}
+
+	aud, _ := claims.GetAudience()
+	if azp, _ := claims["azp"].(string); (len(aud) > 1 || azp != "") && azp != cfg.ClientID {
+		return nil, fmt.Errorf("%w: authorized party %q", ErrInvalidToken, azp)
+	}
+	got, _ := claims["nonce"].(string)
+	if nonce == "" || subtle.ConstantTimeCompare([]byte(got), []byte(nonce)) != 1 {
+		return nil, fmt.Errorf("%w: nonce mismatch", ErrInvalidToken)
+	}
+	sub, _ := claims.GetSubject()
+	if sub == "" {
+		return nil, fmt.Errorf("%w: no subject", ErrInvalidToken)
+	}
+
+	tok := &IDToken{Subject: sub, Claims: claims}
+	tok.Email, _ = claims["email"].(string)
+	tok.Name, _ = claims["name"].(string)
+	// Some providers send email_verified as a string.
+	switch v := claims["email_verified"].(type) {
+	case bool:
+		tok.EmailVerified = v
+	case string:
+		tok.EmailVerified = v == "true"
+	}
+	return tok, nil
+}
+
+// StringsClaim reads a claim that holds a list of strings, or a single
+// string, such as groups or roles.
+func (t *IDToken) StringsClaim(name string) []string {
+	switch v := t.Claims[name].(type) {
+	case string:
+		return []string{v}
+	case []any:
+		out := make([]string, 0, len(v))
+		for _, e := range v {
+			if s, ok := e.(string); ok {
+				out = append(out, s)
+			}
+		}
+		return out
+	}
+	return nil
+}
+
+// key returns the provider's signing key kid, refreshing the JWKS when the
+// key is unknown (the provider may have rotated keys).
+func (p *Provider) key(ctx context.Context, kid string) (crypto.PublicKey, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if k, ok := p.lookup(kid); ok {
+		return k, nil
+	}
+	if time.Since(p.keysFetched) < jwksRefreshInterval {
+		return nil, fmt.Errorf("unknown signing key %q", kid)
+	}
+	keys, err := fetchJWKS(ctx, p.client, p.JWKSURI)
+	p.keysFetched = time.Now()
+	if err != nil {
+		return nil, err
+	}
+	p.keys = keys
+	if k, ok := p.lookup(kid); ok {
+		return k, nil
+	}
+	return nil, fmt.Errorf("unknown signing key %q", kid)
+}
+
+// lookup finds kid among the cached keys. A token without a kid matches
+// only when the provider publishes a single key.
+func (p *Provider) lookup(kid string) (crypto.PublicKey, bool) {
+	if kid == "" && len(p.keys) == 1 {
+		for _, k := range p.keys {
+			return k, true
+		}
+	}
+	k, ok := p.keys[kid]
+	return k, ok
+}
+
+type jwk struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Use string `json:"use"`
+	N   string `json:"n"`
+	E   string `json:"e"`
+	Crv string `json:"crv"`
+	X   string `json:"x"`
+	Y   string `json:"y"`
+}
+
+func fetchJWKS(ctx context.Context, client *http.Client, u string) (map[string]crypto.PublicKey, error) {
+	var set struct {
+		Keys []jwk `json:"keys"`
+	}
+	if err := getJSON(ctx, client, u, &set); err != nil {
+		return nil, fmt.Errorf("oidc jwks: %w", err)
+	}
+	keys := make(map[string]crypto.PublicKey, len(set.Keys))
+	for _, k := range set.Keys {
+		if k.Use != "" && k.Use != "sig" {
+			continue
+		}
+		pub, err := k.publicKey()
+		if err != nil {
+			continue // skip key types we do not verify with
+		}
+		keys[k.Kid] = pub
+	}
+	return keys, nil
+}
+
+func (k *jwk) publicKey() (crypto.PublicKey, error) {
+	b64 := base64.RawURLEncoding
+	switch k.Kty {
+	case "RSA":
+		n, err := b64.DecodeString(k.N)
+		if err != nil {
+			return nil, err
+		}
+		e, err := b64.DecodeString(k.E)
+		if err != nil || len(e) == 0 || len(e) > 4 {
+			return nil, errors.New("bad RSA exponent")
+		}
+		if len(n)*8 < 2048 {
+			return nil, errors.New("RSA key too small")
+		}
+		exp := 0
+		for _, b := range e {
+			exp = exp<<8 | int(b)
+		}
+		return &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: exp}, nil
+	case "EC":
+		var curve elliptic.Curve
+		switch k.Crv {
+		case "P-256":
+			curve = elliptic.P256()
+		case "P-384":
+			curve = elliptic.P384()
+		case "P-521":
+			curve = elliptic.P521()
+		default:
+			return nil, fmt.Errorf("unsupported curve %q", k.Crv)
+		}
+		size := (curve.Params().BitSize + 7) / 8
+		x, err := b64.DecodeString(k.X)
+		if err != nil || len(x) != size {
+			return nil, errors.New("bad EC key")
+		}
+		y, err := b64.DecodeString(k.Y)
+		if err != nil || len(y) != size {
+			return nil, errors.New("bad EC key")
+		}
+		return ecdsa.ParseUncompressedPublicKey(curve, append(append([]byte{4}, x...), y...))
+	}
+	return nil, fmt.Errorf("unsupported key type %q", k.Kty)
+}
@@ -0,0 +1,139 @@
+package oidc_test
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/zynqcloud/api/internal/oidc"
+	"github.com/zynqcloud/api/internal/oidc/oidctest"
+)
+
+func setup(t *testing.T) (*oidctest.Server, *oidc.Provider, *oidc.Config) {
+	t.Helper()
+	idp := oidctest.NewServer("zynq", "s3cret")
+	t.Cleanup(idp.Close)
+	p, err := oidc.Discover(context.Background(), idp.Client(), idp.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfg := &oidc.Config{
+		ClientID:     "zynq",
+		ClientSecret: "s3cret",
+		RedirectURL:  "https://cloud.example.com/api/v1/auth/oidc/callback",
+		Scopes:       []string{"openid", "email", "profile"},
+	}
+	return idp, p, cfg
+}
+
+// authorize follows the authorization URL and returns the code and state
+// the provider redirects back with.
+func authorize(t *testing.T, idp *oidctest.Server, authURL string) (string, string) {
+	t.Helper()
+	client := idp.Client()
+	client.CheckRedirect = func(*http.Request, []*http.Request) error { return http.ErrUseLastResponse }
+	resp, err := client.Get(authURL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusFound {
+		t.Fatalf("authorize: status %d", resp.StatusCode)
+	}
+	loc, _ := url.Parse(resp.Header.Get("Location"))
+	return loc.Query().Get("code"), loc.Query().Get("state")
+}
+
+func TestCodeFlowWithPKCE(t *testing.T) {
+	idp, p, cfg := setup(t)
+	idp.Claims = map[string]any{
+		"sub":            "user-42",
+		"email":          "ada@example.com",
+		"email_verified": true,
+		"name":           "Ada Lovelace",
+		"groups":         []string{"staff", "zynq-admins"},
+	}
+
+	state, _ := oidc.RandomString()
+	nonce, _ := oidc.RandomString()
+	verifier, _ := oidc.RandomString()
+	code, gotState := authorize(t, idp, p.AuthCodeURL(cfg, state, nonce, verifier))
+	if gotState != state {
+		t.Fatalf("state = %q, want %q", gotState, state)
+	}
+
+	tok, err := p.Exchange(context.Background(), cfg, code, verifier)
+	if err != nil {
+		t.Fatal(err)
+	}
+	id, err := p.Verify(context.Background(), cfg, tok.IDToken, nonce)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if id.Subject != "user-42" || id.Email != "ada@example.com" || !id.EmailVerified || id.Name != "Ada Lovelace" {
+		t.Errorf("unexpected identity %+v", id)
+	}
+	if g := id.StringsClaim("groups"); len(g) != 2 || g[1] != "zynq-admins" {
+		t.Errorf("groups = %v", g)
+	}
+
+	// Codes are single-use.
+	if _, err := p.Exchange(context.Background(), cfg, code, verifier); err == nil {
+		t.Error("authorization code redeemed twice")
+	}
+}
+
+func TestExchangeRequiresVerifier(t *testing.T) {
+	idp, p, cfg := setup(t)
+	idp.Claims = map[string]any{"sub": "user-42"}
+	verifier, _ := oidc.RandomString()
+	code, _ := authorize(t, idp, p.AuthCodeURL(cfg, "state", "nonce", verifier))
+	other, _ := oidc.RandomString()
+	if _, err := p.Exchange(context.Background(), cfg, code, other); err == nil {
+		t.Error("code redeemed with the wrong PKCE verifier")
+	}
+}
+
+func TestVerifyRejects(t *testing.T) {
+	idp, p, cfg := setup(t)
+	ctx := context.Background()
+	now := time.Now()
+
+	cases := map[string]jwt.MapClaims{
+		"wrong audience": {"sub": "u", "nonce": "n", "aud": "someone-else"},
+		"wrong issuer":   {"sub": "u", "nonce": "n", "iss": "https://evil.example.net"},
+		"expired":        {"sub": "u", "nonce": "n", "exp": now.Add(-time.Hour).Unix()},
+		"wrong nonce":    {"sub": "u", "nonce": "other"},
+		"no subject":     {"nonce": "n"},
+		"foreign azp":    {"sub": "u", "nonce": "n", "aud": []string{"zynq", "other"}, "azp": "other"},
+	}
+	for name, claims := range cases {
+		if _, err := p.Verify(ctx, cfg, idp.IDToken(claims), "n"); !errors.Is(err, oidc.ErrInvalidToken) {
+			t.Errorf("%s: got %v, want ErrInvalidToken", name, err)
+		}
+	}
+
+	// An HMAC token keyed with something public must not pass.
+	forged, _ := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
+		"iss": idp.URL, "aud": "zynq", "sub": "u", "nonce": "n", "exp": now.Add(time.Hour).Unix(),
+	}).SignedString([]byte("s3cret"))
+	if _, err := p.Verify(ctx, cfg, forged, "n"); err == nil {
+		t.Error("HS256 token accepted")
+	}
+
+	if _, err := p.Verify(ctx, cfg, idp.IDToken(jwt.MapClaims{"sub": "u", "nonce": "n"}), "n"); err != nil {
+		t.Errorf("valid token rejected: %v", err)
+	}
+}
+
+func TestDiscoverChecksIssuer(t *testing.T) {
+	idp := oidctest.NewServer("zynq", "")
+	defer idp.Close()
+	if _, err := oidc.Discover(context.Background(), idp.Client(), idp.URL+"/"); err == nil {
+		t.Error("discovery accepted metadata for a different issuer string")
+	}
+}
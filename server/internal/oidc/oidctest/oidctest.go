@@ -0,0 +1,216 @@
+// Package oidctest runs a minimal OpenID provider for tests. Its
+// authorization endpoint signs in whoever Claims describes without a login
+// page, and its token endpoint checks client authentication, the redirect
+// URI and the PKCE verifier like a real provider.
+package oidctest
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/zynqcloud/api/internal/oidc"
+)
+
+// Server is a running mock provider. Its issuer is URL.
+type Server struct {
+	*httptest.Server
+
+	ClientID     string
+	ClientSecret string
+
+	// Claims are added to the ID token of the next sign-in, on top of iss,
+	// aud, exp, iat and nonce. Set "sub" at least.
+	Claims map[string]any
+
+	key   *rsa.PrivateKey
+	keyID string
+
+	mu    sync.Mutex
+	codes map[string]grant
+}
+
+type grant struct {
+	redirectURI string
+	nonce       string
+	challenge   string
+	claims      map[string]any
+}
+
+// NewServer starts a provider with one registered client. Close it when
+// done.
+func NewServer(clientID, clientSecret string) *Server {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		panic(err)
+	}
+	s := &Server{
+		ClientID:     clientID,
+		ClientSecret: clientSecret,
+		Claims:       map[string]any{},
+		key:          key,
+		keyID:        "test-key",
+		codes:        make(map[string]grant),
+	}
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /.well-known/openid-configuration", s.discovery)
+	mux.HandleFunc("GET /authorize", s.authorize)
+	mux.HandleFunc("POST /token", s.token)
+	mux.HandleFunc("GET /jwks", s.jwks)
+	s.Server = httptest.NewServer(mux)
+	return s
+}
+
+func (s *Server) discovery(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, map[string]any{
+		"issuer":                                s.URL,
+		"authorization_endpoint":                s.URL + "/authorize",
+		"token_endpoint":                        s.URL + "/token",
+		"jwks_uri":                              s.URL + "/jwks",
+		"response_types_supported":              []string{"code"},
+		"subject_types_supported":               []string{"public"},
+		"id_token_signing_alg_values_supported": []string{"RS256"},
+		"code_challenge_methods_supported":      []string{"S256"},
+	})
+}
+
+func (s *Server) authorize(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	if q.Get("client_id") != s.ClientID || q.Get("response_type") != "code" {
+		http.Error(w, "invalid_request", http.StatusBadRequest)
+		return
+	}
+	if q.Get("code_challenge_method") != "S256" || q.Get("code_challenge") == "" {
+		http.Error(w, "PKCE required", http.StatusBadRequest)
+		return
+	}
+	code, _ := oidc.RandomString()
+	claims := make(map[string]any, len(s.Claims))
+	s.mu.Lock()
+	for k, v := range s.Claims {
+		claims[k] = v
+	}
+	s.codes[code] = grant{
+		redirectURI: q.Get("redirect_uri"),
+		nonce:       q.Get("nonce"),
+		challenge:   q.Get("code_challenge"),
+		claims:      claims,
+	}
+	s.mu.Unlock()
+
+	back, err := url.Parse(q.Get("redirect_uri"))
+	if err != nil {
+		http.Error(w, "bad redirect_uri", http.StatusBadRequest)
+		return
+	}
+	v := back.Query()
+	v.Set("code", code)
+	v.Set("state", q.Get("state"))
+	back.RawQuery = v.Encode()
+	http.Redirect(w, r, back.String(), http.StatusFound)
+}
+
+func (s *Server) token(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil {
+		tokenError(w, "invalid_request")
+		return
+	}
+	id, secret, ok := r.BasicAuth()
+	if ok {
+		id, _ = url.QueryUnescape(id)
+		secret, _ = url.QueryUnescape(secret)
+	} else {
+		id = r.PostForm.Get("client_id")
+	}
+	if id != s.ClientID || subtle.ConstantTimeCompare([]byte(secret), []byte(s.ClientSecret)) != 1 {
+		w.Header().Set("WWW-Authenticate", "Basic")
+		writeJSON(w, http.StatusUnauthorized, map[string]string{"error": "invalid_client"})
+		return
+	}
+	if r.PostForm.Get("grant_type") != "authorization_code" {
+		tokenError(w, "unsupported_grant_type")
+		return
+	}
+
+	code := r.PostForm.Get("code")
+	s.mu.Lock()
+	g, found := s.codes[code]
+	delete(s.codes, code) // codes are single-use
+	s.mu.Unlock()
+	if !found || g.redirectURI != r.PostForm.Get("redirect_uri") {
+		tokenError(w, "invalid_grant")
+		return
+	}
+	if oidc.Challenge(r.PostForm.Get("code_verifier")) != g.challenge {
+		tokenError(w, "invalid_grant")
+		return
+	}
+
+	claims := jwt.MapClaims{}
+	for k, v := range g.claims {
+		claims[k] = v
+	}
+	claims["nonce"] = g.nonce
+	writeJSON(w, http.StatusOK, map[string]any{
+		"access_token": "mock-access-token",
+		"token_type":   "Bearer",
+		"expires_in":   3600,
+		"id_token":     s.IDToken(claims),
+	})
+}
+
+func (s *Server) jwks(w http.ResponseWriter, r *http.Request) {
+	pub := s.key.PublicKey
+	writeJSON(w, http.StatusOK, map[string]any{"keys": []map[string]string{{
+		"kty": "RSA",
+		"kid": s.keyID,
+		"use": "sig",
+		"alg": "RS256",
+		"n":   base64.RawURLEncoding.EncodeToString(pub.N.Bytes()),
+		"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(pub.E)).Bytes()),
+	}}})
+}
+
+// IDToken signs claims with the provider key, filling in iss, aud, iat and
+// exp unless claims sets them. Tests use it to forge tokens the provider
+// would not issue.
+func (s *Server) IDToken(claims jwt.MapClaims) string {
+	now := time.Now()
+	defaults := jwt.MapClaims{
+		"iss": s.URL,
+		"aud": s.ClientID,
+		"iat": now.Unix(),
+		"exp": now.Add(5 * time.Minute).Unix(),
+	}
+	for k, v := range defaults {
+		if _, set := claims[k]; !set {
+			claims[k] = v
+		}
+	}
+	tok := jwt.NewWithClaims(jwt.SigningMethodRS256, claims)
+	tok.Header["kid"] = s.keyID
+	signed, err := tok.SignedString(s.key)
+	if err != nil {
+		panic(err)
+	}
+	return signed
+}
+
+func tokenError(w http.ResponseWriter, code string) {
+	writeJSON(w, http.StatusBadRequest, map[string]string{"error": code})
+}
+
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(v)
+}
@@ -0,0 +1,287 @@
+// Package search extracts plain text from documents and turns it into the
+// keyed terms stored in the full-text index.
+package search
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/xml"
+	"errors"
+	"io"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"unicode/utf8"
+)
+
+// MaxSourceBytes is the largest document, in plaintext bytes, that is read
+// for indexing. Bigger files are searchable by name only.
+const MaxSourceBytes = 32 * 1024 * 1024
+
+// MaxTextBytes caps the text taken from one document.
+const MaxTextBytes = 4 * 1024 * 1024
+
+// ErrUnsupported is returned by Extract for formats it cannot read.
+var ErrUnsupported = errors.New("search: unsupported document format")
+
+// extractors maps the document formats of storage.ShouldDedup that can be
+// read without external tools. The legacy binary Office formats (.doc, .xls,
+// .ppt) are left out.
+var extractors = map[string]func([]byte) (string, error){
+	".txt":  plainText,
+	".md":   plainText,
+	".csv":  plainText,
+	".log":  plainText,
+	".json": plainText,
+	".rtf":  rtfText,
+	".html": markupText,
+	".htm":  markupText,
+	".xml":  markupText,
+	".pdf":  pdfText,
+	".docx": zipText("word/document.xml", "word/header*.xml", "word/footer*.xml", "word/footnotes.xml"),
+	".xlsx": zipText("xl/sharedStrings.xml", "xl/worksheets/sheet*.xml"),
+	".pptx": zipText("ppt/slides/slide*.xml", "ppt/notesSlides/notesSlide*.xml"),
+	".odt":  zipText("content.xml"),
+	".ods":  zipText("content.xml"),
+	".odp":  zipText("content.xml"),
+}
+
+// Extensions returns the file extensions Extract can read, sorted.
+func Extensions() []string {
+	exts := make([]string, 0, len(extractors))
+	for ext := range extractors {
+		exts = append(exts, ext)
+	}
+	sort.Strings(exts)
+	return exts
+}
+
+// Supported reports whether Extract can read a file with the given name.
+func Supported(fileName string) bool {
+	_, ok := extractors[strings.ToLower(filepath.Ext(fileName))]
+	return ok
+}
+
+// Extract returns the text of a document, choosing the parser by the file
+// name's extension. The result is valid UTF-8 and at most MaxTextBytes long.
+func Extract(fileName string, data []byte) (string, error) {
+	fn, ok := extractors[strings.ToLower(filepath.Ext(fileName))]
+	if !ok {
+		return "", ErrUnsupported
+	}
+	text, err := fn(data)
+	if err != nil {
+		return "", err
+	}
+	return truncateUTF8(strings.ToValidUTF8(text, " "), MaxTextBytes), nil
+}
+
+func truncateUTF8(s string, n int) string {
+	if len(s) <= n {
+		return s
+	}
+	for n > 0 && !utf8.RuneStart(s[n]) {
+		n--
+	}
+	return s[:n]
+}
+
+func plainText(data []byte) (string, error) {
+	data = bytes.TrimPrefix(data, []byte("\xef\xbb\xbf"))
+	if bytes.IndexByte(data, 0) >= 0 {
+		// UTF-16 or a binary file with a text extension.
+		return "", ErrUnsupported
+	}
+	return string(data), nil
+}
+
+// markupText returns the character data of an HTML or XML document. The
+// decoder runs in non-strict mode so ordinary HTML parses.
+func markupText(data []byte) (string, error) {
+	d := xml.NewDecoder(bytes.NewReader(data))
+	d.Strict = false
+	d.AutoClose = xml.HTMLAutoClose
+	d.Entity = xml.HTMLEntity
+	return collectText(d, map[string]bool{"script": true, "style": true})
+}
+
+// collectText concatenates the character data of an XML stream, separating
+// elements with spaces. Content inside elements named in skip is dropped.
+func collectText(d *xml.Decoder, skip map[string]bool) (string, error) {
+	var b strings.Builder
+	skipDepth := 0
+	for b.Len() < MaxTextBytes {
+		tok, err := d.Token()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			// Keep what was read before the document turned malformed.
+			if b.Len() > 0 {
+				break
+			}
+			return "", err
+		}
+		switch t := tok.(type) {
+		case xml.StartElement:
+			if skipDepth > 0 || skip[strings.ToLower(t.Name.Local)] {
+				skipDepth++
+			}
+		case xml.EndElement:
+			if skipDepth > 0 {
+				skipDepth--
+			}
+			b.WriteByte(' ')
+		case xml.CharData:
+			if skipDepth == 0 {
+				b.Write(t)
+			}
+		}
+	}
+	return b.String(), nil
+}
+
+// zipText reads the XML parts of an Office Open XML or OpenDocument file
+// that match the given patterns, in pattern order.
+func zipText(patterns ...string) func([]byte) (string, error) {
+	return func(data []byte) (string, error) {
+		zr, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+		if err != nil {
+			return "", err
+		}
+		var b strings.Builder
+		for _, pattern := range patterns {
+			var names []string
+			for _, f := range zr.File {
+				if ok, _ := path.Match(pattern, f.Name); ok {
+					names = append(names, f.Name)
+				}
+			}
+			sort.Strings(names)
+			for _, name := range names {
+				if b.Len() >= MaxTextBytes {
+					return b.String(), nil
+				}
+				text, err := zipPartText(zr, name)
+				if err != nil {
+					return "", err
+				}
+				b.WriteString(text)
+				b.WriteByte('\n')
+			}
+		}
+		return b.String(), nil
+	}
+}
+
+func zipPartText(zr *zip.Reader, name string) (string, error) {
+	f, err := zr.Open(name)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	// Bound the inflated size so a crafted archive cannot exhaust memory.
+	return collectText(xml.NewDecoder(io.LimitReader(f, MaxSourceBytes)), nil)
+}
+
+// rtfDestinations are RTF groups that hold formatting tables or metadata
+// rather than document text.
+var rtfDestinations = map[string]bool{
+	"fonttbl": true, "colortbl": true, "stylesheet": true, "info": true,
+	"pict": true, "header": true, "footer": true, "listtable": true,
+}
+
+// rtfText strips RTF control words and skips non-text groups, keeping the
+// text runs. It does not interpret code pages; \'xx escapes are read as
+// Latin-1.
+func rtfText(data []byte) (string, error) {
+	var b strings.Builder
+	depth, skipFrom := 0, 0 // skipFrom > 0: skipping the group opened at that depth
+	for i := 0; i < len(data); i++ {
+		c := data[i]
+		switch c {
+		case '{':
+			depth++
+			continue
+		case '}':
+			if skipFrom == depth {
+				skipFrom = 0
+			}
+			depth--
+			continue
+		case '\r', '\n':
+			continue
+		}
+		if c != '\\' {
+			if skipFrom == 0 {
+				b.WriteByte(c)
+			}
+			continue
+		}
+
+		i++
+		if i >= len(data) {
+			break
+		}
+		switch n := data[i]; {
+		case n == '*':
+			// {\* ...} marks an optional destination the reader may ignore.
+			if skipFrom == 0 {
+				skipFrom = depth
+			}
+		case n == '\'' && i+2 < len(data):
+			if v, ok := unhex(data[i+1], data[i+2]); ok && skipFrom == 0 {
+				b.WriteRune(rune(v))
+			}
+			i += 2
+		case n == '\\' || n == '{' || n == '}':
+			if skipFrom == 0 {
+				b.WriteByte(n)
+			}
+		case isASCIILetter(n):
+			start := i
+			for i < len(data) && isASCIILetter(data[i]) {
+				i++
+			}
+			word := string(data[start:i])
+			for i < len(data) && (data[i] == '-' || data[i] >= '0' && data[i] <= '9') {
+				i++
+			}
+			if i < len(data) && data[i] != ' ' {
+				i-- // not a delimiter: read it again
+			}
+			switch {
+			case rtfDestinations[word] && skipFrom == 0:
+				skipFrom = depth
+			case word == "par" || word == "line" || word == "tab" || word == "cell":
+				if skipFrom == 0 {
+					b.WriteByte(' ')
+				}
+			}
+		}
+	}
+	return b.String(), nil
+}
+
+func isASCIILetter(c byte) bool {
+	return c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z'
+}
+
+func unhex(hi, lo byte) (byte, bool) {
+	h, ok1 := hexVal(hi)
+	l, ok2 := hexVal(lo)
+	return h<<4 | l, ok1 && ok2
+}
+
+func hexVal(c byte) (byte, bool) {
+	switch {
+	case c >= '0' && c <= '9':
+		return c - '0', true
+	case c >= 'a' && c <= 'f':
+		return c - 'a' + 10, true
+	case c >= 'A' && c <= 'F':
+		return c - 'A' + 10, true
+	}
+	return 0, false
+}
@@ -0,0 +1,200 @@
+package search
+
+import (
+	"bytes"
+	"compress/zlib"
+	"io"
+	"strings"
+)
+
+// maxPDFStreamBytes bounds one inflated PDF stream.
+const maxPDFStreamBytes = 16 * 1024 * 1024
+
+// pdfText pulls the strings shown by text operators (Tj, TJ, ' and ") out of
+// a PDF's content streams. It handles uncompressed and FlateDecode streams
+// and single-byte font encodings, which covers documents exported by office
+// suites and most generators. Text drawn with CID fonts, or in object
+// streams, is not recovered; such files stay searchable by name.
+func pdfText(data []byte) (string, error) {
+	if !bytes.HasPrefix(bytes.TrimLeft(data, "\x00\t\r\n "), []byte("%PDF-")) {
+		return "", ErrUnsupported
+	}
+	var b strings.Builder
+	rest := data
+	for b.Len() < MaxTextBytes {
+		i := bytes.Index(rest, []byte("stream"))
+		if i < 0 {
+			break
+		}
+		// Skip "endstream" and the keyword's end-of-line marker.
+		if i >= 3 && bytes.Equal(rest[i-3:i], []byte("end")) {
+			rest = rest[i+len("stream"):]
+			continue
+		}
+		dict := rest[:i]
+		if j := bytes.LastIndex(dict, []byte("obj")); j >= 0 {
+			dict = dict[j:]
+		}
+		body := rest[i+len("stream"):]
+		body = bytes.TrimPrefix(body, []byte("\r"))
+		body = bytes.TrimPrefix(body, []byte("\n"))
+		end := bytes.Index(body, []byte("endstream"))
+		if end < 0 {
+			break
+		}
+		stream := body[:end]
+		rest = body[end+len("endstream"):]
+
+		if bytes.Contains(dict, []byte("/Subtype/Image")) || bytes.Contains(dict, []byte("/Subtype /Image")) {
+			continue
+		}
+		if bytes.Contains(dict, []byte("/FlateDecode")) {
+			zr, err := zlib.NewReader(bytes.NewReader(stream))
+			if err != nil {
+				continue
+			}
+			inflated, err := io.ReadAll(io.LimitReader(zr, maxPDFStreamBytes))
+			zr.Close()
+			if err != nil && len(inflated) == 0 {
+				continue
+			}
+			stream = inflated
+		} else if bytes.Contains(dict, []byte("/Filter")) {
+			continue // other encodings (DCT, LZW, ...) are not text
+		}
+		if !bytes.Contains(stream, []byte("BT")) {
+			continue
+		}
+		pdfContentText(stream, &b)
+	}
+	return b.String(), nil
+}
+
+// pdfContentText scans one content stream. Operands are collected until an
+// operator is seen; text-showing operators write their string operands, and
+// positioning operators start a new word.
+func pdfContentText(s []byte, b *strings.Builder) {
+	var pending []string
+	for i := 0; i < len(s); {
+		c := s[i]
+		switch {
+		case c == '(':
+			str, n := pdfLiteralString(s[i:])
+			pending = append(pending, str)
+			i += n
+		case c == '<' && i+1 < len(s) && s[i+1] != '<':
+			end := bytes.IndexByte(s[i:], '>')
+			if end < 0 {
+				return
+			}
+			pending = append(pending, pdfHexString(s[i+1:i+end]))
+			i += end + 1
+		case c == '/':
+			// A name operand such as a font resource; not an operator.
+			i++
+			for i < len(s) && !bytes.ContainsRune([]byte(" \t\r\n/[]()<>{}%"), rune(s[i])) {
+				i++
+			}
+		case c == '%':
+			for i < len(s) && s[i] != '\n' && s[i] != '\r' {
+				i++
+			}
+		case isASCIILetter(c) || c == '\'' || c == '"' || c == '*':
+			start := i
+			for i < len(s) && (isASCIILetter(s[i]) || s[i] == '\'' || s[i] == '"' || s[i] == '*') {
+				i++
+			}
+			switch string(s[start:i]) {
+			case "Tj", "TJ", "'", "\"":
+				for _, p := range pending {
+					b.WriteString(p)
+				}
+			case "Td", "TD", "T*", "Tm", "ET":
+				b.WriteByte(' ')
+			}
+			pending = pending[:0]
+		default:
+			i++
+		}
+	}
+}
+
+// pdfLiteralString decodes the "( ... )" string at the start of s and returns
+// it with the number of bytes consumed.
+func pdfLiteralString(s []byte) (string, int) {
+	var out []byte
+	depth := 0
+	i := 0
+	for ; i < len(s); i++ {
+		c := s[i]
+		switch c {
+		case '(':
+			depth++
+			if depth == 1 {
+				continue
+			}
+		case ')':
+			depth--
+			if depth == 0 {
+				return latin1(out), i + 1
+			}
+		case '\\':
+			i++
+			if i >= len(s) {
+				return latin1(out), i
+			}
+			switch e := s[i]; e {
+			case 'n', 'r', 't':
+				out = append(out, ' ')
+			case 'b', 'f':
+			case '\r', '\n':
+				// line continuation
+			default:
+				if e >= '0' && e <= '7' {
+					v, n := 0, 0
+					for n < 3 && i < len(s) && s[i] >= '0' && s[i] <= '7' {
+						v = v*8 + int(s[i]-'0')
+						i++
+						n++
+					}
+					i--
+					out = append(out, byte(v))
+				} else {
+					out = append(out, e)
+				}
+			}
+			continue
+		}
+		out = append(out, c)
+	}
+	return latin1(out), i
+}
+
+func pdfHexString(s []byte) string {
+	var digits []byte
+	for _, c := range s {
+		if _, ok := hexVal(c); ok {
+			digits = append(digits, c)
+		}
+	}
+	if len(digits)%2 == 1 {
+		digits = append(digits, '0')
+	}
+	out := make([]byte, 0, len(digits)/2)
+	for i := 0; i < len(digits); i += 2 {
+		v, _ := unhex(digits[i], digits[i+1])
+		out = append(out, v)
+	}
+	return latin1(out)
+}
+
+// latin1 maps single-byte PDF text to UTF-8, approximating WinAnsi and
+// PDFDoc encodings by Latin-1.
+func latin1(b []byte) string {
+	var sb strings.Builder
+	sb.Grow(len(b))
+	for _, c := range b {
+		sb.WriteRune(rune(c))
+	}
+	return sb.String()
+}
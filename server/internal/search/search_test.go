@@ -0,0 +1,124 @@
+package search
+
+import (
+	"archive/zip"
+	"bytes"
+	"compress/zlib"
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func upperToken(s string) string { return strings.ToUpper(s) }
+
+func TestTerms(t *testing.T) {
+	got := Terms("Quarterly-Report 2024: Ünïcode, a b ok!")
+	want := []string{"quarterly", "report", "2024", "ünïcode", "ok"}
+	if strings.Join(got, "|") != strings.Join(want, "|") {
+		t.Errorf("Terms = %q, want %q", got, want)
+	}
+}
+
+func TestTSVector(t *testing.T) {
+	got := TSVector("beta alpha beta", upperToken)
+	if want := "'ALPHA':2 'BETA':1,3"; got != want {
+		t.Errorf("TSVector = %q, want %q", got, want)
+	}
+	if got := TSVector("", upperToken); got != "" {
+		t.Errorf("TSVector(\"\") = %q", got)
+	}
+
+	// Positions clamp at the Postgres maximum without repeating.
+	long := strings.Repeat("word ", maxPosition+10)
+	v := TSVector(long, upperToken)
+	if n := strings.Count(v, ","); n != maxPositionsPerTerm-1 {
+		t.Errorf("got %d positions, want %d", n+1, maxPositionsPerTerm)
+	}
+}
+
+func TestTSQuery(t *testing.T) {
+	if got, want := TSQuery("Invoice march invoice", upperToken), "'INVOICE' & 'MARCH'"; got != want {
+		t.Errorf("TSQuery = %q, want %q", got, want)
+	}
+	if got := TSQuery("a !", upperToken); got != "" {
+		t.Errorf("TSQuery without terms = %q", got)
+	}
+}
+
+func TestExtractPlainAndMarkup(t *testing.T) {
+	cases := []struct {
+		name, body, want string
+	}{
+		{"notes.md", "\xef\xbb\xbf# Budget", "# Budget"},
+		{"page.html", `<html><head><style>p{}</style><script>var x;</script></head><body><p>Hello<br>world &amp; more</p></body></html>`, "Hello world & more"},
+		{"data.xml", `<?xml version="1.0"?><a><b>one</b><c>two</c></a>`, "one two"},
+		{"doc.rtf", `{\rtf1\ansi{\fonttbl{\f0 Arial;}}{\*\generator Writer;}\f0 Caf\'e9 menu\par Second line}`, "Café menu Second line"},
+	}
+	for _, c := range cases {
+		got, err := Extract(c.name, []byte(c.body))
+		if err != nil {
+			t.Errorf("%s: %v", c.name, err)
+			continue
+		}
+		if strings.Join(strings.Fields(got), " ") != c.want {
+			t.Errorf("%s: got %q, want %q", c.name, got, c.want)
+		}
+	}
+
+	if _, err := Extract("utf16.txt", []byte("h\x00i\x00")); err != ErrUnsupported {
+		t.Errorf("binary .txt: err = %v, want ErrUnsupported", err)
+	}
+	if _, err := Extract("legacy.doc", []byte("x")); err != ErrUnsupported {
+		t.Errorf(".doc: err = %v, want ErrUnsupported", err)
+	}
+}
+
+func TestExtractDocx(t *testing.T) {
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	for name, body := range map[string]string{
+		"[Content_Types].xml": `<Types/>`,
+		"word/document.xml":   `<w:document xmlns:w="w"><w:body><w:p><w:r><w:t>Project</w:t></w:r><w:r><w:t>Zephyr</w:t></w:r></w:p></w:body></w:document>`,
+		"word/footer1.xml":    `<w:ftr xmlns:w="w"><w:p><w:r><w:t>Confidential</w:t></w:r></w:p></w:ftr>`,
+	} {
+		f, _ := zw.Create(name)
+		f.Write([]byte(body))
+	}
+	zw.Close()
+
+	got, err := Extract("plan.DOCX", buf.Bytes())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Join(strings.Fields(got), " ") != "Project Zephyr Confidential" {
+		t.Errorf("docx text = %q", got)
+	}
+}
+
+func TestExtractPDF(t *testing.T) {
+	plain := "BT /F1 12 Tf 72 712 Td (Hello \\(PDF\\)) Tj 0 -14 Td [(Wor) -20 (ld)] TJ ET"
+	var z bytes.Buffer
+	zw := zlib.NewWriter(&z)
+	zw.Write([]byte("BT /F1 12 Tf <436f6d7072657373> Tj ET"))
+	zw.Close()
+
+	var pdf bytes.Buffer
+	pdf.WriteString("%PDF-1.4\n")
+	fmt.Fprintf(&pdf, "4 0 obj\n<< /Length %d >>\nstream\n%s\nendstream\nendobj\n", len(plain), plain)
+	fmt.Fprintf(&pdf, "5 0 obj\n<< /Length %d /Filter /FlateDecode >>\nstream\n", z.Len())
+	pdf.Write(z.Bytes())
+	pdf.WriteString("\nendstream\nendobj\n")
+	pdf.WriteString("6 0 obj\n<< /Subtype /Image /Length 4 >>\nstream\nBT()\nendstream\nendobj\n%%EOF\n")
+
+	got, err := Extract("report.pdf", pdf.Bytes())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "Hello (PDF) World Compress"; strings.Join(strings.Fields(got), " ") != want {
+		t.Errorf("pdf text = %q, want %q", got, want)
+	}
+
+	if _, err := Extract("fake.pdf", []byte("not a pdf")); err != ErrUnsupported {
+		t.Errorf("non-PDF: err = %v, want ErrUnsupported", err)
+	}
+}
@@ -0,0 +1,102 @@
+package search
+
+import (
+	"sort"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// Term limits. Terms are normalised words: lower-cased runs of letters and
+// digits. Single characters carry no meaning on their own and overly long
+// runs are usually encoded data, so both are dropped.
+const (
+	minTermRunes = 2
+	maxTermRunes = 64
+)
+
+// Postgres tsvector limits: positions above 16383 are clamped, a lexeme keeps
+// at most 256 positions, and a whole tsvector must stay below 1 MiB.
+const (
+	maxPosition         = 16383
+	maxPositionsPerTerm = 256
+	maxDistinctTerms    = 20000
+)
+
+// Terms splits text into search terms in document order.
+func Terms(text string) []string {
+	var terms []string
+	for _, f := range strings.FieldsFunc(text, func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsNumber(r)
+	}) {
+		n := len([]rune(f))
+		if n < minTermRunes || n > maxTermRunes {
+			continue
+		}
+		terms = append(terms, strings.ToLower(f))
+	}
+	return terms
+}
+
+// TSVector builds a tsvector literal from text in which every term is
+// replaced by token(term). Positions are kept so ts_rank can weigh how often
+// and how early a term appears. token must return strings without quotes or
+// backslashes (hex digests do).
+func TSVector(text string, token func(string) string) string {
+	positions := make(map[string][]int)
+	pos := 0
+	for _, term := range Terms(text) {
+		if pos < maxPosition {
+			pos++
+		}
+		tok := token(term)
+		p, seen := positions[tok]
+		if !seen && len(positions) >= maxDistinctTerms {
+			continue
+		}
+		if len(p) >= maxPositionsPerTerm || len(p) > 0 && p[len(p)-1] == pos {
+			continue
+		}
+		positions[tok] = append(p, pos)
+	}
+
+	toks := make([]string, 0, len(positions))
+	for tok := range positions {
+		toks = append(toks, tok)
+	}
+	sort.Strings(toks)
+
+	var b strings.Builder
+	for i, tok := range toks {
+		if i > 0 {
+			b.WriteByte(' ')
+		}
+		b.WriteByte('\'')
+		b.WriteString(tok)
+		b.WriteString("':")
+		for j, p := range positions[tok] {
+			if j > 0 {
+				b.WriteByte(',')
+			}
+			b.WriteString(strconv.Itoa(p))
+		}
+	}
+	return b.String()
+}
+
+// TSQuery builds a tsquery literal matching documents that contain every
+// term of query, each replaced by token(term). It returns "" when query has
+// no terms.
+func TSQuery(query string, token func(string) string) string {
+	seen := make(map[string]bool)
+	var parts []string
+	for _, term := range Terms(query) {
+		tok := token(term)
+		if seen[tok] {
+			continue
+		}
+		seen[tok] = true
+		parts = append(parts, "'"+tok+"'")
+	}
+	return strings.Join(parts, " & ")
+}
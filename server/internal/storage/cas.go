@@ -1,43 +1,46 @@
 // Package storage — Content Addressable Storage (CAS)
 //
-// Blobs are stored at:
+// Blobs are stored in the configured Backend at:
 //
-//	{root}/blobs/{sha256[0:2]}/{sha256[2:4]}/{sha256}
+//	blobs/{id[0:2]}/{id[2:4]}/{id}
 //
-// Deduplication guarantee: only one goroutine may write a new blob for a given
-// sha256 at a time. A sync.Map of per-hash mutexes (one entry per active hash)
-// provides O(1) lock acquisition without serialising writes to different hashes.
+// The blob ID is chosen by the caller. Handlers use a keyed digest of the
+// plaintext (see crypto.DeriveContentKeys), so the ID reveals nothing about the
+// content to anyone without the master key, and identical uploads from
+// different users or spaces map to the same blob.
 //
-// Concurrent uploads of the same file:
-//  1. Both goroutines stream to separate temp files while hashing.
-//  2. The first to acquire the hash lock checks os.Stat → not found → renames
-//     temp → blob path.  Dedup miss; IsNew = true.
-//  3. The second acquires the lock, checks os.Stat → found → removes its temp
-//     file.  Dedup hit; IsNew = false.
+// Deduplication guarantee: only one goroutine may write a given blob ID at a
+// time. A sync.Map of per-ID mutexes (one entry per active ID) provides O(1)
+// lock acquisition without serialising writes to different blobs.
 //
-// This means the first concurrent duplicate incurs a disk write; all subsequent
-// duplicates are zero-disk-write dedup hits.
+// Concurrent uploads of the same content:
+//  1. The first goroutine to acquire the ID lock checks Exists → not found →
+//     streams the encrypted blob to the backend.  Dedup miss; IsNew = true.
+//  2. The second acquires the lock, checks Exists → found → writes nothing.
+//     Dedup hit; IsNew = false.
+//
+// Reference counting lives in the database (the blobs table); CAS only deals
+// with bytes. Because blob content is fully determined by its ID, a duplicate
+// write from a second process is harmless: it stores identical bytes.
 
 package storage
 
 import (
-	"crypto/sha256"
 	"encoding/hex"
 	"fmt"
 	"io"
-	"os"
-	"path/filepath"
+	"path"
 	"sync"
 	"sync/atomic"
 )
 
-// CAS is a content-addressable blob store backed by the local filesystem.
+// CAS is a content-addressable blob store layered on a Backend.
 type CAS struct {
-	root string
-	mu   sync.Map // map[string]*hashEntry — one entry per sha256 hash currently being written
+	backend Backend
+	mu      sync.Map // map[string]*hashEntry — one entry per blob ID currently locked
 }
 
-// hashEntry pairs a mutex with a reference count for the per-hash lock pool.
+// hashEntry pairs a mutex with a reference count for the per-ID lock pool.
 // When refs drops to zero the entry is removed from the sync.Map to prevent
 // unbounded memory growth over the lifetime of the process.
 type hashEntry struct {
@@ -45,93 +48,64 @@ type hashEntry struct {
 	refs int32
 }
 
-// NewCAS creates a CAS rooted at root, creating the directory if needed.
-func NewCAS(root string) (*CAS, error) {
-	if err := os.MkdirAll(root, 0o750); err != nil {
-		return nil, fmt.Errorf("create CAS root %q: %w", root, err)
-	}
-	absRoot, err := filepath.Abs(root)
-	if err != nil {
-		return nil, fmt.Errorf("resolve CAS root: %w", err)
-	}
-	return &CAS{root: absRoot}, nil
+// NewCAS creates a CAS that stores blobs in backend.
+func NewCAS(backend Backend) *CAS {
+	return &CAS{backend: backend}
 }
 
 // PutResult is returned by CAS.Put.
 type PutResult struct {
-	SHA256   string // hex-encoded SHA-256 of the blob
-	Size     int64  // total bytes received from the caller
-	IsNew    bool   // true = new blob written; false = dedup hit (no disk write)
-	BlobPath string // relative blob path: "blobs/{ab}/{cd}/{sha256}"
+	ID       string // blob ID (64 lowercase hex digits)
+	Size     int64  // bytes written to the backend; 0 on a dedup hit
+	IsNew    bool   // true = new blob written; false = dedup hit (no write)
+	BlobPath string // backend path: "blobs/{ab}/{cd}/{id}"
 }
 
-// Put streams r through a SHA-256 hasher and either stores a new blob or
-// returns a dedup hit if an identical blob already exists.
-//
-// The entire reader is always consumed — this is required to produce the
-// correct hash and to not leave the connection in an undefined state.
-//
-// Put is safe to call from multiple goroutines with the same or different data.
-func (c *CAS) Put(r io.Reader) (PutResult, error) {
-	// ── Phase 1: stream to a random temp file while hashing ──────────────────
-	tmpDir := filepath.Join(c.root, ".tmp")
-	if err := os.MkdirAll(tmpDir, 0o750); err != nil {
-		return PutResult{}, fmt.Errorf("cas: mkdir tmp: %w", err)
-	}
+// BlobPath returns the backend path for a blob ID.
+func BlobPath(id string) string {
+	return path.Join("blobs", id[0:2], id[2:4], id)
+}
 
-	tmp, err := os.CreateTemp(tmpDir, ".cas-*")
-	if err != nil {
-		return PutResult{}, fmt.Errorf("cas: create tmp: %w", err)
+// Put stores the blob for id unless it already exists. write is only called
+// on a dedup miss and must stream the complete blob into w.
+//
+// Put is safe to call from multiple goroutines with the same or different IDs.
+func (c *CAS) Put(id string, write func(w io.Writer) error) (PutResult, error) {
+	if !isValidSHA256Hex(id) {
+		return PutResult{}, fmt.Errorf("cas: invalid blob id %q", id)
 	}
-	tmpPath := tmp.Name()
+	blobPath := BlobPath(id)
 
-	hasher := sha256.New()
-	buf := make([]byte, 512*1024) // 512 KB — matches local.go for consistent syscall overhead
-	n, werr := io.CopyBuffer(tmp, io.TeeReader(r, hasher), buf)
-	cerr := tmp.Close()
+	unlock := c.lockHash(id)
+	defer unlock()
 
-	if werr != nil {
-		os.Remove(tmpPath) //nolint:errcheck
-		return PutResult{}, fmt.Errorf("cas: stream: %w", werr)
+	exists, err := c.backend.Exists(blobPath)
+	if err != nil {
+		return PutResult{}, fmt.Errorf("cas: stat blob: %w", err)
 	}
-	if cerr != nil {
-		os.Remove(tmpPath) //nolint:errcheck
-		return PutResult{}, fmt.Errorf("cas: flush: %w", cerr)
+	if exists {
+		return PutResult{ID: id, IsNew: false, BlobPath: blobPath}, nil
 	}
 
-	sha256hex := hex.EncodeToString(hasher.Sum(nil))
-	blobRel := filepath.Join("blobs", sha256hex[0:2], sha256hex[2:4], sha256hex)
-	blobAbs := filepath.Join(c.root, blobRel)
+	pr, pw := io.Pipe()
+	writeErrCh := make(chan error, 1)
+	go func() {
+		err := write(pw)
+		pw.CloseWithError(err) // nil closes cleanly
+		writeErrCh <- err
+	}()
 
-	// ── Phase 2: acquire hash-level lock, check + commit ─────────────────────
-	unlock := c.lockHash(sha256hex)
-	defer unlock()
-
-	if _, statErr := os.Stat(blobAbs); statErr == nil {
-		// Dedup hit — blob already exists; discard the temp file.
-		os.Remove(tmpPath) //nolint:errcheck
-		return PutResult{SHA256: sha256hex, Size: n, IsNew: false, BlobPath: blobRel}, nil
-	} else if !os.IsNotExist(statErr) {
-		// Unexpected error (permission denied, I/O error) — surface it.
-		os.Remove(tmpPath) //nolint:errcheck
-		return PutResult{}, fmt.Errorf("cas: stat blob: %w", statErr)
-	}
-
-	// New blob — move temp file into its canonical location.
-	if err := os.MkdirAll(filepath.Dir(blobAbs), 0o750); err != nil {
-		os.Remove(tmpPath) //nolint:errcheck
-		return PutResult{}, fmt.Errorf("cas: mkdir blob dir: %w", err)
+	n, storeErr := c.backend.Write(blobPath, pr)
+	pr.CloseWithError(io.ErrClosedPipe) // unblock the producer if the backend bailed early
+	if writeErr := <-writeErrCh; writeErr != nil {
+		_ = c.backend.Delete(blobPath)
+		return PutResult{}, fmt.Errorf("cas: produce blob: %w", writeErr)
 	}
-	if err := os.Chmod(tmpPath, 0o400); err != nil { // blobs are read-only
-		os.Remove(tmpPath) //nolint:errcheck
-		return PutResult{}, fmt.Errorf("cas: chmod: %w", err)
-	}
-	if err := os.Rename(tmpPath, blobAbs); err != nil {
-		os.Remove(tmpPath) //nolint:errcheck
-		return PutResult{}, fmt.Errorf("cas: rename: %w", err)
+	if storeErr != nil {
+		return PutResult{}, fmt.Errorf("cas: store blob: %w", storeErr)
 	}
 
-	return PutResult{SHA256: sha256hex, Size: n, IsNew: true, BlobPath: blobRel}, nil
+	return PutResult{ID: id, Size: n, IsNew: true, BlobPath: blobPath}, nil
 }
 
 // isValidSHA256Hex reports whether s is exactly 64 lowercase hex digits.
@@ -143,48 +117,47 @@ func isValidSHA256Hex(s string) bool {
 	return err == nil
 }
 
-// Exists reports whether a blob with the given sha256 hex string is stored.
-func (c *CAS) Exists(sha256hex string) bool {
-	if !isValidSHA256Hex(sha256hex) {
-		return false
+// Exists reports whether a blob with the given ID is stored.
+func (c *CAS) Exists(id string) (bool, error) {
+	if !isValidSHA256Hex(id) {
+		return false, nil
 	}
-	blobAbs := filepath.Join(c.root, "blobs", sha256hex[0:2], sha256hex[2:4], sha256hex)
-	_, err := os.Stat(blobAbs)
-	return err == nil
+	return c.backend.Exists(BlobPath(id))
 }
 
 // Read opens a blob for streaming. Caller must close the returned ReadCloser.
-func (c *CAS) Read(sha256hex string) (io.ReadCloser, int64, error) {
-	if !isValidSHA256Hex(sha256hex) {
-		return nil, 0, fmt.Errorf("cas: invalid sha256 hex %q", sha256hex)
+func (c *CAS) Read(id string) (io.ReadCloser, int64, error) {
+	if !isValidSHA256Hex(id) {
+		return nil, 0, fmt.Errorf("cas: invalid blob id %q", id)
 	}
-	blobAbs := filepath.Join(c.root, "blobs", sha256hex[0:2], sha256hex[2:4], sha256hex)
-	f, err := os.Open(blobAbs) // #nosec G304 -- path constructed from validated sha256hex only
-	if err != nil {
-		return nil, 0, err
-	}
-	info, err := f.Stat()
-	if err != nil {
-		f.Close()
-		return nil, 0, err
+	return c.backend.Read(BlobPath(id))
+}
+
+// Delete removes a blob. It takes the per-ID lock so a concurrent Put for the
+// same ID either completes before the delete or starts after it.
+func (c *CAS) Delete(id string) error {
+	if !isValidSHA256Hex(id) {
+		return fmt.Errorf("cas: invalid blob id %q", id)
 	}
-	return f, info.Size(), nil
+	unlock := c.lockHash(id)
+	defer unlock()
+	return c.backend.Delete(BlobPath(id))
 }
 
-// lockHash acquires a per-hash mutex and returns an unlock function.
+// lockHash acquires a per-ID mutex and returns an unlock function.
 // Entries are reference-counted and removed from the sync.Map when refs reaches
 // zero, preventing unbounded memory growth over the life of the process.
-func (c *CAS) lockHash(sha256hex string) (unlock func()) {
+func (c *CAS) lockHash(id string) (unlock func()) {
 	// Atomically get or create the entry and increment its refcount before
 	// locking so the entry is never deleted while another goroutine holds it.
-	v, _ := c.mu.LoadOrStore(sha256hex, &hashEntry{})
+	v, _ := c.mu.LoadOrStore(id, &hashEntry{})
 	e := v.(*hashEntry)
 	atomic.AddInt32(&e.refs, 1)
 	e.mu.Lock()
 	return func() {
 		e.mu.Unlock()
 		if atomic.AddInt32(&e.refs, -1) == 0 {
-			c.mu.CompareAndDelete(sha256hex, e)
+			c.mu.CompareAndDelete(id, e)
 		}
 	}
 }
@@ -0,0 +1,115 @@
+package storage
+
+import (
+	"errors"
+	"io"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+)
+
+const testBlobID = "ab12cd34ef56ab12cd34ef56ab12cd34ef56ab12cd34ef56ab12cd34ef56ab12"
+
+func TestCAS_PutDedup(t *testing.T) {
+	cas := NewCAS(tempBackend(t))
+
+	var calls int32
+	write := func(w io.Writer) error {
+		atomic.AddInt32(&calls, 1)
+		_, err := io.WriteString(w, "ciphertext")
+		return err
+	}
+
+	first, err := cas.Put(testBlobID, write)
+	if err != nil {
+		t.Fatalf("Put: %v", err)
+	}
+	if !first.IsNew || first.Size != int64(len("ciphertext")) {
+		t.Errorf("first Put = %+v, want new blob", first)
+	}
+	if first.BlobPath != "blobs/ab/12/"+testBlobID {
+		t.Errorf("unexpected blob path %q", first.BlobPath)
+	}
+
+	second, err := cas.Put(testBlobID, write)
+	if err != nil {
+		t.Fatalf("Put (dup): %v", err)
+	}
+	if second.IsNew {
+		t.Error("second Put should be a dedup hit")
+	}
+	if calls != 1 {
+		t.Errorf("write called %d times, want 1", calls)
+	}
+
+	rc, size, err := cas.Read(testBlobID)
+	if err != nil {
+		t.Fatalf("Read: %v", err)
+	}
+	defer rc.Close()
+	got, _ := io.ReadAll(rc)
+	if string(got) != "ciphertext" || size != int64(len(got)) {
+		t.Errorf("Read = %q (%d)", got, size)
+	}
+}
+
+func TestCAS_PutConcurrentSameID(t *testing.T) {
+	cas := NewCAS(tempBackend(t))
+
+	var calls int32
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, err := cas.Put(testBlobID, func(w io.Writer) error {
+				atomic.AddInt32(&calls, 1)
+				_, err := io.Copy(w, strings.NewReader(strings.Repeat("x", 1<<16)))
+				return err
+			})
+			if err != nil {
+				t.Errorf("Put: %v", err)
+			}
+		}()
+	}
+	wg.Wait()
+	if calls != 1 {
+		t.Errorf("blob written %d times, want 1", calls)
+	}
+}
+
+func TestCAS_PutProducerError(t *testing.T) {
+	cas := NewCAS(tempBackend(t))
+	_, err := cas.Put(testBlobID, func(w io.Writer) error {
+		io.WriteString(w, "partial") //nolint:errcheck
+		return errors.New("encrypt failed")
+	})
+	if err == nil {
+		t.Fatal("expected error from failing producer")
+	}
+	if ok, _ := cas.Exists(testBlobID); ok {
+		t.Error("failed Put must not leave a blob behind")
+	}
+}
+
+func TestCAS_Delete(t *testing.T) {
+	cas := NewCAS(tempBackend(t))
+	cas.Put(testBlobID, func(w io.Writer) error { _, err := io.WriteString(w, "x"); return err }) //nolint:errcheck
+	if err := cas.Delete(testBlobID); err != nil {
+		t.Fatalf("Delete: %v", err)
+	}
+	if ok, _ := cas.Exists(testBlobID); ok {
+		t.Error("blob still exists after Delete")
+	}
+}
+
+func TestCAS_InvalidID(t *testing.T) {
+	cas := NewCAS(tempBackend(t))
+	if _, err := cas.Put("../../etc/passwd", func(io.Writer) error { return nil }); err == nil {
+		t.Error("expected error for invalid blob id")
+	}
+	if _, _, err := cas.Read("nothex"); err == nil {
+		t.Error("expected error for invalid blob id")
+	}
+}
@@ -7,8 +7,9 @@ import (
 	"strings"
 )
 
-// hashableExtensions lists file extensions that qualify for content-addressable
-// deduplication via SHA-256 hashing.
+// hashableExtensions lists file extensions whose SHA-256 is recorded on the
+// file row (files.file_hash) so clients can detect duplicates before uploading.
+// Storage-level deduplication via the CAS applies to every file regardless.
 //
 // Rationale: these are document and structured-text formats where exact binary
 // matches are common (team-shared PDFs, exported CSVs, config files). Computing
@@ -29,8 +30,8 @@ var hashableExtensions = map[string]bool{
 	".pdf": true, ".html": true, ".htm": true, ".xml": true, ".json": true,
 }
 
-// ShouldDedup reports whether a file with the given name should go through the
-// SHA-256 deduplication path. The check is purely extension-based and reads no
+// ShouldDedup reports whether a file with the given name should have its
+// SHA-256 recorded for duplicate detection. The check is purely extension-based and reads no
 // bytes, so it can be called before or after the body is available.
 func ShouldDedup(fileName string) bool {
 	ext := strings.ToLower(filepath.Ext(fileName))
@@ -139,6 +139,26 @@ func (l *Local) Read(path string) (io.ReadCloser, int64, error) {
 	return f, info.Size(), nil
 }
 
+// ReadRange opens path positioned at offset. length < 0 reads to the end.
+func (l *Local) ReadRange(path string, offset, length int64) (io.ReadCloser, error) {
+	abs, err := l.abs(path)
+	if err != nil {
+		return nil, err
+	}
+	f, err := os.Open(abs) // #nosec G304 -- abs is sanitised by l.abs() which rejects path traversal
+	if err != nil {
+		return nil, err
+	}
+	if _, err := f.Seek(offset, io.SeekStart); err != nil {
+		f.Close()
+		return nil, err
+	}
+	if length < 0 {
+		return f, nil
+	}
+	return limitedReadCloser{io.LimitReader(f, length), f}, nil
+}
+
 // Delete removes path recursively. Silently succeeds on ENOENT.
 func (l *Local) Delete(path string) error {
 	abs, err := l.abs(path)
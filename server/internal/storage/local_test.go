@@ -140,3 +140,28 @@ func TestLocal_MkdirAll(t *testing.T) {
 		t.Error("expected directory, got file")
 	}
 }
+
+func TestLocal_ReadRange(t *testing.T) {
+	b := tempBackend(t)
+	b.Write("r.bin", bytes.NewReader([]byte("0123456789"))) //nolint:errcheck
+
+	rc, err := b.ReadRange("r.bin", 3, 4)
+	if err != nil {
+		t.Fatalf("ReadRange: %v", err)
+	}
+	got, _ := io.ReadAll(rc)
+	rc.Close()
+	if string(got) != "3456" {
+		t.Errorf("ReadRange = %q, want %q", got, "3456")
+	}
+
+	rc, err = b.ReadRange("r.bin", 8, -1)
+	if err != nil {
+		t.Fatalf("ReadRange to EOF: %v", err)
+	}
+	got, _ = io.ReadAll(rc)
+	rc.Close()
+	if string(got) != "89" {
+		t.Errorf("ReadRange to EOF = %q, want %q", got, "89")
+	}
+}
@@ -0,0 +1,661 @@
+package storage
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	// s3MinPartSize is the smallest part S3 accepts for every part but the last.
+	s3MinPartSize = 5 * 1024 * 1024
+	// s3DefaultPartSize balances memory per in-flight upload (one buffered part)
+	// against the 10,000-part limit: 16 MiB parts allow objects up to ~156 GiB.
+	s3DefaultPartSize = 16 * 1024 * 1024
+	// s3MaxCopySize is the largest object a single CopyObject call may copy.
+	s3MaxCopySize = 5 * 1024 * 1024 * 1024
+
+	s3UnsignedPayload = "UNSIGNED-PAYLOAD"
+	s3EmptySHA256     = "e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855"
+)
+
+// S3Config describes how to reach an S3-compatible object store
+// (AWS S3, MinIO, Ceph RGW, Cloudflare R2, Backblaze B2, …).
+type S3Config struct {
+	Endpoint       string // e.g. "https://s3.eu-central-1.amazonaws.com" or "http://minio:9000"
+	Region         string // signing region; "us-east-1" for most self-hosted stores
+	Bucket         string
+	AccessKey      string
+	SecretKey      string
+	Prefix         string // optional key prefix so several instances can share a bucket
+	ForcePathStyle bool   // true = {endpoint}/{bucket}/{key}; false = {bucket}.{host}/{key}
+	PartSize       int64  // multipart part size in bytes (0 = default, min 5 MiB)
+	HTTPClient     *http.Client
+}
+
+// S3Compatible stores files as objects in an S3-compatible bucket.
+//
+// Requests are signed with AWS Signature Version 4. Payloads are sent as
+// UNSIGNED-PAYLOAD so uploads stream without a second hashing pass; integrity
+// of the content itself is already guaranteed by the AES-GCM tags written by
+// crypto.EncryptStream.
+//
+// Writes larger than one part use a multipart upload, so at most PartSize bytes
+// are buffered per in-flight upload. The object only becomes visible when the
+// upload is completed, which gives the same all-or-nothing guarantee as the
+// temp-file + rename dance in Local.
+type S3Compatible struct {
+	endpoint  *url.URL
+	region    string
+	bucket    string
+	accessKey string
+	secretKey string
+	prefix    string
+	pathStyle bool
+	partSize  int64
+	client    *http.Client
+	now       func() time.Time // overridable for signature tests
+}
+
+// NewS3Compatible validates cfg and returns a backend. It performs no network I/O.
+func NewS3Compatible(cfg S3Config) (*S3Compatible, error) {
+	if cfg.Endpoint == "" || cfg.Bucket == "" {
+		return nil, errors.New("s3: endpoint and bucket are required")
+	}
+	if cfg.AccessKey == "" || cfg.SecretKey == "" {
+		return nil, errors.New("s3: access key and secret key are required")
+	}
+	u, err := url.Parse(strings.TrimRight(cfg.Endpoint, "/"))
+	if err != nil || u.Host == "" || (u.Scheme != "http" && u.Scheme != "https") {
+		return nil, fmt.Errorf("s3: invalid endpoint %q", cfg.Endpoint)
+	}
+	region := cfg.Region
+	if region == "" {
+		region = "us-east-1"
+	}
+	partSize := cfg.PartSize
+	if partSize == 0 {
+		partSize = s3DefaultPartSize
+	}
+	if partSize < s3MinPartSize {
+		return nil, fmt.Errorf("s3: part size must be at least %d bytes", s3MinPartSize)
+	}
+	client := cfg.HTTPClient
+	if client == nil {
+		// No overall Timeout: large objects legitimately stream for a long time.
+		client = &http.Client{}
+	}
+	return &S3Compatible{
+		endpoint:  u,
+		region:    region,
+		bucket:    cfg.Bucket,
+		accessKey: cfg.AccessKey,
+		secretKey: cfg.SecretKey,
+		prefix:    strings.Trim(cfg.Prefix, "/"),
+		pathStyle: cfg.ForcePathStyle,
+		partSize:  partSize,
+		client:    client,
+		now:       time.Now,
+	}, nil
+}
+
+// key maps a logical storage path to an object key, rejecting traversal in the
+// same spirit as Local.abs so a crafted path cannot reach outside the prefix.
+func (s *S3Compatible) key(p string) (string, error) {
+	if p == "" {
+		return "", errors.New("s3: empty path")
+	}
+	clean := path.Clean("/" + strings.ReplaceAll(p, `\`, "/"))
+	if clean == "/" {
+		return "", fmt.Errorf("path %q resolves to the bucket root", p)
+	}
+	for _, seg := range strings.Split(p, "/") {
+		if seg == ".." {
+			return "", fmt.Errorf("path %q escapes storage root", p)
+		}
+	}
+	k := strings.TrimPrefix(clean, "/")
+	if s.prefix != "" {
+		k = s.prefix + "/" + k
+	}
+	return k, nil
+}
+
+// objectURL builds the request URL for key (empty key = bucket URL).
+func (s *S3Compatible) objectURL(key string, query url.Values) *url.URL {
+	u := *s.endpoint
+	escaped := s3EscapePath(key)
+	if s.pathStyle {
+		u.Path = "/" + s.bucket
+		if key != "" {
+			u.Path += "/" + key
+		}
+		u.RawPath = "/" + s.bucket
+		if key != "" {
+			u.RawPath += "/" + escaped
+		}
+	} else {
+		u.Host = s.bucket + "." + u.Host
+		u.Path = "/" + key
+		u.RawPath = "/" + escaped
+	}
+	if query != nil {
+		u.RawQuery = s3CanonicalQuery(query)
+	}
+	return &u
+}
+
+// Write streams r to path. Small payloads use a single PutObject; anything
+// larger than one part goes through a multipart upload.
+func (s *S3Compatible) Write(p string, r io.Reader) (int64, error) {
+	key, err := s.key(p)
+	if err != nil {
+		return 0, err
+	}
+
+	buf := make([]byte, s.partSize)
+	n, readErr := io.ReadFull(r, buf)
+	if readErr == io.EOF || readErr == io.ErrUnexpectedEOF {
+		if err := s.putObject(key, buf[:n]); err != nil {
+			return 0, err
+		}
+		return int64(n), nil
+	}
+	if readErr != nil {
+		return 0, fmt.Errorf("stream write: %w", readErr)
+	}
+
+	uploadID, err := s.createMultipart(key)
+	if err != nil {
+		return 0, err
+	}
+
+	var (
+		total int64
+		parts []s3CompletedPart
+	)
+	abort := func(cause error) (int64, error) {
+		if aerr := s.abortMultipart(key, uploadID); aerr != nil {
+			return 0, fmt.Errorf("%w (abort failed: %v)", cause, aerr)
+		}
+		return 0, cause
+	}
+
+	for partNum := 1; ; partNum++ {
+		etag, err := s.uploadPart(key, uploadID, partNum, buf[:n])
+		if err != nil {
+			return abort(err)
+		}
+		parts = append(parts, s3CompletedPart{PartNumber: partNum, ETag: etag})
+		total += int64(n)
+		if readErr == io.ErrUnexpectedEOF {
+			break // that was the short final part
+		}
+
+		n, readErr = io.ReadFull(r, buf)
+		if readErr == io.EOF {
+			break
+		}
+		if readErr != nil && readErr != io.ErrUnexpectedEOF {
+			return abort(fmt.Errorf("stream write: %w", readErr))
+		}
+	}
+
+	if err := s.completeMultipart(key, uploadID, parts); err != nil {
+		return abort(err)
+	}
+	return total, nil
+}
+
+// Read opens path for streaming. A missing object returns an error wrapping
+// os.ErrNotExist so callers can treat both backends alike.
+func (s *S3Compatible) Read(p string) (io.ReadCloser, int64, error) {
+	key, err := s.key(p)
+	if err != nil {
+		return nil, 0, err
+	}
+	resp, err := s.do(http.MethodGet, key, nil, nil, nil)
+	if err != nil {
+		return nil, 0, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		defer resp.Body.Close()
+		return nil, 0, s3ResponseError("get object", resp)
+	}
+	return resp.Body, resp.ContentLength, nil
+}
+
+// ReadRange streams part of an object using an HTTP Range request.
+// length < 0 reads to the end.
+func (s *S3Compatible) ReadRange(p string, offset, length int64) (io.ReadCloser, error) {
+	key, err := s.key(p)
+	if err != nil {
+		return nil, err
+	}
+	rng := fmt.Sprintf("bytes=%d-", offset)
+	if length >= 0 {
+		if length == 0 {
+			return io.NopCloser(bytes.NewReader(nil)), nil
+		}
+		rng = fmt.Sprintf("bytes=%d-%d", offset, offset+length-1)
+	}
+	resp, err := s.do(http.MethodGet, key, nil, http.Header{"Range": {rng}}, nil)
+	if err != nil {
+		return nil, err
+	}
+	switch resp.StatusCode {
+	case http.StatusPartialContent:
+		return resp.Body, nil
+	case http.StatusOK:
+		// Server ignored the Range header; skip ahead ourselves.
+		if _, err := io.CopyN(io.Discard, resp.Body, offset); err != nil {
+			resp.Body.Close()
+			return nil, err
+		}
+		if length < 0 {
+			return resp.Body, nil
+		}
+		return limitedReadCloser{io.LimitReader(resp.Body, length), resp.Body}, nil
+	default:
+		defer resp.Body.Close()
+		return nil, s3ResponseError("get object range", resp)
+	}
+}
+
+// Delete removes path. Deleting a missing object is not an error.
+func (s *S3Compatible) Delete(p string) error {
+	key, err := s.key(p)
+	if err != nil {
+		return err
+	}
+	resp, err := s.do(http.MethodDelete, key, nil, nil, nil)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode == http.StatusNoContent || resp.StatusCode == http.StatusOK || resp.StatusCode == http.StatusNotFound {
+		io.Copy(io.Discard, resp.Body) //nolint:errcheck
+		return nil
+	}
+	return s3ResponseError("delete object", resp)
+}
+
+// Exists reports whether an object is stored at path.
+func (s *S3Compatible) Exists(p string) (bool, error) {
+	key, err := s.key(p)
+	if err != nil {
+		return false, err
+	}
+	resp, err := s.do(http.MethodHead, key, nil, nil, nil)
+	if err != nil {
+		return false, err
+	}
+	defer resp.Body.Close()
+	switch resp.StatusCode {
+	case http.StatusOK:
+		return true, nil
+	case http.StatusNotFound:
+		return false, nil
+	default:
+		return false, s3ResponseError("head object", resp)
+	}
+}
+
+// Rename copies src to dst and then deletes src. S3 has no native rename, so
+// the operation is not atomic: a crash between the two steps leaves both
+// objects, never neither.
+func (s *S3Compatible) Rename(src, dst string) error {
+	srcKey, err := s.key(src)
+	if err != nil {
+		return err
+	}
+	dstKey, err := s.key(dst)
+	if err != nil {
+		return err
+	}
+
+	size, err := s.headSize(srcKey)
+	if err != nil {
+		return err
+	}
+	if size > s3MaxCopySize {
+		err = s.multipartCopy(srcKey, dstKey, size)
+	} else {
+		err = s.copyObject(srcKey, dstKey)
+	}
+	if err != nil {
+		return err
+	}
+	return s.Delete(src)
+}
+
+// MkdirAll is a no-op: object stores have no directories.
+func (s *S3Compatible) MkdirAll(string) error { return nil }
+
+// ── S3 API calls ─────────────────────────────────────────────────────────────
+
+type s3CompletedPart struct {
+	PartNumber int    `xml:"PartNumber"`
+	ETag       string `xml:"ETag"`
+}
+
+func (s *S3Compatible) putObject(key string, data []byte) error {
+	resp, err := s.do(http.MethodPut, key, nil, nil, data)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return s3ResponseError("put object", resp)
+	}
+	return nil
+}
+
+func (s *S3Compatible) createMultipart(key string) (string, error) {
+	resp, err := s.do(http.MethodPost, key, url.Values{"uploads": {""}}, nil, nil)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return "", s3ResponseError("create multipart upload", resp)
+	}
+	var out struct {
+		UploadID string `xml:"UploadId"`
+	}
+	if err := xml.NewDecoder(resp.Body).Decode(&out); err != nil || out.UploadID == "" {
+		return "", fmt.Errorf("s3: create multipart upload: malformed response")
+	}
+	return out.UploadID, nil
+}
+
+func (s *S3Compatible) uploadPart(key, uploadID string, partNum int, data []byte) (string, error) {
+	q := url.Values{"partNumber": {strconv.Itoa(partNum)}, "uploadId": {uploadID}}
+	resp, err := s.do(http.MethodPut, key, q, nil, data)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return "", s3ResponseError(fmt.Sprintf("upload part %d", partNum), resp)
+	}
+	io.Copy(io.Discard, resp.Body) //nolint:errcheck
+	return resp.Header.Get("ETag"), nil
+}
+
+func (s *S3Compatible) completeMultipart(key, uploadID string, parts []s3CompletedPart) error {
+	body, err := xml.Marshal(struct {
+		XMLName xml.Name          `xml:"CompleteMultipartUpload"`
+		Parts   []s3CompletedPart `xml:"Part"`
+	}{Parts: parts})
+	if err != nil {
+		return err
+	}
+	resp, err := s.do(http.MethodPost, key, url.Values{"uploadId": {uploadID}}, nil, body)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	// S3 may return 200 with an <Error> body when completion fails late.
+	raw, _ := io.ReadAll(io.LimitReader(resp.Body, 64*1024))
+	if resp.StatusCode != http.StatusOK || bytes.Contains(raw, []byte("<Error>")) {
+		resp.Body = io.NopCloser(bytes.NewReader(raw))
+		return s3ResponseError("complete multipart upload", resp)
+	}
+	return nil
+}
+
+func (s *S3Compatible) abortMultipart(key, uploadID string) error {
+	resp, err := s.do(http.MethodDelete, key, url.Values{"uploadId": {uploadID}}, nil, nil)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusNoContent && resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusNotFound {
+		return s3ResponseError("abort multipart upload", resp)
+	}
+	return nil
+}
+
+func (s *S3Compatible) headSize(key string) (int64, error) {
+	resp, err := s.do(http.MethodHead, key, nil, nil, nil)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return 0, s3ResponseError("head object", resp)
+	}
+	return resp.ContentLength, nil
+}
+
+func (s *S3Compatible) copySource(srcKey string) string {
+	return "/" + s.bucket + "/" + s3EscapePath(srcKey)
+}
+
+func (s *S3Compatible) copyObject(srcKey, dstKey string) error {
+	hdr := http.Header{"X-Amz-Copy-Source": {s.copySource(srcKey)}}
+	resp, err := s.do(http.MethodPut, dstKey, nil, hdr, nil)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	raw, _ := io.ReadAll(io.LimitReader(resp.Body, 64*1024))
+	if resp.StatusCode != http.StatusOK || bytes.Contains(raw, []byte("<Error>")) {
+		resp.Body = io.NopCloser(bytes.NewReader(raw))
+		return s3ResponseError("copy object", resp)
+	}
+	return nil
+}
+
+// multipartCopy copies objects above the 5 GiB CopyObject limit part by part.
+func (s *S3Compatible) multipartCopy(srcKey, dstKey string, size int64) error {
+	uploadID, err := s.createMultipart(dstKey)
+	if err != nil {
+		return err
+	}
+	const copyPart = 512 * 1024 * 1024
+	var parts []s3CompletedPart
+	for partNum, off := 1, int64(0); off < size; partNum, off = partNum+1, off+copyPart {
+		end := off + copyPart - 1
+		if end >= size {
+			end = size - 1
+		}
+		hdr := http.Header{
+			"X-Amz-Copy-Source":       {s.copySource(srcKey)},
+			"X-Amz-Copy-Source-Range": {fmt.Sprintf("bytes=%d-%d", off, end)},
+		}
+		q := url.Values{"partNumber": {strconv.Itoa(partNum)}, "uploadId": {uploadID}}
+		resp, err := s.do(http.MethodPut, dstKey, q, hdr, nil)
+		if err != nil {
+			s.abortMultipart(dstKey, uploadID) //nolint:errcheck
+			return err
+		}
+		var out struct {
+			ETag string `xml:"ETag"`
+		}
+		decErr := xml.NewDecoder(resp.Body).Decode(&out)
+		status := resp.StatusCode
+		if status != http.StatusOK || decErr != nil {
+			err := s3ResponseError(fmt.Sprintf("upload part copy %d", partNum), resp)
+			resp.Body.Close()
+			s.abortMultipart(dstKey, uploadID) //nolint:errcheck
+			return err
+		}
+		resp.Body.Close()
+		parts = append(parts, s3CompletedPart{PartNumber: partNum, ETag: out.ETag})
+	}
+	if err := s.completeMultipart(dstKey, uploadID, parts); err != nil {
+		s.abortMultipart(dstKey, uploadID) //nolint:errcheck
+		return err
+	}
+	return nil
+}
+
+// do signs and sends a request. body may be nil.
+func (s *S3Compatible) do(method, key string, query url.Values, hdr http.Header, body []byte) (*http.Response, error) {
+	u := s.objectURL(key, query)
+	var rdr io.Reader
+	if body != nil {
+		rdr = bytes.NewReader(body)
+	}
+	req, err := http.NewRequest(method, u.String(), rdr)
+	if err != nil {
+		return nil, err
+	}
+	for k, v := range hdr {
+		req.Header[k] = v
+	}
+	if body != nil {
+		req.ContentLength = int64(len(body))
+	}
+	s.sign(req, s3UnsignedPayload)
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("s3: %s %s: %w", method, key, err)
+	}
+	return resp, nil
+}
+
+// ── SigV4 ────────────────────────────────────────────────────────────────────
+
+// sign adds AWS Signature Version 4 headers to req.
+// See https://docs.aws.amazon.com/AmazonS3/latest/API/sig-v4-header-based-auth.html
+func (s *S3Compatible) sign(req *http.Request, payloadHash string) {
+	t := s.now().UTC()
+	amzDate := t.Format("20060102T150405Z")
+	date := t.Format("20060102")
+
+	req.Header.Set("X-Amz-Date", amzDate)
+	req.Header.Set("X-Amz-Content-Sha256", payloadHash)
+
+	// Canonical headers: host plus every x-amz-* / range / content-type header.
+	headers := map[string]string{"host": req.URL.Host}
+	for k, v := range req.Header {
+		lk := strings.ToLower(k)
+		if strings.HasPrefix(lk, "x-amz-") || lk == "range" || lk == "content-type" || lk == "content-md5" {
+			headers[lk] = strings.TrimSpace(strings.Join(v, ","))
+		}
+	}
+	names := make([]string, 0, len(headers))
+	for k := range headers {
+		names = append(names, k)
+	}
+	sort.Strings(names)
+	var canonHeaders strings.Builder
+	for _, k := range names {
+		canonHeaders.WriteString(k + ":" + headers[k] + "\n")
+	}
+	signedHeaders := strings.Join(names, ";")
+
+	canonPath := req.URL.EscapedPath()
+	if canonPath == "" {
+		canonPath = "/"
+	}
+	canonicalRequest := strings.Join([]string{
+		req.Method,
+		canonPath,
+		s3CanonicalQuery(req.URL.Query()),
+		canonHeaders.String(),
+		signedHeaders,
+		payloadHash,
+	}, "\n")
+
+	scope := date + "/" + s.region + "/s3/aws4_request"
+	crHash := sha256.Sum256([]byte(canonicalRequest))
+	stringToSign := "AWS4-HMAC-SHA256\n" + amzDate + "\n" + scope + "\n" + hex.EncodeToString(crHash[:])
+
+	kDate := hmacSHA256([]byte("AWS4"+s.secretKey), date)
+	kRegion := hmacSHA256(kDate, s.region)
+	kService := hmacSHA256(kRegion, "s3")
+	kSigning := hmacSHA256(kService, "aws4_request")
+	signature := hex.EncodeToString(hmacSHA256(kSigning, stringToSign))
+
+	req.Header.Set("Authorization", fmt.Sprintf(
+		"AWS4-HMAC-SHA256 Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		s.accessKey, scope, signedHeaders, signature,
+	))
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	m := hmac.New(sha256.New, key)
+	m.Write([]byte(data))
+	return m.Sum(nil)
+}
+
+// s3Escape percent-encodes s per RFC 3986 as SigV4 requires (unreserved
+// characters are left alone; everything else, including '+', is encoded).
+func s3Escape(s string) string {
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if ('A' <= c && c <= 'Z') || ('a' <= c && c <= 'z') || ('0' <= c && c <= '9') ||
+			c == '-' || c == '_' || c == '.' || c == '~' {
+			b.WriteByte(c)
+		} else {
+			fmt.Fprintf(&b, "%%%02X", c)
+		}
+	}
+	return b.String()
+}
+
+// s3EscapePath escapes each segment of an object key, keeping the slashes.
+func s3EscapePath(key string) string {
+	segs := strings.Split(key, "/")
+	for i, seg := range segs {
+		segs[i] = s3Escape(seg)
+	}
+	return strings.Join(segs, "/")
+}
+
+// s3CanonicalQuery sorts and escapes query parameters for signing.
+func s3CanonicalQuery(q url.Values) string {
+	if len(q) == 0 {
+		return ""
+	}
+	keys := make([]string, 0, len(q))
+	for k := range q {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	var parts []string
+	for _, k := range keys {
+		vals := append([]string(nil), q[k]...)
+		sort.Strings(vals)
+		for _, v := range vals {
+			parts = append(parts, s3Escape(k)+"="+s3Escape(v))
+		}
+	}
+	return strings.Join(parts, "&")
+}
+
+// s3ResponseError turns a non-success response into an error. 404s wrap
+// os.ErrNotExist so errors.Is(err, os.ErrNotExist) works for both backends.
+func s3ResponseError(op string, resp *http.Response) error {
+	var e struct {
+		Code    string `xml:"Code"`
+		Message string `xml:"Message"`
+	}
+	raw, _ := io.ReadAll(io.LimitReader(resp.Body, 64*1024))
+	_ = xml.Unmarshal(raw, &e)
+	if resp.StatusCode == http.StatusNotFound || e.Code == "NoSuchKey" {
+		return fmt.Errorf("s3: %s: %w", op, os.ErrNotExist)
+	}
+	if e.Code != "" {
+		return fmt.Errorf("s3: %s: %s (%d): %s", op, e.Code, resp.StatusCode, e.Message)
+	}
+	return fmt.Errorf("s3: %s: unexpected status %d", op, resp.StatusCode)
+}
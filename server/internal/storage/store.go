@@ -24,3 +24,40 @@ type Backend interface {
 	// MkdirAll creates path and all parents (no-op for object stores).
 	MkdirAll(path string) error
 }
+
+// DiskStatter is implemented by backends that sit on a local volume and can
+// report its capacity. Object stores have no meaningful equivalent.
+type DiskStatter interface {
+	DiskStats() (avail, total uint64)
+}
+
+// RangeReader is implemented by backends that can open a file at an offset
+// without reading the bytes before it. length < 0 reads to the end.
+type RangeReader interface {
+	ReadRange(path string, offset, length int64) (io.ReadCloser, error)
+}
+
+// OpenRange opens path at offset using b's RangeReader when available and
+// falls back to reading and discarding the leading bytes otherwise.
+func OpenRange(b Backend, path string, offset, length int64) (io.ReadCloser, error) {
+	if rr, ok := b.(RangeReader); ok {
+		return rr.ReadRange(path, offset, length)
+	}
+	rc, _, err := b.Read(path)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := io.CopyN(io.Discard, rc, offset); err != nil {
+		rc.Close()
+		return nil, err
+	}
+	if length < 0 {
+		return rc, nil
+	}
+	return limitedReadCloser{io.LimitReader(rc, length), rc}, nil
+}
+
+type limitedReadCloser struct {
+	io.Reader
+	io.Closer
+}
@@ -0,0 +1,73 @@
+package totp
+
+import (
+	"net/url"
+	"testing"
+	"time"
+)
+
+// rfcSecret is the SHA-1 test key from RFC 4226 and RFC 6238.
+var rfcSecret = []byte("12345678901234567890")
+
+func TestCodeRFC4226(t *testing.T) {
+	want := []string{"755224", "287082", "359152", "969429", "338314", "254676", "287922", "162583", "399871", "520489"}
+	for counter, w := range want {
+		if got := Code(rfcSecret, int64(counter)); got != w {
+			t.Errorf("Code(%d) = %s, want %s", counter, got, w)
+		}
+	}
+}
+
+func TestValidateRFC6238(t *testing.T) {
+	// RFC 6238 appendix B lists 8-digit codes; the last six digits are the
+	// 6-digit codes for the same times.
+	cases := []struct {
+		unix int64
+		code string
+	}{
+		{59, "287082"},
+		{1111111109, "081804"},
+		{1234567890, "005924"},
+		{2000000000, "279037"},
+	}
+	for _, c := range cases {
+		at := time.Unix(c.unix, 0)
+		counter, ok := Validate(rfcSecret, c.code, at)
+		if !ok || counter != Counter(at) {
+			t.Errorf("Validate(%s at %d) = %d, %v", c.code, c.unix, counter, ok)
+		}
+	}
+}
+
+func TestValidateSkew(t *testing.T) {
+	at := time.Unix(1234567890, 0)
+	prev := Code(rfcSecret, Counter(at)-1)
+	if _, ok := Validate(rfcSecret, prev, at); !ok {
+		t.Error("code from the previous step rejected")
+	}
+	old := Code(rfcSecret, Counter(at)-2)
+	if _, ok := Validate(rfcSecret, old, at); ok {
+		t.Error("code from two steps back accepted")
+	}
+	if _, ok := Validate(rfcSecret, "12345", at); ok {
+		t.Error("short code accepted")
+	}
+	if _, ok := Validate(rfcSecret, "005 924", at); !ok {
+		t.Error("code with a space rejected")
+	}
+}
+
+func TestProvisioningURI(t *testing.T) {
+	uri := ProvisioningURI("ZynqCloud", "ada@example.com", rfcSecret)
+	u, err := url.Parse(uri)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if u.Scheme != "otpauth" || u.Host != "totp" || u.Path != "/ZynqCloud:ada@example.com" {
+		t.Errorf("unexpected URI %s", uri)
+	}
+	q := u.Query()
+	if q.Get("secret") != "GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ" || q.Get("issuer") != "ZynqCloud" {
+		t.Errorf("unexpected query %s", u.RawQuery)
+	}
+}
@@ -0,0 +1,182 @@
+package webauthn
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"sync"
+)
+
+// Authenticator is a software authenticator holding ES256 passkeys in
+// memory. It answers creation and request options the way a browser and
+// platform authenticator would, so the ceremonies can be exercised in tests
+// and scripts without hardware.
+type Authenticator struct {
+	// Origin is reported in client data, as a browser would for the page
+	// running the ceremony.
+	Origin string
+	// UserVerification sets the UV flag, as after a PIN or biometric check.
+	UserVerification bool
+	// SelfAttestation answers registrations with packed self attestation
+	// instead of "none".
+	SelfAttestation bool
+
+	mu    sync.Mutex
+	creds []*softCredential
+}
+
+type softCredential struct {
+	id         []byte
+	rpID       string
+	userHandle []byte
+	key        *ecdsa.PrivateKey
+	signCount  uint32
+}
+
+// ErrNoCredential is returned by Get when the authenticator holds no
+// credential the options allow.
+var ErrNoCredential = errors.New("webauthn: no matching credential")
+
+// NewAuthenticator returns an authenticator that performs user verification.
+func NewAuthenticator(origin string) *Authenticator {
+	return &Authenticator{Origin: origin, UserVerification: true}
+}
+
+func (a *Authenticator) clientData(typ string, challenge []byte) []byte {
+	cd, _ := json.Marshal(clientData{
+		Type:      typ,
+		Challenge: base64.RawURLEncoding.EncodeToString(challenge),
+		Origin:    a.Origin,
+	})
+	return cd
+}
+
+func (a *Authenticator) flags() byte {
+	f := byte(flagUserPresent)
+	if a.UserVerification {
+		f |= flagUserVerified
+	}
+	return f
+}
+
+func (c *softCredential) coseKey() []byte {
+	point, _ := c.key.PublicKey.Bytes() // 0x04 || X || Y
+	x, y := point[1:33], point[33:]
+	return encodeCBOR(map[int]any{
+		coseKty:    coseKtyEC2,
+		coseAlg:    AlgES256,
+		coseEC2Crv: coseCrvP256,
+		coseEC2X:   x,
+		coseEC2Y:   y,
+	})
+}
+
+func authData(rpID string, flags byte, signCount uint32, attested []byte) []byte {
+	h := sha256.Sum256([]byte(rpID))
+	out := append(h[:], flags)
+	out = binary.BigEndian.AppendUint32(out, signCount)
+	return append(out, attested...)
+}
+
+func (c *softCredential) sign(data []byte) ([]byte, error) {
+	sum := sha256.Sum256(data)
+	return ecdsa.SignASN1(rand.Reader, c.key, sum[:])
+}
+
+// Create registers a new credential, like navigator.credentials.create().
+func (a *Authenticator) Create(opts *CreationOptions) (*CreationResponse, error) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+	id := make([]byte, 16)
+	if _, err := rand.Read(id); err != nil {
+		return nil, err
+	}
+	cred := &softCredential{id: id, rpID: opts.RP.ID, userHandle: bytes.Clone(opts.User.ID), key: key}
+
+	attested := make([]byte, 16)                                        // all-zero AAGUID
+	attested = binary.BigEndian.AppendUint16(attested, uint16(len(id))) // #nosec G115 -- 16 bytes
+	attested = append(attested, id...)
+	attested = append(attested, cred.coseKey()...)
+	ad := authData(opts.RP.ID, a.flags()|flagAttestedData, 0, attested)
+
+	cd := a.clientData("webauthn.create", opts.Challenge)
+	format, stmt := "none", map[string]any{}
+	if a.SelfAttestation {
+		cdHash := sha256.Sum256(cd)
+		sig, err := cred.sign(append(bytes.Clone(ad), cdHash[:]...))
+		if err != nil {
+			return nil, err
+		}
+		format, stmt = "packed", map[string]any{"alg": AlgES256, "sig": sig}
+	}
+
+	a.mu.Lock()
+	a.creds = append(a.creds, cred)
+	a.mu.Unlock()
+
+	resp := &CreationResponse{ID: base64.RawURLEncoding.EncodeToString(id), RawID: id, Type: "public-key"}
+	resp.Response.ClientDataJSON = cd
+	resp.Response.AttestationObject = encodeCBOR(map[string]any{
+		"fmt":      format,
+		"attStmt":  stmt,
+		"authData": ad,
+	})
+	resp.Response.Transports = []string{"internal"}
+	return resp, nil
+}
+
+// Get signs an assertion with the first credential the options allow, like
+// navigator.credentials.get(). Each assertion increments the credential's
+// sign count.
+func (a *Authenticator) Get(opts *RequestOptions) (*AssertionResponse, error) {
+	a.mu.Lock()
+	var cred *softCredential
+	for _, c := range a.creds {
+		if c.rpID != opts.RPID {
+			continue
+		}
+		if len(opts.AllowCredentials) == 0 || allowed(opts.AllowCredentials, c.id) {
+			cred = c
+			break
+		}
+	}
+	if cred == nil {
+		a.mu.Unlock()
+		return nil, ErrNoCredential
+	}
+	cred.signCount++
+	count := cred.signCount
+	a.mu.Unlock()
+
+	ad := authData(opts.RPID, a.flags(), count, nil)
+	cd := a.clientData("webauthn.get", opts.Challenge)
+	cdHash := sha256.Sum256(cd)
+	sig, err := cred.sign(append(bytes.Clone(ad), cdHash[:]...))
+	if err != nil {
+		return nil, err
+	}
+
+	resp := &AssertionResponse{ID: base64.RawURLEncoding.EncodeToString(cred.id), RawID: cred.id, Type: "public-key"}
+	resp.Response.ClientDataJSON = cd
+	resp.Response.AuthenticatorData = ad
+	resp.Response.Signature = sig
+	resp.Response.UserHandle = cred.userHandle
+	return resp, nil
+}
+
+func allowed(list []CredentialDescriptor, id []byte) bool {
+	for _, d := range list {
+		if bytes.Equal(d.ID, id) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,269 @@
+package webauthn
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+)
+
+// CBOR (RFC 8949), reduced to what authenticators emit: definite-length
+// items, integer and text map keys, and the simple values. Integers decode
+// to int64, byte strings to []byte, text to string, arrays to []any and maps
+// to map[any]any.
+
+const cborMaxDepth = 16
+
+var errCBOR = errors.New("webauthn: malformed CBOR")
+
+// decodeCBOR decodes the first item in data and returns it with the bytes
+// that follow it.
+func decodeCBOR(data []byte) (any, []byte, error) {
+	return decodeItem(data, 0)
+}
+
+func decodeItem(data []byte, depth int) (any, []byte, error) {
+	if depth > cborMaxDepth {
+		return nil, nil, fmt.Errorf("%w: nested too deeply", errCBOR)
+	}
+	if len(data) == 0 {
+		return nil, nil, fmt.Errorf("%w: unexpected end of data", errCBOR)
+	}
+	major, info := data[0]>>5, data[0]&0x1f
+	data = data[1:]
+
+	if major == 7 {
+		switch info {
+		case 20:
+			return false, data, nil
+		case 21:
+			return true, data, nil
+		case 22, 23:
+			return nil, data, nil
+		case 25:
+			if len(data) < 2 {
+				return nil, nil, fmt.Errorf("%w: truncated float", errCBOR)
+			}
+			return halfToFloat(binary.BigEndian.Uint16(data)), data[2:], nil
+		case 26:
+			if len(data) < 4 {
+				return nil, nil, fmt.Errorf("%w: truncated float", errCBOR)
+			}
+			return float64(math.Float32frombits(binary.BigEndian.Uint32(data))), data[4:], nil
+		case 27:
+			if len(data) < 8 {
+				return nil, nil, fmt.Errorf("%w: truncated float", errCBOR)
+			}
+			return math.Float64frombits(binary.BigEndian.Uint64(data)), data[8:], nil
+		}
+		return nil, nil, fmt.Errorf("%w: unsupported simple value %d", errCBOR, info)
+	}
+
+	arg, data, err := readArgument(info, data)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	switch major {
+	case 0:
+		if arg > math.MaxInt64 {
+			return nil, nil, fmt.Errorf("%w: integer overflow", errCBOR)
+		}
+		return int64(arg), data, nil // #nosec G115 -- checked above
+	case 1:
+		if arg > math.MaxInt64 {
+			return nil, nil, fmt.Errorf("%w: integer overflow", errCBOR)
+		}
+		return -1 - int64(arg), data, nil // #nosec G115 -- checked above
+	case 2, 3:
+		if arg > uint64(len(data)) {
+			return nil, nil, fmt.Errorf("%w: truncated string", errCBOR)
+		}
+		s := data[:arg]
+		if major == 3 {
+			return string(s), data[arg:], nil
+		}
+		return bytes.Clone(s), data[arg:], nil
+	case 4:
+		// Every item takes at least one byte, which bounds the allocation.
+		if arg > uint64(len(data)) {
+			return nil, nil, fmt.Errorf("%w: truncated array", errCBOR)
+		}
+		arr := make([]any, 0, arg)
+		for i := uint64(0); i < arg; i++ {
+			var v any
+			if v, data, err = decodeItem(data, depth+1); err != nil {
+				return nil, nil, err
+			}
+			arr = append(arr, v)
+		}
+		return arr, data, nil
+	case 5:
+		if arg > uint64(len(data)) {
+			return nil, nil, fmt.Errorf("%w: truncated map", errCBOR)
+		}
+		m := make(map[any]any, arg)
+		for i := uint64(0); i < arg; i++ {
+			var k, v any
+			if k, data, err = decodeItem(data, depth+1); err != nil {
+				return nil, nil, err
+			}
+			switch k.(type) {
+			case int64, string:
+			default:
+				return nil, nil, fmt.Errorf("%w: unsupported map key %T", errCBOR, k)
+			}
+			if _, dup := m[k]; dup {
+				return nil, nil, fmt.Errorf("%w: duplicate map key %v", errCBOR, k)
+			}
+			if v, data, err = decodeItem(data, depth+1); err != nil {
+				return nil, nil, err
+			}
+			m[k] = v
+		}
+		return m, data, nil
+	case 6:
+		// Tags carry no meaning for WebAuthn structures; return the content.
+		return decodeItem(data, depth+1)
+	}
+	return nil, nil, fmt.Errorf("%w: unsupported major type %d", errCBOR, major)
+}
+
+func readArgument(info byte, data []byte) (uint64, []byte, error) {
+	switch {
+	case info < 24:
+		return uint64(info), data, nil
+	case info == 24 && len(data) >= 1:
+		return uint64(data[0]), data[1:], nil
+	case info == 25 && len(data) >= 2:
+		return uint64(binary.BigEndian.Uint16(data)), data[2:], nil
+	case info == 26 && len(data) >= 4:
+		return uint64(binary.BigEndian.Uint32(data)), data[4:], nil
+	case info == 27 && len(data) >= 8:
+		return binary.BigEndian.Uint64(data), data[8:], nil
+	case info == 31:
+		return 0, nil, fmt.Errorf("%w: indefinite-length items are not supported", errCBOR)
+	}
+	return 0, nil, fmt.Errorf("%w: truncated or invalid argument", errCBOR)
+}
+
+func halfToFloat(h uint16) float64 {
+	exp := int(h>>10) & 0x1f
+	frac := float64(h & 0x3ff)
+	var f float64
+	switch exp {
+	case 0:
+		f = math.Ldexp(frac, -24)
+	case 31:
+		if frac == 0 {
+			f = math.Inf(1)
+		} else {
+			f = math.NaN()
+		}
+	default:
+		f = math.Ldexp(frac+1024, exp-25)
+	}
+	if h&0x8000 != 0 {
+		return -f
+	}
+	return f
+}
+
+// encodeCBOR encodes the value types decodeCBOR produces, plus int and
+// map[int]any, with map keys in the canonical CTAP2 order. It is used by the
+// software authenticator.
+func encodeCBOR(v any) []byte {
+	var buf bytes.Buffer
+	writeItem(&buf, v)
+	return buf.Bytes()
+}
+
+func writeItem(buf *bytes.Buffer, v any) {
+	switch v := v.(type) {
+	case int:
+		writeInt(buf, int64(v))
+	case int64:
+		writeInt(buf, v)
+	case []byte:
+		writeHead(buf, 2, uint64(len(v)))
+		buf.Write(v)
+	case string:
+		writeHead(buf, 3, uint64(len(v)))
+		buf.WriteString(v)
+	case []any:
+		writeHead(buf, 4, uint64(len(v)))
+		for _, e := range v {
+			writeItem(buf, e)
+		}
+	case map[int]any:
+		m := make(map[any]any, len(v))
+		for k, e := range v {
+			m[int64(k)] = e
+		}
+		writeItem(buf, m)
+	case map[string]any:
+		m := make(map[any]any, len(v))
+		for k, e := range v {
+			m[k] = e
+		}
+		writeItem(buf, m)
+	case map[any]any:
+		type entry struct{ key, val []byte }
+		entries := make([]entry, 0, len(v))
+		for k, e := range v {
+			entries = append(entries, entry{encodeCBOR(k), encodeCBOR(e)})
+		}
+		// Canonical CTAP2 ordering: shorter encoded keys first, then bytewise.
+		sort.Slice(entries, func(i, j int) bool {
+			a, b := entries[i].key, entries[j].key
+			if len(a) != len(b) {
+				return len(a) < len(b)
+			}
+			return bytes.Compare(a, b) < 0
+		})
+		writeHead(buf, 5, uint64(len(entries)))
+		for _, e := range entries {
+			buf.Write(e.key)
+			buf.Write(e.val)
+		}
+	case bool:
+		if v {
+			buf.WriteByte(0xf5)
+		} else {
+			buf.WriteByte(0xf4)
+		}
+	case nil:
+		buf.WriteByte(0xf6)
+	default:
+		panic(fmt.Sprintf("webauthn: cannot encode %T as CBOR", v))
+	}
+}
+
+func writeInt(buf *bytes.Buffer, n int64) {
+	if n >= 0 {
+		writeHead(buf, 0, uint64(n))
+	} else {
+		writeHead(buf, 1, uint64(-1-n))
+	}
+}
+
+func writeHead(buf *bytes.Buffer, major byte, arg uint64) {
+	m := major << 5
+	switch {
+	case arg < 24:
+		buf.WriteByte(m | byte(arg))
+	case arg <= math.MaxUint8:
+		buf.Write([]byte{m | 24, byte(arg)})
+	case arg <= math.MaxUint16:
+		buf.WriteByte(m | 25)
+		buf.Write(binary.BigEndian.AppendUint16(nil, uint16(arg)))
+	case arg <= math.MaxUint32:
+		buf.WriteByte(m | 26)
+		buf.Write(binary.BigEndian.AppendUint32(nil, uint32(arg)))
+	default:
+		buf.WriteByte(m | 27)
+		buf.Write(binary.BigEndian.AppendUint64(nil, arg))
+	}
+}
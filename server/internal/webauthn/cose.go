@@ -0,0 +1,137 @@
+package webauthn
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"math/big"
+)
+
+// COSE algorithm identifiers (RFC 9053) for the signature schemes accepted
+// for credentials.
+const (
+	AlgES256 = -7
+	AlgEdDSA = -8
+	AlgRS256 = -257
+)
+
+// SupportedAlgorithms lists the accepted algorithms in order of preference.
+var SupportedAlgorithms = []int{AlgES256, AlgEdDSA, AlgRS256}
+
+// COSE_Key labels and values (RFC 9052 §7, RFC 9053 §7).
+const (
+	coseKty = 1
+	coseAlg = 3
+
+	coseKtyOKP = 1
+	coseKtyEC2 = 2
+	coseKtyRSA = 3
+
+	coseEC2Crv     = -1
+	coseEC2X       = -2
+	coseEC2Y       = -3
+	coseCrvP256    = 1
+	coseCrvEd25519 = 6
+
+	coseRSAN = -1
+	coseRSAE = -2
+
+	minRSABits = 2048
+)
+
+var errUnsupportedKey = errors.New("webauthn: unsupported public key")
+
+// publicKey is a parsed COSE_Key.
+type publicKey struct {
+	alg int
+	key crypto.PublicKey
+}
+
+// parsePublicKey parses a COSE_Key as found in attested credential data.
+func parsePublicKey(cose []byte) (*publicKey, error) {
+	v, rest, err := decodeCBOR(cose)
+	if err != nil {
+		return nil, err
+	}
+	if len(rest) != 0 {
+		return nil, fmt.Errorf("%w: trailing bytes after key", errCBOR)
+	}
+	m, ok := v.(map[any]any)
+	if !ok {
+		return nil, fmt.Errorf("%w: key is not a map", errUnsupportedKey)
+	}
+	kty, _ := m[int64(coseKty)].(int64)
+	alg, _ := m[int64(coseAlg)].(int64)
+
+	switch {
+	case kty == coseKtyEC2 && alg == AlgES256:
+		crv, _ := m[int64(coseEC2Crv)].(int64)
+		x, _ := m[int64(coseEC2X)].([]byte)
+		y, _ := m[int64(coseEC2Y)].([]byte)
+		if crv != coseCrvP256 || len(x) != 32 || len(y) != 32 {
+			return nil, fmt.Errorf("%w: bad EC2 key", errUnsupportedKey)
+		}
+		point := append(append([]byte{4}, x...), y...)
+		pub, err := ecdsa.ParseUncompressedPublicKey(elliptic.P256(), point)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %v", errUnsupportedKey, err)
+		}
+		return &publicKey{alg: AlgES256, key: pub}, nil
+
+	case kty == coseKtyOKP && alg == AlgEdDSA:
+		crv, _ := m[int64(coseEC2Crv)].(int64)
+		x, _ := m[int64(coseEC2X)].([]byte)
+		if crv != coseCrvEd25519 || len(x) != ed25519.PublicKeySize {
+			return nil, fmt.Errorf("%w: bad OKP key", errUnsupportedKey)
+		}
+		return &publicKey{alg: AlgEdDSA, key: ed25519.PublicKey(x)}, nil
+
+	case kty == coseKtyRSA && alg == AlgRS256:
+		n, _ := m[int64(coseRSAN)].([]byte)
+		e, _ := m[int64(coseRSAE)].([]byte)
+		if len(n)*8 < minRSABits || len(e) == 0 || len(e) > 4 {
+			return nil, fmt.Errorf("%w: bad RSA key", errUnsupportedKey)
+		}
+		exp := 0
+		for _, b := range e {
+			exp = exp<<8 | int(b)
+		}
+		return &publicKey{alg: AlgRS256, key: &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: exp}}, nil
+	}
+	return nil, fmt.Errorf("%w: kty %d alg %d", errUnsupportedKey, kty, alg)
+}
+
+// verify checks sig over data.
+func (k *publicKey) verify(data, sig []byte) bool {
+	switch k.alg {
+	case AlgES256:
+		sum := sha256.Sum256(data)
+		return ecdsa.VerifyASN1(k.key.(*ecdsa.PublicKey), sum[:], sig)
+	case AlgEdDSA:
+		return ed25519.Verify(k.key.(ed25519.PublicKey), data, sig)
+	case AlgRS256:
+		sum := sha256.Sum256(data)
+		return rsa.VerifyPKCS1v15(k.key.(*rsa.PublicKey), crypto.SHA256, sum[:], sig) == nil
+	}
+	return false
+}
+
+// x509Algorithm maps a COSE algorithm to the x509 signature algorithm used
+// to check a packed attestation signed by a certificate.
+func x509Algorithm(alg int64) (x509.SignatureAlgorithm, bool) {
+	switch alg {
+	case AlgES256:
+		return x509.ECDSAWithSHA256, true
+	case AlgEdDSA:
+		return x509.PureEd25519, true
+	case AlgRS256:
+		return x509.SHA256WithRSA, true
+	}
+	return x509.UnknownSignatureAlgorithm, false
+}
@@ -0,0 +1,480 @@
+// Package webauthn implements the relying-party side of the Web
+// Authentication ceremonies (W3C WebAuthn Level 2) for passkeys:
+// registration with "none" or "packed" attestation, and assertion with
+// ES256, EdDSA or RS256 credentials.
+//
+// Attestation is not evaluated against trust anchors. Options request
+// attestation "none", so browsers strip device attestation, and a credential
+// is trusted because the signed-in user registered it. Packed attestation
+// signatures are still checked when present.
+//
+// Options and responses use the JSON encoding of PublicKeyCredential
+// (base64url for binary fields), so browsers can pass them through
+// PublicKeyCredential.parseCreationOptionsFromJSON and toJSON() unchanged.
+package webauthn
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"crypto/subtle"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+)
+
+// ChallengeLength is the size of generated challenges in bytes.
+const ChallengeLength = 32
+
+// maxCredentialIDLength is the upper bound WebAuthn sets on credential IDs.
+const maxCredentialIDLength = 1023
+
+// Authenticator data flags.
+const (
+	flagUserPresent    = 0x01
+	flagUserVerified   = 0x04
+	flagBackupEligible = 0x08
+	flagBackedUp       = 0x10
+	flagAttestedData   = 0x40
+	flagExtensions     = 0x80
+)
+
+// ErrVerification is wrapped by every ceremony verification failure.
+var ErrVerification = errors.New("webauthn: verification failed")
+
+func verifyErr(format string, args ...any) error {
+	return fmt.Errorf("%w: %s", ErrVerification, fmt.Sprintf(format, args...))
+}
+
+// Base64URL is binary data encoded as unpadded base64url in JSON. Decoding
+// also accepts padding.
+type Base64URL []byte
+
+func (b Base64URL) MarshalJSON() ([]byte, error) {
+	return json.Marshal(base64.RawURLEncoding.EncodeToString(b))
+}
+
+func (b *Base64URL) UnmarshalJSON(data []byte) error {
+	var s string
+	if err := json.Unmarshal(data, &s); err != nil {
+		return err
+	}
+	out, err := base64.RawURLEncoding.DecodeString(strings.TrimRight(s, "="))
+	if err != nil {
+		return err
+	}
+	*b = out
+	return nil
+}
+
+// RelyingParty identifies the site credentials are scoped to.
+type RelyingParty struct {
+	// ID is the RP ID: the registrable domain credentials are bound to,
+	// such as "cloud.example.com".
+	ID string
+	// Name is shown by the browser during registration.
+	Name string
+	// Origins are the web origins allowed to run ceremonies, such as
+	// "https://cloud.example.com".
+	Origins []string
+}
+
+// ── Options ─────────────────────────────────────────────────────────────────
+
+type RPEntity struct {
+	ID   string `json:"id"`
+	Name string `json:"name"`
+}
+
+type UserEntity struct {
+	ID          Base64URL `json:"id"`
+	Name        string    `json:"name"`
+	DisplayName string    `json:"displayName"`
+}
+
+type CredentialParameter struct {
+	Type string `json:"type"`
+	Alg  int    `json:"alg"`
+}
+
+type CredentialDescriptor struct {
+	Type       string    `json:"type"`
+	ID         Base64URL `json:"id"`
+	Transports []string  `json:"transports,omitempty"`
+}
+
+type AuthenticatorSelection struct {
+	ResidentKey      string `json:"residentKey,omitempty"`
+	UserVerification string `json:"userVerification,omitempty"`
+}
+
+// CreationOptions is PublicKeyCredentialCreationOptions.
+type CreationOptions struct {
+	RP                     RPEntity               `json:"rp"`
+	User                   UserEntity             `json:"user"`
+	Challenge              Base64URL              `json:"challenge"`
+	PubKeyCredParams       []CredentialParameter  `json:"pubKeyCredParams"`
+	Timeout                int                    `json:"timeout,omitempty"`
+	ExcludeCredentials     []CredentialDescriptor `json:"excludeCredentials,omitempty"`
+	AuthenticatorSelection AuthenticatorSelection `json:"authenticatorSelection"`
+	Attestation            string                 `json:"attestation"`
+}
+
+// RequestOptions is PublicKeyCredentialRequestOptions.
+type RequestOptions struct {
+	Challenge        Base64URL              `json:"challenge"`
+	Timeout          int                    `json:"timeout,omitempty"`
+	RPID             string                 `json:"rpId"`
+	AllowCredentials []CredentialDescriptor `json:"allowCredentials,omitempty"`
+	UserVerification string                 `json:"userVerification,omitempty"`
+}
+
+// CreationOptions returns options for registering a discoverable credential
+// (a passkey) for user. exclude lists the user's existing credentials so the
+// same authenticator is not registered twice.
+func (rp *RelyingParty) CreationOptions(challenge []byte, user UserEntity, exclude []CredentialDescriptor, timeoutMs int) *CreationOptions {
+	params := make([]CredentialParameter, len(SupportedAlgorithms))
+	for i, alg := range SupportedAlgorithms {
+		params[i] = CredentialParameter{Type: "public-key", Alg: alg}
+	}
+	return &CreationOptions{
+		RP:                 RPEntity{ID: rp.ID, Name: rp.Name},
+		User:               user,
+		Challenge:          challenge,
+		PubKeyCredParams:   params,
+		Timeout:            timeoutMs,
+		ExcludeCredentials: exclude,
+		AuthenticatorSelection: AuthenticatorSelection{
+			ResidentKey:      "preferred",
+			UserVerification: "preferred",
+		},
+		Attestation: "none",
+	}
+}
+
+// RequestOptions returns options for an assertion. An empty allow list lets
+// the user pick any discoverable credential for the RP.
+func (rp *RelyingParty) RequestOptions(challenge []byte, allow []CredentialDescriptor, userVerification string, timeoutMs int) *RequestOptions {
+	return &RequestOptions{
+		Challenge:        challenge,
+		Timeout:          timeoutMs,
+		RPID:             rp.ID,
+		AllowCredentials: allow,
+		UserVerification: userVerification,
+	}
+}
+
+// ── Responses ───────────────────────────────────────────────────────────────
+
+// CreationResponse is the JSON form of a PublicKeyCredential returned by
+// navigator.credentials.create().
+type CreationResponse struct {
+	ID       string    `json:"id"`
+	RawID    Base64URL `json:"rawId"`
+	Type     string    `json:"type"`
+	Response struct {
+		ClientDataJSON    Base64URL `json:"clientDataJSON"`
+		AttestationObject Base64URL `json:"attestationObject"`
+		Transports        []string  `json:"transports,omitempty"`
+	} `json:"response"`
+}
+
+// AssertionResponse is the JSON form of a PublicKeyCredential returned by
+// navigator.credentials.get().
+type AssertionResponse struct {
+	ID       string    `json:"id"`
+	RawID    Base64URL `json:"rawId"`
+	Type     string    `json:"type"`
+	Response struct {
+		ClientDataJSON    Base64URL `json:"clientDataJSON"`
+		AuthenticatorData Base64URL `json:"authenticatorData"`
+		Signature         Base64URL `json:"signature"`
+		UserHandle        Base64URL `json:"userHandle,omitempty"`
+	} `json:"response"`
+}
+
+// Challenge returns the challenge the client signed, so the caller can look
+// up the ceremony it belongs to before verifying.
+func Challenge(clientDataJSON []byte) ([]byte, error) {
+	cd, err := parseClientData(clientDataJSON)
+	if err != nil {
+		return nil, err
+	}
+	return base64.RawURLEncoding.DecodeString(strings.TrimRight(cd.Challenge, "="))
+}
+
+// Credential is a verified new credential, to be stored by the caller.
+type Credential struct {
+	ID             []byte
+	PublicKey      []byte // COSE_Key, as sent by the authenticator
+	Algorithm      int
+	SignCount      uint32
+	AAGUID         []byte
+	Transports     []string
+	UserVerified   bool
+	BackupEligible bool
+	BackedUp       bool
+}
+
+// Assertion is the outcome of a verified assertion.
+type Assertion struct {
+	SignCount    uint32
+	UserVerified bool
+	BackedUp     bool
+}
+
+// ── Verification ────────────────────────────────────────────────────────────
+
+type clientData struct {
+	Type        string `json:"type"`
+	Challenge   string `json:"challenge"`
+	Origin      string `json:"origin"`
+	CrossOrigin bool   `json:"crossOrigin"`
+}
+
+func parseClientData(raw []byte) (*clientData, error) {
+	var cd clientData
+	if err := json.Unmarshal(raw, &cd); err != nil {
+		return nil, verifyErr("client data: %v", err)
+	}
+	return &cd, nil
+}
+
+func (rp *RelyingParty) checkClientData(raw []byte, typ string, challenge []byte) error {
+	cd, err := parseClientData(raw)
+	if err != nil {
+		return err
+	}
+	if cd.Type != typ {
+		return verifyErr("client data type %q, want %q", cd.Type, typ)
+	}
+	got, err := base64.RawURLEncoding.DecodeString(strings.TrimRight(cd.Challenge, "="))
+	if err != nil || len(challenge) == 0 || subtle.ConstantTimeCompare(got, challenge) != 1 {
+		return verifyErr("challenge mismatch")
+	}
+	if !slices.Contains(rp.Origins, cd.Origin) {
+		return verifyErr("origin %q not allowed", cd.Origin)
+	}
+	if cd.CrossOrigin {
+		return verifyErr("cross-origin ceremony")
+	}
+	return nil
+}
+
+type authenticatorData struct {
+	raw          []byte
+	rpIDHash     []byte
+	flags        byte
+	signCount    uint32
+	aaguid       []byte
+	credentialID []byte
+	publicKey    []byte
+}
+
+func parseAuthenticatorData(raw []byte) (*authenticatorData, error) {
+	if len(raw) < 37 {
+		return nil, verifyErr("authenticator data too short")
+	}
+	ad := &authenticatorData{
+		raw:       raw,
+		rpIDHash:  raw[:32],
+		flags:     raw[32],
+		signCount: binary.BigEndian.Uint32(raw[33:37]),
+	}
+	rest := raw[37:]
+	if ad.flags&flagAttestedData != 0 {
+		if len(rest) < 18 {
+			return nil, verifyErr("attested credential data too short")
+		}
+		ad.aaguid = rest[:16]
+		n := int(binary.BigEndian.Uint16(rest[16:18]))
+		rest = rest[18:]
+		if n == 0 || n > maxCredentialIDLength || len(rest) < n {
+			return nil, verifyErr("bad credential ID length")
+		}
+		ad.credentialID = rest[:n]
+		rest = rest[n:]
+		_, after, err := decodeCBOR(rest)
+		if err != nil {
+			return nil, verifyErr("credential public key: %v", err)
+		}
+		ad.publicKey = rest[:len(rest)-len(after)]
+		rest = after
+	}
+	if ad.flags&flagExtensions != 0 {
+		_, after, err := decodeCBOR(rest)
+		if err != nil {
+			return nil, verifyErr("extensions: %v", err)
+		}
+		rest = after
+	}
+	if len(rest) != 0 {
+		return nil, verifyErr("trailing bytes in authenticator data")
+	}
+	return ad, nil
+}
+
+func (rp *RelyingParty) checkAuthenticatorData(ad *authenticatorData, requireUV bool) error {
+	want := sha256.Sum256([]byte(rp.ID))
+	if subtle.ConstantTimeCompare(ad.rpIDHash, want[:]) != 1 {
+		return verifyErr("RP ID hash mismatch")
+	}
+	if ad.flags&flagUserPresent == 0 {
+		return verifyErr("user not present")
+	}
+	if requireUV && ad.flags&flagUserVerified == 0 {
+		return verifyErr("user not verified")
+	}
+	if ad.flags&flagBackedUp != 0 && ad.flags&flagBackupEligible == 0 {
+		return verifyErr("backup state without backup eligibility")
+	}
+	return nil
+}
+
+// VerifyRegistration checks a registration response against the challenge
+// issued for it. requireUV demands user verification (PIN or biometric).
+func (rp *RelyingParty) VerifyRegistration(challenge []byte, resp *CreationResponse, requireUV bool) (*Credential, error) {
+	if resp.Type != "public-key" {
+		return nil, verifyErr("credential type %q", resp.Type)
+	}
+	if err := rp.checkClientData(resp.Response.ClientDataJSON, "webauthn.create", challenge); err != nil {
+		return nil, err
+	}
+
+	obj, rest, err := decodeCBOR(resp.Response.AttestationObject)
+	if err != nil || len(rest) != 0 {
+		return nil, verifyErr("malformed attestation object")
+	}
+	att, ok := obj.(map[any]any)
+	if !ok {
+		return nil, verifyErr("malformed attestation object")
+	}
+	format, _ := att["fmt"].(string)
+	stmt, _ := att["attStmt"].(map[any]any)
+	rawAuthData, _ := att["authData"].([]byte)
+	if stmt == nil {
+		return nil, verifyErr("missing attestation statement")
+	}
+
+	ad, err := parseAuthenticatorData(rawAuthData)
+	if err != nil {
+		return nil, err
+	}
+	if err := rp.checkAuthenticatorData(ad, requireUV); err != nil {
+		return nil, err
+	}
+	if ad.credentialID == nil {
+		return nil, verifyErr("no attested credential data")
+	}
+	if len(resp.RawID) > 0 && !bytes.Equal(resp.RawID, ad.credentialID) {
+		return nil, verifyErr("rawId does not match the attested credential")
+	}
+	key, err := parsePublicKey(ad.publicKey)
+	if err != nil {
+		return nil, verifyErr("%v", err)
+	}
+
+	clientDataHash := sha256.Sum256(resp.Response.ClientDataJSON)
+	signed := append(bytes.Clone(rawAuthData), clientDataHash[:]...)
+	switch format {
+	case "none":
+		if len(stmt) != 0 {
+			return nil, verifyErr("none attestation with a statement")
+		}
+	case "packed":
+		if err := verifyPacked(stmt, key, signed); err != nil {
+			return nil, err
+		}
+	default:
+		return nil, verifyErr("unsupported attestation format %q", format)
+	}
+
+	return &Credential{
+		ID:             bytes.Clone(ad.credentialID),
+		PublicKey:      bytes.Clone(ad.publicKey),
+		Algorithm:      key.alg,
+		SignCount:      ad.signCount,
+		AAGUID:         bytes.Clone(ad.aaguid),
+		Transports:     resp.Response.Transports,
+		UserVerified:   ad.flags&flagUserVerified != 0,
+		BackupEligible: ad.flags&flagBackupEligible != 0,
+		BackedUp:       ad.flags&flagBackedUp != 0,
+	}, nil
+}
+
+// verifyPacked checks a packed attestation statement: a self attestation
+// signed by the credential key, or one signed by the certificate in x5c.
+func verifyPacked(stmt map[any]any, key *publicKey, signed []byte) error {
+	alg, _ := stmt["alg"].(int64)
+	sig, _ := stmt["sig"].([]byte)
+	if len(sig) == 0 {
+		return verifyErr("packed attestation without a signature")
+	}
+	x5c, hasCert := stmt["x5c"].([]any)
+	if !hasCert {
+		if alg != int64(key.alg) {
+			return verifyErr("self attestation algorithm mismatch")
+		}
+		if !key.verify(signed, sig) {
+			return verifyErr("bad self attestation signature")
+		}
+		return nil
+	}
+	if len(x5c) == 0 {
+		return verifyErr("empty x5c")
+	}
+	der, _ := x5c[0].([]byte)
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		return verifyErr("attestation certificate: %v", err)
+	}
+	sigAlg, ok := x509Algorithm(alg)
+	if !ok {
+		return verifyErr("unsupported attestation algorithm %d", alg)
+	}
+	if err := cert.CheckSignature(sigAlg, signed, sig); err != nil {
+		return verifyErr("bad attestation signature")
+	}
+	return nil
+}
+
+// VerifyAssertion checks an assertion against the challenge issued for it
+// and the stored credential. storedCount is the last sign count seen; a
+// count that does not increase signals a cloned authenticator, except that
+// authenticators without a counter always report zero.
+func (rp *RelyingParty) VerifyAssertion(challenge []byte, resp *AssertionResponse, cosePublicKey []byte, storedCount uint32, requireUV bool) (*Assertion, error) {
+	if resp.Type != "public-key" {
+		return nil, verifyErr("credential type %q", resp.Type)
+	}
+	if err := rp.checkClientData(resp.Response.ClientDataJSON, "webauthn.get", challenge); err != nil {
+		return nil, err
+	}
+	ad, err := parseAuthenticatorData(resp.Response.AuthenticatorData)
+	if err != nil {
+		return nil, err
+	}
+	if err := rp.checkAuthenticatorData(ad, requireUV); err != nil {
+		return nil, err
+	}
+	key, err := parsePublicKey(cosePublicKey)
+	if err != nil {
+		return nil, err
+	}
+	clientDataHash := sha256.Sum256(resp.Response.ClientDataJSON)
+	signed := append(bytes.Clone(ad.raw), clientDataHash[:]...)
+	if !key.verify(signed, resp.Response.Signature) {
+		return nil, verifyErr("bad signature")
+	}
+	if (ad.signCount != 0 || storedCount != 0) && ad.signCount <= storedCount {
+		return nil, verifyErr("sign count did not increase (%d <= %d); the authenticator may be cloned", ad.signCount, storedCount)
+	}
+	return &Assertion{
+		SignCount:    ad.signCount,
+		UserVerified: ad.flags&flagUserVerified != 0,
+		BackedUp:     ad.flags&flagBackedUp != 0,
+	}, nil
+}
@@ -0,0 +1,214 @@
+package webauthn
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/json"
+	"errors"
+	"testing"
+)
+
+var testRP = &RelyingParty{ID: "cloud.example.com", Name: "ZynqCloud", Origins: []string{"https://cloud.example.com"}}
+
+func challenge(t *testing.T) []byte {
+	t.Helper()
+	c := make([]byte, ChallengeLength)
+	if _, err := rand.Read(c); err != nil {
+		t.Fatal(err)
+	}
+	return c
+}
+
+func register(t *testing.T, a *Authenticator) *Credential {
+	t.Helper()
+	ch := challenge(t)
+	opts := testRP.CreationOptions(ch, UserEntity{ID: []byte("user-1"), Name: "ada@example.com", DisplayName: "Ada"}, nil, 60000)
+	resp, err := a.Create(opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cred, err := testRP.VerifyRegistration(ch, resp, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return cred
+}
+
+func TestCBORRoundTrip(t *testing.T) {
+	in := map[any]any{
+		int64(1):  int64(2),
+		int64(-7): []byte{1, 2, 3},
+		"fmt":     "none",
+		"list":    []any{int64(0), int64(-1000), int64(1 << 40), true, nil},
+	}
+	out, rest, err := decodeCBOR(encodeCBOR(in))
+	if err != nil || len(rest) != 0 {
+		t.Fatalf("decode: %v (%d trailing bytes)", err, len(rest))
+	}
+	m := out.(map[any]any)
+	if m[int64(1)] != int64(2) || m["fmt"] != "none" || !bytes.Equal(m[int64(-7)].([]byte), []byte{1, 2, 3}) {
+		t.Errorf("round trip mismatch: %#v", m)
+	}
+	list := m["list"].([]any)
+	if list[1] != int64(-1000) || list[2] != int64(1<<40) || list[3] != true || list[4] != nil {
+		t.Errorf("list mismatch: %#v", list)
+	}
+
+	for _, bad := range [][]byte{
+		{0x5f},       // indefinite byte string
+		{0x43, 1, 2}, // truncated byte string
+		{0x9b, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff}, // huge array
+		{0xa2, 0x01, 0x01, 0x01, 0x02},                         // duplicate key
+	} {
+		if _, _, err := decodeCBOR(bad); err == nil {
+			t.Errorf("decoded malformed input % x", bad)
+		}
+	}
+}
+
+func TestRegistrationAndAssertion(t *testing.T) {
+	for _, self := range []bool{false, true} {
+		a := NewAuthenticator("https://cloud.example.com")
+		a.SelfAttestation = self
+		cred := register(t, a)
+		if cred.Algorithm != AlgES256 || !cred.UserVerified || len(cred.ID) == 0 {
+			t.Fatalf("unexpected credential %+v", cred)
+		}
+
+		count := cred.SignCount
+		for i := 0; i < 2; i++ {
+			ch := challenge(t)
+			resp, err := a.Get(testRP.RequestOptions(ch, nil, "required", 60000))
+			if err != nil {
+				t.Fatal(err)
+			}
+			got, err := Challenge(resp.Response.ClientDataJSON)
+			if err != nil || !bytes.Equal(got, ch) {
+				t.Fatalf("Challenge() = %x, %v", got, err)
+			}
+			as, err := testRP.VerifyAssertion(ch, resp, cred.PublicKey, count, true)
+			if err != nil {
+				t.Fatal(err)
+			}
+			count = as.SignCount
+		}
+	}
+}
+
+func TestResponsesSurviveJSON(t *testing.T) {
+	a := NewAuthenticator("https://cloud.example.com")
+	ch := challenge(t)
+	opts := testRP.CreationOptions(ch, UserEntity{ID: []byte("user-1"), Name: "ada@example.com"}, nil, 0)
+
+	// The options go to the browser as JSON and the response comes back the
+	// same way.
+	raw, _ := json.Marshal(opts)
+	var sent CreationOptions
+	if err := json.Unmarshal(raw, &sent); err != nil {
+		t.Fatal(err)
+	}
+	resp, err := a.Create(&sent)
+	if err != nil {
+		t.Fatal(err)
+	}
+	raw, _ = json.Marshal(resp)
+	var back CreationResponse
+	if err := json.Unmarshal(raw, &back); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := testRP.VerifyRegistration(ch, &back, true); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestRegistrationRejected(t *testing.T) {
+	cases := map[string]func(a *Authenticator, rp *RelyingParty, ch []byte) ([]byte, bool){
+		"wrong challenge": func(a *Authenticator, rp *RelyingParty, ch []byte) ([]byte, bool) {
+			return challenge(t), true
+		},
+		"wrong origin": func(a *Authenticator, rp *RelyingParty, ch []byte) ([]byte, bool) {
+			a.Origin = "https://evil.example.net"
+			return ch, true
+		},
+		"wrong RP ID": func(a *Authenticator, rp *RelyingParty, ch []byte) ([]byte, bool) {
+			rp.ID = "example.org"
+			return ch, true
+		},
+		"no user verification": func(a *Authenticator, rp *RelyingParty, ch []byte) ([]byte, bool) {
+			a.UserVerification = false
+			return ch, true
+		},
+	}
+	for name, tweak := range cases {
+		t.Run(name, func(t *testing.T) {
+			a := NewAuthenticator("https://cloud.example.com")
+			rp := *testRP
+			ch := challenge(t)
+			verifyWith, requireUV := tweak(a, &rp, ch)
+			resp, err := a.Create(rp.CreationOptions(ch, UserEntity{ID: []byte("u")}, nil, 0))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if _, err := testRP.VerifyRegistration(verifyWith, resp, requireUV); !errors.Is(err, ErrVerification) {
+				t.Errorf("got %v, want a verification error", err)
+			}
+		})
+	}
+}
+
+func TestAssertionRejected(t *testing.T) {
+	a := NewAuthenticator("https://cloud.example.com")
+	cred := register(t, a)
+	ch := challenge(t)
+	resp, err := a.Get(testRP.RequestOptions(ch, nil, "required", 0))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := testRP.VerifyAssertion(challenge(t), resp, cred.PublicKey, 0, true); err == nil {
+		t.Error("assertion accepted for another challenge")
+	}
+	if _, err := testRP.VerifyAssertion(ch, resp, cred.PublicKey, 5, true); err == nil {
+		t.Error("assertion accepted with a sign count that went backwards")
+	}
+	other := register(t, NewAuthenticator("https://cloud.example.com"))
+	if _, err := testRP.VerifyAssertion(ch, resp, other.PublicKey, 0, true); err == nil {
+		t.Error("assertion accepted with another credential's key")
+	}
+	tampered := *resp
+	tampered.Response.AuthenticatorData = bytes.Clone(resp.Response.AuthenticatorData)
+	tampered.Response.AuthenticatorData[36]++
+	if _, err := testRP.VerifyAssertion(ch, &tampered, cred.PublicKey, 0, true); err == nil {
+		t.Error("assertion accepted with tampered authenticator data")
+	}
+	if _, err := testRP.VerifyAssertion(ch, resp, cred.PublicKey, 0, true); err != nil {
+		t.Errorf("valid assertion rejected: %v", err)
+	}
+
+	a.UserVerification = false
+	ch = challenge(t)
+	resp, _ = a.Get(testRP.RequestOptions(ch, nil, "discouraged", 0))
+	if _, err := testRP.VerifyAssertion(ch, resp, cred.PublicKey, 0, true); err == nil {
+		t.Error("assertion without user verification accepted where it is required")
+	}
+	if _, err := testRP.VerifyAssertion(ch, resp, cred.PublicKey, 0, false); err != nil {
+		t.Errorf("assertion without user verification rejected as a second factor: %v", err)
+	}
+}
+
+func TestEdDSAKey(t *testing.T) {
+	pub, priv, _ := ed25519.GenerateKey(rand.Reader)
+	cose := encodeCBOR(map[int]any{coseKty: coseKtyOKP, coseAlg: AlgEdDSA, coseEC2Crv: coseCrvEd25519, coseEC2X: []byte(pub)})
+	key, err := parsePublicKey(cose)
+	if err != nil {
+		t.Fatal(err)
+	}
+	msg := []byte("signed data")
+	if !key.verify(msg, ed25519.Sign(priv, msg)) {
+		t.Error("valid EdDSA signature rejected")
+	}
+	if key.verify([]byte("other data"), ed25519.Sign(priv, msg)) {
+		t.Error("EdDSA signature accepted for other data")
+	}
+}
@@ -0,0 +1,6 @@
+DROP TABLE IF EXISTS password_resets;
+DROP TABLE IF EXISTS settings;
+DROP TABLE IF EXISTS shares;
+DROP TABLE IF EXISTS files;
+DROP TABLE IF EXISTS invitations;
+DROP TABLE IF EXISTS users;
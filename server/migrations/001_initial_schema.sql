@@ -6,7 +6,7 @@ CREATE EXTENSION IF NOT EXISTS "uuid-ossp";
 -- ===========================================
 -- USERS
 -- ===========================================
-CREATE TABLE users (
+CREATE TABLE IF NOT EXISTS users (
   id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
   name TEXT NOT NULL,
   email TEXT UNIQUE NOT NULL,
@@ -21,7 +21,7 @@ CREATE TABLE users (
 -- ===========================================
 -- INVITATIONS
 -- ===========================================
-CREATE TABLE invitations (
+CREATE TABLE IF NOT EXISTS invitations (
   id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
   email TEXT NOT NULL,
   token UUID UNIQUE NOT NULL DEFAULT uuid_generate_v4(),
@@ -36,7 +36,7 @@ CREATE TABLE invitations (
 -- ===========================================
 -- FILES
 -- ===========================================
-CREATE TABLE files (
+CREATE TABLE IF NOT EXISTS files (
   id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
   owner_id UUID REFERENCES users(id) ON DELETE CASCADE NOT NULL,
   name TEXT NOT NULL,
@@ -57,7 +57,7 @@ CREATE TABLE files (
 -- ===========================================
 -- SHARES (includes public sharing support)
 -- ===========================================
-CREATE TABLE shares (
+CREATE TABLE IF NOT EXISTS shares (
   id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
   file_id UUID REFERENCES files(id) ON DELETE CASCADE NOT NULL,
   grantee_user_id UUID REFERENCES users(id) ON DELETE CASCADE,
@@ -75,7 +75,7 @@ CREATE TABLE shares (
 -- ===========================================
 -- SETTINGS
 -- ===========================================
-CREATE TABLE settings (
+CREATE TABLE IF NOT EXISTS settings (
   id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
   user_id UUID REFERENCES users(id) ON DELETE CASCADE,
   key TEXT NOT NULL,
@@ -87,7 +87,7 @@ CREATE TABLE settings (
 -- ===========================================
 -- PASSWORD RESETS
 -- ===========================================
-CREATE TABLE password_resets (
+CREATE TABLE IF NOT EXISTS password_resets (
   id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
   user_id UUID REFERENCES users(id) ON DELETE CASCADE NOT NULL,
   token VARCHAR UNIQUE NOT NULL,
@@ -100,16 +100,16 @@ CREATE TABLE password_resets (
 -- ===========================================
 -- INDEXES
 -- ===========================================
-CREATE INDEX idx_files_owner_id ON files(owner_id);
-CREATE INDEX idx_files_parent_id ON files(parent_id);
-CREATE INDEX idx_files_deleted_at ON files(deleted_at);
-CREATE INDEX idx_files_file_hash ON files(file_hash) WHERE file_hash IS NOT NULL;
-CREATE INDEX idx_shares_file_id ON shares(file_id);
-CREATE INDEX idx_shares_grantee_user_id ON shares(grantee_user_id);
-CREATE INDEX idx_shares_share_token ON shares(share_token);
-CREATE INDEX idx_shares_created_by_is_public ON shares(created_by, is_public);
-CREATE INDEX idx_invitations_token ON invitations(token);
-CREATE INDEX idx_invitations_status ON invitations(status);
-CREATE INDEX idx_settings_user_id_key ON settings(user_id, key);
-CREATE INDEX idx_password_resets_token ON password_resets(token);
-CREATE INDEX idx_password_resets_user_id ON password_resets(user_id);
+CREATE INDEX IF NOT EXISTS idx_files_owner_id ON files(owner_id);
+CREATE INDEX IF NOT EXISTS idx_files_parent_id ON files(parent_id);
+CREATE INDEX IF NOT EXISTS idx_files_deleted_at ON files(deleted_at);
+CREATE INDEX IF NOT EXISTS idx_files_file_hash ON files(file_hash) WHERE file_hash IS NOT NULL;
+CREATE INDEX IF NOT EXISTS idx_shares_file_id ON shares(file_id);
+CREATE INDEX IF NOT EXISTS idx_shares_grantee_user_id ON shares(grantee_user_id);
+CREATE INDEX IF NOT EXISTS idx_shares_share_token ON shares(share_token);
+CREATE INDEX IF NOT EXISTS idx_shares_created_by_is_public ON shares(created_by, is_public);
+CREATE INDEX IF NOT EXISTS idx_invitations_token ON invitations(token);
+CREATE INDEX IF NOT EXISTS idx_invitations_status ON invitations(status);
+CREATE INDEX IF NOT EXISTS idx_settings_user_id_key ON settings(user_id, key);
+CREATE INDEX IF NOT EXISTS idx_password_resets_token ON password_resets(token);
+CREATE INDEX IF NOT EXISTS idx_password_resets_user_id ON password_resets(user_id);
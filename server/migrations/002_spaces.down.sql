@@ -0,0 +1,4 @@
+ALTER TABLE files DROP COLUMN IF EXISTS space_id;
+DROP TABLE IF EXISTS space_activity;
+DROP TABLE IF EXISTS space_members;
+DROP TABLE IF EXISTS spaces;
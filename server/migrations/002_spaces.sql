@@ -1,7 +1,7 @@
 -- ===========================================
 -- SPACES
 -- ===========================================
-CREATE TABLE spaces (
+CREATE TABLE IF NOT EXISTS spaces (
   id          UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
   name        TEXT NOT NULL,
   description TEXT,
@@ -14,7 +14,7 @@ CREATE TABLE spaces (
 -- SPACE MEMBERS
 -- role: viewer | contributor | admin
 -- ===========================================
-CREATE TABLE space_members (
+CREATE TABLE IF NOT EXISTS space_members (
   space_id UUID NOT NULL REFERENCES spaces(id) ON DELETE CASCADE,
   user_id  UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
   role     TEXT NOT NULL DEFAULT 'contributor',
@@ -27,7 +27,7 @@ CREATE TABLE space_members (
 -- SPACE ACTIVITY (audit log)
 -- action: upload|delete|rename|move|member_added|member_role_changed|member_removed
 -- ===========================================
-CREATE TABLE space_activity (
+CREATE TABLE IF NOT EXISTS space_activity (
   id         UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
   space_id   UUID NOT NULL REFERENCES spaces(id) ON DELETE CASCADE,
   user_id    UUID REFERENCES users(id) ON DELETE SET NULL,
@@ -41,12 +41,12 @@ CREATE TABLE space_activity (
 -- ===========================================
 -- Add space_id to files (NULL = personal file)
 -- ===========================================
-ALTER TABLE files ADD COLUMN space_id UUID REFERENCES spaces(id) ON DELETE CASCADE;
+ALTER TABLE files ADD COLUMN IF NOT EXISTS space_id UUID REFERENCES spaces(id) ON DELETE CASCADE;
 
 -- ===========================================
 -- INDEXES
 -- ===========================================
-CREATE INDEX idx_files_space_id         ON files(space_id) WHERE space_id IS NOT NULL;
-CREATE INDEX idx_space_members_user_id  ON space_members(user_id);
-CREATE INDEX idx_space_activity_space   ON space_activity(space_id, created_at DESC);
-CREATE INDEX idx_space_activity_user    ON space_activity(user_id);
+CREATE INDEX IF NOT EXISTS idx_files_space_id         ON files(space_id) WHERE space_id IS NOT NULL;
+CREATE INDEX IF NOT EXISTS idx_space_members_user_id  ON space_members(user_id);
+CREATE INDEX IF NOT EXISTS idx_space_activity_space   ON space_activity(space_id, created_at DESC);
+CREATE INDEX IF NOT EXISTS idx_space_activity_user    ON space_activity(user_id);
@@ -0,0 +1,2 @@
+-- Data fix only: the corrected limits and column default are kept.
+SELECT 1;
@@ -0,0 +1,3 @@
+DROP INDEX IF EXISTS idx_files_blob_id;
+ALTER TABLE files DROP COLUMN IF EXISTS blob_id;
+DROP TABLE IF EXISTS blobs;
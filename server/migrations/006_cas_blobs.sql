@@ -0,0 +1,20 @@
+-- Content-addressable blob store. One row per unique encrypted blob; files
+-- reference a blob via files.blob_id. ref_count tracks how many file rows
+-- (including trashed ones) point at the blob; blobs at zero are garbage
+-- collected by the API after a grace period.
+CREATE TABLE IF NOT EXISTS blobs (
+    id              TEXT        PRIMARY KEY,
+    created_at      TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    updated_at      TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    storage_path    TEXT        NOT NULL,
+    size            BIGINT      NOT NULL DEFAULT 0,
+    encrypted_dek   BYTEA       NOT NULL,
+    encryption_iv   BYTEA       NOT NULL,
+    encryption_algo TEXT        NOT NULL DEFAULT 'AES-256-GCM-STREAM',
+    ref_count       INTEGER     NOT NULL DEFAULT 0
+);
+
+CREATE INDEX IF NOT EXISTS idx_blobs_unreferenced ON blobs (updated_at) WHERE ref_count <= 0;
+
+ALTER TABLE files ADD COLUMN IF NOT EXISTS blob_id TEXT REFERENCES blobs(id);
+CREATE INDEX IF NOT EXISTS idx_files_blob_id ON files(blob_id) WHERE blob_id IS NOT NULL;
@@ -0,0 +1,24 @@
+-- Previous contents of a file, kept each time it is overwritten. A version
+-- holds the reference on its blob that the file held before the overwrite.
+CREATE TABLE IF NOT EXISTS file_versions (
+    id              UUID        PRIMARY KEY DEFAULT uuid_generate_v4(),
+    created_at      TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    file_id         UUID        NOT NULL REFERENCES files(id) ON DELETE CASCADE,
+    version_number  INTEGER     NOT NULL,
+    uploaded_by     UUID        REFERENCES users(id) ON DELETE SET NULL,
+    blob_id         TEXT        REFERENCES blobs(id),
+    storage_path    TEXT,
+    encrypted_dek   BYTEA,
+    encryption_iv   BYTEA,
+    encryption_algo TEXT,
+    size            BIGINT      NOT NULL DEFAULT 0,
+    file_hash       VARCHAR,
+    mime_type       TEXT,
+    UNIQUE (file_id, version_number)
+);
+
+CREATE INDEX IF NOT EXISTS idx_file_versions_file_id    ON file_versions (file_id, version_number DESC);
+CREATE INDEX IF NOT EXISTS idx_file_versions_created_at ON file_versions (created_at);
+
+-- Who uploaded the current content (space members can overwrite others' files).
+ALTER TABLE files ADD COLUMN IF NOT EXISTS uploaded_by UUID REFERENCES users(id) ON DELETE SET NULL;
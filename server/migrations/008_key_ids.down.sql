@@ -0,0 +1,3 @@
+ALTER TABLE blobs         DROP COLUMN IF EXISTS key_id;
+ALTER TABLE file_versions DROP COLUMN IF EXISTS key_id;
+ALTER TABLE files         DROP COLUMN IF EXISTS key_id;
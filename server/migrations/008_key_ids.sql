@@ -0,0 +1,6 @@
+-- Identifies the master key (KEK) that wrapped each stored encrypted_dek, so
+-- a key rotation can find the rows it still has to re-wrap. NULL means the
+-- row predates key tracking and was wrapped with the first-boot key.
+ALTER TABLE files         ADD COLUMN IF NOT EXISTS key_id TEXT;
+ALTER TABLE file_versions ADD COLUMN IF NOT EXISTS key_id TEXT;
+ALTER TABLE blobs         ADD COLUMN IF NOT EXISTS key_id TEXT;
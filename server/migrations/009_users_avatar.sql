@@ -0,0 +1,2 @@
+-- User profile picture. Earlier releases added this column at API startup.
+ALTER TABLE users ADD COLUMN IF NOT EXISTS avatar TEXT;
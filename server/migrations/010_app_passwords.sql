@@ -0,0 +1,16 @@
+-- ===========================================
+-- APP PASSWORDS
+-- ===========================================
+-- Per-device passwords for clients that cannot do the browser login, such as
+-- WebDAV mounts. Only a SHA-256 hash of the generated secret is stored.
+CREATE TABLE IF NOT EXISTS app_passwords (
+  id           UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+  created_at   TIMESTAMPTZ NOT NULL DEFAULT now(),
+  user_id      UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+  name         TEXT NOT NULL,
+  token_hash   TEXT NOT NULL,
+  last_used_at TIMESTAMPTZ
+);
+
+CREATE UNIQUE INDEX IF NOT EXISTS idx_app_passwords_token_hash ON app_passwords(token_hash);
+CREATE INDEX IF NOT EXISTS idx_app_passwords_user_id ON app_passwords(user_id);
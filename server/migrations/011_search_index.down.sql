@@ -0,0 +1,2 @@
+DROP INDEX IF EXISTS idx_files_name_tsv;
+DROP TABLE IF EXISTS blob_search_index;
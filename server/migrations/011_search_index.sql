@@ -0,0 +1,15 @@
+-- Full-text search. File names are matched directly; document content is
+-- indexed per blob, so identical content shared by many files is extracted
+-- once. content_tsv holds keyed tokens (see crypto.SearchToken), never the
+-- words themselves, and key_id records which master key produced them so
+-- rows are rebuilt after a key rotation.
+CREATE TABLE IF NOT EXISTS blob_search_index (
+    blob_id     TEXT        PRIMARY KEY REFERENCES blobs(id) ON DELETE CASCADE,
+    key_id      TEXT        NOT NULL,
+    status      TEXT        NOT NULL,
+    content_tsv TSVECTOR,
+    indexed_at  TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS idx_blob_search_index_tsv ON blob_search_index USING GIN (content_tsv);
+CREATE INDEX IF NOT EXISTS idx_files_name_tsv ON files USING GIN (to_tsvector('simple', name)) WHERE deleted_at IS NULL;
@@ -0,0 +1,28 @@
+-- ===========================================
+-- TWO-FACTOR AUTHENTICATION (TOTP)
+-- ===========================================
+-- One row per user who has started TOTP enrollment. The secret has to be
+-- readable to check codes, so it is wrapped by the master key like a file DEK;
+-- the encrypted_dek/key_id column names let key rotation re-wrap it with the
+-- other keyed tables. enabled_at stays NULL until the first code is verified.
+-- last_counter is the last accepted time step, so a code cannot be replayed.
+CREATE TABLE IF NOT EXISTS user_totp (
+  id            UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+  created_at    TIMESTAMPTZ NOT NULL DEFAULT now(),
+  user_id       UUID NOT NULL UNIQUE REFERENCES users(id) ON DELETE CASCADE,
+  encrypted_dek BYTEA NOT NULL,
+  key_id        TEXT,
+  enabled_at    TIMESTAMPTZ,
+  last_counter  BIGINT NOT NULL DEFAULT 0
+);
+
+-- Single-use recovery codes, stored as SHA-256 hashes.
+CREATE TABLE IF NOT EXISTS totp_recovery_codes (
+  id         UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+  created_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+  user_id    UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+  code_hash  TEXT NOT NULL,
+  used_at    TIMESTAMPTZ
+);
+
+CREATE INDEX IF NOT EXISTS idx_totp_recovery_codes_user_id ON totp_recovery_codes(user_id);
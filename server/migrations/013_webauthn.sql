@@ -0,0 +1,24 @@
+-- ===========================================
+-- PASSKEYS (WEBAUTHN)
+-- ===========================================
+-- One row per registered authenticator. credential_id is the ID the browser
+-- presents at sign-in; public_key is the COSE key it signs with. sign_count
+-- is the last counter seen, so a cloned authenticator is detected when its
+-- counter falls behind. transports is a comma-separated hint list passed
+-- back to the browser.
+CREATE TABLE IF NOT EXISTS webauthn_credentials (
+  id              UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+  created_at      TIMESTAMPTZ NOT NULL DEFAULT now(),
+  user_id         UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+  name            VARCHAR(100) NOT NULL,
+  credential_id   BYTEA NOT NULL UNIQUE,
+  public_key      BYTEA NOT NULL,
+  sign_count      BIGINT NOT NULL DEFAULT 0,
+  aaguid          BYTEA,
+  transports      TEXT NOT NULL DEFAULT '',
+  backup_eligible BOOLEAN NOT NULL DEFAULT false,
+  backed_up       BOOLEAN NOT NULL DEFAULT false,
+  last_used_at    TIMESTAMPTZ
+);
+
+CREATE INDEX IF NOT EXISTS idx_webauthn_credentials_user_id ON webauthn_credentials(user_id);
@@ -0,0 +1,10 @@
+-- ===========================================
+-- SINGLE SIGN-ON (OPENID CONNECT)
+-- ===========================================
+-- Users signing in through an OpenID provider are linked by the provider's
+-- issuer and subject, which stay stable when the email address changes.
+ALTER TABLE users ADD COLUMN IF NOT EXISTS oidc_issuer TEXT;
+ALTER TABLE users ADD COLUMN IF NOT EXISTS oidc_subject TEXT;
+
+CREATE UNIQUE INDEX IF NOT EXISTS idx_users_oidc_identity
+  ON users(oidc_issuer, oidc_subject) WHERE oidc_subject IS NOT NULL;
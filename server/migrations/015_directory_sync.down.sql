@@ -0,0 +1,4 @@
+ALTER TABLE space_members DROP COLUMN IF EXISTS source;
+ALTER TABLE users DROP COLUMN IF EXISTS disabled_at;
+DROP INDEX IF EXISTS idx_users_ldap_id;
+ALTER TABLE users DROP COLUMN IF EXISTS ldap_id;
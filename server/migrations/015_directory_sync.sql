@@ -0,0 +1,17 @@
+-- ===========================================
+-- LDAP / ACTIVE DIRECTORY
+-- ===========================================
+-- Directory users are linked by an immutable entry ID (entryUUID,
+-- objectGUID) so renames and OU moves keep the same account.
+ALTER TABLE users ADD COLUMN IF NOT EXISTS ldap_id TEXT;
+
+CREATE UNIQUE INDEX IF NOT EXISTS idx_users_ldap_id
+  ON users(ldap_id) WHERE ldap_id IS NOT NULL;
+
+-- Accounts removed from the directory are disabled rather than deleted, so
+-- their files stay in place until an admin decides what to do with them.
+ALTER TABLE users ADD COLUMN IF NOT EXISTS disabled_at TIMESTAMPTZ;
+
+-- Memberships granted by a directory group. The sync only removes rows it
+-- created; memberships added by hand are left alone.
+ALTER TABLE space_members ADD COLUMN IF NOT EXISTS source VARCHAR(16);
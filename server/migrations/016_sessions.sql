@@ -0,0 +1,26 @@
+-- ===========================================
+-- SIGN-IN SESSIONS
+-- ===========================================
+-- One row per signed-in device. The row ID is the jti of every access token
+-- the session hands out, so revoking the row cuts off those tokens at once.
+-- refresh_hash is the SHA-256 of the current refresh token; the previous one
+-- is kept briefly so concurrent refreshes from the same browser succeed and
+-- a stale token replayed later is detected as theft.
+CREATE TABLE IF NOT EXISTS sessions (
+  id                UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+  created_at        TIMESTAMPTZ NOT NULL DEFAULT now(),
+  user_id           UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+  refresh_hash      VARCHAR(64) NOT NULL,
+  prev_refresh_hash VARCHAR(64),
+  rotated_at        TIMESTAMPTZ,
+  expires_at        TIMESTAMPTZ NOT NULL,
+  last_seen_at      TIMESTAMPTZ NOT NULL DEFAULT now(),
+  revoked_at        TIMESTAMPTZ,
+  ip_address        TEXT NOT NULL DEFAULT '',
+  user_agent        TEXT NOT NULL DEFAULT '',
+  device            VARCHAR(100) NOT NULL DEFAULT '',
+  auth_method       VARCHAR(20) NOT NULL DEFAULT ''
+);
+
+CREATE INDEX IF NOT EXISTS idx_sessions_user_id ON sessions(user_id);
+CREATE INDEX IF NOT EXISTS idx_sessions_expires_at ON sessions(expires_at);
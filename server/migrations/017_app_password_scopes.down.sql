@@ -0,0 +1,2 @@
+ALTER TABLE app_passwords DROP COLUMN IF EXISTS expires_at;
+ALTER TABLE app_passwords DROP COLUMN IF EXISTS scopes;
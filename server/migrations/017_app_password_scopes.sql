@@ -0,0 +1,11 @@
+-- ===========================================
+-- ACCESS TOKEN SCOPES AND EXPIRY
+-- ===========================================
+-- App passwords double as personal access tokens for the JSON API. scopes is
+-- a JSON array of the scopes granted; passwords created before scopes
+-- existed keep the file and space access WebDAV needs. expires_at is NULL
+-- for tokens that never expire.
+ALTER TABLE app_passwords ADD COLUMN IF NOT EXISTS scopes TEXT NOT NULL
+  DEFAULT '["files:read","files:write","spaces:read","spaces:write"]';
+ALTER TABLE app_passwords ALTER COLUMN scopes SET DEFAULT '[]';
+ALTER TABLE app_passwords ADD COLUMN IF NOT EXISTS expires_at TIMESTAMPTZ;
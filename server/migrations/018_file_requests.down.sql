@@ -0,0 +1,2 @@
+DROP TABLE IF EXISTS file_request_uploads;
+DROP TABLE IF EXISTS file_requests;
@@ -0,0 +1,46 @@
+-- ===========================================
+-- FILE REQUESTS
+-- ===========================================
+-- A file request is an upload-only public link into a folder, personal or in
+-- a space. Visitors can add files to the folder but never list or download
+-- anything, which is why these are kept apart from shares: no share endpoint
+-- can be pointed at one by mistake. password is an Argon2id hash like share
+-- passwords. max_files and max_file_size are 0 for no limit;
+-- allowed_extensions is a JSON array, empty for any file type that is not
+-- blocked outright. upload_count counts accepted uploads against max_files.
+CREATE TABLE IF NOT EXISTS file_requests (
+  id                 UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+  created_at         TIMESTAMPTZ NOT NULL DEFAULT now(),
+  updated_at         TIMESTAMPTZ NOT NULL DEFAULT now(),
+  created_by         UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+  folder_id          UUID NOT NULL REFERENCES files(id) ON DELETE CASCADE,
+  token              VARCHAR(64) NOT NULL UNIQUE,
+  title              VARCHAR(255) NOT NULL DEFAULT '',
+  message            TEXT NOT NULL DEFAULT '',
+  password           TEXT,
+  expires_at         TIMESTAMPTZ,
+  max_files          INTEGER NOT NULL DEFAULT 0,
+  max_file_size      BIGINT NOT NULL DEFAULT 0,
+  allowed_extensions TEXT NOT NULL DEFAULT '[]',
+  require_uploader   BOOLEAN NOT NULL DEFAULT false,
+  upload_count       INTEGER NOT NULL DEFAULT 0
+);
+
+CREATE INDEX IF NOT EXISTS idx_file_requests_created_by ON file_requests(created_by);
+CREATE INDEX IF NOT EXISTS idx_file_requests_folder_id ON file_requests(folder_id);
+
+-- One row per file received through a request, with what the visitor said
+-- about themselves. file_id is cleared when the file is deleted for good.
+CREATE TABLE IF NOT EXISTS file_request_uploads (
+  id              UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+  created_at      TIMESTAMPTZ NOT NULL DEFAULT now(),
+  request_id      UUID NOT NULL REFERENCES file_requests(id) ON DELETE CASCADE,
+  file_id         UUID REFERENCES files(id) ON DELETE SET NULL,
+  file_name       VARCHAR(255) NOT NULL,
+  size            BIGINT NOT NULL DEFAULT 0,
+  uploader_name   VARCHAR(255) NOT NULL DEFAULT '',
+  uploader_email  VARCHAR(255) NOT NULL DEFAULT '',
+  ip_address      TEXT NOT NULL DEFAULT ''
+);
+
+CREATE INDEX IF NOT EXISTS idx_file_request_uploads_request_id ON file_request_uploads(request_id);
@@ -0,0 +1,3 @@
+ALTER TABLE shares DROP COLUMN IF EXISTS download_count;
+ALTER TABLE shares DROP COLUMN IF EXISTS max_downloads;
+DROP TABLE IF EXISTS share_access_log;
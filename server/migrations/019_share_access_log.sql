@@ -0,0 +1,20 @@
+-- ===========================================
+-- SHARE ACCESS LOG AND DOWNLOAD LIMITS
+-- ===========================================
+-- Every hit on a public link is recorded with its outcome, for the share's
+-- owner to review. Rows go with their share.
+CREATE TABLE IF NOT EXISTS share_access_log (
+  id          UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+  created_at  TIMESTAMPTZ NOT NULL DEFAULT now(),
+  share_id    UUID NOT NULL REFERENCES shares(id) ON DELETE CASCADE,
+  outcome     VARCHAR(20) NOT NULL,
+  ip_address  TEXT NOT NULL DEFAULT '',
+  user_agent  TEXT NOT NULL DEFAULT ''
+);
+
+CREATE INDEX IF NOT EXISTS idx_share_access_log_share_created ON share_access_log(share_id, created_at DESC);
+
+-- max_downloads is NULL for no limit; a public link counts as expired once
+-- download_count reaches it. Raising the limit opens the link again.
+ALTER TABLE shares ADD COLUMN IF NOT EXISTS max_downloads INTEGER;
+ALTER TABLE shares ADD COLUMN IF NOT EXISTS download_count INTEGER NOT NULL DEFAULT 0;
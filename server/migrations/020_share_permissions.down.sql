@@ -0,0 +1,2 @@
+-- Unknown permissions were folded into read; there is nothing to restore.
+SELECT 1;
@@ -0,0 +1,8 @@
+-- ===========================================
+-- PRIVATE SHARE PERMISSIONS
+-- ===========================================
+-- Private shares grant one of read, comment, write or reshare, each including
+-- the ones before it. Shares created before the permission was validated may
+-- hold anything the client sent; they fall back to read.
+UPDATE shares SET permission = 'read'
+WHERE permission IS NULL OR permission NOT IN ('read', 'comment', 'write', 'reshare');
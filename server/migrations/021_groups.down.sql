@@ -0,0 +1,4 @@
+ALTER TABLE shares DROP COLUMN IF EXISTS grantee_group_id;
+DROP TABLE IF EXISTS space_group_members;
+DROP TABLE IF EXISTS user_group_members;
+DROP TABLE IF EXISTS user_groups;
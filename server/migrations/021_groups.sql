@@ -0,0 +1,51 @@
+-- ===========================================
+-- USER GROUPS
+-- ===========================================
+-- Groups are named sets of users that can be granted a share or a space
+-- role like a single user; a member gets the strongest of their own grants
+-- and their groups'. The table is user_groups because GROUPS is an SQL
+-- keyword. A group with sync_source set follows sync_group in the directory
+-- (ldap, a group DN or CN) or in the IdP's groups claim (oidc); the sync only
+-- adds and removes memberships it granted itself.
+CREATE TABLE IF NOT EXISTS user_groups (
+  id           UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+  created_at   TIMESTAMPTZ NOT NULL DEFAULT now(),
+  updated_at   TIMESTAMPTZ NOT NULL DEFAULT now(),
+  name         VARCHAR(255) NOT NULL,
+  description  TEXT NOT NULL DEFAULT '',
+  created_by   UUID REFERENCES users(id) ON DELETE SET NULL,
+  sync_source  VARCHAR(10),
+  sync_group   TEXT
+);
+
+CREATE UNIQUE INDEX IF NOT EXISTS idx_user_groups_name ON user_groups(LOWER(name));
+
+-- source is the sync ('ldap' or 'oidc') that added the membership, NULL for
+-- memberships added by hand.
+CREATE TABLE IF NOT EXISTS user_group_members (
+  group_id  UUID NOT NULL REFERENCES user_groups(id) ON DELETE CASCADE,
+  user_id   UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+  added_by  UUID REFERENCES users(id) ON DELETE SET NULL,
+  added_at  TIMESTAMPTZ NOT NULL DEFAULT now(),
+  source    VARCHAR(10),
+  PRIMARY KEY (group_id, user_id)
+);
+
+CREATE INDEX IF NOT EXISTS idx_user_group_members_user_id ON user_group_members(user_id);
+
+-- A group's role in a space, held by each of its members.
+CREATE TABLE IF NOT EXISTS space_group_members (
+  space_id  UUID NOT NULL REFERENCES spaces(id) ON DELETE CASCADE,
+  group_id  UUID NOT NULL REFERENCES user_groups(id) ON DELETE CASCADE,
+  role      VARCHAR(20) NOT NULL DEFAULT 'contributor',
+  added_by  UUID REFERENCES users(id) ON DELETE SET NULL,
+  added_at  TIMESTAMPTZ NOT NULL DEFAULT now(),
+  PRIMARY KEY (space_id, group_id)
+);
+
+CREATE INDEX IF NOT EXISTS idx_space_group_members_group_id ON space_group_members(group_id);
+
+-- A private share goes to a user, an email address or a group.
+ALTER TABLE shares ADD COLUMN IF NOT EXISTS grantee_group_id UUID REFERENCES user_groups(id) ON DELETE CASCADE;
+
+CREATE INDEX IF NOT EXISTS idx_shares_grantee_group_id ON shares(grantee_group_id);
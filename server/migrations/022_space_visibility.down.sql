@@ -0,0 +1,2 @@
+DROP TABLE IF EXISTS space_join_requests;
+ALTER TABLE spaces DROP COLUMN IF EXISTS visibility;
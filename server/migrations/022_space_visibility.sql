@@ -0,0 +1,25 @@
+-- ===========================================
+-- SPACE VISIBILITY AND JOIN REQUESTS
+-- ===========================================
+-- open spaces take every user (new users are enrolled automatically),
+-- discoverable spaces are listed to everyone but joined by request, and
+-- private spaces are invite-only and invisible to non-members. Existing
+-- spaces stay open, which is how they behaved so far.
+ALTER TABLE spaces ADD COLUMN IF NOT EXISTS visibility VARCHAR(20) NOT NULL DEFAULT 'open';
+
+-- A request to join a discoverable space, decided by a space admin. A user
+-- has at most one pending request per space.
+CREATE TABLE IF NOT EXISTS space_join_requests (
+  id          UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+  created_at  TIMESTAMPTZ NOT NULL DEFAULT now(),
+  space_id    UUID NOT NULL REFERENCES spaces(id) ON DELETE CASCADE,
+  user_id     UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+  message     TEXT NOT NULL DEFAULT '',
+  status      VARCHAR(20) NOT NULL DEFAULT 'pending',
+  decided_by  UUID REFERENCES users(id) ON DELETE SET NULL,
+  decided_at  TIMESTAMPTZ
+);
+
+CREATE UNIQUE INDEX IF NOT EXISTS idx_space_join_requests_pending
+  ON space_join_requests(space_id, user_id) WHERE status = 'pending';
+CREATE INDEX IF NOT EXISTS idx_space_join_requests_space_status ON space_join_requests(space_id, status);
@@ -0,0 +1,3 @@
+DROP INDEX IF EXISTS idx_files_space_trash;
+ALTER TABLE files DROP COLUMN IF EXISTS deleted_by;
+ALTER TABLE spaces DROP COLUMN IF EXISTS trash_retention_days;
@@ -0,0 +1,11 @@
+-- ===========================================
+-- SPACE TRASH
+-- ===========================================
+-- Deleted space files go to a per-space trash instead of being removed at
+-- once. deleted_by records who trashed an item, so they can restore it next
+-- to the space admins; the trash is purged after trash_retention_days.
+ALTER TABLE spaces ADD COLUMN IF NOT EXISTS trash_retention_days INTEGER NOT NULL DEFAULT 30;
+ALTER TABLE files ADD COLUMN IF NOT EXISTS deleted_by UUID REFERENCES users(id) ON DELETE SET NULL;
+
+CREATE INDEX IF NOT EXISTS idx_files_space_trash
+  ON files(space_id, deleted_at) WHERE space_id IS NOT NULL AND deleted_at IS NOT NULL;
@@ -0,0 +1,16 @@
+-- ===========================================
+-- FILE COMMENTS
+-- ===========================================
+-- Comments on personal files and folders. The owner and every grantee can
+-- read them; writing one needs the comment share permission or stronger.
+-- A comment outlives its author's account and goes with the file.
+CREATE TABLE IF NOT EXISTS file_comments (
+  id          UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+  created_at  TIMESTAMPTZ NOT NULL DEFAULT now(),
+  updated_at  TIMESTAMPTZ NOT NULL DEFAULT now(),
+  file_id     UUID NOT NULL REFERENCES files(id) ON DELETE CASCADE,
+  user_id     UUID REFERENCES users(id) ON DELETE SET NULL,
+  body        TEXT NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS idx_file_comments_file ON file_comments(file_id, created_at);
@@ -0,0 +1,11 @@
+// Package migrations embeds the SQL schema migrations into the API binary.
+//
+// Each migration is NNN_name.sql with an optional NNN_name.down.sql that
+// reverts it. Files are applied in version order by database.Migrator, which
+// records them in schema_migrations.
+package migrations
+
+import "embed"
+
+//go:embed *.sql
+var FS embed.FS
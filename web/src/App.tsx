@@ -7,6 +7,7 @@ import ForgotPasswordPage from './pages/auth/forgot-password';
 import ResetPasswordPage from './pages/auth/reset-password';
 import SetupPage from './pages/auth/setup';
 import PublicSharePage from './pages/share/public-share';
+import FileRequestPage from './pages/share/file-request';
 import DashboardLayout from './pages/dashboard/layout';
 import DashboardFilesPage from './pages/dashboard/files';
 import DashboardUploadsPage from './pages/dashboard/uploads';
@@ -44,6 +45,7 @@ export default function App() {
 
       {/* Public share (unauthenticated) */}
       <Route path="/share/:token" element={<PublicSharePage />} />
+      <Route path="/upload/:token" element={<FileRequestPage />} />
 
       {/* Protected dashboard — nested routes use <Outlet /> in layout */}
       <Route path="/dashboard" element={<DashboardLayout />}>
@@ -36,8 +36,9 @@ export const AuthProvider = ({ children }: { children: ReactNode }) => {
   const { pathname } = useLocation();
 
   const logout = useCallback(() => {
-    clearAuthToken();
+    // authApi.logout reads the stored refresh token before clearing it.
     authApi.logout().catch(() => {});
+    clearAuthToken();
     setUser(null);
     navigate('/login');
   }, [navigate]);
@@ -101,10 +102,10 @@ export const AuthProvider = ({ children }: { children: ReactNode }) => {
 
   const login = (userData: User & { token?: string }) => {
     if (userData.token) {
-      saveAuthToken(userData.token);
+      saveAuthToken(userData.token, userData.refreshToken);
     }
-    // Strip the token field before storing in state
-    const { token: _token, ...user } = userData;
+    // Strip the token fields before storing in state
+    const { token: _token, refreshToken: _refreshToken, ...user } = userData;
     setUser(user as User);
     setNeedsSetup(false);
   };
@@ -0,0 +1,211 @@
+import { useCallback, useEffect, useRef, useState } from 'react';
+import { motion } from 'framer-motion';
+import { Input } from '@/components/ui/input';
+import { Button } from '@/components/ui/button';
+import { CheckCircle2, Loader2, Upload, XCircle } from 'lucide-react';
+import { formatBytes } from '@/lib/auth';
+import { ApiError, publicApi } from '@/lib/api';
+import {
+  BackgroundDecor,
+  ErrorState,
+  LoadingState,
+  PasswordGate,
+  ZynqBrand,
+} from '@/features/share/components/public-share-view';
+
+type FileRequestInfo = Awaited<ReturnType<typeof publicApi.getFileRequest>>;
+
+interface QueuedFile {
+  file: File;
+  status: 'pending' | 'uploading' | 'done' | 'error';
+  error?: string;
+}
+
+// ── Upload-only page for a file request link ─────────────────────────────────
+export function FileRequestView({ token }: { token: string }) {
+  const [info, setInfo] = useState<FileRequestInfo | null>(null);
+  const [loading, setLoading] = useState(true);
+  const [error, setError] = useState('');
+  const [needsPassword, setNeedsPassword] = useState(false);
+  const [password, setPassword] = useState('');
+  const [passwordInput, setPasswordInput] = useState('');
+  const [uploaderName, setUploaderName] = useState('');
+  const [uploaderEmail, setUploaderEmail] = useState('');
+  const [queue, setQueue] = useState<QueuedFile[]>([]);
+  const [uploading, setUploading] = useState(false);
+  const inputRef = useRef<HTMLInputElement>(null);
+
+  const fetchInfo = useCallback(async () => {
+    setLoading(true);
+    setError('');
+    setNeedsPassword(false);
+    try {
+      setInfo(await publicApi.getFileRequest(token, password || undefined));
+    } catch (err) {
+      setInfo(null);
+      if (err instanceof ApiError && err.statusCode === 401) {
+        setNeedsPassword(true);
+        setError(password ? 'Incorrect password. Please try again.' : 'This share is password protected.');
+      } else if (err instanceof ApiError && err.statusCode === 429) {
+        setNeedsPassword(true);
+        setError(err.message || 'Too many password attempts. Try again shortly.');
+      } else {
+        setError(err instanceof ApiError && err.statusCode === 410 ? err.message : 'This link is invalid or has expired.');
+      }
+    } finally {
+      setLoading(false);
+    }
+  }, [password, token]);
+
+  useEffect(() => {
+    void fetchInfo();
+  }, [fetchInfo]);
+
+  const setStatus = (index: number, patch: Partial<QueuedFile>) =>
+    setQueue((q) => q.map((item, i) => (i === index ? { ...item, ...patch } : item)));
+
+  const handleUpload = async () => {
+    setUploading(true);
+    for (let i = 0; i < queue.length; i++) {
+      if (queue[i].status === 'done') continue;
+      setStatus(i, { status: 'uploading', error: undefined });
+      try {
+        await publicApi.uploadToFileRequest(
+          token,
+          queue[i].file,
+          { name: uploaderName.trim(), email: uploaderEmail.trim() },
+          password || undefined,
+        );
+        setStatus(i, { status: 'done' });
+      } catch (err) {
+        setStatus(i, {
+          status: 'error',
+          error: err instanceof ApiError ? err.message : 'Upload failed',
+        });
+      }
+    }
+    setUploading(false);
+  };
+
+  if (loading) return <LoadingState />;
+  if (error && !needsPassword) return <ErrorState message={error} />;
+  if (needsPassword || !info) {
+    return (
+      <PasswordGate
+        error={error}
+        value={passwordInput}
+        onChange={setPasswordInput}
+        onSubmit={() => setPassword(passwordInput.trim())}
+      />
+    );
+  }
+
+  const remaining = info.maxFiles > 0 ? Math.max(info.maxFiles - info.uploadCount, 0) : null;
+  const missingUploader = info.requireUploader && (!uploaderName.trim() || !uploaderEmail.trim());
+  const pending = queue.some((q) => q.status !== 'done');
+  const accept = info.allowedExtensions.length
+    ? info.allowedExtensions.map((e) => `.${e}`).join(',')
+    : undefined;
+
+  return (
+    <div className="min-h-screen flex flex-col items-center justify-center bg-background p-4">
+      <BackgroundDecor />
+      <motion.div
+        initial={{ opacity: 0, y: 16 }}
+        animate={{ opacity: 1, y: 0 }}
+        className="relative z-10 w-full max-w-md"
+      >
+        <div className="flex justify-center mb-5">
+          <ZynqBrand />
+        </div>
+
+        <div className="rounded-2xl border border-border/60 bg-background/80 backdrop-blur-xl shadow-2xl shadow-black/10 p-6 space-y-5">
+          <div className="space-y-1 text-center">
+            <h1 className="text-[15px] font-semibold break-all">{info.title || 'Upload files'}</h1>
+            {info.owner && (
+              <p className="text-sm text-muted-foreground">{info.owner} is requesting files</p>
+            )}
+            {info.message && (
+              <p className="text-sm text-muted-foreground whitespace-pre-line pt-2">{info.message}</p>
+            )}
+          </div>
+
+          <ul className="text-xs text-muted-foreground space-y-0.5">
+            {remaining !== null && <li>{remaining} file{remaining === 1 ? '' : 's'} remaining</li>}
+            {info.maxFileSize > 0 && <li>Up to {formatBytes(info.maxFileSize)} per file</li>}
+            {info.allowedExtensions.length > 0 && (
+              <li>Accepted types: {info.allowedExtensions.map((e) => `.${e}`).join(', ')}</li>
+            )}
+            {info.expiresAt && <li>Open until {new Date(info.expiresAt).toLocaleString()}</li>}
+          </ul>
+
+          <div className="space-y-2">
+            <Input
+              placeholder={info.requireUploader ? 'Your name' : 'Your name (optional)'}
+              value={uploaderName}
+              onChange={(e) => setUploaderName(e.target.value)}
+              maxLength={255}
+            />
+            <Input
+              type="email"
+              placeholder={info.requireUploader ? 'Your email' : 'Your email (optional)'}
+              value={uploaderEmail}
+              onChange={(e) => setUploaderEmail(e.target.value)}
+              maxLength={255}
+            />
+          </div>
+
+          <input
+            ref={inputRef}
+            type="file"
+            multiple
+            accept={accept}
+            className="hidden"
+            onChange={(e) => {
+              const files = Array.from(e.target.files ?? []);
+              setQueue((q) => [...q, ...files.map((file) => ({ file, status: 'pending' as const }))]);
+              e.target.value = '';
+            }}
+          />
+          <Button
+            variant="outline"
+            className="w-full h-10"
+            disabled={uploading || remaining === 0}
+            onClick={() => inputRef.current?.click()}
+          >
+            Choose files
+          </Button>
+
+          {queue.length > 0 && (
+            <ul className="space-y-1.5 max-h-60 overflow-y-auto">
+              {queue.map((item, i) => (
+                <li key={`${item.file.name}-${i}`} className="flex items-center gap-2 text-xs">
+                  {item.status === 'uploading' && <Loader2 className="h-3.5 w-3.5 animate-spin" />}
+                  {item.status === 'done' && <CheckCircle2 className="h-3.5 w-3.5 text-green-600" />}
+                  {item.status === 'error' && <XCircle className="h-3.5 w-3.5 text-destructive" />}
+                  {item.status === 'pending' && <Upload className="h-3.5 w-3.5 text-muted-foreground" />}
+                  <span className="truncate flex-1" title={item.file.name}>{item.file.name}</span>
+                  <span className="text-muted-foreground tabular-nums">
+                    {item.error ?? formatBytes(item.file.size)}
+                  </span>
+                </li>
+              ))}
+            </ul>
+          )}
+
+          <Button
+            className="w-full h-10 gap-2"
+            disabled={uploading || !pending || missingUploader}
+            onClick={handleUpload}
+          >
+            {uploading ? <Loader2 className="h-4 w-4 animate-spin" /> : <Upload className="h-4 w-4" />}
+            {uploading ? 'Uploading…' : 'Upload'}
+          </Button>
+          <p className="text-[11px] text-center text-muted-foreground/60">
+            Files you upload are only visible to the person who sent you this link.
+          </p>
+        </div>
+      </motion.div>
+    </div>
+  );
+}
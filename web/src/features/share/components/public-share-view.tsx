@@ -27,7 +27,7 @@ interface PublicShareViewProps {
 }
 
 // ── Branding ──────────────────────────────────────────────────────────────────
-function ZynqBrand() {
+export function ZynqBrand() {
   return (
     <div className="flex items-center gap-2">
       <div className="w-6 h-6 rounded-md bg-white flex items-center justify-center shadow-sm">
@@ -39,7 +39,7 @@ function ZynqBrand() {
 }
 
 // ── Background decoration ─────────────────────────────────────────────────────
-function BackgroundDecor() {
+export function BackgroundDecor() {
   return (
     <div className="fixed inset-0 pointer-events-none overflow-hidden" aria-hidden>
       {/* Primary blobs */}
@@ -59,7 +59,7 @@ function BackgroundDecor() {
 }
 
 // ── Loading state ─────────────────────────────────────────────────────────────
-function LoadingState() {
+export function LoadingState() {
   return (
     <div className="min-h-screen flex items-center justify-center bg-background">
       <BackgroundDecor />
@@ -78,7 +78,7 @@ function LoadingState() {
 }
 
 // ── Error state ───────────────────────────────────────────────────────────────
-function ErrorState({ message }: { message: string }) {
+export function ErrorState({ message }: { message: string }) {
   return (
     <div className="min-h-screen flex items-center justify-center bg-background p-4">
       <BackgroundDecor />
@@ -101,7 +101,7 @@ function ErrorState({ message }: { message: string }) {
 }
 
 // ── Password gate ─────────────────────────────────────────────────────────────
-function PasswordGate({
+export function PasswordGate({
   error,
   value,
   onChange,
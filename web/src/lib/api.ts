@@ -9,19 +9,33 @@
 // HttpOnly cookie is dropped (e.g. plain-HTTP LAN / Tailscale access when
 // COOKIE_SECURE=true). The middleware checks Authorization: Bearer first,
 // then falls back to the cookie, so both paths are always supported.
+//
+// The access token is short-lived. When it expires the client trades the
+// refresh token (an HttpOnly cookie, or the stored copy below) for a new one.
 
 const TOKEN_KEY = 'zynq_token';
+const REFRESH_KEY = 'zynq_refresh';
 
-export function saveAuthToken(token: string): void {
-  try { localStorage.setItem(TOKEN_KEY, token); } catch { /* incognito / storage full */ }
+export function saveAuthToken(token: string, refreshToken?: string): void {
+  try {
+    localStorage.setItem(TOKEN_KEY, token);
+    if (refreshToken) localStorage.setItem(REFRESH_KEY, refreshToken);
+  } catch { /* incognito / storage full */ }
 }
 
 export function getAuthToken(): string | null {
   try { return localStorage.getItem(TOKEN_KEY); } catch { return null; }
 }
 
+function getRefreshToken(): string | null {
+  try { return localStorage.getItem(REFRESH_KEY); } catch { return null; }
+}
+
 export function clearAuthToken(): void {
-  try { localStorage.removeItem(TOKEN_KEY); } catch { /* ignore */ }
+  try {
+    localStorage.removeItem(TOKEN_KEY);
+    localStorage.removeItem(REFRESH_KEY);
+  } catch { /* ignore */ }
 }
 
 function trimTrailingSlash(value: string): string {
@@ -96,6 +110,7 @@ export interface User {
   created_at?: string;
   avatar?: string;
   token?: string; // present only in login/register responses; not stored in state
+  refreshToken?: string; // likewise
 }
 
 export interface ShareableUser {
@@ -117,6 +132,8 @@ export interface FileMetadata {
   is_folder: boolean;
   file_hash?: string;
   deleted_at?: string | null;
+  deleted_by?: string;
+  deleter?: { id: string; name: string; email: string };
   created_at: string;
   updated_at: string;
   shareCount?: number;
@@ -137,13 +154,18 @@ export interface UploadSessionInfo {
   completeUrl: string;
 }
 
+/** Private share permissions, weakest first; each includes the ones before it. */
+export type SharePermission = 'read' | 'comment' | 'write' | 'reshare';
+
 export interface Share {
   id: string;
   file_id: string;
   grantee_user_id?: string;
   grantee_email?: string;
   grantee_user?: { id: string; name: string; email: string };
-  permission: 'read' | 'write';
+  grantee_group_id?: string;
+  grantee_group?: { id: string; name: string };
+  permission: SharePermission;
   created_by: string;
   created_at: string;
   file?: FileMetadata;
@@ -152,6 +174,37 @@ export interface Share {
   publicLink?: string | null;
   expires_at?: string | null;
   hasPassword?: boolean;
+  max_downloads?: number | null;
+  download_count?: number;
+}
+
+/** A comment on a personal file or folder. */
+export interface FileComment {
+  id: string;
+  created_at: string;
+  updated_at: string;
+  file_id: string;
+  user_id?: string;
+  user?: { id: string; name: string; email: string };
+  body: string;
+}
+
+export type ShareAccessOutcome =
+  | 'viewed'
+  | 'downloaded'
+  | 'password_required'
+  | 'wrong_password'
+  | 'locked_out'
+  | 'expired';
+
+/** One hit on a public link. */
+export interface ShareAccess {
+  id: string;
+  created_at: string;
+  share_id: string;
+  outcome: ShareAccessOutcome;
+  ip_address: string;
+  user_agent: string;
 }
 
 export interface Invitation {
@@ -305,9 +358,44 @@ function getFileNameFromDisposition(
   return fallback;
 }
 
+let refreshing: Promise<boolean> | null = null;
+
+/**
+ * Trades the refresh token for a new access token. Concurrent callers share
+ * one request, since the server rotates the refresh token on every use.
+ * Resolves false when the session has ended.
+ */
+export function refreshSession(): Promise<boolean> {
+  if (!refreshing) {
+    const refreshToken = getRefreshToken();
+    refreshing = fetch(`${getApiBaseUrl()}/auth/refresh`, {
+      method: 'POST',
+      headers: { 'Content-Type': 'application/json' },
+      body: refreshToken ? JSON.stringify({ refreshToken }) : undefined,
+      credentials: 'include',
+    })
+      .then(async (response) => {
+        if (!response.ok) return false;
+        const data = (await response.json()) as { token: string; refreshToken?: string };
+        saveAuthToken(data.token, data.refreshToken);
+        return true;
+      })
+      .catch(() => false)
+      .finally(() => {
+        refreshing = null;
+      });
+  }
+  return refreshing;
+}
+
+// Endpoints whose 401 means bad credentials or a share password, not an
+// expired access token.
+const NO_REFRESH = ['/auth/login', '/auth/register', '/auth/refresh', '/auth/logout', '/auth/passkeys/login', '/public/', '/shares/'];
+
 async function fetchApi<T>(
   endpoint: string,
   options: RequestInit = {},
+  retried = false,
 ): Promise<T> {
   const token = getAuthToken();
   const headers: Record<string, string> = {
@@ -331,6 +419,15 @@ async function fetchApi<T>(
     });
   }
 
+  if (
+    response.status === 401 &&
+    !retried &&
+    !NO_REFRESH.some((prefix) => endpoint.startsWith(prefix)) &&
+    (await refreshSession())
+  ) {
+    return fetchApi<T>(endpoint, options, true);
+  }
+
   if (!response.ok) {
     throw await toApiError(response);
   }
@@ -368,8 +465,12 @@ export const authApi = {
     }),
 
   logout: () => {
+    const refreshToken = getRefreshToken();
     clearAuthToken();
-    return fetchApi<{ success: boolean }>('/auth/logout', { method: 'POST' });
+    return fetchApi<{ success: boolean }>('/auth/logout', {
+      method: 'POST',
+      body: refreshToken ? JSON.stringify({ refreshToken }) : undefined,
+    });
   },
 
   me: () => fetchApi<User>('/auth/me'),
@@ -408,6 +509,50 @@ export const authApi = {
     fetchApi<{ message: string }>('/auth/avatar', { method: 'DELETE' }),
 };
 
+/** An upload-only link into a folder. */
+export interface FileRequest {
+  id: string;
+  created_at: string;
+  folder_id: string;
+  folder?: FileMetadata;
+  token: string;
+  title: string;
+  message: string;
+  expires_at: string | null;
+  max_files: number;
+  max_file_size: number;
+  allowed_extensions: string[];
+  require_uploader: boolean;
+  upload_count: number;
+  hasPassword: boolean;
+  publicLink: string;
+}
+
+/** Settings of a file request; fields left out are not changed. */
+export interface FileRequestInput {
+  title?: string;
+  message?: string;
+  /** An empty string removes the password. */
+  password?: string;
+  expiresAt?: string;
+  noExpiry?: boolean;
+  maxFiles?: number;
+  maxFileSize?: number;
+  allowedExtensions?: string[];
+  requireUploader?: boolean;
+}
+
+export interface FileRequestUpload {
+  id: string;
+  created_at: string;
+  file_id: string | null;
+  file_name: string;
+  size: number;
+  uploader_name: string;
+  uploader_email: string;
+  ip_address: string;
+}
+
 /** File API: CRUD, upload, download, share, trash operations */
 export const fileApi = {
   list: (params: {
@@ -539,12 +684,14 @@ export const fileApi = {
   share: (
     id: string,
     data: {
-      toUserId?: string;
-      email?: string;
-      permission: 'read' | 'write';
+      granteeUserId?: string;
+      granteeEmail?: string;
+      granteeGroupId?: string;
+      permission: SharePermission;
       isPublic?: boolean;
       expiresAt?: string;
       password?: string;
+      maxDownloads?: number;
     },
   ) =>
     fetchApi<Share>(`/files/${id}/share`, {
@@ -552,6 +699,22 @@ export const fileApi = {
       body: JSON.stringify(data),
     }),
 
+  listComments: (id: string, page = 1, limit = 50) =>
+    fetchApi<PaginatedResponse<FileComment>>(
+      `/files/${id}/comments?page=${page}&limit=${limit}`,
+    ),
+
+  addComment: (id: string, body: string) =>
+    fetchApi<FileComment>(`/files/${id}/comments`, {
+      method: 'POST',
+      body: JSON.stringify({ body }),
+    }),
+
+  deleteComment: (id: string, commentId: string) =>
+    fetchApi<{ message: string }>(`/files/${id}/comments/${commentId}`, {
+      method: 'DELETE',
+    }),
+
   getShared: (page = 1, limit = 50) =>
     fetchApi<{
       items: Share[];
@@ -574,6 +737,8 @@ export const fileApi = {
       password?: string;
       clearPassword?: boolean;
       clearExpiry?: boolean;
+      /** 0 removes the download limit. */
+      maxDownloads?: number;
     },
   ) =>
     fetchApi<Share & { publicLink: string }>(
@@ -584,6 +749,35 @@ export const fileApi = {
       },
     ),
 
+  getShareAccessLog: (shareId: string, page = 1, limit = 50, outcome?: ShareAccessOutcome) =>
+    fetchApi<{
+      items: ShareAccess[];
+      summary: Partial<Record<ShareAccessOutcome, number>>;
+      downloadCount: number;
+      maxDownloads: number | null;
+      meta: { total: number; page: number; limit: number };
+    }>(
+      `/files/public-shares/${shareId}/access?page=${page}&limit=${limit}${outcome ? `&outcome=${outcome}` : ''}`,
+    ),
+  getFileRequests: () => fetchApi<FileRequest[]>('/files/file-requests'),
+  createFileRequest: (data: FileRequestInput & { folderId: string }) =>
+    fetchApi<FileRequest>('/files/file-requests', {
+      method: 'POST',
+      body: JSON.stringify(data),
+    }),
+  updateFileRequest: (id: string, data: FileRequestInput) =>
+    fetchApi<FileRequest>(`/files/file-requests/${id}`, {
+      method: 'PATCH',
+      body: JSON.stringify(data),
+    }),
+  deleteFileRequest: (id: string) =>
+    fetchApi<{ message: string }>(`/files/file-requests/${id}`, { method: 'DELETE' }),
+  getFileRequestUploads: (id: string, page = 1, limit = 50) =>
+    fetchApi<{
+      items: FileRequestUpload[];
+      meta: { total: number; page: number; limit: number };
+    }>(`/files/file-requests/${id}/uploads?page=${page}&limit=${limit}`),
+
   downloadShared: (shareId: string) => {
     const url = `${getApiBaseUrl()}/files/shares/${shareId}/download`;
     const a = document.createElement('a');
@@ -724,6 +918,63 @@ export const userApi = {
   },
 };
 
+// ── Groups ────────────────────────────────────────────────────────────────────
+
+export interface Group {
+  id: string;
+  name: string;
+  description: string;
+  created_by?: string;
+  /** Set when the membership follows a directory group or the IdP's groups claim. */
+  sync_source?: 'ldap' | 'oidc';
+  sync_group?: string;
+  member_count: number;
+  created_at: string;
+  updated_at: string;
+}
+
+export interface GroupMember {
+  group_id: string;
+  user_id: string;
+  added_by?: string;
+  added_at: string;
+  /** The sync that added the member; absent for members added by hand. */
+  source?: 'ldap' | 'oidc';
+  user?: { id: string; name: string; email: string };
+}
+
+export interface GroupInput {
+  name?: string;
+  description?: string;
+  /** Empty string stops syncing. */
+  syncSource?: 'ldap' | 'oidc' | '';
+  syncGroup?: string;
+}
+
+/** Groups API: everyone can list groups; the rest is admin only */
+export const groupApi = {
+  list: (query?: string) => {
+    const params = new URLSearchParams();
+    if (query) params.append('q', query);
+    const suffix = params.toString() ? `?${params}` : '';
+    return fetchApi<Group[]>(`/groups${suffix}`);
+  },
+  create: (data: GroupInput) =>
+    fetchApi<Group>('/groups', { method: 'POST', body: JSON.stringify(data) }),
+  update: (id: string, data: GroupInput) =>
+    fetchApi<Group>(`/groups/${id}`, { method: 'PATCH', body: JSON.stringify(data) }),
+  delete: (id: string) =>
+    fetchApi<{ message: string }>(`/groups/${id}`, { method: 'DELETE' }),
+  listMembers: (id: string) => fetchApi<GroupMember[]>(`/groups/${id}/members`),
+  addMembers: (id: string, userIds: string[]) =>
+    fetchApi<{ added: number }>(`/groups/${id}/members`, {
+      method: 'POST',
+      body: JSON.stringify({ userIds }),
+    }),
+  removeMember: (id: string, userId: string) =>
+    fetchApi<{ message: string }>(`/groups/${id}/members/${userId}`, { method: 'DELETE' }),
+};
+
 /** Settings API: user preferences */
 export const settingsApi = {
   get: () => fetchApi<Record<string, unknown>>('/settings'),
@@ -811,6 +1062,7 @@ export interface NotificationChannel {
 export const ALL_NOTIFICATION_ACTIONS = [
   { id: 'file_uploaded',    label: 'File Uploaded',    description: 'Triggered when a file is uploaded' },
   { id: 'file_shared',      label: 'File Shared',      description: 'Triggered when a file is shared' },
+  { id: 'file_request_upload', label: 'File Request Upload', description: 'Triggered when someone uploads through a file request link' },
   { id: 'user_invited',     label: 'User Invited',     description: 'Triggered when an invitation is sent' },
   { id: 'user_registered',  label: 'User Registered',  description: 'Triggered when a new user registers' },
   { id: 'storage_warning',  label: 'Storage Warning',  description: 'Triggered when user storage exceeds 75%' },
@@ -866,12 +1118,20 @@ export const notificationChannelApi = {
     }),
 };
 
+// Share sessions earned by unlocking a password-protected share, by share
+// token. Once we hold one the password is not sent again; the server also
+// sets it as a cookie, this copy covers browsers that drop the cookie.
+const shareSessions = new Map<string, string>();
+
+function shareHeaders(token: string, password?: string): HeadersInit | undefined {
+  const session = shareSessions.get(token);
+  if (session) return { 'x-share-session': session };
+  return password ? { 'x-share-password': password } : undefined;
+}
+
 /** Public API: anonymous access to shared files */
 export const publicApi = {
   getShare: async (token: string, password?: string) => {
-    const headers = password
-      ? ({ 'x-share-password': password } as HeadersInit)
-      : undefined;
     const data = await fetchApi<{
       id: string;
       name: string;
@@ -882,41 +1142,141 @@ export const publicApi = {
       createdAt: string;
       isFolder: boolean;
       hasContent: boolean;
-    }>(`/public/share/${token}`, { headers });
+      shareSession?: string;
+    }>(`/public/share/${token}`, { headers: shareHeaders(token, password) }).catch((err) => {
+      // The session ended (e.g. the password changed); ask for it again.
+      if (err instanceof ApiError && err.statusCode === 401) shareSessions.delete(token);
+      throw err;
+    });
+    if (data.shareSession) shareSessions.set(token, data.shareSession);
     return {
       ...data,
       size: toNumber(data.size, 0),
     };
   },
 
-  downloadShare: async (token: string, password?: string) => {
-    const headers = password
-      ? ({ 'x-share-password': password } as HeadersInit)
-      : undefined;
-    const response = await fetch(
-      `${getApiBaseUrl()}/public/share/${token}/download`,
-      { headers },
-    );
+  downloadShare: (token: string, password?: string, ids?: string[]) => {
+    const query = ids?.length ? `?ids=${ids.map(encodeURIComponent).join(',')}` : '';
+    return fetchShareBlob(token, `/public/share/${token}/download${query}`, password);
+  },
 
+  /** Lists a folder inside a public folder share (the shared folder by default). */
+  listShare: (
+    token: string,
+    opts: { parentId?: string; recursive?: boolean; page?: number; limit?: number } = {},
+    password?: string,
+  ) => {
+    const params = new URLSearchParams({
+      page: String(opts.page ?? 1),
+      limit: String(opts.limit ?? 50),
+    });
+    if (opts.parentId) params.set('parentId', opts.parentId);
+    if (opts.recursive) params.set('recursive', 'true');
+    return fetchApi<{
+      items: PublicShareItem[];
+      meta: { total: number; page: number; limit: number };
+    }>(`/public/share/${token}/items?${params}`, {
+      headers: shareHeaders(token, password),
+    }).catch((err) => {
+      if (err instanceof ApiError && err.statusCode === 401) shareSessions.delete(token);
+      throw err;
+    });
+  },
+
+  /** Opens a file request (upload-only link). */
+  getFileRequest: async (token: string, password?: string) => {
+    const data = await fetchApi<{
+      id: string;
+      title: string;
+      message: string;
+      owner: string;
+      hasPassword: boolean;
+      expiresAt: string | null;
+      maxFiles: number;
+      uploadCount: number;
+      maxFileSize: number;
+      allowedExtensions: string[];
+      requireUploader: boolean;
+      shareSession?: string;
+    }>(`/public/upload/${token}`, { headers: shareHeaders(token, password) }).catch((err) => {
+      if (err instanceof ApiError && err.statusCode === 401) shareSessions.delete(token);
+      throw err;
+    });
+    if (data.shareSession) shareSessions.set(token, data.shareSession);
+    return data;
+  },
+
+  /** Uploads one file through a file request. */
+  uploadToFileRequest: async (
+    token: string,
+    file: File,
+    uploader: { name?: string; email?: string } = {},
+    password?: string,
+  ) => {
+    // The server reads the uploader fields before the file part.
+    const form = new FormData();
+    if (uploader.name) form.append('uploaderName', uploader.name);
+    if (uploader.email) form.append('uploaderEmail', uploader.email);
+    form.append('file', file, file.name);
+    const response = await fetch(`${getApiBaseUrl()}/public/upload/${token}`, {
+      method: 'POST',
+      body: form,
+      headers: shareHeaders(token, password),
+      credentials: 'include',
+    });
+    if (response.status === 401) shareSessions.delete(token);
     if (!response.ok) {
       throw await toApiError(response);
     }
-
-    const blob = await response.blob();
-    const fileName = getFileNameFromDisposition(
-      response.headers.get('Content-Disposition'),
-    );
-
-    return { blob, fileName };
+    return (await response.json()) as { name: string; size: number };
   },
+
+  /** Downloads one item inside a public folder share; folders come as a ZIP. */
+  downloadShareItem: (token: string, itemId: string, password?: string) =>
+    fetchShareBlob(token, `/public/share/${token}/items/${itemId}/download`, password),
 };
 
+/** An item inside a public folder share; path is relative to the shared folder. */
+export interface PublicShareItem {
+  id: string;
+  parentId: string;
+  name: string;
+  path: string;
+  isFolder: boolean;
+  size: number;
+  mimeType: string | null;
+  updatedAt: string;
+}
+
+async function fetchShareBlob(token: string, path: string, password?: string) {
+  const response = await fetch(`${getApiBaseUrl()}${path}`, {
+    headers: shareHeaders(token, password),
+    credentials: 'include',
+  });
+
+  if (response.status === 401) shareSessions.delete(token);
+  if (!response.ok) {
+    throw await toApiError(response);
+  }
+
+  const blob = await response.blob();
+  const fileName = getFileNameFromDisposition(
+    response.headers.get('Content-Disposition'),
+  );
+
+  return { blob, fileName };
+}
+
 // ── Spaces ────────────────────────────────────────────────────────────────────
 
+export type SpaceVisibility = 'open' | 'discoverable' | 'private';
+
 export interface Space {
   id: string;
   name: string;
   description?: string;
+  visibility: SpaceVisibility;
+  trash_retention_days: number;
   created_by?: string;
   created_at: string;
   updated_at: string;
@@ -932,6 +1292,34 @@ export interface SpaceMember {
   user?: { id: string; name: string; email: string };
 }
 
+export interface DiscoverableSpace extends Omit<Space, 'my_role'> {
+  requested_to_join: boolean;
+}
+
+export interface SpaceJoinRequest {
+  id: string;
+  created_at: string;
+  space_id: string;
+  user_id: string;
+  message: string;
+  status: 'pending' | 'approved' | 'rejected';
+  decided_by?: string;
+  decided_at?: string;
+  user?: { id: string; name: string; email: string };
+}
+
+export type SpaceJoinResult =
+  | { status: 'joined'; role: SpaceMember['role'] }
+  | { status: 'requested'; request: SpaceJoinRequest };
+
+export interface SpaceGroup {
+  space_id: string;
+  group_id: string;
+  role: 'viewer' | 'contributor' | 'admin';
+  added_at: string;
+  group?: Group;
+}
+
 export interface SpaceActivity {
   id: string;
   space_id: string;
@@ -947,12 +1335,53 @@ export interface SpaceActivity {
 export const spaceApi = {
   list: (): Promise<Space[]> => fetchApi<Space[]>('/spaces'),
 
-  create: (name: string, description?: string): Promise<Space> =>
+  create: (name: string, description?: string, visibility?: SpaceVisibility): Promise<Space> =>
     fetchApi<Space>('/spaces', {
       method: 'POST',
-      body: JSON.stringify({ name, description }),
+      body: JSON.stringify({ name, description, visibility }),
     }),
 
+  updateSettings: (
+    spaceId: string,
+    payload: { name?: string; description?: string; visibility?: SpaceVisibility; trashRetentionDays?: number },
+  ): Promise<Space> =>
+    fetchApi<Space>(`/spaces/${spaceId}`, {
+      method: 'PATCH',
+      body: JSON.stringify(payload),
+    }),
+
+  discover: (): Promise<DiscoverableSpace[]> => fetchApi<DiscoverableSpace[]>('/spaces/discover'),
+
+  join: (spaceId: string, message?: string): Promise<SpaceJoinResult> =>
+    fetchApi<SpaceJoinResult>(`/spaces/${spaceId}/join`, {
+      method: 'POST',
+      body: JSON.stringify({ message }),
+    }),
+
+  cancelJoin: (spaceId: string): Promise<{ message: string }> =>
+    fetchApi<{ message: string }>(`/spaces/${spaceId}/join`, { method: 'DELETE' }),
+
+  listJoinRequests: (
+    spaceId: string,
+    params?: { status?: SpaceJoinRequest['status']; page?: number; limit?: number },
+  ): Promise<PaginatedResponse<SpaceJoinRequest>> => {
+    const q = new URLSearchParams();
+    if (params?.status) q.set('status', params.status);
+    if (params?.page) q.set('page', String(params.page));
+    if (params?.limit) q.set('limit', String(params.limit));
+    const qs = q.toString();
+    return fetchApi<PaginatedResponse<SpaceJoinRequest>>(`/spaces/${spaceId}/join-requests${qs ? `?${qs}` : ''}`);
+  },
+
+  approveJoinRequest: (spaceId: string, requestId: string, role?: string): Promise<SpaceJoinRequest> =>
+    fetchApi<SpaceJoinRequest>(`/spaces/${spaceId}/join-requests/${requestId}/approve`, {
+      method: 'POST',
+      body: JSON.stringify({ role }),
+    }),
+
+  rejectJoinRequest: (spaceId: string, requestId: string): Promise<SpaceJoinRequest> =>
+    fetchApi<SpaceJoinRequest>(`/spaces/${spaceId}/join-requests/${requestId}/reject`, { method: 'POST' }),
+
   getFiles: (
     spaceId: string,
     params?: { page?: number; limit?: number; search?: string; category?: string; parentId?: string | null },
@@ -1004,9 +1433,37 @@ export const spaceApi = {
   deleteFile: (spaceId: string, fileId: string): Promise<{ message: string }> =>
     fetchApi<{ message: string }>(`/spaces/${spaceId}/files/${fileId}`, { method: 'DELETE' }),
 
+  getTrash: (
+    spaceId: string,
+    params?: { page?: number; limit?: number },
+  ): Promise<PaginatedResponse<FileMetadata> & { retention_days: number }> => {
+    const q = new URLSearchParams();
+    if (params?.page) q.set('page', String(params.page));
+    if (params?.limit) q.set('limit', String(params.limit));
+    const qs = q.toString();
+    return fetchApi<PaginatedResponse<FileMetadata> & { retention_days: number }>(
+      `/spaces/${spaceId}/trash${qs ? `?${qs}` : ''}`,
+    );
+  },
+
+  restoreFile: (spaceId: string, fileId: string): Promise<{ message: string }> =>
+    fetchApi<{ message: string }>(`/spaces/${spaceId}/trash/${fileId}/restore`, { method: 'POST' }),
+
+  purgeFile: (spaceId: string, fileId: string): Promise<{ message: string }> =>
+    fetchApi<{ message: string }>(`/spaces/${spaceId}/trash/${fileId}`, { method: 'DELETE' }),
+
+  emptyTrash: (spaceId: string): Promise<{ message: string }> =>
+    fetchApi<{ message: string }>(`/spaces/${spaceId}/trash`, { method: 'DELETE' }),
+
   listMembers: (spaceId: string): Promise<SpaceMember[]> =>
     fetchApi<SpaceMember[]>(`/spaces/${spaceId}/members`),
 
+  addMember: (spaceId: string, userId: string, role: string): Promise<SpaceMember> =>
+    fetchApi<SpaceMember>(`/spaces/${spaceId}/members`, {
+      method: 'POST',
+      body: JSON.stringify({ userId, role }),
+    }),
+
   updateMember: (spaceId: string, userId: string, role: string): Promise<{ message: string }> =>
     fetchApi<{ message: string }>(`/spaces/${spaceId}/members/${userId}`, {
       method: 'PATCH',
@@ -1016,6 +1473,24 @@ export const spaceApi = {
   removeMember: (spaceId: string, userId: string): Promise<{ message: string }> =>
     fetchApi<{ message: string }>(`/spaces/${spaceId}/members/${userId}`, { method: 'DELETE' }),
 
+  listGroups: (spaceId: string): Promise<SpaceGroup[]> =>
+    fetchApi<SpaceGroup[]>(`/spaces/${spaceId}/groups`),
+
+  addGroup: (spaceId: string, groupId: string, role: string): Promise<SpaceGroup> =>
+    fetchApi<SpaceGroup>(`/spaces/${spaceId}/groups`, {
+      method: 'POST',
+      body: JSON.stringify({ groupId, role }),
+    }),
+
+  updateGroup: (spaceId: string, groupId: string, role: string): Promise<{ message: string }> =>
+    fetchApi<{ message: string }>(`/spaces/${spaceId}/groups/${groupId}`, {
+      method: 'PATCH',
+      body: JSON.stringify({ role }),
+    }),
+
+  removeGroup: (spaceId: string, groupId: string): Promise<{ message: string }> =>
+    fetchApi<{ message: string }>(`/spaces/${spaceId}/groups/${groupId}`, { method: 'DELETE' }),
+
   getActivity: (
     spaceId: string,
     params?: { page?: number; limit?: number },
@@ -50,8 +50,10 @@ import {
   userApi,
   getApiBaseUrl,
   getAuthToken,
+  refreshSession,
   type FileMetadata,
   type ShareableUser,
+  type SharePermission,
   type UploadSessionInfo,
   ApiError,
 } from '@/lib/api';
@@ -262,9 +264,7 @@ export default function FilesPage() {
   const [shareUsers, setShareUsers] = useState<ShareableUser[]>([]);
   const [shareUsersLoading, setShareUsersLoading] = useState(false);
   const [selectedShareUserId, setSelectedShareUserId] = useState('');
-  const [sharePermission, setSharePermission] = useState<'read' | 'write'>(
-    'read',
-  );
+  const [sharePermission, setSharePermission] = useState<SharePermission>('read');
   const [publicSharePassword, setPublicSharePassword] = useState('');
   const [publicShareExpiresAt, setPublicShareExpiresAt] = useState('');
   const [publicSharePasswordError, setPublicSharePasswordError] = useState('');
@@ -940,7 +940,11 @@ export default function FilesPage() {
             return await attemptOnce();
           } catch (err) {
             attempt += 1;
+            // Long uploads outlive the access token; renew it and retry.
+            const expired =
+              err instanceof ApiError && err.statusCode === 401 && (await refreshSession());
             const retryable =
+              expired ||
               err instanceof Error &&
               (err.message === 'Network error' ||
                 err.message === 'Upload aborted' ||
@@ -1728,7 +1732,7 @@ export default function FilesPage() {
     }
     try {
       await fileApi.share(fileId, {
-        toUserId: selectedShareUserId,
+        granteeUserId: selectedShareUserId,
         permission: sharePermission,
       });
       setShareUserDialog({ open: false, file: null });
@@ -2462,7 +2466,7 @@ export default function FilesPage() {
                 <Select
                   value={sharePermission}
                   onValueChange={(v) =>
-                    setSharePermission(v as 'read' | 'write')
+                    setSharePermission(v as SharePermission)
                   }
                 >
                   <SelectTrigger id="share_permission">
@@ -2470,7 +2474,9 @@ export default function FilesPage() {
                   </SelectTrigger>
                   <SelectContent>
                     <SelectItem value="read">Read</SelectItem>
+                    <SelectItem value="comment">Comment</SelectItem>
                     <SelectItem value="write">Write</SelectItem>
+                    <SelectItem value="reshare">Write and reshare</SelectItem>
                   </SelectContent>
                 </Select>
               </div>
@@ -377,7 +377,7 @@ export default function SharedPage() {
                             <FileTypeIcon name={fileName} mimeType={mimeType} isFolder={isFolder} size={44} />
                             <Badge
                               variant={
-                                share.permission === 'write'
+                                share.permission === 'write' || share.permission === 'reshare'
                                   ? 'default'
                                   : 'secondary'
                               }
@@ -397,6 +397,7 @@ export default function SharedPage() {
                             <p className="text-xs text-muted-foreground mt-1">
                               Shared with{' '}
                               {share.grantee_user?.name ||
+                                (share.grantee_group && `${share.grantee_group.name} (group)`) ||
                                 share.grantee_email ||
                                 'Unknown'}
                             </p>
@@ -454,7 +455,7 @@ export default function SharedPage() {
                             <FileTypeIcon name={fileName} mimeType={mimeType} isFolder={isFolder} size={44} />
                             <Badge
                               variant={
-                                share.permission === 'write'
+                                share.permission === 'write' || share.permission === 'reshare'
                                   ? 'default'
                                   : 'secondary'
                               }
@@ -0,0 +1,8 @@
+import { useParams } from 'react-router-dom';
+import { FileRequestView } from '@/features/share/components/file-request-view';
+
+export default function FileRequestPage() {
+  const { token } = useParams<{ token: string }>();
+  if (!token) return null;
+  return <FileRequestView token={token} />;
+}
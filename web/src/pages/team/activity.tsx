@@ -2,7 +2,7 @@ import { useState, useEffect, useCallback } from 'react';
 import { spaceApi, type SpaceActivity } from '@/lib/api';
 import { Avatar, AvatarFallback } from '@/components/ui/avatar';
 import { Button } from '@/components/ui/button';
-import { Clock, Loader2, Upload, Trash2, Pencil, UserPlus, UserMinus, UserCog } from 'lucide-react';
+import { Clock, Loader2, Upload, Trash2, Pencil, Copy, UserPlus, UserMinus, UserCog, RotateCcw } from 'lucide-react';
 import { getInitials } from '@/lib/auth';
 import { cn } from '@/lib/utils';
 import { ToastContainer } from '@/components/toast-container';
@@ -10,8 +10,11 @@ import { ToastContainer } from '@/components/toast-container';
 const ACTION_ICON: Record<string, React.ElementType> = {
   upload: Upload,
   delete: Trash2,
+  restore: RotateCcw,
+  purge: Trash2,
   rename: Pencil,
   move: Pencil,
+  copy: Copy,
   member_added: UserPlus,
   member_removed: UserMinus,
   member_role_changed: UserCog,
@@ -19,9 +22,12 @@ const ACTION_ICON: Record<string, React.ElementType> = {
 
 const ACTION_LABEL: Record<string, string> = {
   upload: 'uploaded',
-  delete: 'deleted',
+  delete: 'moved to trash',
+  restore: 'restored',
+  purge: 'permanently deleted',
   rename: 'renamed',
   move: 'moved',
+  copy: 'copied',
   member_added: 'added a member',
   member_removed: 'removed a member',
   member_role_changed: 'updated a member role',
@@ -105,7 +111,7 @@ export default function TeamActivityPage() {
             {activities.map((act) => {
               const ActionIcon = ACTION_ICON[act.action] ?? Clock;
               const label = ACTION_LABEL[act.action] ?? act.action;
-              const userName = act.user?.name ?? 'Someone';
+              const userName = act.user?.name ?? (act.details?.auto ? 'Trash retention' : 'Someone');
               const isFileAction = !!act.file_name;
 
               return (